@@ -3,14 +3,19 @@ package agentize
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/ghiac/agentize/config"
 	"github.com/ghiac/agentize/debuger"
 	"github.com/ghiac/agentize/debuger/ui"
 	"github.com/ghiac/agentize/engine"
+	"github.com/ghiac/agentize/engine/mcp"
 	"github.com/ghiac/agentize/fsrepo"
 	"github.com/ghiac/agentize/llmutils"
 	"github.com/ghiac/agentize/log"
@@ -18,6 +23,7 @@ import (
 	"github.com/ghiac/agentize/store"
 	"github.com/ghiac/agentize/visualize"
 	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
 )
 
 // Version returns the current version of the library
@@ -53,8 +59,35 @@ type Agentize struct {
 	// Optional: provider for user billing/credit HTML on debug user detail page
 	userBillingHTMLProvider debuger.UserBillingHTMLProvider
 
+	// Debug page auto-refresh interval (<= 0 disables it)
+	debugRefreshInterval time.Duration
+
+	// Optional: store the debug pages read from instead of the session store (e.g. a replica)
+	debugReadStore model.SessionStore
+
 	// Optional: hook called after DeleteUserData (sessions/messages) so app can delete quota/consumption etc.
 	userDeleteDataHook func(userID string) error
+
+	// Optional: CoreHandler whose UserAgents' tools are listed at /agentize/tools.json
+	coreHandler *engine.CoreHandler
+
+	// Optional: metrics served at /metrics (see SetMetrics)
+	metrics http.Handler
+
+	// Optional: index behind the search_knowledge tool (see EnableKnowledgeSearch)
+	knowledgeIndex *engine.KnowledgeIndex
+
+	// Optional: connections to the MCP servers whose tools are registered (see ConnectMCP)
+	mcpServers *mcp.Manager
+
+	// Tool merge strategy applied to LLM configs that don't set one (see WithMergeStrategy)
+	mergeStrategy model.MergeStrategy
+
+	// Optional: scheduler config used instead of the environment (see WithScheduler)
+	schedulerConfig *engine.SessionSchedulerConfig
+
+	// Optional: LLM of the summarization scheduler instead of the engine's (see WithSummarizerLLM)
+	summarizerLLM *engine.LLMConfig
 }
 
 // Options allows configuring Agentize behavior
@@ -65,19 +98,92 @@ type Options struct {
 	Repository *fsrepo.NodeRepository
 	// FunctionRegistry allows providing an existing function registry instead of creating a new one
 	FunctionRegistry *model.FunctionRegistry
+	// Strict validates the knowledge tree with fsrepo.Validate before loading
+	// and fails if any error-severity issue is found
+	Strict bool
+	// AllowCycles logs routing cycles in the knowledge tree as warnings instead of failing to load
+	AllowCycles bool
+	// AllowJump lets sessions jump to any node (Engine.JumpTo) and offers the goto_node tool to the model
+	AllowJump bool
+	// MergeStrategy sets how node tools combine for every agent (see WithMergeStrategy)
+	MergeStrategy model.MergeStrategy
+	// LLM configures the LLM and builds a CoreHandler (see WithLLM)
+	LLM *engine.LLMConfig
+	// VisionLLM configures the CoreHandler's LLM for image messages (see WithVisionLLM)
+	VisionLLM *engine.LLMConfig
+	// CoreLLM configures the LLM of the Core's own decisions (see WithCoreLLM)
+	CoreLLM *engine.LLMConfig
+	// SummarizerLLM configures the LLM that summarizes sessions (see WithSummarizerLLM)
+	SummarizerLLM *engine.LLMConfig
+	// CoreConfig is the CoreHandler config (see WithCoreConfig)
+	CoreConfig *engine.CoreHandlerConfig
+	// Agents configures the CoreHandler's agents by name (see WithAgents)
+	Agents map[string]EngineConfig
+	// Scheduler is the summarization scheduler config (see WithScheduler)
+	Scheduler *engine.SessionSchedulerConfig
+	// Logger receives the logs of the engines, the CoreHandler, the scheduler and the store
+	// (see WithLogger)
+	Logger log.FieldLogger
 }
 
-// New creates a new Agentize instance by loading the entire knowledge tree from the given path
-func New(path string) (*Agentize, error) {
-	return NewWithOptions(path, nil)
+// New creates a new Agentize instance by loading the entire knowledge tree from the given path.
+// With WithLLM it also builds a fully wired CoreHandler, available from GetCoreHandler:
+//
+//	ag, err := agentize.New("./knowledge",
+//		agentize.WithStore(sessionStore),
+//		agentize.WithLLM(engine.LLMConfig{APIKey: apiKey, Model: "gpt-4o-mini"}),
+//		agentize.WithAgents(map[string]agentize.EngineConfig{"billing": {Repository: billingRepo}}),
+//	)
+//	reply, err := ag.GetCoreHandler().ProcessMessage(ctx, userID, message)
+func New(path string, opts ...Option) (*Agentize, error) {
+	var options Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return NewWithOptions(path, &options)
+}
+
+// validateStrict runs fsrepo.Validate and returns an error listing every error-severity issue
+func validateStrict(path string) error {
+	issues, err := fsrepo.Validate(path)
+	if err != nil {
+		return fmt.Errorf("failed to validate knowledge tree: %w", err)
+	}
+	var errs []string
+	for _, issue := range issues {
+		if issue.Severity == fsrepo.SeverityError {
+			errs = append(errs, issue.String())
+		} else {
+			log.Log.Warn("[Agentize] ⚠️  Knowledge tree issue", "issue", issue)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("knowledge tree validation failed with %d error(s):\n  %s", len(errs), strings.Join(errs, "\n  "))
+	}
+	return nil
 }
 
 // NewWithOptions creates a new Agentize instance with custom options
 func NewWithOptions(path string, opts *Options) (*Agentize, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if !model.IsValidMergeStrategy(opts.MergeStrategy) {
+		return nil, fmt.Errorf("invalid merge strategy %q", opts.MergeStrategy)
+	}
+	if opts.LLM == nil && (opts.VisionLLM != nil || opts.CoreLLM != nil || opts.SummarizerLLM != nil || opts.CoreConfig != nil || len(opts.Agents) > 0) {
+		return nil, fmt.Errorf("vision, core and summarizer LLMs, core config and agents require an LLM config (WithLLM)")
+	}
+	if opts.Strict {
+		if err := validateStrict(path); err != nil {
+			return nil, err
+		}
+	}
+
 	// Use existing repository or create a new one
 	var repo *fsrepo.NodeRepository
 	var err error
-	if opts != nil && opts.Repository != nil {
+	if opts.Repository != nil {
 		repo = opts.Repository
 	} else {
 		repo, err = fsrepo.NewNodeRepository(path)
@@ -85,10 +191,19 @@ func NewWithOptions(path string, opts *Options) (*Agentize, error) {
 			return nil, fmt.Errorf("failed to create repository: %w", err)
 		}
 	}
+	if opts.AllowCycles {
+		repo.SetAllowCycles(true)
+	}
+	if opts.AllowJump {
+		repo.SetAllowJump(true)
+	}
+	if err := repo.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load knowledge tree: %w", err)
+	}
 
 	// Determine session store
 	var sessionStore store.SessionStore
-	if opts != nil && opts.SessionStore != nil {
+	if opts.SessionStore != nil {
 		sessionStore = opts.SessionStore
 	} else {
 		dbStore, err := store.NewDBStore()
@@ -97,10 +212,15 @@ func NewWithOptions(path string, opts *Options) (*Agentize, error) {
 		}
 		sessionStore = dbStore
 	}
+	if opts.Logger != nil {
+		if loggable, ok := sessionStore.(interface{ SetLogger(log.FieldLogger) }); ok {
+			loggable.SetLogger(opts.Logger)
+		}
+	}
 
 	// Determine function registry
 	functionRegistry := model.NewFunctionRegistry()
-	if opts != nil && opts.FunctionRegistry != nil {
+	if opts.FunctionRegistry != nil {
 		functionRegistry = opts.FunctionRegistry
 	}
 
@@ -109,6 +229,7 @@ func NewWithOptions(path string, opts *Options) (*Agentize, error) {
 		Repo:      repo,
 		Sessions:  sessionStore,
 		Functions: functionRegistry,
+		Logger:    opts.Logger,
 	}
 	eng.Executor = func(toolName string, args map[string]interface{}) (string, error) {
 		if eng.Functions == nil {
@@ -116,11 +237,23 @@ func NewWithOptions(path string, opts *Options) (*Agentize, error) {
 		}
 		return eng.Functions.Execute(toolName, args)
 	}
+	if repo.AllowsJump() {
+		if err := eng.RegisterNavigationTools(); err != nil {
+			return nil, fmt.Errorf("failed to register navigation tools: %w", err)
+		}
+	}
+	if err := eng.RegisterHTTPTools(); err != nil {
+		return nil, err
+	}
 
 	// Create Agentize instance
 	ag := &Agentize{
-		engine: eng,
-		nodes:  make(map[string]*model.Node),
+		engine:               eng,
+		nodes:                make(map[string]*model.Node),
+		debugRefreshInterval: debuger.DefaultRefreshInterval,
+		mergeStrategy:        opts.MergeStrategy,
+		schedulerConfig:      opts.Scheduler,
+		summarizerLLM:        opts.SummarizerLLM,
 	}
 
 	// Load all nodes recursively (for visualization cache)
@@ -128,6 +261,18 @@ func NewWithOptions(path string, opts *Options) (*Agentize, error) {
 		return nil, fmt.Errorf("failed to load knowledge tree: %w", err)
 	}
 
+	if opts.LLM != nil {
+		llm := *opts.LLM
+		if err := ag.UseLLMConfig(llm); err != nil {
+			return nil, fmt.Errorf("failed to configure LLM: %w", err)
+		}
+		ch, err := ag.newCoreHandler(llm, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create core handler: %w", err)
+		}
+		ag.SetCoreHandler(ch)
+	}
+
 	return ag, nil
 }
 
@@ -227,14 +372,71 @@ func (ag *Agentize) GetNodePaths() []string {
 	return paths
 }
 
-// Reload reloads all nodes from the filesystem
+// Reload reloads all nodes from the filesystem.
+// The new tree is fully parsed before it replaces the current one, so concurrent
+// readers never observe a half-loaded tree; on error the current tree is kept.
 func (ag *Agentize) Reload() error {
+	if err := ag.engine.Repo.Reload(); err != nil {
+		return err
+	}
+	ag.refreshNodesFromRepo()
+	return nil
+}
+
+// refreshNodesFromRepo swaps the node cache with the repository's current tree and
+// re-registers the http tools it declares
+func (ag *Agentize) refreshNodesFromRepo() {
+	nodes := ag.engine.Repo.CachedNodes()
 	ag.mu.Lock()
-	ag.nodes = make(map[string]*model.Node)
-	ag.engine.Repo.InvalidateCache("")
+	ag.nodes = nodes
 	ag.mu.Unlock()
+	if err := ag.engine.RegisterHTTPTools(); err != nil {
+		log.Log.Warn("[Agentize] ⚠️  Failed to register HTTP tools", "error", err)
+	}
+}
 
-	return ag.loadAllNodes()
+// StartKnowledgeWatcher watches the knowledge tree and hot-reloads it when node files change.
+// It runs in the background until ctx is cancelled. interval is only used when the tree has to be
+// polled (see fsrepo.NodeRepository.Watch); <= 0 uses fsrepo.DefaultWatchInterval.
+func (ag *Agentize) StartKnowledgeWatcher(ctx context.Context, interval time.Duration) {
+	go ag.engine.Repo.Watch(ctx, interval, ag.refreshNodesFromRepo)
+}
+
+// StartRemoteKnowledgeWatcher polls loader's source and hot-swaps the knowledge tree when it changes.
+// The repository must have been built by loader.Load. interval <= 0 uses fsrepo.DefaultRemoteWatchInterval.
+func (ag *Agentize) StartRemoteKnowledgeWatcher(ctx context.Context, loader *fsrepo.RemoteLoader, interval time.Duration) {
+	go loader.Watch(ctx, ag.engine.Repo, interval, ag.refreshNodesFromRepo)
+}
+
+// EnableKnowledgeSearch indexes the content (node.md) of every knowledge node, embedded with
+// provider, and offers the search_knowledge tool to the engine and to the CoreHandler and its
+// UserAgents (call it after SetCoreHandler when the handler is not built by New). The index is
+// persisted to the session store when it implements model.KnowledgeIndexStore, rebuilt on every
+// reload, and its stats are shown at /agentize/debug/knowledge.
+func (ag *Agentize) EnableKnowledgeSearch(provider engine.EmbeddingProvider, config engine.KnowledgeIndexConfig) *engine.KnowledgeIndex {
+	indexStore, _ := ag.engine.Sessions.(model.KnowledgeIndexStore)
+	index := engine.NewKnowledgeIndex(provider, ag.engine.Repo, indexStore, config)
+	ag.engine.SetKnowledgeIndex(index)
+	if ag.coreHandler != nil {
+		ag.coreHandler.SetKnowledgeIndex(index)
+	}
+	ag.knowledgeIndex = index
+	return index
+}
+
+// ConnectMCP connects to the MCP servers (see config.Config.MCPServers) and registers their
+// tools. Servers that cannot be reached are logged and their tools are not offered; see
+// mcp.Manager.Status. The connections are closed on shutdown.
+func (ag *Agentize) ConnectMCP(ctx context.Context, servers map[string]config.MCPServerConfig) *mcp.Manager {
+	manager := mcp.Connect(ctx, servers)
+	manager.Register(ag)
+	ag.mcpServers = manager
+	return manager
+}
+
+// GetReloadStats returns the knowledge tree reload counter and last reload time
+func (ag *Agentize) GetReloadStats() fsrepo.ReloadStats {
+	return ag.engine.Repo.GetReloadStats()
 }
 
 // ReloadNode reloads a specific node from the filesystem
@@ -245,7 +447,10 @@ func (ag *Agentize) ReloadNode(path string) error {
 	ag.engine.Repo.InvalidateCache(path)
 	delete(ag.nodes, path)
 
-	return ag.loadNodeRecursiveLocked(path)
+	if err := ag.loadNodeRecursiveLocked(path); err != nil {
+		return err
+	}
+	return ag.engine.RegisterHTTPTools()
 }
 
 // ============================================================================
@@ -275,6 +480,15 @@ func (ag *Agentize) GetRegisteredTools() []string {
 	return nil
 }
 
+// ToolDefinitions returns the tools the agents expose, de-duplicated by name: those of both
+// UserAgent engines when a CoreHandler is set (see SetCoreHandler), otherwise the engine's own
+func (ag *Agentize) ToolDefinitions() []openai.Tool {
+	if ag.coreHandler != nil {
+		return ag.coreHandler.ToolDefinitions()
+	}
+	return ag.engine.ToolDefinitions()
+}
+
 // ============================================================================
 // LLM Configuration
 // ============================================================================
@@ -282,6 +496,9 @@ func (ag *Agentize) GetRegisteredTools() []string {
 // UseLLMConfig configures the LLM client for the agentize instance
 // It also automatically starts the scheduler if enabled
 func (ag *Agentize) UseLLMConfig(config engine.LLMConfig) error {
+	if config.ToolMergeStrategy == "" {
+		config.ToolMergeStrategy = ag.mergeStrategy
+	}
 	if err := ag.engine.UseLLMConfig(config); err != nil {
 		return err
 	}
@@ -289,7 +506,7 @@ func (ag *Agentize) UseLLMConfig(config engine.LLMConfig) error {
 	// Automatically start scheduler if LLM is configured
 	ctx := context.Background()
 	if err := ag.StartScheduler(ctx); err != nil {
-		log.Log.Warnf("[Agentize] ⚠️  Failed to start scheduler: %v", err)
+		log.Log.Warn("[Agentize] ⚠️  Failed to start scheduler", "error", err)
 	}
 
 	return nil
@@ -298,6 +515,40 @@ func (ag *Agentize) UseLLMConfig(config engine.LLMConfig) error {
 // UseFunctionRegistry configures the function registry for tool execution
 func (ag *Agentize) UseFunctionRegistry(registry *model.FunctionRegistry) {
 	ag.engine.UseFunctionRegistry(registry)
+	if ag.engine.Repo.AllowsJump() && !ag.engine.Functions.Has("goto_node") {
+		if err := ag.engine.RegisterNavigationTools(); err != nil {
+			log.Log.Warn("[Agentize] ⚠️  Failed to register navigation tools", "error", err)
+		}
+	}
+	if err := ag.engine.RegisterHTTPTools(); err != nil {
+		log.Log.Warn("[Agentize] ⚠️  Failed to register HTTP tools", "error", err)
+	}
+}
+
+// RegisterFunction adds a tool at runtime (see engine.Engine.RegisterFunction)
+func (ag *Agentize) RegisterFunction(name string, def openai.FunctionDefinition, handler func(ctx context.Context, args map[string]any) (string, error)) error {
+	return ag.engine.RegisterFunction(name, def, handler)
+}
+
+// RegisterMCPFunction registers a tool proxied to an MCP server (see engine.Engine.RegisterMCPFunction)
+func (ag *Agentize) RegisterMCPFunction(server string, name string, def openai.FunctionDefinition, handler func(ctx context.Context, args map[string]any) (string, error)) error {
+	return ag.engine.RegisterMCPFunction(server, name, def, handler)
+}
+
+// UnregisterFunction removes a tool registered at runtime
+func (ag *Agentize) UnregisterFunction(name string) bool {
+	return ag.engine.UnregisterFunction(name)
+}
+
+// BindTool binds a Go handler to a tool declared in the knowledge tree (see engine.Engine.BindTool)
+func (ag *Agentize) BindTool(name string, handler model.ToolFunction) error {
+	return ag.engine.BindTool(name, handler)
+}
+
+// VerifyTools logs every tool declared in the knowledge tree without a handler and, if strict,
+// fails listing them. Call it once all handlers are registered.
+func (ag *Agentize) VerifyTools(strict bool) error {
+	return ag.engine.VerifyTools(strict)
 }
 
 // InitializeSummaries generates concise summaries for all nodes that don't have one
@@ -337,6 +588,11 @@ func (ag *Agentize) CreateSession(userID string) (*model.Session, error) {
 	return ag.engine.CreateSession(userID)
 }
 
+// SetTemplateVars sets application values available to node.md templates as {{.Vars.key}}
+func (ag *Agentize) SetTemplateVars(vars map[string]interface{}) {
+	ag.engine.SetTemplateVars(vars)
+}
+
 // SetProgress sets the progress state for a session
 func (ag *Agentize) SetProgress(sessionID string, inProgress bool) error {
 	return ag.engine.SetProgress(sessionID, inProgress)
@@ -377,12 +633,42 @@ func (ag *Agentize) SetUserBillingHTMLProvider(fn debuger.UserBillingHTMLProvide
 	ag.userBillingHTMLProvider = fn
 }
 
+// SetDebugRefreshInterval sets how often debug pages reload themselves (default 30s).
+// Use 0 to disable auto-refresh entirely.
+func (ag *Agentize) SetDebugRefreshInterval(interval time.Duration) {
+	ag.debugRefreshInterval = interval
+}
+
+// SetDebugReadStore routes the debug pages' read queries to store (e.g. a replica, or a MongoDB
+// store with ReadPreference "secondaryPreferred") so dashboards do not load the primary database.
+// Actions that modify data still use the session store. nil reads from the session store again.
+func (ag *Agentize) SetDebugReadStore(store model.SessionStore) {
+	ag.debugReadStore = store
+}
+
 // SetUserDeleteDataHook sets an optional hook called after DeleteUserData (sessions, messages) for a user.
 // The application can use it to delete quota usage, consumption records, balance, etc. for that user.
 func (ag *Agentize) SetUserDeleteDataHook(fn func(userID string) error) {
 	ag.userDeleteDataHook = fn
 }
 
+// SetCoreHandler sets the CoreHandler whose UserAgent engines' tools are exported by ToolDefinitions
+func (ag *Agentize) SetCoreHandler(ch *engine.CoreHandler) {
+	ag.coreHandler = ch
+}
+
+// GetCoreHandler returns the CoreHandler built by New with WithLLM or set with SetCoreHandler
+// (nil if there is none)
+func (ag *Agentize) GetCoreHandler() *engine.CoreHandler {
+	return ag.coreHandler
+}
+
+// SetMetrics serves metrics (e.g. an engine.PrometheusCallback attached to the CoreHandler) at
+// /metrics. It must be called before RegisterRoutes; without it /metrics is not registered.
+func (ag *Agentize) SetMetrics(metrics http.Handler) {
+	ag.metrics = metrics
+}
+
 // GetDebugNavItems returns the full set of navigation items including extra pages.
 func (ag *Agentize) GetDebugNavItems() []ui.NavItem {
 	items := ui.DefaultNavItems()
@@ -392,15 +678,30 @@ func (ag *Agentize) GetDebugNavItems() []ui.NavItem {
 	return items
 }
 
+// shutdownTimeout bounds how long WaitForShutdown waits for messages in progress
+const shutdownTimeout = 30 * time.Second
+
 // WaitForShutdown waits for shutdown signals and performs graceful shutdown
 func (ag *Agentize) WaitForShutdown() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 
 	sig := <-sigChan
-	log.Log.Infof("[Agentize] 📡 Received signal: %v, initiating graceful shutdown...", sig)
+	log.Log.Info("[Agentize] 📡 Received signal, initiating graceful shutdown...", "signal", sig)
 
 	ag.StopScheduler()
 
-	log.Log.Infof("[Agentize] ✅ Graceful shutdown completed")
+	// Let messages in progress finish so sessions and sequence counters are saved
+	if ag.coreHandler != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := ag.coreHandler.Shutdown(ctx); err != nil {
+			log.Log.Warn("[Agentize] ⚠️  Core handler shutdown", "error", err)
+		}
+		cancel()
+	}
+	if ag.mcpServers != nil {
+		ag.mcpServers.Close()
+	}
+
+	log.Log.Info("[Agentize] ✅ Graceful shutdown completed")
 }
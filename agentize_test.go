@@ -1,10 +1,22 @@
 package agentize
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/engine"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
 )
 
 func TestNew(t *testing.T) {
@@ -59,6 +71,242 @@ func TestNewWithOptions(t *testing.T) {
 	}
 }
 
+func TestNewWithFunctionalOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Hello!"},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	defer server.Close()
+
+	tmpDir := createTestKnowledgeTree(t)
+	defer os.RemoveAll(tmpDir)
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	schedulerConfig := engine.DefaultSessionSchedulerConfig()
+	schedulerConfig.CheckInterval = time.Hour
+	ag, err := New(tmpDir,
+		WithStore(sqliteStore),
+		WithMergeStrategy(model.MergeStrategyAppendDedupe),
+		WithLLM(engine.LLMConfig{APIKey: "test", BaseURL: server.URL, Model: "core-model"}),
+		WithAgents(map[string]EngineConfig{
+			"low":     {Model: "cheap-model"},
+			"billing": {},
+		}),
+		WithScheduler(schedulerConfig),
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer ag.StopScheduler()
+
+	ch := ag.GetCoreHandler()
+	if ch == nil {
+		t.Fatal("Expected a CoreHandler")
+	}
+	if names := ch.NamedAgents(); len(names) != 1 || names[0] != "billing" {
+		t.Errorf("Expected the billing named agent, got %v", names)
+	}
+	high, low := ch.GetUserAgentHigh().GetLLMConfig(), ch.GetUserAgentLow().GetLLMConfig()
+	if high.Model != engine.DefaultCoreHandlerConfig().UserAgentHighModel || low.Model != "cheap-model" {
+		t.Errorf("Unexpected agent models high=%q low=%q", high.Model, low.Model)
+	}
+	if high.ToolMergeStrategy != model.MergeStrategyAppendDedupe || ag.GetEngine().GetLLMConfig().ToolMergeStrategy != model.MergeStrategyAppendDedupe {
+		t.Errorf("Expected the merge strategy on every engine, got %q", high.ToolMergeStrategy)
+	}
+	if cfg := ag.GetSchedulerConfig(); cfg == nil || cfg.CheckInterval != time.Hour {
+		t.Errorf("Expected the WithScheduler config, got %+v", cfg)
+	}
+
+	reply, err := ch.ProcessMessage(context.Background(), "user1", "What can you help me with?")
+	if err != nil || reply != "Hello!" {
+		t.Errorf("ProcessMessage = %q, %v", reply, err)
+	}
+
+	if _, err := New(tmpDir, WithStore(sqliteStore), WithMergeStrategy("newest")); err == nil {
+		t.Error("Expected an error for an unknown merge strategy")
+	}
+	if _, err := New(tmpDir, WithStore(sqliteStore), WithAgents(map[string]EngineConfig{"billing": {}})); err == nil {
+		t.Error("Expected an error for agents without an LLM config")
+	}
+}
+
+func TestNewWithPerAgentLLM(t *testing.T) {
+	// One fake provider per agent, counting the calls it gets
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	newProvider := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			calls[name]++
+			mu.Unlock()
+			json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Hello from " + name},
+				FinishReason: openai.FinishReasonStop,
+			}}})
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	defaultProvider, highProvider, lowProvider := newProvider("default"), newProvider("high"), newProvider("low")
+	coreProvider, summarizerProvider := newProvider("core"), newProvider("summarizer")
+
+	tmpDir := createTestKnowledgeTree(t)
+	defer os.RemoveAll(tmpDir)
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	schedulerConfig := engine.DefaultSessionSchedulerConfig()
+	schedulerConfig.CheckInterval = time.Hour
+	ag, err := New(tmpDir,
+		WithStore(sqliteStore),
+		WithLLM(engine.LLMConfig{APIKey: "default-key", BaseURL: defaultProvider.URL, Model: "default-model"}),
+		WithAgents(map[string]EngineConfig{
+			"high": {LLM: &engine.LLMConfig{APIKey: "azure-key", BaseURL: highProvider.URL}},
+			"low":  {LLM: &engine.LLMConfig{BaseURL: lowProvider.URL, Model: "llama"}},
+		}),
+		WithCoreLLM(engine.LLMConfig{BaseURL: coreProvider.URL}),
+		WithSummarizerLLM(engine.LLMConfig{BaseURL: summarizerProvider.URL, Model: "summary-model"}),
+		WithScheduler(schedulerConfig),
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer ag.StopScheduler()
+
+	// Unset fields inherit the WithLLM config, except the API key of another provider
+	ch := ag.GetCoreHandler()
+	high, low := ch.GetUserAgentHigh(), ch.GetUserAgentLow()
+	if cfg := high.GetLLMConfig(); cfg.APIKey != "azure-key" || cfg.Model != engine.DefaultCoreHandlerConfig().UserAgentHighModel {
+		t.Errorf("Unexpected high config: key %q, model %q", cfg.APIKey, cfg.Model)
+	}
+	if cfg := low.GetLLMConfig(); cfg.APIKey != "" || cfg.Model != "llama" {
+		t.Errorf("Unexpected low config: key %q, model %q", cfg.APIKey, cfg.Model)
+	}
+
+	ctx := context.Background()
+	if reply, err := ch.ProcessMessage(ctx, "user1", "What can you help me with?"); err != nil || reply != "Hello from core" {
+		t.Errorf("Core ProcessMessage = %q, %v", reply, err)
+	}
+	for name, agent := range map[string]*engine.Engine{"high": high, "low": low} {
+		session, err := agent.CreateSession("user2")
+		if err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
+		reply, _, err := agent.ProcessMessage(ctx, session.SessionID, "Please check my order status")
+		if err != nil || reply != "Hello from "+name {
+			t.Errorf("%s ProcessMessage = %q, %v", name, reply, err)
+		}
+		if name == "low" {
+			if _, err := ag.SummarizeSessionNow(ctx, session.SessionID); err != nil {
+				t.Errorf("SummarizeSessionNow failed: %v", err)
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{"core", "high", "low", "summarizer"} {
+		if calls[name] == 0 {
+			t.Errorf("Expected the %s provider to be called, got %v", name, calls)
+		}
+	}
+	if calls["default"] != 0 {
+		t.Errorf("Expected no calls to the default provider, got %d", calls["default"])
+	}
+}
+
+func TestReplaySession(t *testing.T) {
+	// Fake chat completions endpoint answering with the requested model's name
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		last := req.Messages[len(req.Messages)-1]
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: req.Model + " answers: " + last.Content},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	defer server.Close()
+
+	tmpDir := createTestKnowledgeTree(t)
+	defer os.RemoveAll(tmpDir)
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	schedulerConfig := engine.DefaultSessionSchedulerConfig()
+	schedulerConfig.CheckInterval = time.Hour
+	ag, err := New(tmpDir,
+		WithStore(sqliteStore),
+		WithLLM(engine.LLMConfig{APIKey: "test", BaseURL: server.URL, Model: "old-model"}),
+		WithScheduler(schedulerConfig),
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer ag.StopScheduler()
+
+	ctx := context.Background()
+	session, err := ag.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	for _, msg := range []string{"Where is my order?", "It was placed last Monday"} {
+		session.Msgs = append(session.Msgs,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: msg},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "old-model answers: " + msg})
+	}
+	if err := sqliteStore.Put(session); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	before, _ := sqliteStore.Get(session.SessionID)
+
+	transcript, err := ag.ReplaySession(ctx, session.SessionID, "new-model")
+	if err != nil {
+		t.Fatalf("ReplaySession failed: %v", err)
+	}
+	var replies []string
+	for _, msg := range transcript {
+		if msg.Role == openai.ChatMessageRoleAssistant {
+			replies = append(replies, msg.Content)
+		}
+	}
+	want := []string{"new-model answers: Where is my order?", "new-model answers: It was placed last Monday"}
+	if fmt.Sprint(replies) != fmt.Sprint(want) {
+		t.Errorf("Expected replies %q, got %q", want, replies)
+	}
+
+	// The original session is untouched and the throwaway session is gone
+	after, _ := sqliteStore.Get(session.SessionID)
+	if len(after.Msgs) != len(before.Msgs) || after.Msgs[len(after.Msgs)-1].Content != "old-model answers: It was placed last Monday" {
+		t.Errorf("Expected the original session to be unchanged, got %+v", after.Msgs)
+	}
+	all, err := sqliteStore.GetAllSessions()
+	if err != nil {
+		t.Fatalf("GetAllSessions failed: %v", err)
+	}
+	for userID := range all {
+		if userID != "user1" && len(all[userID]) > 0 {
+			t.Errorf("Expected the replay session to be deleted, found sessions of %s", userID)
+		}
+	}
+
+	if _, err := ag.ReplaySession(ctx, "missing-session", "new-model"); err == nil {
+		t.Error("Expected an error for an unknown session")
+	}
+}
+
 func TestGetNode(t *testing.T) {
 	tmpDir := createTestKnowledgeTree(t)
 	defer os.RemoveAll(tmpDir)
@@ -666,3 +914,47 @@ func TestScenario_TBD(t *testing.T) {
 	// ============================================
 	t.Log("Knowledge tree loading test completed successfully")
 }
+
+func TestDebugReadStore(t *testing.T) {
+	tmpDir := createTestKnowledgeTree(t)
+	defer os.RemoveAll(tmpDir)
+
+	primary, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create primary store: %v", err)
+	}
+	defer primary.Close()
+	replica, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create replica store: %v", err)
+	}
+	defer replica.Close()
+	if err := replica.Put(model.NewSessionWithType("user1", model.AgentTypeCore)); err != nil {
+		t.Fatalf("Failed to put session: %v", err)
+	}
+
+	ag, err := NewWithOptions(tmpDir, &Options{SessionStore: primary})
+	if err != nil {
+		t.Fatalf("Failed to create Agentize: %v", err)
+	}
+	ag.SetDebugReadStore(replica)
+	handler, err := ag.createDebugHandler()
+	if err != nil {
+		t.Fatalf("Failed to create debug handler: %v", err)
+	}
+
+	// Pages read from the replica, writes go to the primary
+	if sessions, _ := handler.GetStore().GetAllSessions(); len(sessions) != 1 {
+		t.Errorf("Expected the pages to read the replica's session, got %d users", len(sessions))
+	}
+	if handler.GetWriteStore() != primary {
+		t.Error("Expected writes to go to the primary store")
+	}
+
+	if err := handler.SetReadStore(nil); err != nil {
+		t.Fatalf("SetReadStore(nil) failed: %v", err)
+	}
+	if sessions, _ := handler.GetStore().GetAllSessions(); len(sessions) != 0 {
+		t.Errorf("Expected the primary to be read again, got %d users", len(sessions))
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ghiac/agentize/config"
+	"github.com/ghiac/agentize/fsrepo"
+)
+
+// runGraph implements "agentize graph [-format dot|mermaid|json] [-user id] [path]": it prints
+// the knowledge tree diagram to stdout, e.g. to embed it in docs or diff it in CI.
+func runGraph(args []string) int {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	format := fs.String("format", string(fsrepo.GraphFormatDOT), "output format: dot, mermaid or json")
+	userID := fs.String("user", "", "only include nodes visible in graph to this user")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: agentize graph [-format dot|mermaid|json] [-user id] [knowledge-path]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	path := fs.Arg(0)
+	if path == "" {
+		cfg, err := config.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+			return 2
+		}
+		path = cfg.KnowledgePath
+	}
+
+	repo, err := fsrepo.NewNodeRepository(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "graph: %v\n", err)
+		return 1
+	}
+
+	var opts []fsrepo.GraphOption
+	if *userID != "" {
+		opts = append(opts, fsrepo.OptGraphUser(*userID))
+	}
+	data, err := repo.ExportGraph(fsrepo.GraphFormat(*format), opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "graph: %v\n", err)
+		return 2
+	}
+	os.Stdout.Write(data)
+	return 0
+}
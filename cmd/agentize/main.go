@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/ghiac/agentize"
+	"github.com/ghiac/agentize/config"
+	"github.com/ghiac/agentize/engine"
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/store"
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "graph":
+			os.Exit(runGraph(os.Args[2:]))
+		case "session":
+			os.Exit(runSession(os.Args[2:]))
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	log.SetFormat(log.Format(cfg.LogFormat))
+
+	flag.StringVar(&cfg.KnowledgePath, "knowledge", cfg.KnowledgePath, "path to the knowledge tree; comma-separated paths are merged, later ones overriding earlier ones")
+	repl := flag.Bool("repl", false, "run an interactive REPL on stdin instead of waiting for signals")
+	userID := flag.String("user", "local", "user ID used for REPL messages")
+	verbose := flag.Bool("verbose", false, "show info logs in REPL mode")
+	flag.BoolVar(&cfg.KnowledgeStrict, "strict", cfg.KnowledgeStrict, "validate the knowledge tree and refuse to start on errors")
+	flag.StringVar(&cfg.LLM.RecordDir, "record", cfg.LLM.RecordDir, "record every LLM request/response pair to this directory")
+	flag.StringVar(&cfg.LLM.ReplayDir, "replay", cfg.LLM.ReplayDir, "serve LLM calls from the pairs recorded in this directory instead of calling the model")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration (secrets masked) at startup")
+	flag.Parse()
+
+	if *printConfig {
+		out, err := cfg.Masked().YAML()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to print config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("# effective configuration\n%s", out)
+	}
+	if err := cfg.Validate(); err != nil {
+		var verr *config.ValidationError
+		if errors.As(err, &verr) {
+			fmt.Fprintln(os.Stderr, "invalid configuration:")
+			for _, problem := range verr.Problems {
+				fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		}
+		os.Exit(1)
+	}
+
+	level, _ := cfg.SlogLevel()
+	if *repl && !*verbose && level < slog.LevelWarn {
+		level = slog.LevelWarn
+	}
+	log.SetLevel(level)
+	log.SetRedaction(cfg.LogRedact)
+
+	sessionStore, err := openStore(cfg.Store)
+	if err != nil {
+		log.Log.Error("[Main] ❌ Failed to open session store", "error", err)
+		os.Exit(1)
+	}
+
+	opts := []agentize.Option{
+		agentize.WithStore(sessionStore),
+		agentize.WithStrict(cfg.KnowledgeStrict),
+		agentize.WithAllowCycles(cfg.KnowledgeAllowCycles),
+		agentize.WithAllowJump(cfg.KnowledgeAllowJump),
+	}
+	if roots := knowledgeRoots(cfg.KnowledgePath); len(roots) > 1 {
+		repo, err := fsrepo.NewMultiRootRepository(roots...)
+		if err != nil {
+			log.Log.Error("[Main] ❌ Failed to open knowledge roots", "error", err)
+			os.Exit(1)
+		}
+		if cfg.KnowledgeStrict {
+			// fsrepo.Validate checks a single directory; the merged tree is still checked when loading
+			log.Log.Warn("[Main] ⚠️  -strict validation skipped for a multi-root knowledge tree", "roots", strings.Join(roots, ", "))
+			opts = append(opts, agentize.WithStrict(false))
+		}
+		opts = append(opts, agentize.WithRepository(repo))
+	}
+	if *repl {
+		llmOpts, err := replLLMOptions(cfg.LLM)
+		if err != nil {
+			log.Log.Error("[Main] ❌ Failed to initialize core handler", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, llmOpts...)
+	}
+	ag, err := agentize.New(cfg.KnowledgePath, opts...)
+	if err != nil {
+		log.Log.Error("[Main] ❌ Failed to load knowledge tree", "error", err)
+		os.Exit(1)
+	}
+	log.Log.Info("[Main] ✅ Knowledge tree loaded", "path", cfg.KnowledgePath, "nodes", len(ag.GetAllNodes()))
+
+	ag.SetDebugRefreshInterval(cfg.DebugRefreshInterval)
+	if debugStore, err := openDebugReadStore(cfg.Store); err != nil {
+		log.Log.Error("[Main] ❌ Failed to open debug read store", "error", err)
+		os.Exit(1)
+	} else if debugStore != nil {
+		ag.SetDebugReadStore(debugStore)
+		log.Log.Info("[Main] ✅ Debug pages read with preference", "preference", cfg.Store.DebugReadPreference)
+	}
+
+	if cfg.KnowledgeWatch {
+		ag.StartKnowledgeWatcher(context.Background(), cfg.KnowledgeWatchInterval)
+	}
+	if len(cfg.MCPServers) > 0 {
+		ag.ConnectMCP(context.Background(), cfg.MCPServers)
+	}
+
+	if cfg.HTTP.Enabled {
+		router := gin.Default()
+		ag.RegisterRoutes(router)
+		go func() {
+			log.Log.Info("[Main] 🌐 HTTP server listening", "address", cfg.GetAddress())
+			if err := router.Run(cfg.GetAddress()); err != nil {
+				log.Log.Error("[Main] ❌ HTTP server stopped", "error", err)
+			}
+		}()
+	}
+
+	if *repl {
+		ch := ag.GetCoreHandler()
+		if err := useLLMRecords(ch, cfg.LLM); err != nil {
+			log.Log.Error("[Main] ❌ Failed to initialize core handler", "error", err)
+			os.Exit(1)
+		}
+		r := &REPL{
+			core:   ch,
+			userID: *userID,
+			in:     os.Stdin,
+			out:    os.Stdout,
+		}
+		runErr := r.Run(context.Background())
+		if err := ch.Shutdown(context.Background()); err != nil {
+			log.Log.Warn("[Main] ⚠️  Core handler shutdown", "error", err)
+		}
+		if runErr != nil {
+			log.Log.Error("[Main] ❌ REPL stopped", "error", runErr)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ag.WaitForShutdown()
+}
+
+// openStore creates the session store selected by config
+func openStore(cfg config.StoreConfig) (store.SessionStore, error) {
+	switch cfg.Type {
+	case "", "sqlite":
+		return store.NewDBStoreWithPath(cfg.Path)
+	case "mongodb":
+		if cfg.MongoURI == "" {
+			return nil, fmt.Errorf("AGENTIZE_STORE_MONGO_URI is required for mongodb store")
+		}
+		return store.NewMongoDBStoreFromURI(cfg.MongoURI)
+	default:
+		return nil, fmt.Errorf("unknown store type: %s", cfg.Type)
+	}
+}
+
+// openDebugReadStore opens the store the debug pages read from when a read preference is
+// configured for the mongodb store; it returns nil otherwise (pages read from the session store)
+func openDebugReadStore(cfg config.StoreConfig) (store.SessionStore, error) {
+	if cfg.DebugReadPreference == "" || cfg.Type != "mongodb" {
+		return nil, nil
+	}
+	mongoConfig := store.DefaultMongoDBStoreConfig()
+	mongoConfig.URI = cfg.MongoURI
+	mongoConfig.ReadPreference = cfg.DebugReadPreference
+	return store.NewMongoDBStore(mongoConfig)
+}
+
+// replLLMOptions returns the options building the CoreHandler the REPL talks to: the same
+// stack used in production, two UserAgent engines sharing the repository, store and function registry
+func replLLMOptions(llm config.LLMConfig) ([]agentize.Option, error) {
+	if llm.APIKey == "" && llm.ReplayDir == "" {
+		return nil, fmt.Errorf("AGENTIZE_LLM_API_KEY is required for REPL mode")
+	}
+	if llm.RecordDir != "" && llm.ReplayDir != "" {
+		return nil, fmt.Errorf("-record and -replay cannot be used together")
+	}
+	backups, err := engine.BackupProvidersFromConfig(llm.Backups)
+	if err != nil {
+		return nil, err
+	}
+	opts := []agentize.Option{
+		agentize.WithLLM(engine.LLMConfig{APIKey: llm.APIKey, BaseURL: llm.BaseURL, Model: llm.Model, BackupProviders: backups}),
+	}
+
+	// Agents with an llm.agents entry (or AGENTIZE_LLM_<NAME>_* variables) get their own connection
+	agentLLM := func(name string) *engine.LLMConfig {
+		if _, ok := llm.Agents[name]; !ok {
+			return nil
+		}
+		agent := llm.ForAgent(name)
+		return &engine.LLMConfig{APIKey: agent.APIKey, BaseURL: agent.BaseURL, Model: agent.Model}
+	}
+	agents := make(map[string]agentize.EngineConfig)
+	for _, name := range []string{"high", "low"} {
+		if cfg := agentLLM(name); cfg != nil {
+			agents[name] = agentize.EngineConfig{LLM: cfg}
+		}
+	}
+	if len(agents) > 0 {
+		opts = append(opts, agentize.WithAgents(agents))
+	}
+	if cfg := agentLLM("core"); cfg != nil {
+		opts = append(opts, agentize.WithCoreLLM(*cfg))
+	}
+	if cfg := agentLLM("summarizer"); cfg != nil {
+		opts = append(opts, agentize.WithSummarizerLLM(*cfg))
+	}
+	return opts, nil
+}
+
+// useLLMRecords makes ch replay or record its LLM calls as configured by -replay and -record
+func useLLMRecords(ch *engine.CoreHandler, llm config.LLMConfig) error {
+	if llm.ReplayDir != "" {
+		records, err := engine.NewFileRecordStore(llm.ReplayDir)
+		if err != nil {
+			return err
+		}
+		ch.UseReplay(records)
+		log.Log.Info("[Main] ⏪ Replaying recorded LLM responses", "dir", llm.ReplayDir)
+	} else if llm.RecordDir != "" {
+		records, err := engine.NewFileRecordStore(llm.RecordDir)
+		if err != nil {
+			return err
+		}
+		ch.UseRecording(records)
+		log.Log.Info("[Main] 📼 Recording LLM calls", "dir", llm.RecordDir)
+	}
+	return nil
+}
+
+// knowledgeRoots splits the -knowledge value into its comma-separated paths
+func knowledgeRoots(value string) []string {
+	var roots []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			roots = append(roots, p)
+		}
+	}
+	return roots
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ghiac/agentize/engine"
+	"github.com/ghiac/agentize/model"
+)
+
+const replHelp = `Commands:
+  /sessions            list sessions for the current user
+  /switch <session_id> make a session the active one for its agent type
+  /summarize [id]      summarize a session (default: active high/low sessions)
+  /tools               list registered tools
+  /help                show this help
+  /quit                exit
+Any other input is sent to the Core as a user message.`
+
+// REPL reads user messages from stdin and runs them through the CoreHandler,
+// printing status updates inline as they arrive.
+type REPL struct {
+	core   *engine.CoreHandler
+	userID string
+	in     io.Reader
+	out    io.Writer
+}
+
+// Run processes input lines until EOF or /quit
+func (r *REPL) Run(ctx context.Context) error {
+	fmt.Fprintf(r.out, "Agentize REPL | user: %s | type /help for commands\n", r.userID)
+
+	ctx = engine.WithStatusFunc(ctx, r.printStatus)
+	scanner := bufio.NewScanner(r.in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for {
+		fmt.Fprint(r.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "/") {
+			if quit := r.handleCommand(ctx, line); quit {
+				return nil
+			}
+			continue
+		}
+
+		response, err := r.core.ProcessMessage(ctx, r.userID, line)
+		if err != nil {
+			fmt.Fprintf(r.out, "error: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(r.out, "\n%s\n\n", response)
+	}
+}
+
+// handleCommand executes a slash command. Returns true when the REPL should exit.
+func (r *REPL) handleCommand(ctx context.Context, line string) bool {
+	fields := strings.Fields(line)
+	cmd, args := fields[0], fields[1:]
+
+	switch cmd {
+	case "/quit", "/exit":
+		return true
+
+	case "/help":
+		fmt.Fprintln(r.out, replHelp)
+
+	case "/sessions":
+		prompt, err := r.core.GetSessionHandler().GetSessionsPrompt(r.userID)
+		if err != nil {
+			fmt.Fprintf(r.out, "error: %v\n", err)
+			return false
+		}
+		fmt.Fprintln(r.out, prompt)
+
+	case "/switch":
+		if len(args) != 1 {
+			fmt.Fprintln(r.out, "usage: /switch <session_id>")
+			return false
+		}
+		session, err := r.core.SwitchSession(r.userID, args[0])
+		if err != nil {
+			fmt.Fprintf(r.out, "error: %v\n", err)
+			return false
+		}
+		fmt.Fprintf(r.out, "switched %s session to %s\n", session.AgentType, session.SessionID)
+
+	case "/summarize":
+		sessionIDs := args
+		if len(sessionIDs) == 0 {
+			sessionIDs = r.activeSessionIDs()
+		}
+		if len(sessionIDs) == 0 {
+			fmt.Fprintln(r.out, "no active sessions to summarize")
+			return false
+		}
+		for _, id := range sessionIDs {
+			if err := r.core.GetSessionHandler().SummarizeSession(ctx, id); err != nil {
+				fmt.Fprintf(r.out, "error summarizing %s: %v\n", id, err)
+				continue
+			}
+			fmt.Fprintf(r.out, "summarized %s\n", id)
+		}
+
+	case "/tools":
+		r.printTools()
+
+	default:
+		fmt.Fprintf(r.out, "unknown command: %s (type /help)\n", cmd)
+	}
+	return false
+}
+
+// activeSessionIDs returns the user's active high/low session IDs (if the store supports users)
+func (r *REPL) activeSessionIDs() []string {
+	userStore, ok := r.core.GetSessionHandler().GetStore().(interface {
+		GetOrCreateUser(string) (*model.User, error)
+	})
+	if !ok {
+		return nil
+	}
+	user, err := userStore.GetOrCreateUser(r.userID)
+	if err != nil || user == nil {
+		return nil
+	}
+
+	var ids []string
+	for _, agentType := range []model.AgentType{model.AgentTypeHigh, model.AgentTypeLow} {
+		if id := user.GetActiveSessionID(agentType); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// printTools lists Core tools and the tools registered on the UserAgents
+func (r *REPL) printTools() {
+	coreTools := r.core.GetCoreTools().GetAllRegistered()
+	sort.Strings(coreTools)
+	fmt.Fprintln(r.out, "Core tools:")
+	for _, name := range coreTools {
+		fmt.Fprintf(r.out, "  - %s\n", name)
+	}
+
+	agentTools := map[string]bool{}
+	for _, agent := range []*engine.Engine{r.core.GetUserAgentHigh(), r.core.GetUserAgentLow()} {
+		if agent == nil || agent.Functions == nil {
+			continue
+		}
+		for _, name := range agent.Functions.GetAllRegistered() {
+			agentTools[name] = true
+		}
+	}
+	names := make([]string, 0, len(agentTools))
+	for name := range agentTools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(r.out, "UserAgent tools:")
+	for _, name := range names {
+		fmt.Fprintf(r.out, "  - %s\n", name)
+	}
+}
+
+// printStatus renders a status update inline
+func (r *REPL) printStatus(status *engine.StatusUpdate) {
+	if status.Detail != "" {
+		fmt.Fprintf(r.out, "  … %s: %s\n", status.Phase, status.Detail)
+		return
+	}
+	fmt.Fprintf(r.out, "  … %s\n", status.Phase)
+}
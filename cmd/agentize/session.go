@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ghiac/agentize/config"
+	"github.com/ghiac/agentize/model"
+)
+
+// runSession implements "agentize session export|import": it copies a session and its
+// records between the configured store and a portable JSON file.
+//
+//	agentize session export [-o file] <session-id>
+//	agentize session import [-user id] [file]
+func runSession(args []string) int {
+	usage := "usage: agentize session export [-o file] <session-id> | agentize session import [-user id] [file]"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("session "+args[0], flag.ContinueOnError)
+	output := fs.String("o", "", "export: file to write (default stdout)")
+	userID := fs.String("user", "", "import: assign the session to this user")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 2
+	}
+	sessionStore, err := openStore(cfg.Store)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "session: %v\n", err)
+		return 1
+	}
+	sessions := model.NewSessionHandler(sessionStore, model.DefaultSessionHandlerConfig())
+
+	switch args[0] {
+	case "export":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return 2
+		}
+		doc, err := sessions.ExportSession(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "session export: %v\n", err)
+			return 1
+		}
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "session export: %v\n", err)
+			return 1
+		}
+		data = append(data, '\n')
+		if *output == "" {
+			os.Stdout.Write(data)
+			return 0
+		}
+		if err := os.WriteFile(*output, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "session export: %v\n", err)
+			return 1
+		}
+		return 0
+
+	case "import":
+		var in io.Reader = os.Stdin
+		if path := fs.Arg(0); path != "" && path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "session import: %v\n", err)
+				return 1
+			}
+			defer f.Close()
+			in = f
+		}
+		var doc model.SessionExport
+		if err := json.NewDecoder(in).Decode(&doc); err != nil {
+			fmt.Fprintf(os.Stderr, "session import: invalid export: %v\n", err)
+			return 1
+		}
+		session, err := sessions.ImportSession(&doc, model.ImportOptions{UserID: *userID})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "session import: %v\n", err)
+			return 1
+		}
+		fmt.Println(session.SessionID)
+		return 0
+
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ghiac/agentize/config"
+	"github.com/ghiac/agentize/fsrepo"
+)
+
+// runValidate implements "agentize validate [path]": it prints every issue found
+// in the knowledge tree and returns a non-zero exit code if any of them is an error.
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	quiet := fs.Bool("quiet", false, "only print errors, not warnings")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: agentize validate [-quiet] [knowledge-path]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	path := fs.Arg(0)
+	if path == "" {
+		cfg, err := config.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+			return 2
+		}
+		path = cfg.KnowledgePath
+	}
+
+	issues, err := fsrepo.Validate(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "validate: %v\n", err)
+		return 2
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, issue := range issues {
+		if issue.Severity == fsrepo.SeverityError {
+			errorCount++
+		} else {
+			warningCount++
+			if *quiet {
+				continue
+			}
+		}
+		fmt.Println(issue.String())
+	}
+
+	fmt.Printf("%s: %d error(s), %d warning(s)\n", path, errorCount, warningCount)
+	if errorCount > 0 {
+		return 1
+	}
+	return 0
+}
@@ -1,67 +1,250 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds the application configuration
 type Config struct {
 	// HTTP server configuration
-	HTTP HTTPConfig
+	HTTP HTTPConfig `yaml:"http"`
 
 	// Feature flags
-	Features FeatureFlags
+	Features FeatureFlags `yaml:"features"`
 
 	// Knowledge tree path
-	KnowledgePath string
+	KnowledgePath string `yaml:"knowledge_path"`
+
+	// KnowledgeWatch enables hot reload of the knowledge tree when node files change
+	KnowledgeWatch bool `yaml:"knowledge_watch"`
+	// KnowledgeWatchInterval is the polling interval of the knowledge tree watcher when file
+	// notifications are unavailable
+	KnowledgeWatchInterval time.Duration `yaml:"knowledge_watch_interval"`
+	// KnowledgeStrict validates the knowledge tree on startup and refuses to start on errors
+	KnowledgeStrict bool `yaml:"knowledge_strict"`
+	// KnowledgeAllowCycles logs routing cycles in the knowledge tree instead of refusing to load it
+	KnowledgeAllowCycles bool `yaml:"knowledge_allow_cycles"`
+	// KnowledgeAllowJump lets sessions jump to any node and offers the goto_node tool to the model
+	KnowledgeAllowJump bool `yaml:"knowledge_allow_jump"`
+
+	// DebugRefreshInterval is how often debug pages reload themselves (0 disables auto-refresh)
+	DebugRefreshInterval time.Duration `yaml:"debug_refresh_interval"`
+
+	// LogFormat is the log output format: "text" (default) or "json"
+	LogFormat string `yaml:"log_format"`
+	// LogLevel is the minimum log level: "debug", "info" (default), "warn" or "error"
+	LogLevel string `yaml:"log_level"`
+	// LogRedact hashes user and session IDs in logs and keeps message content out of them
+	// above debug level
+	LogRedact bool `yaml:"log_redact"`
 
 	// Scheduler configuration
-	Scheduler SchedulerConfig
+	Scheduler SchedulerConfig `yaml:"scheduler"`
+
+	// Session store configuration
+	Store StoreConfig `yaml:"store"`
+
+	// LLM configuration
+	LLM LLMConfig `yaml:"llm"`
+
+	// MCPServers are the MCP servers whose tools are offered to the agents, keyed by a name that
+	// tool call records refer to (config file only)
+	MCPServers map[string]MCPServerConfig `yaml:"mcp_servers,omitempty"`
+
+	// problems found while reading the config file, reported by Validate
+	problems []string
+}
+
+// StoreConfig holds session store configuration
+type StoreConfig struct {
+	Type     string `yaml:"type"`      // "sqlite" (default) or "mongodb"
+	Path     string `yaml:"path"`      // SQLite database path (default: ./data/sessions.db)
+	MongoURI string `yaml:"mongo_uri"` // MongoDB connection URI (required when Type is "mongodb")
+	// DebugReadPreference, when set with the mongodb store, makes the debug pages read through a
+	// second connection with this read preference (e.g. "secondaryPreferred")
+	DebugReadPreference string `yaml:"debug_read_preference"`
+}
+
+// LLMConfig holds LLM client configuration
+type LLMConfig struct {
+	APIKey  string `yaml:"api_key"`
+	BaseURL string `yaml:"base_url"`
+	Model   string `yaml:"model"`
+	// Enabled marks the LLM as required by the deployment, so Validate reports a missing API key
+	// when the HTTP server is enabled
+	Enabled bool `yaml:"enabled"`
+
+	// RecordDir, if set, records every LLM request/response pair to this directory
+	RecordDir string `yaml:"record_dir"`
+	// ReplayDir, if set, serves LLM calls from the pairs recorded in this directory
+	// instead of calling the model (requests that were not recorded fail)
+	ReplayDir string `yaml:"replay_dir"`
+
+	// Agents gives agents their own provider or model, keyed by LLMAgentNames; unset fields
+	// inherit the fields above (see ForAgent). Set from the environment with
+	// AGENTIZE_LLM_<NAME>_API_KEY, _BASE_URL and _MODEL, e.g. AGENTIZE_LLM_HIGH_BASE_URL.
+	Agents map[string]AgentLLMConfig `yaml:"agents,omitempty"`
+
+	// Backups are providers tried in order before the one above when a call fails, each with
+	// its own API (provider: openai, anthropic or gemini), see engine.LLMConfig.BackupProviders
+	// (config file only)
+	Backups []BackupLLMConfig `yaml:"backups,omitempty"`
+}
+
+// BackupProviderNames are the APIs a BackupLLMConfig can talk to ("" is openai)
+var BackupProviderNames = []string{"openai", "anthropic", "gemini"}
+
+// BackupLLMConfig is one backup provider of LLMConfig.Backups
+type BackupLLMConfig struct {
+	Name     string `yaml:"name,omitempty"`     // shown in logs and BackupStatus (default: backup-<index>)
+	Provider string `yaml:"provider,omitempty"` // one of BackupProviderNames (default: openai)
+	APIKey   string `yaml:"api_key,omitempty"`
+	BaseURL  string `yaml:"base_url,omitempty"` // default: the provider's public API
+	Model    string `yaml:"model"`
+	// MaxTokens caps the answers of anthropic and gemini backups (anthropic default: 4096)
+	MaxTokens int `yaml:"max_tokens,omitempty"`
+	// Vision marks the model as able to read images; requests with images skip other backups
+	Vision bool `yaml:"vision,omitempty"`
+}
+
+// LLMAgentNames are the agents LLMConfig.Agents can configure: the high and low UserAgents,
+// the Core's own decisions and the session summarizer
+var LLMAgentNames = []string{"high", "low", "core", "summarizer"}
+
+// AgentLLMConfig is the LLM connection of one agent
+type AgentLLMConfig struct {
+	APIKey  string `yaml:"api_key,omitempty"`
+	BaseURL string `yaml:"base_url,omitempty"`
+	Model   string `yaml:"model,omitempty"`
+}
+
+// ForAgent returns the connection of agent name: its Agents entry, with the fields it leaves
+// empty taken from c. An entry with its own BaseURL is another provider and does not inherit
+// the API key (a local model may need none).
+func (c LLMConfig) ForAgent(name string) AgentLLMConfig {
+	agent := c.Agents[name]
+	if agent.BaseURL == "" {
+		agent.BaseURL = c.BaseURL
+		if agent.APIKey == "" {
+			agent.APIKey = c.APIKey
+		}
+	}
+	if agent.Model == "" {
+		agent.Model = c.Model
+	}
+	return agent
+}
+
+// MCPServerConfig is the connection of one MCP (Model Context Protocol) server
+type MCPServerConfig struct {
+	// Transport is "stdio" (the server is a command talking over stdin/stdout) or "sse"
+	// (the server listens on URL)
+	Transport string `yaml:"transport"`
+	// Command and Args start a stdio server; Env is added to its environment
+	Command string            `yaml:"command,omitempty"`
+	Args    []string          `yaml:"args,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+	// URL is the SSE endpoint of an sse server; Headers are sent with every request to it
+	URL     string            `yaml:"url,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// ToolPrefix is prepended to the names of the server's tools, to keep them apart from others
+	ToolPrefix string `yaml:"tool_prefix,omitempty"`
+	// Timeout bounds connecting and each tool call (default: 30 seconds)
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// MaxResultBytes caps the tool results passed to the model (default: 16384)
+	MaxResultBytes int `yaml:"max_result_bytes,omitempty"`
+	// Disabled keeps the server configured without connecting to it
+	Disabled bool `yaml:"disabled,omitempty"`
 }
 
 // HTTPConfig holds HTTP server configuration
 type HTTPConfig struct {
-	Enabled bool
-	Host    string
-	Port    int
+	Enabled bool   `yaml:"enabled"`
+	Host    string `yaml:"host"`
+	Port    int    `yaml:"port"`
 }
 
 // FeatureFlags holds feature flag settings
 type FeatureFlags struct {
-	HTTPServerEnabled         bool
-	GraphVisualizationEnabled bool
+	HTTPServerEnabled         bool `yaml:"http_server"`
+	GraphVisualizationEnabled bool `yaml:"graph_visualization"`
 }
 
 // SchedulerConfig holds scheduler configuration
 type SchedulerConfig struct {
-	Enabled                     bool
-	CheckInterval               time.Duration
-	FirstSummarizationThreshold int           // Min messages for first summarization (default: 5)
-	SubsequentMessageThreshold  int           // Min messages for subsequent summarizations (default: 25)
-	SubsequentTimeThreshold     time.Duration // Min time since last summarization (default: 1 hour)
-	LastActivityThreshold       time.Duration // Session must be active within this time (default: 1 hour)
-	SummaryModel                string
-	DisableLogs                 bool // If true, SessionScheduler does not emit any logs
+	Enabled                     bool          `yaml:"enabled"`
+	CheckInterval               time.Duration `yaml:"check_interval"`
+	FirstSummarizationThreshold int           `yaml:"first_summarization_threshold"` // Min messages for first summarization (default: 5)
+	SubsequentMessageThreshold  int           `yaml:"subsequent_message_threshold"`  // Min messages for subsequent summarizations (default: 25)
+	SubsequentTimeThreshold     time.Duration `yaml:"subsequent_time_threshold"`     // Min time since last summarization (default: 1 hour)
+	LastActivityThreshold       time.Duration `yaml:"last_activity_threshold"`       // Session must be active within this time (default: 1 hour)
+	SummaryModel                string        `yaml:"summary_model"`
+	DisableLogs                 bool          `yaml:"disable_logs"` // If true, SessionScheduler does not emit any logs
 }
 
-// Load loads configuration from environment variables
-func Load() (*Config, error) {
-	cfg := &Config{
+// Default returns the configuration used when neither a config file nor environment
+// variables set a value
+func Default() *Config {
+	return &Config{
 		HTTP: HTTPConfig{
-			Enabled: getEnvBool("AGENTIZE_HTTP_ENABLED", false),
-			Host:    getEnvString("AGENTIZE_HTTP_HOST", "0.0.0.0"),
-			Port:    getEnvInt("AGENTIZE_HTTP_PORT", 8080),
+			Host: "0.0.0.0",
+			Port: 8080,
 		},
 		Features: FeatureFlags{
-			HTTPServerEnabled:         getEnvBool("AGENTIZE_FEATURE_HTTP", false),
-			GraphVisualizationEnabled: getEnvBool("AGENTIZE_FEATURE_GRAPH", true),
+			GraphVisualizationEnabled: true,
+		},
+		KnowledgePath:          "./knowledge",
+		KnowledgeWatchInterval: 2 * time.Second,
+		DebugRefreshInterval:   30 * time.Second,
+		LogFormat:              "text",
+		LogLevel:               "info",
+		Scheduler: SchedulerConfig{
+			Enabled:                     true,
+			CheckInterval:               5 * time.Minute,
+			FirstSummarizationThreshold: 5,
+			SubsequentMessageThreshold:  25,
+			SubsequentTimeThreshold:     time.Hour,
+			LastActivityThreshold:       time.Hour,
+			SummaryModel:                "openai/gpt-5-nano",
+		},
+		Store: StoreConfig{
+			Type: "sqlite",
+			Path: "./data/sessions.db",
+		},
+		LLM: LLMConfig{
+			Model: "openai/gpt-5-nano",
 		},
-		KnowledgePath: getEnvString("AGENTIZE_KNOWLEDGE_PATH", "./knowledge"),
-		Scheduler:     loadSchedulerConfig(),
 	}
+}
+
+// Load loads the configuration: the defaults, overridden by the YAML or JSON file named by
+// AGENTIZE_CONFIG (if set), overridden by environment variables. Unknown keys and invalid
+// values in the file do not fail Load; call Validate to report them with the other problems.
+func Load() (*Config, error) {
+	return LoadFile(os.Getenv("AGENTIZE_CONFIG"))
+}
+
+// LoadFile loads the configuration like Load from the config file at path (none if empty)
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	cfg.applyEnv()
 
 	// HTTP is enabled if both HTTP config and feature flag are enabled
 	cfg.HTTP.Enabled = cfg.HTTP.Enabled && cfg.Features.HTTPServerEnabled
@@ -69,31 +252,286 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
-// loadSchedulerConfig loads scheduler configuration from environment variables
-func loadSchedulerConfig() SchedulerConfig {
-	// Parse durations from environment (in minutes, convert to time.Duration)
-	checkIntervalMinutes := getEnvInt("AGENTIZE_SCHEDULER_CHECK_INTERVAL_MINUTES", 5)
-	subsequentTimeThresholdMinutes := getEnvInt("AGENTIZE_SCHEDULER_SUBSEQUENT_TIME_THRESHOLD_MINUTES", 60)
-	lastActivityThresholdMinutes := getEnvInt("AGENTIZE_SCHEDULER_LAST_ACTIVITY_THRESHOLD_MINUTES", 60)
+// loadFile overrides cfg with the values set in the file at path. JSON is read by the YAML
+// decoder as well, JSON being a subset of YAML.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err = dec.Decode(c)
+	var typeErr *yaml.TypeError
+	switch {
+	case err == nil || errors.Is(err, io.EOF):
+		// An empty file keeps the defaults
+	case errors.As(err, &typeErr):
+		// The decoder keeps going past unknown keys and invalid values; collect them all
+		for _, problem := range typeErr.Errors {
+			c.problems = append(c.problems, fmt.Sprintf("%s: %s", path, problem))
+		}
+	default:
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides cfg with the environment variables that are set
+func (c *Config) applyEnv() {
+	c.HTTP.Enabled = getEnvBool("AGENTIZE_HTTP_ENABLED", c.HTTP.Enabled)
+	c.HTTP.Host = getEnvString("AGENTIZE_HTTP_HOST", c.HTTP.Host)
+	c.HTTP.Port = getEnvInt("AGENTIZE_HTTP_PORT", c.HTTP.Port)
+	c.Features.HTTPServerEnabled = getEnvBool("AGENTIZE_FEATURE_HTTP", c.Features.HTTPServerEnabled)
+	c.Features.GraphVisualizationEnabled = getEnvBool("AGENTIZE_FEATURE_GRAPH", c.Features.GraphVisualizationEnabled)
+
+	c.KnowledgePath = getEnvString("AGENTIZE_KNOWLEDGE_PATH", c.KnowledgePath)
+	c.KnowledgeWatch = getEnvBool("AGENTIZE_KNOWLEDGE_WATCH", c.KnowledgeWatch)
+	c.KnowledgeWatchInterval = getEnvDuration("AGENTIZE_KNOWLEDGE_WATCH_INTERVAL_SECONDS", time.Second, c.KnowledgeWatchInterval)
+	c.KnowledgeStrict = getEnvBool("AGENTIZE_KNOWLEDGE_STRICT", c.KnowledgeStrict)
+	c.KnowledgeAllowCycles = getEnvBool("AGENTIZE_KNOWLEDGE_ALLOW_CYCLES", c.KnowledgeAllowCycles)
+	c.KnowledgeAllowJump = getEnvBool("AGENTIZE_KNOWLEDGE_ALLOW_JUMP", c.KnowledgeAllowJump)
+	c.DebugRefreshInterval = getEnvDuration("AGENTIZE_DEBUG_REFRESH_SECONDS", time.Second, c.DebugRefreshInterval)
+	c.LogFormat = getEnvString("AGENTIZE_LOG_FORMAT", c.LogFormat)
+	c.LogLevel = getEnvString("AGENTIZE_LOG_LEVEL", c.LogLevel)
+	c.LogRedact = getEnvBool("AGENTIZE_LOG_REDACT", c.LogRedact)
+
+	c.applySchedulerEnv()
+
+	c.Store.Type = getEnvString("AGENTIZE_STORE_TYPE", c.Store.Type)
+	c.Store.Path = getEnvString("AGENTIZE_STORE_PATH", c.Store.Path)
+	c.Store.MongoURI = getEnvString("AGENTIZE_STORE_MONGO_URI", c.Store.MongoURI)
+	c.Store.DebugReadPreference = getEnvString("AGENTIZE_STORE_DEBUG_READ_PREFERENCE", c.Store.DebugReadPreference)
+
+	c.LLM.APIKey = getEnvString("AGENTIZE_LLM_API_KEY", c.LLM.APIKey)
+	c.LLM.BaseURL = getEnvString("AGENTIZE_LLM_BASE_URL", c.LLM.BaseURL)
+	c.LLM.Model = getEnvString("AGENTIZE_LLM_MODEL", c.LLM.Model)
+	c.LLM.Enabled = getEnvBool("AGENTIZE_LLM_ENABLED", c.LLM.Enabled)
+	c.LLM.RecordDir = getEnvString("AGENTIZE_LLM_RECORD_DIR", c.LLM.RecordDir)
+	c.LLM.ReplayDir = getEnvString("AGENTIZE_LLM_REPLAY_DIR", c.LLM.ReplayDir)
+	for _, name := range LLMAgentNames {
+		prefix := "AGENTIZE_LLM_" + strings.ToUpper(name) + "_"
+		agent := c.LLM.Agents[name]
+		agent.APIKey = getEnvString(prefix+"API_KEY", agent.APIKey)
+		agent.BaseURL = getEnvString(prefix+"BASE_URL", agent.BaseURL)
+		agent.Model = getEnvString(prefix+"MODEL", agent.Model)
+		if agent != (AgentLLMConfig{}) {
+			if c.LLM.Agents == nil {
+				c.LLM.Agents = make(map[string]AgentLLMConfig)
+			}
+			c.LLM.Agents[name] = agent
+		}
+	}
+}
+
+// applySchedulerEnv overrides the scheduler configuration with environment variables
+// (durations in minutes)
+func (c *Config) applySchedulerEnv() {
+	s := &c.Scheduler
+	s.Enabled = getEnvBool("AGENTIZE_SCHEDULER_ENABLED", s.Enabled)
+	s.CheckInterval = getEnvDuration("AGENTIZE_SCHEDULER_CHECK_INTERVAL_MINUTES", time.Minute, s.CheckInterval)
+	s.FirstSummarizationThreshold = getEnvInt("AGENTIZE_SCHEDULER_FIRST_THRESHOLD", s.FirstSummarizationThreshold)
+	s.SubsequentMessageThreshold = getEnvInt("AGENTIZE_SCHEDULER_SUBSEQUENT_MESSAGE_THRESHOLD", s.SubsequentMessageThreshold)
+	s.SubsequentTimeThreshold = getEnvDuration("AGENTIZE_SCHEDULER_SUBSEQUENT_TIME_THRESHOLD_MINUTES", time.Minute, s.SubsequentTimeThreshold)
+	s.LastActivityThreshold = getEnvDuration("AGENTIZE_SCHEDULER_LAST_ACTIVITY_THRESHOLD_MINUTES", time.Minute, s.LastActivityThreshold)
+	s.SummaryModel = getEnvString("AGENTIZE_SCHEDULER_SUMMARY_MODEL", s.SummaryModel)
+	s.DisableLogs = getEnvBool("AGENTIZE_SCHEDULER_DISABLE_LOGS", s.DisableLogs)
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(e.Problems, "; "))
+}
+
+// Validate checks the whole configuration and returns a *ValidationError listing every
+// problem (including unknown keys and invalid values in the config file), or nil
+func (c *Config) Validate() error {
+	problems := append([]string(nil), c.problems...)
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.HTTP.Enabled && (c.HTTP.Port < 1 || c.HTTP.Port > 65535) {
+		addf("http.port must be between 1 and 65535, got %d", c.HTTP.Port)
+	}
+	if c.KnowledgePath == "" {
+		addf("knowledge_path is required")
+	}
+	if c.KnowledgeWatch && c.KnowledgeWatchInterval <= 0 {
+		addf("knowledge_watch_interval must be positive, got %s", c.KnowledgeWatchInterval)
+	}
+	if c.DebugRefreshInterval < 0 {
+		addf("debug_refresh_interval must not be negative, got %s", c.DebugRefreshInterval)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		addf("log_format must be \"text\" or \"json\", got %q", c.LogFormat)
+	}
+	if _, err := c.SlogLevel(); err != nil {
+		addf("log_level must be \"debug\", \"info\", \"warn\" or \"error\", got %q", c.LogLevel)
+	}
+
+	if c.Scheduler.Enabled {
+		if c.Scheduler.CheckInterval <= 0 {
+			addf("scheduler.check_interval must be positive, got %s", c.Scheduler.CheckInterval)
+		}
+		if c.Scheduler.SubsequentTimeThreshold < 0 {
+			addf("scheduler.subsequent_time_threshold must not be negative, got %s", c.Scheduler.SubsequentTimeThreshold)
+		}
+		if c.Scheduler.LastActivityThreshold < 0 {
+			addf("scheduler.last_activity_threshold must not be negative, got %s", c.Scheduler.LastActivityThreshold)
+		}
+		if c.Scheduler.FirstSummarizationThreshold < 1 || c.Scheduler.SubsequentMessageThreshold < 1 {
+			addf("scheduler message thresholds must be at least 1")
+		}
+	}
+
+	switch c.Store.Type {
+	case "sqlite":
+		if c.Store.Path == "" {
+			addf("store.path is required for the sqlite store")
+		}
+	case "mongodb":
+		if c.Store.MongoURI == "" {
+			addf("store.mongo_uri is required for the mongodb store")
+		}
+	default:
+		addf("store.type must be \"sqlite\" or \"mongodb\", got %q", c.Store.Type)
+	}
+
+	if c.HTTP.Enabled && c.LLM.Enabled && c.LLM.APIKey == "" && c.LLM.ReplayDir == "" {
+		addf("llm.api_key (AGENTIZE_LLM_API_KEY) is required when the HTTP server and the LLM are enabled")
+	}
+	agentNames := make([]string, 0, len(c.LLM.Agents))
+	for name := range c.LLM.Agents {
+		agentNames = append(agentNames, name)
+	}
+	sort.Strings(agentNames)
+	for _, name := range agentNames {
+		if !slices.Contains(LLMAgentNames, name) {
+			addf("llm.agents.%s: unknown agent (expected one of %s)", name, strings.Join(LLMAgentNames, ", "))
+		}
+	}
+	if c.LLM.Enabled && c.LLM.Model == "" {
+		addf("llm.model is required when the LLM is enabled")
+	}
+	if c.LLM.RecordDir != "" && c.LLM.ReplayDir != "" {
+		addf("llm.record_dir and llm.replay_dir cannot be used together")
+	}
+	for i, backup := range c.LLM.Backups {
+		if backup.Provider != "" && !slices.Contains(BackupProviderNames, backup.Provider) {
+			addf("llm.backups[%d].provider must be one of %s, got %q", i, strings.Join(BackupProviderNames, ", "), backup.Provider)
+		}
+		if backup.Model == "" {
+			addf("llm.backups[%d].model is required", i)
+		}
+		if backup.MaxTokens < 0 {
+			addf("llm.backups[%d].max_tokens must not be negative", i)
+		}
+	}
 
-	// Scheduler is enabled by default (true), only disable if explicitly set to false via env var
-	enabled := true
-	if envVal := os.Getenv("AGENTIZE_SCHEDULER_ENABLED"); envVal != "" {
-		if enabledVal, err := strconv.ParseBool(envVal); err == nil {
-			enabled = enabledVal
+	mcpNames := make([]string, 0, len(c.MCPServers))
+	for name := range c.MCPServers {
+		mcpNames = append(mcpNames, name)
+	}
+	sort.Strings(mcpNames)
+	for _, name := range mcpNames {
+		server := c.MCPServers[name]
+		switch server.Transport {
+		case "stdio":
+			if server.Command == "" {
+				addf("mcp_servers.%s.command is required for the stdio transport", name)
+			}
+		case "sse":
+			if server.URL == "" {
+				addf("mcp_servers.%s.url is required for the sse transport", name)
+			}
+		default:
+			addf("mcp_servers.%s.transport must be \"stdio\" or \"sse\", got %q", name, server.Transport)
+		}
+		if server.Timeout < 0 || server.MaxResultBytes < 0 {
+			addf("mcp_servers.%s: timeout and max_result_bytes must not be negative", name)
 		}
 	}
 
-	return SchedulerConfig{
-		Enabled:                     enabled,
-		CheckInterval:               time.Duration(checkIntervalMinutes) * time.Minute,
-		FirstSummarizationThreshold: getEnvInt("AGENTIZE_SCHEDULER_FIRST_THRESHOLD", 5),
-		SubsequentMessageThreshold:  getEnvInt("AGENTIZE_SCHEDULER_SUBSEQUENT_MESSAGE_THRESHOLD", 25),
-		SubsequentTimeThreshold:     time.Duration(subsequentTimeThresholdMinutes) * time.Minute,
-		LastActivityThreshold:       time.Duration(lastActivityThresholdMinutes) * time.Minute,
-		SummaryModel:                getEnvString("AGENTIZE_SCHEDULER_SUMMARY_MODEL", "openai/gpt-5-nano"),
-		DisableLogs:                 getEnvBool("AGENTIZE_SCHEDULER_DISABLE_LOGS", false),
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
 	}
+	return nil
+}
+
+// Masked returns a copy of the configuration with secrets (the LLM and backup API keys, the
+// environment and headers of MCP servers and the MongoDB URI) replaced, safe to print or log
+func (c *Config) Masked() *Config {
+	masked := *c
+	masked.problems = nil
+	if masked.LLM.APIKey != "" {
+		masked.LLM.APIKey = maskSecret(masked.LLM.APIKey)
+	}
+	if masked.LLM.Agents != nil {
+		agents := make(map[string]AgentLLMConfig, len(masked.LLM.Agents))
+		for name, agent := range masked.LLM.Agents {
+			if agent.APIKey != "" {
+				agent.APIKey = maskSecret(agent.APIKey)
+			}
+			agents[name] = agent
+		}
+		masked.LLM.Agents = agents
+	}
+	if masked.LLM.Backups != nil {
+		backups := make([]BackupLLMConfig, len(masked.LLM.Backups))
+		for i, backup := range masked.LLM.Backups {
+			if backup.APIKey != "" {
+				backup.APIKey = maskSecret(backup.APIKey)
+			}
+			backups[i] = backup
+		}
+		masked.LLM.Backups = backups
+	}
+	if masked.MCPServers != nil {
+		// Environment variables and headers of MCP servers typically carry tokens
+		servers := make(map[string]MCPServerConfig, len(masked.MCPServers))
+		for name, server := range masked.MCPServers {
+			server.Env = maskValues(server.Env)
+			server.Headers = maskValues(server.Headers)
+			servers[name] = server
+		}
+		masked.MCPServers = servers
+	}
+	if masked.Store.MongoURI != "" {
+		// The URI may carry credentials; keep only the scheme
+		scheme, _, _ := strings.Cut(masked.Store.MongoURI, "://")
+		masked.Store.MongoURI = scheme + "://****"
+	}
+	return &masked
+}
+
+// YAML returns the configuration as YAML, in the config file format
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// maskValues returns a copy of values with every value masked
+func maskValues(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	masked := make(map[string]string, len(values))
+	for key, value := range values {
+		masked[key] = maskSecret(value)
+	}
+	return masked
+}
+
+// maskSecret keeps the last 4 characters of long secrets so keys can still be told apart
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
 }
 
 // GetAddress returns the HTTP server address
@@ -101,6 +539,21 @@ func (c *Config) GetAddress() string {
 	return fmt.Sprintf("%s:%d", c.HTTP.Host, c.HTTP.Port)
 }
 
+// SlogLevel parses LogLevel ("" is info)
+func (c *Config) SlogLevel() (slog.Level, error) {
+	switch strings.ToLower(c.LogLevel) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", c.LogLevel)
+}
+
 // Helper functions for environment variables
 func getEnvString(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -118,6 +571,16 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvDuration reads an integer count of unit
+func getEnvDuration(key string, unit time.Duration, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return time.Duration(intValue) * unit
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	os.WriteFile(path, []byte(`
+knowledge_path: ./kb
+knowledge_watch_interval: 10s
+http:
+  port: 9090
+llm:
+  model: file-model
+  api_key: sk-file-secret-1234
+scheduler:
+  check_interval: 1m
+`), 0644)
+	t.Setenv("AGENTIZE_LLM_MODEL", "env-model")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.KnowledgePath != "./kb" || cfg.KnowledgeWatchInterval != 10*time.Second || cfg.HTTP.Port != 9090 {
+		t.Errorf("Expected file values, got %+v", cfg)
+	}
+	if cfg.LLM.Model != "env-model" {
+		t.Errorf("Expected the environment to override the file, got model %q", cfg.LLM.Model)
+	}
+	if cfg.Store.Type != "sqlite" || cfg.Scheduler.SubsequentMessageThreshold != 25 {
+		t.Errorf("Expected defaults for unset values, got %+v", cfg)
+	}
+	if cfg.Scheduler.CheckInterval != time.Minute {
+		t.Errorf("Expected check_interval 1m, got %s", cfg.Scheduler.CheckInterval)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+
+	out, err := cfg.Masked().YAML()
+	if err != nil {
+		t.Fatalf("YAML failed: %v", err)
+	}
+	if strings.Contains(string(out), "sk-file-secret") || !strings.Contains(string(out), "****1234") {
+		t.Errorf("Expected the API key to be masked:\n%s", out)
+	}
+
+	// JSON files are read too
+	jsonPath := filepath.Join(dir, "config.json")
+	os.WriteFile(jsonPath, []byte(`{"log_format": "json", "store": {"path": "./x.db"}}`), 0644)
+	cfg, err = LoadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("LoadFile(json) failed: %v", err)
+	}
+	if cfg.LogFormat != "json" || cfg.Store.Path != "./x.db" {
+		t.Errorf("Expected JSON values, got %+v", cfg)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+knowledge_pth: ./kb
+debug_refresh_interval: soon
+log_level: verbose
+http:
+  enabled: true
+features:
+  http_server: true
+llm:
+  enabled: true
+store:
+  type: postgres
+`), 0644)
+	t.Setenv("AGENTIZE_LLM_API_KEY", "")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	err = cfg.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	all := strings.Join(verr.Problems, "\n")
+	for _, want := range []string{"knowledge_pth", "soon", "log_level", "store.type", "llm.api_key"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("Expected a problem mentioning %q, got:\n%s", want, all)
+		}
+	}
+	if len(verr.Problems) != 5 {
+		t.Errorf("Expected 5 problems, got %d:\n%s", len(verr.Problems), all)
+	}
+}
+
+func TestLLMAgents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+llm:
+  api_key: sk-default-secret-0000
+  model: gpt-4o-mini
+  agents:
+    high:
+      base_url: https://acme.openai.azure.com/v1
+      api_key: azure-secret-key-9999
+    summarizer:
+      model: gpt-4o-mini-summary
+`), 0644)
+	t.Setenv("AGENTIZE_LLM_LOW_BASE_URL", "http://localhost:8000/v1")
+	t.Setenv("AGENTIZE_LLM_LOW_MODEL", "llama-3-8b")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want AgentLLMConfig
+	}{
+		{"high", AgentLLMConfig{APIKey: "azure-secret-key-9999", BaseURL: "https://acme.openai.azure.com/v1", Model: "gpt-4o-mini"}},
+		// Another provider does not get the default API key
+		{"low", AgentLLMConfig{BaseURL: "http://localhost:8000/v1", Model: "llama-3-8b"}},
+		{"core", AgentLLMConfig{APIKey: "sk-default-secret-0000", Model: "gpt-4o-mini"}},
+		{"summarizer", AgentLLMConfig{APIKey: "sk-default-secret-0000", Model: "gpt-4o-mini-summary"}},
+	}
+	for _, tt := range tests {
+		if got := cfg.LLM.ForAgent(tt.name); got != tt.want {
+			t.Errorf("ForAgent(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	out, _ := cfg.Masked().YAML()
+	if strings.Contains(string(out), "azure-secret") || cfg.LLM.Agents["high"].APIKey != "azure-secret-key-9999" {
+		t.Errorf("Expected agent API keys masked in the copy only:\n%s", out)
+	}
+
+	cfg.LLM.Agents["hihg"] = AgentLLMConfig{Model: "typo"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "llm.agents.hihg") {
+		t.Errorf("Expected an unknown agent problem, got %v", err)
+	}
+}
+
+func TestMCPServers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+mcp_servers:
+  tickets:
+    transport: stdio
+    command: ticket-mcp
+    args: ["--readonly"]
+    env:
+      TICKETS_TOKEN: tok-secret-5678
+    tool_prefix: tickets_
+  wiki:
+    transport: sse
+    url: https://wiki.internal/mcp/sse
+    headers:
+      Authorization: Bearer wiki-secret-4321
+    timeout: 10s
+`), 0644)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+	if tickets := cfg.MCPServers["tickets"]; tickets.Command != "ticket-mcp" || len(tickets.Args) != 1 || tickets.ToolPrefix != "tickets_" {
+		t.Errorf("Expected the tickets server, got %+v", tickets)
+	}
+	if wiki := cfg.MCPServers["wiki"]; wiki.Timeout != 10*time.Second {
+		t.Errorf("Expected the wiki timeout, got %+v", wiki)
+	}
+
+	out, _ := cfg.Masked().YAML()
+	if strings.Contains(string(out), "tok-secret") || strings.Contains(string(out), "wiki-secret") || !strings.Contains(string(out), "****4321") {
+		t.Errorf("Expected MCP env and headers to be masked:\n%s", out)
+	}
+	if cfg.MCPServers["wiki"].Headers["Authorization"] != "Bearer wiki-secret-4321" {
+		t.Errorf("Expected the headers masked in the copy only")
+	}
+
+	cfg.MCPServers["broken"] = MCPServerConfig{Transport: "sse"}
+	cfg.MCPServers["odd"] = MCPServerConfig{Transport: "websocket"}
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "mcp_servers.broken.url") || !strings.Contains(err.Error(), "mcp_servers.odd.transport") {
+		t.Errorf("Expected problems for broken and odd, got %v", err)
+	}
+}
+
+func TestLLMBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+llm:
+  api_key: sk-main
+  model: gpt-4o-mini
+  backups:
+    - name: claude
+      provider: anthropic
+      api_key: sk-ant-secret-9876
+      model: claude-sonnet-4-5
+      max_tokens: 2048
+    - provider: gemini
+      api_key: gemini-secret-1111
+      model: gemini-2.5-flash
+      vision: true
+`), 0644)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+	if len(cfg.LLM.Backups) != 2 || cfg.LLM.Backups[0].Provider != "anthropic" || cfg.LLM.Backups[0].MaxTokens != 2048 || !cfg.LLM.Backups[1].Vision {
+		t.Fatalf("Expected the anthropic and gemini backups, got %+v", cfg.LLM.Backups)
+	}
+
+	out, _ := cfg.Masked().YAML()
+	if strings.Contains(string(out), "ant-secret") || strings.Contains(string(out), "gemini-secret") || !strings.Contains(string(out), "****9876") {
+		t.Errorf("Expected the backup API keys to be masked:\n%s", out)
+	}
+	if cfg.LLM.Backups[0].APIKey != "sk-ant-secret-9876" {
+		t.Errorf("Expected the API keys masked in the copy only")
+	}
+
+	cfg.LLM.Backups = append(cfg.LLM.Backups, BackupLLMConfig{Provider: "cohere"})
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "llm.backups[2].provider") || !strings.Contains(err.Error(), "llm.backups[2].model") {
+		t.Errorf("Expected problems for the third backup, got %v", err)
+	}
+}
@@ -65,6 +65,28 @@ func (dp *DataProvider) GetAllSessionsFlat() ([]*model.Session, error) {
 	return allSessions, nil
 }
 
+// GetSessionsFlatInRange returns sessions active within r as a flat slice, newest activity first.
+// A zero range returns all sessions.
+func (dp *DataProvider) GetSessionsFlatInRange(r debuger.TimeRange) ([]*model.Session, error) {
+	if r.IsZero() {
+		return dp.GetAllSessionsFlat()
+	}
+	sessionsByUser, err := dp.store.GetSessionsByTimeRange(r.From, r.To)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*model.Session
+	for _, userSessions := range sessionsByUser {
+		sessions = append(sessions, userSessions...)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return getSessionLastActivity(sessions[i]).After(getSessionLastActivity(sessions[j]))
+	})
+
+	return sessions, nil
+}
+
 // GetSessionCount returns total number of sessions
 func (dp *DataProvider) GetSessionCount() (int, error) {
 	sessionsByUser, err := dp.GetAllSessionsSorted()
@@ -144,6 +166,14 @@ func (dp *DataProvider) GetAllMessages() ([]*model.Message, error) {
 	return dp.store.GetAllMessages()
 }
 
+// GetMessagesInRange returns messages created within r (newest first); a zero range returns all messages
+func (dp *DataProvider) GetMessagesInRange(r debuger.TimeRange) ([]*model.Message, error) {
+	if r.IsZero() {
+		return dp.store.GetAllMessages()
+	}
+	return dp.store.GetMessagesByTimeRange(r.From, r.To)
+}
+
 // GetMessagesBySession returns messages for a session sorted by CreatedAt (oldest first for conversation flow)
 // Note: Database query returns DESC, so we reverse to get ASC
 func (dp *DataProvider) GetMessagesBySession(sessionID string) ([]*model.Message, error) {
@@ -202,25 +232,24 @@ func (dp *DataProvider) GetOpenedFilesBySession(sessionID string) ([]*model.Open
 	return files, nil
 }
 
-// GetOpenedFilesByUser returns opened files for a user sorted by OpenedAt (newest first)
-func (dp *DataProvider) GetOpenedFilesByUser(userID string) ([]*model.OpenedFile, error) {
-	allFiles, err := dp.store.GetAllOpenedFiles()
-	if err != nil {
-		return nil, err
-	}
-	var userFiles []*model.OpenedFile
-	for _, f := range allFiles {
-		if f.UserID == userID {
-			userFiles = append(userFiles, f)
+// GetOpenedFilesBySessions returns the opened files of the given sessions sorted by OpenedAt
+// (newest first), querying them per session instead of scanning every opened file
+func (dp *DataProvider) GetOpenedFilesBySessions(sessions []*model.Session) ([]*model.OpenedFile, error) {
+	var files []*model.OpenedFile
+	for _, session := range sessions {
+		sessionFiles, err := dp.store.GetOpenedFilesBySession(session.SessionID)
+		if err != nil {
+			return nil, err
 		}
+		files = append(files, sessionFiles...)
 	}
 
 	// Sort by OpenedAt (newest first)
-	sort.Slice(userFiles, func(i, j int) bool {
-		return userFiles[i].OpenedAt.After(userFiles[j].OpenedAt)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].OpenedAt.After(files[j].OpenedAt)
 	})
 
-	return userFiles, nil
+	return files, nil
 }
 
 // GetAllToolCalls returns all tool calls sorted by CreatedAt (newest first)
@@ -238,6 +267,19 @@ func (dp *DataProvider) GetAllToolCalls() ([]*model.ToolCall, error) {
 	return toolCalls, nil
 }
 
+// GetToolCallsPage returns one page of tool calls (newest first) and the total number of tool calls
+func (dp *DataProvider) GetToolCallsPage(offset, limit int) ([]*model.ToolCall, int, error) {
+	return dp.store.GetToolCallsPaginated(offset, limit)
+}
+
+// GetToolCallsInRange returns tool calls created within r (newest first); a zero range returns all tool calls
+func (dp *DataProvider) GetToolCallsInRange(r debuger.TimeRange) ([]*model.ToolCall, error) {
+	if r.IsZero() {
+		return dp.GetAllToolCalls()
+	}
+	return dp.store.GetToolCallsByTimeRange(r.From, r.To)
+}
+
 // GetToolCallsBySession returns tool calls for a session sorted by CreatedAt (newest first)
 func (dp *DataProvider) GetToolCallsBySession(sessionID string) ([]*model.ToolCall, error) {
 	toolCalls, err := dp.store.GetToolCallsBySession(sessionID)
@@ -263,6 +305,11 @@ func (dp *DataProvider) GetToolCallByToolID(toolID string) (*model.ToolCall, err
 	return dp.store.GetToolCallByToolID(toolID)
 }
 
+// GetToolCall returns a tool call by ToolID or OpenAI tool call ID (nil if not found)
+func (dp *DataProvider) GetToolCall(toolID string) (*model.ToolCall, error) {
+	return dp.store.GetToolCall(toolID)
+}
+
 // GetAllSummarizationLogs returns all summarization logs
 func (dp *DataProvider) GetAllSummarizationLogs() ([]*model.SummarizationLog, error) {
 	logs, err := dp.store.GetAllSummarizationLogs()
@@ -278,6 +325,11 @@ func (dp *DataProvider) GetAllSummarizationLogs() ([]*model.SummarizationLog, er
 	return logs, nil
 }
 
+// GetSummarizationLogsPage returns one page of summarization logs (newest first) and the total number of logs
+func (dp *DataProvider) GetSummarizationLogsPage(offset, limit int) ([]*model.SummarizationLog, int, error) {
+	return dp.store.GetSummarizationLogsPaginated(offset, limit)
+}
+
 // GetSummarizationLogsBySession returns summarization logs for a session sorted by CreatedAt (newest first)
 func (dp *DataProvider) GetSummarizationLogsBySession(sessionID string) ([]*model.SummarizationLog, error) {
 	logs, err := dp.store.GetSummarizationLogsBySession(sessionID)
@@ -295,25 +347,49 @@ func (dp *DataProvider) GetSummarizationLogsBySession(sessionID string) ([]*mode
 
 // GetDashboardStats returns statistics for the dashboard
 func (dp *DataProvider) GetDashboardStats() (*debuger.DashboardStats, error) {
-	userCount, err := dp.GetUserCount()
-	if err != nil {
-		return nil, err
-	}
+	return dp.GetDashboardStatsInRange(debuger.TimeRange{})
+}
 
-	sessionCount, err := dp.GetSessionCount()
-	if err != nil {
-		return nil, err
+// GetDashboardStatsInRange returns dashboard statistics restricted to r.
+// Within a range, users are those with a session active in it and files are those opened in it.
+func (dp *DataProvider) GetDashboardStatsInRange(r debuger.TimeRange) (*debuger.DashboardStats, error) {
+	var userCount, sessionCount int
+	if r.IsZero() {
+		var err error
+		if userCount, err = dp.GetUserCount(); err != nil {
+			return nil, err
+		}
+		if sessionCount, err = dp.GetSessionCount(); err != nil {
+			return nil, err
+		}
+	} else {
+		sessionsByUser, err := dp.store.GetSessionsByTimeRange(r.From, r.To)
+		if err != nil {
+			return nil, err
+		}
+		for _, sessions := range sessionsByUser {
+			if len(sessions) > 0 {
+				userCount++
+			}
+			sessionCount += len(sessions)
+		}
 	}
 
-	messages, err := dp.store.GetAllMessages()
+	messages, err := dp.GetMessagesInRange(r)
 	if err != nil {
 		return nil, err
 	}
 
-	files, err := dp.store.GetAllOpenedFiles()
+	allFiles, err := dp.store.GetAllOpenedFiles()
 	if err != nil {
 		return nil, err
 	}
+	var files []*model.OpenedFile
+	for _, f := range allFiles {
+		if r.Contains(f.OpenedAt) {
+			files = append(files, f)
+		}
+	}
 
 	// Count tool calls
 	toolCallCount := 0
@@ -334,23 +410,22 @@ func (dp *DataProvider) GetDashboardStats() (*debuger.DashboardStats, error) {
 
 // GetSummarizationStats returns statistics for summarization
 func (dp *DataProvider) GetSummarizationStats(config *debuger.SchedulerConfig) (*debuger.SummarizationStats, *debuger.SessionStats, error) {
-	logs, err := dp.store.GetAllSummarizationLogs()
+	counts, err := dp.store.CountSummarizationLogsByStatus()
 	if err != nil {
 		return nil, nil, err
 	}
 
 	// Count log statuses
-	sumStats := &debuger.SummarizationStats{
-		TotalLogs: len(logs),
-	}
-	for _, log := range logs {
-		switch log.Status {
+	sumStats := &debuger.SummarizationStats{}
+	for status, n := range counts {
+		sumStats.TotalLogs += n
+		switch status {
 		case "success":
-			sumStats.SuccessLogs++
+			sumStats.SuccessLogs += n
 		case "failed":
-			sumStats.FailedLogs++
+			sumStats.FailedLogs += n
 		default:
-			sumStats.PendingLogs++
+			sumStats.PendingLogs += n
 		}
 	}
 
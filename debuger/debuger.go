@@ -2,18 +2,24 @@ package debuger
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ghiac/agentize/model"
 )
 
+// DefaultRefreshInterval is how often debug pages reload themselves unless configured otherwise
+const DefaultRefreshInterval = 30 * time.Second
+
 // UserBillingHTMLProvider returns HTML fragment for a user's billing/credit summary (optional; used on user detail page).
 type UserBillingHTMLProvider func(userID string) (html string, err error)
 
 // DebugHandler provides HTML debugging interface for SessionStore
 type DebugHandler struct {
 	store                   model.SessionStore
+	readStore               DebugStore // optional replica the pages read from (see SetReadStore)
 	schedulerConfig         *SchedulerConfig
 	userBillingHTMLProvider UserBillingHTMLProvider
+	refreshInterval         time.Duration // page auto-refresh interval; <= 0 disables it
 }
 
 // NewDebugHandler creates a new debug handler for a SessionStore
@@ -22,7 +28,7 @@ func NewDebugHandler(store model.SessionStore) (*DebugHandler, error) {
 	if _, ok := store.(DebugStore); !ok {
 		return nil, fmt.Errorf("store does not implement DebugStore interface")
 	}
-	return &DebugHandler{store: store}, nil
+	return &DebugHandler{store: store, refreshInterval: DefaultRefreshInterval}, nil
 }
 
 // NewDebugHandlerWithConfig creates a new debug handler with scheduler configuration
@@ -48,6 +54,16 @@ func (h *DebugHandler) GetUserBillingHTML(userID string) (string, error) {
 	return h.userBillingHTMLProvider(userID)
 }
 
+// SetRefreshInterval sets how often debug pages reload themselves (<= 0 disables auto-refresh)
+func (h *DebugHandler) SetRefreshInterval(interval time.Duration) {
+	h.refreshInterval = interval
+}
+
+// GetRefreshInterval returns the page auto-refresh interval (<= 0 means disabled)
+func (h *DebugHandler) GetRefreshInterval() time.Duration {
+	return h.refreshInterval
+}
+
 // SetSchedulerConfig sets the scheduler configuration
 func (h *DebugHandler) SetSchedulerConfig(config *SchedulerConfig) {
 	h.schedulerConfig = config
@@ -58,8 +74,32 @@ func (h *DebugHandler) GetSchedulerConfig() *SchedulerConfig {
 	return h.schedulerConfig
 }
 
-// GetStore returns the underlying store as DebugStore
+// SetReadStore routes the pages' queries to store, e.g. a replica or a store reading from
+// secondaries, so heavy GetAll* queries do not compete with live traffic on the primary.
+// Writes (such as deleting a user's data) still go to the primary. nil reads from the primary again.
+func (h *DebugHandler) SetReadStore(store model.SessionStore) error {
+	if store == nil {
+		h.readStore = nil
+		return nil
+	}
+	readStore, ok := store.(DebugStore)
+	if !ok {
+		return fmt.Errorf("read store does not implement DebugStore interface")
+	}
+	h.readStore = readStore
+	return nil
+}
+
+// GetStore returns the store the pages read from: the read store if set, otherwise the primary
 func (h *DebugHandler) GetStore() DebugStore {
+	if h.readStore != nil {
+		return h.readStore
+	}
+	return h.store.(DebugStore)
+}
+
+// GetWriteStore returns the primary store as DebugStore, for the actions that modify data
+func (h *DebugHandler) GetWriteStore() DebugStore {
 	return h.store.(DebugStore)
 }
 
@@ -67,3 +107,12 @@ func (h *DebugHandler) GetStore() DebugStore {
 func (h *DebugHandler) GetSessionStore() model.SessionStore {
 	return h.store
 }
+
+// Namespace returns the namespace of the underlying store ("" if it has none).
+// Every page reads through the store, so it only shows this namespace's data.
+func (h *DebugHandler) Namespace() string {
+	if namespaced, ok := h.store.(interface{ Namespace() string }); ok {
+		return namespaced.Namespace()
+	}
+	return ""
+}
@@ -2,6 +2,8 @@ package pages
 
 import (
 	"fmt"
+	"html/template"
+	"net/url"
 
 	"github.com/ghiac/agentize/debuger"
 	"github.com/ghiac/agentize/debuger/data"
@@ -10,15 +12,26 @@ import (
 )
 
 // RenderDashboard generates the dashboard HTML page
-func RenderDashboard(handler *debuger.DebugHandler) (string, error) {
+// A non-zero tr restricts the stat cards to that time range
+func RenderDashboard(handler *debuger.DebugHandler, tr debuger.TimeRange) (string, error) {
 	dp := data.NewDataProvider(handler.GetStore())
 
-	stats, err := dp.GetDashboardStats()
+	stats, err := dp.GetDashboardStatsInRange(tr)
 	if err != nil {
 		return "", fmt.Errorf("failed to get dashboard stats: %w", err)
 	}
 
+	// Card links carry the range to the list pages that support it
+	rangeQuery := ""
+	if query := debuger.SetTimeRangeParams(url.Values{}, tr); len(query) > 0 {
+		rangeQuery = "?" + query.Encode()
+	}
+
 	content := ui.ContainerStart()
+	if ns := handler.Namespace(); ns != "" {
+		content += fmt.Sprintf(`<div class="mb-3"><span class="badge bg-secondary"><i class="bi bi-diagram-3 me-1"></i>Namespace: %s</span></div>`, template.HTMLEscapeString(ns))
+	}
+	content += components.TimeRangeFilter("/agentize/debug", tr, nil)
 
 	// Stats cards row
 	content += `<div class="row g-4 mb-4">`
@@ -34,9 +47,10 @@ func RenderDashboard(handler *debuger.DebugHandler) (string, error) {
 
 	// Sessions card
 	content += `<div class="col-md-6 col-lg-4 col-xl-2">`
-	content += components.StatCard(
+	content += components.StatCardWithLink(
 		fmt.Sprintf("%d", stats.TotalSessions),
 		"Sessions", "📊", "success",
+		"/agentize/debug/sessions"+rangeQuery, "View Details",
 	)
 	content += `</div>`
 
@@ -45,7 +59,7 @@ func RenderDashboard(handler *debuger.DebugHandler) (string, error) {
 	content += components.StatCardWithLink(
 		fmt.Sprintf("%d", stats.TotalMessages),
 		"Messages", "💬", "info",
-		"/agentize/debug/messages", "View Details",
+		"/agentize/debug/messages"+rangeQuery, "View Details",
 	)
 	content += `</div>`
 
@@ -63,7 +77,7 @@ func RenderDashboard(handler *debuger.DebugHandler) (string, error) {
 	content += components.StatCardWithLink(
 		fmt.Sprintf("%d", stats.TotalToolCalls),
 		"Tool Calls", "🔧", "danger",
-		"/agentize/debug/tool-calls", "View Details",
+		"/agentize/debug/tool-calls"+rangeQuery, "View Details",
 	)
 	content += `</div>`
 
@@ -122,5 +136,5 @@ func RenderDashboard(handler *debuger.DebugHandler) (string, error) {
 </div>`
 
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Dashboard") + ui.NavbarAndBody("/agentize/debug", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Dashboard") + ui.NavbarAndBody("/agentize/debug", content) + ui.Footer(handler.GetRefreshInterval()), nil
 }
@@ -76,5 +76,5 @@ func RenderFiles(handler *debuger.DebugHandler, page int) (string, error) {
 
 	content += ui.CardEnd()
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Opened Files") + ui.NavbarAndBody("/agentize/debug/files", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Opened Files") + ui.NavbarAndBody("/agentize/debug/files", content) + ui.Footer(handler.GetRefreshInterval()), nil
 }
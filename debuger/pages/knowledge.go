@@ -0,0 +1,50 @@
+package pages
+
+import (
+	"fmt"
+
+	"github.com/ghiac/agentize/debuger"
+	"github.com/ghiac/agentize/debuger/ui"
+	"github.com/ghiac/agentize/debuger/ui/components"
+)
+
+// RenderKnowledge generates the knowledge search index page; stats is nil when knowledge search
+// is not enabled
+func RenderKnowledge(handler *debuger.DebugHandler, stats *debuger.KnowledgeIndexStats) (string, error) {
+	content := ui.ContainerStart()
+	if stats == nil {
+		content += components.InfoAlert("Knowledge search is not enabled (see EnableKnowledgeSearch).")
+		content += ui.ContainerEnd()
+		return ui.Header("Agentize Debug - Knowledge") + ui.NavbarAndBody("/agentize/debug/knowledge", content) + ui.Footer(handler.GetRefreshInterval()), nil
+	}
+
+	if stats.LastError != "" {
+		content += components.DangerAlert("Last build failed: " + stats.LastError)
+	}
+
+	content += `<div class="row g-4 mb-4">`
+	for _, stat := range []struct{ value, label, icon, color string }{
+		{fmt.Sprintf("%d / %d", stats.Nodes, stats.TreeNodes), "Indexed Nodes", "📚", "primary"},
+		{fmt.Sprintf("%d", stats.Chunks), "Excerpts", "🧩", "info"},
+		{fmt.Sprintf("%d", stats.Embedded), "Embedded by Last Build", "🧮", "secondary"},
+	} {
+		content += `<div class="col-md-6 col-lg-4">`
+		content += components.StatCard(stat.value, stat.label, stat.icon, stat.color)
+		content += `</div>`
+	}
+	content += `</div>`
+
+	lastBuilt := debuger.FormatTime(stats.LastBuilt)
+	if !stats.LastBuilt.IsZero() {
+		lastBuilt += " (" + debuger.FormatDuration(stats.LastBuilt) + ")"
+	}
+	content += components.ConfigCard("Knowledge Index", []components.ConfigItem{
+		{Label: "Last Built", Value: lastBuilt},
+		{Label: "Indexed Nodes", Value: fmt.Sprintf("%d", stats.Nodes)},
+		{Label: "Nodes in Tree", Value: fmt.Sprintf("%d", stats.TreeNodes)},
+		{Label: "Excerpts", Value: fmt.Sprintf("%d", stats.Chunks)},
+	})
+
+	content += ui.ContainerEnd()
+	return ui.Header("Agentize Debug - Knowledge") + ui.NavbarAndBody("/agentize/debug/knowledge", content) + ui.Footer(handler.GetRefreshInterval()), nil
+}
@@ -3,6 +3,7 @@ package pages
 import (
 	"fmt"
 	"html/template"
+	"net/url"
 
 	"github.com/ghiac/agentize/debuger"
 	"github.com/ghiac/agentize/debuger/data"
@@ -11,34 +12,71 @@ import (
 	"github.com/ghiac/agentize/model"
 )
 
+// messageRoles are the roles offered in the messages filter form
+var messageRoles = []string{"user", "assistant", "system", "tool"}
+
 // RenderMessages generates the messages list HTML page
-// userID and sessionID are optional filters
-func RenderMessages(handler *debuger.DebugHandler, page int, userID, sessionID string) (string, error) {
+// userID, sessionID, role and tr are optional filters and can be combined (a zero tr means all time)
+func RenderMessages(handler *debuger.DebugHandler, page int, userID, sessionID, role string, tr debuger.TimeRange) (string, error) {
 	dp := data.NewDataProvider(handler.GetStore())
 
 	var messages []*model.Message
 	var err error
 	var title string
-	var baseURL string
 
-	// Apply filters based on query params
+	// Load the narrowest set from the store, then apply the remaining filters in memory
 	if sessionID != "" {
 		messages, err = dp.GetMessagesBySessionDesc(sessionID)
 		title = "Messages for Session: " + sessionID
-		baseURL = "/agentize/debug/messages?session=" + template.URLQueryEscaper(sessionID)
 	} else if userID != "" {
 		messages, err = dp.GetMessagesByUser(userID)
 		title = "Messages for User: " + userID
-		baseURL = "/agentize/debug/messages?user=" + template.URLQueryEscaper(userID)
 	} else {
-		messages, err = dp.GetAllMessages()
+		messages, err = dp.GetMessagesInRange(tr)
 		title = "All Messages"
-		baseURL = "/agentize/debug/messages"
 	}
 	if err != nil {
 		return "", fmt.Errorf("failed to get messages: %w", err)
 	}
 
+	// The time range was already applied by the store when neither session nor user is set
+	filterRange := (sessionID != "" || userID != "") && !tr.IsZero()
+	if (sessionID != "" && userID != "") || role != "" || filterRange {
+		filtered := make([]*model.Message, 0, len(messages))
+		for _, msg := range messages {
+			if sessionID != "" && userID != "" && msg.UserID != userID {
+				continue
+			}
+			if role != "" && msg.Role != role {
+				continue
+			}
+			if filterRange && !tr.Contains(msg.CreatedAt) {
+				continue
+			}
+			filtered = append(filtered, msg)
+		}
+		messages = filtered
+	}
+	if role != "" {
+		title += " (role: " + role + ")"
+	}
+
+	query := url.Values{}
+	if userID != "" {
+		query.Set("user", userID)
+	}
+	if sessionID != "" {
+		query.Set("session", sessionID)
+	}
+	if role != "" {
+		query.Set("role", role)
+	}
+	debuger.SetTimeRangeParams(query, tr)
+	baseURL := "/agentize/debug/messages"
+	if len(query) > 0 {
+		baseURL += "?" + query.Encode()
+	}
+
 	// Pagination
 	totalItems := len(messages)
 	startIdx, endIdx, _ := components.GetPaginationInfo(page, totalItems, components.DefaultItemsPerPage)
@@ -63,6 +101,8 @@ func RenderMessages(handler *debuger.DebugHandler, page int, userID, sessionID s
 		})
 	}
 
+	content += messagesFilterForm(userID, sessionID, role, tr)
+	content += components.TimeRangeFilter("/agentize/debug/messages", tr, query)
 	content += ui.CardStartWithCount(title, "chat-dots-fill", totalItems)
 
 	if len(messages) == 0 {
@@ -71,6 +111,9 @@ func RenderMessages(handler *debuger.DebugHandler, page int, userID, sessionID s
 		rowConfig := components.DefaultMessageRowConfig()
 		rowConfig.ShowUser = true
 		rowConfig.ShowSession = true
+		if feedbackStore, ok := handler.GetStore().(model.FeedbackStore); ok {
+			rowConfig.Feedback = messageFeedback(feedbackStore, paginatedMessages)
+		}
 
 		columns := components.MessageTableColumns(rowConfig)
 		content += components.TableStartWithConfig(columns, components.DefaultTableConfig())
@@ -86,5 +129,59 @@ func RenderMessages(handler *debuger.DebugHandler, page int, userID, sessionID s
 
 	content += ui.CardEnd()
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Messages") + ui.NavbarAndBody("/agentize/debug/messages", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Messages") + ui.NavbarAndBody("/agentize/debug/messages", content) + ui.Footer(handler.GetRefreshInterval()), nil
+}
+
+// messageFeedback returns the MessageRowConfig.Feedback of a page of messages, loading their
+// stats in one query; when it fails the messages show no rating
+func messageFeedback(feedbackStore model.FeedbackStore, messages []*model.Message) func(string) *model.FeedbackStats {
+	messageIDs := make([]string, len(messages))
+	for i, msg := range messages {
+		messageIDs[i] = msg.MessageID
+	}
+	byMessage, err := feedbackStore.GetFeedbackStatsByMessages(messageIDs)
+	if err != nil {
+		byMessage = nil
+	}
+	return func(messageID string) *model.FeedbackStats {
+		return byMessage[messageID]
+	}
+}
+
+// messagesFilterForm renders the user/session/role filter form shown above the messages table
+func messagesFilterForm(userID, sessionID, role string, tr debuger.TimeRange) string {
+	roleOptions := `<option value="">All roles</option>`
+	for _, r := range messageRoles {
+		selected := ""
+		if r == role {
+			selected = " selected"
+		}
+		roleOptions += fmt.Sprintf(`<option value="%s"%s>%s</option>`, r, selected, r)
+	}
+
+	hidden := ""
+	for k, v := range debuger.SetTimeRangeParams(url.Values{}, tr) {
+		hidden += fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, k, template.HTMLEscapeString(v[0]))
+	}
+
+	return fmt.Sprintf(`<form method="GET" action="/agentize/debug/messages" class="row g-2 align-items-end mb-3">
+    %s
+    <div class="col-md-4">
+        <label class="form-label small mb-1" for="filter-user">User ID</label>
+        <input type="text" class="form-control form-control-sm" id="filter-user" name="user" value="%s" placeholder="any">
+    </div>
+    <div class="col-md-4">
+        <label class="form-label small mb-1" for="filter-session">Session ID</label>
+        <input type="text" class="form-control form-control-sm" id="filter-session" name="session" value="%s" placeholder="any">
+    </div>
+    <div class="col-md-2">
+        <label class="form-label small mb-1" for="filter-role">Role</label>
+        <select class="form-select form-select-sm" id="filter-role" name="role">%s</select>
+    </div>
+    <div class="col-md-2 d-flex gap-2">
+        <button type="submit" class="btn btn-sm btn-primary"><i class="bi bi-funnel"></i> Filter</button>
+        <a href="/agentize/debug/messages" class="btn btn-sm btn-outline-secondary">Clear</a>
+    </div>
+</form>`,
+		hidden, template.HTMLEscapeString(userID), template.HTMLEscapeString(sessionID), roleOptions)
 }
@@ -3,6 +3,9 @@ package pages
 import (
 	"fmt"
 	"html/template"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/ghiac/agentize/debuger"
@@ -13,21 +16,71 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
+// Values of the sessions page "archived" filter
+const (
+	ArchivedFilterAll     = ""        // archived and active sessions
+	ArchivedFilterActive  = "exclude" // hide archived sessions
+	ArchivedFilterArchive = "only"    // only archived sessions
+)
+
 // RenderSessions generates the sessions list HTML page
-func RenderSessions(handler *debuger.DebugHandler, page int) (string, error) {
+// tr optionally restricts the list to sessions active in a time range (zero means all time);
+// archived is one of the ArchivedFilter values; tags, when given, keeps the sessions carrying any
+// of them (every one of them with matchAll)
+func RenderSessions(handler *debuger.DebugHandler, page int, tr debuger.TimeRange, archived string, tags []string, matchAll bool) (string, error) {
 	dp := data.NewDataProvider(handler.GetStore())
 
-	allSessions, err := dp.GetAllSessionsFlat()
+	allSessions, err := dp.GetSessionsFlatInRange(tr)
 	if err != nil {
 		return "", fmt.Errorf("failed to get sessions: %w", err)
 	}
 
+	if archived != ArchivedFilterAll {
+		filtered := make([]*model.Session, 0, len(allSessions))
+		for _, s := range allSessions {
+			if s.Archived == (archived == ArchivedFilterArchive) {
+				filtered = append(filtered, s)
+			}
+		}
+		allSessions = filtered
+	}
+
+	tags = model.NormalizeTags(tags)
+	if len(tags) > 0 {
+		filtered := make([]*model.Session, 0, len(allSessions))
+		for _, s := range allSessions {
+			if s.MatchesTags(tags, matchAll) {
+				filtered = append(filtered, s)
+			}
+		}
+		allSessions = filtered
+	}
+
 	// Pagination
 	totalItems := len(allSessions)
 	startIdx, endIdx, _ := components.GetPaginationInfo(page, totalItems, components.DefaultItemsPerPage)
 	paginatedSessions := allSessions[startIdx:endIdx]
 
+	query := url.Values{}
+	if archived != ArchivedFilterAll {
+		query.Set("archived", archived)
+	}
+	if len(tags) > 0 {
+		query.Set("tags", strings.Join(tags, ","))
+		if matchAll {
+			query.Set("match", "all")
+		}
+	}
+	debuger.SetTimeRangeParams(query, tr)
+	baseURL := "/agentize/debug/sessions"
+	if len(query) > 0 {
+		baseURL += "?" + query.Encode()
+	}
+
 	content := ui.ContainerStart()
+	content += components.TimeRangeFilter("/agentize/debug/sessions", tr, query)
+	content += archivedFilterLinks(query, archived)
+	content += tagFilterForm(query, tags, matchAll)
 	content += ui.CardStartWithCount("All Sessions", "diagram-3-fill", totalItems)
 
 	if len(allSessions) == 0 {
@@ -56,12 +109,69 @@ func RenderSessions(handler *debuger.DebugHandler, page int) (string, error) {
 
 		content += components.TableEnd(true)
 		content += components.SessionTableScript()
-		content += components.PaginationSimple(page, totalItems, components.DefaultItemsPerPage, "/agentize/debug/sessions")
+		content += components.PaginationSimple(page, totalItems, components.DefaultItemsPerPage, baseURL)
 	}
 
 	content += ui.CardEnd()
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Sessions") + ui.NavbarAndBody("/agentize/debug/sessions", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Sessions") + ui.NavbarAndBody("/agentize/debug/sessions", content) + ui.Footer(handler.GetRefreshInterval()), nil
+}
+
+// archivedFilterLinks renders the All / Active / Archived switch of the sessions page
+func archivedFilterLinks(query url.Values, current string) string {
+	links := ""
+	for _, f := range []struct{ Label, Value string }{
+		{"All", ArchivedFilterAll},
+		{"Active", ArchivedFilterActive},
+		{"📦 Archived", ArchivedFilterArchive},
+	} {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Del("page")
+		q.Del("archived")
+		if f.Value != ArchivedFilterAll {
+			q.Set("archived", f.Value)
+		}
+		href := "/agentize/debug/sessions"
+		if len(q) > 0 {
+			href += "?" + q.Encode()
+		}
+		variant := "btn-outline-secondary"
+		if f.Value == current {
+			variant = "btn-secondary"
+		}
+		links += fmt.Sprintf(`<a href="%s" class="btn btn-sm %s">%s</a>`, template.HTMLEscapeString(href), variant, f.Label)
+	}
+	return `<div class="btn-group mb-3" role="group" aria-label="Archived filter">` + links + `</div>`
+}
+
+// tagFilterForm renders the tag filter of the sessions page, keeping the other filters
+func tagFilterForm(query url.Values, tags []string, matchAll bool) string {
+	hidden := ""
+	for _, k := range []string{"archived", "from", "to"} {
+		if v := query.Get(k); v != "" {
+			hidden += fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, k, template.HTMLEscapeString(v))
+		}
+	}
+	checked := ""
+	if matchAll {
+		checked = " checked"
+	}
+	return fmt.Sprintf(`<form method="GET" action="/agentize/debug/sessions" class="row g-2 align-items-center mb-3">
+    %s
+    <div class="col-md-4">
+        <input type="text" class="form-control form-control-sm" name="tags" value="%s" placeholder="Tags, comma separated">
+    </div>
+    <div class="col-auto form-check">
+        <input class="form-check-input" type="checkbox" id="tags-match-all" name="match" value="all"%s>
+        <label class="form-check-label small" for="tags-match-all">Match all tags</label>
+    </div>
+    <div class="col-auto">
+        <button type="submit" class="btn btn-sm btn-outline-primary"><i class="bi bi-tags"></i> Filter</button>
+    </div>
+</form>`, hidden, template.HTMLEscapeString(strings.Join(tags, ", ")), checked)
 }
 
 // convertExMsgToMessage converts an openai.ChatCompletionMessage to model.Message for display
@@ -83,8 +193,14 @@ func convertExMsgToMessage(chatMsg openai.ChatCompletionMessage, sessionID, user
 	}
 }
 
+// SessionDetailOptions controls optional notices on the session detail page
+type SessionDetailOptions struct {
+	SummarizedLogID string // shows a success notice linking to this summarization log
+	SummarizeError  string // shows a failure notice for a manual summarization
+}
+
 // RenderSessionDetail generates the session detail HTML page
-func RenderSessionDetail(handler *debuger.DebugHandler, sessionID string) (string, error) {
+func RenderSessionDetail(handler *debuger.DebugHandler, sessionID string, opts ...SessionDetailOptions) (string, error) {
 	dp := data.NewDataProvider(handler.GetStore())
 
 	session, err := dp.GetSession(sessionID)
@@ -121,6 +237,10 @@ func RenderSessionDetail(handler *debuger.DebugHandler, sessionID string) (strin
 	}
 
 	summarizationLogs, _ := dp.GetSummarizationLogsBySession(sessionID)
+	stats, err := handler.GetStore().GetSessionStats(sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get session stats: %w", err)
+	}
 	dbToolCalls, _ := dp.GetToolCallsBySession(sessionID)
 	toolCalls := data.ConvertToolCallsToInfo(dbToolCalls)
 
@@ -134,6 +254,18 @@ func RenderSessionDetail(handler *debuger.DebugHandler, sessionID string) (strin
 		{Label: "Session", Active: true},
 	})
 
+	// Manual summarization outcome
+	if len(opts) > 0 {
+		if opts[0].SummarizedLogID != "" {
+			content += fmt.Sprintf(`<div class="alert alert-success">
+    <i class="bi bi-check-circle me-2"></i>Session summarized. %s
+</div>`, components.Link("View summarization log "+opts[0].SummarizedLogID, "/agentize/debug/summarized/"+url.PathEscape(opts[0].SummarizedLogID)))
+		}
+		if opts[0].SummarizeError != "" {
+			content += components.DangerAlert("Summarization failed: " + opts[0].SummarizeError)
+		}
+	}
+
 	// Session info card
 	title := session.Title
 	if title == "" {
@@ -151,7 +283,7 @@ func RenderSessionDetail(handler *debuger.DebugHandler, sessionID string) (strin
 	activeMessagesCount := len(session.Msgs)
 	archivedMessagesCount := len(session.ArchivedMsgs)
 	// If database messages count is higher, use it (messages from DB are more accurate)
-	dbMessagesCount := len(messages)
+	dbMessagesCount := stats.TotalMessages
 	sessionTotalCount := activeMessagesCount + archivedMessagesCount
 	if dbMessagesCount > sessionTotalCount {
 		// DB has more messages than session object, adjust active count
@@ -177,10 +309,36 @@ func RenderSessionDetail(handler *debuger.DebugHandler, sessionID string) (strin
 		tagsDisplay = components.TagBadges(session.Tags)
 	}
 
+	// Stored message counts per role, from the store's aggregate stats
+	rolesDisplay := "-"
+	if stats.TotalMessages > 0 {
+		roles := make([]string, 0, len(stats.MessagesByRole))
+		for role := range stats.MessagesByRole {
+			roles = append(roles, role)
+		}
+		sort.Strings(roles)
+		rolesDisplay = ""
+		for _, role := range roles {
+			label := role
+			if label == "" {
+				label = "unknown"
+			}
+			rolesDisplay += components.Badge(fmt.Sprintf("%d %s", stats.MessagesByRole[role], label), "secondary") + " "
+		}
+	}
+
+	messageSpanDisplay := "-"
+	if !stats.FirstMessageAt.IsZero() {
+		messageSpanDisplay = debuger.FormatTime(stats.FirstMessageAt) + " → " + debuger.FormatTime(stats.LastMessageAt)
+	}
+
 	content += fmt.Sprintf(`
 <div class="card mb-4">
-    <div class="card-header">
+    <div class="card-header d-flex justify-content-between align-items-center">
         <h4 class="mb-0"><i class="bi bi-diagram-3-fill me-2"></i>Session Information</h4>
+        <form method="POST" action="%s" onsubmit="return confirm('Summarize this session now? Active messages will be archived.');" class="d-inline">
+            <button type="submit" class="btn btn-sm btn-outline-primary"><i class="bi bi-file-text me-1"></i>Summarize now</button>
+        </form>
     </div>
     <div class="card-body">
         <div class="row g-4">
@@ -231,6 +389,22 @@ func RenderSessionDetail(handler *debuger.DebugHandler, sessionID string) (strin
                     <strong class="d-block mb-2">Messages:</strong>
                     <div>%s + %s</div>
                 </div>
+                <div class="mb-3">
+                    <strong class="d-block mb-2">Stored Messages:</strong>
+                    <div>%s</div>
+                </div>
+                <div class="mb-3">
+                    <strong class="d-block mb-2">Message Span:</strong>
+                    <div class="text-muted">%s</div>
+                </div>
+                <div class="mb-3">
+                    <strong class="d-block mb-2">Tokens / Tool Calls / Summarizations:</strong>
+                    <div>%s %s %s</div>
+                </div>
+                <div class="mb-3">
+                    <strong class="d-block mb-2">LLM Token Usage:</strong>
+                    <div>%s %s %s %s %s</div>
+                </div>
                 <div class="mb-3">
                     <strong class="d-block mb-2">Opened Files:</strong>
                     <div>%s</div>
@@ -247,6 +421,7 @@ func RenderSessionDetail(handler *debuger.DebugHandler, sessionID string) (strin
         </div>
     </div>
 </div>`,
+		"/agentize/debug/sessions/"+url.PathEscape(session.SessionID)+"/summarize",
 		components.CodeBlock(template.HTMLEscapeString(session.SessionID)),
 		template.HTMLEscapeString(title),
 		inProgressBadge,
@@ -262,6 +437,16 @@ func RenderSessionDetail(handler *debuger.DebugHandler, sessionID string) (strin
 		summarizedAtDisplay,
 		components.Badge(fmt.Sprintf("%d active", activeMessagesCount), "primary"),
 		components.Badge(fmt.Sprintf("%d archived", archivedMessagesCount), "secondary"),
+		rolesDisplay,
+		messageSpanDisplay,
+		components.CountBadge(stats.TotalTokens, "secondary"),
+		components.CountBadge(stats.ToolCalls, "warning"),
+		components.CountBadge(stats.Summarizations, "success"),
+		components.Badge(fmt.Sprintf("%d prompt", session.TotalPromptTokens), "info"),
+		components.Badge(fmt.Sprintf("%d completion", session.TotalCompletionTokens), "info"),
+		components.Badge(fmt.Sprintf("%d reasoning", session.TotalReasoningTokens), "info"),
+		components.Badge(fmt.Sprintf("%d total", session.TotalTokens), "primary"),
+		components.Badge(fmt.Sprintf("%d summarization", session.SummarizationTokens), "secondary"),
 		components.CountBadge(len(files), "info"),
 		components.CountBadge(session.MessageSeq, "info"),
 		components.CountBadge(session.ToolSeq, "info"),
@@ -538,5 +723,5 @@ func RenderSessionDetail(handler *debuger.DebugHandler, sessionID string) (strin
 
 	content += ui.CardEnd()
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Session: "+sessionID) + ui.NavbarAndBody("/agentize/debug", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Session: "+sessionID) + ui.NavbarAndBody("/agentize/debug", content) + ui.Footer(handler.GetRefreshInterval()), nil
 }
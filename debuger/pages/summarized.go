@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"net/url"
 	"sort"
 
 	"github.com/ghiac/agentize/debuger"
@@ -14,8 +15,9 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
-// RenderSummarized generates the summarization logs list HTML page with scheduler config
-func RenderSummarized(handler *debuger.DebugHandler, page int) (string, error) {
+// RenderSummarized generates the summarization logs list HTML page with scheduler config.
+// Only the requested page of logs (offset/limit) is loaded; the stat cards use store-wide counts.
+func RenderSummarized(handler *debuger.DebugHandler, offset, limit int) (string, error) {
 	dp := data.NewDataProvider(handler.GetStore())
 	config := handler.GetSchedulerConfig()
 
@@ -24,16 +26,11 @@ func RenderSummarized(handler *debuger.DebugHandler, page int) (string, error) {
 		return "", fmt.Errorf("failed to get summarization stats: %w", err)
 	}
 
-	logs, err := dp.GetAllSummarizationLogs()
+	paginatedLogs, totalItems, err := dp.GetSummarizationLogsPage(offset, limit)
 	if err != nil {
 		return "", fmt.Errorf("failed to get summarization logs: %w", err)
 	}
 
-	// Pagination for logs
-	totalItems := len(logs)
-	startIdx, endIdx, _ := components.GetPaginationInfo(page, totalItems, components.DefaultItemsPerPage)
-	paginatedLogs := logs[startIdx:endIdx]
-
 	content := ui.ContainerStart()
 
 	// Scheduler Configuration Card (if available)
@@ -122,7 +119,7 @@ func RenderSummarized(handler *debuger.DebugHandler, page int) (string, error) {
 	// Summarization Logs Table
 	content += ui.CardStartWithCount("All Summarization Logs", "file-text-fill", totalItems)
 
-	if len(logs) == 0 {
+	if len(paginatedLogs) == 0 {
 		content += components.InfoAlert("No summarization logs found.")
 	} else {
 		columns := []components.ColumnConfig{
@@ -201,12 +198,12 @@ func RenderSummarized(handler *debuger.DebugHandler, page int) (string, error) {
 		}
 
 		content += components.TableEnd(true)
-		content += components.PaginationSimple(page, totalItems, components.DefaultItemsPerPage, "/agentize/debug/summarized")
+		content += components.PaginationSimple(offset/limit+1, totalItems, limit, limitBaseURL("/agentize/debug/summarized", url.Values{}, limit))
 	}
 
 	content += ui.CardEnd()
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Summarization Logs") + ui.NavbarAndBody("/agentize/debug/summarized", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Summarization Logs") + ui.NavbarAndBody("/agentize/debug/summarized", content) + ui.Footer(handler.GetRefreshInterval()), nil
 }
 
 // RenderSummarizedMessages generates a page showing all summarized messages from all sessions
@@ -370,7 +367,7 @@ func RenderSummarizedMessages(handler *debuger.DebugHandler) (string, error) {
 
 	content += ui.CardEnd()
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Summarized Messages") + ui.NavbarAndBody("/agentize/debug/summarized", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Summarized Messages") + ui.NavbarAndBody("/agentize/debug/summarized", content) + ui.Footer(handler.GetRefreshInterval()), nil
 }
 
 // RenderSummarizationLogDetail generates the detail page for a single summarization log
@@ -698,5 +695,5 @@ func RenderSummarizationLogDetail(handler *debuger.DebugHandler, logID string) (
 	}
 
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Summarization Log: "+logID) + ui.NavbarAndBody("/agentize/debug/summarized", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Summarization Log: "+logID) + ui.NavbarAndBody("/agentize/debug/summarized", content) + ui.Footer(handler.GetRefreshInterval()), nil
 }
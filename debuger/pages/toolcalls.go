@@ -1,8 +1,13 @@
 package pages
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"net/url"
+	"strconv"
 
 	"github.com/ghiac/agentize/debuger"
 	"github.com/ghiac/agentize/debuger/data"
@@ -11,36 +16,56 @@ import (
 	"github.com/ghiac/agentize/model"
 )
 
-// RenderToolCalls generates the tool calls list HTML page
-// sessionID is an optional filter
-func RenderToolCalls(handler *debuger.DebugHandler, page int, sessionID string) (string, error) {
+// ErrToolCallNotFound is returned by RenderToolCallDetail when no tool call matches the ID
+var ErrToolCallNotFound = errors.New("tool call not found")
+
+// RenderToolCalls generates the tool calls list HTML page showing limit tool calls from offset.
+// sessionID and tr are optional filters (a zero tr means all time); without them only the
+// requested page is loaded from the store.
+func RenderToolCalls(handler *debuger.DebugHandler, offset, limit int, sessionID string, tr debuger.TimeRange) (string, error) {
 	dp := data.NewDataProvider(handler.GetStore())
 
 	var dbToolCalls []*model.ToolCall
+	var totalItems int
 	var err error
-	var title string
-	var baseURL string
+	title := "All Tool Calls"
 
 	// Apply filter based on session query param
-	if sessionID != "" {
+	query := url.Values{}
+	switch {
+	case sessionID != "":
 		dbToolCalls, err = dp.GetToolCallsBySession(sessionID)
 		title = "Tool Calls for Session: " + sessionID
-		baseURL = "/agentize/debug/tool-calls?session=" + template.URLQueryEscaper(sessionID)
-	} else {
-		dbToolCalls, err = dp.GetAllToolCalls()
-		title = "All Tool Calls"
-		baseURL = "/agentize/debug/tool-calls"
+		query.Set("session", sessionID)
+	case !tr.IsZero():
+		dbToolCalls, err = dp.GetToolCallsInRange(tr)
+	default:
+		dbToolCalls, totalItems, err = dp.GetToolCallsPage(offset, limit)
 	}
 	if err != nil {
 		return "", fmt.Errorf("failed to get tool calls: %w", err)
 	}
 
-	toolCalls := data.ConvertToolCallsToInfo(dbToolCalls)
+	if sessionID != "" && !tr.IsZero() {
+		filtered := make([]*model.ToolCall, 0, len(dbToolCalls))
+		for _, tc := range dbToolCalls {
+			if tr.Contains(tc.CreatedAt) {
+				filtered = append(filtered, tc)
+			}
+		}
+		dbToolCalls = filtered
+	}
+
+	// Filtered results are loaded whole, so paginate them here
+	if sessionID != "" || !tr.IsZero() {
+		totalItems = len(dbToolCalls)
+		dbToolCalls = dbToolCalls[min(offset, totalItems):min(offset+limit, totalItems)]
+	}
+
+	debuger.SetTimeRangeParams(query, tr)
+	baseURL := limitBaseURL("/agentize/debug/tool-calls", query, limit)
 
-	// Pagination
-	totalItems := len(toolCalls)
-	startIdx, endIdx, _ := components.GetPaginationInfo(page, totalItems, components.DefaultItemsPerPage)
-	paginatedToolCalls := toolCalls[startIdx:endIdx]
+	paginatedToolCalls := data.ConvertToolCallsToInfo(dbToolCalls)
 
 	content := ui.ContainerStart()
 
@@ -54,9 +79,10 @@ func RenderToolCalls(handler *debuger.DebugHandler, page int, sessionID string)
 		})
 	}
 
+	content += components.TimeRangeFilter("/agentize/debug/tool-calls", tr, query)
 	content += ui.CardStartWithCount(title, "tools", totalItems)
 
-	if len(toolCalls) == 0 {
+	if len(paginatedToolCalls) == 0 {
 		content += components.InfoAlert("No tool calls found.")
 	} else {
 		// Configure tool call row display
@@ -79,24 +105,25 @@ func RenderToolCalls(handler *debuger.DebugHandler, page int, sessionID string)
 
 		content += components.TableEnd(true)
 		content += components.ToolCallTableScript()
-		content += components.PaginationSimple(page, totalItems, components.DefaultItemsPerPage, baseURL)
+		content += components.PaginationSimple(offset/limit+1, totalItems, limit, baseURL)
 	}
 
 	content += ui.CardEnd()
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Tool Calls") + ui.NavbarAndBody("/agentize/debug/tool-calls", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Tool Calls") + ui.NavbarAndBody("/agentize/debug/tool-calls", content) + ui.Footer(handler.GetRefreshInterval()), nil
 }
 
-// RenderToolCallDetail generates a detailed view for a single tool call
+// RenderToolCallDetail generates a detailed view for a single tool call.
+// toolID may be the sequential ToolID or the OpenAI tool call ID.
 func RenderToolCallDetail(handler *debuger.DebugHandler, toolID string) (string, error) {
 	dp := data.NewDataProvider(handler.GetStore())
 
-	tc, err := dp.GetToolCallByToolID(toolID)
+	tc, err := dp.GetToolCall(toolID)
 	if err != nil {
 		return "", fmt.Errorf("failed to get tool call: %w", err)
 	}
 	if tc == nil {
-		return "", fmt.Errorf("tool call not found: %s", toolID)
+		return "", fmt.Errorf("%w: %s", ErrToolCallNotFound, toolID)
 	}
 
 	content := ui.ContainerStart()
@@ -121,12 +148,19 @@ func RenderToolCallDetail(handler *debuger.DebugHandler, toolID string) (string,
 	content += fmt.Sprintf(`<tr><th class="w-25">Tool ID</th><td>%s</td></tr>`, components.InlineCode(tc.ToolID))
 	content += fmt.Sprintf(`<tr><th>Tool Call ID</th><td>%s</td></tr>`, components.InlineCode(tc.ToolCallID))
 	content += fmt.Sprintf(`<tr><th>Function</th><td>%s</td></tr>`, components.InlineCode(tc.FunctionName))
+	if tc.MCPServer != "" {
+		content += fmt.Sprintf(`<tr><th>MCP Server</th><td>%s</td></tr>`, components.InlineCode(tc.MCPServer))
+	}
 	content += fmt.Sprintf(`<tr><th>Agent Type</th><td>%s</td></tr>`, agentBadge)
 	content += fmt.Sprintf(`<tr><th>Duration</th><td>%s</td></tr>`, debuger.FormatDurationMs(tc.DurationMs))
-	content += fmt.Sprintf(`<tr><th>Status</th><td>%s</td></tr>`, tc.Status)
+	content += fmt.Sprintf(`<tr><th>Status</th><td>%s</td></tr>`, components.StatusBadge(tc.Status))
 	if tc.Error != "" {
 		content += fmt.Sprintf(`<tr><th class="text-danger">Error</th><td class="text-danger">%s</td></tr>`, template.HTMLEscapeString(tc.Error))
 	}
+	if tc.ArgsValidation != "" {
+		content += fmt.Sprintf(`<tr><th>Arguments</th><td>%s <span class="text-muted">%s</span></td></tr>`,
+			components.StatusBadge(tc.ArgsValidation), template.HTMLEscapeString(tc.ArgsValidationDetail))
+	}
 	content += fmt.Sprintf(`<tr><th>Created At</th><td>%s</td></tr>`, debuger.FormatTime(tc.CreatedAt))
 	content += fmt.Sprintf(`<tr><th>Updated At</th><td>%s</td></tr>`, debuger.FormatTime(tc.UpdatedAt))
 	content += `</table>`
@@ -137,19 +171,44 @@ func RenderToolCallDetail(handler *debuger.DebugHandler, toolID string) (string,
 	content += `<table class="table table-sm">`
 	content += fmt.Sprintf(`<tr><th class="w-25">User</th><td>%s</td></tr>`,
 		components.TruncatedLink(tc.UserID, "/agentize/debug/users/"+template.URLQueryEscaper(tc.UserID), 30))
-	content += fmt.Sprintf(`<tr><th>Session</th><td>%s</td></tr>`,
+	content += fmt.Sprintf(`<tr><th>Session</th><td>%s %s</td></tr>`,
+		components.InlineCode(tc.SessionID),
 		components.OpenButton("/agentize/debug/sessions/"+template.URLQueryEscaper(tc.SessionID)))
-	content += fmt.Sprintf(`<tr><th>Message ID</th><td>%s</td></tr>`, components.InlineCode(tc.MessageID))
+	content += fmt.Sprintf(`<tr><th>Message ID</th><td>%s %s</td></tr>`,
+		components.InlineCode(tc.MessageID),
+		components.OpenButton("/agentize/debug/messages?session="+template.URLQueryEscaper(tc.SessionID)))
+	content += fmt.Sprintf(`<tr><th>Other Calls</th><td>%s</td></tr>`,
+		components.OpenButton("/agentize/debug/tool-calls?session="+template.URLQueryEscaper(tc.SessionID)))
 	content += `</table>`
 	content += `</div>`
 
 	content += `</div>`
 	content += ui.CardEnd()
 
+	// Sources Card (web search citations)
+	if len(tc.Sources) > 0 {
+		content += ui.CardStartWithCount("Sources", "link-45deg", len(tc.Sources))
+		content += `<ol class="mb-0">`
+		for _, source := range tc.Sources {
+			title := source.Title
+			if title == "" {
+				title = source.URL
+			}
+			content += fmt.Sprintf(`<li><a href="%s" target="_blank" rel="noopener noreferrer">%s</a>`,
+				template.HTMLEscapeString(source.URL), template.HTMLEscapeString(title))
+			if source.Snippet != "" {
+				content += fmt.Sprintf(`<div class="text-muted small">%s</div>`, template.HTMLEscapeString(source.Snippet))
+			}
+			content += `</li>`
+		}
+		content += `</ol>`
+		content += ui.CardEnd()
+	}
+
 	// Arguments Card
 	content += ui.CardStart("Arguments", "code-slash")
 	content += `<pre class="bg-light p-3 rounded" style="white-space: pre-wrap; word-wrap: break-word; max-height: 400px; overflow-y: auto;">`
-	content += template.HTMLEscapeString(tc.Arguments)
+	content += template.HTMLEscapeString(prettyJSON(tc.Arguments))
 	content += `</pre>`
 	content += ui.CardEnd()
 
@@ -163,11 +222,31 @@ func RenderToolCallDetail(handler *debuger.DebugHandler, toolID string) (string,
 		content += components.InfoAlert("No response recorded yet.")
 	} else {
 		content += `<pre class="bg-light p-3 rounded" style="white-space: pre-wrap; word-wrap: break-word; max-height: 400px; overflow-y: auto;">`
-		content += template.HTMLEscapeString(tc.Response)
+		content += template.HTMLEscapeString(prettyJSON(tc.Response))
 		content += `</pre>`
 	}
 	content += ui.CardEnd()
 
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Tool Call: "+tc.FunctionName) + ui.NavbarAndBody("/agentize/debug/tool-calls", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Tool Call: "+tc.FunctionName) + ui.NavbarAndBody("/agentize/debug/tool-calls", content) + ui.Footer(handler.GetRefreshInterval()), nil
+}
+
+// prettyJSON indents s if it is valid JSON, otherwise returns it unchanged
+func prettyJSON(s string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(s), "", "  "); err != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// limitBaseURL builds a pager base URL from the page's filter params, keeping a non-default page size
+func limitBaseURL(path string, query url.Values, limit int) string {
+	if limit != components.DefaultItemsPerPage {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
 }
@@ -0,0 +1,117 @@
+package pages
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+
+	"github.com/ghiac/agentize/debuger"
+	"github.com/ghiac/agentize/debuger/ui"
+	"github.com/ghiac/agentize/debuger/ui/components"
+	"github.com/ghiac/agentize/model"
+)
+
+// RenderUsage generates the LLM usage page: calls, tokens and cost per model for userID
+// ("" for every user) within tr (a zero tr means all time)
+func RenderUsage(handler *debuger.DebugHandler, userID string, tr debuger.TimeRange) (string, error) {
+	query := url.Values{}
+	if userID != "" {
+		query.Set("user", userID)
+	}
+
+	content := ui.ContainerStart()
+	if userID != "" {
+		content += components.Breadcrumb([]components.BreadcrumbItem{
+			{Label: "Users", URL: "/agentize/debug/users"},
+			{Label: userID, URL: "/agentize/debug/users/" + template.URLQueryEscaper(userID)},
+			{Label: "Usage", Active: true},
+		})
+	}
+
+	content += components.TimeRangeFilter("/agentize/debug/usage", tr, query)
+
+	usageStore, ok := handler.GetStore().(model.UsageStore)
+	if !ok {
+		content += components.InfoAlert("This store does not record LLM usage.")
+		content += ui.ContainerEnd()
+		return ui.Header("Agentize Debug - Usage") + ui.NavbarAndBody("/agentize/debug/usage", content) + ui.Footer(handler.GetRefreshInterval()), nil
+	}
+
+	summary, err := usageStore.GetUsageSummary(userID, tr.From, tr.To)
+	if err != nil {
+		return "", fmt.Errorf("failed to get usage summary: %w", err)
+	}
+
+	// Totals row
+	content += `<div class="row g-4 mb-4">`
+	for _, stat := range []struct{ value, label, icon, color string }{
+		{fmt.Sprintf("%d", summary.Calls), "LLM Calls", "🤖", "primary"},
+		{fmt.Sprintf("%d", summary.PromptTokens), "Prompt Tokens", "📥", "info"},
+		{fmt.Sprintf("%d", summary.CompletionTokens), "Completion Tokens", "📤", "secondary"},
+		{formatUSD(summary.CostUSD), "Cost", "💰", "success"},
+	} {
+		content += `<div class="col-md-6 col-lg-3">`
+		content += components.StatCard(stat.value, stat.label, stat.icon, stat.color)
+		content += `</div>`
+	}
+	content += `</div>`
+
+	content += ui.CardStartWithCount("Usage by Model", "cpu", len(summary.ByModel))
+	if len(summary.ByModel) == 0 {
+		content += components.InfoAlert("No LLM usage recorded in this range.")
+	} else {
+		columns := []components.ColumnConfig{
+			{Header: "Model"},
+			{Header: "Calls", Center: true, NoWrap: true},
+			{Header: "Prompt Tokens", Center: true, NoWrap: true},
+			{Header: "Completion Tokens", Center: true, NoWrap: true},
+			{Header: "Cost (USD)", Center: true, NoWrap: true},
+		}
+		content += components.TableStartWithConfig(columns, components.TableConfig{
+			Hover:       true,
+			Small:       true,
+			Responsive:  true,
+			AlignMiddle: true,
+		})
+
+		models := make([]string, 0, len(summary.ByModel))
+		for name := range summary.ByModel {
+			models = append(models, name)
+		}
+		// Most expensive first, then by name
+		sort.Slice(models, func(i, j int) bool {
+			a, b := summary.ByModel[models[i]], summary.ByModel[models[j]]
+			if a.CostUSD != b.CostUSD {
+				return a.CostUSD > b.CostUSD
+			}
+			return models[i] < models[j]
+		})
+
+		for _, name := range models {
+			usage := summary.ByModel[name]
+			display := "-"
+			if name != "" {
+				display = components.InlineCode(template.HTMLEscapeString(name))
+			}
+			content += fmt.Sprintf(`<tr>
+                <td>%s</td>
+                <td class="text-center">%d</td>
+                <td class="text-center">%d</td>
+                <td class="text-center">%d</td>
+                <td class="text-center text-nowrap">%s</td>
+            </tr>`,
+				display, usage.Calls, usage.PromptTokens, usage.CompletionTokens, formatUSD(usage.CostUSD))
+		}
+		content += components.TableEnd(true)
+	}
+	content += ui.CardEnd()
+
+	content += ui.ContainerEnd()
+	return ui.Header("Agentize Debug - Usage") + ui.NavbarAndBody("/agentize/debug/usage", content) + ui.Footer(handler.GetRefreshInterval()), nil
+}
+
+// formatUSD formats a cost in US dollars with enough precision for per-call prices
+func formatUSD(cost float64) string {
+	return fmt.Sprintf("$%.4f", cost)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/ghiac/agentize/debuger/data"
 	"github.com/ghiac/agentize/debuger/ui"
 	"github.com/ghiac/agentize/debuger/ui/components"
+	"github.com/ghiac/agentize/model"
 )
 
 // RenderUsers generates the users list HTML page
@@ -99,7 +100,7 @@ func RenderUsers(handler *debuger.DebugHandler, page int) (string, error) {
 
 	content += ui.CardEnd()
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - Users") + ui.NavbarAndBody("/agentize/debug/users", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - Users") + ui.NavbarAndBody("/agentize/debug/users", content) + ui.Footer(handler.GetRefreshInterval()), nil
 }
 
 // RenderUserDetail generates the user detail HTML page.
@@ -126,11 +127,16 @@ func RenderUserDetail(handler *debuger.DebugHandler, userID string, showDeletedS
 		return "", fmt.Errorf("failed to get messages: %w", err)
 	}
 
-	userFiles, err := dp.GetOpenedFilesByUser(userID)
+	userFiles, err := dp.GetOpenedFilesBySessions(userSessions)
 	if err != nil {
 		return "", fmt.Errorf("failed to get files: %w", err)
 	}
 
+	stats, err := handler.GetStore().GetUserStats(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user stats: %w", err)
+	}
+
 	content := ui.ContainerStart()
 
 	// Breadcrumb
@@ -185,14 +191,6 @@ func RenderUserDetail(handler *debuger.DebugHandler, userID string, showDeletedS
 		}
 	}
 
-	// Calculate total MessageSeq and ToolSeq from all user sessions
-	totalMessageSeq := 0
-	totalToolSeq := 0
-	for _, session := range userSessions {
-		totalMessageSeq += session.MessageSeq
-		totalToolSeq += session.ToolSeq
-	}
-
 	// Build ban details display
 	isBannedDisplay := "No"
 	if user.IsBanned {
@@ -208,17 +206,31 @@ func RenderUserDetail(handler *debuger.DebugHandler, userID string, showDeletedS
 	if user.BanMessage != "" {
 		banMessageDisplay = template.HTMLEscapeString(user.BanMessage)
 	}
+	languageDisplay := "-"
+	if user.Language != "" {
+		languageDisplay = template.HTMLEscapeString(user.Language)
+	}
 
 	// Delete user data button (form with confirmation)
 	deleteFormAction := "/agentize/debug/users/" + url.PathEscape(userID) + "/delete-data"
 
+	// Unban button, only while the user is banned
+	unbanFormHTML := ""
+	if user.IsCurrentlyBanned() {
+		unbanFormHTML = fmt.Sprintf(`<form method="POST" action="%s" onsubmit="return confirm('Lift the ban for this user?');" class="d-inline me-2">
+            <button type="submit" class="btn btn-sm btn-outline-success"><i class="bi bi-unlock me-1"></i>Unban user</button>
+        </form>`, "/agentize/debug/users/"+url.PathEscape(userID)+"/unban")
+	}
+
 	content += fmt.Sprintf(`
 <div class="card mb-4">
     <div class="card-header d-flex justify-content-between align-items-center">
         <h4 class="mb-0"><i class="bi bi-person-fill me-2"></i>User Information</h4>
-        <form method="POST" action="%s" onsubmit="return confirm('Are you sure? All messages, sessions, quota, consumption and invoices for this user will be deleted.');" class="d-inline">
+        <div>
+        %s<form method="POST" action="%s" onsubmit="return confirm('Are you sure? All messages, sessions, quota, consumption and invoices for this user will be deleted.');" class="d-inline">
             <button type="submit" class="btn btn-sm btn-outline-danger"><i class="bi bi-trash me-1"></i>Delete all user data (messages, sessions, quota, consumption, invoices)</button>
         </form>
+        </div>
     </div>
     <div class="card-body p-0">
         <div class="row g-0">
@@ -237,6 +249,10 @@ func RenderUserDetail(handler *debuger.DebugHandler, userID string, showDeletedS
                             <td class="text-end fw-bold" style="padding: 0.5rem 1rem;">Username:</td>
                             <td style="padding: 0.5rem 1rem;">%s</td>
                         </tr>
+                        <tr>
+                            <td class="text-end fw-bold" style="padding: 0.5rem 1rem;">Language:</td>
+                            <td style="padding: 0.5rem 1rem;">%s</td>
+                        </tr>
                         <tr>
                             <td class="text-end fw-bold" style="padding: 0.5rem 1rem;">Status:</td>
                             <td style="padding: 0.5rem 1rem;">%s</td>
@@ -268,12 +284,8 @@ func RenderUserDetail(handler *debuger.DebugHandler, userID string, showDeletedS
                             <td style="padding: 0.5rem 1rem;" class="text-muted">%s</td>
                         </tr>
                         <tr>
-                            <td class="text-end fw-bold" style="padding: 0.5rem 1rem;">Total Message Seq:</td>
-                            <td style="padding: 0.5rem 1rem;">%s</td>
-                        </tr>
-                        <tr>
-                            <td class="text-end fw-bold" style="padding: 0.5rem 1rem;">Total Tool Seq:</td>
-                            <td style="padding: 0.5rem 1rem;">%s</td>
+                            <td class="text-end fw-bold" style="padding: 0.5rem 1rem;">Last Active:</td>
+                            <td style="padding: 0.5rem 1rem;" class="text-muted">%s</td>
                         </tr>
                         <tr>
                             <td class="text-end fw-bold" style="padding: 0.5rem 1rem;">Nonsense Count:</td>
@@ -293,28 +305,50 @@ func RenderUserDetail(handler *debuger.DebugHandler, userID string, showDeletedS
         </div>
     </div>
 </div>`,
+		unbanFormHTML,
 		deleteFormAction,
 		components.CodeBlock(template.HTMLEscapeString(user.UserID)),
 		nameDisplay,
 		usernameDisplay,
+		languageDisplay,
 		banStatus,
 		isBannedDisplay,
 		banUntilDisplay,
 		banMessageDisplay,
 		debuger.FormatTime(user.CreatedAt),
 		debuger.FormatTime(user.UpdatedAt),
-		components.CountBadge(totalMessageSeq, "info"),
-		components.CountBadge(totalToolSeq, "info"),
+		debuger.FormatTime(stats.LastActiveAt),
 		components.CountBadge(user.NonsenseCount, "warning text-dark"),
 		debuger.FormatTime(user.LastNonsenseTime),
 		activeSessionsHTML,
 	)
 
+	// Aggregate statistics
+	content += `<div class="row g-4 mb-4">`
+	for _, card := range []struct {
+		value, label, icon, color string
+	}{
+		{fmt.Sprintf("%d", stats.Sessions), "Sessions", "🗂️", "primary"},
+		{fmt.Sprintf("%d", stats.TotalMessages), "Messages", "💬", "info"},
+		{fmt.Sprintf("%d", stats.ToolCalls), "Tool Calls", "🔧", "secondary"},
+		{fmt.Sprintf("%d", stats.TotalTokens), "Tokens", "🪙", "success"},
+	} {
+		content += `<div class="col-md-6 col-lg-3">`
+		content += components.StatCard(card.value, card.label, card.icon, card.color)
+		content += `</div>`
+	}
+	content += `</div>`
+
 	// Optional billing/credit summary (when provider is set by the application)
 	if billingHTML, err := handler.GetUserBillingHTML(userID); err == nil && billingHTML != "" {
 		content += billingHTML
 	}
 
+	// Moderation history card (bans, unbans and nonsense strikes), when the store records them
+	if eventStore, ok := handler.GetStore().(model.ModerationEventStore); ok {
+		content += renderModerationHistory(eventStore, userID)
+	}
+
 	// Sessions card
 	content += ui.CardStartWithCount("Sessions", "diagram-3-fill", len(userSessions))
 
@@ -452,5 +486,90 @@ func RenderUserDetail(handler *debuger.DebugHandler, userID string, showDeletedS
 
 	content += ui.CardEnd()
 	content += ui.ContainerEnd()
-	return ui.Header("Agentize Debug - User: "+userID) + ui.NavbarAndBody("/agentize/debug/users", content) + ui.Footer(), nil
+	return ui.Header("Agentize Debug - User: "+userID) + ui.NavbarAndBody("/agentize/debug/users", content) + ui.Footer(handler.GetRefreshInterval()), nil
+}
+
+// renderModerationHistory renders the moderation events of a user, newest first
+func renderModerationHistory(eventStore model.ModerationEventStore, userID string) string {
+	events, err := eventStore.GetModerationEventsByUser(userID)
+	if err != nil {
+		return components.DangerAlert("Failed to load moderation history: " + template.HTMLEscapeString(err.Error()))
+	}
+
+	content := ui.CardStartWithCount("Moderation History", "shield-exclamation", len(events))
+	if len(events) == 0 {
+		content += components.InfoAlert("No moderation events recorded for this user.")
+		return content + ui.CardEnd()
+	}
+
+	columns := []components.ColumnConfig{
+		{Header: "Time", NoWrap: true},
+		{Header: "Event", Center: true, NoWrap: true},
+		{Header: "Actor", NoWrap: true},
+		{Header: "Reason"},
+		{Header: "Duration", NoWrap: true},
+		{Header: "Strikes", Center: true, NoWrap: true},
+		{Header: "Message", NoWrap: true},
+	}
+	content += components.TableStartWithConfig(columns, components.TableConfig{
+		Hover:       true,
+		Small:       true,
+		Responsive:  true,
+		AlignMiddle: true,
+	})
+
+	for _, event := range events {
+		var badge string
+		switch event.Type {
+		case model.ModerationEventBan:
+			badge = components.BadgeWithIcon("Ban", "🚫", "danger")
+		case model.ModerationEventUnban:
+			badge = components.BadgeWithIcon("Unban", "✅", "success")
+		case model.ModerationEventNonsenseStrike:
+			badge = components.BadgeWithIcon("Strike", "⚠️", "warning text-dark")
+		default:
+			badge = components.Badge(template.HTMLEscapeString(string(event.Type)), "secondary")
+		}
+
+		reason := "-"
+		if event.Reason != "" {
+			reason = template.HTMLEscapeString(event.Reason)
+		}
+		duration := "-"
+		if event.Type == model.ModerationEventBan {
+			duration = "Permanent"
+			if event.Duration > 0 {
+				duration = event.Duration.String()
+			}
+		}
+		strikes := "-"
+		if event.NonsenseCount > 0 {
+			strikes = components.CountBadge(event.NonsenseCount, "warning text-dark")
+		}
+		messageID := "-"
+		if event.MessageID != "" {
+			messageID = components.InlineCode(template.HTMLEscapeString(event.MessageID))
+		}
+
+		content += fmt.Sprintf(`<tr>
+                <td class="text-nowrap">%s</td>
+                <td class="text-center">%s</td>
+                <td class="text-nowrap">%s</td>
+                <td>%s</td>
+                <td class="text-nowrap">%s</td>
+                <td class="text-center">%s</td>
+                <td class="text-nowrap">%s</td>
+            </tr>`,
+			debuger.FormatTime(event.CreatedAt),
+			badge,
+			template.HTMLEscapeString(event.Actor),
+			reason,
+			duration,
+			strikes,
+			messageID,
+		)
+	}
+
+	content += components.TableEnd(true)
+	return content + ui.CardEnd()
 }
@@ -22,10 +22,33 @@ type DebugStore interface {
 	GetToolCallsBySession(sessionID string) ([]*model.ToolCall, error)
 	GetToolCallByID(toolCallID string) (*model.ToolCall, error)
 	GetToolCallByToolID(toolID string) (*model.ToolCall, error)
+	// GetToolCall returns a tool call by ToolID, falling back to the OpenAI tool call ID.
+	// Returns (nil, nil) if no tool call matches.
+	GetToolCall(toolID string) (*model.ToolCall, error)
+
+	// Time-range queries: a zero from or to leaves that side of the range open.
+	// Sessions are matched on last activity (updated_at) and grouped by user ID, messages and
+	// tool calls on created_at, newest first.
+	GetSessionsByTimeRange(from, to time.Time) (map[string][]*model.Session, error)
+	GetMessagesByTimeRange(from, to time.Time) ([]*model.Message, error)
+	GetToolCallsByTimeRange(from, to time.Time) ([]*model.ToolCall, error)
+
 	PutSummarizationLog(log *model.SummarizationLog) error
 	GetSummarizationLogsBySession(sessionID string) ([]*model.SummarizationLog, error)
 	GetAllSummarizationLogs() ([]*model.SummarizationLog, error)
 
+	// Paginated queries return one page (newest first) plus the total number of records
+	GetToolCallsPaginated(offset, limit int) ([]*model.ToolCall, int, error)
+	GetSummarizationLogsPaginated(offset, limit int) ([]*model.SummarizationLog, int, error)
+	// CountSummarizationLogsByStatus returns the number of logs per status ("success", "failed", "pending")
+	CountSummarizationLogsByStatus() (map[string]int, error)
+
+	// GetSessionStats returns aggregate message, token, tool call and summarization counts for a session
+	GetSessionStats(sessionID string) (*model.SessionStats, error)
+	// GetUserStats returns aggregate session, message, tool call, token and file counts, the ban
+	// status and the last activity of a user
+	GetUserStats(userID string) (*model.UserStats, error)
+
 	// DeleteUserData deletes all sessions, messages, tool calls, summarization logs,
 	// and opened files for a user. Resets user's ActiveSessionIDs and SessionSeqs.
 	DeleteUserData(userID string) error
@@ -79,6 +102,41 @@ type PageData struct {
 	CurrentPage string
 }
 
+// TimeRange restricts debug pages to [From, To]; a zero bound leaves that side open.
+// FromParam/ToParam keep the raw query values (e.g. "1h") so links can carry them forward.
+type TimeRange struct {
+	From      time.Time
+	To        time.Time
+	FromParam string
+	ToParam   string
+}
+
+// IsZero reports whether the range is "all time"
+func (r TimeRange) IsZero() bool {
+	return r.From.IsZero() && r.To.IsZero()
+}
+
+// Contains reports whether t falls within the range
+func (r TimeRange) Contains(t time.Time) bool {
+	if !r.From.IsZero() && t.Before(r.From) {
+		return false
+	}
+	if !r.To.IsZero() && t.After(r.To) {
+		return false
+	}
+	return true
+}
+
+// KnowledgeIndexStats holds the state of the knowledge search index for the knowledge page
+type KnowledgeIndexStats struct {
+	TreeNodes int // nodes in the knowledge tree
+	Nodes     int // nodes with indexed content
+	Chunks    int
+	Embedded  int // excerpts the last build had to embed
+	LastBuilt time.Time
+	LastError string
+}
+
 // DashboardStats holds statistics for the dashboard
 type DashboardStats struct {
 	TotalUsers     int
@@ -45,6 +45,9 @@ func StatusBadge(status string) string {
 	case "pending":
 		variant = "warning text-dark"
 		icon = "⏳ "
+	case "cache_hit":
+		variant = "info"
+		icon = "♻️ "
 	case "active":
 		variant = "success"
 		icon = "✅ "
@@ -3,6 +3,7 @@ package components
 import (
 	"fmt"
 	"html/template"
+	"strings"
 	"time"
 
 	"github.com/ghiac/agentize/model"
@@ -70,6 +71,11 @@ func MessageCard(msg *model.Message, config MessageDisplayConfig) string {
 		badges += " " + BadgeWithIcon("Nonsense", "⚠️", "warning text-dark")
 	}
 
+	// Duplicate badge
+	if msg.IsDuplicate {
+		badges += " " + BadgeWithIcon("Duplicate", "🔁", "secondary")
+	}
+
 	// Model badge
 	modelDisplay := ""
 	if config.ShowModel && msg.Model != "" {
@@ -188,6 +194,8 @@ type MessageRowConfig struct {
 	ShowUser    bool   // Show user column with link
 	ShowSession bool   // Show session column with link
 	BaseURL     string // Base URL for links
+	// Feedback returns the rating stats of a message; when set, a feedback column is shown
+	Feedback func(messageID string) *model.FeedbackStats
 }
 
 // DefaultMessageRowConfig returns default configuration for message row
@@ -218,6 +226,9 @@ func MessageTableColumns(config MessageRowConfig) []ColumnConfig {
 		ColumnConfig{Header: "Tools", Center: true, NoWrap: true},
 		ColumnConfig{Header: "Nonsense", Center: true, NoWrap: true},
 	)
+	if config.Feedback != nil {
+		columns = append(columns, ColumnConfig{Header: "Feedback", Center: true, NoWrap: true})
+	}
 	return columns
 }
 
@@ -246,6 +257,8 @@ func MessageTableRow(msg *model.Message, config MessageRowConfig, rowIndex int)
 	nonsenseBadge := Badge("-", "secondary")
 	if msg.IsNonsense {
 		nonsenseBadge = BadgeWithIcon("Nonsense", "⚠️", "warning text-dark")
+	} else if msg.IsDuplicate {
+		nonsenseBadge = BadgeWithIcon("Duplicate", "🔁", "secondary")
 	}
 
 	// Format time as "ago"
@@ -290,11 +303,16 @@ func MessageTableRow(msg *model.Message, config MessageRowConfig, rowIndex int)
 
 	html += fmt.Sprintf(`
 		<td class="text-center">%s</td>
-		<td class="text-center">%s</td>
-	</tr>`,
+		<td class="text-center">%s</td>`,
 		toolCallDisplay,
 		nonsenseBadge,
 	)
+	if config.Feedback != nil {
+		html += fmt.Sprintf(`
+		<td class="text-center">%s</td>`, feedbackDisplay(config.Feedback(msg.MessageID)))
+	}
+	html += `
+	</tr>`
 
 	// Build the expanded details row (hidden by default)
 	// Base columns: expand button, seq, time, agent, type, role, content, model, tools, nonsense = 10
@@ -302,6 +320,9 @@ func MessageTableRow(msg *model.Message, config MessageRowConfig, rowIndex int)
 	if config.ShowUser {
 		colSpan++
 	}
+	if config.Feedback != nil {
+		colSpan++
+	}
 
 	html += fmt.Sprintf(`<tr id="%s-details" style="display: none;" class="table-light">
 		<td colspan="%d">
@@ -325,6 +346,7 @@ func MessageTableRow(msg *model.Message, config MessageRowConfig, rowIndex int)
 							<tr><th class="text-muted">Request Model</th><td>%s</td></tr>
 							<tr><th class="text-muted">Prompt Tokens</th><td>%d</td></tr>
 							<tr><th class="text-muted">Completion Tokens</th><td>%d</td></tr>
+							<tr><th class="text-muted">Reasoning Tokens</th><td>%d</td></tr>
 							<tr><th class="text-muted">Total Tokens</th><td>%d</td></tr>
 							<tr><th class="text-muted">Max Tokens</th><td>%d</td></tr>
 							<tr><th class="text-muted">Temperature</th><td>%.2f</td></tr>
@@ -354,6 +376,7 @@ func MessageTableRow(msg *model.Message, config MessageRowConfig, rowIndex int)
 		InlineCode(msg.RequestModel),
 		msg.PromptTokens,
 		msg.CompletionTokens,
+		msg.ReasoningTokens,
 		msg.TotalTokens,
 		msg.MaxTokens,
 		msg.Temperature,
@@ -425,3 +448,18 @@ func getFinishReasonDisplay(reason string) string {
 		return Badge(reason, "secondary")
 	}
 }
+
+// feedbackDisplay renders the thumbs up/down counts of a message, or "-" when it has no rating
+func feedbackDisplay(stats *model.FeedbackStats) string {
+	if stats == nil || stats.Total == 0 {
+		return Badge("-", "secondary")
+	}
+	var badges []string
+	if stats.Up > 0 {
+		badges = append(badges, BadgeWithIcon(fmt.Sprintf("%d", stats.Up), "👍", "success"))
+	}
+	if stats.Down > 0 {
+		badges = append(badges, BadgeWithIcon(fmt.Sprintf("%d", stats.Down), "👎", "danger"))
+	}
+	return strings.Join(badges, " ")
+}
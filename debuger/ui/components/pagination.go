@@ -17,6 +17,9 @@ type PaginationConfig struct {
 // DefaultItemsPerPage is the default number of items per page
 const DefaultItemsPerPage = 50
 
+// MaxItemsPerPage caps the page size a list page accepts through its limit query param
+const MaxItemsPerPage = 500
+
 // GetPaginationInfo calculates pagination information
 func GetPaginationInfo(currentPage, totalItems, itemsPerPage int) (startIdx, endIdx, totalPages int) {
 	if itemsPerPage <= 0 {
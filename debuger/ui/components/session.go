@@ -73,7 +73,9 @@ func SessionTableRow(session *model.Session, config SessionRowConfig, rowIndex i
 
 	// Status badges
 	var statusBadges string
-	if session.InProgress {
+	if session.Archived {
+		statusBadges = Badge("📦 Archived", "dark")
+	} else if session.InProgress {
 		statusBadges = Badge("⏳ Active", "warning text-dark")
 	} else if !session.SummarizedAt.IsZero() {
 		statusBadges = Badge("📋 Summarized", "success")
@@ -83,7 +85,9 @@ func SessionTableRow(session *model.Session, config SessionRowConfig, rowIndex i
 
 	// Row styling
 	rowClass := ""
-	if session.AgentType == model.AgentTypeCore {
+	if session.Archived {
+		rowClass = "table-secondary text-muted"
+	} else if session.AgentType == model.AgentTypeCore {
 		rowClass = "table-danger"
 	}
 
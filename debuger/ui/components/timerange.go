@@ -0,0 +1,79 @@
+package components
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"sort"
+
+	"github.com/ghiac/agentize/debuger"
+)
+
+// timeRangePresets are the quick links offered by TimeRangeFilter ("" means all time)
+var timeRangePresets = []struct {
+	Label string
+	From  string
+}{
+	{"15m", "15m"},
+	{"1h", "1h"},
+	{"24h", "24h"},
+	{"7d", "7d"},
+	{"All time", ""},
+}
+
+// TimeRangeFilter renders a from/to form with quick range links for a list page.
+// keep holds the page's other query parameters (filters) so they survive a range change.
+func TimeRangeFilter(action string, r debuger.TimeRange, keep url.Values) string {
+	presets := ""
+	for _, p := range timeRangePresets {
+		q := url.Values{}
+		for k, v := range keep {
+			q[k] = v
+		}
+		q.Del("from")
+		q.Del("to")
+		q.Del("page")
+		if p.From != "" {
+			q.Set("from", p.From)
+		}
+		href := action
+		if len(q) > 0 {
+			href += "?" + q.Encode()
+		}
+		variant := "btn-outline-secondary"
+		if p.From == r.FromParam && r.ToParam == "" {
+			variant = "btn-secondary"
+		}
+		presets += fmt.Sprintf(`<a href="%s" class="btn btn-sm %s">%s</a>`, template.HTMLEscapeString(href), variant, p.Label)
+	}
+
+	keys := make([]string, 0, len(keep))
+	for k := range keep {
+		if k != "from" && k != "to" && k != "page" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	hidden := ""
+	for _, k := range keys {
+		hidden += fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, template.HTMLEscapeString(k), template.HTMLEscapeString(keep.Get(k)))
+	}
+
+	return fmt.Sprintf(`<form method="GET" action="%s" class="row g-2 align-items-end mb-3">
+    %s
+    <div class="col-md-3">
+        <label class="form-label small mb-1" for="range-from">From</label>
+        <input type="text" class="form-control form-control-sm" id="range-from" name="from" value="%s" placeholder="1h, 7d or RFC3339">
+    </div>
+    <div class="col-md-3">
+        <label class="form-label small mb-1" for="range-to">To</label>
+        <input type="text" class="form-control form-control-sm" id="range-to" name="to" value="%s" placeholder="now">
+    </div>
+    <div class="col-md-1">
+        <button type="submit" class="btn btn-sm btn-primary"><i class="bi bi-clock-history"></i> Apply</button>
+    </div>
+    <div class="col-md-5 d-flex gap-1 justify-content-md-end">%s</div>
+</form>`,
+		template.HTMLEscapeString(action), hidden,
+		template.HTMLEscapeString(r.FromParam), template.HTMLEscapeString(r.ToParam), presets)
+}
@@ -76,6 +76,8 @@ func ToolCallTableRow(tc *debuger.ToolCallInfo, config ToolCallRowConfig, rowInd
 		statusBadge = BadgeWithIcon("Success", "✅", "success")
 	case "pending":
 		statusBadge = Badge("Pending", "warning text-dark")
+	case "cache_hit":
+		statusBadge = BadgeWithIcon("Cached", "♻️", "info")
 	default:
 		if tc.Result == "" {
 			statusBadge = Badge("Pending", "warning text-dark")
@@ -3,11 +3,12 @@ package ui
 import (
 	"fmt"
 	"html/template"
+	"time"
 )
 
 // RenderPage renders a complete HTML page with the given content
-func RenderPage(title, navbar, content string) string {
-	return Header(title) + navbar + content + Footer()
+func RenderPage(title, navbar, content string, refreshInterval time.Duration) string {
+	return Header(title) + navbar + content + Footer(refreshInterval)
 }
 
 // NavbarAndBody returns the top navbar plus body layout: when extra nav items
@@ -38,13 +39,15 @@ func Header(title string) string {
 <body>`, template.HTMLEscapeString(title), GetStyles())
 }
 
-// Footer generates the HTML footer with scripts
-func Footer() string {
+// Footer generates the HTML footer with scripts.
+// refreshInterval is the page auto-refresh interval (<= 0 disables it).
+func Footer(refreshInterval time.Duration) string {
 	return fmt.Sprintf(`
+    %s
     <script src="%s" integrity="%s" crossorigin="anonymous"></script>
     <script>%s</script>
 </body>
-</html>`, GetBootstrapJS(), GetBootstrapJSIntegrity(), GetScripts())
+</html>`, AutoRefreshToggle(refreshInterval), GetBootstrapJS(), GetBootstrapJSIntegrity(), GetScripts(refreshInterval))
 }
 
 // ContainerStart returns the opening tags for the main container
@@ -41,6 +41,8 @@ func DefaultNavItems() []NavItem {
 		{"/agentize/debug/files", "📁", "Files"},
 		{"/agentize/debug/tool-calls", "🔧", "Tool Calls"},
 		{"/agentize/debug/summarized", "📝", "Summarized"},
+		{"/agentize/debug/usage", "💰", "Usage"},
+		{"/agentize/debug/knowledge", "📚", "Knowledge"},
 	}
 }
 
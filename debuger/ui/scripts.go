@@ -1,13 +1,14 @@
 package ui
 
-// GetScripts returns the JavaScript for the debug interface
-func GetScripts() string {
-	return `
-        // Auto-refresh every 30 seconds
-        setTimeout(function() {
-            location.reload();
-        }, 30000);
-        
+import (
+	"fmt"
+	"time"
+)
+
+// GetScripts returns the JavaScript for the debug interface.
+// refreshInterval <= 0 disables the auto-refresh.
+func GetScripts(refreshInterval time.Duration) string {
+	return getAutoRefreshScript(refreshInterval) + `
         // Expandable content functionality
         document.addEventListener('DOMContentLoaded', function() {
             document.querySelectorAll('.expandable-content').forEach(function(element) {
@@ -29,3 +30,58 @@ func GetBootstrapJS() string {
 func GetBootstrapJSIntegrity() string {
 	return `sha384-BBtl+eGJRgqQAUMxJ7pMwbEyER4l1g+O15P+16Ep7Q9Q+zqX6gSbd85u4mG4QzX+`
 }
+
+// getAutoRefreshScript reloads the page every refreshInterval unless paused with the
+// auto-refresh toggle; the pause survives reloads and applies to every debug page (localStorage).
+func getAutoRefreshScript(refreshInterval time.Duration) string {
+	if refreshInterval <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(`
+        // Auto-refresh (pausable)
+        (function() {
+            var refreshMs = %d;
+            var pauseKey = 'agentize.debug.autoRefreshPaused';
+            var timer = null;
+            function isPaused() {
+                try { return localStorage.getItem(pauseKey) === '1'; } catch (e) { return false; }
+            }
+            function setPaused(paused) {
+                try {
+                    if (paused) { localStorage.setItem(pauseKey, '1'); } else { localStorage.removeItem(pauseKey); }
+                } catch (e) {}
+            }
+            function schedule() {
+                clearTimeout(timer);
+                if (!isPaused()) {
+                    timer = setTimeout(function() { location.reload(); }, refreshMs);
+                }
+            }
+            function render(button) {
+                button.innerHTML = isPaused()
+                    ? '<i class="bi bi-play-fill"></i> Resume auto-refresh'
+                    : '<i class="bi bi-pause-fill"></i> Pause auto-refresh (%s)';
+            }
+            document.addEventListener('DOMContentLoaded', function() {
+                var button = document.getElementById('auto-refresh-toggle');
+                if (button) {
+                    render(button);
+                    button.addEventListener('click', function() {
+                        setPaused(!isPaused());
+                        render(button);
+                        schedule();
+                    });
+                }
+            });
+            schedule();
+        })();
+`, refreshInterval.Milliseconds(), refreshInterval)
+}
+
+// AutoRefreshToggle returns the floating "Pause auto-refresh" button (empty when auto-refresh is off)
+func AutoRefreshToggle(refreshInterval time.Duration) string {
+	if refreshInterval <= 0 {
+		return ""
+	}
+	return `<button type="button" id="auto-refresh-toggle" class="btn btn-sm btn-light shadow-sm auto-refresh-toggle"></button>`
+}
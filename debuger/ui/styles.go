@@ -192,6 +192,16 @@ func GetStyles() string {
             margin-top: 0;
             margin-bottom: 0;
         }
+        .auto-refresh-toggle {
+            position: fixed;
+            right: 1rem;
+            bottom: 1rem;
+            z-index: 1030;
+            opacity: 0.85;
+        }
+        .auto-refresh-toggle:hover {
+            opacity: 1;
+        }
     `
 }
 
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,6 +36,57 @@ func FormatDuration(t time.Time) string {
 	return fmt.Sprintf("%d days ago", int(duration.Hours()/24))
 }
 
+// ParseTimeRange parses the from/to query parameters of debug pages.
+// Each value is either RFC3339 (2025-01-02T15:04:05Z) or a relative duration before now
+// such as "30m", "1h" or "7d". Empty values leave that side of the range open.
+func ParseTimeRange(from, to string, now time.Time) (TimeRange, error) {
+	r := TimeRange{FromParam: strings.TrimSpace(from), ToParam: strings.TrimSpace(to)}
+	var err error
+	if r.From, err = parseTimeParam(r.FromParam, now); err != nil {
+		return TimeRange{}, fmt.Errorf("invalid from: %w", err)
+	}
+	if r.To, err = parseTimeParam(r.ToParam, now); err != nil {
+		return TimeRange{}, fmt.Errorf("invalid to: %w", err)
+	}
+	if !r.From.IsZero() && !r.To.IsZero() && r.From.After(r.To) {
+		return TimeRange{}, fmt.Errorf("from (%s) is after to (%s)", r.FromParam, r.ToParam)
+	}
+	return r, nil
+}
+
+// parseTimeParam parses a single RFC3339 or relative ("1h", "7d") time value
+func parseTimeParam(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("%q is neither RFC3339 nor a relative duration like 1h or 7d", value)
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("%q is neither RFC3339 nor a relative duration like 1h or 7d", value)
+	}
+	return now.Add(-d), nil
+}
+
+// SetTimeRangeParams adds the range's from/to parameters to q (no-op for empty params)
+func SetTimeRangeParams(q url.Values, r TimeRange) url.Values {
+	if r.FromParam != "" {
+		q.Set("from", r.FromParam)
+	}
+	if r.ToParam != "" {
+		q.Set("to", r.ToParam)
+	}
+	return q
+}
+
 // FormatDurationValue formats a duration value for display
 func FormatDurationValue(d time.Duration) string {
 	if d < time.Minute {
@@ -44,16 +97,33 @@ func FormatDurationValue(d time.Duration) string {
 	return fmt.Sprintf("%.1f hours", d.Hours())
 }
 
-// FormatMessage formats a ChatCompletionMessage for display
+// DefaultMessageDisplayLength is the content length FormatMessage shows before truncating
+const DefaultMessageDisplayLength = 1000
+
+// FormatMessage formats a ChatCompletionMessage for display, truncating its content to
+// DefaultMessageDisplayLength characters
 func FormatMessage(msg openai.ChatCompletionMessage) string {
+	return FormatMessageWithLimit(msg, DefaultMessageDisplayLength)
+}
+
+// FormatMessageWithLimit formats a ChatCompletionMessage for display, truncating its content
+// to maxLength characters (<= 0: no limit)
+func FormatMessageWithLimit(msg openai.ChatCompletionMessage, maxLength int) string {
 	var parts []string
 
 	parts = append(parts, fmt.Sprintf("<strong>Role:</strong> %s", msg.Role))
 
 	if msg.Content != "" {
-		content := template.HTMLEscapeString(msg.Content)
-		if len(content) > 1000 {
-			content = content[:1000] + "... (truncated)"
+		content := msg.Content
+		truncated := false
+		if runes := []rune(content); maxLength > 0 && len(runes) > maxLength {
+			content = string(runes[:maxLength])
+			truncated = true
+		}
+		// Escape after cutting so an HTML entity is never split
+		content = template.HTMLEscapeString(content)
+		if truncated {
+			content += "... (truncated)"
 		}
 		parts = append(parts, fmt.Sprintf("<strong>Content:</strong> %s", content))
 	}
@@ -0,0 +1,32 @@
+package engine
+
+import "errors"
+
+// ErrAccessDenied is returned when node auth does not grant the user the needed permission
+var ErrAccessDenied = errors.New("access denied")
+
+// GroupResolver returns the auth groups a user belongs to (matched against auth.groups in node.yaml)
+type GroupResolver func(userID string) []string
+
+// SetGroupResolver sets how the engine finds a user's groups, e.g. from the application's
+// own user directory. Without a resolver only auth.users entries and defaults apply.
+func (e *Engine) SetGroupResolver(resolver GroupResolver) {
+	e.groupResolver = resolver
+}
+
+// UserGroups returns the groups of userID, or nil if no resolver is set
+func (e *Engine) UserGroups(userID string) []string {
+	if e.groupResolver == nil {
+		return nil
+	}
+	return e.groupResolver(userID)
+}
+
+// canUser reports whether userID has flag (model.PermRead, ...) on the node at nodePath
+func (e *Engine) canUser(nodePath string, userID string, flag rune) bool {
+	if !e.Repo.CanUser(nodePath, userID, e.UserGroups(userID), flag) {
+		e.logger().Debug("[Engine] 🔒 Access denied", "user_id", userID, "path", nodePath, "permission", string(flag))
+		return false
+	}
+	return true
+}
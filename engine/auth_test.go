@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/store"
+)
+
+func TestEngineGroupAuth(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		full := filepath.Join(dir, rel)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", rel, err)
+		}
+	}
+	write("root/node.yaml", `id: "root"
+auth:
+  policy: "deny"
+  groups:
+    staff:
+      perms: "rxd"
+`)
+	write("root/node.md", "# Root")
+	write("root/billing/node.yaml", `id: "billing"
+auth:
+  inherit: true
+  users:
+    - user_id: "alice"
+      can_read: false
+`)
+	write("root/billing/node.md", "# Billing")
+
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	e.SetGroupResolver(func(userID string) []string {
+		if userID == "alice" || userID == "bob" {
+			return []string{"staff"}
+		}
+		return nil
+	})
+
+	open := func(userID string) error {
+		session, err := e.CreateSession(userID)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		_, err = e.OpenFile(session.SessionID, "root/billing")
+		return err
+	}
+
+	// Group entry on the root is inherited by billing
+	if err := open("bob"); err != nil {
+		t.Errorf("Expected staff member to open billing, got %v", err)
+	}
+	// User entry takes precedence over the group entry
+	if err := open("alice"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected user entry to deny alice, got %v", err)
+	}
+	// Nobody else matches anything, so the root policy denies
+	if err := open("carol"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected deny policy for carol, got %v", err)
+	}
+
+	bob, _ := e.CreateSession("bob")
+	if index := e.buildFileIndex(bob); !strings.Contains(index, "root/billing") {
+		t.Errorf("Expected billing in bob's file index, got %q", index)
+	}
+	carol, _ := e.CreateSession("carol")
+	if index := e.buildFileIndex(carol); index != "" {
+		t.Errorf("Expected empty file index for carol, got %q", index)
+	}
+}
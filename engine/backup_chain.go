@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
+	"github.com/ghiac/agentize/config"
 	llminterface "github.com/ghiac/agentize/llm-interface"
 	"github.com/ghiac/agentize/log"
 	"github.com/sashabaranov/go-openai"
@@ -18,14 +20,87 @@ type BackupLLM struct {
 	Provider llminterface.Provider
 	Model    string // model name to pass to the provider (e.g. "@cf/openai/gpt-oss-120b")
 	Name     string // human-readable name for logging (e.g. "cf-oss-120b")
+
+	// Vision marks the provider/model as able to read images (llminterface.Message.Images).
+	// Requests that include images skip backups without it.
+	Vision bool
+
+	// Circuit breaker settings. After FailureThreshold consecutive failures the provider
+	// is skipped for BreakerOpenDuration, then a single probe request is allowed (half-open).
+	FailureThreshold    int           // default: 3
+	BreakerOpenDuration time.Duration // default: 30s
+}
+
+// BackupProvidersFromConfig returns the backup chain configured in a config file
+// (config.LLMConfig.Backups): each entry gets the built-in adapter of its provider API
+// (llminterface.NewProvider), e.g. Anthropic or Gemini
+func BackupProvidersFromConfig(backups []config.BackupLLMConfig) ([]BackupLLM, error) {
+	providers := make([]BackupLLM, 0, len(backups))
+	for i, backup := range backups {
+		provider, err := llminterface.NewProvider(backup.Provider, llminterface.ProviderConfig{
+			APIKey:    backup.APIKey,
+			BaseURL:   backup.BaseURL,
+			MaxTokens: backup.MaxTokens,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("backup %d: %w", i, err)
+		}
+		providers = append(providers, BackupLLM{Provider: provider, Model: backup.Model, Name: backup.Name, Vision: backup.Vision})
+	}
+	return providers, nil
 }
 
-// backupChain manages a chain of backup LLM providers with per-provider cooldowns.
+const (
+	defaultBackupFailureThreshold    = 3
+	defaultBackupBreakerOpenDuration = 30 * time.Second
+)
+
+// BreakerState is the circuit breaker state of a backup provider
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // provider is healthy and tried normally
+	BreakerOpen     BreakerState = "open"      // provider is skipped until the open period ends
+	BreakerHalfOpen BreakerState = "half_open" // one probe request is allowed to test recovery
+)
+
+// ProviderStatus is a snapshot of a backup provider's health, for observability
+type ProviderStatus struct {
+	Name                string
+	Model               string
+	State               BreakerState
+	ConsecutiveFailures int
+	TotalSuccesses      int
+	TotalFailures       int
+	LastError           string
+	LastFailureAt       time.Time
+	OpenUntil           time.Time // zero unless the breaker is open
+}
+
+// providerHealth tracks failures and breaker state for one provider (guarded by backupChain.mu).
+// It belongs to the provider's position in the chain, so providers sharing a Name (or having none)
+// still have their own breaker.
+type providerHealth struct {
+	consecutiveFailures int
+	totalSuccesses      int
+	totalFailures       int
+	lastError           string
+	lastFailureAt       time.Time
+	cooldownUntil       time.Time // short per-failure cooldown (backupCooldownDuration)
+	openUntil           time.Time // breaker open period
+	tripped             bool      // breaker has tripped and not yet recovered
+	probing             bool      // a half-open probe is in flight
+}
+
+// backupChain manages a chain of backup LLM providers with per-provider cooldowns
+// and circuit breakers.
 // It is the single implementation used by both Engine and CoreHandler to avoid duplication.
 type backupChain struct {
-	providers  []BackupLLM
-	cooldowns  map[string]time.Time
-	cooldownMu sync.Mutex
+	providers []BackupLLM
+	health    []*providerHealth // per provider, in chain order
+	mu        sync.Mutex
+	now       func() time.Time
+	closed    bool // set by close; no provider is tried afterwards
 }
 
 // newBackupChain creates a backupChain from the given providers.
@@ -34,10 +109,178 @@ func newBackupChain(providers []BackupLLM) *backupChain {
 	if len(providers) == 0 {
 		return nil
 	}
-	return &backupChain{
+	bc := &backupChain{
 		providers: providers,
-		cooldowns: make(map[string]time.Time),
+		health:    make([]*providerHealth, len(providers)),
+		now:       time.Now,
+	}
+	for i := range providers {
+		bc.health[i] = &providerHealth{}
+	}
+	return bc
+}
+
+// backupName returns the provider's name, or a positional fallback name
+func backupName(backup BackupLLM, index int) string {
+	if backup.Name != "" {
+		return backup.Name
+	}
+	return fmt.Sprintf("backup-%d", index)
+}
+
+// breakerSettings returns the provider's breaker threshold and open duration with defaults applied
+func breakerSettings(backup BackupLLM) (int, time.Duration) {
+	threshold := backup.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultBackupFailureThreshold
+	}
+	openDuration := backup.BreakerOpenDuration
+	if openDuration <= 0 {
+		openDuration = defaultBackupBreakerOpenDuration
+	}
+	return threshold, openDuration
+}
+
+// stateLocked returns the breaker state of h at now (caller must hold bc.mu)
+func (h *providerHealth) stateLocked(now time.Time) BreakerState {
+	if !h.tripped {
+		return BreakerClosed
+	}
+	if now.Before(h.openUntil) {
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+// acquire decides whether the provider at index may be tried now. It returns a reason when skipped.
+// In half-open state only one caller gets the probe; others skip until it completes.
+func (bc *backupChain) acquire(index int) (ok bool, reason string) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.closed {
+		return false, "chain closed"
+	}
+
+	h := bc.health[index]
+	now := bc.now()
+	switch h.stateLocked(now) {
+	case BreakerOpen:
+		return false, fmt.Sprintf("circuit open until %s", h.openUntil.Format(time.RFC3339))
+	case BreakerHalfOpen:
+		if h.probing {
+			return false, "half-open probe in flight"
+		}
+		h.probing = true
+		return true, ""
+	}
+	if now.Before(h.cooldownUntil) {
+		return false, fmt.Sprintf("cooldown until %s", h.cooldownUntil.Format(time.RFC3339))
+	}
+	return true, ""
+}
+
+// recordSuccess closes the breaker of the provider at index and resets its failure counter
+func (bc *backupChain) recordSuccess(index int) (recovered bool) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	h := bc.health[index]
+	recovered = h.tripped
+	h.consecutiveFailures = 0
+	h.totalSuccesses++
+	h.tripped = false
+	h.probing = false
+	h.openUntil = time.Time{}
+	h.cooldownUntil = time.Time{}
+	return recovered
+}
+
+// release gives up a slot taken by acquire without an outcome (e.g. the request was cancelled),
+// so a half-open provider can be probed again
+func (bc *backupChain) release(index int) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.health[index].probing = false
+}
+
+// recordFailure counts a failure and opens the breaker when the threshold is reached
+// (or immediately when a half-open probe fails).
+func (bc *backupChain) recordFailure(index int, reason string) (opened bool, openDuration time.Duration) {
+	threshold, openDuration := breakerSettings(bc.providers[index])
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	h := bc.health[index]
+	now := bc.now()
+	h.consecutiveFailures++
+	h.totalFailures++
+	h.lastError = reason
+	h.lastFailureAt = now
+	h.cooldownUntil = now.Add(backupCooldownDuration)
+
+	if h.probing || h.consecutiveFailures >= threshold {
+		h.tripped = true
+		h.probing = false
+		h.openUntil = now.Add(openDuration)
+		return true, openDuration
+	}
+	return false, 0
+}
+
+// status returns a snapshot of every provider's health, in chain order
+func (bc *backupChain) status() []ProviderStatus {
+	if bc == nil {
+		return nil
+	}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	now := bc.now()
+	statuses := make([]ProviderStatus, 0, len(bc.providers))
+	for i, backup := range bc.providers {
+		h := bc.health[i]
+		st := ProviderStatus{
+			Name:                backupName(backup, i),
+			Model:               backup.Model,
+			State:               h.stateLocked(now),
+			ConsecutiveFailures: h.consecutiveFailures,
+			TotalSuccesses:      h.totalSuccesses,
+			TotalFailures:       h.totalFailures,
+			LastError:           h.lastError,
+			LastFailureAt:       h.lastFailureAt,
+		}
+		if st.State == BreakerOpen {
+			st.OpenUntil = h.openUntil
+		}
+		statuses = append(statuses, st)
 	}
+	return statuses
+}
+
+// close stops the chain from trying providers and closes the providers that hold resources (io.Closer)
+func (bc *backupChain) close() error {
+	if bc == nil {
+		return nil
+	}
+	bc.mu.Lock()
+	if bc.closed {
+		bc.mu.Unlock()
+		return nil
+	}
+	bc.closed = true
+	bc.mu.Unlock()
+
+	var errs []error
+	for i, backup := range bc.providers {
+		if closer, ok := backup.Provider.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close backup %s: %w", backupName(backup, i), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // tryBackup iterates through backup providers in order and returns the first successful response.
@@ -55,7 +298,11 @@ func (bc *backupChain) tryBackup(ctx context.Context, messages []openai.ChatComp
 	// Compute prompt stats once for logging
 	promptChars := 0
 	systemPromptLen := 0
+	hasImages := false
 	for _, m := range ifcMsgs {
+		if len(m.Images) > 0 {
+			hasImages = true
+		}
 		promptChars += len(m.Content) + len(m.ToolCallID)
 		if m.Role == "system" {
 			systemPromptLen += len(m.Content)
@@ -66,58 +313,72 @@ func (bc *backupChain) tryBackup(ctx context.Context, messages []openai.ChatComp
 	}
 
 	for i, backup := range bc.providers {
-		name := backup.Name
-		if name == "" {
-			name = fmt.Sprintf("backup-%d", i)
+		if ctx.Err() != nil {
+			return openai.ChatCompletionResponse{}, false
 		}
+		name := backupName(backup, i)
 
-		// Check per-provider cooldown
-		bc.cooldownMu.Lock()
-		cooldownUntil, hasCooldown := bc.cooldowns[name]
-		inCooldown := hasCooldown && time.Now().Before(cooldownUntil)
-		bc.cooldownMu.Unlock()
+		if hasImages && !backup.Vision {
+			log.Log.Info("["+logPrefix+"] ⏸️ BACKUP LLM >> Skipping provider, request has images and it is not vision-capable", "provider", name)
+			continue
+		}
 
-		if inCooldown {
-			log.Log.Infof("[%s] ⏸️ BACKUP LLM >> Skipping %s (cooldown until %s)",
-				logPrefix, name, cooldownUntil.Format(time.RFC3339))
+		// Check per-provider cooldown and circuit breaker
+		if ok, reason := bc.acquire(i); !ok {
+			log.Log.Info("["+logPrefix+"] ⏸️ BACKUP LLM >> Skipping provider", "provider", name, "reason", reason)
 			continue
 		}
 
-		log.Log.Infof("[%s] 🔄 BACKUP LLM >> Trying %s | Model: %s | Messages: %d | Tools: %d | Prompt ~%d chars | system_prompt_len=%d",
-			logPrefix, name, backup.Model, len(ifcMsgs), len(ifcTools), promptChars, systemPromptLen)
+		log.Log.Info("["+logPrefix+"] 🔄 BACKUP LLM >> Trying provider",
+			"provider", name, "model", backup.Model, "messages", len(ifcMsgs), "tools", len(ifcTools), "prompt_chars", promptChars, "system_prompt_len", systemPromptLen)
 
 		resp, err := backup.Provider.ChatCompletion(ctx, backup.Model, ifcMsgs, ifcTools)
-		if err == nil && (resp.Content != "" || len(resp.ToolCalls) > 0) {
+		if err == nil && resp != nil && (resp.Content != "" || len(resp.ToolCalls) > 0) {
+			if bc.recordSuccess(i) {
+				log.Log.Info("["+logPrefix+"] 🔌 BACKUP LLM >> Provider recovered, circuit closed", "provider", name)
+			}
 			// Success - set the model name in response so caller knows which model was used
 			resp.Model = backup.Model
-			log.Log.Infof("[%s] ✅ BACKUP LLM >> Success | %s | Model: %s | Response: %d chars | ToolCalls: %d | Tokens: prompt=%d completion=%d total=%d",
-				logPrefix, name, backup.Model, len(resp.Content), len(resp.ToolCalls),
-				resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
+			log.Log.Info("["+logPrefix+"] ✅ BACKUP LLM >> Success",
+				"provider", name, "model", backup.Model, "response_chars", len(resp.Content), "tool_calls", len(resp.ToolCalls),
+				"prompt_tokens", resp.Usage.PromptTokens, "completion_tokens", resp.Usage.CompletionTokens, "total_tokens", resp.Usage.TotalTokens)
 			return llminterface.ToOpenAIResponse(resp), true
 		}
 
-		// Failed or empty: set per-provider cooldown and continue to next
-		bc.cooldownMu.Lock()
-		bc.cooldowns[name] = time.Now().Add(backupCooldownDuration)
-		bc.cooldownMu.Unlock()
+		// A cancelled request is not the provider's fault: no cooldown, and no point trying the rest
+		if ctx.Err() != nil {
+			log.Log.Info("["+logPrefix+"] ⏹️ BACKUP LLM >> Provider aborted, context done", "provider", name, "error", ctx.Err())
+			bc.release(i)
+			return openai.ChatCompletionResponse{}, false
+		}
 
+		var reason string
 		if err != nil {
-			log.Log.Warnf("[%s] ❌ BACKUP LLM >> %s failed | Model: %s | Error: %v | Messages: %d | Tools: %d",
-				logPrefix, name, backup.Model, err, len(ifcMsgs), len(ifcTools))
+			reason = err.Error()
+			log.Log.Warn("["+logPrefix+"] ❌ BACKUP LLM >> Provider failed",
+				"provider", name, "model", backup.Model, "error", err, "messages", len(ifcMsgs), "tools", len(ifcTools))
 			if cause := errors.Unwrap(err); cause != nil {
-				log.Log.Warnf("[%s] ❌ BACKUP LLM >> Cause: %v", logPrefix, cause)
+				log.Log.Warn("["+logPrefix+"] ❌ BACKUP LLM >> Cause", "error", cause)
 			}
+		} else if resp == nil {
+			reason = "provider returned nil response"
+			log.Log.Warn("["+logPrefix+"] ❌ BACKUP LLM >> Provider returned nil response", "provider", name, "model", backup.Model)
 		} else {
-			reason := "API returned success but content and tool_calls are both empty"
+			reason = "API returned success but content and tool_calls are both empty"
 			if resp.Usage.CompletionTokens == 0 {
 				reason = "model produced 0 completion tokens (content filter, max_tokens, or empty API response)"
 			}
-			log.Log.Warnf("[%s] ❌ BACKUP LLM >> %s empty response | Model: %s | Tokens: prompt=%d completion=%d total=%d | Reason: %s",
-				logPrefix, name, backup.Model,
-				resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens, reason)
+			log.Log.Warn("["+logPrefix+"] ❌ BACKUP LLM >> Provider returned an empty response",
+				"provider", name, "model", backup.Model, "prompt_tokens", resp.Usage.PromptTokens,
+				"completion_tokens", resp.Usage.CompletionTokens, "total_tokens", resp.Usage.TotalTokens, "reason", reason)
 		}
 
-		log.Log.Warnf("[%s] ⏸️ BACKUP LLM >> %s disabled for %s", logPrefix, name, backupCooldownDuration)
+		// Failed or empty: set per-provider cooldown (and possibly open the breaker), then continue to next
+		if opened, openDuration := bc.recordFailure(i, reason); opened {
+			log.Log.Warn("["+logPrefix+"] 🔌 BACKUP LLM >> Provider circuit open", "provider", name, "duration", openDuration)
+		} else {
+			log.Log.Warn("["+logPrefix+"] ⏸️ BACKUP LLM >> Provider disabled", "provider", name, "duration", backupCooldownDuration)
+		}
 	}
 
 	// All providers failed or were in cooldown
@@ -0,0 +1,294 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/config"
+	"github.com/ghiac/agentize/fsrepo"
+	llminterface "github.com/ghiac/agentize/llm-interface"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+// TestBackupChain_CircuitBreakerTripsAndRecovers verifies that a provider is skipped after
+// FailureThreshold consecutive failures, probed once after the open period, and closed again on success.
+func TestBackupChain_CircuitBreakerTripsAndRecovers(t *testing.T) {
+	failing := true
+	calls := 0
+	provider := llminterface.ProviderFunc(func(ctx context.Context, model string, msgs []llminterface.Message, tools []llminterface.Tool) (*llminterface.Response, error) {
+		calls++
+		if failing {
+			return nil, errors.New("provider down")
+		}
+		return &llminterface.Response{Content: "ok"}, nil
+	})
+
+	bc := newBackupChain([]BackupLLM{{
+		Provider:            provider,
+		Model:               "test-model",
+		Name:                "flaky",
+		FailureThreshold:    2,
+		BreakerOpenDuration: time.Minute,
+	}})
+	now := time.Now()
+	bc.now = func() time.Time { return now }
+
+	msgs := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}
+	try := func() bool {
+		_, ok := bc.tryBackup(context.Background(), msgs, nil, "Test")
+		return ok
+	}
+
+	// Two failures (past the short per-failure cooldown each time) trip the breaker
+	for i := 0; i < 2; i++ {
+		if try() {
+			t.Fatalf("attempt %d: expected failure", i+1)
+		}
+		now = now.Add(2 * backupCooldownDuration)
+	}
+	if got := bc.status()[0]; got.State != BreakerOpen || got.ConsecutiveFailures != 2 {
+		t.Fatalf("expected open breaker after 2 failures, got %+v", got)
+	}
+
+	// While open, the provider is not called
+	if try() || calls != 2 {
+		t.Fatalf("expected provider to be skipped while open, calls=%d", calls)
+	}
+
+	// After the open period the breaker half-opens; a failed probe re-opens it
+	now = now.Add(time.Minute)
+	if got := bc.status()[0].State; got != BreakerHalfOpen {
+		t.Fatalf("expected half-open, got %s", got)
+	}
+	if try() || calls != 3 {
+		t.Fatalf("expected one failed probe, calls=%d", calls)
+	}
+	if got := bc.status()[0].State; got != BreakerOpen {
+		t.Fatalf("expected breaker to re-open after failed probe, got %s", got)
+	}
+
+	// Provider recovers: the next probe succeeds and closes the breaker
+	failing = false
+	now = now.Add(time.Minute)
+	if !try() {
+		t.Fatal("expected successful probe")
+	}
+	got := bc.status()[0]
+	if got.State != BreakerClosed || got.ConsecutiveFailures != 0 || got.TotalSuccesses != 1 || got.TotalFailures != 3 {
+		t.Fatalf("unexpected status after recovery: %+v", got)
+	}
+}
+
+// TestBackupChain_SameNameProvidersHaveOwnBreakers verifies that providers sharing a Name (or
+// having none) do not share circuit breaker state.
+func TestBackupChain_SameNameProvidersHaveOwnBreakers(t *testing.T) {
+	down := llminterface.ProviderFunc(func(ctx context.Context, model string, msgs []llminterface.Message, tools []llminterface.Tool) (*llminterface.Response, error) {
+		return nil, errors.New("provider down")
+	})
+	upCalls := 0
+	up := llminterface.ProviderFunc(func(ctx context.Context, model string, msgs []llminterface.Message, tools []llminterface.Tool) (*llminterface.Response, error) {
+		upCalls++
+		return &llminterface.Response{Content: "ok"}, nil
+	})
+
+	for _, name := range []string{"shared", ""} {
+		bc := newBackupChain([]BackupLLM{
+			{Provider: down, Model: "a", Name: name, FailureThreshold: 1, BreakerOpenDuration: time.Minute},
+			{Provider: up, Model: "b", Name: name, FailureThreshold: 1, BreakerOpenDuration: time.Minute},
+		})
+		msgs := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}
+		if _, ok := bc.tryBackup(context.Background(), msgs, nil, "Test"); !ok {
+			t.Fatalf("name %q: expected the second provider to answer", name)
+		}
+		statuses := bc.status()
+		if statuses[0].State != BreakerOpen || statuses[1].State != BreakerClosed || statuses[1].TotalSuccesses != 1 {
+			t.Fatalf("name %q: expected separate breakers, got %+v", name, statuses)
+		}
+	}
+	if upCalls != 2 {
+		t.Errorf("Expected the healthy provider to be called once per chain, got %d", upCalls)
+	}
+}
+
+// TestBackupChain_StatusNil verifies that status is safe on a nil chain (no backups configured).
+func TestBackupChain_StatusNil(t *testing.T) {
+	var bc *backupChain
+	if got := bc.status(); got != nil {
+		t.Fatalf("expected nil status, got %v", got)
+	}
+}
+
+// TestBackupChain_VisionRequestsSkipNonVisionProviders verifies that requests with images
+// only go to backups flagged as vision-capable, with the images passed through.
+func TestBackupChain_VisionRequestsSkipNonVisionProviders(t *testing.T) {
+	var textCalls int
+	var images []string
+	bc := newBackupChain([]BackupLLM{
+		{
+			Name: "text-only",
+			Provider: llminterface.ProviderFunc(func(ctx context.Context, model string, msgs []llminterface.Message, tools []llminterface.Tool) (*llminterface.Response, error) {
+				textCalls++
+				return &llminterface.Response{Content: "text"}, nil
+			}),
+		},
+		{
+			Name:   "vision",
+			Vision: true,
+			Provider: llminterface.ProviderFunc(func(ctx context.Context, model string, msgs []llminterface.Message, tools []llminterface.Tool) (*llminterface.Response, error) {
+				images = msgs[len(msgs)-1].Images
+				return &llminterface.Response{Content: "vision"}, nil
+			}),
+		},
+	})
+
+	msgs := []openai.ChatCompletionMessage{{
+		Role: openai.ChatMessageRoleUser,
+		MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "what is this?"},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,AAAA"}},
+		},
+	}}
+	resp, ok := bc.tryBackup(context.Background(), msgs, nil, "Test")
+	if !ok || resp.Choices[0].Message.Content != "vision" {
+		t.Fatalf("Expected the vision backup to answer, got ok=%v resp=%+v", ok, resp)
+	}
+	if textCalls != 0 {
+		t.Errorf("Expected the text-only backup to be skipped, called %d times", textCalls)
+	}
+	if len(images) != 1 || images[0] != "data:image/png;base64,AAAA" {
+		t.Errorf("Expected the image to reach the vision backup, got %v", images)
+	}
+
+	// Text requests still use the first backup
+	if resp, ok := bc.tryBackup(context.Background(), []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}, nil, "Test"); !ok || resp.Choices[0].Message.Content != "text" {
+		t.Errorf("Expected the text-only backup to answer a text request, got ok=%v", ok)
+	}
+}
+
+// usageRecorder is a Callback that records the LLM usage events it receives
+type usageRecorder struct {
+	mu     sync.Mutex
+	before []UsageEvent
+	after  []UsageEvent
+}
+
+func (r *usageRecorder) BeforeAction(_ context.Context, event *UsageEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if event.EventType == EventLLMCall {
+		r.before = append(r.before, *event)
+	}
+	return nil
+}
+
+func (r *usageRecorder) AfterAction(_ context.Context, event *UsageEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if event.EventType == EventLLMCall {
+		r.after = append(r.after, *event)
+	}
+}
+
+// TestProcessMessageWithImage_UsesBackupChainAndCallbacks verifies that image messages fail over
+// to a vision-capable backup and report usage with the vision model name.
+func TestProcessMessageWithImage_UsesBackupChainAndCallbacks(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+
+	var images int
+	backup := BackupLLM{
+		Name:   "vision-backup",
+		Model:  "backup-vision-model",
+		Vision: true,
+		Provider: llminterface.ProviderFunc(func(ctx context.Context, model string, msgs []llminterface.Message, tools []llminterface.Tool) (*llminterface.Response, error) {
+			for _, m := range msgs {
+				images += len(m.Images)
+			}
+			return &llminterface.Response{Content: "a white square", Usage: llminterface.Usage{PromptTokens: 90, CompletionTokens: 10, TotalTokens: 100}}, nil
+		}),
+	}
+	// The default client is unreachable, so the answer can only come from the backup
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: "http://127.0.0.1:0", Model: "main", BackupProviders: []BackupLLM{backup}}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	if err := ch.UseVisionLLMConfig(LLMConfig{BaseURL: "http://127.0.0.1:0", Model: "vision-model"}); err != nil {
+		t.Fatalf("UseVisionLLMConfig failed: %v", err)
+	}
+	recorder := &usageRecorder{}
+	ch.Callback = recorder
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	response, err := ch.ProcessMessageWithImage(context.Background(), "user1", "what is this picture?", img.Bytes(), "image/png")
+	if err != nil {
+		t.Fatalf("ProcessMessageWithImage failed: %v", err)
+	}
+	if response != "a white square" || images != 1 {
+		t.Errorf("Expected the backup to answer with the image, got %q (images: %d)", response, images)
+	}
+
+	if len(recorder.before) != 1 || recorder.before[0].Model != "vision-model" {
+		t.Errorf("Expected one BeforeAction for vision-model, got %+v", recorder.before)
+	}
+	if len(recorder.after) != 1 || recorder.after[0].Model != "vision-model" || recorder.after[0].Tokens != 100 {
+		t.Errorf("Expected one AfterAction for vision-model with 100 tokens, got %+v", recorder.after)
+	}
+}
+
+// TestBackupProvidersFromConfig verifies a backup entry with provider: anthropic talks to the
+// Anthropic API and its answer comes back as an OpenAI response, usage included
+func TestBackupProvidersFromConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" || r.Header.Get("x-api-key") != "sk-ant" {
+			t.Errorf("Expected an Anthropic Messages request, got %s %v", r.URL.Path, r.Header)
+		}
+		io.WriteString(w, `{"model":"claude-test","stop_reason":"end_turn","content":[{"type":"text","text":"Hello from Claude"}],
+			"usage":{"input_tokens":12,"output_tokens":4}}`)
+	}))
+	defer server.Close()
+
+	backups, err := BackupProvidersFromConfig([]config.BackupLLMConfig{{Name: "claude", Provider: "anthropic", APIKey: "sk-ant", BaseURL: server.URL, Model: "claude-test"}})
+	if err != nil {
+		t.Fatalf("BackupProvidersFromConfig failed: %v", err)
+	}
+	resp, ok := newBackupChain(backups).tryBackup(context.Background(),
+		[]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "Be brief."}, {Role: openai.ChatMessageRoleUser, Content: "Hello there"}}, nil, "Test")
+	if !ok || resp.Choices[0].Message.Content != "Hello from Claude" || resp.Model != "claude-test" {
+		t.Fatalf("Expected the Anthropic answer, got %+v (%v)", resp, ok)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 4 || resp.Usage.TotalTokens != 16 {
+		t.Errorf("Expected the Anthropic usage, got %+v", resp.Usage)
+	}
+
+	if _, err := BackupProvidersFromConfig([]config.BackupLLMConfig{{Provider: "cohere", Model: "command"}}); err == nil {
+		t.Error("Expected an unknown provider to fail")
+	}
+}
@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultReadFileMaxLength is the content length returned by read_file when
+// CoreHandlerConfig.ReadFileMaxLength is 0
+const defaultReadFileMaxLength = 8000
+
+// knowledgeRepo returns the knowledge tree the UserAgents work on (nil if there is none)
+func (ch *CoreHandler) knowledgeRepo() *fsrepo.NodeRepository {
+	if agent := ch.knowledgeAgent(); agent != nil {
+		return agent.Repo
+	}
+	return nil
+}
+
+// knowledgeAgent returns the UserAgent whose knowledge tree the file tools use, nil if none has one
+func (ch *CoreHandler) knowledgeAgent() *Engine {
+	for _, agent := range []*Engine{ch.userAgentHigh, ch.userAgentLow} {
+		if agent != nil && agent.Repo != nil {
+			return agent
+		}
+	}
+	return nil
+}
+
+// fileOwnerNode returns the path of the nearest node containing filePath (a cleaned path
+// relative to the tree root), "root" when no node does
+func fileOwnerNode(repo *fsrepo.NodeRepository, filePath string) string {
+	for dir := path.Dir(filePath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if _, err := repo.LoadNode(dir); err == nil {
+			return dir
+		}
+	}
+	return "root"
+}
+
+// readFileTool returns a knowledge tree file (truncated to ReadFileMaxLength) and records it
+// as opened in the Core session
+func (ch *CoreHandler) readFileTool(userID, sessionID string, args map[string]interface{}) (string, error) {
+	filePath, err := getStringArg(args, "file_path")
+	if err != nil {
+		return "", err
+	}
+	agent := ch.knowledgeAgent()
+	if agent == nil {
+		return "", fmt.Errorf("no knowledge tree is configured")
+	}
+	data, err := agent.Repo.ReadFile(filePath)
+	filePath = path.Clean(strings.TrimSpace(filePath))
+	// A file is readable by those who can read the node it belongs to (see Engine.OpenFile);
+	// checked before the read error so a denied user cannot probe which files exist
+	if !agent.canUser(fileOwnerNode(agent.Repo, filePath), userID, model.PermRead) {
+		return "", fmt.Errorf("%w: %s", ErrAccessDenied, filePath)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	content := string(data)
+	maxLen := ch.config.ReadFileMaxLength
+	if maxLen <= 0 {
+		maxLen = defaultReadFileMaxLength
+	}
+	if len(content) > maxLen {
+		content = content[:maxLen] + fmt.Sprintf("\n... [truncated, %d of %d characters shown]", maxLen, len(data))
+	}
+
+	ch.recordOpenedFile(userID, sessionID, filePath)
+	ch.logger().Info("[CoreHandler] 📂 File read", "user_id", userID, "session_id", sessionID, "path", filePath, "size", len(data))
+	return content, nil
+}
+
+// recordOpenedFile records filePath as opened in the Core session unless it already is
+func (ch *CoreHandler) recordOpenedFile(userID, sessionID, filePath string) {
+	sessionStore := ch.sessionHandler.GetStore()
+	fileStore, ok := sessionStore.(interface {
+		GetCurrentlyOpenedFilesBySession(string) ([]*model.OpenedFile, error)
+		AddOpenedFile(*model.OpenedFile) error
+	})
+	if !ok || sessionID == "" {
+		return
+	}
+	openedFiles, err := fileStore.GetCurrentlyOpenedFilesBySession(sessionID)
+	if err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to get opened files", "session_id", sessionID, "error", err)
+		return
+	}
+	for _, f := range openedFiles {
+		if f.FilePath == filePath && f.IsOpen {
+			return
+		}
+	}
+
+	session, err := sessionStore.Get(sessionID)
+	if err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to load session for opened file", "session_id", sessionID, "error", err)
+		return
+	}
+	openedFile := model.NewOpenedFile(session, filePath, path.Base(filePath))
+	if err := sessionStore.Put(session); err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to save session", "session_id", sessionID, "error", err)
+	}
+	if err := fileStore.AddOpenedFile(openedFile); err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to record opened file", "user_id", userID, "session_id", sessionID, "path", filePath, "error", err)
+	}
+}
+
+// closeFileTool marks a file opened with read_file as closed in the Core session
+func (ch *CoreHandler) closeFileTool(userID, sessionID string, args map[string]interface{}) (string, error) {
+	filePath, err := getStringArg(args, "file_path")
+	if err != nil {
+		return "", err
+	}
+	filePath = path.Clean(strings.TrimSpace(filePath))
+
+	fileStore, ok := ch.sessionHandler.GetStore().(interface {
+		GetCurrentlyOpenedFilesBySession(string) ([]*model.OpenedFile, error)
+		CloseOpenedFile(string, string) error
+	})
+	if !ok {
+		return "", fmt.Errorf("store does not track opened files")
+	}
+	openedFiles, err := fileStore.GetCurrentlyOpenedFilesBySession(sessionID)
+	if err != nil {
+		return "", err
+	}
+	open := false
+	for _, f := range openedFiles {
+		if f.FilePath == filePath && f.IsOpen {
+			open = true
+			break
+		}
+	}
+	if !open {
+		return "", fmt.Errorf("file not opened: %s", filePath)
+	}
+	if err := fileStore.CloseOpenedFile(sessionID, filePath); err != nil {
+		return "", err
+	}
+	ch.logger().Info("[CoreHandler] 📂 File closed", "user_id", userID, "session_id", sessionID, "path", filePath)
+	return fmt.Sprintf("File closed successfully: %s", filePath), nil
+}
+
+// coreFileToolDefinitions returns the read_file and close_file tools offered to the Core
+func coreFileToolDefinitions() []openai.Tool {
+	filePathParams := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"file_path": map[string]interface{}{
+					"type":        "string",
+					"description": description,
+				},
+			},
+			"required": []string{"file_path"},
+		}
+	}
+	return []openai.Tool{
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "read_file",
+				Description: "Read a file of the knowledge tree (e.g. root/billing/node.md) to answer from or summarize it. Long files are truncated.",
+				Parameters:  filePathParams("Path of the file relative to the knowledge root, e.g. 'root/billing/node.md'"),
+			},
+		},
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "close_file",
+				Description: "Close a file opened with read_file once it is no longer needed.",
+				Parameters:  filePathParams("Path of the file to close, as passed to read_file"),
+			},
+		},
+	}
+}
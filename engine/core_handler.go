@@ -9,12 +9,14 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ghiac/agentize/llmutils"
 	"github.com/ghiac/agentize/log"
 	"github.com/ghiac/agentize/model"
 	"github.com/sashabaranov/go-openai"
+	"golang.org/x/sync/semaphore"
 )
 
 //go:embed core_controller.md
@@ -37,6 +39,134 @@ type CoreHandlerConfig struct {
 
 	// WebSearchDisabled disables web_search and web_search_deepresearch tools
 	WebSearchDisabled bool
+
+	// MaxHistoryMessages limits how many recent conversation messages are sent to the LLM
+	// (system prompts and summary context are always included). 0 means no limit.
+	MaxHistoryMessages int
+
+	// ReadFileMaxLength truncates files returned by the read_file tool (default: 8000 characters)
+	ReadFileMaxLength int
+
+	// Escalation controls when a message sent to UserAgent-Low is retried with UserAgent-High
+	Escalation EscalationPolicy
+
+	// MaxParallelTools limits how many tool calls of one LLM response run at once
+	// (default: 4; 1 runs them one after another). Sequential tools always run alone.
+	MaxParallelTools int
+
+	// ToolCache configures the result cache of tools opted in with SetCacheTTL (e.g. web_search)
+	ToolCache ToolCacheConfig
+
+	// WebSearchMaxCitations limits the sources returned with a web search answer
+	// (default: 5; negative returns the plain answer without sources)
+	WebSearchMaxCitations int
+
+	// Moderation holds the nonsense detection thresholds, the moderation allowlist and the
+	// (localizable) messages shown to banned and warned users
+	Moderation ModerationConfig
+
+	// AllowedImageTypes are the image types ProcessMessageWithImage accepts, detected from the
+	// image bytes (default: image/png, image/jpeg, image/webp, image/gif)
+	AllowedImageTypes []string
+
+	// StatusMessages overrides the user-facing text (StatusUpdate.Message) of the automatic status
+	// phases. Values are text/template strings rendered with StatusMessageData; missing phases use
+	// DefaultStatusMessages. StatusCustom always shows the update_status text.
+	StatusMessages map[StatusPhase]string
+
+	// SuppressedStatuses are phases that are never sent to the request's StatusFunc
+	SuppressedStatuses []StatusPhase
+
+	// LocalizedStatusMessages are the status messages for users with a language
+	// (model.User.Language), keyed by ISO 639-1 code then phase. For those users they take
+	// precedence over StatusMessages, which take precedence over the built-in translations
+	// (fr, es, de, fa).
+	LocalizedStatusMessages map[string]map[StatusPhase]string
+
+	// DetectLanguage replaces the built-in guess (DetectLanguage) of a user's language from their
+	// first messages; return "" when unsure. The language is stored on the user, the Core is told
+	// to respond in it and moderation and status messages are translated to it.
+	DetectLanguage func(message string) string
+	// DisableLanguageDetection leaves the language of users unset unless given with SetUserLanguage
+	DisableLanguageDetection bool
+
+	// CostTable prices the LLM calls of the Core and of UserAgents without their own table:
+	// UsageEvent.CostUSD is set from it and summed in the store's usage aggregate
+	CostTable CostTable
+
+	// QuotaPolicy enables per-user token quotas (nil: none). Usage is read from the session
+	// store's usage aggregate, so it needs a store implementing model.UsageStore. LLM calls of a
+	// user with no tokens left are answered with LLMConfig.QuotaExceededMessage.
+	QuotaPolicy QuotaPolicy
+
+	// DedupeToolCalls runs a tool call only once when the model repeats it (same name and
+	// arguments) within one response; the repeats get the first call's result
+	DedupeToolCalls bool
+
+	// SkipToolArgValidation turns off checking tool call arguments against the tool's input
+	// schema. Arguments are still parsed leniently (code fences, trailing commas and single
+	// quotes are repaired). When on, arguments that do not match are not passed to the tool:
+	// the model gets the problems as the tool result so it can retry.
+	SkipToolArgValidation bool
+
+	// FailFastOnPersistError aborts a turn with an ErrPersistFailed error when saving a message,
+	// tool call or session fails. By default the turn continues and Session.PersistErrors counts
+	// the failure, so the store may miss records the conversation has.
+	FailFastOnPersistError bool
+
+	// MaxActiveMessages and MaxActiveTokens (estimated) bound the active messages of a session.
+	// When a new message exceeds them, the oldest messages are moved to ArchivedMsgs right away
+	// (the scheduler summarizes them later) and a system note tells the model context was trimmed.
+	// Unlike MaxHistoryMessages this changes the session. Applies to the Core and, when an agent
+	// sets none itself, to the UserAgents. 0 means no limit.
+	MaxActiveMessages int
+	MaxActiveTokens   int
+
+	// MaxSessionMessages is a hard cap on the messages a session keeps in Msgs, enforced when the
+	// session is saved: the oldest turns are moved to ArchivedMsgs (see Session.CapMessages), with
+	// no trimmed note. A safety net for memory and store size independent of summarization and of
+	// MaxActiveMessages. Applies to the UserAgents too unless they set their own. 0 means no limit.
+	MaxSessionMessages int
+
+	// MaxStoredContentBytes truncates message contents and tool call arguments and responses
+	// longer than this before they are stored, ending them with a marker giving the original
+	// size; the full content is only logged at debug level. Protects the store from multi-MB
+	// rows, e.g. huge tool results or pasted documents. Applies to the UserAgents too unless
+	// they set their own. 0 means no limit.
+	MaxStoredContentBytes int
+
+	// Logger receives the Core's logs, e.g. an application *slog.Logger or a redacting
+	// log.New logger. Applies to the UserAgents too unless they set their own. nil logs to log.Log.
+	Logger log.FieldLogger
+
+	// MaxConcurrentRequests caps the messages of all users whose LLM calls run at once; the others
+	// wait for a slot (or their context to end). Protects provider rate limits and memory during
+	// traffic spikes, which the per-user lock does not. 0 means no limit.
+	MaxConcurrentRequests int
+
+	// AutoContinueOnLength asks the model to continue when a Core answer stops at the token limit
+	// (finish_reason "length"), up to maxLengthContinuations times, and joins the parts. Otherwise,
+	// or when the limit is hit again, the answer ends with truncatedResponseMarker.
+	AutoContinueOnLength bool
+
+	// DropDuplicateOfCurrent drops a queued message identical to the one being answered (a
+	// double-tapped send). Messages sent while one is processed are queued (see QueueMode);
+	// consecutive identical ones are always collapsed into one. Dropped messages are still
+	// stored, with IsDuplicate set.
+	DropDuplicateOfCurrent bool
+
+	// QueueMode is how messages sent while one is processed are answered (default QueueModeMerge)
+	QueueMode QueueMode
+
+	// QueuedReply is returned right away for a queued message (default defaultQueuedReply).
+	// DisableQueuedReply returns an empty answer instead, for clients that send nothing then.
+	QueuedReply        string
+	DisableQueuedReply bool
+
+	// QueueTimeout drops the queued messages of a user that waited longer than this before their
+	// turn came. Their sender gets a StatusQueueExpired update and the Callback an
+	// EventQueueExpired event. 0 means they wait as long as it takes.
+	QueueTimeout time.Duration
 }
 
 // DefaultCoreHandlerConfig returns default configuration
@@ -47,6 +177,9 @@ func DefaultCoreHandlerConfig() CoreHandlerConfig {
 		CoreModel:              "openai/gpt-5-nano",
 		AutoSummarizeThreshold: 5,
 		WebSearchDisabled:      true, // Web search disabled by default
+		Escalation:             DefaultEscalationPolicy(),
+		MaxParallelTools:       defaultMaxParallelTools,
+		ToolCache:              ToolCacheConfig{Scope: ToolCacheScopeSession},
 	}
 }
 
@@ -60,6 +193,10 @@ type CoreHandler struct {
 	userAgentHigh *Engine
 	userAgentLow  *Engine
 
+	// Named specialist agents reachable through the call_agent tool (see RegisterNamedAgent)
+	namedAgents   map[string]*Engine
+	namedAgentsMu sync.RWMutex
+
 	// LLM client for Core's orchestration decisions
 	llmClient *openai.Client
 	llmConfig LLMConfig
@@ -68,6 +205,10 @@ type CoreHandler struct {
 	visionLLMClient *openai.Client
 	visionLLMConfig *LLMConfig
 
+	// Recording and replay of LLM calls (see UseRecording and UseReplay)
+	llmRecords LLMRecordStore
+	replay     *ReplayClient
+
 	// Core's own sessions per user (for orchestration context)
 	coreSessions   map[string]*model.Session
 	coreSessionsMu sync.RWMutex
@@ -82,6 +223,11 @@ type CoreHandler struct {
 	// when already in progress and queue the message instead of blocking
 	userProgress *ProgressGuard
 
+	// Graceful shutdown (see Shutdown): messages in progress, and whether new ones are refused
+	shutdownMu   sync.Mutex
+	shuttingDown bool
+	inFlight     sync.WaitGroup
+
 	// Configuration
 	config CoreHandlerConfig
 
@@ -94,6 +240,28 @@ type CoreHandler struct {
 	// Backup LLM chain (initialized from LLMConfig.BackupProviders)
 	backups *backupChain
 
+	// Results of cacheable tools (see CoreHandlerConfig.ToolCache)
+	toolCache *toolResultCache
+
+	// Parsed CoreHandlerConfig.StatusMessages and SuppressedStatuses, and the status messages of
+	// each translated language (see LocalizedStatusMessages)
+	statusMessages  *statusMessages
+	localizedStatus map[string]*statusMessages
+
+	// Enforces CoreHandlerConfig.QuotaPolicy (nil when quotas are off)
+	quota *quotaGuard
+
+	// Long-term memory behind the remember, recall and forget_memory tools (nil when disabled, see EnableMemory)
+	memory *coreMemory
+
+	// Index searched by the search_knowledge tool (nil when disabled, see SetKnowledgeIndex)
+	knowledge *KnowledgeIndex
+
+	// Slots of CoreHandlerConfig.MaxConcurrentRequests (nil when unlimited) and the number of
+	// messages holding one or running without a limit
+	requestSlots     *semaphore.Weighted
+	inFlightRequests atomic.Int64
+
 	// Callback for billing/usage metering (optional, set by application)
 	Callback Callback
 }
@@ -114,14 +282,78 @@ func NewCoreHandler(
 		userMutexes:    make(map[string]*sync.Mutex),
 		userProgress:   NewProgressGuard(),
 		coreTools:      model.NewFunctionRegistry(),
+		toolCache:      newToolResultCache(config.ToolCache.MaxEntries),
+		statusMessages: defaultStatusMessages,
+	}
+	if config.StatusMessages != nil || len(config.SuppressedStatuses) > 0 {
+		ch.statusMessages = newStatusMessages(config.StatusMessages, config.SuppressedStatuses)
+	}
+	ch.localizedStatus = newLocalizedStatusMessages(config.StatusMessages, config.LocalizedStatusMessages, config.SuppressedStatuses)
+
+	if config.QuotaPolicy != nil {
+		ch.quota = newQuotaGuard(config.QuotaPolicy, sessionHandler.GetStore())
+	}
+	if config.MaxConcurrentRequests > 0 {
+		ch.requestSlots = semaphore.NewWeighted(int64(config.MaxConcurrentRequests))
+	}
+	for _, agent := range []*Engine{userAgentHigh, userAgentLow} {
+		if agent != nil {
+			ch.configureAgent(agent)
+		}
 	}
 
 	// Register Core's tools
 	ch.registerCoreTools()
 
+	// Let the low agent ask for escalation explicitly
+	if userAgentLow != nil && userAgentLow != userAgentHigh && config.Escalation.has(EscalationTriggerTool) {
+		userAgentLow.addLocalTool(escalateToolDefinition, escalateTool)
+	}
+
 	return ch
 }
 
+// configureAgent applies the Core's config (costs, quotas, tool call handling, history limits)
+// to a UserAgent, keeping the values the agent set itself
+func (ch *CoreHandler) configureAgent(agent *Engine) {
+	config := ch.config
+	if agent.CostTable == nil {
+		agent.CostTable = config.CostTable
+	}
+	if agent.quota == nil {
+		agent.quota = ch.quota
+	}
+	if config.DedupeToolCalls {
+		agent.DedupeToolCalls = true
+	}
+	if config.SkipToolArgValidation {
+		agent.SkipToolArgValidation = true
+	}
+	if config.FailFastOnPersistError {
+		agent.FailFastOnPersistError = true
+	}
+	if agent.MaxActiveMessages == 0 {
+		agent.MaxActiveMessages = config.MaxActiveMessages
+	}
+	if agent.MaxActiveTokens == 0 {
+		agent.MaxActiveTokens = config.MaxActiveTokens
+	}
+	if agent.MaxSessionMessages == 0 {
+		agent.MaxSessionMessages = config.MaxSessionMessages
+	}
+	if agent.MaxStoredContentBytes == 0 {
+		agent.MaxStoredContentBytes = config.MaxStoredContentBytes
+	}
+	if agent.Logger == nil {
+		agent.Logger = config.Logger
+	}
+}
+
+// logger returns the Core's logger (see CoreHandlerConfig.Logger)
+func (ch *CoreHandler) logger() log.FieldLogger {
+	return log.Or(ch.config.Logger)
+}
+
 // getUserMutex returns or creates a mutex for a specific user
 // This ensures only one message is processed at a time per user
 func (ch *CoreHandler) getUserMutex(userID string) *sync.Mutex {
@@ -147,14 +379,58 @@ func (ch *CoreHandler) getUserMutex(userID string) *sync.Mutex {
 	return mu
 }
 
+// recordMessageProcessed reports an answered user message to the Callback (EventMessage)
+func (ch *CoreHandler) recordMessageProcessed(ctx context.Context, userID string, contentType model.ContentType, start time.Time, err error) {
+	if ch.Callback == nil {
+		return
+	}
+	event := &UsageEvent{
+		UserID:    userID,
+		EventType: EventMessage,
+		Name:      string(contentType),
+		Duration:  time.Since(start),
+		Error:     err,
+	}
+	ch.coreSessionsMu.RLock()
+	if session, ok := ch.coreSessions[userID]; ok {
+		event.SessionID = session.SessionID
+	}
+	ch.coreSessionsMu.RUnlock()
+	ch.Callback.AfterAction(ctx, event)
+}
+
+// UseToolMiddleware adds middlewares around every Core tool call, the built-in tools included
+// (see model.FunctionRegistry.Use). UserAgent tools use their function registry's Use.
+func (ch *CoreHandler) UseToolMiddleware(middlewares ...model.ToolMiddleware) {
+	ch.coreTools.Use(middlewares...)
+}
+
 // SetCallback sets the billing/usage callback on the CoreHandler and propagates it to child engines.
 func (ch *CoreHandler) SetCallback(cb Callback) {
 	ch.Callback = cb
+	for _, agent := range ch.allAgents() {
+		agent.Callback = cb
+	}
+}
+
+// SetSemanticRouter makes both UserAgents try router before the LLM when they route
+// (nodes with routing mode llm); nil disables it
+func (ch *CoreHandler) SetSemanticRouter(router *SemanticRouter) {
 	if ch.userAgentHigh != nil {
-		ch.userAgentHigh.Callback = cb
+		ch.userAgentHigh.SetSemanticRouter(router)
 	}
 	if ch.userAgentLow != nil {
-		ch.userAgentLow.Callback = cb
+		ch.userAgentLow.SetSemanticRouter(router)
+	}
+}
+
+// SetKnowledgeIndex offers the search_knowledge tool over index to the Core and both UserAgents
+func (ch *CoreHandler) SetKnowledgeIndex(index *KnowledgeIndex) {
+	ch.knowledge = index
+	for _, agent := range []*Engine{ch.userAgentHigh, ch.userAgentLow} {
+		if agent != nil {
+			agent.SetKnowledgeIndex(index)
+		}
 	}
 }
 
@@ -167,6 +443,7 @@ func (ch *CoreHandler) UseLLMConfig(config LLMConfig) error {
 	if config.HTTPClient != nil {
 		openaiConfig.HTTPClient = config.HTTPClient
 	}
+	openaiConfig = withPromptCaching(openaiConfig, config)
 
 	ch.llmClient = openai.NewClientWithConfig(openaiConfig)
 	ch.llmConfig = config
@@ -187,6 +464,8 @@ func (ch *CoreHandler) UseLLMConfig(config LLMConfig) error {
 		ch.getOrCreateUser,
 		ch.saveUser,
 	)
+	ch.userModeration.SetConfig(ch.config.Moderation)
+	ch.userModeration.SetEventRecorder(ch.recordModerationEvent)
 
 	return nil
 }
@@ -195,10 +474,38 @@ func (ch *CoreHandler) UseLLMConfig(config LLMConfig) error {
 // to the default OpenAI client. This is the single entry point for all LLM calls
 // in the CoreHandler, ensuring consistent fallback behaviour.
 func (ch *CoreHandler) callLLM(ctx context.Context, model string, messages []openai.ChatCompletionMessage, tools []openai.Tool) (openai.ChatCompletionResponse, error) {
+	return ch.callLLMWithClient(ctx, ch.llmClient, model, messages, tools)
+}
+
+// callLLMWithClient is callLLM with the OpenAI client used after the backups
+// (the vision client for image messages). Requests with images only try vision-capable backups.
+func (ch *CoreHandler) callLLMWithClient(ctx context.Context, client *openai.Client, model string, messages []openai.ChatCompletionMessage, tools []openai.Tool) (openai.ChatCompletionResponse, error) {
+	request := openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: messages,
+		Tools:    tools,
+	}
+	if ch.replay != nil {
+		return ch.replay.CreateChatCompletion(ctx, request)
+	}
+	resp, err := ch.callLLMProvider(ctx, client, request)
+	if err == nil && ch.llmRecords != nil {
+		recordLLMCall(ch.llmRecords, request, resp, "CoreHandler")
+	}
+	return resp, err
+}
+
+// callLLMProvider sends request to the backup providers or, after them, to client
+func (ch *CoreHandler) callLLMProvider(ctx context.Context, client *openai.Client, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	model, messages, tools := request.Model, request.Messages, request.Tools
+
 	// Try backup providers chain first
 	if resp, ok := ch.backups.tryBackup(ctx, messages, tools, "CoreHandler"); ok {
 		return resp, nil
 	}
+	if err := ctx.Err(); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
 
 	// Default: OpenAI client
 	systemPromptLen := 0
@@ -207,24 +514,52 @@ func (ch *CoreHandler) callLLM(ctx context.Context, model string, messages []ope
 			systemPromptLen += len(m.Content)
 		}
 	}
-	log.Log.Infof("[CoreHandler] 🔵 DEFAULT LLM >> Using OpenAI | Model: %s | Messages: %d | Tools: %d | system_prompt_len=%d", model, len(messages), len(tools), systemPromptLen)
-	request := openai.ChatCompletionRequest{
-		Model:    model,
-		Messages: messages,
-		Tools:    tools,
-	}
-	resp, err := ch.llmClient.CreateChatCompletion(ctx, request)
+	ch.logger().Info("[CoreHandler] 🔵 DEFAULT LLM >> Using OpenAI", "model", model, "messages", len(messages), "tools", len(tools), "system_prompt_len", systemPromptLen)
+	resp, err := client.CreateChatCompletion(ctx, request)
 	if err == nil && resp.Usage.TotalTokens > 0 {
-		cacheTokens := 0
+		cacheTokens, reasoningTokens := 0, 0
 		if resp.Usage.PromptTokensDetails != nil {
 			cacheTokens = resp.Usage.PromptTokensDetails.CachedTokens
 		}
-		log.Log.Infof("[CoreHandler] 📊 TOKEN USAGE >> Model: %s | prompt=%d | completion=%d | total=%d | cache=%d (input=prompt, output=completion, total=total, cache=cache)",
-			model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens, cacheTokens)
+		if resp.Usage.CompletionTokensDetails != nil {
+			reasoningTokens = resp.Usage.CompletionTokensDetails.ReasoningTokens
+		}
+		ch.logger().Info("[CoreHandler] 📊 TOKEN USAGE", "model", model,
+			"prompt_tokens", resp.Usage.PromptTokens, "completion_tokens", resp.Usage.CompletionTokens,
+			"total_tokens", resp.Usage.TotalTokens, "cache_tokens", cacheTokens, "reasoning_tokens", reasoningTokens)
+		logPromptCache(ch.logger(), "CoreHandler", model, resp.Usage, ch.llmConfig.EnablePromptCaching)
 	}
 	return resp, err
 }
 
+// UseRecording records every successful LLM call of the Core and all its agents to store, so a
+// conversation can later be replayed with UseReplay. A nil store stops recording.
+func (ch *CoreHandler) UseRecording(store LLMRecordStore) {
+	ch.llmRecords = store
+	for _, agent := range ch.allAgents() {
+		agent.UseRecording(store)
+	}
+}
+
+// UseReplay serves the LLM calls of the Core and all its agents from the responses recorded in
+// store, failing with ErrReplayMiss for requests that were not recorded. A nil store turns it off.
+func (ch *CoreHandler) UseReplay(store LLMRecordStore) {
+	if store == nil {
+		ch.replay = nil
+	} else {
+		ch.replay = NewReplayClient(store)
+	}
+	for _, agent := range ch.allAgents() {
+		agent.UseReplay(store)
+	}
+}
+
+// BackupStatus returns the health and circuit breaker state of each backup provider.
+// Returns nil when no backup providers are configured.
+func (ch *CoreHandler) BackupStatus() []ProviderStatus {
+	return ch.backups.status()
+}
+
 // SetHTTPClient sets a custom HTTP client (e.g., for proxy support)
 func (ch *CoreHandler) SetHTTPClient(client *http.Client) {
 	if ch.llmConfig.HTTPClient == nil {
@@ -250,23 +585,82 @@ func (ch *CoreHandler) ProcessMessageWithContentType(
 	userMessage string,
 	contentType model.ContentType,
 ) (string, error) {
-	if ch.userProgress.TryQueue(userID, userMessage) {
-		return "⏳ Processing previous request... Please wait. 📋 Your message was queued and will be answered in order.", nil
+	if err := ch.beginMessage(); err != nil {
+		return "", err
+	}
+	defer ch.inFlight.Done()
+
+	ctx = withStatusMessages(ctx, ch.statusMessages)
+	queued := queuedMessage{Text: userMessage, ContentType: contentType, QueuedAt: time.Now(), Status: statusFuncFromContext(ctx)}
+	if ch.userProgress.tryQueueMessage(userID, queued) {
+		return ch.queuedReply(), nil
 	}
 	userMu := ch.getUserMutex(userID)
 	userMu.Lock()
-	defer userMu.Unlock()
 	ch.userProgress.SetInProgress(userID, true)
-	defer ch.userProgress.SetInProgress(userID, false)
+	release := func() {
+		ch.userProgress.SetInProgress(userID, false)
+		userMu.Unlock()
+	}
+	if ch.config.QueueMode == QueueModeSeparate {
+		// Messages queued meanwhile are answered one by one once this one is done, whether it
+		// succeeded or not: the user's lock goes to answerQueuedMessages with them
+		release = func() {
+			if queue := ch.userProgress.drainOrRelease(userID); queue != nil {
+				ch.inFlight.Add(1)
+				go ch.answerQueuedMessages(context.WithoutCancel(ctx), userID, userMessage, queue, userMu)
+				return
+			}
+			userMu.Unlock()
+		}
+	}
+	defer release()
+
+	// The caller may have given up while we waited for the mutex
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 
+	start := time.Now()
 	response, err := ch.processOneMessageCore(ctx, userID, userMessage, contentType)
+	ch.recordMessageProcessed(ctx, userID, contentType, start, err)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			ch.logger().Warn("[CoreHandler] ⏹️  Processing cancelled", "user_id", userID, "error", ctxErr)
+			return "", ctxErr
+		}
 		return "", err
 	}
-	// Queued messages are merged inside processWithTools after the first tool response (one combined answer)
+	// Queued messages are merged inside processWithTools (see mergeQueuedMessages): one combined
+	// answer. With QueueModeSeparate they are answered one by one once this answer is returned.
 	return response, nil
 }
 
+// acquireRequestSlot waits for one of the CoreHandlerConfig.MaxConcurrentRequests slots and
+// returns the function giving it back. It fails when ctx ends while waiting.
+func (ch *CoreHandler) acquireRequestSlot(ctx context.Context, userID string) (func(), error) {
+	if ch.requestSlots != nil {
+		if !ch.requestSlots.TryAcquire(1) {
+			ch.logger().Info("[CoreHandler] 🚦 Waiting for a request slot", "user_id", userID, "in_flight", ch.InFlightRequests())
+			if err := ch.requestSlots.Acquire(ctx, 1); err != nil {
+				return nil, fmt.Errorf("gave up waiting for a request slot: %w", err)
+			}
+		}
+	}
+	ch.inFlightRequests.Add(1)
+	return func() {
+		ch.inFlightRequests.Add(-1)
+		if ch.requestSlots != nil {
+			ch.requestSlots.Release(1)
+		}
+	}, nil
+}
+
+// InFlightRequests returns the number of messages whose LLM calls are running, across all users
+func (ch *CoreHandler) InFlightRequests() int {
+	return int(ch.inFlightRequests.Load())
+}
+
 // processOneMessageCore does one full Core message flow (no mutex; caller must hold user mutex and set progress).
 func (ch *CoreHandler) processOneMessageCore(
 	ctx context.Context,
@@ -274,6 +668,7 @@ func (ch *CoreHandler) processOneMessageCore(
 	userMessage string,
 	contentType model.ContentType,
 ) (string, error) {
+	ctx = withStatusMessages(ctx, ch.statusMessagesFor(ch.userLanguage(userID, userMessage)))
 	notifyStatus(ctx, userID, "", StatusReceived, "")
 
 	userSessions, _ := ch.sessionHandler.ListUserSessions(userID)
@@ -281,55 +676,52 @@ func (ch *CoreHandler) processOneMessageCore(
 	totalCoreSessions := len(ch.coreSessions)
 	ch.coreSessionsMu.RUnlock()
 
-	log.Log.Infof("[CoreHandler] 🚀 Processing new message | UserID: %s | Message length: %d chars | User sessions: %d | Total Core sessions: %d",
-		userID, len(userMessage), len(userSessions), totalCoreSessions)
+	ch.logger().Info("[CoreHandler] 🚀 Processing new message", "user_id", userID, "message_len", len(userMessage), "user_sessions", len(userSessions), "core_sessions", totalCoreSessions)
 
 	if !ch.userAgentHigh.IsDBReady() || !ch.userAgentLow.IsDBReady() {
 		return "", fmt.Errorf("database is not ready. Call Init() on UserAgents first to ensure database is fully loaded")
 	}
-	if ch.llmClient == nil {
+	if ch.llmClient == nil && ch.replay == nil {
 		return "", fmt.Errorf("LLM client not configured. Call UseLLMConfig first")
 	}
 
 	notifyStatus(ctx, userID, "", StatusAnalyzing, "")
 
-	var isNonsense bool
 	if ch.userModeration != nil {
 		if isBanned, banMessage := ch.userModeration.CheckBanStatus(userID); isBanned {
 			return banMessage, nil
 		}
-		ctx = model.WithUserID(ctx, userID)
-		shouldBan, banMessage, err := ch.userModeration.ProcessNonsenseCheck(ctx, userID, userMessage)
-		if err != nil {
-			log.Log.Warnf("[CoreHandler] ⚠️  Failed to process nonsense check, proceeding anyway | UserID: %s | Error: %v", userID, err)
-		} else {
-			isNonsense = banMessage != "" || shouldBan
-			if shouldBan {
-				return banMessage, nil
-			}
-			if banMessage != "" {
-				return banMessage, nil
-			}
-		}
 	}
 
 	coreSession, err := ch.getOrCreateCoreSession(userID)
 	if err != nil {
 		return "", fmt.Errorf("failed to get or create core session: %w", err)
 	}
-	systemPrompts, err := ch.buildSystemPrompts(userID)
+
+	// The message ID is assigned before moderation so strikes and bans can refer to it
+	userMsgID, userSeqID := coreSession.GenerateMessageIDWithSeq()
+	ctx = withModerationMessageID(ctx, userMsgID)
+	if reply, blocked := ch.moderateUserMessage(ctx, userID, coreSession, userMsgID, userSeqID, userMessage, userMessage, contentType); blocked {
+		return reply, nil
+	}
+
+	systemPrompts, stable, err := ch.buildSystemPrompts(userID)
 	if err != nil {
 		return "", fmt.Errorf("failed to build system prompts: %w", err)
 	}
+	ctx = withPromptCachePrefix(ctx, systemPrompts[:stable])
 
 	coreSession.Msgs = append(
 		coreSession.Msgs,
 		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: userMessage},
 	)
-	userMsgID, userSeqID := coreSession.GenerateMessageIDWithSeq()
+	coreSession.Msgs = trimActiveMessages(coreSession, coreSession.Msgs, ch.config.MaxActiveMessages, ch.config.MaxActiveTokens)
 	userMsg := model.NewUserMessage(userMsgID, userSeqID, userID, coreSession.SessionID, userMessage, contentType)
-	userMsg.IsNonsense = isNonsense
-	ch.saveMessage(userMsg)
+	if err := ch.saveMessage(userMsg); err != nil {
+		if err := persistFailed(ch.config.FailFastOnPersistError, coreSession, "message", err); err != nil {
+			return "", err
+		}
+	}
 	if err := ch.saveCoreSession(coreSession); err != nil {
 		return "", fmt.Errorf("failed to save core session: %w", err)
 	}
@@ -339,7 +731,12 @@ func (ch *CoreHandler) processOneMessageCore(
 	ctx = model.WithUserID(ctx, userID)
 	notifyStatus(ctx, userID, coreSession.SessionID, StatusRouting, "")
 
-	response, err := ch.processWithTools(ctx, messages, tools, userID, coreSession)
+	release, err := ch.acquireRequestSlot(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	response, err := ch.processWithTools(ctx, messages, tools, userID, userMessage, coreSession)
+	release()
 	if err != nil {
 		return "", fmt.Errorf("failed to process message: %w", err)
 	}
@@ -352,10 +749,47 @@ func (ch *CoreHandler) processOneMessageCore(
 	if err := ch.saveCoreSession(coreSession); err != nil {
 		return "", fmt.Errorf("failed to save core session: %w", err)
 	}
+	ch.noteMemoryMessage(ctx, userID, coreSession.SessionID, coreSession.Msgs)
 	notifyStatus(ctx, userID, coreSession.SessionID, StatusCompleted, "")
 	return response, nil
 }
 
+// moderateUserMessage runs the nonsense check on text, the content of a user message that is
+// stored as msgID. A flagged message is stored with IsNonsense (but kept out of the conversation)
+// and the warning or ban message is returned with blocked=true.
+func (ch *CoreHandler) moderateUserMessage(
+	ctx context.Context,
+	userID string,
+	coreSession *model.Session,
+	msgID string,
+	seqID int,
+	text string,
+	storedContent string,
+	contentType model.ContentType,
+) (string, bool) {
+	if ch.userModeration == nil {
+		return "", false
+	}
+	ctx = model.WithUserID(ctx, userID)
+	shouldBan, banMessage, err := ch.userModeration.ProcessNonsenseCheck(ctx, userID, text)
+	if err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to process nonsense check, proceeding anyway", "user_id", userID, "error", err)
+		return "", false
+	}
+	if !shouldBan && banMessage == "" {
+		return "", false
+	}
+
+	msg := model.NewUserMessage(msgID, seqID, userID, coreSession.SessionID, storedContent, contentType)
+	msg.IsNonsense = true
+	ch.saveMessage(msg)
+	// Persist the message sequence so the ID is not reused
+	if err := ch.saveCoreSession(coreSession); err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to save core session after moderation", "user_id", userID, "error", err)
+	}
+	return banMessage, true
+}
+
 // getOrCreateCoreSession gets or creates a Core session for a user
 // It uses SessionHandler to ensure persistence in the database
 // NOTE: This uses the same pattern as getOrCreateActiveSession - first checks User's ActiveSessionID
@@ -368,17 +802,16 @@ func (ch *CoreHandler) getOrCreateCoreSession(userID string) (*model.Session, er
 	if exists {
 		// Verify session still exists in database and refresh if needed
 		dbSession, err := ch.sessionHandler.GetSession(session.SessionID)
-		if err == nil && dbSession != nil {
+		if err == nil && dbSession != nil && !dbSession.Archived {
 			// Update cache with fresh data from database
 			ch.coreSessionsMu.Lock()
 			ch.coreSessions[userID] = dbSession
 			ch.coreSessionsMu.Unlock()
 
-			log.Log.Infof("[CoreHandler] 🔄 Using cached Core session | UserID: %s | SessionID: %s",
-				userID, dbSession.SessionID)
+			ch.logger().Info("[CoreHandler] 🔄 Using cached Core session", "user_id", userID, "session_id", dbSession.SessionID)
 			return dbSession, nil
 		}
-		// Session not found in DB, will create new one below
+		// Session not found in DB or archived, will pick up or create another one below
 	}
 
 	ch.coreSessionsMu.Lock()
@@ -387,10 +820,9 @@ func (ch *CoreHandler) getOrCreateCoreSession(userID string) (*model.Session, er
 	// Double-check after acquiring write lock
 	if session, exists = ch.coreSessions[userID]; exists {
 		dbSession, err := ch.sessionHandler.GetSession(session.SessionID)
-		if err == nil && dbSession != nil {
+		if err == nil && dbSession != nil && !dbSession.Archived {
 			ch.coreSessions[userID] = dbSession
-			log.Log.Infof("[CoreHandler] 🔄 Using cached Core session (after lock) | UserID: %s | SessionID: %s",
-				userID, dbSession.SessionID)
+			ch.logger().Info("[CoreHandler] 🔄 Using cached Core session (after lock)", "user_id", userID, "session_id", dbSession.SessionID)
 			return dbSession, nil
 		}
 	}
@@ -399,15 +831,13 @@ func (ch *CoreHandler) getOrCreateCoreSession(userID string) (*model.Session, er
 	activeSessionID := ch.getActiveSessionID(userID, model.AgentTypeCore)
 	if activeSessionID != "" {
 		activeSession, err := ch.sessionHandler.GetSession(activeSessionID)
-		if err == nil && activeSession != nil {
+		if err == nil && activeSession != nil && !activeSession.Archived {
 			ch.coreSessions[userID] = activeSession
-			log.Log.Infof("[CoreHandler] 🔄 Using active Core session from User | UserID: %s | SessionID: %s",
-				userID, activeSession.SessionID)
+			ch.logger().Info("[CoreHandler] 🔄 Using active Core session from User", "user_id", userID, "session_id", activeSession.SessionID)
 			return activeSession, nil
 		}
 		// Active session reference is stale, will create new below
-		log.Log.Warnf("[CoreHandler] ⚠️  Active Core session no longer exists | UserID: %s | OldSessionID: %s",
-			userID, activeSessionID)
+		ch.logger().Warn("[CoreHandler] ⚠️  Active Core session no longer exists", "user_id", userID, "old_session_id", activeSessionID)
 	}
 
 	// Fallback: Try to get existing Core session from database (for migration from old data)
@@ -420,8 +850,7 @@ func (ch *CoreHandler) getOrCreateCoreSession(userID string) (*model.Session, er
 			ch.coreSessions[userID] = existingCore
 			// Also set as active session for future lookups
 			_ = ch.setActiveSessionID(userID, model.AgentTypeCore, existingCore.SessionID)
-			log.Log.Infof("[CoreHandler] 🔄 Loaded Core session from database (migration) | UserID: %s | SessionID: %s",
-				userID, existingCore.SessionID)
+			ch.logger().Info("[CoreHandler] 🔄 Loaded Core session from database (migration)", "user_id", userID, "session_id", existingCore.SessionID)
 			return existingCore, nil
 		}
 	} else {
@@ -433,8 +862,7 @@ func (ch *CoreHandler) getOrCreateCoreSession(userID string) (*model.Session, er
 					ch.coreSessions[userID] = s
 					// Also set as active session for future lookups
 					_ = ch.setActiveSessionID(userID, model.AgentTypeCore, s.SessionID)
-					log.Log.Infof("[CoreHandler] 🔄 Found Core session from list (migration) | UserID: %s | SessionID: %s",
-						userID, s.SessionID)
+					ch.logger().Info("[CoreHandler] 🔄 Found Core session from list (migration)", "user_id", userID, "session_id", s.SessionID)
 					return s, nil
 				}
 			}
@@ -450,7 +878,7 @@ func (ch *CoreHandler) getOrCreateCoreSession(userID string) (*model.Session, er
 
 	ch.coreSessions[userID] = session
 
-	log.Log.Infof("[CoreHandler] ✨ Created new Core session | UserID: %s | SessionID: %s", userID, session.SessionID)
+	ch.logger().Info("[CoreHandler] ✨ Created new Core session", "user_id", userID, "session_id", session.SessionID)
 
 	return session, nil
 }
@@ -462,6 +890,10 @@ func (ch *CoreHandler) saveCoreSession(session *model.Session) error {
 	ch.coreSessions[session.UserID] = session
 	ch.coreSessionsMu.Unlock()
 
+	if moved := session.CapMessages(ch.config.MaxSessionMessages); moved > 0 {
+		ch.logger().Info("[CoreHandler] ✂️  Capped session messages", "session_id", session.SessionID, "moved", moved, "kept", len(session.Msgs))
+	}
+
 	// Save to database through SessionHandler
 	store := ch.sessionHandler.GetStore()
 	if err := store.Put(session); err != nil {
@@ -471,8 +903,9 @@ func (ch *CoreHandler) saveCoreSession(session *model.Session) error {
 	return nil
 }
 
-// buildSystemPrompts builds the array of system prompts for the Core
-func (ch *CoreHandler) buildSystemPrompts(userID string) ([]string, error) {
+// buildSystemPrompts builds the array of system prompts for the Core, and how many of them
+// (the first ones) do not change between turns, see withPromptCachePrefix
+func (ch *CoreHandler) buildSystemPrompts(userID string) ([]string, int, error) {
 	prompts := []string{}
 
 	// 1. Core Controller base prompt
@@ -483,6 +916,8 @@ func (ch *CoreHandler) buildSystemPrompts(userID string) ([]string, error) {
 	if toolsPrompt != "" {
 		prompts = append(prompts, toolsPrompt)
 	}
+	// Everything above is the same for every user and turn (the cacheable prefix), what follows is not
+	stable := len(prompts)
 
 	// 3. Session context - Summary and tags from previous conversations (if summarized)
 	// This provides context from archived messages that are no longer in the active conversation
@@ -496,6 +931,18 @@ func (ch *CoreHandler) buildSystemPrompts(userID string) ([]string, error) {
 		}
 	}
 
+	// 3a. Language - respond in the user's language (if known)
+	if user, _ := ch.getOrCreateUser(userID); user != nil {
+		if languagePrompt := buildLanguagePrompt(user.Language); languagePrompt != "" {
+			prompts = append(prompts, languagePrompt)
+		}
+	}
+
+	// 3b. Long-term memory - the user's most confident facts (if memory is enabled)
+	if memoryPrompt := ch.buildMemoryPrompt(userID); memoryPrompt != "" {
+		prompts = append(prompts, memoryPrompt)
+	}
+
 	// 4. Active sessions prompt (shows current active session for each agent type)
 	activePrompt := ch.buildActiveSessionsPrompt(userID)
 	if activePrompt != "" {
@@ -505,31 +952,28 @@ func (ch *CoreHandler) buildSystemPrompts(userID string) ([]string, error) {
 	// 5. Sessions list prompt (for change_session)
 	sessionsPrompt, err := ch.sessionHandler.GetSessionsPrompt(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get sessions prompt: %w", err)
+		return nil, 0, fmt.Errorf("failed to get sessions prompt: %w", err)
 	}
 	prompts = append(prompts, sessionsPrompt)
 
-	return prompts, nil
+	return prompts, stable, nil
 }
 
 // buildUserAgentToolsPrompt generates a system prompt listing all tools registered
 // in the UserAgent engines. This helps the Core LLM understand what capabilities
 // the agents have so it can route requests more accurately.
+// It is rebuilt on every message, so tools registered or removed at runtime show up immediately.
 func (ch *CoreHandler) buildUserAgentToolsPrompt() string {
-	// Collect unique tool names from both engines
-	toolSet := make(map[string]bool)
-	if ch.userAgentHigh != nil && ch.userAgentHigh.Functions != nil {
-		for _, name := range ch.userAgentHigh.Functions.GetAllRegistered() {
-			toolSet[name] = true
-		}
-	}
-	if ch.userAgentLow != nil && ch.userAgentLow.Functions != nil {
-		for _, name := range ch.userAgentLow.Functions.GetAllRegistered() {
-			toolSet[name] = true
+	// Collect unique tools from both engines, sorted by name for prompt caching
+	var lists [][]openai.Tool
+	for _, agent := range []*Engine{ch.userAgentHigh, ch.userAgentLow} {
+		if agent != nil && agent.Functions != nil {
+			lists = append(lists, agent.Functions.GetDefinitions())
 		}
 	}
+	tools := MergeToolDefinitions(lists...)
 
-	if len(toolSet) == 0 {
+	if len(tools) == 0 {
 		return ""
 	}
 
@@ -537,8 +981,12 @@ func (ch *CoreHandler) buildUserAgentToolsPrompt() string {
 	sb.WriteString("## Registered UserAgent Tools\n\n")
 	sb.WriteString("The following tools are currently registered and available to UserAgents.\n")
 	sb.WriteString("When a user's request requires any of these tools, delegate to the appropriate agent.\n\n")
-	for name := range toolSet {
-		sb.WriteString(fmt.Sprintf("- `%s`\n", name))
+	for _, tool := range tools {
+		if tool.Function.Description != "" {
+			sb.WriteString(fmt.Sprintf("- `%s`: %s\n", tool.Function.Name, tool.Function.Description))
+		} else {
+			sb.WriteString(fmt.Sprintf("- `%s`\n", tool.Function.Name))
+		}
 	}
 	return sb.String()
 }
@@ -606,6 +1054,10 @@ func (ch *CoreHandler) buildActiveSessionsPrompt(userID string) string {
 			sb.WriteString(fmt.Sprintf("- **%s**: No active session (previous session was deleted)\n", at.name))
 			continue
 		}
+		if session.Archived {
+			sb.WriteString(fmt.Sprintf("- **%s**: No active session (previous session was archived)\n", at.name))
+			continue
+		}
 
 		hasActiveSessions = true
 		title := session.Title
@@ -638,12 +1090,46 @@ func (ch *CoreHandler) buildMessages(systemPrompts []string, conversationMsgs []
 		})
 	}
 
-	// Add conversation history
-	messages = append(messages, conversationMsgs...)
+	// Add conversation history (limited to the configured window)
+	messages = append(messages, dropOrphanToolMessages(trimHistoryWindow(conversationMsgs, ch.config.MaxHistoryMessages), "CoreHandler")...)
 
 	return messages
 }
 
+// trimHistoryWindow returns the most recent maxMessages non-system messages, with the system
+// messages (such as the note of the active history window) kept in place.
+// The cutoff is moved forward past any leading tool results so a tool result is never
+// sent without the assistant message that requested it (see model.WindowStart).
+// maxMessages <= 0 disables trimming.
+func trimHistoryWindow(msgs []openai.ChatCompletionMessage, maxMessages int) []openai.ChatCompletionMessage {
+	if maxMessages <= 0 {
+		return msgs
+	}
+
+	conversation := make([]openai.ChatCompletionMessage, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Role != openai.ChatMessageRoleSystem {
+			conversation = append(conversation, m)
+		}
+	}
+	start := model.WindowStart(conversation, func(window []openai.ChatCompletionMessage) bool {
+		return len(window) <= maxMessages
+	})
+	if start == 0 {
+		return msgs
+	}
+
+	kept := make([]openai.ChatCompletionMessage, 0, len(msgs)-start)
+	for _, m := range msgs {
+		if m.Role != openai.ChatMessageRoleSystem && start > 0 {
+			start--
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
 // getCoreToolsForLLM returns the tools in OpenAI format
 func (ch *CoreHandler) getCoreToolsForLLM() []openai.Tool {
 	tools := []openai.Tool{
@@ -736,6 +1222,54 @@ func (ch *CoreHandler) getCoreToolsForLLM() []openai.Tool {
 				},
 			},
 		},
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "find_sessions",
+				Description: "Find the current user's sessions by tag, e.g. to switch to \"the conversation about the Berlin trip\" with change_session. Cheaper than list_sessions when the user names a topic.",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"tags": map[string]interface{}{
+							"type":        "array",
+							"items":       map[string]interface{}{"type": "string"},
+							"description": "Tags to look for, e.g. [\"berlin\", \"travel\"]",
+						},
+						"match_all": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Only return sessions carrying every tag (default: any tag)",
+						},
+					},
+					"required": []string{"tags"},
+				},
+			},
+		},
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "restart_journey",
+				Description: "Restart the active session of a UserAgent at the beginning of the knowledge tree. Use when the user wants to start a multi-step flow over.",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"agent_type": map[string]interface{}{
+							"type":        "string",
+							"enum":        []string{"high", "low"},
+							"description": "The type of UserAgent whose session to restart",
+						},
+						"clear_history": map[string]interface{}{
+							"type":        "boolean",
+							"description": "true to clear the conversation so far, false to keep it",
+						},
+						"clear_visited_nodes": map[string]interface{}{
+							"type":        "boolean",
+							"description": "Optional: also forget the steps the user has already visited",
+						},
+					},
+					"required": []string{"agent_type", "clear_history"},
+				},
+			},
+		},
 		{
 			Type: openai.ToolTypeFunction,
 			Function: &openai.FunctionDefinition{
@@ -757,6 +1291,27 @@ func (ch *CoreHandler) getCoreToolsForLLM() []openai.Tool {
 				},
 			},
 		},
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "unban_user",
+				Description: "Lift the current user's ban and reset their nonsense-message strikes. Use this to undo a ban that turned out to be a mistake.",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"reason": map[string]interface{}{
+							"type":        "string",
+							"description": "Why the ban is lifted (kept in the moderation history)",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// call_agent tool: only offered when named specialist agents are registered
+	if tool, ok := ch.namedAgentToolDefinition(); ok {
+		tools = append(tools, tool)
 	}
 
 	// update_status tool: let Core LLM send contextual status updates
@@ -782,6 +1337,27 @@ func (ch *CoreHandler) getCoreToolsForLLM() []openai.Tool {
 		},
 	})
 
+	// File tools need a knowledge tree to read from
+	if ch.knowledgeRepo() != nil {
+		tools = append(tools, coreFileToolDefinitions()...)
+	}
+
+	if ch.memory != nil {
+		tools = append(tools, coreMemoryToolDefinitions()...)
+	}
+
+	if ch.knowledge != nil {
+		def := searchKnowledgeToolDefinition
+		tools = append(tools, openai.Tool{Type: openai.ToolTypeFunction, Function: &def})
+	}
+
+	// Tools added with RegisterFunction (built-in Core tools are not context-aware)
+	for _, tool := range ch.coreTools.GetDefinitions() {
+		if ch.coreTools.HasContext(tool.Function.Name) {
+			tools = append(tools, tool)
+		}
+	}
+
 	// Add web search tools only if not disabled
 	if !ch.config.WebSearchDisabled {
 		tools = append(tools, openai.Tool{
@@ -823,14 +1399,26 @@ func (ch *CoreHandler) getCoreToolsForLLM() []openai.Tool {
 	return tools
 }
 
-// processWithTools handles the LLM call and tool execution loop.
-// SIMPLIFIED: Only uses currentMessages for the LLM loop. coreSession.Msgs is NOT updated here.
+// Length-limited answers (see CoreHandlerConfig.AutoContinueOnLength)
+const (
+	// maxLengthContinuations limits how many times one answer is continued
+	maxLengthContinuations = 3
+	// lengthContinuePrompt asks the model to go on with an answer cut off by the token limit
+	lengthContinuePrompt = "Your previous response was cut off by the length limit. Continue exactly where it stopped, without repeating anything."
+	// truncatedResponseMarker ends an answer that was cut off and not continued
+	truncatedResponseMarker = "\n\n(response truncated)"
+)
+
+// processWithTools handles the LLM call and tool execution loop for userMessage.
+// SIMPLIFIED: Only uses currentMessages for the LLM loop. coreSession.Msgs only gets the messages
+// queued meanwhile (see mergeQueuedMessages).
 // The caller (processOneMessageCore) is responsible for updating coreSession.Msgs with the final response.
 func (ch *CoreHandler) processWithTools(
 	ctx context.Context,
 	messages []openai.ChatCompletionMessage,
 	tools []openai.Tool,
 	userID string,
+	userMessage string,
 	coreSession *model.Session,
 ) (string, error) {
 	const maxIterations = 10
@@ -852,29 +1440,30 @@ func (ch *CoreHandler) processWithTools(
 	if _, ok := model.GetUserIDFromContext(ctx); !ok && userID != "" {
 		ctx = model.WithUserID(ctx, userID)
 	}
+	ctx = withOfferedTools(ctx, tools)
 
 	sessionID := ""
 	if coreSession != nil {
 		sessionID = coreSession.SessionID
 	}
 
+	// Text of answers cut off by the token limit, continued in the next iteration
+	continued := ""
+	continuations := 0
+
 	for i := 0; i < maxIterations; i++ {
-		log.Log.Infof("[CoreHandler] 🔄 processWithTools iteration %d/%d | UserID: %s | Messages: %d",
-			i+1, maxIterations, userID, len(currentMessages))
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		ch.logger().Info("[CoreHandler] 🔄 processWithTools iteration",
+			"iteration", i+1, "max_iterations", maxIterations, "user_id", userID, "messages", len(currentMessages))
 
 		notifyStatus(ctx, userID, sessionID, StatusThinking, "")
 
 		// BeforeAction: check quota/credit before LLM call (block without consuming tokens)
-		if ch.Callback != nil {
-			if cbErr := ch.Callback.BeforeAction(ctx, &UsageEvent{
-				UserID:    userID,
-				SessionID: sessionID,
-				EventType: EventLLMCall,
-				Name:      EventNameLLMCall,
-				Model:     modelName,
-			}); cbErr != nil {
-				return cbErr.Error(), nil
-			}
+		if cbErr := checkLLMBudget(ctx, ch.Callback, ch.quota, userID, sessionID, modelName, currentMessages, tools); cbErr != nil {
+			return blockedLLMMessage(ch.llmConfig.QuotaExceededMessage, cbErr), nil
 		}
 
 		// Call LLM
@@ -882,6 +1471,9 @@ func (ch *CoreHandler) processWithTools(
 		resp, err := ch.callLLM(ctx, modelName, currentMessages, tools)
 		llmDuration := time.Since(llmStart)
 		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return "", ctxErr
+			}
 			return "", formatLLMError(err)
 		}
 
@@ -890,55 +1482,93 @@ func (ch *CoreHandler) processWithTools(
 		}
 
 		choice := resp.Choices[0]
+		if coreSession != nil {
+			coreSession.AddTokenUsage(resp.Usage)
+		}
 
 		// Record usage
-		if ch.Callback != nil {
-			ev := &UsageEvent{
-				UserID:       userID,
-				SessionID:    sessionID,
-				EventType:    EventLLMCall,
-				Name:         EventNameLLMCall,
-				Tokens:       resp.Usage.TotalTokens,
-				InputTokens:  resp.Usage.PromptTokens,
-				OutputTokens: resp.Usage.CompletionTokens,
-				Model:        modelName,
-				Duration:     llmDuration,
-			}
-			if resp.Usage.PromptTokensDetails != nil {
-				ev.CachedInputTokens = resp.Usage.PromptTokensDetails.CachedTokens
-			}
-			ch.Callback.AfterAction(ctx, ev)
+		ev := &UsageEvent{
+			UserID:       userID,
+			SessionID:    sessionID,
+			EventType:    EventLLMCall,
+			Name:         EventNameLLMCall,
+			Tokens:       resp.Usage.TotalTokens,
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+			Model:        modelName,
+			Duration:     llmDuration,
+		}
+		if resp.Usage.PromptTokensDetails != nil {
+			ev.CachedInputTokens = resp.Usage.PromptTokensDetails.CachedTokens
 		}
+		recordLLMUsage(ctx, ch.Callback, ch.config.CostTable, ch.sessionHandler.GetStore(), ev)
 
 		// Save message to DB
 		request := openai.ChatCompletionRequest{Model: modelName, Messages: currentMessages, Tools: tools}
-		messageID := ch.saveCoreMessage(userID, request, resp, choice)
+		messageID, err := ch.saveCoreMessage(userID, request, resp, choice)
+		if err != nil {
+			if err := persistFailed(ch.config.FailFastOnPersistError, coreSession, "message", err); err != nil {
+				return "", err
+			}
+		}
 
-		log.Log.Infof("[CoreHandler] 📊 LLM response | Iteration: %d | FinishReason: %s | ToolCalls: %d | ContentLen: %d",
-			i+1, choice.FinishReason, len(choice.Message.ToolCalls), len(choice.Message.Content))
+		ch.logger().Info("[CoreHandler] 📊 LLM response", "iteration", i+1, "finish_reason", choice.FinishReason, "tool_calls", len(choice.Message.ToolCalls), "content_len", len(choice.Message.Content))
 
 		// No tool calls = final response
 		if len(choice.Message.ToolCalls) == 0 {
-			return choice.Message.Content, nil
+			response := continued + choice.Message.Content
+			if choice.FinishReason != openai.FinishReasonLength {
+				// Messages the user sent meanwhile are answered in the same reply
+				if i+1 < maxIterations {
+					queued, err := ch.mergeQueuedMessages(ctx, userID, coreSession, userMessage)
+					if err != nil {
+						return "", err
+					}
+					if len(queued) > 0 {
+						continued = response + "\n\n"
+						currentMessages = append(currentMessages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: choice.Message.Content})
+						currentMessages = append(currentMessages, queued...)
+						continue
+					}
+				}
+				return response, nil
+			}
+			// The last iteration has no room left for a continuation
+			if !ch.config.AutoContinueOnLength || continuations >= maxLengthContinuations || i+1 >= maxIterations {
+				ch.logger().Warn("[CoreHandler] ✂️  Response truncated at the token limit", "user_id", userID, "continuations", continuations)
+				return response + truncatedResponseMarker, nil
+			}
+			continuations++
+			continued = response
+			ch.logger().Info("[CoreHandler] ⏩ Continuing truncated response", "user_id", userID, "continuation", continuations)
+			currentMessages = append(currentMessages,
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: choice.Message.Content},
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: lengthContinuePrompt},
+			)
+			continue
 		}
 
 		// Has tool calls - add assistant message to currentMessages
 		currentMessages = append(currentMessages, choice.Message)
 
-		// Execute each tool
-		for _, toolCall := range choice.Message.ToolCalls {
-			result := ch.executeCoreTool(ctx, userID, sessionID, coreSession, messageID, toolCall)
-
-			log.Log.Infof("[CoreHandler] 🔧 Tool executed | Name: %s | ResultLen: %d",
-				toolCall.Function.Name, len(result))
-
-			// Add tool result to currentMessages
+		// Execute the tools (concurrently where possible); results keep the order of the calls
+		results, err := ch.executeCoreToolCalls(ctx, userID, sessionID, coreSession, messageID, choice.Message.ToolCalls)
+		if err != nil {
+			return "", err
+		}
+		for j, toolCall := range choice.Message.ToolCalls {
 			currentMessages = append(currentMessages, openai.ChatCompletionMessage{
 				Role:       openai.ChatMessageRoleTool,
-				Content:    result,
+				Content:    results[j],
 				ToolCallID: toolCall.ID,
 			})
 		}
+		// Messages the user sent meanwhile join the conversation before the next call
+		queued, err := ch.mergeQueuedMessages(ctx, userID, coreSession, userMessage)
+		if err != nil {
+			return "", err
+		}
+		currentMessages = append(currentMessages, queued...)
 
 		// Continue loop to process tool results
 	}
@@ -946,28 +1576,47 @@ func (ch *CoreHandler) processWithTools(
 	return "", fmt.Errorf("max iterations (%d) reached without final response", maxIterations)
 }
 
-// executeCoreTool executes a Core tool and returns the result string.
-// Handles persistence, callbacks, and status notifications.
+// executeCoreTool executes a Core tool saved under toolID and returns the result string and the
+// error the call was saved with (nil if it succeeded).
+// Handles the tool call's response update, callbacks, and status notifications.
 func (ch *CoreHandler) executeCoreTool(
 	ctx context.Context,
 	userID, sessionID string,
-	coreSession *model.Session,
-	messageID string,
+	persister *ToolCallPersister,
+	toolID string,
 	toolCall openai.ToolCall,
-) string {
-	// Save tool call to DB
-	persister := ch.getToolCallPersister()
-	var toolID string
-	if coreSession != nil {
-		toolID = persister.SaveWithAgentType(coreSession, messageID, toolCall, model.AgentTypeCore)
-	}
-
+) (string, error) {
 	toolDetail := ch.coreTools.GetDisplayName(toolCall.Function.Name)
 	if toolDetail == "" {
 		toolDetail = toolCall.Function.Name
 	}
 	notifyStatus(ctx, userID, sessionID, StatusToolExecuting, toolDetail)
 
+	// Repair and validate the arguments; invalid ones are reported back to the model
+	check := checkToolArgs(ctx, toolCall, ch.config.SkipToolArgValidation, "CoreHandler")
+	persister.SetArgsValidation(toolID, check)
+	if check.Outcome == model.ToolArgsInvalid {
+		result := check.ErrorResult(toolCall.Function.Name)
+		err := check.Err(toolCall.Function.Name)
+		persister.Update(toolID, result, err)
+		return result, err
+	}
+	if check.Outcome == model.ToolArgsRepaired {
+		if data, err := json.Marshal(check.Args); err == nil {
+			toolCall.Function.Arguments = string(data)
+		}
+	}
+
+	// Cacheable tools repeating a recent call are answered from the cache
+	cacheTTL := ch.coreTools.GetCacheTTL(toolCall.Function.Name)
+	cacheKey := ""
+	if cacheTTL > 0 {
+		cacheKey = toolCacheKey(ch.config.ToolCache.Scope, userID, sessionID, toolCall)
+		if result, sources, ok := ch.toolCache.get(cacheKey); ok {
+			return ch.cachedToolResult(ctx, userID, sessionID, persister, toolID, toolCall, toolDetail, result, sources)
+		}
+	}
+
 	// Check callback before execution
 	if ch.Callback != nil {
 		if cbErr := ch.Callback.BeforeAction(ctx, &UsageEvent{
@@ -978,34 +1627,68 @@ func (ch *CoreHandler) executeCoreTool(
 		}); cbErr != nil {
 			result := FormatBlockedActionResult(cbErr)
 			persister.Update(toolID, result, cbErr)
-			return result
+			return result, cbErr
 		}
 	}
 
 	// Execute tool
 	toolStart := time.Now()
-	result, err := ch.runCoreToolImpl(ctx, userID, sessionID, toolCall)
+	sources := &toolSources{}
+	result, err := ch.runCoreTool(withToolSources(ctx, sources), userID, sessionID, toolCall)
 	toolDuration := time.Since(toolStart)
 	if err != nil {
 		result = fmt.Sprintf("Error executing tool: %v", err)
+	} else if cacheKey != "" {
+		ch.toolCache.put(cacheKey, result, sources.get(), cacheTTL)
 	}
 
-	// Callback after execution
+	// Callback after execution (web search citations are passed as "sources")
 	if ch.Callback != nil {
-		ch.Callback.AfterAction(ctx, &UsageEvent{
+		event := &UsageEvent{
 			UserID:    userID,
 			SessionID: sessionID,
 			EventType: EventToolCall,
 			Name:      toolCall.Function.Name,
 			Duration:  toolDuration,
 			Error:     err,
-		})
+		}
+		if cited := sources.get(); len(cited) > 0 {
+			event.Metadata = map[string]interface{}{"sources": cited}
+		}
+		ch.Callback.AfterAction(ctx, event)
 	}
 
 	notifyStatus(ctx, userID, sessionID, StatusToolDone, toolDetail)
 	persister.Update(toolID, result, err)
+	persister.SetSources(toolID, sources.get())
 
-	return result
+	return result, err
+}
+
+// runCoreTool runs a Core tool call with the tool call info in ctx. Built-in tools are wrapped in
+// the middlewares of the Core tool registry (see UseToolMiddleware), which receive the parsed
+// arguments and may change them; registered tools get them from ExecuteContext.
+func (ch *CoreHandler) runCoreTool(ctx context.Context, userID, sessionID string, toolCall openai.ToolCall) (string, error) {
+	ctx = model.WithToolCallInfo(ctx, model.ToolCallInfo{
+		ToolName:   toolCall.Function.Name,
+		ToolCallID: toolCall.ID,
+		UserID:     userID,
+		SessionID:  sessionID,
+	})
+	if ch.coreTools.HasContext(toolCall.Function.Name) {
+		return ch.runCoreToolImpl(ctx, userID, sessionID, toolCall)
+	}
+
+	var args map[string]interface{}
+	json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
+	return ch.coreTools.Wrap(toolCall.Function.Name, func(ctx context.Context, args map[string]interface{}) (string, error) {
+		if args != nil {
+			if data, err := json.Marshal(args); err == nil {
+				toolCall.Function.Arguments = string(data)
+			}
+		}
+		return ch.runCoreToolImpl(ctx, userID, sessionID, toolCall)
+	})(ctx, args)
 }
 
 // runCoreToolImpl runs the Core tool logic (switch on tool name). Persistence is handled by executeCoreToolWithPersistence.
@@ -1040,44 +1723,10 @@ func (ch *CoreHandler) runCoreToolImpl(
 		return result, err
 
 	case "call_user_agent_low":
-		agentType := model.AgentTypeLow
-		notifyStatus(ctx, userID, "", StatusAgentCalling, string(agentType))
-		if ch.Callback != nil {
-			if cbErr := ch.Callback.BeforeAction(ctx, &UsageEvent{
-				UserID: userID, EventType: EventAgentRouting, Name: string(agentType),
-			}); cbErr != nil {
-				return FormatBlockedActionResult(cbErr), nil
-			}
-		}
-		result, err := ch.callUserAgent(ctx, userID, args, ch.userAgentLow, agentType)
-		if err != nil {
-			return "", err
-		}
-		// Check for escalation
-		if strings.HasPrefix(strings.TrimSpace(result), "ESCALATE:") {
-			if ch.Callback != nil {
-				ch.Callback.AfterAction(ctx, &UsageEvent{
-					UserID: userID, SessionID: sessionID, EventType: EventAgentRouting, Name: string(agentType),
-				})
-			}
-			notifyStatus(ctx, userID, "", StatusAgentCalling, string(model.AgentTypeHigh)+" (escalated)")
-			// Auto-escalate to high model
-			result, err = ch.callUserAgent(ctx, userID, args, ch.userAgentHigh, model.AgentTypeHigh)
-			if ch.Callback != nil {
-				ch.Callback.AfterAction(ctx, &UsageEvent{
-					UserID: userID, SessionID: sessionID, EventType: EventAgentRouting, Name: string(model.AgentTypeHigh), Error: err,
-				})
-			}
-			notifyStatus(ctx, userID, "", StatusAgentDone, string(model.AgentTypeHigh))
-			return result, err
-		}
-		if ch.Callback != nil {
-			ch.Callback.AfterAction(ctx, &UsageEvent{
-				UserID: userID, SessionID: sessionID, EventType: EventAgentRouting, Name: string(agentType),
-			})
-		}
-		notifyStatus(ctx, userID, "", StatusAgentDone, string(agentType))
-		return result, nil
+		return ch.callUserAgentLow(ctx, userID, sessionID, args)
+
+	case "call_agent":
+		return ch.callNamedAgentTool(ctx, userID, sessionID, args)
 
 	case "update_status":
 		message, _ := args["message"].(string)
@@ -1095,8 +1744,35 @@ func (ch *CoreHandler) runCoreToolImpl(
 	case "list_sessions":
 		return ch.listSessionsTool(userID)
 
+	case "find_sessions":
+		return ch.findSessionsTool(userID, args)
+
+	case "restart_journey":
+		return ch.restartJourneyTool(userID, args)
+
 	case "ban_user":
 		return ch.banUserTool(ctx, userID, args)
+	case "unban_user":
+		reason, _ := args["reason"].(string)
+		if err := ch.unbanUser(ctx, userID, model.ModerationActorCore, reason); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("User %s has been unbanned.", userID), nil
+
+	case "read_file":
+		return ch.readFileTool(userID, sessionID, args)
+	case "close_file":
+		return ch.closeFileTool(userID, sessionID, args)
+
+	case "remember":
+		return ch.rememberTool(ctx, userID, args)
+	case "recall":
+		return ch.recallTool(ctx, userID, args)
+	case "forget_memory":
+		return ch.forgetMemoryTool(userID, args)
+
+	case SearchKnowledgeToolName:
+		return ch.searchKnowledgeTool(ctx, userID, args)
 
 	case "web_search":
 		return ch.webSearchWithModelTool(ctx, userID, args, "")
@@ -1104,6 +1780,14 @@ func (ch *CoreHandler) runCoreToolImpl(
 		return ch.webSearchWithModelTool(ctx, userID, args, SearchModelTongyiDeepResearch)
 
 	default:
+		if ch.coreTools.HasContext(toolCall.Function.Name) {
+			if args == nil {
+				args = make(map[string]interface{})
+			}
+			args["__user_id__"] = userID
+			args["__session_id__"] = sessionID
+			return ch.coreTools.ExecuteContext(ctx, toolCall.Function.Name, args)
+		}
 		return "", fmt.Errorf("unknown tool: %s", toolCall.Function.Name)
 	}
 }
@@ -1125,23 +1809,20 @@ func (ch *CoreHandler) callUserAgent(
 	// Get or create active session for this agent type
 	sessionID, err := ch.getOrCreateActiveSession(userID, agentType)
 	if err != nil {
-		log.Log.Errorf("[CoreHandler] ❌ Failed to get/create active session | UserID: %s | AgentType: %s | Error: %v",
-			userID, agentType, err)
+		ch.logger().Error("[CoreHandler] ❌ Failed to get/create active session", "user_id", userID, "agent_type", agentType, "error", err)
 		return "", fmt.Errorf("failed to get active session: %w", err)
 	}
 
-	log.Log.Infof("[CoreHandler] 🎯 Using active session | SessionID: %s | AgentType: %s | UserID: %s | Message length: %d chars",
-		sessionID, agentType, userID, len(message))
+	ch.logger().Info("[CoreHandler] 🎯 Using active session", "session_id", sessionID, "agent_type", agentType, "user_id", userID, "message_len", len(message))
 
 	// Process message through the UserAgent
 	response, _, err := agent.ProcessMessage(ctx, sessionID, message)
 	if err != nil {
-		log.Log.Errorf("[CoreHandler] ❌ UserAgent processing failed | SessionID: %s | Error: %v", sessionID, err)
+		ch.logger().Error("[CoreHandler] ❌ UserAgent processing failed", "session_id", sessionID, "error", err)
 		return "", fmt.Errorf("UserAgent error: %w", err)
 	}
 
-	log.Log.Infof("[CoreHandler] ✅ UserAgent response received | SessionID: %s | Response length: %d chars",
-		sessionID, len(response))
+	ch.logger().Info("[CoreHandler] ✅ UserAgent response received", "session_id", sessionID, "response_len", len(response))
 
 	return response, nil
 }
@@ -1163,11 +1844,11 @@ func (ch *CoreHandler) createSessionTool(_ context.Context, userID string, args
 		return "", fmt.Errorf("invalid agent_type: %s", agentTypeStr)
 	}
 
-	log.Log.Infof("[CoreHandler] 🛠️  createSessionTool called | UserID: %s | AgentType: %s", userID, agentType)
+	ch.logger().Info("[CoreHandler] 🛠️  createSessionTool called", "user_id", userID, "agent_type", agentType)
 
 	session, err := ch.createSessionForUser(userID, agentType)
 	if err != nil {
-		log.Log.Errorf("[CoreHandler] ❌ Failed to create session | UserID: %s | AgentType: %s | Error: %v", userID, agentType, err)
+		ch.logger().Error("[CoreHandler] ❌ Failed to create session", "user_id", userID, "agent_type", agentType, "error", err)
 		return "", fmt.Errorf("failed to create session: %w", err)
 	}
 
@@ -1175,15 +1856,15 @@ func (ch *CoreHandler) createSessionTool(_ context.Context, userID string, args
 	if title, ok := args["title"].(string); ok && title != "" {
 		session.Title = title
 		ch.sessionHandler.UpdateSessionMetadata(session.SessionID, title, nil, "")
-		log.Log.Infof("[CoreHandler] 📝 Set session title | SessionID: %s | Title: %s", session.SessionID, title)
+		ch.logger().Info("[CoreHandler] 📝 Set session title", "session_id", session.SessionID, "title", title)
 	}
 
 	// Set as active session automatically
 	if err := ch.setActiveSessionID(userID, agentType, session.SessionID); err != nil {
-		log.Log.Warnf("[CoreHandler] ⚠️  Failed to set active session | UserID: %s | AgentType: %s | Error: %v", userID, agentType, err)
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to set active session", "user_id", userID, "agent_type", agentType, "error", err)
 	}
 
-	log.Log.Infof("[CoreHandler] ✅ Session created and set as active | SessionID: %s | AgentType: %s", session.SessionID, agentType)
+	ch.logger().Info("[CoreHandler] ✅ Session created and set as active", "session_id", session.SessionID, "agent_type", agentType)
 
 	return fmt.Sprintf("Created new session and set as active (type: %s)", agentType), nil
 }
@@ -1210,12 +1891,12 @@ func (ch *CoreHandler) changeSessionTool(_ context.Context, userID string, args
 		return "", fmt.Errorf("invalid agent_type: %s", agentTypeStr)
 	}
 
-	log.Log.Infof("[CoreHandler] 🛠️  changeSessionTool called | UserID: %s | AgentType: %s | SessionID: %s", userID, agentType, sessionID)
+	ch.logger().Info("[CoreHandler] 🛠️  changeSessionTool called", "user_id", userID, "agent_type", agentType, "session_id", sessionID)
 
 	// Verify session exists and belongs to the correct agent type
 	session, err := ch.sessionHandler.GetSession(sessionID)
 	if err != nil {
-		log.Log.Errorf("[CoreHandler] ❌ Session not found | SessionID: %s | Error: %v", sessionID, err)
+		ch.logger().Error("[CoreHandler] ❌ Session not found", "session_id", sessionID, "error", err)
 		return "", fmt.Errorf("session not found: %s", sessionID)
 	}
 
@@ -1233,22 +1914,104 @@ func (ch *CoreHandler) changeSessionTool(_ context.Context, userID string, args
 		title = "Untitled"
 	}
 
-	log.Log.Infof("[CoreHandler] ✅ Session changed | UserID: %s | AgentType: %s | SessionID: %s | Title: %s", userID, agentType, sessionID, title)
+	ch.logger().Info("[CoreHandler] ✅ Session changed", "user_id", userID, "agent_type", agentType, "session_id", sessionID, "title", title)
 
 	return fmt.Sprintf("Switched to session: %s (%s)", title, agentType), nil
 }
 
+// restartJourneyTool resets the active session of a UserAgent to the root of the knowledge tree
+func (ch *CoreHandler) restartJourneyTool(userID string, args map[string]interface{}) (string, error) {
+	agentTypeStr, _ := args["agent_type"].(string)
+	clearHistory, ok := args["clear_history"].(bool)
+	if !ok {
+		return "", fmt.Errorf("clear_history is required")
+	}
+	clearVisited, _ := args["clear_visited_nodes"].(bool)
+
+	var agentType model.AgentType
+	var agent *Engine
+	switch agentTypeStr {
+	case "high":
+		agentType, agent = model.AgentTypeHigh, ch.userAgentHigh
+	case "low":
+		agentType, agent = model.AgentTypeLow, ch.userAgentLow
+	default:
+		return "", fmt.Errorf("invalid agent_type: %s", agentTypeStr)
+	}
+	if agent == nil {
+		return "", fmt.Errorf("no %s UserAgent configured", agentType)
+	}
+
+	ch.logger().Info("[CoreHandler] 🛠️  restartJourneyTool called", "user_id", userID, "agent_type", agentType, "clear_history", clearHistory, "clear_visited", clearVisited)
+
+	sessionID := ch.getActiveSessionID(userID, agentType)
+	if sessionID == "" {
+		return fmt.Sprintf("No active %s session to restart; the next message starts at the beginning.", agentType), nil
+	}
+	if err := agent.ResetSession(sessionID, ResetOptions{ClearHistory: clearHistory, ClearVisitedNodes: clearVisited}); err != nil {
+		return "", fmt.Errorf("failed to restart session: %w", err)
+	}
+
+	history := "kept"
+	if clearHistory {
+		history = "cleared"
+	}
+	return fmt.Sprintf("Restarted session %s (%s) at the beginning; conversation history %s.", sessionID, agentType, history), nil
+}
+
+// SwitchSession makes an existing session the active one for its agent type.
+// Unlike the change_session tool, the agent type is taken from the session itself.
+func (ch *CoreHandler) SwitchSession(userID string, sessionID string) (*model.Session, error) {
+	session, err := ch.sessionHandler.GetSession(sessionID)
+	if err != nil || session == nil {
+		return nil, fmt.Errorf("session not found: %s", sessionID)
+	}
+	if session.UserID != userID {
+		return nil, fmt.Errorf("session %s does not belong to user %s", sessionID, userID)
+	}
+	if session.AgentType == model.AgentTypeCore {
+		return nil, fmt.Errorf("session %s is a core session and cannot be switched to", sessionID)
+	}
+	if err := ch.setActiveSessionID(userID, session.AgentType, sessionID); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
 // listSessionsTool returns the sessions summary
 func (ch *CoreHandler) listSessionsTool(userID string) (string, error) {
-	log.Log.Infof("[CoreHandler] 🛠️  listSessionsTool called | UserID: %s", userID)
+	ch.logger().Info("[CoreHandler] 🛠️  listSessionsTool called", "user_id", userID)
 	sessions, err := ch.sessionHandler.ListUserSessions(userID)
 	if err != nil {
 		return "", err
 	}
-	log.Log.Infof("[CoreHandler] 📋 Returning %d sessions for user %s", len(sessions), userID)
+	ch.logger().Info("[CoreHandler] 📋 Returning sessions", "user_id", userID, "count", len(sessions))
 	return ch.sessionHandler.GetSessionsPrompt(userID)
 }
 
+// findSessionsTool returns the user's sessions carrying the given tags
+func (ch *CoreHandler) findSessionsTool(userID string, args map[string]interface{}) (string, error) {
+	var tags []string
+	switch v := args["tags"].(type) {
+	case []interface{}:
+		for _, tag := range v {
+			if s, ok := tag.(string); ok {
+				tags = append(tags, s)
+			}
+		}
+	case string:
+		tags = strings.Split(v, ",")
+	}
+	matchAll, _ := args["match_all"].(bool)
+
+	prompt, err := ch.sessionHandler.GetTaggedSessionsPrompt(userID, tags, matchAll)
+	if err != nil {
+		return "", err
+	}
+	ch.logger().Info("[CoreHandler] 🔎 Sessions found by tags", "user_id", userID, "tags", tags, "match_all", matchAll)
+	return prompt, nil
+}
+
 // coreToolNoOp is a no-op used only for display-name registration; execution is in runCoreToolImpl switch
 var coreToolNoOp = func(args map[string]interface{}) (string, error) { return "", nil }
 
@@ -1257,13 +2020,32 @@ var coreToolNoOp = func(args map[string]interface{}) (string, error) { return ""
 func (ch *CoreHandler) registerCoreTools() {
 	ch.coreTools.MustRegister("call_user_agent_high", "هوش سطح بالا", coreToolNoOp)
 	ch.coreTools.MustRegister("call_user_agent_low", "هوش سطح پایین", coreToolNoOp)
+	ch.coreTools.MustRegister("call_agent", "عامل تخصصی", coreToolNoOp)
 	ch.coreTools.MustRegister("update_status", "به‌روزرسانی وضعیت", coreToolNoOp)
 	ch.coreTools.MustRegister("create_session", "ایجاد نشست", coreToolNoOp)
 	ch.coreTools.MustRegister("change_session", "تغییر نشست", coreToolNoOp)
 	ch.coreTools.MustRegister("list_sessions", "لیست نشست‌ها", coreToolNoOp)
+	ch.coreTools.MustRegister("find_sessions", "جستجوی نشست‌ها", coreToolNoOp)
+	ch.coreTools.MustRegister("restart_journey", "شروع دوباره مسیر", coreToolNoOp)
 	ch.coreTools.MustRegister("ban_user", "مسدود کاربر", coreToolNoOp)
+	ch.coreTools.MustRegister("unban_user", "رفع مسدودیت کاربر", coreToolNoOp)
 	ch.coreTools.MustRegister("web_search", "جستجوی وب", coreToolNoOp)
 	ch.coreTools.MustRegister("web_search_deepresearch", "جستجوی وب (عمیق)", coreToolNoOp)
+	ch.coreTools.MustRegister("read_file", "خواندن فایل", coreToolNoOp)
+	ch.coreTools.MustRegister("close_file", "بستن فایل", coreToolNoOp)
+	ch.coreTools.MustRegister("remember", "به خاطر سپردن", coreToolNoOp)
+	ch.coreTools.MustRegister("recall", "یادآوری", coreToolNoOp)
+	ch.coreTools.MustRegister("forget_memory", "فراموش کردن", coreToolNoOp)
+	ch.coreTools.MustRegister(SearchKnowledgeToolName, "جستجوی دانش", coreToolNoOp)
+
+	// Repeated searches within a conversation reuse the first result
+	_ = ch.coreTools.SetCacheTTL("web_search", defaultSearchCacheTTL)
+	_ = ch.coreTools.SetCacheTTL("web_search_deepresearch", defaultSearchCacheTTL)
+
+	// These read or change the user's active sessions, user record or opened files
+	for _, name := range []string{"call_user_agent_high", "call_user_agent_low", "call_agent", "create_session", "change_session", "restart_journey", "ban_user", "unban_user", "read_file", "close_file"} {
+		_ = ch.coreTools.SetSequential(name, true)
+	}
 }
 
 // GetSessionHandler returns the session handler for external access
@@ -1271,6 +2053,11 @@ func (ch *CoreHandler) GetSessionHandler() *model.SessionHandler {
 	return ch.sessionHandler
 }
 
+// Namespace returns the namespace of the handler's sessions ("" if none)
+func (ch *CoreHandler) Namespace() string {
+	return ch.sessionHandler.Namespace()
+}
+
 // GetUserAgentHigh returns the high-intelligence UserAgent
 func (ch *CoreHandler) GetUserAgentHigh() *Engine {
 	return ch.userAgentHigh
@@ -1281,12 +2068,37 @@ func (ch *CoreHandler) GetUserAgentLow() *Engine {
 	return ch.userAgentLow
 }
 
+// ToolDefinitions returns the tools of both UserAgent engines, de-duplicated by name
+// (Core's own routing tools are not included)
+func (ch *CoreHandler) ToolDefinitions() []openai.Tool {
+	var lists [][]openai.Tool
+	for _, agent := range []*Engine{ch.userAgentHigh, ch.userAgentLow} {
+		if agent != nil {
+			lists = append(lists, agent.ToolDefinitions())
+		}
+	}
+	return MergeToolDefinitions(lists...)
+}
+
 // GetCoreTools returns the function registry for Core tools (e.g. for display name resolution).
 // Do not register or replace entries from outside; Core owns this registry.
 func (ch *CoreHandler) GetCoreTools() *model.FunctionRegistry {
 	return ch.coreTools
 }
 
+// RegisterFunction adds a tool to the Core's own tools (e.g. from engine/tools). It is offered
+// to the Core model from the next message on; fails if the name is taken by a built-in Core tool.
+func (ch *CoreHandler) RegisterFunction(name string, def openai.FunctionDefinition, handler func(ctx context.Context, args map[string]any) (string, error)) error {
+	if err := ch.coreTools.RegisterContext(name, "", handler); err != nil {
+		return err
+	}
+	if err := ch.coreTools.SetDefinition(name, def); err != nil {
+		return err
+	}
+	ch.logger().Info("[CoreHandler] 🔌 Function registered", "name", name)
+	return nil
+}
+
 // getOrCreateUser gets or creates a user from the store
 func (ch *CoreHandler) getOrCreateUser(userID string) (*model.User, error) {
 	store := ch.sessionHandler.GetStore()
@@ -1339,7 +2151,7 @@ func (ch *CoreHandler) createSessionForUser(userID string, agentType model.Agent
 
 	// Save user with updated session sequence counter
 	if err := ch.saveUser(user); err != nil {
-		log.Log.Warnf("[CoreHandler] ⚠️  Failed to save user after session creation | UserID: %s | Error: %v", userID, err)
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to save user after session creation", "user_id", userID, "error", err)
 	}
 
 	return session, nil
@@ -1355,6 +2167,62 @@ func (ch *CoreHandler) getActiveSessionID(userID string, agentType model.AgentTy
 	return user.GetActiveSessionID(agentType)
 }
 
+// GetActiveSession returns the session userID is currently talking to for agentType, or nil if
+// there is none: no session was started yet, or it was deleted, archived, or doesn't belong to
+// the user and agent type. Unlike processing a message, it creates neither the user nor a session.
+func (ch *CoreHandler) GetActiveSession(userID string, agentType model.AgentType) (*model.Session, error) {
+	user, err := ch.getUser(userID)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	return ch.resolveActiveSession(user, agentType), nil
+}
+
+// GetAllActiveSessions returns the active sessions of userID by agent type (see
+// GetActiveSession); the map is empty when the user has none
+func (ch *CoreHandler) GetAllActiveSessions(userID string) (map[model.AgentType]*model.Session, error) {
+	sessions := make(map[model.AgentType]*model.Session)
+	user, err := ch.getUser(userID)
+	if err != nil || user == nil {
+		return sessions, err
+	}
+	for agentType := range user.ActiveSessionIDs {
+		if session := ch.resolveActiveSession(user, agentType); session != nil {
+			sessions[agentType] = session
+		}
+	}
+	return sessions, nil
+}
+
+// resolveActiveSession loads the active session of user for agentType, or returns nil if it is
+// unset, gone, archived or not the user's session of that agent type
+func (ch *CoreHandler) resolveActiveSession(user *model.User, agentType model.AgentType) *model.Session {
+	sessionID := user.GetActiveSessionID(agentType)
+	if sessionID == "" {
+		return nil
+	}
+	session, err := ch.sessionHandler.GetSession(sessionID)
+	if err != nil || session == nil || session.Archived {
+		return nil
+	}
+	if session.UserID != user.UserID || session.AgentType != agentType {
+		ch.logger().Warn("[CoreHandler] ⚠️  Active session belongs to another user or agent type", "user_id", user.UserID, "agent_type", agentType, "session_id", sessionID)
+		return nil
+	}
+	return session
+}
+
+// getUser returns a user from the store without creating it (nil if it doesn't exist or the
+// store has no users)
+func (ch *CoreHandler) getUser(userID string) (*model.User, error) {
+	if userStore, ok := ch.sessionHandler.GetStore().(interface {
+		GetUser(string) (*model.User, error)
+	}); ok {
+		return userStore.GetUser(userID)
+	}
+	return nil, nil
+}
+
 // setActiveSessionID sets the active session ID for a user and agent type
 // Persists to database via User model.
 // IMPORTANT: Only sets active session if the session exists in the database.
@@ -1363,8 +2231,7 @@ func (ch *CoreHandler) setActiveSessionID(userID string, agentType model.AgentTy
 	if sessionID != "" {
 		session, err := ch.sessionHandler.GetSession(sessionID)
 		if err != nil || session == nil {
-			log.Log.Warnf("[CoreHandler] ⚠️  Cannot set active session - session not found | UserID: %s | AgentType: %s | SessionID: %s",
-				userID, agentType, sessionID)
+			ch.logger().Warn("[CoreHandler] ⚠️  Cannot set active session - session not found", "user_id", userID, "agent_type", agentType, "session_id", sessionID)
 			return fmt.Errorf("session not found in database: %s", sessionID)
 		}
 	}
@@ -1382,8 +2249,7 @@ func (ch *CoreHandler) setActiveSessionID(userID string, agentType model.AgentTy
 		return fmt.Errorf("failed to save user: %w", err)
 	}
 
-	log.Log.Infof("[CoreHandler] 📌 Active session set | UserID: %s | AgentType: %s | SessionID: %s",
-		userID, agentType, sessionID)
+	ch.logger().Info("[CoreHandler] 📌 Active session set", "user_id", userID, "agent_type", agentType, "session_id", sessionID)
 	return nil
 }
 
@@ -1396,14 +2262,12 @@ func (ch *CoreHandler) getOrCreateActiveSession(userID string, agentType model.A
 	if sessionID != "" {
 		// Verify session still exists in database
 		session, err := ch.sessionHandler.GetSession(sessionID)
-		if err == nil && session != nil {
-			log.Log.Infof("[CoreHandler] 🔄 Using existing active session | UserID: %s | AgentType: %s | SessionID: %s",
-				userID, agentType, sessionID)
+		if err == nil && session != nil && !session.Archived {
+			ch.logger().Info("[CoreHandler] 🔄 Using existing active session", "user_id", userID, "agent_type", agentType, "session_id", sessionID)
 			return sessionID, nil
 		}
-		// Session was deleted, clear the reference and create new
-		log.Log.Warnf("[CoreHandler] ⚠️  Active session no longer exists, creating new | UserID: %s | AgentType: %s | OldSessionID: %s",
-			userID, agentType, sessionID)
+		// Session was deleted or archived, clear the reference and create new
+		ch.logger().Warn("[CoreHandler] ⚠️  Active session no longer exists, creating new", "user_id", userID, "agent_type", agentType, "old_session_id", sessionID)
 	}
 
 	// Create new session with proper sequential ID
@@ -1413,14 +2277,29 @@ func (ch *CoreHandler) getOrCreateActiveSession(userID string, agentType model.A
 		return "", fmt.Errorf("failed to create session: %w", err)
 	}
 
-	log.Log.Infof("[CoreHandler] ✨ Auto-created active session | UserID: %s | AgentType: %s | SessionID: %s",
-		userID, agentType, session.SessionID)
+	ch.logger().Info("[CoreHandler] ✨ Auto-created active session", "user_id", userID, "agent_type", agentType, "session_id", session.SessionID)
 	return session.SessionID, nil
 }
 
+// recordModerationEvent adds an event to the moderation audit trail if the store keeps one
+func (ch *CoreHandler) recordModerationEvent(event *model.ModerationEvent) {
+	recordModerationEvent(ch.sessionHandler.GetStore(), event)
+}
+
+// UnbanUser lifts a user's ban and resets their nonsense strikes (admin action).
+// The unban is recorded in the moderation history with the given reason.
+func (ch *CoreHandler) UnbanUser(userID string, reason string) error {
+	return unbanUser(ch.sessionHandler.GetStore(), userID, model.ModerationActorAdmin, "", reason)
+}
+
+// unbanUser lifts the current user's ban on behalf of actor (see model.ModerationActor*)
+func (ch *CoreHandler) unbanUser(ctx context.Context, userID, actor, reason string) error {
+	return unbanUser(ch.sessionHandler.GetStore(), userID, actor, moderationMessageID(ctx), reason)
+}
+
 // banUserTool bans the current user for a specified duration
 // userID is passed directly from executeCoreTool (from the current conversation context)
-func (ch *CoreHandler) banUserTool(_ context.Context, userID string, args map[string]interface{}) (string, error) {
+func (ch *CoreHandler) banUserTool(ctx context.Context, userID string, args map[string]interface{}) (string, error) {
 	if userID == "" {
 		return "", fmt.Errorf("user_id is required but not available in context")
 	}
@@ -1430,20 +2309,23 @@ func (ch *CoreHandler) banUserTool(_ context.Context, userID string, args map[st
 		return "", fmt.Errorf("duration_hours is required and must be a number")
 	}
 
+	user, err := ch.getOrCreateUser(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return "", fmt.Errorf("store does not support user management")
+	}
+
 	message, _ := args["message"].(string)
 	if message == "" {
 		if durationHours == 0 {
-			message = "You have been permanently restricted."
+			message = ch.config.Moderation.render(ModerationMessagePermanentBan, 0, user.Language)
 		} else {
-			message = fmt.Sprintf("You have been restricted for %.0f hours.", durationHours)
+			message = ch.config.Moderation.render(ModerationMessageTemporaryBan, durationHours, user.Language)
 		}
 	}
 
-	user, err := ch.getOrCreateUser(userID)
-	if err != nil {
-		return "", fmt.Errorf("failed to get user: %w", err)
-	}
-
 	var banDuration time.Duration
 	if durationHours > 0 {
 		banDuration = time.Duration(durationHours) * time.Hour
@@ -1454,7 +2336,14 @@ func (ch *CoreHandler) banUserTool(_ context.Context, userID string, args map[st
 		return "", fmt.Errorf("failed to save user ban: %w", err)
 	}
 
-	log.Log.Infof("[CoreHandler] 🚫 User banned | UserID: %s | Duration: %v", userID, banDuration)
+	event := model.NewModerationEvent(userID, model.ModerationEventBan, model.ModerationActorCore)
+	event.MessageID = moderationMessageID(ctx)
+	event.Reason = message
+	event.Duration = banDuration
+	event.NonsenseCount = user.NonsenseCount
+	ch.recordModerationEvent(event)
+
+	ch.logger().Info("[CoreHandler] 🚫 User banned", "user_id", userID, "duration", banDuration)
 	return fmt.Sprintf("User %s has been banned. Duration: %v", userID, banDuration), nil
 }
 
@@ -1466,30 +2355,37 @@ func (ch *CoreHandler) webSearchWithModelTool(ctx context.Context, userID string
 	}
 	result, err := PerformWebSearchWithModel(ctx, ch.llmClient, ch.llmConfig, query, userID, searchModel)
 	if err != nil {
-		log.Log.Errorf("[CoreHandler] ❌ Web search failed | UserID: %s | Query: %s | Error: %v", userID, query, err)
+		ch.logger().Error("[CoreHandler] ❌ Web search failed", "user_id", userID, "query", query, "error", err)
 		return "", fmt.Errorf("web search failed: %w", err)
 	}
-	log.Log.Infof("[CoreHandler] ✅ Web search completed | UserID: %s | Query: %s | Result length: %d chars", userID, query, len(result))
-	if result != "" {
-		initialMessage := FormatWebSearchInitialMessage(result, 0)
+	maxCitations := ch.config.WebSearchMaxCitations
+	if maxCitations == 0 {
+		maxCitations = defaultWebSearchMaxCitations
+	}
+	result.limitCitations(maxCitations)
+	reportToolSources(ctx, result.Citations)
+
+	ch.logger().Info("[CoreHandler] ✅ Web search completed", "user_id", userID, "query", query, "result_len", len(result.Answer), "citations", len(result.Citations))
+	if result.Answer != "" {
+		initialMessage := FormatWebSearchInitialMessage(result.Answer, 0)
 		notifyStatus(ctx, userID, "", StatusCustom, initialMessage, OptSendAsNewMessage())
 	}
-	return result, nil
+	return result.ToolContent(), nil
 }
 
 // saveCoreMessage saves a message from CoreHandler to the database
-// Returns the messageID of the saved message
+// Returns the messageID of the saved message and the store error when saving failed
 func (ch *CoreHandler) saveCoreMessage(
 	userID string,
 	request openai.ChatCompletionRequest,
 	response openai.ChatCompletionResponse,
 	choice openai.ChatCompletionChoice,
-) string {
+) (string, error) {
 	// Get Core session to get sessionID
 	coreSession, err := ch.getOrCreateCoreSession(userID)
 	if err != nil {
-		log.Log.Warnf("[CoreHandler] ⚠️  Failed to get core session for message save | UserID: %s | Error: %v", userID, err)
-		return ""
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to get core session for message save", "user_id", userID, "error", err)
+		return "", nil
 	}
 
 	// Get message content
@@ -1514,27 +2410,28 @@ func (ch *CoreHandler) saveCoreMessage(
 		choice,
 	)
 
-	ch.saveMessage(msg)
-	return msg.MessageID
+	return msg.MessageID, ch.saveMessage(msg)
 }
 
-// saveMessage saves a message to the database
-func (ch *CoreHandler) saveMessage(msg *model.Message) {
+// saveMessage saves a message to the database and returns the (logged) store error
+func (ch *CoreHandler) saveMessage(msg *model.Message) error {
+	msg.Content = limitStoredContent(msg.Content, ch.config.MaxStoredContentBytes, "CoreHandler", "message "+msg.MessageID)
 	store := ch.sessionHandler.GetStore()
 	if sqliteStore, ok := store.(interface {
 		PutMessage(*model.Message) error
 	}); ok {
 		if err := sqliteStore.PutMessage(msg); err != nil {
-			log.Log.Warnf("[CoreHandler] ⚠️  Failed to save message | MessageID: %s | Error: %v", msg.MessageID, err)
-		} else {
-			log.Log.Infof("[CoreHandler] 💾 Message saved | MessageID: %s | Model: %s | Tokens: %d", msg.MessageID, msg.Model, msg.TotalTokens)
+			ch.logger().Warn("[CoreHandler] ⚠️  Failed to save message", "message_id", msg.MessageID, "error", err)
+			return err
 		}
+		ch.logger().Info("[CoreHandler] 💾 Message saved", "message_id", msg.MessageID, "model", msg.Model, "tokens", msg.TotalTokens)
 	}
+	return nil
 }
 
 // getToolCallPersister returns a ToolCallPersister for the session store.
 func (ch *CoreHandler) getToolCallPersister() *ToolCallPersister {
-	return NewToolCallPersister(ch.sessionHandler.GetStore(), "CoreHandler")
+	return NewToolCallPersister(ch.sessionHandler.GetStore(), "CoreHandler").withMaxContentBytes(ch.config.MaxStoredContentBytes)
 }
 
 // ============================================================================
@@ -1552,11 +2449,12 @@ func (ch *CoreHandler) UseVisionLLMConfig(config LLMConfig) error {
 	if config.HTTPClient != nil {
 		openaiConfig.HTTPClient = config.HTTPClient
 	}
+	openaiConfig = withPromptCaching(openaiConfig, config)
 
 	ch.visionLLMClient = openai.NewClientWithConfig(openaiConfig)
 	ch.visionLLMConfig = &config
 
-	log.Log.Infof("[CoreHandler] ✅ Vision LLM configured | Model: %s | BaseURL: %s", config.Model, config.BaseURL)
+	ch.logger().Info("[CoreHandler] ✅ Vision LLM configured", "model", config.Model, "base_url", config.BaseURL)
 	return nil
 }
 
@@ -1564,12 +2462,33 @@ func (ch *CoreHandler) UseVisionLLMConfig(config LLMConfig) error {
 // It uses the Vision LLM (if configured) or falls back to the main LLM
 // The image is processed directly by the LLM, not sent to UserAgents
 // Uses per-user mutex to ensure only one message is processed at a time per user
+// The image type is detected from imageData (imageMimeType is only a hint); types outside
+// AllowedImageTypes are rejected with ErrUnsupportedImageType
 func (ch *CoreHandler) ProcessMessageWithImage(
 	ctx context.Context,
 	userID string,
 	userMessage string,
 	imageData []byte,
 	imageMimeType string,
+) (string, error) {
+	if err := ch.beginMessage(); err != nil {
+		return "", err
+	}
+	defer ch.inFlight.Done()
+
+	start := time.Now()
+	response, err := ch.processImageMessage(withStatusMessages(ctx, ch.statusMessages), userID, userMessage, imageData, imageMimeType)
+	ch.recordMessageProcessed(ctx, userID, model.ContentTypeImage, start, err)
+	return response, err
+}
+
+// processImageMessage does the image message flow of ProcessMessageWithImage
+func (ch *CoreHandler) processImageMessage(
+	ctx context.Context,
+	userID string,
+	userMessage string,
+	imageData []byte,
+	imageMimeType string,
 ) (string, error) {
 	// Acquire per-user mutex to serialize message processing
 	// This prevents race conditions on session creation and sequence number generation
@@ -1577,8 +2496,14 @@ func (ch *CoreHandler) ProcessMessageWithImage(
 	userMu.Lock()
 	defer userMu.Unlock()
 
-	log.Log.Infof("[CoreHandler] 🖼️  Processing image message | UserID: %s | Message length: %d chars | Image size: %d bytes | MimeType: %s",
-		userID, len(userMessage), len(imageData), imageMimeType)
+	ctx = withStatusMessages(ctx, ch.statusMessagesFor(ch.userLanguage(userID, userMessage)))
+	ch.logger().Info("[CoreHandler] 🖼️  Processing image message", "user_id", userID, "message_len", len(userMessage), "image_bytes", len(imageData), "mime_type", imageMimeType)
+
+	// The declared MIME type is only a hint: the data URL uses the type detected from the bytes
+	imageMimeType, err := detectImageType(imageData, imageMimeType, ch.config.AllowedImageTypes)
+	if err != nil {
+		return "", err
+	}
 
 	// Check if database is ready
 	if !ch.userAgentHigh.IsDBReady() || !ch.userAgentLow.IsDBReady() {
@@ -1594,7 +2519,7 @@ func (ch *CoreHandler) ProcessMessageWithImage(
 
 	// Fall back to main LLM if Vision LLM not configured
 	if llmClient == nil {
-		log.Log.Warnf("[CoreHandler] ⚠️  Vision LLM not configured, falling back to main LLM")
+		ch.logger().Warn("[CoreHandler] ⚠️  Vision LLM not configured, falling back to main LLM")
 		llmClient = ch.llmClient
 		llmModel = ch.llmConfig.Model
 	}
@@ -1620,6 +2545,24 @@ func (ch *CoreHandler) ProcessMessageWithImage(
 		return "", fmt.Errorf("failed to get or create core session: %w", err)
 	}
 
+	// Add to session (store text representation for history)
+	// Use a user-friendly message instead of technical MIME type
+	historyContent := userMessage
+	if historyContent == "" {
+		historyContent = "(User sent an image)"
+	} else {
+		historyContent = fmt.Sprintf("(User sent an image) %s", userMessage)
+	}
+
+	// Moderate the caption like a text message (an image without one is not checked)
+	imageMsgID, imageSeqID := coreSession.GenerateMessageIDWithSeq()
+	ctx = withModerationMessageID(ctx, imageMsgID)
+	if strings.TrimSpace(userMessage) != "" {
+		if reply, blocked := ch.moderateUserMessage(ctx, userID, coreSession, imageMsgID, imageSeqID, userMessage, historyContent, model.ContentTypeImage); blocked {
+			return reply, nil
+		}
+	}
+
 	// Build base64 data URL for image
 	base64Image := base64.StdEncoding.EncodeToString(imageData)
 	dataURL := fmt.Sprintf("data:%s;base64,%s", imageMimeType, base64Image)
@@ -1642,14 +2585,6 @@ func (ch *CoreHandler) ProcessMessageWithImage(
 		},
 	}
 
-	// Add to session (store text representation for history)
-	// Use a user-friendly message instead of technical MIME type
-	historyContent := userMessage
-	if historyContent == "" {
-		historyContent = "(User sent an image)"
-	} else {
-		historyContent = fmt.Sprintf("(User sent an image) %s", userMessage)
-	}
 	coreSession.Msgs = append(
 		coreSession.Msgs,
 		openai.ChatCompletionMessage{
@@ -1657,21 +2592,22 @@ func (ch *CoreHandler) ProcessMessageWithImage(
 			Content: historyContent,
 		},
 	)
+	coreSession.Msgs = trimActiveMessages(coreSession, coreSession.Msgs, ch.config.MaxActiveMessages, ch.config.MaxActiveTokens)
 
 	// Update session model to vision model for proper tracking
 	coreSession.Model = llmModel
 
 	// Save user message to database
 	// Note: User messages don't have a model - the model field stays empty for user messages
-	imageMsgID, imageSeqID := coreSession.GenerateMessageIDWithSeq()
 	userMsgRecord := model.NewUserMessage(imageMsgID, imageSeqID, userID, coreSession.SessionID, historyContent, model.ContentTypeImage)
 	ch.saveMessage(userMsgRecord)
 
 	// Build system prompts (simplified for vision - no tools needed)
-	systemPrompts, err := ch.buildSystemPrompts(userID)
+	systemPrompts, stable, err := ch.buildSystemPrompts(userID)
 	if err != nil {
 		return "", fmt.Errorf("failed to build system prompts: %w", err)
 	}
+	ctx = withPromptCachePrefix(ctx, systemPrompts[:stable])
 
 	// Build messages for LLM call
 	messages := []openai.ChatCompletionMessage{}
@@ -1687,7 +2623,7 @@ func (ch *CoreHandler) ProcessMessageWithImage(
 	// Add conversation history (without the current message)
 	historyMsgs := coreSession.Msgs
 	if len(historyMsgs) > 1 {
-		messages = append(messages, historyMsgs[:len(historyMsgs)-1]...)
+		messages = append(messages, dropOrphanToolMessages(historyMsgs[:len(historyMsgs)-1], "CoreHandler")...)
 	}
 
 	// Add the multimodal message (with actual image)
@@ -1696,18 +2632,29 @@ func (ch *CoreHandler) ProcessMessageWithImage(
 	// Add user_id to context
 	ctx = model.WithUserID(ctx, userID)
 
-	// Make LLM call (no tools for vision messages - direct response)
-	log.Log.Infof("[CoreHandler] 🔵 VISION LLM >> Model: %s | Messages: %d | Image included", llmModel, len(messages))
+	// BeforeAction: check quota/credit before the vision call (block without consuming tokens)
+	if cbErr := checkLLMBudget(ctx, ch.Callback, ch.quota, userID, coreSession.SessionID, llmModel, messages, nil); cbErr != nil {
+		return blockedLLMMessage(ch.llmConfig.QuotaExceededMessage, cbErr), nil
+	}
+
+	// Make LLM call (no tools for vision messages - direct response).
+	// Goes through the backup chain like text calls; only vision-capable backups are tried.
+	ch.logger().Info("[CoreHandler] 🔵 VISION LLM >> Image included", "model", llmModel, "messages", len(messages))
 
 	request := openai.ChatCompletionRequest{
 		Model:    llmModel,
 		Messages: messages,
 	}
 
-	resp, err := llmClient.CreateChatCompletion(ctx, request)
+	llmStart := time.Now()
+	resp, err := ch.callLLMWithClient(ctx, llmClient, llmModel, messages, nil)
+	llmDuration := time.Since(llmStart)
 	if err != nil {
-		log.Log.Errorf("[CoreHandler] ❌ Vision LLM call failed | Error: %v", err)
-		return "", fmt.Errorf("vision LLM call failed: %w", err)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		ch.logger().Error("[CoreHandler] ❌ Vision LLM call failed", "error", err)
+		return "", fmt.Errorf("vision LLM call failed: %w", formatLLMError(err))
 	}
 
 	if len(resp.Choices) == 0 {
@@ -1715,12 +2662,24 @@ func (ch *CoreHandler) ProcessMessageWithImage(
 	}
 
 	response := resp.Choices[0].Message.Content
+	coreSession.AddTokenUsage(resp.Usage)
 
-	// Log token usage
-	if resp.Usage.TotalTokens > 0 {
-		log.Log.Infof("[CoreHandler] 📊 VISION TOKEN USAGE >> Model: %s | prompt=%d | completion=%d | total=%d",
-			llmModel, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
+	// Record usage
+	ev := &UsageEvent{
+		UserID:       userID,
+		SessionID:    coreSession.SessionID,
+		EventType:    EventLLMCall,
+		Name:         EventNameLLMCall,
+		Tokens:       resp.Usage.TotalTokens,
+		InputTokens:  resp.Usage.PromptTokens,
+		OutputTokens: resp.Usage.CompletionTokens,
+		Model:        llmModel,
+		Duration:     llmDuration,
+	}
+	if resp.Usage.PromptTokensDetails != nil {
+		ev.CachedInputTokens = resp.Usage.PromptTokensDetails.CachedTokens
 	}
+	recordLLMUsage(ctx, ch.Callback, ch.config.CostTable, ch.sessionHandler.GetStore(), ev)
 
 	// Add assistant response to session
 	coreSession.Msgs = append(
@@ -1754,7 +2713,7 @@ func (ch *CoreHandler) ProcessMessageWithImage(
 	)
 	ch.saveMessage(assistantMsg)
 
-	log.Log.Infof("[CoreHandler] ✅ Image message processed | UserID: %s | Response length: %d chars | Model: %s", userID, len(response), llmModel)
+	ch.logger().Info("[CoreHandler] ✅ Image message processed", "user_id", userID, "response_len", len(response), "model", llmModel)
 
 	return response, nil
 }
@@ -0,0 +1,1508 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+// TestTrimHistoryWindow_NeverOrphansToolResult verifies that the history window
+// never starts with a tool result whose assistant tool call was cut off.
+func TestTrimHistoryWindow_NeverOrphansToolResult(t *testing.T) {
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "hi"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "c1"}, {ID: "c2"}}},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "c1", Content: "r1"},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "c2", Content: "r2"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "done"},
+		{Role: openai.ChatMessageRoleUser, Content: "next"},
+	}
+
+	for window := 1; window <= len(msgs)+1; window++ {
+		got := trimHistoryWindow(msgs, window)
+		if len(got) > window {
+			t.Fatalf("window %d: got %d messages", window, len(got))
+		}
+		if len(got) > 0 && got[0].Role == openai.ChatMessageRoleTool {
+			t.Fatalf("window %d: history starts with orphaned tool result %q", window, got[0].ToolCallID)
+		}
+		for i, m := range got {
+			if m.Role != openai.ChatMessageRoleTool {
+				continue
+			}
+			found := false
+			for j := i - 1; j >= 0 && !found; j-- {
+				for _, tc := range got[j].ToolCalls {
+					if tc.ID == m.ToolCallID {
+						found = true
+						break
+					}
+				}
+			}
+			if !found {
+				t.Fatalf("window %d: tool result %q has no matching tool call", window, m.ToolCallID)
+			}
+		}
+	}
+}
+
+// TestTrimHistoryWindow_KeepsSystemMessages verifies that system messages are kept in place
+// whether or not the window trims the history.
+func TestTrimHistoryWindow_KeepsSystemMessages(t *testing.T) {
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: historyTrimmedNote},
+		{Role: openai.ChatMessageRoleUser, Content: "a"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "b"},
+		{Role: openai.ChatMessageRoleSystem, Content: "The user switched sessions."},
+		{Role: openai.ChatMessageRoleUser, Content: "c"},
+	}
+	got := trimHistoryWindow(msgs, 1)
+	if len(got) != 3 || !isHistoryTrimmedNote(got[0]) || got[1].Role != openai.ChatMessageRoleSystem || got[2].Content != "c" {
+		t.Fatalf("Expected [note, system, c], got %+v", got)
+	}
+	if got := trimHistoryWindow(msgs, 3); len(got) != len(msgs) {
+		t.Fatalf("Expected every message within the window, got %+v", got)
+	}
+}
+
+// TestTrimHistoryWindow_Disabled verifies that a zero window keeps the full history.
+func TestTrimHistoryWindow_Disabled(t *testing.T) {
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "a"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "b"},
+	}
+	if got := trimHistoryWindow(msgs, 0); len(got) != len(msgs) {
+		t.Fatalf("expected %d messages, got %d", len(msgs), len(got))
+	}
+}
+
+// TestCoreHandlerReadFile verifies read_file returns truncated content and records an opened
+// file, close_file closes it, and paths leaving the knowledge root are rejected.
+func TestCoreHandlerReadFile(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "knowledge")
+	os.MkdirAll(filepath.Join(dir, "root", "billing"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "billing", "node.md"), []byte("# Billing\n"+strings.Repeat("refunds ", 20)), 0644)
+	os.WriteFile(filepath.Join(base, "secret.txt"), []byte("top secret"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	config := DefaultCoreHandlerConfig()
+	config.ReadFileMaxLength = 50
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	coreSession, err := ch.getOrCreateCoreSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create core session: %v", err)
+	}
+	call := func(name, args string) (string, error) {
+		return ch.runCoreToolImpl(context.Background(), "user1", coreSession.SessionID, openai.ToolCall{
+			Function: openai.FunctionCall{Name: name, Arguments: args},
+		})
+	}
+
+	for _, p := range []string{"../secret.txt", "root/../../secret.txt", filepath.Join(base, "secret.txt")} {
+		if _, err := call("read_file", `{"file_path": "`+filepath.ToSlash(p)+`"}`); !errors.Is(err, fsrepo.ErrPathEscapesRoot) {
+			t.Errorf("Expected %q to be rejected, got %v", p, err)
+		}
+	}
+
+	content, err := call("read_file", `{"file_path": "root/billing/node.md"}`)
+	if err != nil {
+		t.Fatalf("read_file failed: %v", err)
+	}
+	if !strings.HasPrefix(content, "# Billing") || !strings.Contains(content, "[truncated, 50 of") {
+		t.Fatalf("Unexpected read_file content: %q", content)
+	}
+	call("read_file", `{"file_path": "root/billing/node.md"}`)
+	files, _ := sqliteStore.GetCurrentlyOpenedFilesBySession(coreSession.SessionID)
+	if len(files) != 1 || files[0].FilePath != "root/billing/node.md" {
+		t.Fatalf("Expected one opened file record, got %+v", files)
+	}
+
+	if _, err := call("close_file", `{"file_path": "root/billing/node.md"}`); err != nil {
+		t.Fatalf("close_file failed: %v", err)
+	}
+	if files, _ := sqliteStore.GetCurrentlyOpenedFilesBySession(coreSession.SessionID); len(files) != 0 {
+		t.Fatalf("Expected no open files after close_file, got %+v", files)
+	}
+	if _, err := call("close_file", `{"file_path": "root/billing/node.md"}`); err == nil {
+		t.Fatal("Expected closing a file that is not open to fail")
+	}
+}
+
+// TestCoreHandlerReadFileRespectsNodeAuth verifies read_file refuses the files of a node the
+// user cannot read, including files in its subdirectories and files that do not exist
+func TestCoreHandlerReadFileRespectsNodeAuth(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root", "hr", "docs"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "notes.txt"), []byte("public notes"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "hr", "node.md"), []byte("# HR"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "hr", "node.yaml"), []byte(`id: "hr"
+auth:
+  users:
+    - user_id: "alice"
+      can_read: false
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "hr", "docs", "salaries.csv"), []byte("alice,100"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	call := func(userID, filePath string) (string, error) {
+		coreSession, err := ch.getOrCreateCoreSession(userID)
+		if err != nil {
+			t.Fatalf("Failed to create core session: %v", err)
+		}
+		return ch.runCoreToolImpl(context.Background(), userID, coreSession.SessionID, openai.ToolCall{
+			Function: openai.FunctionCall{Name: "read_file", Arguments: `{"file_path": "` + filePath + `"}`},
+		})
+	}
+
+	for _, p := range []string{"root/hr/node.md", "root/hr/docs/salaries.csv", "root/hr/missing.txt"} {
+		if content, err := call("alice", p); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("Expected %s to be refused to alice, got %q (%v)", p, content, err)
+		}
+	}
+	if content, err := call("alice", "root/notes.txt"); err != nil || content != "public notes" {
+		t.Errorf("Expected alice to read root/notes.txt, got %q (%v)", content, err)
+	}
+	if content, err := call("bob", "root/hr/docs/salaries.csv"); err != nil || content != "alice,100" {
+		t.Errorf("Expected bob to read the HR file, got %q (%v)", content, err)
+	}
+}
+
+// TestCoreHandlerFindSessions verifies find_sessions lists the user's sessions carrying the tags
+func TestCoreHandlerFindSessions(t *testing.T) {
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	for i, title := range []string{"Berlin", "Paris"} {
+		session := model.NewSessionWithType("user1", model.AgentTypeHigh)
+		session.SessionID = fmt.Sprintf("user1-high-s%04d", i+1)
+		session.Title = title + " trip"
+		session.Tags = []string{"travel", strings.ToLower(title)}
+		if err := sqliteStore.Put(session); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	agent := &Engine{Sessions: sqliteStore}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	call := func(args string) (string, error) {
+		return ch.runCoreToolImpl(context.Background(), "user1", "", openai.ToolCall{
+			Function: openai.FunctionCall{Name: "find_sessions", Arguments: args},
+		})
+	}
+
+	result, err := call(`{"tags": ["Berlin"]}`)
+	if err != nil {
+		t.Fatalf("find_sessions failed: %v", err)
+	}
+	if !strings.Contains(result, "user1-high-s0001") || strings.Contains(result, "user1-high-s0002") {
+		t.Errorf("Expected only the Berlin session, got:\n%s", result)
+	}
+	if result, _ = call(`{"tags": ["travel", "paris"], "match_all": true}`); !strings.Contains(result, "Paris trip") || strings.Contains(result, "Berlin trip") {
+		t.Errorf("Expected only the Paris session with match_all, got:\n%s", result)
+	}
+	if result, _ = call(`{"tags": ["rome"]}`); !strings.Contains(result, "No sessions tagged rome") {
+		t.Errorf("Expected no sessions for an unknown tag, got:\n%s", result)
+	}
+	if _, err := call(`{"tags": []}`); err == nil {
+		t.Error("Expected find_sessions without tags to fail")
+	}
+}
+
+// TestCoreHandlerMemory verifies remember stores facts per user and recall returns the most
+// similar ones first, limited to TopK, and that the tools are only offered when enabled.
+func TestCoreHandlerMemory(t *testing.T) {
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	agent := &Engine{Sessions: sqliteStore}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	hasTool := func(name string) bool {
+		for _, tool := range ch.getCoreToolsForLLM() {
+			if tool.Function.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+	if hasTool("remember") || hasTool("recall") {
+		t.Fatal("Expected no memory tools before EnableMemory")
+	}
+	if err := ch.EnableMemory(&keywordEmbedder{}, MemoryConfig{TopK: 2}); err != nil {
+		t.Fatalf("EnableMemory failed: %v", err)
+	}
+	if !hasTool("remember") || !hasTool("recall") {
+		t.Fatal("Expected the memory tools once memory is enabled")
+	}
+
+	call := func(userID, name, args string) string {
+		t.Helper()
+		result, err := ch.runCoreToolImpl(context.Background(), userID, "", openai.ToolCall{
+			Function: openai.FunctionCall{Name: name, Arguments: args},
+		})
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		return result
+	}
+	call("user1", "remember", `{"fact": "The user wants refunds paid back to their card"}`)
+	call("user1", "remember", `{"fact": "The user reported a bug in the invoice export"}`)
+	call("user1", "remember", `{"fact": "The user asked for the price list in EUR, and about the refund price"}`)
+	call("user2", "remember", `{"fact": "The user wants a refund for order 42"}`)
+
+	result := call("user1", "recall", `{"query": "refund preference"}`)
+	lines := strings.Split(strings.TrimSpace(result), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and TopK=2 memories, got %q", result)
+	}
+	if !strings.Contains(lines[1], "refunds paid back to their card") || !strings.Contains(lines[2], "price list in EUR") {
+		t.Errorf("Expected the refund memories, most similar first, got %q", result)
+	}
+	if strings.Contains(result, "order 42") {
+		t.Errorf("Recall returned another user's memory: %q", result)
+	}
+	if result := call("user3", "recall", `{"query": "refund"}`); !strings.Contains(result, "No memories") {
+		t.Errorf("Expected no memories for a new user, got %q", result)
+	}
+
+	// Memories survive across sessions but go with the user's data
+	if err := sqliteStore.DeleteUserData("user1"); err != nil {
+		t.Fatalf("DeleteUserData failed: %v", err)
+	}
+	if result := call("user1", "recall", `{"query": "refund"}`); !strings.Contains(result, "No memories") {
+		t.Errorf("Expected no memories after DeleteUserData, got %q", result)
+	}
+}
+
+// TestCoreHandlerMemoryFacts verifies facts are extracted every ExtractEvery messages, shown in
+// the Core's system prompt, capped per user with LRU eviction and deleted by forget_memory.
+func TestCoreHandlerMemoryFacts(t *testing.T) {
+	var mu sync.Mutex
+	var lastPrompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		answer := "ok"
+		if req.Messages[0].Content == memoryExtractionPrompt {
+			answer = `{"facts": [
+				{"key": "Preferred Tone", "value": "The user prefers a formal tone", "confidence": 0.9},
+				{"key": "company", "value": "The user works at Acme", "confidence": 0.8},
+				{"key": "mood", "value": "The user is tired", "confidence": 0.2}
+			]}`
+		} else {
+			var prompts []string
+			for _, msg := range req.Messages {
+				if msg.Role == openai.ChatMessageRoleSystem {
+					prompts = append(prompts, msg.Content)
+				}
+			}
+			mu.Lock()
+			lastPrompt = strings.Join(prompts, "\n")
+			mu.Unlock()
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	if err := ch.EnableMemory(&keywordEmbedder{}, MemoryConfig{ExtractEvery: 2, MaxPerUser: 3}); err != nil {
+		t.Fatalf("EnableMemory failed: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, text := range []string{"Good day. I work at Acme.", "Please keep it formal."} {
+		if _, err := ch.ProcessMessage(ctx, "user1", text); err != nil {
+			t.Fatalf("ProcessMessage failed: %v", err)
+		}
+	}
+	ch.inFlight.Wait() // the extraction runs in the background
+
+	memories, err := sqliteStore.GetMemoriesByUser("user1")
+	if err != nil {
+		t.Fatalf("GetMemoriesByUser failed: %v", err)
+	}
+	if len(memories) != 2 {
+		t.Fatalf("Expected 2 facts (the unsure one dropped), got %d", len(memories))
+	}
+	coreSession, _ := ch.getOrCreateCoreSession("user1")
+	for _, memory := range memories {
+		if memory.SessionID != coreSession.SessionID || memory.Confidence < 0.5 || memory.Key == "" {
+			t.Errorf("Unexpected fact: %+v", memory)
+		}
+	}
+
+	if _, err := ch.ProcessMessage(ctx, "user1", "Hello again"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	mu.Lock()
+	prompt := lastPrompt
+	mu.Unlock()
+	if !strings.Contains(prompt, "preferred_tone: The user prefers a formal tone") || !strings.Contains(prompt, "company: The user works at Acme") {
+		t.Errorf("Expected the facts in the Core prompt, got:\n%s", prompt)
+	}
+
+	// Beyond MaxPerUser the least recently used fact goes
+	if err := sqliteStore.TouchMemories("user1", []string{"user1-memory-preferred_tone"}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("TouchMemories failed: %v", err)
+	}
+	call := func(name, args string) string {
+		t.Helper()
+		result, err := ch.runCoreToolImpl(ctx, "user1", "", openai.ToolCall{Function: openai.FunctionCall{Name: name, Arguments: args}})
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		return result
+	}
+	call("remember", `{"fact": "The user has two cats"}`)
+	call("remember", `{"fact": "The user lives in Berlin"}`)
+	memories, _ = sqliteStore.GetMemoriesByUser("user1")
+	if len(memories) != 3 {
+		t.Fatalf("Expected MaxPerUser=3 memories, got %d", len(memories))
+	}
+	for _, memory := range memories {
+		if memory.Key == "company" {
+			t.Errorf("Expected the least recently used fact to be evicted, got %+v", memory)
+		}
+	}
+
+	if result := call("forget_memory", `{"memory": "Preferred tone"}`); !strings.Contains(result, "Forgot 1 memories") {
+		t.Errorf("Expected the tone fact forgotten, got %q", result)
+	}
+	if result := call("forget_memory", `{"memory": "berlin"}`); !strings.Contains(result, "lives in Berlin") {
+		t.Errorf("Expected the Berlin memory forgotten by its text, got %q", result)
+	}
+	if result := call("forget_memory", `{"memory": "salary"}`); !strings.Contains(result, "Nothing remembered") {
+		t.Errorf("Expected nothing to forget, got %q", result)
+	}
+	if memories, _ = sqliteStore.GetMemoriesByUser("user1"); len(memories) != 1 || memories[0].Text != "The user has two cats" {
+		t.Errorf("Expected only the cats memory left, got %d", len(memories))
+	}
+}
+
+// TestCoreHandlerGetActiveSession verifies active sessions are resolved per agent type, and
+// missing, archived or mismatched ones come back as nil without creating anything.
+func TestCoreHandlerGetActiveSession(t *testing.T) {
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Sessions: sqliteStore}
+	sh := model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig())
+	ch := NewCoreHandler(sh, agent, agent, DefaultCoreHandlerConfig())
+
+	session, err := ch.GetActiveSession("user1", model.AgentTypeHigh)
+	if err != nil || session != nil {
+		t.Fatalf("Expected no session for an unknown user, got %v (%v)", session, err)
+	}
+	if sessions, err := ch.GetAllActiveSessions("user1"); err != nil || len(sessions) != 0 {
+		t.Fatalf("Expected no sessions for an unknown user, got %v (%v)", sessions, err)
+	}
+	if user, _ := sqliteStore.GetUser("user1"); user != nil {
+		t.Fatal("Expected the lookup not to create the user")
+	}
+
+	high, err := ch.createSessionForUser("user1", model.AgentTypeHigh)
+	if err != nil {
+		t.Fatalf("createSessionForUser failed: %v", err)
+	}
+	low, err := ch.createSessionForUser("user1", model.AgentTypeLow)
+	if err != nil {
+		t.Fatalf("createSessionForUser failed: %v", err)
+	}
+	other, err := ch.createSessionForUser("user2", model.AgentTypeCore)
+	if err != nil {
+		t.Fatalf("createSessionForUser failed: %v", err)
+	}
+	if session, err := ch.GetActiveSession("user1", model.AgentTypeHigh); err != nil || session == nil || session.SessionID != high.SessionID {
+		t.Fatalf("Expected the high session %s, got %v (%v)", high.SessionID, session, err)
+	}
+	if session, _ := ch.GetActiveSession("user1", model.AgentTypeCore); session != nil {
+		t.Errorf("Expected no core session, got %s", session.SessionID)
+	}
+
+	// Archived sessions and sessions of another user are not active
+	if err := sh.ArchiveSession(low.SessionID); err != nil {
+		t.Fatalf("ArchiveSession failed: %v", err)
+	}
+	user, _ := sqliteStore.GetUser("user1")
+	user.SetActiveSessionID(model.AgentTypeCore, other.SessionID)
+	if err := sqliteStore.PutUser(user); err != nil {
+		t.Fatalf("PutUser failed: %v", err)
+	}
+	sessions, err := ch.GetAllActiveSessions("user1")
+	if err != nil {
+		t.Fatalf("GetAllActiveSessions failed: %v", err)
+	}
+	if len(sessions) != 1 || sessions[model.AgentTypeHigh] == nil || sessions[model.AgentTypeHigh].SessionID != high.SessionID {
+		t.Errorf("Expected only the high session, got %v", sessions)
+	}
+}
+
+// TestCoreHandlerLogger verifies CoreHandlerConfig.Logger receives the Core's logs and is
+// passed on to UserAgents that set no logger, with redaction hashing the user ID.
+func TestCoreHandlerLogger(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	var buf bytes.Buffer
+	logger := log.New(slog.NewJSONHandler(&buf, nil))
+	logger.SetRedaction(true)
+	config := DefaultCoreHandlerConfig()
+	config.Logger = logger
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	if agent.Logger != logger {
+		t.Fatal("Expected the UserAgent to inherit the Core's logger")
+	}
+	if err := ch.EnableMemory(&keywordEmbedder{}, MemoryConfig{}); err != nil {
+		t.Fatalf("EnableMemory failed: %v", err)
+	}
+
+	if _, err := ch.runCoreToolImpl(context.Background(), "alice", "", openai.ToolCall{
+		Function: openai.FunctionCall{Name: "remember", Arguments: `{"fact": "The user wants refunds to their card"}`},
+	}); err != nil {
+		t.Fatalf("remember failed: %v", err)
+	}
+	if _, err := agent.CreateSession("alice"); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	msgs := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected JSON records, got %q: %v", line, err)
+		}
+		msgs[record["msg"].(string)] = record
+	}
+	for _, msg := range []string{"[CoreHandler] 🧠 Memory stored", "[Engine] ✅ Created new session"} {
+		record, ok := msgs[msg]
+		if !ok {
+			t.Fatalf("Expected %q in the injected logger, got %q", msg, buf.String())
+		}
+		if record["user_id"] != log.HashID("alice") {
+			t.Errorf("Expected a hashed user_id in %q, got %v", msg, record["user_id"])
+		}
+	}
+	if strings.Contains(buf.String(), "alice") {
+		t.Errorf("Expected no raw user ID in the logs, got %q", buf.String())
+	}
+}
+
+func TestCoreHandlerParallelToolCalls(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	coreSession, err := ch.getOrCreateCoreSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create core session: %v", err)
+	}
+
+	// "slow" calls only finish once all three are running; "exclusive" checks nothing else runs
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	allStarted := make(chan struct{})
+	enter := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		if running == 3 {
+			close(allStarted)
+		}
+		return running
+	}
+	leave := func() {
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}
+	def := func(name string) openai.FunctionDefinition {
+		return openai.FunctionDefinition{Name: name, Parameters: map[string]any{"type": "object"}}
+	}
+	ch.RegisterFunction("slow", def("slow"), func(ctx context.Context, args map[string]any) (string, error) {
+		enter()
+		defer leave()
+		select {
+		case <-allStarted:
+		case <-time.After(5 * time.Second):
+			return "", errors.New("tool calls did not run in parallel")
+		}
+		return "slow " + args["n"].(string), nil
+	})
+	ch.RegisterFunction("exclusive", def("exclusive"), func(ctx context.Context, args map[string]any) (string, error) {
+		if n := enter(); n != 1 {
+			t.Errorf("Sequential tool ran alongside %d other calls", n-1)
+		}
+		defer leave()
+		return "exclusive", nil
+	})
+	if err := ch.GetCoreTools().SetSequential("exclusive", true); err != nil {
+		t.Fatalf("SetSequential failed: %v", err)
+	}
+
+	var toolCalls []openai.ToolCall
+	for i, name := range []string{"slow", "slow", "slow", "exclusive"} {
+		toolCalls = append(toolCalls, openai.ToolCall{
+			ID: fmt.Sprintf("call_%d", i), Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: name, Arguments: fmt.Sprintf(`{"n":"%d"}`, i)},
+		})
+	}
+	results, err := ch.executeCoreToolCalls(context.Background(), "user1", coreSession.SessionID, coreSession, "msg-1", toolCalls)
+	if err != nil {
+		t.Fatalf("executeCoreToolCalls failed: %v", err)
+	}
+	want := []string{"slow 0", "slow 1", "slow 2", "exclusive"}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("Result %d: expected %q, got %q", i, want[i], results[i])
+		}
+	}
+	if maxRunning != 3 {
+		t.Errorf("Expected 3 concurrent calls, got %d", maxRunning)
+	}
+
+	// Every call is saved in order with its own response
+	saved, err := sqliteStore.GetToolCallsBySession(coreSession.SessionID)
+	if err != nil || len(saved) != len(toolCalls) {
+		t.Fatalf("Expected %d saved tool calls, got %d (%v)", len(toolCalls), len(saved), err)
+	}
+	for i, tc := range saved {
+		if tc.ToolCallID != toolCalls[i].ID || tc.Response != want[i] || tc.Status != model.ToolCallStatusSuccess {
+			t.Errorf("Saved tool call %d: got %s %q %s", i, tc.ToolCallID, tc.Response, tc.Status)
+		}
+	}
+}
+
+func TestCoreHandlerDedupeToolCalls(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	config := DefaultCoreHandlerConfig()
+	config.DedupeToolCalls = true
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	coreSession, err := ch.getOrCreateCoreSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create core session: %v", err)
+	}
+
+	var mu sync.Mutex
+	executions := 0
+	ch.RegisterFunction("lookup", openai.FunctionDefinition{Name: "lookup", Parameters: map[string]any{"type": "object"}},
+		func(ctx context.Context, args map[string]any) (string, error) {
+			mu.Lock()
+			executions++
+			mu.Unlock()
+			if args["q"] == "c" {
+				return "", errors.New("backend down")
+			}
+			return "result " + args["q"].(string), nil
+		})
+
+	// The second call only differs in key order and whitespace; the last repeats a failing call
+	toolCalls := []openai.ToolCall{
+		{ID: "call_a", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup", Arguments: `{"q":"a","n":1}`}},
+		{ID: "call_b", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup", Arguments: `{ "n": 1, "q": "a" }`}},
+		{ID: "call_c", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup", Arguments: `{"q":"c"}`}},
+		{ID: "call_d", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup", Arguments: `{"q":"c"}`}},
+	}
+	results, err := ch.executeCoreToolCalls(context.Background(), "user1", coreSession.SessionID, coreSession, "msg-1", toolCalls)
+	if err != nil {
+		t.Fatalf("executeCoreToolCalls failed: %v", err)
+	}
+	if executions != 2 {
+		t.Errorf("Expected the duplicate calls to run once, got %d executions", executions)
+	}
+	failed := "Error executing tool: backend down"
+	want := []string{"result a", "result a", failed, failed}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("Result %d: expected %q, got %q", i, want[i], results[i])
+		}
+	}
+
+	// The duplicates are still saved under their own ToolCallID with the reused result and status
+	saved, err := sqliteStore.GetToolCallsBySession(coreSession.SessionID)
+	if err != nil || len(saved) != len(toolCalls) {
+		t.Fatalf("Expected %d saved tool calls, got %d (%v)", len(toolCalls), len(saved), err)
+	}
+	wantStatus := []string{model.ToolCallStatusSuccess, model.ToolCallStatusSuccess, model.ToolCallStatusFailed, model.ToolCallStatusFailed}
+	for i, tc := range saved {
+		if tc.ToolCallID != toolCalls[i].ID || tc.Response != want[i] || tc.Status != wantStatus[i] {
+			t.Errorf("Saved tool call %d: got %s %q (%s)", i, tc.ToolCallID, tc.Response, tc.Status)
+		}
+	}
+}
+
+// TestCoreHandlerSessionTokenUsage verifies that token usage accumulates on the Core session across turns
+func TestCoreHandlerSessionTokenUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Sure, here is the answer."},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: openai.Usage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	sessionHandler := model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig())
+	ch := NewCoreHandler(sessionHandler, agent, agent, DefaultCoreHandlerConfig())
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	for _, msg := range []string{"How do I reset my password?", "And how do I change my email address?"} {
+		if _, err := ch.ProcessMessage(context.Background(), "user1", msg); err != nil {
+			t.Fatalf("ProcessMessage failed: %v", err)
+		}
+	}
+
+	coreSession, err := ch.getOrCreateCoreSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to get core session: %v", err)
+	}
+	usage, err := sessionHandler.GetSessionTokenUsage(coreSession.SessionID)
+	if err != nil {
+		t.Fatalf("GetSessionTokenUsage failed: %v", err)
+	}
+	if usage.PromptTokens != 200 || usage.CompletionTokens != 40 || usage.TotalTokens != 240 {
+		t.Errorf("Expected 200/40/240 tokens after two turns, got %+v", usage)
+	}
+	if usage.SummarizationTokens != 0 {
+		t.Errorf("Expected no summarization tokens, got %d", usage.SummarizationTokens)
+	}
+}
+
+func TestCoreHandlerModerationAuditTrail(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "OK"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	sessionHandler := model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig())
+	ch := NewCoreHandler(sessionHandler, agent, agent, DefaultCoreHandlerConfig())
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	// A nonsense message is stored as such and its strike references it
+	if _, err := ch.ProcessMessage(context.Background(), "user1", "x"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	messages, err := sqliteStore.GetMessagesByUser("user1")
+	if err != nil || len(messages) != 1 || !messages[0].IsNonsense {
+		t.Fatalf("Expected one stored nonsense message, got %d (err %v)", len(messages), err)
+	}
+	events, err := sqliteStore.GetModerationEventsByUser("user1")
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Expected one moderation event, got %d (err %v)", len(events), err)
+	}
+	if events[0].Type != model.ModerationEventNonsenseStrike || events[0].Actor != model.ModerationActorAuto ||
+		events[0].MessageID != messages[0].MessageID || events[0].NonsenseCount != 1 {
+		t.Errorf("Unexpected strike event: %+v", events[0])
+	}
+
+	// ban_user records a ban by the Core tool
+	ctx := withModerationMessageID(context.Background(), "msg-ban")
+	if _, err := ch.banUserTool(ctx, "user1", map[string]interface{}{"duration_hours": float64(2), "message": "Abusive language"}); err != nil {
+		t.Fatalf("banUserTool failed: %v", err)
+	}
+	if banned, _ := ch.userModeration.CheckBanStatus("user1"); !banned {
+		t.Fatal("Expected user to be banned")
+	}
+
+	// An admin unban lifts the ban and is recorded
+	if err := ch.UnbanUser("user1", "Appealed"); err != nil {
+		t.Fatalf("UnbanUser failed: %v", err)
+	}
+	if banned, _ := ch.userModeration.CheckBanStatus("user1"); banned {
+		t.Error("Expected user to be unbanned")
+	}
+
+	events, err = sqliteStore.GetModerationEventsByUser("user1")
+	if err != nil || len(events) != 3 {
+		t.Fatalf("Expected three moderation events, got %d (err %v)", len(events), err)
+	}
+	unban, ban := events[0], events[1]
+	if unban.Type != model.ModerationEventUnban || unban.Actor != model.ModerationActorAdmin || unban.Reason != "Appealed" {
+		t.Errorf("Unexpected unban event: %+v", unban)
+	}
+	if ban.Type != model.ModerationEventBan || ban.Actor != model.ModerationActorCore || ban.MessageID != "msg-ban" ||
+		ban.Duration != 2*time.Hour || ban.Reason != "Abusive language" {
+		t.Errorf("Unexpected ban event: %+v", ban)
+	}
+}
+
+// budgetCallback blocks every LLM call with err and records the events it saw
+type budgetCallback struct {
+	err    error
+	events []UsageEvent
+}
+
+func (b *budgetCallback) BeforeAction(_ context.Context, event *UsageEvent) error {
+	if event.EventType != EventLLMCall {
+		return nil
+	}
+	b.events = append(b.events, *event)
+	return b.err
+}
+
+func (b *budgetCallback) AfterAction(context.Context, *UsageEvent) {}
+
+func TestCoreHandlerLLMBudgetCheck(t *testing.T) {
+	llmRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		llmRequests++
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "OK"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	sessionHandler := model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig())
+	ch := NewCoreHandler(sessionHandler, agent, agent, DefaultCoreHandlerConfig())
+	callback := &budgetCallback{err: errors.New("balance exhausted")}
+	ch.Callback = callback
+
+	// Without a configured message the callback error is the answer
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	response, err := ch.ProcessMessage(context.Background(), "user1", "How do I reset my password?")
+	if err != nil || response != "balance exhausted" {
+		t.Errorf("Expected the callback error as answer, got %q (err %v)", response, err)
+	}
+
+	// With QuotaExceededMessage the user gets the configured text
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model", QuotaExceededMessage: "Your credit has run out."}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	response, err = ch.ProcessMessage(context.Background(), "user1", "How do I reset my password?")
+	if err != nil || response != "Your credit has run out." {
+		t.Errorf("Expected the quota message, got %q (err %v)", response, err)
+	}
+
+	if llmRequests != 0 {
+		t.Errorf("Expected no LLM request once the budget check blocks, got %d", llmRequests)
+	}
+	if len(callback.events) != 2 {
+		t.Fatalf("Expected 2 LLM BeforeAction events, got %d", len(callback.events))
+	}
+	if ev := callback.events[0]; ev.UserID != "user1" || ev.Model != "test-model" || ev.EstimatedInputTokens <= 0 {
+		t.Errorf("Unexpected BeforeAction event: %+v", ev)
+	}
+}
+
+func TestCoreHandlerLengthFinishReason(t *testing.T) {
+	for _, autoContinue := range []bool{false, true} {
+		var mu sync.Mutex
+		var requests []openai.ChatCompletionRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req openai.ChatCompletionRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			mu.Lock()
+			requests = append(requests, req)
+			first := len(requests) == 1
+			mu.Unlock()
+			choice := openai.ChatCompletionChoice{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: " world"},
+				FinishReason: openai.FinishReasonStop,
+			}
+			if first {
+				choice.Message.Content, choice.FinishReason = "Hello", openai.FinishReasonLength
+			}
+			json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+		}))
+
+		dir := t.TempDir()
+		os.MkdirAll(filepath.Join(dir, "root"), 0755)
+		os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+		repo, err := fsrepo.NewNodeRepository(dir)
+		if err != nil {
+			t.Fatalf("Failed to create repository: %v", err)
+		}
+		sqliteStore, err := store.NewSQLiteStore(":memory:")
+		if err != nil {
+			t.Fatalf("Failed to create SQLite store: %v", err)
+		}
+		agent := &Engine{Repo: repo, Sessions: sqliteStore}
+		if err := agent.Init(); err != nil {
+			t.Fatalf("Failed to init engine: %v", err)
+		}
+		config := DefaultCoreHandlerConfig()
+		config.AutoContinueOnLength = autoContinue
+		ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+		if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+			t.Fatalf("UseLLMConfig failed: %v", err)
+		}
+
+		response, err := ch.ProcessMessage(context.Background(), "user1", "Say hello world")
+		if err != nil {
+			t.Fatalf("ProcessMessage failed: %v", err)
+		}
+		coreSession, _ := ch.getOrCreateCoreSession("user1")
+		messages, _ := sqliteStore.GetMessagesBySession(coreSession.SessionID)
+		server.Close()
+		sqliteStore.Close()
+
+		if !autoContinue {
+			if response != "Hello"+truncatedResponseMarker || len(requests) != 1 {
+				t.Errorf("Expected a marked truncated answer from 1 request, got %q from %d", response, len(requests))
+			}
+		} else {
+			if response != "Hello world" || len(requests) != 2 {
+				t.Fatalf("Expected the continued answer from 2 requests, got %q from %d", response, len(requests))
+			}
+			sent := requests[1].Messages
+			if n := len(sent); n < 2 || sent[n-2].Content != "Hello" || sent[n-1].Content != lengthContinuePrompt {
+				t.Errorf("Expected the partial answer and the continue prompt last, got %+v", sent)
+			}
+		}
+
+		reasons := map[string]bool{}
+		for _, m := range messages {
+			reasons[m.FinishReason] = true
+		}
+		if !reasons[string(openai.FinishReasonLength)] {
+			t.Errorf("Expected the length finish reason to be stored, got %v", reasons)
+		}
+	}
+}
+
+// TestCoreHandlerLengthOnLastIteration verifies an answer cut off on the last tool iteration is
+// returned with the truncation marker instead of failing with max iterations reached
+func TestCoreHandlerLengthOnLastIteration(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+		choice := openai.ChatCompletionChoice{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Hello"},
+			FinishReason: openai.FinishReasonLength,
+		}
+		if n < 10 {
+			choice = openai.ChatCompletionChoice{
+				Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{
+					ID: fmt.Sprintf("call_%d", n), Type: openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: "update_status", Arguments: fmt.Sprintf(`{"message": "step %d"}`, n)},
+				}}},
+				FinishReason: openai.FinishReasonToolCalls,
+			}
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	config := DefaultCoreHandlerConfig()
+	config.AutoContinueOnLength = true
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	response, err := ch.ProcessMessage(context.Background(), "user1", "Do ten things")
+	if err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	if response != "Hello"+truncatedResponseMarker || requests != 10 {
+		t.Errorf("Expected a marked truncated answer after 10 requests, got %q after %d", response, requests)
+	}
+}
+
+// TestCoreHandlerToolMiddleware verifies built-in Core tools run inside the Core tool middlewares,
+// which see the tool call info and can rewrite arguments and results.
+func TestCoreHandlerToolMiddleware(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root", "billing"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "billing", "node.md"), []byte("# Billing\napi key sk-live123"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	coreSession, err := ch.getOrCreateCoreSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create core session: %v", err)
+	}
+
+	var seen model.ToolCallInfo
+	ch.UseToolMiddleware(func(next model.ContextToolFunction) model.ContextToolFunction {
+		return func(ctx context.Context, args map[string]interface{}) (string, error) {
+			seen, _ = model.ToolCallInfoFromContext(ctx)
+			args["file_path"] = "root/billing/node.md"
+			return next(ctx, args)
+		}
+	}, model.RedactToolResults("***", regexp.MustCompile(`sk-\w+`)))
+
+	result, err := ch.runCoreTool(context.Background(), "user1", coreSession.SessionID, openai.ToolCall{
+		ID:       "call_1",
+		Function: openai.FunctionCall{Name: "read_file", Arguments: `{"file_path": "root/node.md"}`},
+	})
+	if err != nil {
+		t.Fatalf("read_file failed: %v", err)
+	}
+	if !strings.Contains(result, "# Billing") || !strings.Contains(result, "api key ***") {
+		t.Errorf("Expected the rewritten path to be read and the key redacted, got %q", result)
+	}
+	if seen.ToolName != "read_file" || seen.ToolCallID != "call_1" || seen.UserID != "user1" || seen.SessionID != coreSession.SessionID {
+		t.Errorf("Unexpected tool call info %+v", seen)
+	}
+}
+
+// TestCoreHandlerReasoningTokens verifies reasoning tokens reported in CompletionTokensDetails are
+// stored on the Core message and added to the session's token usage.
+func TestCoreHandlerReasoningTokens(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model: "reasoning-model",
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "42"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: openai.Usage{
+				PromptTokens:            100,
+				CompletionTokens:        250,
+				TotalTokens:             350,
+				CompletionTokensDetails: &openai.CompletionTokensDetails{ReasoningTokens: 200},
+			},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	sessions := model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig())
+	ch := NewCoreHandler(sessions, agent, agent, DefaultCoreHandlerConfig())
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	if _, err := ch.ProcessMessage(context.Background(), "user1", "What is the answer?"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	coreSession, _ := ch.getOrCreateCoreSession("user1")
+	messages, err := sqliteStore.GetMessagesBySession(coreSession.SessionID)
+	if err != nil {
+		t.Fatalf("GetMessagesBySession failed: %v", err)
+	}
+	var answer *model.Message
+	for _, m := range messages {
+		if m.Role == openai.ChatMessageRoleAssistant {
+			answer = m
+		}
+	}
+	if answer == nil || answer.ReasoningTokens != 200 || answer.CompletionTokens != 250 {
+		t.Fatalf("Expected the stored answer to have 200 of 250 completion tokens reasoning, got %+v", answer)
+	}
+
+	usage, err := sessions.GetSessionTokenUsage(coreSession.SessionID)
+	if err != nil {
+		t.Fatalf("GetSessionTokenUsage failed: %v", err)
+	}
+	if usage.ReasoningTokens != 200 {
+		t.Errorf("Expected 200 session reasoning tokens, got %+v", usage)
+	}
+}
+
+func TestCoreHandlerNamedAgent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		offersCallAgent := false
+		for _, tool := range req.Tools {
+			offersCallAgent = offersCallAgent || tool.Function.Name == "call_agent"
+		}
+		last := req.Messages[len(req.Messages)-1]
+		choice := openai.ChatCompletionChoice{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "billing: refund issued"},
+			FinishReason: openai.FinishReasonStop,
+		}
+		switch {
+		case offersCallAgent && last.Role == openai.ChatMessageRoleTool:
+			choice.Message.Content = "Core: " + last.Content
+		case offersCallAgent:
+			choice = openai.ChatCompletionChoice{
+				Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{
+					ID: "call_1", Type: openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: "call_agent", Arguments: `{"agent_name": "billing", "message": "refund my order"}`},
+				}}},
+				FinishReason: openai.FinishReasonToolCalls,
+			}
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	newAgent := func() *Engine {
+		agent := &Engine{Repo: repo, Sessions: sqliteStore}
+		if err := agent.Init(); err != nil {
+			t.Fatalf("Failed to init engine: %v", err)
+		}
+		if err := agent.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+			t.Fatalf("UseLLMConfig failed: %v", err)
+		}
+		return agent
+	}
+	agent := newAgent()
+	sessions := model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig())
+	ch := NewCoreHandler(sessions, agent, agent, DefaultCoreHandlerConfig())
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	for _, tool := range ch.getCoreToolsForLLM() {
+		if tool.Function.Name == "call_agent" {
+			t.Fatal("Expected no call_agent tool without named agents")
+		}
+	}
+	for _, name := range []string{"", "Billing", "high", "billing-team"} {
+		if err := ch.RegisterNamedAgent(name, newAgent()); err == nil {
+			t.Errorf("Expected agent name %q to be rejected", name)
+		}
+	}
+	if err := ch.RegisterNamedAgent("billing", newAgent()); err != nil {
+		t.Fatalf("RegisterNamedAgent failed: %v", err)
+	}
+	if err := ch.RegisterNamedAgent("support", newAgent()); err != nil {
+		t.Fatalf("RegisterNamedAgent failed: %v", err)
+	}
+
+	var description string
+	for _, tool := range ch.getCoreToolsForLLM() {
+		if tool.Function.Name == "call_agent" {
+			description = tool.Function.Description
+		}
+	}
+	if !strings.Contains(description, "Available agents: billing, support.") {
+		t.Errorf("Expected call_agent to list the named agents, got %q", description)
+	}
+
+	reply, err := ch.ProcessMessage(context.Background(), "user1", "I want a refund")
+	if err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	if reply != "Core: billing: refund issued" {
+		t.Errorf("Expected the billing agent's answer, got %q", reply)
+	}
+
+	sessionID := ch.getActiveSessionID("user1", model.NamedAgentType("billing"))
+	if sessionID != "user1-billing-s0001" {
+		t.Fatalf("Expected an active billing session user1-billing-s0001, got %q", sessionID)
+	}
+	session, err := sessions.GetSession(sessionID)
+	if err != nil || session.AgentType != model.NamedAgentType("billing") {
+		t.Fatalf("Expected a billing session, got %+v (%v)", session, err)
+	}
+	if ch.getActiveSessionID("user1", model.NamedAgentType("support")) != "" || ch.getActiveSessionID("user1", model.AgentTypeHigh) != "" {
+		t.Error("Expected only the billing agent to get a session")
+	}
+
+	if _, err := ch.callNamedAgentTool(context.Background(), "user1", "", map[string]interface{}{"agent_name": "sales", "message": "hi"}); err == nil ||
+		!strings.Contains(err.Error(), "available: billing, support") {
+		t.Errorf("Expected an unknown agent error listing the agents, got %v", err)
+	}
+}
+
+// TestCoreHandlerParallelNamedAgentCalls verifies two call_agent calls in one LLM response run
+// one after the other, so they share a single session of the agent
+func TestCoreHandlerParallelNamedAgentCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		offersCallAgent := false
+		for _, tool := range req.Tools {
+			offersCallAgent = offersCallAgent || tool.Function.Name == "call_agent"
+		}
+		last := req.Messages[len(req.Messages)-1]
+		choice := openai.ChatCompletionChoice{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "done"},
+			FinishReason: openai.FinishReasonStop,
+		}
+		if offersCallAgent && last.Role == openai.ChatMessageRoleUser {
+			choice = openai.ChatCompletionChoice{
+				Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{
+					{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "call_agent", Arguments: `{"agent_name": "billing", "message": "refund order 1"}`}},
+					{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "call_agent", Arguments: `{"agent_name": "billing", "message": "refund order 2"}`}},
+				}},
+				FinishReason: openai.FinishReasonToolCalls,
+			}
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	newAgent := func() *Engine {
+		agent := &Engine{Repo: repo, Sessions: sqliteStore}
+		if err := agent.Init(); err != nil {
+			t.Fatalf("Failed to init engine: %v", err)
+		}
+		if err := agent.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+			t.Fatalf("UseLLMConfig failed: %v", err)
+		}
+		return agent
+	}
+	agent := newAgent()
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	if err := ch.RegisterNamedAgent("billing", newAgent()); err != nil {
+		t.Fatalf("RegisterNamedAgent failed: %v", err)
+	}
+	routing := &agentRoutingCallback{}
+	ch.Callback = routing
+
+	if _, err := ch.ProcessMessage(context.Background(), "user1", "Refund both orders"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	sessions, err := sqliteStore.List("user1")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	billing := 0
+	for _, session := range sessions {
+		if session.AgentType == model.NamedAgentType("billing") {
+			billing++
+		}
+	}
+	if billing != 1 {
+		t.Fatalf("Expected the two call_agent calls to share one billing session, got %d", billing)
+	}
+	if routing.calls != 2 || routing.maxInFlight != 1 {
+		t.Errorf("Expected two call_agent calls run one at a time, got %d with %d at once", routing.calls, routing.maxInFlight)
+	}
+}
+
+// agentRoutingCallback counts the agent calls in flight; each call holds its slot for a while
+// so that calls run in parallel overlap
+type agentRoutingCallback struct {
+	mu                           sync.Mutex
+	calls, inFlight, maxInFlight int
+}
+
+func (c *agentRoutingCallback) BeforeAction(_ context.Context, event *UsageEvent) error {
+	if event.EventType != EventAgentRouting {
+		return nil
+	}
+	c.mu.Lock()
+	c.calls++
+	c.inFlight++
+	c.maxInFlight = max(c.maxInFlight, c.inFlight)
+	c.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+func (c *agentRoutingCallback) AfterAction(_ context.Context, event *UsageEvent) {
+	if event.EventType == EventAgentRouting {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}
+}
+
+// TestCoreHandlerMaxConcurrentRequests verifies that with MaxConcurrentRequests N the message of
+// an N+1th user waits until one in progress finishes, and gives up when its context ends
+func TestCoreHandlerMaxConcurrentRequests(t *testing.T) {
+	var llmCalls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		llmCalls.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "done"},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	config := DefaultCoreHandlerConfig()
+	config.MaxConcurrentRequests = 2
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	waitFor := func(cond func() bool, what string) {
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	var wg sync.WaitGroup
+	for _, userID := range []string{"user1", "user2", "user3"} {
+		wg.Add(1)
+		go func(userID string) {
+			defer wg.Done()
+			if _, err := ch.ProcessMessage(context.Background(), userID, "hello"); err != nil {
+				t.Errorf("ProcessMessage for %s failed: %v", userID, err)
+			}
+		}(userID)
+	}
+	waitFor(func() bool { return llmCalls.Load() == 2 }, "two LLM calls")
+	time.Sleep(50 * time.Millisecond)
+	if got := llmCalls.Load(); got != 2 || ch.InFlightRequests() != 2 {
+		t.Fatalf("Expected the third user to wait, got %d LLM calls and %d in flight", got, ch.InFlightRequests())
+	}
+
+	// A waiting message gives up with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ch.ProcessMessage(ctx, "user4", "hello"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the waiting message to fail with its context, got %v", err)
+	}
+
+	// Finishing one message lets the waiting one in
+	release <- struct{}{}
+	waitFor(func() bool { return llmCalls.Load() == 3 }, "the third LLM call")
+	close(release)
+	wg.Wait()
+	if n := ch.InFlightRequests(); n != 0 {
+		t.Errorf("Expected no request in flight at the end, got %d", n)
+	}
+}
@@ -147,12 +147,13 @@ func PerformWebSearch(
 	llmConfig LLMConfig,
 	query string,
 	userID string,
-) (string, error) {
+) (*WebSearchResult, error) {
 	return PerformWebSearchWithModel(ctx, llmClient, llmConfig, query, userID, DefaultSearchModel)
 }
 
 // PerformWebSearchWithModel performs a web search using the given search-enabled model.
 // Models: gpt-4o-search-preview, gpt-4o-mini-search-preview, or alibaba/tongyi-deepresearch-30b-a3b (etc.)
+// The result carries the sources cited in the answer (none if the model cites no links).
 func PerformWebSearchWithModel(
 	ctx context.Context,
 	llmClient *openai.Client,
@@ -160,7 +161,7 @@ func PerformWebSearchWithModel(
 	query string,
 	userID string,
 	searchModel string,
-) (string, error) {
+) (*WebSearchResult, error) {
 	if searchModel == "" {
 		searchModel = DefaultSearchModel
 	}
@@ -169,7 +170,7 @@ func PerformWebSearchWithModel(
 		ctx = model.WithUserID(ctx, userID)
 	}
 
-	log.Log.Infof("[WebSearch] 🔍 Performing web search | UserID: %s | Query: %s | Model: %s", userID, query, searchModel)
+	log.Log.Info("[WebSearch] 🔍 Performing web search", "user_id", userID, "query", query, "model", searchModel)
 
 	request := openai.ChatCompletionRequest{
 		Model: searchModel,
@@ -183,15 +184,15 @@ func PerformWebSearchWithModel(
 
 	resp, err := llmClient.CreateChatCompletion(ctx, request)
 	if err != nil {
-		log.Log.Errorf("[WebSearch] ❌ Web search failed | UserID: %s | Error: %v", userID, err)
-		return "", fmt.Errorf("web search failed: %w", err)
+		log.Log.Error("[WebSearch] ❌ Web search failed", "user_id", userID, "error", err)
+		return nil, fmt.Errorf("web search failed: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from web search")
+		return nil, fmt.Errorf("no response from web search")
 	}
 
-	result := resp.Choices[0].Message.Content
-	log.Log.Infof("[WebSearch] ✅ Web search completed | UserID: %s | Result length: %d chars", userID, len(result))
+	result := ParseWebSearchResult(resp.Choices[0].Message.Content)
+	log.Log.Info("[WebSearch] ✅ Web search completed", "user_id", userID, "result_length", len(result.Answer), "citations", len(result.Citations))
 	return result, nil
 }
@@ -0,0 +1,306 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// memoryExtractionMessages is the number of recent Core messages a fact extraction reads
+const memoryExtractionMessages = 20
+
+// memoryExtractionPrompt is the system prompt of a fact extraction
+const memoryExtractionPrompt = `You extract durable facts about the user from a conversation with an assistant: preferences (tone, language, formats), personal and company details, and decisions that will still matter in later conversations. Ignore one-off requests, the assistant's own statements and anything uncertain.
+
+Reply with JSON only: {"facts": [{"key": "snake_case_name", "value": "the fact, written so it makes sense on its own", "confidence": 0.0 to 1.0}]}
+Reuse the key of a known fact to update it. Reply {"facts": []} when there is nothing new.`
+
+// memoryExtractionSchema is the JSON Schema of an extraction answer
+var memoryExtractionSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"facts": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"key":        map[string]interface{}{"type": "string"},
+					"value":      map[string]interface{}{"type": "string"},
+					"confidence": map[string]interface{}{"type": "number"},
+				},
+				"required": []interface{}{"key", "value", "confidence"},
+			},
+		},
+	},
+	"required": []interface{}{"facts"},
+}
+
+// memoryLine describes a memory as "key: text", or its text when it has no key
+func memoryLine(memory *model.MemoryRecord) string {
+	if memory.Key == "" {
+		return memory.Text
+	}
+	return memory.Key + ": " + memory.Text
+}
+
+// buildMemoryPrompt lists the user's MemoryConfig.PromptTopK most confident memories (the most
+// recently used first among equals) for the Core's system prompt; "" when there are none
+func (ch *CoreHandler) buildMemoryPrompt(userID string) string {
+	if ch.memory == nil || ch.memory.config.PromptTopK < 0 {
+		return ""
+	}
+	memories, err := ch.memory.store.GetMemoriesByUser(userID)
+	if err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to load memories for the prompt", "user_id", userID, "error", err)
+		return ""
+	}
+	if len(memories) == 0 {
+		return ""
+	}
+	sort.SliceStable(memories, func(i, j int) bool {
+		if memories[i].Confidence != memories[j].Confidence {
+			return memories[i].Confidence > memories[j].Confidence
+		}
+		return memories[i].LastUsedAt.After(memories[j].LastUsedAt)
+	})
+	if len(memories) > ch.memory.config.PromptTopK {
+		memories = memories[:ch.memory.config.PromptTopK]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## What You Know About This User\n\n")
+	sb.WriteString("Facts remembered from earlier conversations. Use them without asking again; use recall for more, and forget_memory when the user asks you to forget something.\n\n")
+	for _, memory := range memories {
+		fmt.Fprintf(&sb, "- %s\n", memoryLine(memory))
+	}
+	return sb.String()
+}
+
+// evictMemories deletes the least recently used memories of userID beyond MemoryConfig.MaxPerUser
+func (ch *CoreHandler) evictMemories(userID string) {
+	memories, err := ch.memory.store.GetMemoriesByUser(userID)
+	if err != nil || len(memories) <= ch.memory.config.MaxPerUser {
+		return
+	}
+	sort.SliceStable(memories, func(i, j int) bool { return memories[i].LastUsedAt.Before(memories[j].LastUsedAt) })
+	evicted := make([]string, len(memories)-ch.memory.config.MaxPerUser)
+	for i := range evicted {
+		evicted[i] = memories[i].MemoryID
+	}
+	if _, err := ch.memory.store.DeleteMemories(userID, evicted...); err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to evict memories", "user_id", userID, "error", err)
+		return
+	}
+	ch.logger().Info("[CoreHandler] 🧠 Memories evicted", "user_id", userID, "count", len(evicted))
+}
+
+// forgetMemoryTool deletes the user's memories with the given key, or else those whose text
+// contains the given words
+func (ch *CoreHandler) forgetMemoryTool(userID string, args map[string]interface{}) (string, error) {
+	if ch.memory == nil {
+		return "", fmt.Errorf("memory is not enabled")
+	}
+	subject, err := getStringArg(args, "memory")
+	if err != nil {
+		return "", err
+	}
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return "", fmt.Errorf("memory cannot be empty")
+	}
+
+	memories, err := ch.memory.store.GetMemoriesByUser(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load memories: %w", err)
+	}
+	var ids, forgotten []string
+	key := model.NormalizeMemoryKey(subject)
+	for _, memory := range memories {
+		if memory.Key != "" && memory.Key == key {
+			ids, forgotten = append(ids, memory.MemoryID), append(forgotten, memoryLine(memory))
+		}
+	}
+	if len(ids) == 0 {
+		words := strings.ToLower(subject)
+		for _, memory := range memories {
+			if strings.Contains(strings.ToLower(memory.Text), words) {
+				ids, forgotten = append(ids, memory.MemoryID), append(forgotten, memoryLine(memory))
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return fmt.Sprintf("Nothing remembered matches %q.", subject), nil
+	}
+	if _, err := ch.memory.store.DeleteMemories(userID, ids...); err != nil {
+		return "", err
+	}
+	ch.logger().Info("[CoreHandler] 🧠 Memories forgotten", "user_id", userID, "count", len(ids))
+	return fmt.Sprintf("Forgot %d memories:\n- %s", len(ids), strings.Join(forgotten, "\n- ")), nil
+}
+
+// noteMemoryMessage counts a user message of userID and, every MemoryConfig.ExtractEvery
+// messages, extracts facts from conversation (the Core session's messages) in the background
+func (ch *CoreHandler) noteMemoryMessage(ctx context.Context, userID, sessionID string, conversation []openai.ChatCompletionMessage) {
+	m := ch.memory
+	if m == nil || m.config.ExtractEvery <= 0 {
+		return
+	}
+	m.messagesMu.Lock()
+	m.messages[userID]++
+	due := m.messages[userID] >= m.config.ExtractEvery
+	if due {
+		m.messages[userID] = 0
+	}
+	m.messagesMu.Unlock()
+	if !due {
+		return
+	}
+
+	// Counted as in flight so Shutdown waits for it; the message calling this still is
+	conversation = append([]openai.ChatCompletionMessage{}, conversation...)
+	ch.inFlight.Add(1)
+	go func() {
+		defer ch.inFlight.Done()
+		if _, err := ch.extractMemories(context.WithoutCancel(ctx), userID, sessionID, conversation); err != nil {
+			ch.logger().Warn("[CoreHandler] ⚠️  Memory extraction failed", "user_id", userID, "error", err)
+		}
+	}()
+}
+
+// ExtractMemories asks the model for durable facts about userID in their recent Core
+// conversation and stores those with at least MemoryConfig.MinConfidence, replacing the facts
+// with the same key. It returns the number of facts stored. Memory must be enabled.
+func (ch *CoreHandler) ExtractMemories(ctx context.Context, userID string) (int, error) {
+	if ch.memory == nil {
+		return 0, fmt.Errorf("memory is not enabled")
+	}
+	userMu := ch.getUserMutex(userID)
+	userMu.Lock()
+	coreSession, err := ch.getOrCreateCoreSession(userID)
+	var conversation []openai.ChatCompletionMessage
+	if err == nil {
+		conversation = append(conversation, coreSession.Msgs...)
+	}
+	userMu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get core session: %w", err)
+	}
+	return ch.extractMemories(ctx, userID, coreSession.SessionID, conversation)
+}
+
+// extractMemories runs a fact extraction over the last messages of conversation
+func (ch *CoreHandler) extractMemories(ctx context.Context, userID, sessionID string, conversation []openai.ChatCompletionMessage) (int, error) {
+	var transcript strings.Builder
+	var lines []string
+	for _, msg := range conversation {
+		if (msg.Role == openai.ChatMessageRoleUser || msg.Role == openai.ChatMessageRoleAssistant) && msg.Content != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", msg.Role, msg.Content))
+		}
+	}
+	if len(lines) > memoryExtractionMessages {
+		lines = lines[len(lines)-memoryExtractionMessages:]
+	}
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	known, err := ch.memory.store.GetMemoriesByUser(userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load memories: %w", err)
+	}
+	byKey := make(map[string]*model.MemoryRecord)
+	if len(known) > 0 {
+		transcript.WriteString("Known facts:\n")
+		for _, memory := range known {
+			fmt.Fprintf(&transcript, "- %s\n", memoryLine(memory))
+			if memory.Key != "" {
+				byKey[memory.Key] = memory
+			}
+		}
+		transcript.WriteString("\n")
+	}
+	transcript.WriteString("Conversation:\n")
+	transcript.WriteString(strings.Join(lines, "\n"))
+
+	llmModel := ch.memory.config.ExtractionModel
+	if llmModel == "" {
+		llmModel = ch.llmConfig.Model
+	}
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: memoryExtractionPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: transcript.String()},
+	}
+	if cbErr := checkLLMBudget(ctx, ch.Callback, ch.quota, userID, sessionID, llmModel, messages, nil); cbErr != nil {
+		return 0, fmt.Errorf("LLM call blocked: %w", cbErr)
+	}
+	llmStart := time.Now()
+	resp, err := ch.callLLM(ctx, llmModel, messages, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Choices) == 0 {
+		return 0, fmt.Errorf("no choices in LLM response")
+	}
+	ev := &UsageEvent{
+		UserID:       userID,
+		SessionID:    sessionID,
+		EventType:    EventLLMCall,
+		Name:         EventNameLLMCall,
+		Tokens:       resp.Usage.TotalTokens,
+		InputTokens:  resp.Usage.PromptTokens,
+		OutputTokens: resp.Usage.CompletionTokens,
+		Model:        llmModel,
+		Duration:     time.Since(llmStart),
+	}
+	if resp.Usage.PromptTokensDetails != nil {
+		ev.CachedInputTokens = resp.Usage.PromptTokensDetails.CachedTokens
+	}
+	recordLLMUsage(ctx, ch.Callback, ch.config.CostTable, ch.sessionHandler.GetStore(), ev)
+
+	value, problems := model.ParseJSONResponse(resp.Choices[0].Message.Content, memoryExtractionSchema)
+	if len(problems) > 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidJSONResponse, strings.Join(problems, "; "))
+	}
+	var facts []*model.MemoryRecord
+	var texts []string
+	for _, item := range value.(map[string]interface{})["facts"].([]interface{}) {
+		fact := item.(map[string]interface{})
+		key, text := model.NormalizeMemoryKey(fact["key"].(string)), strings.TrimSpace(fact["value"].(string))
+		confidence := fact["confidence"].(float64)
+		if key == "" || text == "" || confidence < ch.memory.config.MinConfidence {
+			continue
+		}
+		memory := model.NewMemoryFact(userID, sessionID, key, text, math.Min(confidence, 1), nil)
+		if previous, ok := byKey[key]; ok {
+			memory.CreatedAt = previous.CreatedAt
+		}
+		facts = append(facts, memory)
+		texts = append(texts, text)
+	}
+	if len(facts) == 0 {
+		return 0, nil
+	}
+
+	vectors, err := ch.memory.provider.Embed(ctx, texts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to embed facts: %w", err)
+	}
+	if len(vectors) != len(facts) {
+		return 0, fmt.Errorf("embedder returned %d vectors for %d facts", len(vectors), len(facts))
+	}
+	for i, fact := range facts {
+		fact.Embedding = vectors[i]
+		if err := ch.memory.store.PutMemory(fact); err != nil {
+			return i, err
+		}
+	}
+	ch.evictMemories(userID)
+	ch.logger().Info("[CoreHandler] 🧠 Memories extracted", "user_id", userID, "count", len(facts))
+	return len(facts), nil
+}
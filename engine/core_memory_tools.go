@@ -0,0 +1,249 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Defaults of MemoryConfig
+const (
+	defaultMemoryTopK          = 5
+	defaultMemoryMaxPerUser    = 100
+	defaultMemoryPromptTopK    = 10
+	defaultMemoryMinConfidence = 0.5
+)
+
+// MemoryConfig configures the Core's long-term memory (see CoreHandler.EnableMemory)
+type MemoryConfig struct {
+	// TopK is the number of memories recall returns at most (default: 5)
+	TopK int
+	// MinSimilarity is the cosine similarity a memory needs to be recalled (0: no threshold)
+	MinSimilarity float64
+
+	// MaxPerUser caps the memories of a user: storing more evicts the least recently used ones
+	// (default: 100)
+	MaxPerUser int
+	// PromptTopK is the number of memories shown to the Core with every message, most confident
+	// first (default: 10, negative: none)
+	PromptTopK int
+	// ExtractEvery extracts facts from the Core conversation every ExtractEvery user messages
+	// (0: never, see CoreHandler.ExtractMemories)
+	ExtractEvery int
+	// MinConfidence is the confidence an extracted fact needs to be stored (default: 0.5)
+	MinConfidence float64
+	// ExtractionModel is the model extracting facts (default: the Core model)
+	ExtractionModel string
+}
+
+// coreMemory is the long-term memory behind the remember, recall and forget_memory tools
+type coreMemory struct {
+	provider EmbeddingProvider
+	store    model.MemoryStore
+	config   MemoryConfig
+
+	// messagesMu guards messages, the user messages of each user since their last extraction
+	messagesMu sync.Mutex
+	messages   map[string]int
+}
+
+// EnableMemory gives the Core the remember, recall and forget_memory tools, which store facts
+// about the user with their embedding, retrieve the most similar ones in later sessions and
+// delete them. The user's most confident facts are also part of the Core's system prompt, and
+// with MemoryConfig.ExtractEvery facts are extracted from the conversation. The session store
+// must implement model.MemoryStore; a nil provider disables memory.
+func (ch *CoreHandler) EnableMemory(provider EmbeddingProvider, config MemoryConfig) error {
+	if provider == nil {
+		ch.memory = nil
+		return nil
+	}
+	memoryStore, ok := ch.sessionHandler.GetStore().(model.MemoryStore)
+	if !ok {
+		return fmt.Errorf("the session store does not keep memories")
+	}
+	if config.TopK <= 0 {
+		config.TopK = defaultMemoryTopK
+	}
+	if config.MaxPerUser <= 0 {
+		config.MaxPerUser = defaultMemoryMaxPerUser
+	}
+	if config.PromptTopK == 0 {
+		config.PromptTopK = defaultMemoryPromptTopK
+	}
+	if config.MinConfidence <= 0 {
+		config.MinConfidence = defaultMemoryMinConfidence
+	}
+	ch.memory = &coreMemory{provider: provider, store: memoryStore, config: config, messages: make(map[string]int)}
+	return nil
+}
+
+// embedOne embeds a single text
+func (m *coreMemory) embedOne(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := m.provider.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed text: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 text", len(vectors))
+	}
+	return vectors[0], nil
+}
+
+// recalledMemory is a memory with its similarity to a recall query
+type recalledMemory struct {
+	memory *model.MemoryRecord
+	score  float64
+}
+
+// search returns the memories of userID most similar to query, best first
+func (m *coreMemory) search(ctx context.Context, userID, query string) ([]recalledMemory, error) {
+	memories, err := m.store.GetMemoriesByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load memories: %w", err)
+	}
+	if len(memories) == 0 {
+		return nil, nil
+	}
+	queryVector, err := m.embedOne(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]recalledMemory, 0, len(memories))
+	for _, memory := range memories {
+		score := cosineSimilarity(queryVector, memory.Embedding)
+		if m.config.MinSimilarity > 0 && score < m.config.MinSimilarity {
+			continue
+		}
+		results = append(results, recalledMemory{memory: memory, score: score})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
+	if len(results) > m.config.TopK {
+		results = results[:m.config.TopK]
+	}
+	return results, nil
+}
+
+// rememberTool stores a fact about the user in the long-term memory
+func (ch *CoreHandler) rememberTool(ctx context.Context, userID string, args map[string]interface{}) (string, error) {
+	if ch.memory == nil {
+		return "", fmt.Errorf("memory is not enabled")
+	}
+	fact, err := getStringArg(args, "fact")
+	if err != nil {
+		return "", err
+	}
+	fact = strings.TrimSpace(fact)
+	if fact == "" {
+		return "", fmt.Errorf("fact cannot be empty")
+	}
+
+	embedding, err := ch.memory.embedOne(ctx, fact)
+	if err != nil {
+		return "", err
+	}
+	if err := ch.memory.store.PutMemory(model.NewMemoryRecord(userID, fact, embedding)); err != nil {
+		return "", err
+	}
+	ch.evictMemories(userID)
+	ch.logger().Info("[CoreHandler] 🧠 Memory stored", "user_id", userID, "length", len(fact))
+	return fmt.Sprintf("Remembered: %s", fact), nil
+}
+
+// recallTool returns the user's memories most similar to the query
+func (ch *CoreHandler) recallTool(ctx context.Context, userID string, args map[string]interface{}) (string, error) {
+	if ch.memory == nil {
+		return "", fmt.Errorf("memory is not enabled")
+	}
+	query, err := getStringArg(args, "query")
+	if err != nil {
+		return "", err
+	}
+
+	results, err := ch.memory.search(ctx, userID, query)
+	if err != nil {
+		return "", err
+	}
+	ch.logger().Info("[CoreHandler] 🧠 Memories recalled", "user_id", userID, "count", len(results))
+	if len(results) == 0 {
+		return "No memories found for this user.", nil
+	}
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.memory.MemoryID
+	}
+	if err := ch.memory.store.TouchMemories(userID, ids, time.Now()); err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to update recalled memories", "user_id", userID, "error", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Memories about this user, most relevant first:\n")
+	for i, result := range results {
+		fmt.Fprintf(&sb, "%d. %s (remembered %s, similarity %.2f)\n",
+			i+1, memoryLine(result.memory), result.memory.CreatedAt.Format("2006-01-02"), result.score)
+	}
+	return sb.String(), nil
+}
+
+// coreMemoryToolDefinitions returns the remember, recall and forget_memory tools offered to the Core
+func coreMemoryToolDefinitions() []openai.Tool {
+	return []openai.Tool{
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "remember",
+				Description: "Store a lasting fact about the user (preferences, personal details, decisions) so it can be recalled in later sessions. Store one self-contained fact per call.",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"fact": map[string]interface{}{
+							"type":        "string",
+							"description": "The fact to remember, written so it makes sense on its own, e.g. 'The user prefers invoices in EUR'",
+						},
+					},
+					"required": []string{"fact"},
+				},
+			},
+		},
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "recall",
+				Description: "Search the facts remembered about the user in earlier sessions and return the most relevant ones.",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"query": map[string]interface{}{
+							"type":        "string",
+							"description": "What to look for, e.g. 'preferred currency'",
+						},
+					},
+					"required": []string{"query"},
+				},
+			},
+		},
+		{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        "forget_memory",
+				Description: "Delete what is remembered about the user on a subject, when they ask you to forget it or say it is wrong.",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"memory": map[string]interface{}{
+							"type":        "string",
+							"description": "The key of the fact (e.g. 'preferred_tone'), or words of the remembered text",
+						},
+					},
+					"required": []string{"memory"},
+				},
+			},
+		},
+	}
+}
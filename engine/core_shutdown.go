@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ghiac/agentize/model"
+)
+
+// ErrShuttingDown is returned by ProcessMessage (and its variants) once Shutdown has started
+var ErrShuttingDown = errors.New("core handler is shutting down")
+
+// beginMessage registers an in-flight message; it fails once Shutdown has started.
+// Callers must call ch.inFlight.Done() when the message is finished.
+func (ch *CoreHandler) beginMessage() error {
+	ch.shutdownMu.Lock()
+	defer ch.shutdownMu.Unlock()
+	if ch.shuttingDown {
+		return ErrShuttingDown
+	}
+	ch.inFlight.Add(1)
+	return nil
+}
+
+// Shutdown stops accepting new messages, waits for the messages in progress to finish, then
+// saves the cached Core sessions (so sequence counters are persisted) and closes the backup chain.
+// If ctx ends first, Shutdown returns its error without flushing; messages still running keep
+// their own saves. Calling Shutdown again waits for the same messages.
+func (ch *CoreHandler) Shutdown(ctx context.Context) error {
+	ch.shutdownMu.Lock()
+	if !ch.shuttingDown {
+		ch.logger().Info("[CoreHandler] 🛑 Shutting down, waiting for messages in progress")
+	}
+	ch.shuttingDown = true
+	ch.shutdownMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ch.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		ch.logger().Warn("[CoreHandler] ⚠️  Shutdown deadline reached with messages still in progress", "error", ctx.Err())
+		return fmt.Errorf("shutdown interrupted: %w", ctx.Err())
+	}
+
+	err := errors.Join(ch.flushCoreSessions(), ch.backups.close())
+	if err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Shutdown completed with errors", "error", err)
+		return err
+	}
+	ch.logger().Info("[CoreHandler] ✅ Shutdown completed")
+	return nil
+}
+
+// flushCoreSessions saves every cached Core session to the store
+func (ch *CoreHandler) flushCoreSessions() error {
+	ch.coreSessionsMu.RLock()
+	sessions := make([]*model.Session, 0, len(ch.coreSessions))
+	for _, session := range ch.coreSessions {
+		sessions = append(sessions, session)
+	}
+	ch.coreSessionsMu.RUnlock()
+
+	store := ch.sessionHandler.GetStore()
+	var errs []error
+	for _, session := range sessions {
+		if err := store.Put(session); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save core session %s: %w", session.SessionID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
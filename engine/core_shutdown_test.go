@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestCoreHandlerShutdownDrainsInFlightMessages(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Here is how to reset it."},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	sessionHandler := model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig())
+	ch := NewCoreHandler(sessionHandler, agent, agent, DefaultCoreHandlerConfig())
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	// A message started before shutdown
+	type result struct {
+		response string
+		err      error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		response, err := ch.ProcessMessage(context.Background(), "user1", "How do I reset my password?")
+		inFlight <- result{response, err}
+	}()
+	<-started
+
+	// Shutdown waits for it
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- ch.Shutdown(context.Background()) }()
+	for {
+		ch.shutdownMu.Lock()
+		shuttingDown := ch.shuttingDown
+		ch.shutdownMu.Unlock()
+		if shuttingDown {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// New messages are refused while shutting down
+	if _, err := ch.ProcessMessage(context.Background(), "user2", "What are your opening hours?"); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected ErrShuttingDown for a new message, got %v", err)
+	}
+
+	// A short deadline ends the wait without waiting for the message
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	if err := ch.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline error, got %v", err)
+	}
+	cancel()
+
+	select {
+	case err := <-shutdownDone:
+		t.Fatalf("Shutdown returned before the in-flight message finished: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if r := <-inFlight; r.err != nil || r.response != "Here is how to reset it." {
+		t.Errorf("In-flight message = %q, %v; want it to complete", r.response, r.err)
+	}
+	select {
+	case err := <-shutdownDone:
+		if err != nil {
+			t.Errorf("Shutdown failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after the in-flight message finished")
+	}
+
+	// The Core session and its message counter were saved
+	coreSession, err := ch.getOrCreateCoreSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to get core session: %v", err)
+	}
+	stored, err := sqliteStore.Get(coreSession.SessionID)
+	if err != nil || stored.MessageSeq != coreSession.MessageSeq || stored.MessageSeq == 0 {
+		t.Errorf("Expected the core session to be saved with its message counter, got %+v (err %v)", stored, err)
+	}
+}
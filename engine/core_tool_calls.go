@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultMaxParallelTools is the number of tool calls run at once when
+// CoreHandlerConfig.MaxParallelTools is 0
+const defaultMaxParallelTools = 4
+
+// executeCoreToolCalls runs the tool calls of one assistant message and returns their results in
+// the order of toolCalls. Calls run concurrently up to MaxParallelTools; a sequential tool (see
+// FunctionRegistry.SetSequential) waits for the calls before it, and the calls after it wait for it.
+// All calls are saved before any runs, so their tool IDs follow the order the model gave them.
+// With DedupeToolCalls a repeated call is not run; it gets the result (and is saved with the error)
+// of the first identical call.
+func (ch *CoreHandler) executeCoreToolCalls(
+	ctx context.Context,
+	userID, sessionID string,
+	coreSession *model.Session,
+	messageID string,
+	toolCalls []openai.ToolCall,
+) ([]string, error) {
+	persister := ch.getToolCallPersister()
+	toolIDs := make([]string, len(toolCalls))
+	if coreSession != nil {
+		for i, toolCall := range toolCalls {
+			toolID, err := persister.save(coreSession, messageID, toolCall, model.AgentTypeCore)
+			if err != nil {
+				if err := persistFailed(ch.config.FailFastOnPersistError, coreSession, "tool call", err); err != nil {
+					for _, saved := range toolIDs[:i] {
+						persister.Update(saved, "", err)
+					}
+					return nil, err
+				}
+			}
+			toolIDs[i] = toolID
+		}
+	}
+
+	limit := ch.config.MaxParallelTools
+	if limit <= 0 {
+		limit = defaultMaxParallelTools
+	}
+
+	var duplicateOf []int
+	if ch.config.DedupeToolCalls {
+		duplicateOf = duplicateToolCalls(toolCalls)
+	}
+
+	results := make([]string, len(toolCalls))
+	errs := make([]error, len(toolCalls))
+	run := func(i int) {
+		toolCall := toolCalls[i]
+		results[i], errs[i] = ch.executeCoreTool(ctx, userID, sessionID, persister, toolIDs[i], toolCall)
+		ch.logger().Info("[CoreHandler] 🔧 Tool executed", "name", toolCall.Function.Name, "result_len", len(results[i]))
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, limit)
+	for i, toolCall := range toolCalls {
+		if err := ctx.Err(); err != nil {
+			wg.Wait()
+			// Calls that never ran are not left pending
+			for _, toolID := range toolIDs[i:] {
+				persister.Update(toolID, "", err)
+			}
+			return nil, err
+		}
+
+		if duplicateOf != nil && duplicateOf[i] >= 0 {
+			continue
+		}
+		if limit == 1 || ch.coreTools.IsSequential(toolCall.Function.Name) {
+			wg.Wait()
+			run(i)
+			continue
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			run(i)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, j := range duplicateOf {
+		if j >= 0 {
+			results[i] = results[j]
+			persister.Update(toolIDs[i], results[i], errs[j])
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+)
+
+// ModelPrice is the USD price of a model per 1K tokens
+type ModelPrice struct {
+	PromptPer1K     float64
+	CompletionPer1K float64
+}
+
+// CostTable maps model names to their price. A key ending in "*" matches every model with
+// that prefix (e.g. "openai/gpt-5-*"); an exact key wins over prefixes, and the longest
+// prefix wins over shorter ones.
+type CostTable map[string]ModelPrice
+
+// Price returns the price of modelName and whether the table has one
+func (t CostTable) Price(modelName string) (ModelPrice, bool) {
+	if price, ok := t[modelName]; ok {
+		return price, true
+	}
+	var best ModelPrice
+	bestLen := -1
+	for key, price := range t {
+		prefix, ok := strings.CutSuffix(key, "*")
+		if !ok || !strings.HasPrefix(modelName, prefix) || len(prefix) <= bestLen {
+			continue
+		}
+		best, bestLen = price, len(prefix)
+	}
+	return best, bestLen >= 0
+}
+
+// Cost returns the USD cost of a call to modelName, and false when the model has no price
+func (t CostTable) Cost(modelName string, promptTokens, completionTokens int) (float64, bool) {
+	price, ok := t.Price(modelName)
+	if !ok {
+		return 0, false
+	}
+	return float64(promptTokens)/1000*price.PromptPer1K + float64(completionTokens)/1000*price.CompletionPer1K, true
+}
+
+// recordLLMUsage finishes the usage event of an LLM call: it sets CostUSD from costs, adds a
+// usage record to sessionStore when it keeps the usage aggregate (model.UsageStore), and
+// reports the event to cb (when set)
+func recordLLMUsage(ctx context.Context, cb Callback, costs CostTable, sessionStore interface{}, event *UsageEvent) {
+	if cost, ok := costs.Cost(event.Model, event.InputTokens, event.OutputTokens); ok {
+		event.CostUSD = cost
+	}
+
+	if usageStore, ok := sessionStore.(model.UsageStore); ok && event.UserID != "" {
+		record := model.NewUsageRecord(event.UserID, event.SessionID, event.Model)
+		record.PromptTokens = event.InputTokens
+		record.CompletionTokens = event.OutputTokens
+		record.CostUSD = event.CostUSD
+		if err := usageStore.PutUsageRecord(record); err != nil {
+			log.Log.Warn("[Usage] ⚠️  Failed to store usage record", "user_id", event.UserID, "model", event.Model, "error", err)
+		}
+	}
+
+	if cb != nil {
+		cb.AfterAction(ctx, event)
+	}
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestCostTable(t *testing.T) {
+	costs := CostTable{
+		"openai/gpt-5-*":    {PromptPer1K: 0.001, CompletionPer1K: 0.002},
+		"openai/gpt-5-nano": {PromptPer1K: 0.0001, CompletionPer1K: 0.0004},
+		"openai/*":          {PromptPer1K: 1, CompletionPer1K: 1},
+	}
+
+	tests := []struct {
+		model string
+		want  float64
+		ok    bool
+	}{
+		{"openai/gpt-5-nano", 0.0001*2 + 0.0004*0.5, true}, // exact match wins
+		{"openai/gpt-5-mini", 0.001*2 + 0.002*0.5, true},   // longest prefix wins
+		{"openai/gpt-4o", 2 + 0.5, true},                   // shorter prefix
+		{"anthropic/claude", 0, false},                     // no price
+	}
+	for _, tt := range tests {
+		got, ok := costs.Cost(tt.model, 2000, 500)
+		if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Cost(%q) = %v, %v; want %v, %v", tt.model, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// A nil table prices nothing
+	if _, ok := CostTable(nil).Cost("openai/gpt-5-nano", 1, 1); ok {
+		t.Error("Expected no price from a nil table")
+	}
+}
+
+// usageCallback records AfterAction events
+type usageCallback struct {
+	events []UsageEvent
+}
+
+func (u *usageCallback) BeforeAction(context.Context, *UsageEvent) error { return nil }
+
+func (u *usageCallback) AfterAction(_ context.Context, event *UsageEvent) {
+	u.events = append(u.events, *event)
+}
+
+func TestCoreHandlerUsageCost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "OK"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: openai.Usage{PromptTokens: 1000, CompletionTokens: 500, TotalTokens: 1500},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+
+	config := DefaultCoreHandlerConfig()
+	config.CostTable = CostTable{"test-*": {PromptPer1K: 0.01, CompletionPer1K: 0.03}}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	callback := &usageCallback{}
+	ch.Callback = callback
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	if agent.CostTable == nil {
+		t.Error("Expected the cost table to be propagated to the agents")
+	}
+
+	if _, err := ch.ProcessMessage(context.Background(), "user1", "How do I reset my password?"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+
+	var llmEvents []UsageEvent
+	for _, ev := range callback.events {
+		if ev.EventType == EventLLMCall {
+			llmEvents = append(llmEvents, ev)
+		}
+	}
+	if len(llmEvents) != 1 || math.Abs(llmEvents[0].CostUSD-0.025) > 1e-9 {
+		t.Fatalf("Expected one LLM event costing $0.025, got %+v", llmEvents)
+	}
+
+	summary, err := sqliteStore.GetUsageSummary("user1", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("GetUsageSummary failed: %v", err)
+	}
+	if summary.Calls != 1 || summary.PromptTokens != 1000 || summary.CompletionTokens != 500 || math.Abs(summary.CostUSD-0.025) > 1e-9 {
+		t.Errorf("Unexpected usage summary: %+v", summary)
+	}
+	if summary.ByModel["test-model"] == nil {
+		t.Errorf("Expected usage of test-model, got %+v", summary.ByModel)
+	}
+}
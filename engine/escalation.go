@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// EscalationTrigger is a way the low UserAgent can hand a message over to the high one
+type EscalationTrigger string
+
+const (
+	// EscalationTriggerPrefix escalates when the low agent's reply starts with EscalationPolicy.Prefix
+	EscalationTriggerPrefix EscalationTrigger = "prefix"
+	// EscalationTriggerTool escalates when the low agent calls the escalate_to_high tool
+	EscalationTriggerTool EscalationTrigger = "tool"
+	// EscalationTriggerConfidence escalates when the low agent's reply reports a
+	// "CONFIDENCE: <0..1>" line below EscalationPolicy.ConfidenceThreshold
+	EscalationTriggerConfidence EscalationTrigger = "confidence"
+)
+
+// EventEscalation is the UsageEvent type recorded when a message is escalated from low to high
+const EventEscalation EventType = "escalation"
+
+// EscalateToolName is the tool the low UserAgent calls to request escalation
+const EscalateToolName = "escalate_to_high"
+
+// defaultEscalationPrefix is the reply prefix of EscalationTriggerPrefix when Prefix is empty
+const defaultEscalationPrefix = "ESCALATE:"
+
+// EscalationPolicy controls when a message sent to the low UserAgent is retried with the high one.
+// The zero value escalates on the "ESCALATE:" prefix and on the escalate_to_high tool.
+type EscalationPolicy struct {
+	// Triggers enabled (default: prefix and tool)
+	Triggers []EscalationTrigger
+	// Prefix of the low agent's reply that requests escalation (default: "ESCALATE:")
+	Prefix string
+	// ConfidenceThreshold escalates replies whose reported confidence is below it (confidence trigger)
+	ConfidenceThreshold float64
+	// Disabled turns escalation off: the low agent's reply is always returned as is
+	Disabled bool
+}
+
+// DefaultEscalationPolicy returns the default policy (prefix and tool triggers)
+func DefaultEscalationPolicy() EscalationPolicy {
+	return EscalationPolicy{
+		Triggers: []EscalationTrigger{EscalationTriggerPrefix, EscalationTriggerTool},
+		Prefix:   defaultEscalationPrefix,
+	}
+}
+
+// has reports whether trigger is enabled
+func (p EscalationPolicy) has(trigger EscalationTrigger) bool {
+	if p.Disabled {
+		return false
+	}
+	triggers := p.Triggers
+	if len(triggers) == 0 {
+		triggers = DefaultEscalationPolicy().Triggers
+	}
+	for _, t := range triggers {
+		if t == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+// confidenceLineRe matches the confidence line of a low agent reply
+var confidenceLineRe = regexp.MustCompile(`(?im)^\s*CONFIDENCE:\s*([0-9]*\.?[0-9]+)\s*$`)
+
+// escalationDecision is the outcome of evaluating a low agent reply against the policy
+type escalationDecision struct {
+	Escalate bool
+	Trigger  EscalationTrigger
+	Reason   string
+	Reply    string // the reply to return if not escalated (confidence line removed)
+}
+
+// evaluate decides whether reply (and a tool request, if the low agent made one) escalates
+func (p EscalationPolicy) evaluate(reply string, request *escalationRequest) escalationDecision {
+	d := escalationDecision{Reply: reply}
+	if p.Disabled {
+		return d
+	}
+
+	if p.has(EscalationTriggerTool) && request != nil {
+		if reason, ok := request.get(); ok {
+			return escalationDecision{Escalate: true, Trigger: EscalationTriggerTool, Reason: reason, Reply: reply}
+		}
+	}
+
+	if p.has(EscalationTriggerPrefix) {
+		prefix := p.Prefix
+		if prefix == "" {
+			prefix = defaultEscalationPrefix
+		}
+		if trimmed := strings.TrimSpace(reply); strings.HasPrefix(trimmed, prefix) {
+			reason := strings.TrimSpace(strings.TrimPrefix(trimmed, prefix))
+			return escalationDecision{Escalate: true, Trigger: EscalationTriggerPrefix, Reason: reason, Reply: reply}
+		}
+	}
+
+	if p.has(EscalationTriggerConfidence) {
+		if m := confidenceLineRe.FindStringSubmatch(reply); m != nil {
+			d.Reply = strings.TrimSpace(confidenceLineRe.ReplaceAllString(reply, ""))
+			if confidence, err := strconv.ParseFloat(m[1], 64); err == nil && confidence < p.ConfidenceThreshold {
+				return escalationDecision{Escalate: true, Trigger: EscalationTriggerConfidence, Reason: "confidence " + m[1], Reply: d.Reply}
+			}
+		}
+	}
+	return d
+}
+
+// escalationRequest records an escalate_to_high call made while the low agent handles a message
+type escalationRequest struct {
+	mu        sync.Mutex
+	requested bool
+	reason    string
+}
+
+func (r *escalationRequest) set(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requested = true
+	r.reason = reason
+}
+
+func (r *escalationRequest) get() (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reason, r.requested
+}
+
+type escalationCtxKey struct{}
+
+// withEscalationRequest attaches an escalation request the escalate_to_high tool can fill in
+func withEscalationRequest(ctx context.Context, r *escalationRequest) context.Context {
+	return context.WithValue(ctx, escalationCtxKey{}, r)
+}
+
+// escalateTool is the escalate_to_high tool added to the low UserAgent
+func escalateTool(ctx context.Context, args map[string]interface{}) (string, error) {
+	r, ok := ctx.Value(escalationCtxKey{}).(*escalationRequest)
+	if !ok || r == nil {
+		return "Escalation is not available here; answer the user yourself.", nil
+	}
+	reason, _ := args["reason"].(string)
+	r.set(strings.TrimSpace(reason))
+	return "Escalation requested: the high-level agent will take over this message. Stop here and reply with a one-line summary of the request.", nil
+}
+
+// escalateToolDefinition is the definition of escalate_to_high
+var escalateToolDefinition = openai.FunctionDefinition{
+	Name:        EscalateToolName,
+	Description: "Hand this message over to the high-level agent when it needs deeper reasoning, coding, multi-step work or knowledge you lack. Call it instead of guessing.",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"reason": map[string]interface{}{
+				"type":        "string",
+				"description": "Why the high-level agent is needed",
+			},
+		},
+		"required": []string{"reason"},
+	},
+}
+
+// callUserAgentLow sends a message to UserAgent-Low and retries it with UserAgent-High when
+// the reply escalates under the configured EscalationPolicy
+func (ch *CoreHandler) callUserAgentLow(ctx context.Context, userID, sessionID string, args map[string]interface{}) (string, error) {
+	agentType := model.AgentTypeLow
+	notifyStatus(ctx, userID, "", StatusAgentCalling, string(agentType))
+	if ch.Callback != nil {
+		if cbErr := ch.Callback.BeforeAction(ctx, &UsageEvent{
+			UserID: userID, EventType: EventAgentRouting, Name: string(agentType),
+		}); cbErr != nil {
+			return FormatBlockedActionResult(cbErr), nil
+		}
+	}
+
+	request := &escalationRequest{}
+	result, err := ch.callUserAgent(withEscalationRequest(ctx, request), userID, args, ch.userAgentLow, agentType)
+	if err != nil {
+		return "", err
+	}
+	if ch.Callback != nil {
+		ch.Callback.AfterAction(ctx, &UsageEvent{
+			UserID: userID, SessionID: sessionID, EventType: EventAgentRouting, Name: string(agentType),
+		})
+	}
+
+	decision := ch.config.Escalation.evaluate(result, request)
+	if !decision.Escalate {
+		notifyStatus(ctx, userID, "", StatusAgentDone, string(agentType))
+		return decision.Reply, nil
+	}
+
+	ch.logger().Info("[CoreHandler] ⬆️  Escalating to high agent", "user_id", userID, "trigger", decision.Trigger, "reason", decision.Reason)
+	if ch.Callback != nil {
+		ch.Callback.AfterAction(ctx, &UsageEvent{
+			UserID: userID, SessionID: sessionID, EventType: EventEscalation, Name: string(model.AgentTypeHigh),
+			Metadata: map[string]interface{}{"trigger": string(decision.Trigger), "reason": decision.Reason},
+		})
+	}
+	notifyStatus(ctx, userID, "", StatusAgentCalling, string(model.AgentTypeHigh)+" (escalated)")
+	result, err = ch.callUserAgent(ctx, userID, args, ch.userAgentHigh, model.AgentTypeHigh)
+	if ch.Callback != nil {
+		ch.Callback.AfterAction(ctx, &UsageEvent{
+			UserID: userID, SessionID: sessionID, EventType: EventAgentRouting, Name: string(model.AgentTypeHigh), Error: err,
+		})
+	}
+	notifyStatus(ctx, userID, "", StatusAgentDone, string(model.AgentTypeHigh))
+	return result, err
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEscalationPolicyEvaluate(t *testing.T) {
+	policy := EscalationPolicy{Triggers: []EscalationTrigger{EscalationTriggerPrefix, EscalationTriggerConfidence}, ConfidenceThreshold: 0.5}
+
+	if d := policy.evaluate("  ESCALATE: needs code review", nil); !d.Escalate || d.Trigger != EscalationTriggerPrefix || d.Reason != "needs code review" {
+		t.Errorf("Expected prefix escalation, got %+v", d)
+	}
+	if d := policy.evaluate("Maybe 42.\nCONFIDENCE: 0.3", nil); !d.Escalate || d.Trigger != EscalationTriggerConfidence {
+		t.Errorf("Expected confidence escalation, got %+v", d)
+	}
+	if d := policy.evaluate("It is 42.\nconfidence: 0.9", nil); d.Escalate || d.Reply != "It is 42." {
+		t.Errorf("Expected a confident reply without its confidence line, got %+v", d)
+	}
+
+	// The tool trigger is not enabled in this policy
+	request := &escalationRequest{}
+	request.set("hard")
+	if d := policy.evaluate("fine", request); d.Escalate {
+		t.Errorf("Tool trigger should be ignored when not enabled, got %+v", d)
+	}
+	if d := (EscalationPolicy{Disabled: true}).evaluate("ESCALATE: x", request); d.Escalate {
+		t.Errorf("Disabled policy should never escalate, got %+v", d)
+	}
+}
+
+// escalationRecorder is a Callback that records escalation events
+type escalationRecorder struct {
+	mu     sync.Mutex
+	events []*UsageEvent
+}
+
+func (r *escalationRecorder) BeforeAction(context.Context, *UsageEvent) error { return nil }
+
+func (r *escalationRecorder) AfterAction(_ context.Context, event *UsageEvent) {
+	if event.EventType == EventEscalation {
+		r.mu.Lock()
+		r.events = append(r.events, event)
+		r.mu.Unlock()
+	}
+}
+
+func TestCoreHandlerEscalation(t *testing.T) {
+	// Fake LLM: the high model answers; the low model escalates by prefix or by calling escalate_to_high
+	var lowMode string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "high answer"}
+		finish := openai.FinishReasonStop
+		last := req.Messages[len(req.Messages)-1]
+		if req.Model == "low" {
+			switch {
+			case lowMode == "prefix":
+				msg.Content = "ESCALATE: needs deeper reasoning"
+			case last.Role == openai.ChatMessageRoleTool:
+				msg.Content = "handing over"
+			default:
+				msg = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{
+					ID: "call_1", Type: openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: EscalateToolName, Arguments: `{"reason":"multi-step refactor"}`},
+				}}}
+				finish = openai.FinishReasonToolCalls
+			}
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: msg, FinishReason: finish}}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	functions := model.NewFunctionRegistry()
+	newAgent := func(modelName string) *Engine {
+		e := &Engine{Repo: repo, Sessions: sqliteStore, Functions: functions}
+		if err := e.Init(); err != nil {
+			t.Fatalf("Failed to init engine: %v", err)
+		}
+		if err := e.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: modelName}); err != nil {
+			t.Fatalf("UseLLMConfig failed: %v", err)
+		}
+		return e
+	}
+	high, low := newAgent("high"), newAgent("low")
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), high, low, DefaultCoreHandlerConfig())
+	recorder := &escalationRecorder{}
+	ch.SetCallback(recorder)
+
+	// Only the low agent is offered escalate_to_high, although both share a registry
+	session := &model.Session{}
+	hasEscalateTool := func(e *Engine) bool {
+		for _, tool := range e.GetTools(session) {
+			if tool.Function.Name == EscalateToolName {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasEscalateTool(low) || hasEscalateTool(high) {
+		t.Fatal("escalate_to_high should be offered to the low agent only")
+	}
+
+	for _, mode := range []string{"prefix", "tool"} {
+		lowMode = mode
+		result, err := ch.runCoreToolImpl(context.Background(), "user1", "core-session", openai.ToolCall{
+			Function: openai.FunctionCall{Name: "call_user_agent_low", Arguments: `{"message":"refactor my service"}`},
+		})
+		if err != nil || result != "high answer" {
+			t.Fatalf("%s: expected the high agent's answer, got %q (%v)", mode, result, err)
+		}
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.events) != 2 {
+		t.Fatalf("Expected 2 escalation events, got %d", len(recorder.events))
+	}
+	if got := recorder.events[0].Metadata["trigger"]; got != string(EscalationTriggerPrefix) {
+		t.Errorf("Expected prefix trigger first, got %v", got)
+	}
+	if got := recorder.events[1].Metadata; got["trigger"] != string(EscalationTriggerTool) || got["reason"] != "multi-step refactor" {
+		t.Errorf("Expected tool trigger with its reason, got %v", got)
+	}
+}
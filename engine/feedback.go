@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// EventFeedback is the UsageEvent type recorded (AfterAction only) when a user rates an answer
+// (see CoreHandler.RecordFeedback). Name is "up" or "down"; Metadata has the message_id, the
+// rating and the comment.
+const EventFeedback EventType = "feedback"
+
+// ErrMessageNotFound is returned by RecordFeedback when the rated message does not exist
+var ErrMessageNotFound = errors.New("message not found")
+
+// RecordFeedback stores userID's rating (model.FeedbackUp or model.FeedbackDown) of an answer,
+// replacing their previous rating of it, and reports it to the Callback (EventFeedback).
+// When the store keeps messages, the message must be an answer to userID. The store must
+// implement model.FeedbackStore.
+func (ch *CoreHandler) RecordFeedback(ctx context.Context, userID, messageID string, rating int, comment string) (*model.Feedback, error) {
+	sessionStore := ch.sessionHandler.GetStore()
+	feedbackStore, ok := sessionStore.(model.FeedbackStore)
+	if !ok {
+		return nil, fmt.Errorf("the store does not record feedback")
+	}
+	feedback := model.NewFeedback(userID, messageID, rating, comment)
+	if err := feedback.Validate(); err != nil {
+		return nil, err
+	}
+
+	if messageStore, ok := sessionStore.(interface {
+		GetMessagesBySession(string) ([]*model.Message, error)
+	}); ok {
+		message, err := findMessage(messageStore.GetMessagesBySession, messageID)
+		if err != nil {
+			return nil, err
+		}
+		if message.UserID != userID {
+			return nil, fmt.Errorf("%w: message %s belongs to another user", ErrAccessDenied, messageID)
+		}
+		if message.Role != openai.ChatMessageRoleAssistant {
+			return nil, fmt.Errorf("%w: message %s is not an answer", model.ErrInvalidFeedback, messageID)
+		}
+		feedback.SessionID = message.SessionID
+	}
+
+	if err := feedbackStore.PutFeedback(feedback); err != nil {
+		return nil, err
+	}
+	ch.logger().Info("[CoreHandler] 👍 Feedback recorded", "user_id", userID, "message_id", messageID, "rating", rating)
+
+	if ch.Callback != nil {
+		name := "up"
+		if rating == model.FeedbackDown {
+			name = "down"
+		}
+		ch.Callback.AfterAction(ctx, &UsageEvent{
+			UserID:    userID,
+			SessionID: feedback.SessionID,
+			EventType: EventFeedback,
+			Name:      name,
+			Metadata:  map[string]interface{}{"message_id": messageID, "rating": rating, "comment": comment},
+		})
+	}
+	return feedback, nil
+}
+
+// findMessage looks messageID up among the messages of the session its ID was generated in
+func findMessage(messagesBySession func(string) ([]*model.Message, error), messageID string) (*model.Message, error) {
+	sessionID := model.MessageSessionID(messageID)
+	if sessionID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+	}
+	messages, err := messagesBySession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	for _, message := range messages {
+		if message.MessageID == messageID {
+			return message, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestCoreHandlerRecordFeedback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "It costs 10 EUR."},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	callback := &usageCallback{}
+	ch.Callback = callback
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := ch.ProcessMessage(ctx, "user1", "How much is it?"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	messages, err := sqliteStore.GetMessagesByUser("user1")
+	if err != nil {
+		t.Fatalf("GetMessagesByUser failed: %v", err)
+	}
+	var answer, question *model.Message
+	for _, msg := range messages {
+		switch msg.Role {
+		case openai.ChatMessageRoleAssistant:
+			answer = msg
+		case openai.ChatMessageRoleUser:
+			question = msg
+		}
+	}
+	if answer == nil || question == nil {
+		t.Fatalf("Expected a stored question and answer, got %d messages", len(messages))
+	}
+
+	feedback, err := ch.RecordFeedback(ctx, "user1", answer.MessageID, model.FeedbackDown, "wrong price")
+	if err != nil {
+		t.Fatalf("RecordFeedback failed: %v", err)
+	}
+	if feedback.SessionID != answer.SessionID {
+		t.Errorf("Expected the feedback in session %s, got %s", answer.SessionID, feedback.SessionID)
+	}
+	last := callback.events[len(callback.events)-1]
+	if last.EventType != EventFeedback || last.Name != "down" || last.Metadata["message_id"] != answer.MessageID {
+		t.Errorf("Expected a feedback event, got %+v", last)
+	}
+
+	// Rating again replaces the rating
+	if _, err := ch.RecordFeedback(ctx, "user1", answer.MessageID, model.FeedbackUp, ""); err != nil {
+		t.Fatalf("RecordFeedback failed: %v", err)
+	}
+	stats, err := sqliteStore.GetFeedbackStats(model.FeedbackFilter{MessageID: answer.MessageID})
+	if err != nil || stats.Total != 1 || stats.Up != 1 {
+		t.Errorf("Expected one thumbs up, got %+v (err %v)", stats, err)
+	}
+
+	if _, err := ch.RecordFeedback(ctx, "user1", answer.MessageID, 0, ""); !errors.Is(err, model.ErrInvalidFeedback) {
+		t.Errorf("Expected ErrInvalidFeedback for a zero rating, got %v", err)
+	}
+	if _, err := ch.RecordFeedback(ctx, "user1", question.MessageID, model.FeedbackUp, ""); !errors.Is(err, model.ErrInvalidFeedback) {
+		t.Errorf("Expected ErrInvalidFeedback for rating a question, got %v", err)
+	}
+	if _, err := ch.RecordFeedback(ctx, "user2", answer.MessageID, model.FeedbackUp, ""); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected ErrAccessDenied for another user's answer, got %v", err)
+	}
+	if _, err := ch.RecordFeedback(ctx, "user1", answer.SessionID+"-m9999", model.FeedbackUp, ""); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// RegisterFunction adds a tool at runtime, e.g. from a plugin loaded after startup.
+// The definition is offered to the model from the next message on (see GetTools) and the
+// handler receives the context of the message that called it. Safe for concurrent use;
+// fails if a tool with the same name is already registered.
+func (e *Engine) RegisterFunction(name string, def openai.FunctionDefinition, handler func(ctx context.Context, args map[string]any) (string, error)) error {
+	if e.Functions == nil {
+		return fmt.Errorf("function registry is not configured")
+	}
+	if err := e.Functions.RegisterContext(name, "", handler); err != nil {
+		return err
+	}
+	if err := e.Functions.SetDefinition(name, def); err != nil {
+		return err
+	}
+	e.logger().Info("[Engine] 🔌 Function registered", "name", name)
+	return nil
+}
+
+// RegisterMCPFunction registers a tool like RegisterFunction, recording that it is proxied to the
+// named MCP server (see the mcp package): its tool call records carry the server's name
+func (e *Engine) RegisterMCPFunction(server string, name string, def openai.FunctionDefinition, handler func(ctx context.Context, args map[string]any) (string, error)) error {
+	if err := e.RegisterFunction(name, def, handler); err != nil {
+		return err
+	}
+	return e.Functions.SetMCPServer(name, server)
+}
+
+// mcpServer returns the MCP server a tool is proxied to ("" for other tools)
+func (e *Engine) mcpServer(name string) string {
+	e.localToolsMu.RLock()
+	_, local := e.localTools[name]
+	e.localToolsMu.RUnlock()
+	if local || e.Functions == nil {
+		return ""
+	}
+	return e.Functions.GetMCPServer(name)
+}
+
+// UnregisterFunction removes a tool added with RegisterFunction (or any registered tool).
+// Returns false if no tool had that name.
+func (e *Engine) UnregisterFunction(name string) bool {
+	if e.Functions == nil || !e.Functions.Unregister(name) {
+		return false
+	}
+	e.logger().Info("[Engine] 🔌 Function unregistered", "name", name)
+	return true
+}
+
+// localTool is a tool offered and executed by one engine only
+type localTool struct {
+	def openai.FunctionDefinition
+	fn  model.ContextToolFunction
+}
+
+// addLocalTool adds a tool to this engine alone, e.g. escalate_to_high on the low UserAgent
+// whose function registry is shared with the high one. It takes precedence over registry tools.
+func (e *Engine) addLocalTool(def openai.FunctionDefinition, fn model.ContextToolFunction) {
+	e.localToolsMu.Lock()
+	defer e.localToolsMu.Unlock()
+	if e.localTools == nil {
+		e.localTools = make(map[string]localTool)
+	}
+	e.localTools[def.Name] = localTool{def: def, fn: fn}
+}
+
+// localToolDefinitions returns the definitions of the tools added with addLocalTool
+func (e *Engine) localToolDefinitions() []openai.Tool {
+	e.localToolsMu.RLock()
+	defer e.localToolsMu.RUnlock()
+	tools := make([]openai.Tool, 0, len(e.localTools))
+	for _, tool := range e.localTools {
+		def := tool.def
+		tools = append(tools, openai.Tool{Type: openai.ToolTypeFunction, Function: &def})
+	}
+	// Sorted, so the tools of a request stay the same from turn to turn (prompt caching)
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Function.Name < tools[j].Function.Name })
+	return tools
+}
+
+// defaultToolTimeout bounds a tool call when neither LLMConfig.ToolTimeout nor the tool sets a timeout
+const defaultToolTimeout = 2 * time.Minute
+
+// SetToolTimeout overrides LLMConfig.ToolTimeout for one registered tool
+// (0 restores the default, a negative value runs it without a timeout)
+func (e *Engine) SetToolTimeout(name string, timeout time.Duration) error {
+	if e.Functions == nil {
+		return fmt.Errorf("function registry is not configured")
+	}
+	return e.Functions.SetTimeout(name, timeout)
+}
+
+// toolTimeout returns the timeout of a call to the tool name (0: none)
+func (e *Engine) toolTimeout(name string) time.Duration {
+	timeout := e.llmConfig.ToolTimeout
+	if e.Functions != nil {
+		if t := e.Functions.GetTimeout(name); t != 0 {
+			timeout = t
+		}
+	}
+	if timeout == 0 {
+		return defaultToolTimeout
+	}
+	if timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+// runTool executes a tool call within its timeout, turning a timeout into *model.ToolTimeoutError
+// and a panic into *model.ToolPanicError so one bad handler cannot hang or crash the message loop.
+func (e *Engine) runTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	toolCtx := ctx
+	timeout := e.toolTimeout(name)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		toolCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	result, err := runUntilDone(toolCtx, name, func() (string, error) { return e.callTool(toolCtx, name, args) })
+	if err != nil && ctx.Err() == nil && errors.Is(toolCtx.Err(), context.DeadlineExceeded) {
+		e.logger().Warn("[Engine] ⏱️  Tool timed out", "name", name, "timeout", timeout)
+		return "", &model.ToolTimeoutError{ToolName: name, Timeout: timeout}
+	}
+	return result, err
+}
+
+// callTool calls the tool's function. Local and context-aware functions (see RegisterFunction)
+// get ctx; everything else goes through Executor, or the registry if there is none.
+// The registry's middlewares (see model.FunctionRegistry.Use) run around every call.
+func (e *Engine) callTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	e.localToolsMu.RLock()
+	local, ok := e.localTools[name]
+	e.localToolsMu.RUnlock()
+	if ok {
+		if e.Functions != nil {
+			return e.Functions.Wrap(name, local.fn)(ctx, args)
+		}
+		return local.fn(ctx, args)
+	}
+	if e.Functions != nil && (e.Executor == nil || e.Functions.HasContext(name)) {
+		return e.Functions.ExecuteContext(ctx, name, args)
+	}
+	if e.Executor == nil {
+		return "", &model.FunctionNotFoundError{ToolName: name}
+	}
+	if e.Functions != nil {
+		return e.Functions.Wrap(name, func(_ context.Context, args map[string]interface{}) (string, error) {
+			return e.Executor(name, args)
+		})(ctx, args)
+	}
+	return e.Executor(name, args)
+}
+
+// runUntilDone runs fn, a tool that may ignore ctx, but stops waiting for it when ctx is done
+// so a cancelled or timed out call releases its session promptly; the late result is discarded.
+// A panic in fn is recovered and returned as *model.ToolPanicError.
+func runUntilDone(ctx context.Context, name string, fn func() (string, error)) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	type toolResult struct {
+		result string
+		err    error
+	}
+	done := make(chan toolResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Log.Error("[Engine] ❌ Tool panicked", "name", name, "panic", r, "stack", string(debug.Stack()))
+				done <- toolResult{err: &model.ToolPanicError{ToolName: name, Value: r}}
+			}
+		}()
+		result, err := fn()
+		done <- toolResult{result, err}
+	}()
+	select {
+	case r := <-done:
+		return r.result, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// isBareTool reports whether tool has a name only, without description or parameters
+func isBareTool(tool openai.Tool) bool {
+	return tool.Function == nil || (tool.Function.Description == "" && tool.Function.Parameters == nil)
+}
@@ -0,0 +1,553 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEngineRegisterFunctionAtRuntime(t *testing.T) {
+	// Fake chat completions endpoint: calls get_weather if offered, then answers with its result
+	var mu sync.Mutex
+	var offered [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		var names []string
+		for _, tool := range req.Tools {
+			names = append(names, tool.Function.Name)
+		}
+		mu.Lock()
+		offered = append(offered, names)
+		mu.Unlock()
+
+		last := req.Messages[len(req.Messages)-1]
+		choice := openai.ChatCompletionChoice{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "no tool"},
+			FinishReason: openai.FinishReasonStop,
+		}
+		switch {
+		case last.Role == openai.ChatMessageRoleTool:
+			choice.Message.Content = "weather: " + last.Content
+		case len(names) > 0:
+			choice.Message = openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleAssistant,
+				ToolCalls: []openai.ToolCall{{
+					ID:       "call_1",
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`},
+				}},
+			}
+			choice.FinishReason = openai.FinishReasonToolCalls
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore, Functions: model.NewFunctionRegistry()}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	if err := e.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	ctx := context.Background()
+
+	if reply, _, err := e.ProcessMessage(ctx, session.SessionID, "weather?"); err != nil || reply != "no tool" {
+		t.Fatalf("Expected no tool before registration, got %q (%v)", reply, err)
+	}
+
+	// Register mid-lifecycle; the handler sees the message context
+	err = e.RegisterFunction("get_weather", openai.FunctionDefinition{
+		Description: "Current weather for a city",
+		Parameters:  map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+	}, func(ctx context.Context, args map[string]any) (string, error) {
+		userID, _ := model.GetUserIDFromContext(ctx)
+		return args["city"].(string) + " sunny for " + userID, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunction failed: %v", err)
+	}
+	if err := e.RegisterFunction("get_weather", openai.FunctionDefinition{}, nil); err == nil {
+		t.Error("Expected an error registering get_weather twice")
+	}
+
+	reply, _, err := e.ProcessMessage(ctx, session.SessionID, "weather?")
+	if err != nil || reply != "weather: Paris sunny for user1" {
+		t.Fatalf("Expected the model to call get_weather, got %q (%v)", reply, err)
+	}
+
+	if !e.UnregisterFunction("get_weather") || e.UnregisterFunction("get_weather") {
+		t.Error("Expected get_weather to be unregistered exactly once")
+	}
+	if reply, _, err := e.ProcessMessage(ctx, session.SessionID, "weather?"); err != nil || reply != "no tool" {
+		t.Fatalf("Expected no tool after unregistration, got %q (%v)", reply, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(offered) != 4 || len(offered[0]) != 0 || len(offered[1]) != 1 || len(offered[3]) != 0 {
+		t.Errorf("Unexpected tools offered per request: %v", offered)
+	}
+}
+
+func TestEngineProcessMessageCancelled(t *testing.T) {
+	// Fake chat completions endpoint that always asks for slow_tool
+	var llmCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		llmCalls.Add(1)
+		choice := openai.ChatCompletionChoice{
+			Message: openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleAssistant,
+				ToolCalls: []openai.ToolCall{{
+					ID:       "call_1",
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: "slow_tool", Arguments: `{}`},
+				}},
+			},
+			FinishReason: openai.FinishReasonToolCalls,
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	// The executor ignores cancellation and blocks until the test ends
+	release := make(chan struct{})
+	defer close(release)
+	toolStarted := make(chan struct{}, 1)
+	e := &Engine{Repo: repo, Sessions: sqliteStore, Executor: func(string, map[string]interface{}) (string, error) {
+		toolStarted <- struct{}{}
+		<-release
+		return "late", nil
+	}}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	if err := e.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-toolStarted
+		cancel()
+	}()
+
+	start := time.Now()
+	_, _, err = e.ProcessMessage(ctx, session.SessionID, "hello")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected a prompt return after cancel, took %s", elapsed)
+	}
+
+	// The session is released and no further LLM calls follow the cancellation
+	time.Sleep(100 * time.Millisecond)
+	if got := llmCalls.Load(); got != 1 {
+		t.Errorf("Expected exactly 1 LLM call, got %d", got)
+	}
+	if e.sessionProgress.TryQueue(session.SessionID, "again") {
+		t.Error("Expected the session to no longer be in progress")
+	}
+	lock, releaseLock := e.acquireSessionLock(session.SessionID)
+	if !lock.mu.TryLock() {
+		t.Error("Expected the session lock to be released")
+	}
+	releaseLock()
+}
+
+func TestEngineBindTool(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root", "docs"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "tools.json"), []byte(`{"tools": [{"name": "search_docs", "description": "Search", "input_schema": {"type": "object"}}]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "docs", "node.md"), []byte("# Docs"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "docs", "tools.json"), []byte(`{"tools": [{"name": "search_docs", "description": "Search", "input_schema": {"type": "object"}}, {"name": "open_doc", "description": "Open", "input_schema": {"type": "object"}}]}`), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore, Functions: model.NewFunctionRegistry()}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Init should only warn about unbound tools: %v", err)
+	}
+	unbound := e.UnboundTools()
+	if len(unbound) != 2 || unbound[0].Name != "open_doc" || unbound[1].Name != "search_docs" || len(unbound[1].Nodes) != 2 {
+		t.Fatalf("Unexpected unbound tools: %+v", unbound)
+	}
+	e.SetStrictTools(true)
+	var missing *model.MissingFunctionsError
+	if err := e.Init(); !errors.As(err, &missing) || len(missing.MissingTools) != 2 {
+		t.Fatalf("Expected strict Init to fail with missing tools, got %v", err)
+	}
+
+	// Calling an unbound tool yields a structured result instead of an error
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	result, _ := e.executeTool(context.Background(), session, "msg1", openai.ToolCall{
+		ID:       "call_1",
+		Function: openai.FunctionCall{Name: "open_doc", Arguments: `{}`},
+	})
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(result), &payload); err != nil || payload["error"] != "tool_not_implemented" || payload["tool"] != "open_doc" {
+		t.Fatalf("Expected tool_not_implemented result, got %q", result)
+	}
+
+	handler := func(args map[string]interface{}) (string, error) { return "ok", nil }
+	if err := e.BindTool("search_docs", handler); err != nil {
+		t.Fatalf("BindTool failed: %v", err)
+	}
+	if err := e.BindTool("open_doc", handler); err != nil {
+		t.Fatalf("BindTool failed: %v", err)
+	}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Strict Init should pass once all tools are bound: %v", err)
+	}
+	if result, _ := e.executeTool(context.Background(), session, "msg2", openai.ToolCall{
+		ID:       "call_2",
+		Function: openai.FunctionCall{Name: "open_doc", Arguments: `{}`},
+	}); result != "ok" {
+		t.Fatalf("Expected bound handler result, got %q", result)
+	}
+}
+
+// toolEventRecorder is a Callback that records tool call events
+type toolEventRecorder struct {
+	mu     sync.Mutex
+	events []*UsageEvent
+}
+
+func (r *toolEventRecorder) BeforeAction(context.Context, *UsageEvent) error { return nil }
+
+func (r *toolEventRecorder) AfterAction(_ context.Context, event *UsageEvent) {
+	if event.EventType == EventToolCall {
+		r.mu.Lock()
+		r.events = append(r.events, event)
+		r.mu.Unlock()
+	}
+}
+
+func TestEngineToolTimeoutAndPanic(t *testing.T) {
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	functions := model.NewFunctionRegistry()
+	release := make(chan struct{})
+	defer close(release)
+	functions.Register("hang", "", func(map[string]interface{}) (string, error) {
+		<-release // ignores any context
+		return "late", nil
+	})
+	functions.Register("boom", "", func(map[string]interface{}) (string, error) {
+		panic("nil map write")
+	})
+	functions.Register("slow", "", func(map[string]interface{}) (string, error) {
+		time.Sleep(100 * time.Millisecond)
+		return "done", nil
+	})
+
+	recorder := &toolEventRecorder{}
+	e := &Engine{Sessions: sqliteStore, Functions: functions, Callback: recorder}
+	e.llmConfig.ToolTimeout = 50 * time.Millisecond
+	if err := e.SetToolTimeout("slow", time.Second); err != nil {
+		t.Fatalf("SetToolTimeout failed: %v", err)
+	}
+	session := &model.Session{UserID: "user1", SessionID: "session1"}
+	call := func(name string) string {
+		result, _ := e.executeTool(context.Background(), session, "", openai.ToolCall{
+			ID: "call_" + name, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: "{}"},
+		})
+		return result
+	}
+
+	start := time.Now()
+	if result := call("hang"); !strings.Contains(result, "did not finish within 50ms") {
+		t.Errorf("Expected a timeout result, got %q", result)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Hanging tool blocked for %s", elapsed)
+	}
+	if result := call("boom"); !strings.Contains(result, "internal error") {
+		t.Errorf("Expected a panic result, got %q", result)
+	}
+	if result := call("slow"); result != "done" {
+		t.Errorf("Per-tool timeout should override the default, got %q", result)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.events) != 3 {
+		t.Fatalf("Expected 3 tool events, got %d", len(recorder.events))
+	}
+	var timedOut *model.ToolTimeoutError
+	if ev := recorder.events[0]; !errors.As(ev.Error, &timedOut) || ev.Duration < 50*time.Millisecond {
+		t.Errorf("Expected a ToolTimeoutError with its duration, got %v (%s)", ev.Error, ev.Duration)
+	}
+	var panicked *model.ToolPanicError
+	if ev := recorder.events[1]; !errors.As(ev.Error, &panicked) || panicked.Value != "nil map write" {
+		t.Errorf("Expected a ToolPanicError, got %v", ev.Error)
+	}
+	if ev := recorder.events[2]; ev.Error != nil {
+		t.Errorf("Expected the slow tool to succeed, got %v", ev.Error)
+	}
+}
+
+func TestEngineToolArgValidation(t *testing.T) {
+	// The model first sends arguments that cannot be repaired, then near-valid ones
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		last := req.Messages[len(req.Messages)-1]
+		call := func(id, args string) openai.ChatCompletionChoice {
+			return openai.ChatCompletionChoice{
+				Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{
+					ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "book_room", Arguments: args},
+				}}},
+				FinishReason: openai.FinishReasonToolCalls,
+			}
+		}
+		choice := call("call_1", `{"duration_hours": "two",}`)
+		if last.Role == openai.ChatMessageRoleTool {
+			choice = openai.ChatCompletionChoice{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: last.Content},
+				FinishReason: openai.FinishReasonStop,
+			}
+			if strings.Contains(last.Content, "invalid_arguments") {
+				choice = call("call_2", "```json\n{'duration_hours': '2',}\n```")
+			}
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore, Functions: model.NewFunctionRegistry()}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	if err := e.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	var calls []interface{}
+	e.RegisterFunction("book_room", openai.FunctionDefinition{
+		Description: "Book a meeting room",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"duration_hours": map[string]interface{}{"type": "number"}},
+			"required":   []string{"duration_hours"},
+		},
+	}, func(ctx context.Context, args map[string]any) (string, error) {
+		calls = append(calls, args["duration_hours"])
+		return "booked", nil
+	})
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	reply, _, err := e.ProcessMessage(context.Background(), session.SessionID, "book a room for two hours")
+	if err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	if reply != "booked" || len(calls) != 1 || calls[0] != float64(2) {
+		t.Fatalf("Expected one call with the repaired argument, got %q and %v", reply, calls)
+	}
+
+	toolCalls, err := sqliteStore.GetToolCallsBySession(session.SessionID)
+	if err != nil || len(toolCalls) != 2 {
+		t.Fatalf("Expected 2 tool call records, got %d (%v)", len(toolCalls), err)
+	}
+	byID := map[string]*model.ToolCall{}
+	for _, tc := range toolCalls {
+		byID[tc.ToolCallID] = tc
+	}
+	invalid, repaired := byID["call_1"], byID["call_2"]
+	if invalid.ArgsValidation != model.ToolArgsInvalid || invalid.Status != model.ToolCallStatusFailed ||
+		!strings.Contains(invalid.Response, `argument 'duration_hours' must be a number, got \"two\"`) {
+		t.Errorf("Unexpected invalid call record %+v", invalid)
+	}
+	if repaired.ArgsValidation != model.ToolArgsRepaired || repaired.Status != model.ToolCallStatusSuccess ||
+		!strings.Contains(repaired.ArgsValidationDetail, "coerced argument 'duration_hours' to number") {
+		t.Errorf("Unexpected repaired call record %+v", repaired)
+	}
+}
+
+func TestEngineSessionLockAcrossEngines(t *testing.T) {
+	// Fake chat completions endpoint tracking how many calls run at once
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			max := maxInFlight.Load()
+			if n <= max || maxInFlight.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Noted"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	// Two engines on one store, like the Agentize engine and a CoreHandler UserAgent
+	engines := make([]*Engine, 2)
+	for i := range engines {
+		engines[i] = &Engine{Repo: repo, Sessions: sqliteStore, Functions: model.NewFunctionRegistry()}
+		if err := engines[i].Init(); err != nil {
+			t.Fatalf("Failed to init engine: %v", err)
+		}
+		if err := engines[i].UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test"}); err != nil {
+			t.Fatalf("UseLLMConfig failed: %v", err)
+		}
+	}
+	unlock := engines[0].lockSession("s")
+	lock, release := engines[1].acquireSessionLock("s")
+	if lock.mu.TryLock() {
+		t.Fatal("Expected engines on the same store to share session locks")
+	}
+	release()
+	unlock()
+
+	session, err := engines[0].CreateSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 3; i++ {
+				msg := "Please note my order number is " + string(rune('A'+g)) + string(rune('0'+i))
+				if _, _, err := engines[g%2].ProcessMessage(context.Background(), session.SessionID, msg); err != nil {
+					t.Errorf("ProcessMessage failed: %v", err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if got := maxInFlight.Load(); got != 1 {
+		t.Errorf("Expected LLM calls for one session to be serialized, got %d at once", got)
+	}
+	// Locks of idle sessions are dropped
+	sessionLocksMu.Lock()
+	for key := range sessionLocks {
+		if key.owner == store.SessionStore(sqliteStore) {
+			t.Errorf("Expected no session lock left for idle session %q", key.sessionID)
+		}
+	}
+	sessionLocksMu.Unlock()
+
+	messages, err := sqliteStore.GetMessagesBySession(session.SessionID)
+	if err != nil {
+		t.Fatalf("GetMessagesBySession failed: %v", err)
+	}
+	if len(messages) < 4 {
+		t.Fatalf("Expected stored messages, got %d", len(messages))
+	}
+	// SeqIDs must be unique, gapless and follow creation order
+	sort.Slice(messages, func(i, j int) bool { return messages[i].SeqID < messages[j].SeqID })
+	for i, msg := range messages {
+		if msg.SeqID != i+1 {
+			t.Fatalf("Expected SeqID %d, got %d", i+1, msg.SeqID)
+		}
+		if i > 0 && msg.CreatedAt.Before(messages[i-1].CreatedAt) {
+			t.Errorf("SeqID %d was created before SeqID %d", msg.SeqID, messages[i-1].SeqID)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// historyTrimmedNote is the system message put at the start of a session's active messages once
+// the history window has moved older messages out of them
+const historyTrimmedNote = "Earlier context of this conversation was trimmed; see the conversation summary for it."
+
+// isHistoryTrimmedNote reports whether msg is the note added by trimActiveMessages
+func isHistoryTrimmedNote(msg openai.ChatCompletionMessage) bool {
+	return msg.Role == openai.ChatMessageRoleSystem && msg.Content == historyTrimmedNote
+}
+
+// trimActiveMessages keeps msgs, the active messages of session, within maxMessages messages and
+// maxTokens estimated tokens (<= 0: no limit). Older messages are moved to session.ArchivedMsgs and
+// counted in session.TrimmedMsgs until the scheduler summarizes them, and historyTrimmedNote is put
+// first. An assistant tool call is never separated from its tool results, and the last message
+// (with its tool results) is always kept.
+func trimActiveMessages(session *model.Session, msgs []openai.ChatCompletionMessage, maxMessages, maxTokens int) []openai.ChatCompletionMessage {
+	if maxMessages <= 0 && maxTokens <= 0 {
+		return msgs
+	}
+
+	note := len(msgs) > 0 && isHistoryTrimmedNote(msgs[0])
+	conversation := msgs
+	if note {
+		conversation = msgs[1:]
+	}
+
+	fits := func(window []openai.ChatCompletionMessage) bool {
+		if maxMessages > 0 && len(window) > maxMessages {
+			return false
+		}
+		return maxTokens <= 0 || estimatePromptTokens(window, nil) <= maxTokens
+	}
+
+	cut := model.WindowStart(conversation, fits)
+	if cut == 0 {
+		return msgs
+	}
+
+	session.ArchivedMsgs = append(session.ArchivedMsgs, conversation[:cut]...)
+	session.TrimmedMsgs += cut
+
+	trimmed := make([]openai.ChatCompletionMessage, 0, len(conversation)-cut+1)
+	trimmed = append(trimmed, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: historyTrimmedNote})
+	trimmed = append(trimmed, conversation[cut:]...)
+
+	log.Log.Info("[HistoryWindow] ✂️  Trimmed active messages",
+		"session_id", session.SessionID, "moved", cut, "kept", len(conversation)-cut, "pending_summary", session.TrimmedMsgs)
+	return trimmed
+}
+
+// capSessionMessages applies MaxSessionMessages to session before it is saved
+func (e *Engine) capSessionMessages(session *model.Session) {
+	if moved := session.CapMessages(e.MaxSessionMessages); moved > 0 {
+		e.logger().Info("[Engine] ✂️  Capped session messages", "session_id", session.SessionID, "moved", moved, "kept", len(session.Msgs))
+	}
+}
+
+// putCappedSession saves session in the middle of a turn: MaxSessionMessages applies to what is
+// saved, while session keeps all the messages the turn is working with
+func (e *Engine) putCappedSession(session *model.Session) error {
+	msgs, archived, trimmed := session.Msgs, session.ArchivedMsgs, session.TrimmedMsgs
+	defer func() {
+		session.Msgs, session.ArchivedMsgs, session.TrimmedMsgs = msgs, archived, trimmed
+	}()
+	e.capSessionMessages(session)
+	return e.Sessions.Put(session)
+}
+
+// dropOrphanToolMessages returns msgs without the messages the API rejects: tool results that
+// do not answer a tool call of the assistant message right before them, and assistant messages
+// whose tool calls are not all answered (together with their partial results). where names the
+// caller in the warning logged when anything is dropped.
+func dropOrphanToolMessages(msgs []openai.ChatCompletionMessage, where string) []openai.ChatCompletionMessage {
+	var kept []openai.ChatCompletionMessage
+	dropped := 0
+	for i := 0; i < len(msgs); {
+		msg := msgs[i]
+		if msg.Role == openai.ChatMessageRoleTool {
+			// Not preceded by its assistant message
+			dropped++
+			i++
+			continue
+		}
+		if msg.Role != openai.ChatMessageRoleAssistant || len(msg.ToolCalls) == 0 {
+			kept = append(kept, msg)
+			i++
+			continue
+		}
+
+		// An assistant tool call and the tool results that follow it
+		unanswered := make(map[string]bool, len(msg.ToolCalls))
+		for _, tc := range msg.ToolCalls {
+			unanswered[tc.ID] = true
+		}
+		group := []openai.ChatCompletionMessage{msg}
+		j := i + 1
+		for ; j < len(msgs) && msgs[j].Role == openai.ChatMessageRoleTool; j++ {
+			if unanswered[msgs[j].ToolCallID] {
+				delete(unanswered, msgs[j].ToolCallID)
+				group = append(group, msgs[j])
+			} else {
+				dropped++
+			}
+		}
+		if len(unanswered) == 0 {
+			kept = append(kept, group...)
+		} else {
+			dropped += len(group)
+		}
+		i = j
+	}
+
+	if dropped == 0 {
+		return msgs
+	}
+	log.Log.Warn("["+where+"] ⚠️  Dropped orphaned tool messages", "dropped", dropped, "kept", len(kept))
+	return kept
+}
+
+// archivableMessages returns how many leading messages of msgs can be archived without separating
+// a tool call from its results: all of them, unless they end with an assistant tool call that is
+// not fully answered yet (a turn in progress), which stays active with its results
+func archivableMessages(msgs []openai.ChatCompletionMessage) int {
+	end := len(msgs)
+	for end > 0 && msgs[end-1].Role == openai.ChatMessageRoleTool {
+		end--
+	}
+	if end == 0 {
+		return len(msgs)
+	}
+	last := msgs[end-1]
+	if last.Role != openai.ChatMessageRoleAssistant || len(last.ToolCalls) == 0 {
+		return len(msgs)
+	}
+	answered := make(map[string]bool, len(msgs)-end)
+	for _, m := range msgs[end:] {
+		answered[m.ToolCallID] = true
+	}
+	for _, tc := range last.ToolCalls {
+		if !answered[tc.ID] {
+			return end - 1
+		}
+	}
+	return len(msgs)
+}
@@ -0,0 +1,330 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestTrimActiveMessages(t *testing.T) {
+	toolTurn := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "look it up"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "c1"}, {ID: "c2"}}},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "c1", Content: "r1"},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "c2", Content: "r2"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "done"},
+		{Role: openai.ChatMessageRoleUser, Content: "thanks"},
+	}
+
+	// No limits: untouched
+	session := &model.Session{}
+	if got := trimActiveMessages(session, toolTurn, 0, 0); len(got) != len(toolTurn) || len(session.ArchivedMsgs) != 0 {
+		t.Fatalf("Expected no trimming without limits, got %d messages", len(got))
+	}
+
+	// A window of 3 would start at a tool result: the whole tool call pair goes instead
+	got := trimActiveMessages(session, toolTurn, 3, 0)
+	if !isHistoryTrimmedNote(got[0]) {
+		t.Fatalf("Expected the trimmed note first, got %+v", got[0])
+	}
+	if len(got) != 3 || got[1].Content != "done" || got[2].Content != "thanks" {
+		t.Fatalf("Expected [note, done, thanks], got %+v", got)
+	}
+	if len(session.ArchivedMsgs) != 4 || session.TrimmedMsgs != 4 {
+		t.Errorf("Expected 4 archived and pending messages, got %d / %d", len(session.ArchivedMsgs), session.TrimmedMsgs)
+	}
+
+	// Trimming again keeps a single note
+	got = append(got, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "welcome"})
+	got = trimActiveMessages(session, got, 2, 0)
+	if len(got) != 3 || !isHistoryTrimmedNote(got[0]) || isHistoryTrimmedNote(got[1]) || got[1].Content != "thanks" {
+		t.Fatalf("Expected [note, thanks, welcome], got %+v", got)
+	}
+	if session.TrimmedMsgs != 5 {
+		t.Errorf("Expected 5 pending messages, got %d", session.TrimmedMsgs)
+	}
+
+	// The last message is kept with its tool results even when it alone exceeds the token limit
+	session = &model.Session{}
+	pending := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "hi"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "c1"}}},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "c1", Content: strings.Repeat("x", 4000)},
+	}
+	got = trimActiveMessages(session, pending, 0, 100)
+	if len(got) != 3 || got[1].Role != openai.ChatMessageRoleAssistant || got[2].ToolCallID != "c1" {
+		t.Fatalf("Expected [note, tool call, tool result], got %+v", got)
+	}
+	if session.TrimmedMsgs != 1 {
+		t.Errorf("Expected 1 pending message, got %d", session.TrimmedMsgs)
+	}
+}
+
+func TestBuildMessagesKeepsTrimmedNote(t *testing.T) {
+	ch := &CoreHandler{config: CoreHandlerConfig{MaxHistoryMessages: 1}}
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: historyTrimmedNote},
+		{Role: openai.ChatMessageRoleUser, Content: "one"},
+		{Role: openai.ChatMessageRoleUser, Content: "two"},
+	}
+	got := ch.buildMessages([]string{"prompt"}, msgs)
+	if len(got) != 3 || got[0].Content != "prompt" || !isHistoryTrimmedNote(got[1]) || got[2].Content != "two" {
+		t.Fatalf("Expected [prompt, note, two], got %+v", got)
+	}
+
+	ch.config.MaxHistoryMessages = 0
+	if got := ch.buildMessages(nil, msgs); len(got) != 3 {
+		t.Errorf("Expected the note once without a history limit, got %+v", got)
+	}
+}
+
+// toolCallMsg is an assistant message calling the tools with the given IDs
+func toolCallMsg(ids ...string) openai.ChatCompletionMessage {
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	for _, id := range ids {
+		msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{ID: id, Type: openai.ToolTypeFunction})
+	}
+	return msg
+}
+
+// toolResultMsg is the tool message answering the tool call id
+func toolResultMsg(id string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: id, Content: "result " + id}
+}
+
+// assertToolPairs fails unless every tool message answers a tool call of the assistant message
+// right before its group and every tool call is answered
+func assertToolPairs(t *testing.T, msgs []openai.ChatCompletionMessage) {
+	t.Helper()
+	var pending map[string]bool
+	for i, msg := range msgs {
+		if msg.Role == openai.ChatMessageRoleTool {
+			if !pending[msg.ToolCallID] {
+				t.Fatalf("Message %d: tool result %q without a preceding tool call", i, msg.ToolCallID)
+			}
+			delete(pending, msg.ToolCallID)
+			continue
+		}
+		if len(pending) > 0 {
+			t.Fatalf("Message %d: tool calls %v left unanswered", i, pending)
+		}
+		pending = map[string]bool{}
+		for _, tc := range msg.ToolCalls {
+			pending[tc.ID] = true
+		}
+	}
+	if len(pending) > 0 {
+		t.Fatalf("Tool calls %v left unanswered at the end", pending)
+	}
+}
+
+func TestDropOrphanToolMessages(t *testing.T) {
+	user := func(text string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: text}
+	}
+
+	// Valid interleaved conversations are returned as-is
+	valid := []openai.ChatCompletionMessage{
+		user("a"), toolCallMsg("c1", "c2"), toolResultMsg("c2"), toolResultMsg("c1"),
+		{Role: openai.ChatMessageRoleAssistant, Content: "a done"},
+		user("b"), toolCallMsg("c3"), toolResultMsg("c3"), toolCallMsg("c4"), toolResultMsg("c4"),
+		{Role: openai.ChatMessageRoleAssistant, Content: "b done"},
+	}
+	if got := dropOrphanToolMessages(valid, "Test"); len(got) != len(valid) {
+		t.Fatalf("Expected a valid conversation to be kept, got %d of %d messages", len(got), len(valid))
+	}
+
+	// The shapes left behind by a split archive boundary
+	broken := []openai.ChatCompletionMessage{
+		toolResultMsg("c1"), toolResultMsg("c2"), // call archived, results left active
+		{Role: openai.ChatMessageRoleAssistant, Content: "a done"},
+		user("b"), toolCallMsg("c3", "c4"), toolResultMsg("c3"), // one result missing
+		user("c"), toolCallMsg("c5"), toolResultMsg("c5"), toolResultMsg("c9"), // stray result
+		{Role: openai.ChatMessageRoleAssistant, Content: "c done"},
+		user("d"), toolCallMsg("c6"), // results archived
+	}
+	got := dropOrphanToolMessages(broken, "Test")
+	assertToolPairs(t, got)
+	var contents []string
+	for _, m := range got {
+		if m.Role == openai.ChatMessageRoleTool {
+			contents = append(contents, m.ToolCallID)
+		} else if m.Content != "" {
+			contents = append(contents, m.Content)
+		} else {
+			contents = append(contents, "call")
+		}
+	}
+	if want := "a done,b,c,call,c5,c done,d"; strings.Join(contents, ",") != want {
+		t.Errorf("Expected %s, got %s", want, strings.Join(contents, ","))
+	}
+}
+
+func TestArchivableMessages(t *testing.T) {
+	complete := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "a"}, toolCallMsg("c1", "c2"), toolResultMsg("c1"), toolResultMsg("c2"),
+	}
+	if n := archivableMessages(complete); n != len(complete) {
+		t.Errorf("Expected a complete tool call to be archivable, got %d", n)
+	}
+	inProgress := append(append([]openai.ChatCompletionMessage{}, complete...),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "b"}, toolCallMsg("c3", "c4"), toolResultMsg("c3"))
+	if n := archivableMessages(inProgress); n != len(complete)+1 {
+		t.Errorf("Expected the unanswered tool call to stay active, got %d", n)
+	}
+	assertToolPairs(t, inProgress[:archivableMessages(inProgress)])
+}
+
+func TestEngineNeverSendsOrphanedToolMessages(t *testing.T) {
+	var mu sync.Mutex
+	var sent [][]openai.ChatCompletionMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		sent = append(sent, req.Messages)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "ok"},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	if err := e.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	// A session whose archive boundary split tool pairs in both directions
+	session.Msgs = []openai.ChatCompletionMessage{
+		toolResultMsg("c1"),
+		{Role: openai.ChatMessageRoleAssistant, Content: "done"},
+		{Role: openai.ChatMessageRoleUser, Content: "again"},
+		toolCallMsg("c2"),
+	}
+	if err := sqliteStore.Put(session); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+
+	if _, _, err := e.ProcessMessage(context.Background(), session.SessionID, "hi"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 LLM request, got %d", len(sent))
+	}
+	assertToolPairs(t, sent[0])
+	if last := sent[0][len(sent[0])-1]; last.Content != "hi" {
+		t.Errorf("Expected the new user message last, got %+v", last)
+	}
+}
+
+// TestEngineMaxSessionMessagesKeepsTurn verifies MaxSessionMessages caps the saved session, not
+// the messages of the turn in progress
+func TestEngineMaxSessionMessagesKeepsTurn(t *testing.T) {
+	var mu sync.Mutex
+	var sent [][]openai.ChatCompletionMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		sent = append(sent, req.Messages)
+		mu.Unlock()
+		choice := openai.ChatCompletionChoice{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Order 42 has shipped."},
+			FinishReason: openai.FinishReasonStop,
+		}
+		if req.Messages[len(req.Messages)-1].Role == openai.ChatMessageRoleUser {
+			choice.Message = toolCallMsg("c1")
+			choice.Message.ToolCalls[0].Function = openai.FunctionCall{Name: "lookup_order", Arguments: `{}`}
+			choice.FinishReason = openai.FinishReasonToolCalls
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore, Functions: model.NewFunctionRegistry(), MaxSessionMessages: 2}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	e.Functions.Register("lookup_order", "", func(args map[string]interface{}) (string, error) { return "shipped", nil })
+	if err := e.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	if _, _, err := e.ProcessMessage(context.Background(), session.SessionID, "Where is order 42?"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 2 {
+		t.Fatalf("Expected 2 LLM requests, got %d", len(sent))
+	}
+	var followUp []string
+	for _, msg := range sent[1] {
+		if msg.Role != openai.ChatMessageRoleSystem {
+			followUp = append(followUp, msg.Role)
+		}
+	}
+	if strings.Join(followUp, ",") != "user,assistant,tool" {
+		t.Errorf("Expected the whole turn in the follow-up request, got %v", followUp)
+	}
+
+	stored, err := sqliteStore.Get(session.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if len(stored.Msgs) > 2 || len(stored.ArchivedMsgs) != 4-len(stored.Msgs) {
+		t.Errorf("Expected the saved session to be capped, got %d messages and %d archived", len(stored.Msgs), len(stored.ArchivedMsgs))
+	}
+}
@@ -2,7 +2,10 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
 	"time"
+
+	"github.com/sashabaranov/go-openai"
 )
 
 // ==================== Status Updates (per-request, via context) ====================
@@ -22,6 +25,8 @@ const (
 	StatusCompleted     StatusPhase = "completed"      // processing done
 	StatusError         StatusPhase = "error"          // error occurred
 	StatusCustom        StatusPhase = "custom"         // LLM-generated custom status via update_status tool
+	StatusQueuedAnswer  StatusPhase = "queued_answer"  // answer to a queued message (QueueModeSeparate), Detail is the answer
+	StatusQueueExpired  StatusPhase = "queue_expired"  // a queued message waited longer than QueueTimeout and was dropped
 )
 
 // StatusUpdate carries real-time progress information
@@ -30,6 +35,7 @@ type StatusUpdate struct {
 	SessionID string
 	Phase     StatusPhase
 	Detail    string                 // human-readable detail: tool name, model name, etc.
+	Message   string                 // user-facing text of the update (see CoreHandlerConfig.StatusMessages)
 	Metadata  map[string]interface{} // extensible
 	// SendAsNewMessage: when true, the receiver should send a new message instead of editing the status message.
 	SendAsNewMessage bool
@@ -55,16 +61,28 @@ func WithStatusFunc(ctx context.Context, fn StatusFunc) context.Context {
 	return context.WithValue(ctx, statusCtxKey{}, fn)
 }
 
+// statusFuncFromContext returns the StatusFunc attached to ctx (nil if none)
+func statusFuncFromContext(ctx context.Context) StatusFunc {
+	fn, _ := ctx.Value(statusCtxKey{}).(StatusFunc)
+	return fn
+}
+
 // notifyStatus is the internal helper called throughout the engine.
 // Safe to call even if no StatusFunc is set (no-op).
 // Optional opts are applied to the StatusUpdate before passing to the callback.
+// Suppressed phases are dropped; Message is rendered from the request's status messages.
 func notifyStatus(ctx context.Context, userID, sessionID string, phase StatusPhase, detail string, opts ...NotifyOption) {
 	if fn, ok := ctx.Value(statusCtxKey{}).(StatusFunc); ok && fn != nil {
+		messages := statusMessagesFromContext(ctx)
+		if messages.suppressed[phase] {
+			return
+		}
 		su := &StatusUpdate{
 			UserID:    userID,
 			SessionID: sessionID,
 			Phase:     phase,
 			Detail:    detail,
+			Message:   messages.message(phase, detail),
 		}
 		for _, opt := range opts {
 			opt(su)
@@ -82,14 +100,19 @@ type UsageEvent struct {
 	EventType EventType
 	Name      string // for LLM: use EventNameLLMCall; for tool_call: tool name; for agent_routing: agent type (e.g. high, low)
 	Tokens    int    // token count (for LLM calls) - deprecated, use Input/Output/Cached
-	// Detailed token counts for LLM calls (Credit+Usage billing)
-	InputTokens       int
-	OutputTokens      int
-	CachedInputTokens int
-	Model             string
-	Duration          time.Duration
-	Error             error
-	Metadata          map[string]interface{}
+	// Detailed token counts for LLM calls (Credit+Usage billing), set on AfterAction
+	InputTokens       int // prompt tokens
+	OutputTokens      int // completion tokens
+	CachedInputTokens int // prompt tokens served from the provider's cache
+	// EstimatedInputTokens is set on BeforeAction of LLM calls: the prompt size estimated
+	// from the request (see estimatePromptTokens), so budgets can be checked before spending
+	EstimatedInputTokens int
+	Model                string
+	// CostUSD is the cost of an LLM call from the configured CostTable (0 when the model has no price)
+	CostUSD  float64
+	Duration time.Duration
+	Error    error
+	Metadata map[string]interface{}
 }
 
 // EventType classifies the kind of metered action
@@ -115,6 +138,56 @@ type Callback interface {
 	AfterAction(ctx context.Context, event *UsageEvent)
 }
 
+// checkLLMBudget checks the user's token quota (when quota is set) and then calls cb.BeforeAction
+// for an LLM call about to send messages and tools. It returns the quota or callback error when
+// the call is blocked (nil when neither is set).
+func checkLLMBudget(ctx context.Context, cb Callback, quota *quotaGuard, userID, sessionID, modelName string, messages []openai.ChatCompletionMessage, tools []openai.Tool) error {
+	if err := quota.check(ctx, cb, userID, sessionID); err != nil {
+		return err
+	}
+	if cb == nil {
+		return nil
+	}
+	return cb.BeforeAction(ctx, &UsageEvent{
+		UserID:               userID,
+		SessionID:            sessionID,
+		EventType:            EventLLMCall,
+		Name:                 EventNameLLMCall,
+		Model:                modelName,
+		EstimatedInputTokens: estimatePromptTokens(messages, tools),
+	})
+}
+
+// estimatePromptTokens roughly estimates the prompt tokens of a request at 4 characters per token,
+// counting message text, tool call arguments and tool definitions (images are not counted)
+func estimatePromptTokens(messages []openai.ChatCompletionMessage, tools []openai.Tool) int {
+	chars := 0
+	for _, msg := range messages {
+		chars += len(msg.Content)
+		for _, part := range msg.MultiContent {
+			chars += len(part.Text)
+		}
+		for _, tc := range msg.ToolCalls {
+			chars += len(tc.Function.Name) + len(tc.Function.Arguments)
+		}
+	}
+	if len(tools) > 0 {
+		if data, err := json.Marshal(tools); err == nil {
+			chars += len(data)
+		}
+	}
+	return (chars + 3) / 4
+}
+
+// blockedLLMMessage is the answer given to the user when BeforeAction blocks an LLM call:
+// quotaMessage (LLMConfig.QuotaExceededMessage) when set, otherwise the callback error as-is
+func blockedLLMMessage(quotaMessage string, err error) string {
+	if quotaMessage != "" {
+		return quotaMessage
+	}
+	return FormatBlockedActionResult(err)
+}
+
 // FormatBlockedActionResult returns the string to use as the result when BeforeAction blocks.
 // The callback error message is returned as-is so the app (e.g. Billing) can use a consistent template.
 func FormatBlockedActionResult(err error) string {
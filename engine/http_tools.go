@@ -0,0 +1,236 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+)
+
+const (
+	// defaultHTTPToolTimeout bounds an HTTP tool call whose http block sets no timeout
+	defaultHTTPToolTimeout = 30 * time.Second
+	// defaultHTTPToolMaxResponseBytes is the response size kept when LLMConfig.HTTPToolMaxResponseBytes is 0
+	defaultHTTPToolMaxResponseBytes = 16 * 1024
+	// DefaultHTTPToolEnvPrefix is the prefix of the environment variables http tool headers may
+	// read when LLMConfig.HTTPToolEnvPrefix is empty
+	DefaultHTTPToolEnvPrefix = "AGENTIZE_TOOL_"
+	// maxHTTPToolRedirects is the number of redirects an HTTP tool call follows
+	maxHTTPToolRedirects = 5
+)
+
+// RegisterHTTPTools registers a built-in handler for every tool in the knowledge tree that
+// declares an "http" block and has no handler yet, so it runs without any Go code.
+// Called by Init and after every reload of the tree: handlers it registered earlier are
+// replaced when their http block changed and removed when the tool is gone.
+// Creates the function registry if there is none and a tool needs it.
+func (e *Engine) RegisterHTTPTools() error {
+	if e.Repo == nil {
+		return nil
+	}
+	tools := make(map[string]model.Tool)
+	e.collectHTTPTools("root", tools, make(map[string]bool))
+
+	e.httpToolsMu.Lock()
+	defer e.httpToolsMu.Unlock()
+	for name, spec := range e.httpTools {
+		if tool, exists := tools[name]; !exists || !reflect.DeepEqual(*tool.HTTP, spec) {
+			e.Functions.Unregister(name)
+			delete(e.httpTools, name)
+			e.logger().Info("[Engine] 🌐 HTTP tool unregistered", "name", name)
+		}
+	}
+	for name, tool := range tools {
+		if e.Functions == nil {
+			e.Functions = model.NewFunctionRegistry()
+		}
+		if e.Functions.Has(name) {
+			continue
+		}
+		if err := e.Functions.RegisterContext(name, "", e.httpToolHandler(tool)); err != nil {
+			return fmt.Errorf("failed to register http tool %s: %w", name, err)
+		}
+		if e.httpTools == nil {
+			e.httpTools = make(map[string]model.HTTPTool)
+		}
+		e.httpTools[name] = *tool.HTTP
+		e.logger().Info("[Engine] 🌐 HTTP tool registered", "name", name, "method", tool.HTTP.RequestMethod())
+	}
+	return nil
+}
+
+// forgetHTTPTool stops tracking the built-in handler of name once another handler replaced it,
+// so a later RegisterHTTPTools leaves that handler alone
+func (e *Engine) forgetHTTPTool(name string) {
+	e.httpToolsMu.Lock()
+	delete(e.httpTools, name)
+	e.httpToolsMu.Unlock()
+}
+
+// collectHTTPTools maps the names of the tools with an http block under path to their
+// definitions; the first definition found (nearest the root) wins
+func (e *Engine) collectHTTPTools(path string, tools map[string]model.Tool, seen map[string]bool) {
+	if seen[path] {
+		return
+	}
+	seen[path] = true
+	node, err := e.Repo.LoadNode(path)
+	if err != nil {
+		return
+	}
+	for _, tool := range node.Tools {
+		if tool.HTTP == nil {
+			continue
+		}
+		if _, exists := tools[tool.Name]; exists {
+			e.logger().Warn("[Engine] ⚠️  HTTP tool declared more than once, keeping the first", "name", tool.Name, "path", path)
+			continue
+		}
+		tools[tool.Name] = tool
+	}
+	children, err := e.Repo.GetChildren(path)
+	if err != nil {
+		return
+	}
+	for _, child := range children {
+		e.collectHTTPTools(child, tools, seen)
+	}
+}
+
+// httpToolHandler returns the handler calling tool's endpoint. Arguments named in the URL
+// template fill it; the rest go to the query string or a JSON body (see HTTPTool.ArgsIn).
+// A non-2xx status is returned as an error so the tool call is saved as failed.
+func (e *Engine) httpToolHandler(tool model.Tool) model.ContextToolFunction {
+	spec := *tool.HTTP
+	timeout := defaultHTTPToolTimeout
+	if spec.TimeoutSeconds > 0 {
+		timeout = time.Duration(spec.TimeoutSeconds) * time.Second
+	}
+	client := newHTTPToolClient(timeout)
+	return func(ctx context.Context, args map[string]interface{}) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		req, err := buildHTTPToolRequest(ctx, &spec, args, e.httpToolHeaderVar)
+		if err != nil {
+			return "", err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("request failed: %w", err)
+		}
+		defer resp.Body.Close()
+
+		maxBytes := e.llmConfig.HTTPToolMaxResponseBytes
+		if maxBytes <= 0 {
+			maxBytes = defaultHTTPToolMaxResponseBytes
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+		if err != nil {
+			return "", fmt.Errorf("failed to read response: %w", err)
+		}
+		result := string(body)
+		if len(body) > maxBytes {
+			result = string(body[:maxBytes]) + "\n... [truncated]"
+		}
+
+		// Only the tool name and status are logged: the URL and headers may carry secrets
+		e.logger().Info("[Engine] 🌐 HTTP tool called", "name", tool.Name, "status", resp.StatusCode, "bytes", len(body))
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, result)
+		}
+		return result, nil
+	}
+}
+
+// newHTTPToolClient returns the client of an HTTP tool: it gives up after timeout and only
+// follows a few redirects to the same host, so header secrets never reach another server
+func newHTTPToolClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxHTTPToolRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxHTTPToolRedirects)
+			}
+			if req.URL.Host != via[0].URL.Host {
+				return fmt.Errorf("redirect to another host %q refused", req.URL.Host)
+			}
+			return nil
+		},
+	}
+}
+
+// httpToolHeaderVar resolves $NAME in an http tool header: from LLMConfig.HTTPToolSecrets,
+// else from the environment when NAME has the allowed prefix (LLMConfig.HTTPToolEnvPrefix).
+// Any other variable expands to an empty string, so a tree cannot read arbitrary secrets.
+func (e *Engine) httpToolHeaderVar(name string) string {
+	if value, ok := e.llmConfig.HTTPToolSecrets[name]; ok {
+		return value
+	}
+	prefix := e.llmConfig.HTTPToolEnvPrefix
+	if prefix == "" {
+		prefix = DefaultHTTPToolEnvPrefix
+	}
+	if strings.HasPrefix(name, prefix) {
+		return os.Getenv(name)
+	}
+	e.logger().Warn("[Engine] ⚠️  HTTP tool header variable not allowed, expanded to empty", "variable", name, "allowed_prefix", prefix)
+	return ""
+}
+
+// buildHTTPToolRequest builds the request for spec from the model's arguments, resolving the
+// $VAR and ${VAR} of header values with lookup. Arguments the engine injects (__user_id__,
+// __session_id__, ...) are never sent.
+func buildHTTPToolRequest(ctx context.Context, spec *model.HTTPTool, args map[string]interface{}, lookup func(string) string) (*http.Request, error) {
+	rest := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		if !strings.HasPrefix(k, "__") {
+			rest[k] = v
+		}
+	}
+
+	target := spec.URL
+	for k, v := range rest {
+		placeholder := "{" + k + "}"
+		if strings.Contains(target, placeholder) {
+			target = strings.ReplaceAll(target, placeholder, url.PathEscape(fmt.Sprint(v)))
+			delete(rest, k)
+		}
+	}
+
+	var body io.Reader
+	method := spec.RequestMethod()
+	if spec.ArgsPlacement() == model.HTTPArgsInBody {
+		data, err := json.Marshal(rest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode arguments: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	} else if len(rest) > 0 {
+		query := req.URL.Query()
+		for k, v := range rest {
+			query.Set(k, fmt.Sprint(v))
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+	for name, value := range spec.Headers {
+		req.Header.Set(name, os.Expand(value, lookup))
+	}
+	return req, nil
+}
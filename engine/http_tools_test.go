@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEngineHTTPTools(t *testing.T) {
+	t.Setenv("AGENTIZE_TOOL_TEST_TOKEN", "s3cret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/items/a b":
+			w.Write([]byte("item " + r.URL.Query().Get("fields") + " " + strings.Repeat("x", 100)))
+		case r.Method == http.MethodPost && r.URL.Path == "/tickets":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("backend down"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "tools.json"), []byte(`{"tools": [
+		{"name": "get_item", "description": "Get an item", "input_schema": {"type": "object"},
+		 "http": {"url": "`+server.URL+`/items/{id}", "headers": {"Authorization": "Bearer ${AGENTIZE_TOOL_TEST_TOKEN}"}}},
+		{"name": "create_ticket", "description": "Create a ticket", "input_schema": {"type": "object"},
+		 "http": {"url": "`+server.URL+`/tickets", "method": "post", "headers": {"Authorization": "Bearer ${AGENTIZE_TOOL_TEST_TOKEN}"}, "timeout_seconds": 5}}
+	]}`), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore, llmConfig: LLMConfig{HTTPToolMaxResponseBytes: 40, MaxToolResultLength: 1000}}
+	e.SetStrictTools(true)
+	if err := e.Init(); err != nil {
+		t.Fatalf("HTTP tools should count as bound: %v", err)
+	}
+
+	// URL placeholders are path-escaped, other arguments go to the query, the response is truncated
+	result, err := e.Functions.ExecuteContext(context.Background(), "get_item", map[string]interface{}{"id": "a b", "fields": "name", "__user_id__": "user1"})
+	if err != nil {
+		t.Fatalf("get_item failed: %v", err)
+	}
+	if !strings.HasPrefix(result, "item name xxx") || !strings.HasSuffix(result, "[truncated]") || len(result) > 60 {
+		t.Fatalf("Unexpected get_item result: %q", result)
+	}
+
+	// A failing endpoint marks the tool call failed; header secrets are not stored
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	result, _ = e.executeTool(context.Background(), session, "msg1", openai.ToolCall{
+		ID:       "call_1",
+		Function: openai.FunctionCall{Name: "create_ticket", Arguments: `{"title":"broken"}`},
+	})
+	if !strings.Contains(result, "HTTP 500: backend down") {
+		t.Fatalf("Expected HTTP 500 error result, got %q", result)
+	}
+	calls, err := sqliteStore.GetToolCallsBySession(session.SessionID)
+	if err != nil || len(calls) != 1 {
+		t.Fatalf("Expected one saved tool call, got %d (%v)", len(calls), err)
+	}
+	if calls[0].Status != model.ToolCallStatusFailed {
+		t.Errorf("Expected failed status, got %q", calls[0].Status)
+	}
+	if strings.Contains(calls[0].Arguments, "s3cret") || strings.Contains(calls[0].Response, "s3cret") {
+		t.Errorf("Secret leaked into the stored tool call: %+v", calls[0])
+	}
+}
+
+func TestEngineHTTPToolsHeadersRedirectsAndReload(t *testing.T) {
+	t.Setenv("AGENTIZE_TOOL_TEST_TOKEN", "allowed")
+	t.Setenv("DATABASE_PASSWORD", "hunter2")
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Redirect to another host should not be followed (auth %q)", r.Header.Get("Authorization"))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/headers":
+			w.Write([]byte(r.Header.Get("Authorization") + "|" + r.Header.Get("X-Password") + "|" + r.Header.Get("X-Api-Key")))
+		case "/away":
+			http.Redirect(w, r, other.URL+"/", http.StatusFound)
+		case "/v2":
+			w.Write([]byte("v2"))
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	writeTools := func(tools string) {
+		if err := os.WriteFile(filepath.Join(dir, "root", "tools.json"), []byte(`{"tools": [`+tools+`]}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTools(`{"name": "headers", "description": "Echo headers", "input_schema": {"type": "object"},
+		 "http": {"url": "` + server.URL + `/headers", "headers": {"Authorization": "${AGENTIZE_TOOL_TEST_TOKEN}", "X-Password": "${DATABASE_PASSWORD}", "X-Api-Key": "$API_KEY"}}},
+		{"name": "away", "description": "Redirects", "input_schema": {"type": "object"}, "http": {"url": "` + server.URL + `/away"}}`)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	e := &Engine{Repo: repo, llmConfig: LLMConfig{HTTPToolSecrets: map[string]string{"API_KEY": "k3y"}}}
+	if err := e.RegisterHTTPTools(); err != nil {
+		t.Fatalf("RegisterHTTPTools failed: %v", err)
+	}
+
+	// Only allowlisted environment variables and configured secrets are expanded
+	result, err := e.Functions.ExecuteContext(context.Background(), "headers", nil)
+	if err != nil {
+		t.Fatalf("headers failed: %v", err)
+	}
+	if result != "allowed||k3y" {
+		t.Fatalf("Expected only the allowed variables to be expanded, got %q", result)
+	}
+
+	if _, err := e.Functions.ExecuteContext(context.Background(), "away", nil); err == nil || !strings.Contains(err.Error(), "another host") {
+		t.Fatalf("Expected the cross-host redirect to be refused, got %v", err)
+	}
+
+	// After a reload the changed tool is re-registered and the removed one is gone
+	writeTools(`{"name": "headers", "description": "Echo headers", "input_schema": {"type": "object"}, "http": {"url": "` + server.URL + `/v2"}}`)
+	if err := repo.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := e.RegisterHTTPTools(); err != nil {
+		t.Fatalf("RegisterHTTPTools after reload failed: %v", err)
+	}
+	if result, err := e.Functions.ExecuteContext(context.Background(), "headers", nil); err != nil || result != "v2" {
+		t.Fatalf("Expected the reloaded tool to call /v2, got %q (%v)", result, err)
+	}
+	if e.Functions.Has("away") {
+		t.Error("Expected the removed http tool to be unregistered")
+	}
+
+	// A handler bound in Go is left alone by later reloads
+	e.BindTool("headers", func(args map[string]interface{}) (string, error) { return "bound", nil })
+	writeTools(`{"name": "headers", "description": "Echo headers", "input_schema": {"type": "object"}, "http": {"url": "` + server.URL + `/headers"}}`)
+	repo.Reload()
+	e.RegisterHTTPTools()
+	if result, _ := e.Functions.ExecuteContext(context.Background(), "headers", nil); result != "bound" {
+		t.Errorf("Expected the bound handler to survive a reload, got %q", result)
+	}
+}
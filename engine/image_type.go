@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ghiac/agentize/log"
+)
+
+// ErrUnsupportedImageType is returned by ProcessMessageWithImage for images whose content is not
+// one of CoreHandlerConfig.AllowedImageTypes
+var ErrUnsupportedImageType = errors.New("unsupported image type")
+
+// defaultAllowedImageTypes are the image types accepted when AllowedImageTypes is empty
+var defaultAllowedImageTypes = []string{"image/png", "image/jpeg", "image/webp", "image/gif"}
+
+// detectImageType sniffs the type of an uploaded image from its bytes and checks it is allowed.
+// The sniffed type wins over the declared one, which callers often get wrong (e.g. a JPEG sent as
+// image/png); a mismatch is logged.
+func detectImageType(data []byte, declared string, allowed []string) (string, error) {
+	if len(data) == 0 {
+		return "", fmt.Errorf("%w: image is empty", ErrUnsupportedImageType)
+	}
+	if len(allowed) == 0 {
+		allowed = defaultAllowedImageTypes
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	allowedType := false
+	for _, t := range allowed {
+		if strings.EqualFold(t, sniffed) {
+			allowedType = true
+			break
+		}
+	}
+	if !allowedType {
+		return "", fmt.Errorf("%w: content is %s, expected one of %s", ErrUnsupportedImageType, sniffed, strings.Join(allowed, ", "))
+	}
+
+	declaredType, _, _ := mime.ParseMediaType(declared)
+	if declaredType == "image/jpg" {
+		declaredType = "image/jpeg"
+	}
+	if declared != "" && !strings.EqualFold(declaredType, sniffed) {
+		log.Log.Warn("[CoreHandler] ⚠️  Image MIME type does not match its content, using the detected type", "declared", declared, "detected", sniffed)
+	}
+	return sniffed, nil
+}
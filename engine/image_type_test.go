@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestDetectImageType(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, image.NewRGBA(image.Rect(0, 0, 2, 2)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+
+	// A JPEG labeled as PNG is sent as what it is
+	got, err := detectImageType(jpg.Bytes(), "image/png", nil)
+	if err != nil || got != "image/jpeg" {
+		t.Errorf("Expected a mislabeled JPEG to be detected as image/jpeg, got %q (%v)", got, err)
+	}
+	if got, err := detectImageType(jpg.Bytes(), "", nil); err != nil || got != "image/jpeg" {
+		t.Errorf("Expected image/jpeg without a declared type, got %q (%v)", got, err)
+	}
+
+	// Non-images, empty data and types outside the allowed list are rejected
+	for name, tc := range map[string]struct {
+		data    []byte
+		allowed []string
+	}{
+		"text":       {[]byte("hello, this is not an image"), nil},
+		"pdf":        {[]byte("%PDF-1.4\n"), nil},
+		"empty":      {nil, nil},
+		"disallowed": {jpg.Bytes(), []string{"image/png"}},
+	} {
+		if _, err := detectImageType(tc.data, "image/jpeg", tc.allowed); !errors.Is(err, ErrUnsupportedImageType) {
+			t.Errorf("%s: expected ErrUnsupportedImageType, got %v", name, err)
+		}
+	}
+}
+
+func TestProcessMessageWithImageUsesDetectedType(t *testing.T) {
+	var imageURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, msg := range req.Messages {
+			for _, part := range msg.MultiContent {
+				if part.ImageURL != nil {
+					imageURL = part.ImageURL.URL
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "a black square"},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "vision"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	var jpg bytes.Buffer
+	jpeg.Encode(&jpg, image.NewRGBA(image.Rect(0, 0, 2, 2)), nil)
+	if _, err := ch.ProcessMessageWithImage(context.Background(), "user1", "what is this?", jpg.Bytes(), "image/png"); err != nil {
+		t.Fatalf("ProcessMessageWithImage failed: %v", err)
+	}
+	if !strings.HasPrefix(imageURL, "data:image/jpeg;base64,") {
+		t.Errorf("Expected a JPEG data URL, got %.40q", imageURL)
+	}
+
+	if _, err := ch.ProcessMessageWithImage(context.Background(), "user1", "", []byte("not an image"), "image/png"); !errors.Is(err, ErrUnsupportedImageType) {
+		t.Errorf("Expected ErrUnsupportedImageType, got %v", err)
+	}
+}
@@ -0,0 +1,433 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// SearchKnowledgeToolName is the tool searching the content of the knowledge nodes
+const SearchKnowledgeToolName = "search_knowledge"
+
+const (
+	// defaultKnowledgeChunkSize is the length of an excerpt in characters when
+	// KnowledgeIndexConfig.ChunkSize is 0
+	defaultKnowledgeChunkSize = 1500
+	// defaultKnowledgeTopK is the number of excerpts returned when KnowledgeIndexConfig.TopK is 0
+	defaultKnowledgeTopK = 5
+	// defaultKnowledgeMinSimilarity is the similarity an excerpt needs when
+	// KnowledgeIndexConfig.MinSimilarity is 0
+	defaultKnowledgeMinSimilarity = 0.2
+	// maxKnowledgeResults bounds the limit argument of search_knowledge
+	maxKnowledgeResults = 20
+	// knowledgeEmbedBatch is the number of excerpts embedded per request
+	knowledgeEmbedBatch = 100
+)
+
+// KnowledgeIndexConfig configures a KnowledgeIndex
+type KnowledgeIndexConfig struct {
+	// ChunkSize is the maximum length of an excerpt in characters; node content is split on
+	// paragraphs, and longer paragraphs on words (default: 1500)
+	ChunkSize int
+	// TopK is the number of excerpts a search returns when it asks for no limit (default: 5)
+	TopK int
+	// MinSimilarity is the cosine similarity an excerpt needs to be returned (default: 0.2)
+	MinSimilarity float64
+}
+
+// KnowledgeIndexStats describes the current state of a KnowledgeIndex
+type KnowledgeIndexStats struct {
+	Nodes  int // nodes with at least one excerpt
+	Chunks int // excerpts in the index
+	// Embedded is how many excerpts the last build had to embed (the others were unchanged)
+	Embedded  int
+	LastBuilt time.Time // zero until the first build succeeds
+	LastError string    // error of the last failed build (empty after a success)
+}
+
+// KnowledgeHit is an excerpt returned by KnowledgeIndex.Search
+type KnowledgeHit struct {
+	Path    string  `json:"path"`
+	Title   string  `json:"title,omitempty"`
+	Excerpt string  `json:"excerpt"`
+	Score   float64 `json:"score"`
+}
+
+// KnowledgeIndex is a vector index of the content (node.md) of the knowledge nodes, searched by
+// the search_knowledge tool. It is rebuilt in the background after every load and reload of the
+// tree; excerpts whose text did not change keep their embedding, so a rebuild only embeds what
+// was edited.
+type KnowledgeIndex struct {
+	provider EmbeddingProvider
+	repo     *fsrepo.NodeRepository
+	store    model.KnowledgeIndexStore
+	config   KnowledgeIndexConfig
+
+	buildMu sync.Mutex // serializes builds
+
+	// Background rebuild after a load (see scheduleRebuild)
+	rebuildMu    sync.Mutex
+	rebuilding   bool
+	rebuildAgain bool
+
+	mu     sync.RWMutex
+	chunks []*model.KnowledgeChunk
+	stats  KnowledgeIndexStats
+}
+
+// NewKnowledgeIndex creates an index of the content of repo's nodes, embedded with provider
+// (e.g. an OpenAIEmbeddingProvider). When store is not nil the index is persisted to it and the
+// stored excerpts are loaded now, so a restart only embeds content that changed. The index is
+// built now if the tree is already loaded, and in the background after every load and reload,
+// so reloads do not wait for the embeddings; until a rebuild is done the previous index is
+// searched.
+func NewKnowledgeIndex(provider EmbeddingProvider, repo *fsrepo.NodeRepository, store model.KnowledgeIndexStore, config KnowledgeIndexConfig) *KnowledgeIndex {
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = defaultKnowledgeChunkSize
+	}
+	if config.TopK <= 0 {
+		config.TopK = defaultKnowledgeTopK
+	}
+	if config.MinSimilarity <= 0 {
+		config.MinSimilarity = defaultKnowledgeMinSimilarity
+	}
+	k := &KnowledgeIndex{provider: provider, repo: repo, store: store, config: config}
+
+	if store != nil {
+		chunks, err := store.GetKnowledgeChunks()
+		if err != nil {
+			log.Log.Warn("[KnowledgeIndex] ⚠️  Failed to load the stored index", "error", err)
+		} else {
+			k.setChunks(chunks)
+		}
+	}
+
+	repo.OnLoad(k.scheduleRebuild)
+	if len(repo.CachedNodes()) > 0 {
+		k.rebuild()
+	}
+	return k
+}
+
+// Build indexes the content of the cached nodes, embedding the excerpts not indexed yet, and
+// persists the index to the store. It runs after each load; call it directly to retry after a
+// failure. On error the current index is kept.
+func (k *KnowledgeIndex) Build(ctx context.Context) error {
+	k.buildMu.Lock()
+	defer k.buildMu.Unlock()
+
+	err := k.build(ctx)
+	if err != nil {
+		k.mu.Lock()
+		k.stats.LastError = err.Error()
+		k.mu.Unlock()
+	}
+	return err
+}
+
+func (k *KnowledgeIndex) build(ctx context.Context) error {
+	k.mu.RLock()
+	byHash := make(map[string][]float32, len(k.chunks))
+	for _, chunk := range k.chunks {
+		byHash[chunk.Hash] = chunk.Embedding
+	}
+	k.mu.RUnlock()
+
+	nodes := k.repo.CachedNodes()
+	paths := make([]string, 0, len(nodes))
+	for path := range nodes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var chunks, missing []*model.KnowledgeChunk
+	var missingTexts []string
+	for _, path := range paths {
+		node := nodes[path]
+		for i, text := range splitKnowledge(node.Content, k.config.ChunkSize) {
+			embedded := knowledgeEmbeddingText(node.Title, text)
+			sum := sha256.Sum256([]byte(embedded))
+			hash := hex.EncodeToString(sum[:])
+			chunk := model.NewKnowledgeChunk(path, i, node.Title, text, hash, byHash[hash])
+			chunks = append(chunks, chunk)
+			if chunk.Embedding == nil {
+				missing = append(missing, chunk)
+				missingTexts = append(missingTexts, embedded)
+			}
+		}
+	}
+
+	for start := 0; start < len(missing); start += knowledgeEmbedBatch {
+		end := start + knowledgeEmbedBatch
+		if end > len(missing) {
+			end = len(missing)
+		}
+		vectors, err := k.provider.Embed(ctx, missingTexts[start:end])
+		if err != nil {
+			return fmt.Errorf("failed to embed knowledge excerpts: %w", err)
+		}
+		if len(vectors) != end-start {
+			return fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), end-start)
+		}
+		for i, vector := range vectors {
+			missing[start+i].Embedding = vector
+		}
+	}
+
+	if k.store != nil {
+		if err := k.store.ReplaceKnowledgeChunks(chunks); err != nil {
+			log.Log.Warn("[KnowledgeIndex] ⚠️  Failed to store the index", "error", err)
+		}
+	}
+
+	k.setChunks(chunks)
+	k.mu.Lock()
+	k.stats.Embedded = len(missing)
+	k.stats.LastBuilt = time.Now()
+	k.stats.LastError = ""
+	stats := k.stats
+	k.mu.Unlock()
+
+	log.Log.Info("[KnowledgeIndex] 📚 Knowledge index built", "nodes", stats.Nodes, "chunks", stats.Chunks, "embedded", stats.Embedded)
+	return nil
+}
+
+// rebuild runs Build after a load; failures are logged and leave the previous index searchable
+func (k *KnowledgeIndex) rebuild() {
+	if err := k.Build(context.Background()); err != nil {
+		log.Log.Warn("[KnowledgeIndex] ⚠️  Failed to build the knowledge index", "error", err)
+	}
+}
+
+// scheduleRebuild runs rebuild in the background after a load. Loads during a rebuild are
+// coalesced into one more rebuild.
+func (k *KnowledgeIndex) scheduleRebuild() {
+	k.rebuildMu.Lock()
+	defer k.rebuildMu.Unlock()
+	if k.rebuilding {
+		k.rebuildAgain = true
+		return
+	}
+	k.rebuilding = true
+	go func() {
+		for {
+			k.rebuild()
+			k.rebuildMu.Lock()
+			if !k.rebuildAgain {
+				k.rebuilding = false
+				k.rebuildMu.Unlock()
+				return
+			}
+			k.rebuildAgain = false
+			k.rebuildMu.Unlock()
+		}
+	}()
+}
+
+// setChunks makes chunks the searched index
+func (k *KnowledgeIndex) setChunks(chunks []*model.KnowledgeChunk) {
+	nodes := make(map[string]bool)
+	for _, chunk := range chunks {
+		nodes[chunk.NodePath] = true
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.chunks = chunks
+	k.stats.Nodes = len(nodes)
+	k.stats.Chunks = len(chunks)
+}
+
+// Stats returns the size of the index and when it was last built
+func (k *KnowledgeIndex) Stats() KnowledgeIndexStats {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.stats
+}
+
+// Search returns up to limit excerpts most similar to query (the configured TopK when limit
+// <= 0), best first. Only excerpts of nodes userID (in groups) can read are searched, so node
+// auth applies to every query.
+func (k *KnowledgeIndex) Search(ctx context.Context, query, userID string, groups []string, limit int) ([]KnowledgeHit, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if limit <= 0 {
+		limit = k.config.TopK
+	}
+	vectors, err := k.provider.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 text", len(vectors))
+	}
+
+	k.mu.RLock()
+	chunks := k.chunks
+	k.mu.RUnlock()
+
+	readable := make(map[string]bool)
+	var hits []KnowledgeHit
+	for _, chunk := range chunks {
+		allowed, checked := readable[chunk.NodePath]
+		if !checked {
+			allowed = k.repo.CanUser(chunk.NodePath, userID, groups, model.PermRead)
+			readable[chunk.NodePath] = allowed
+		}
+		if !allowed {
+			continue
+		}
+		score := cosineSimilarity(vectors[0], chunk.Embedding)
+		if score < k.config.MinSimilarity {
+			continue
+		}
+		hits = append(hits, KnowledgeHit{Path: chunk.NodePath, Title: chunk.Title, Excerpt: chunk.Text, Score: score})
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// knowledgeEmbeddingText is what an excerpt is embedded from: the node title and the excerpt
+func knowledgeEmbeddingText(title, text string) string {
+	return strings.TrimSpace(title + "\n\n" + text)
+}
+
+// splitKnowledge splits node content into excerpts of at most size characters, keeping
+// paragraphs together when they fit
+func splitKnowledge(content string, size int) []string {
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if text := strings.TrimSpace(current.String()); text != "" {
+			chunks = append(chunks, text)
+		}
+		current.Reset()
+	}
+	for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if current.Len() > 0 && len([]rune(current.String()))+2+len([]rune(paragraph)) > size {
+			flush()
+		}
+		for len([]rune(paragraph)) > size {
+			head, rest := splitRunesAtSpace(paragraph, size)
+			current.WriteString(head)
+			flush()
+			paragraph = rest
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(paragraph)
+	}
+	flush()
+	return chunks
+}
+
+// splitRunesAtSpace cuts text after at most size characters, at the last space if there is one
+func splitRunesAtSpace(text string, size int) (string, string) {
+	runes := []rune(text)
+	cut := size
+	for i := size; i > size/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimSpace(string(runes[:cut])), strings.TrimSpace(string(runes[cut:]))
+}
+
+// searchKnowledgeToolDefinition is the definition of search_knowledge
+var searchKnowledgeToolDefinition = openai.FunctionDefinition{
+	Name:        SearchKnowledgeToolName,
+	Description: "Search the knowledge base for passages relevant to a question, across every knowledge node you may read. Returns the most relevant excerpts with the path of their node. Use it before answering questions the current node does not cover.",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "What to look for, as a question or keywords",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum number of excerpts to return (at most %d)", maxKnowledgeResults),
+			},
+		},
+		"required": []string{"query"},
+	},
+}
+
+// searchKnowledge runs search_knowledge for userID and returns the hits as JSON. It fails without
+// a userID, as node auth could not be applied.
+func searchKnowledge(ctx context.Context, index *KnowledgeIndex, userID string, groups []string, args map[string]interface{}) (string, error) {
+	if userID == "" {
+		return "", fmt.Errorf("search_knowledge needs the user it searches for")
+	}
+	query, _ := args["query"].(string)
+	limit := 0
+	if n, ok := args["limit"].(float64); ok {
+		limit = int(math.Min(n, maxKnowledgeResults))
+	}
+	hits, err := index.Search(ctx, query, userID, groups, limit)
+	if err != nil {
+		return "", err
+	}
+	if len(hits) == 0 {
+		return "No knowledge excerpt matches this query.", nil
+	}
+	for i := range hits {
+		hits[i].Score = math.Round(hits[i].Score*100) / 100
+	}
+	data, err := json.Marshal(hits)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SetKnowledgeIndex offers the search_knowledge tool to the engine's model, searching index with
+// the node auth of the session's user (see SetGroupResolver). Calls without a user fail.
+func (e *Engine) SetKnowledgeIndex(index *KnowledgeIndex) {
+	e.addLocalTool(searchKnowledgeToolDefinition, func(ctx context.Context, args map[string]interface{}) (string, error) {
+		userID := ""
+		if info, ok := model.ToolCallInfoFromContext(ctx); ok {
+			userID = info.UserID
+		}
+		if userID == "" {
+			userID, _ = model.GetUserIDFromContext(ctx)
+		}
+		return searchKnowledge(ctx, index, userID, e.UserGroups(userID), args)
+	})
+}
+
+// searchKnowledgeTool runs search_knowledge for the Core, with the node auth groups the
+// UserAgent owning the knowledge tree resolves for userID
+func (ch *CoreHandler) searchKnowledgeTool(ctx context.Context, userID string, args map[string]interface{}) (string, error) {
+	if ch.knowledge == nil {
+		return "", fmt.Errorf("knowledge search is not enabled")
+	}
+	var groups []string
+	if agent := ch.knowledgeAgent(); agent != nil {
+		groups = agent.UserGroups(userID)
+	}
+	return searchKnowledge(ctx, ch.knowledge, userID, groups, args)
+}
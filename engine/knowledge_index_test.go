@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+)
+
+func TestKnowledgeIndex(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		full := filepath.Join(dir, rel)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", rel, err)
+		}
+	}
+	write("root/node.md", "# Root")
+	write("root/refunds/node.yaml", "id: \"refunds\"\ntitle: \"Refunds\"\n")
+	write("root/refunds/node.md", "Ask for a refund within 14 days.\n\nA refund takes a week.")
+	write("root/bugs/node.yaml", "id: \"bugs\"\ntitle: \"Bugs\"\n")
+	write("root/bugs/node.md", "Report a bug with a screenshot.")
+	write("root/internal/node.yaml", `id: "internal"
+title: "Internal"
+auth:
+  inherit: true
+  users:
+    - user_id: "alice"
+      can_read: false
+`)
+	write("root/internal/node.md", "Refund exceptions: refund any.")
+
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	if err := repo.Load(); err != nil {
+		t.Fatalf("Failed to load repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	embedder := &keywordEmbedder{}
+	index := NewKnowledgeIndex(embedder, repo, sqliteStore, KnowledgeIndexConfig{ChunkSize: 40, MinSimilarity: 0.5})
+	stats := index.Stats()
+	if stats.Nodes != 4 || stats.Chunks != 5 || stats.Embedded != 5 || stats.LastBuilt.IsZero() {
+		t.Fatalf("Expected 4 nodes in 5 excerpts, got %+v", stats)
+	}
+
+	ctx := context.Background()
+	hits, err := index.Search(ctx, "how do I get a refund?", "bob", nil, 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	paths := make(map[string]bool)
+	for _, hit := range hits {
+		paths[hit.Path] = true
+		if hit.Path == "root/refunds" && hit.Title != "Refunds" {
+			t.Errorf("Expected the node title with the excerpt, got %+v", hit)
+		}
+	}
+	if len(hits) != 3 || !paths["root/refunds"] || !paths["root/internal"] {
+		t.Fatalf("Expected the refund excerpts of both nodes, got %+v", hits)
+	}
+
+	// can_read is checked per user at query time
+	hits, err = index.Search(ctx, "refund", "alice", nil, 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	for _, hit := range hits {
+		if hit.Path == "root/internal" {
+			t.Fatalf("Expected alice not to see root/internal, got %+v", hits)
+		}
+	}
+	if len(hits) != 2 {
+		t.Fatalf("Expected the 2 refund excerpts of root/refunds, got %+v", hits)
+	}
+
+	// A reload rebuilds the index in the background, only embedding the edited excerpt
+	write("root/bugs/node.md", "Report each bug with a screenshot.")
+	if err := repo.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !index.Stats().LastBuilt.After(stats.LastBuilt) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := index.Stats(); stats.Embedded != 1 || stats.Chunks != 5 {
+		t.Fatalf("Expected 1 excerpt embedded again after the reload, got %+v", stats)
+	}
+
+	// The stored index spares a restart from embedding unchanged content
+	restarted := &keywordEmbedder{}
+	index = NewKnowledgeIndex(restarted, repo, sqliteStore, KnowledgeIndexConfig{ChunkSize: 40, MinSimilarity: 0.5})
+	if restarted.embedded != 0 || index.Stats().Chunks != 5 {
+		t.Fatalf("Expected the stored index to be reused, embedded %d (%+v)", restarted.embedded, index.Stats())
+	}
+
+	// search_knowledge on a UserAgent applies the auth of the session's user
+	e := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	e.SetKnowledgeIndex(index)
+	toolCtx := model.WithToolCallInfo(ctx, model.ToolCallInfo{ToolName: SearchKnowledgeToolName, UserID: "alice"})
+	result, err := e.callTool(toolCtx, SearchKnowledgeToolName, map[string]interface{}{"query": "refund", "limit": float64(1)})
+	if err != nil {
+		t.Fatalf("search_knowledge failed: %v", err)
+	}
+	if !strings.Contains(result, `"path":"root/refunds"`) || strings.Contains(result, "root/internal") || strings.Count(result, `"path"`) != 1 {
+		t.Fatalf("Expected one excerpt of root/refunds, got %s", result)
+	}
+	result, err = e.callTool(toolCtx, SearchKnowledgeToolName, map[string]interface{}{"query": "price"})
+	if err != nil || !strings.Contains(result, "No knowledge excerpt") {
+		t.Fatalf("Expected no match for price, got %q (%v)", result, err)
+	}
+	// Without a user node auth can't be applied
+	if _, err := e.callTool(ctx, SearchKnowledgeToolName, map[string]interface{}{"query": "refund"}); err == nil {
+		t.Fatalf("Expected search_knowledge to fail without a user")
+	}
+}
+
+func TestSplitKnowledge(t *testing.T) {
+	chunks := splitKnowledge("one two three\n\nfour\n\n\nfive six seven eight nine ten", 14)
+	want := []string{"one two three", "four", "five six seven", "eight nine ten"}
+	if strings.Join(chunks, "|") != strings.Join(want, "|") {
+		t.Fatalf("Expected %q, got %q", want, chunks)
+	}
+}
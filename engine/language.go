@@ -0,0 +1,243 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// language describes a language the Core can instruct the model to answer in
+type language struct {
+	name        string // English name, used in the prompt
+	instruction string // "always respond in ..." in the language itself
+}
+
+// languages are the languages known by name, keyed by ISO 639-1 code. Other codes (set with
+// SetUserLanguage) are passed to the model as the code.
+var languages = map[string]language{
+	"ar": {"Arabic", "أجب دائمًا باللغة العربية."},
+	"de": {"German", "Antworte immer auf Deutsch."},
+	"el": {"Greek", "Απάντα πάντα στα ελληνικά."},
+	"en": {"English", "Always respond in English."},
+	"es": {"Spanish", "Responde siempre en español."},
+	"fa": {"Persian", "همیشه به فارسی پاسخ بده."},
+	"fr": {"French", "Réponds toujours en français."},
+	"he": {"Hebrew", "ענה תמיד בעברית."},
+	"hi": {"Hindi", "हमेशा हिंदी में उत्तर दें।"},
+	"it": {"Italian", "Rispondi sempre in italiano."},
+	"ja": {"Japanese", "常に日本語で答えてください。"},
+	"ko": {"Korean", "항상 한국어로 답하세요."},
+	"nl": {"Dutch", "Antwoord altijd in het Nederlands."},
+	"pt": {"Portuguese", "Responda sempre em português."},
+	"ru": {"Russian", "Всегда отвечай на русском языке."},
+	"th": {"Thai", "ตอบเป็นภาษาไทยเสมอ"},
+	"uk": {"Ukrainian", "Завжди відповідай українською мовою."},
+	"zh": {"Chinese", "请始终用中文回答。"},
+}
+
+// LanguageName returns the English name of an ISO 639-1 language code, or the code itself
+// for languages that are not known by name
+func LanguageName(code string) string {
+	if lang, ok := languages[code]; ok {
+		return lang.name
+	}
+	return code
+}
+
+// buildLanguagePrompt returns the system prompt asking the model to answer in the user's
+// language, with the instruction repeated in that language ("" when the language is unknown)
+func buildLanguagePrompt(code string) string {
+	if code == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("## Language\n\n")
+	lang, known := languages[code]
+	if !known {
+		sb.WriteString(fmt.Sprintf("The user's preferred language has the ISO 639-1 code %q. Always respond in that language, unless the user explicitly asks for another one.\n", code))
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("The user's preferred language is %s. Always respond in %s, unless the user explicitly asks for another language.\n", lang.name, lang.name))
+	if code != "en" {
+		sb.WriteString(lang.instruction)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// languageScripts maps the scripts that identify a language on their own to its code
+// (Arabic and Cyrillic letters are told apart by DetectLanguage)
+var languageScripts = []struct {
+	script *unicode.RangeTable
+	code   string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// languageStopwords are frequent words that tell Latin-script languages apart. Words shared by
+// several of them (e.g. "de", "en") are left out.
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "you", "your", "what", "how", "with", "this", "that", "have", "for", "can", "my", "please", "hello", "thanks", "does", "i", "it", "of", "to", "when", "where", "why"},
+	"fr": {"le", "la", "les", "des", "est", "et", "je", "vous", "vos", "tu", "une", "pour", "avec", "que", "qui", "pas", "sont", "mon", "votre", "bonjour", "merci", "quel", "quels", "quelle", "comment", "où", "du", "au", "aux", "ce", "plaît"},
+	"es": {"el", "los", "las", "es", "y", "por", "mi", "su", "hola", "gracias", "cómo", "qué", "dónde", "cuál", "estoy", "tengo", "usted", "favor", "del", "muy", "sus", "tu", "pero"},
+	"de": {"der", "die", "das", "und", "ist", "ich", "sie", "nicht", "ein", "eine", "mit", "für", "wie", "was", "wo", "bitte", "danke", "hallo", "haben", "sind", "mein", "ihr", "auf", "zu", "den", "dem", "wir"},
+	"it": {"il", "lo", "gli", "è", "e", "sono", "che", "non", "ciao", "grazie", "come", "dove", "quale", "sei", "mio", "questo", "della", "ho", "hai", "buongiorno"},
+	"pt": {"o", "é", "não", "você", "uma", "obrigado", "obrigada", "olá", "onde", "meu", "minha", "são", "isso", "da", "em", "bom", "dia"},
+	"nl": {"het", "een", "ik", "jij", "van", "niet", "wat", "hoe", "waar", "dank", "bedankt", "zijn", "mijn", "met", "voor", "alstublieft", "goedemorgen"},
+}
+
+// languageLetters are letters only used by one Latin-script language, counted like a stopword
+var languageLetters = map[rune]string{'ñ': "es", '¿': "es", '¡': "es", 'ß': "de", 'ã': "pt", 'õ': "pt", 'œ': "fr"}
+
+// DetectLanguage guesses the language of text and returns its ISO 639-1 code, or "" when text
+// is too short or ambiguous. Non-Latin scripts are recognized by their letters, Latin-script
+// languages (en, fr, es, de, it, pt, nl) by their most frequent words.
+func DetectLanguage(text string) string {
+	counts := map[string]int{}
+	latin, persian, ukrainian := 0, 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+			// Letters of the Persian alphabet that Arabic does not use (and Persian ye and kaf)
+			if strings.ContainsRune("پچژگیک", r) {
+				persian++
+			}
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["ru"]++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				ukrainian++
+			}
+		default:
+			for _, s := range languageScripts {
+				if unicode.Is(s.script, r) {
+					counts[s.code]++
+					break
+				}
+			}
+		}
+	}
+	if persian > 0 {
+		counts["fa"], counts["ar"] = counts["ar"], 0
+	}
+	if ukrainian > 0 {
+		counts["uk"], counts["ru"] = counts["ru"], 0
+	}
+	// Japanese mixes kanji with kana
+	if counts["ja"] > 0 {
+		counts["ja"] += counts["zh"]
+		counts["zh"] = 0
+	}
+
+	best, bestCount := "", 0
+	for code, count := range counts {
+		if count > bestCount || (count == bestCount && code < best) {
+			best, bestCount = code, count
+		}
+	}
+	if bestCount > latin {
+		return best
+	}
+	return detectLatinLanguage(text)
+}
+
+// detectLatinLanguage picks the Latin-script language with the most stopwords in text, or ""
+// when none or several tie
+func detectLatinLanguage(text string) string {
+	scores := map[string]int{}
+	text = strings.ToLower(text)
+	for _, r := range text {
+		if code, ok := languageLetters[r]; ok {
+			scores[code]++
+		}
+	}
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for code, stopwords := range languageStopwords {
+			for _, stopword := range stopwords {
+				if word == stopword {
+					scores[code]++
+					break
+				}
+			}
+		}
+	}
+
+	best, bestScore, tie := "", 0, false
+	for code, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tie = code, score, false
+		case score == bestScore:
+			tie = true
+		}
+	}
+	if bestScore == 0 || tie {
+		return ""
+	}
+	return best
+}
+
+// SetUserLanguage sets the language the Core responds to userID in and translates moderation and
+// status messages to (ISO 639-1 code, e.g. "fr"). An empty language lets it be detected again
+// from the user's next message. The store must support user management.
+func (ch *CoreHandler) SetUserLanguage(userID string, language string) error {
+	user, err := ch.getOrCreateUser(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return fmt.Errorf("store does not support user management")
+	}
+	user.SetLanguage(strings.ToLower(strings.TrimSpace(language)))
+	if err := ch.saveUser(user); err != nil {
+		return fmt.Errorf("failed to save user language: %w", err)
+	}
+	ch.logger().Info("[CoreHandler] 🌐 User language set", "user_id", userID, "language", user.Language)
+	return nil
+}
+
+// userLanguage returns the language of userID, detecting it from message and storing it on the
+// user while it is unknown ("" when the store has no users or the language is unclear)
+func (ch *CoreHandler) userLanguage(userID string, message string) string {
+	user, err := ch.getOrCreateUser(userID)
+	if err != nil || user == nil {
+		return ""
+	}
+	if user.Language != "" || ch.config.DisableLanguageDetection {
+		return user.Language
+	}
+
+	detect := DetectLanguage
+	if ch.config.DetectLanguage != nil {
+		detect = ch.config.DetectLanguage
+	}
+	language := detect(message)
+	if language == "" {
+		return ""
+	}
+	user.SetLanguage(language)
+	if err := ch.saveUser(user); err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to save detected user language", "user_id", userID, "language", language, "error", err)
+	} else {
+		ch.logger().Info("[CoreHandler] 🌐 User language detected", "user_id", userID, "language", language)
+	}
+	return language
+}
+
+// statusMessagesFor returns the status messages of language, or the default ones when it has
+// no translation
+func (ch *CoreHandler) statusMessagesFor(language string) *statusMessages {
+	if sm, ok := ch.localizedStatus[language]; ok {
+		return sm
+	}
+	return ch.statusMessages
+}
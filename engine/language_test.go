@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	for text, want := range map[string]string{
+		"What are your opening hours?":                   "en",
+		"Bonjour, quels sont vos horaires d'ouverture ?": "fr",
+		"¿Cuál es el horario de la tienda?":              "es",
+		"Wie lange haben Sie heute geöffnet?":            "de",
+		"Ciao, come posso prenotare un tavolo?":          "it",
+		"Olá, você pode me ajudar com isso?":             "pt",
+		"Hoe laat gaat de winkel open?":                  "nl",
+		"سلام، ساعت کاری فروشگاه چیست؟":                  "fa",
+		"مرحبا، ما هي ساعات العمل؟":                      "ar",
+		"Привет, когда вы открываетесь?":                 "ru",
+		"こんにちは、営業時間を教えてください":                             "ja",
+		"你们几点开门？":                                        "zh",
+		"안녕하세요, 영업시간이 어떻게 되나요?":                          "ko",
+		"ok":        "",
+		"12345 !!!": "",
+	} {
+		if got := DetectLanguage(text); got != want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+// TestCoreHandlerUserLanguage verifies the language detected from a user's first message is
+// stored, asked for in the system prompt and used for moderation and status messages
+func TestCoreHandlerUserLanguage(t *testing.T) {
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	agent := &Engine{Sessions: sqliteStore}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+
+	if language := ch.userLanguage("alice", "Bonjour, quels sont vos horaires d'ouverture ?"); language != "fr" {
+		t.Fatalf("Expected French to be detected, got %q", language)
+	}
+	// The first detected language sticks
+	if language := ch.userLanguage("alice", "What are your opening hours?"); language != "fr" {
+		t.Fatalf("Expected the stored language to be kept, got %q", language)
+	}
+	user, err := sqliteStore.GetOrCreateUser("alice")
+	if err != nil || user.Language != "fr" {
+		t.Fatalf("Expected the language to be stored on the user, got %+v (%v)", user, err)
+	}
+
+	prompts, _, err := ch.buildSystemPrompts("alice")
+	if err != nil {
+		t.Fatalf("buildSystemPrompts failed: %v", err)
+	}
+	prompt := strings.Join(prompts, "\n")
+	if !strings.Contains(prompt, "Always respond in French") || !strings.Contains(prompt, "Réponds toujours en français.") {
+		t.Fatalf("Expected the French instruction in the system prompt, got:\n%s", prompt)
+	}
+
+	if got := ch.statusMessagesFor("fr").message(StatusThinking, ""); got != "Réflexion..." {
+		t.Errorf("Expected a French status message, got %q", got)
+	}
+	if _, err := ch.banUserTool(context.Background(), "alice", map[string]interface{}{"duration_hours": 2.0}); err != nil {
+		t.Fatalf("ban_user failed: %v", err)
+	}
+	if user, _ := sqliteStore.GetOrCreateUser("alice"); user.BanMessage != "Votre accès a été restreint pendant 2 heures." {
+		t.Errorf("Expected a French ban message, got %q", user.BanMessage)
+	}
+
+	// An explicit language replaces the detected one
+	if err := ch.SetUserLanguage("alice", "EN"); err != nil {
+		t.Fatalf("SetUserLanguage failed: %v", err)
+	}
+	prompts, _, _ = ch.buildSystemPrompts("alice")
+	prompt = strings.Join(prompts, "\n")
+	if !strings.Contains(prompt, "Always respond in English") || strings.Contains(prompt, "français") {
+		t.Errorf("Expected the English instruction only, got:\n%s", prompt)
+	}
+
+	// Without detection users only get a language explicitly
+	ch.config.DisableLanguageDetection = true
+	if language := ch.userLanguage("bob", "Bonjour, quels sont vos horaires d'ouverture ?"); language != "" {
+		t.Errorf("Expected no detection when disabled, got %q", language)
+	}
+}
@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghiac/agentize/model"
+)
+
+// resolveLLMOverride merges the llm overrides of the session's opened nodes.
+// Nodes are applied from shallowest to deepest (then in the order they were opened),
+// so with the default override strategy the deepest node the session advanced to wins.
+func (e *Engine) resolveLLMOverride(session *model.Session) (model.LLMOverride, error) {
+	if len(session.NodeDigests) == 0 {
+		return model.LLMOverride{}, nil
+	}
+
+	paths := make([]string, 0, len(session.NodeDigests))
+	for _, digest := range session.NodeDigests {
+		paths = append(paths, digest.Path)
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return strings.Count(paths[i], "/") < strings.Count(paths[j], "/")
+	})
+
+	overrides := make([]model.LLMOverride, 0, len(paths))
+	for _, path := range paths {
+		node, err := e.Repo.LoadNode(path)
+		if err != nil || node.LLM.IsZero() {
+			continue
+		}
+		overrides = append(overrides, node.LLM)
+	}
+
+	merged, err := model.MergeLLMOverrides(e.llmConfig.NodeOverrideStrategy, overrides...)
+	if err != nil {
+		return model.LLMOverride{}, fmt.Errorf("failed to resolve node llm overrides: %w", err)
+	}
+	return merged, nil
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestResolveLLMOverride(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root", "faq"), 0755)
+	os.MkdirAll(filepath.Join(dir, "root", "faq", "deep"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.yaml"), []byte("id: root\nllm:\n  model: \"base-model\"\n  temperature: 0.5\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "faq", "node.yaml"), []byte("id: faq\nllm:\n  model: \"cheap-model\"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "faq", "deep", "node.yaml"), []byte("id: deep\nllm:\n  max_tokens: 500\n"), 0644)
+
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	e := &Engine{Repo: repo}
+
+	// Opened deepest-first: resolution still applies shallow -> deep
+	session := &model.Session{NodeDigests: []model.NodeDigest{
+		{Path: "root/faq/deep"}, {Path: "root/faq"}, {Path: "root"},
+	}}
+	got, err := e.resolveLLMOverride(session)
+	if err != nil {
+		t.Fatalf("resolveLLMOverride failed: %v", err)
+	}
+	if got.Model != "cheap-model" || got.MaxTokens != 500 || got.Temperature == nil || *got.Temperature != 0.5 {
+		t.Errorf("Unexpected override: %+v", got)
+	}
+
+	e.llmConfig.NodeOverrideStrategy = model.MergeStrategyError
+	if _, err := e.resolveLLMOverride(session); err == nil {
+		t.Error("Expected conflict error with MergeStrategyError")
+	}
+
+	if got, _ := e.resolveLLMOverride(&model.Session{}); !got.IsZero() {
+		t.Errorf("Expected empty override for session without nodes, got %+v", got)
+	}
+}
+
+func TestEngineProcessMessage_NodeModel(t *testing.T) {
+	var mu sync.Mutex
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		models = append(models, req.Model)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "ok"},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root", "coding"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "coding", "node.md"), []byte("# Coding"), 0644)
+	os.WriteFile(filepath.Join(dir, "root", "coding", "node.yaml"), []byte("id: coding\nmodel: \"strong-model\"\n"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	if err := e.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "default-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, _, err := e.ProcessMessage(ctx, session.SessionID, "hi"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	if _, err := e.Advance(ctx, session.SessionID, "root", "coding"); err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	if _, _, err := e.ProcessMessage(ctx, session.SessionID, "write code"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(models) != 2 || models[0] != "default-model" || models[1] != "strong-model" {
+		t.Fatalf("Expected default-model then strong-model, got %v", models)
+	}
+}
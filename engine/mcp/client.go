@@ -0,0 +1,371 @@
+// Package mcp connects agents to the tools of MCP (Model Context Protocol) servers. A Manager
+// connects to the servers configured in config.Config.MCPServers over stdio or SSE, lists their
+// tools and registers them as functions proxied to the server:
+//
+//	manager := mcp.Connect(ctx, cfg.MCPServers)
+//	defer manager.Close()
+//	manager.Register(ag) // an engine.Engine or agentize.Agentize
+//
+// A server that cannot be reached is logged and reported by Status; its tools are unavailable
+// and the other servers keep working.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ghiac/agentize/config"
+	"github.com/ghiac/agentize/log"
+)
+
+const (
+	// protocolVersion is the MCP revision the client speaks
+	protocolVersion = "2024-11-05"
+	// DefaultTimeout bounds connecting to a server and each tool call
+	DefaultTimeout = 30 * time.Second
+	// DefaultMaxResultBytes caps the tool results passed to the model
+	DefaultMaxResultBytes = 16384
+)
+
+// ErrClosed is returned for calls to a server whose connection ended
+var ErrClosed = errors.New("mcp: connection closed")
+
+// Tool is a tool listed by an MCP server
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+// RPCError is a JSON-RPC error returned by a server
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp: %s (code %d)", e.Message, e.Code)
+}
+
+// rpcMessage is a JSON-RPC 2.0 request, notification (no ID) or response
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// incomingMessage is rpcMessage as received: the ID of server requests need not be a number
+type incomingMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RPCError       `json:"error,omitempty"`
+}
+
+// transport carries JSON-RPC messages to and from a server
+type transport interface {
+	// send delivers one message to the server
+	send(ctx context.Context, msg []byte) error
+	// messages returns the messages received from the server, closed when the connection ends
+	messages() <-chan []byte
+	close() error
+}
+
+// Client is a connection to one MCP server
+type Client struct {
+	name           string
+	t              transport
+	timeout        time.Duration
+	maxResultBytes int
+
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[int64]chan incomingMessage
+	done    chan struct{}
+	tools   []Tool
+}
+
+// Dial connects to the server configured as name, completes the MCP handshake and lists its tools
+func Dial(ctx context.Context, name string, server config.MCPServerConfig) (*Client, error) {
+	timeout := server.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var t transport
+	var err error
+	switch server.Transport {
+	case "stdio":
+		t, err = startStdio(name, server)
+	case "sse":
+		t, err = dialSSE(ctx, server)
+	default:
+		err = fmt.Errorf("unknown transport %q", server.Transport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mcp: failed to connect to %s: %w", name, err)
+	}
+
+	c := &Client{
+		name:           name,
+		t:              t,
+		timeout:        timeout,
+		maxResultBytes: server.MaxResultBytes,
+		pending:        make(map[int64]chan incomingMessage),
+		done:           make(chan struct{}),
+	}
+	if c.maxResultBytes <= 0 {
+		c.maxResultBytes = DefaultMaxResultBytes
+	}
+	go c.readLoop()
+
+	if err := c.initialize(ctx); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("mcp: failed to initialize %s: %w", name, err)
+	}
+	if c.tools, err = c.listTools(ctx); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("mcp: failed to list the tools of %s: %w", name, err)
+	}
+	return c, nil
+}
+
+// Name returns the name the server is configured under
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Tools returns the tools the server listed when connecting
+func (c *Client) Tools() []Tool {
+	return c.tools
+}
+
+// Close ends the connection; pending calls fail with ErrClosed
+func (c *Client) Close() error {
+	return c.t.close()
+}
+
+// closed reports whether the connection ended
+func (c *Client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// initialize runs the MCP handshake
+func (c *Client) initialize(ctx context.Context) error {
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "agentize", "version": "1.0.0"},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	log.Log.Info("[MCP] 🔌 Connected", "server", c.name, "server_name", result.ServerInfo.Name,
+		"server_version", result.ServerInfo.Version, "protocol", result.ProtocolVersion)
+	return c.notify(ctx, "notifications/initialized")
+}
+
+// listTools lists every tool of the server, following pagination
+func (c *Client) listTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool calls a tool of the server and returns its result as text, truncated to the server's
+// MaxResultBytes. A result the server flags as an error is returned as an error.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if args == nil {
+		args = map[string]any{}
+	}
+	var result struct {
+		Content []struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			MimeType string `json:"mimeType"`
+			Resource *struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"resource"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &result); err != nil {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return "", fmt.Errorf("mcp: %s did not answer within %s", c.name, c.timeout)
+		case errors.Is(err, ErrClosed):
+			return "", fmt.Errorf("mcp: %s is unavailable: %w", c.name, err)
+		}
+		return "", err
+	}
+
+	parts := make([]string, 0, len(result.Content))
+	for _, content := range result.Content {
+		switch {
+		case content.Type == "text":
+			parts = append(parts, content.Text)
+		case content.Type == "resource" && content.Resource != nil && content.Resource.Text != "":
+			parts = append(parts, content.Resource.Text)
+		case content.Type == "resource" && content.Resource != nil:
+			parts = append(parts, fmt.Sprintf("[resource: %s]", content.Resource.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content: %s]", content.Type, content.MimeType))
+		}
+	}
+	text := truncate(strings.Join(parts, "\n"), c.maxResultBytes)
+	if result.IsError {
+		return "", errors.New(text)
+	}
+	return text, nil
+}
+
+// call sends a request and decodes the result of its response into result
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	id := c.nextID.Add(1)
+	response := make(chan incomingMessage, 1)
+	c.mu.Lock()
+	c.pending[id] = response
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	msg, err := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if err := c.t.send(ctx, msg); err != nil {
+		return err
+	}
+	select {
+	case resp := <-response:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	case <-c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification
+func (c *Client) notify(ctx context.Context, method string) error {
+	msg, err := json.Marshal(rpcMessage{JSONRPC: "2.0", Method: method})
+	if err != nil {
+		return err
+	}
+	return c.t.send(ctx, msg)
+}
+
+// readLoop dispatches the server's responses to the pending calls and answers its requests
+func (c *Client) readLoop() {
+	defer close(c.done)
+	for data := range c.t.messages() {
+		var msg incomingMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Log.Warn("[MCP] ⚠️  Invalid message", "server", c.name, "error", err)
+			continue
+		}
+		switch {
+		case msg.Method != "" && len(msg.ID) > 0:
+			c.answer(msg)
+		case msg.Method != "":
+			log.Log.Debug("[MCP] Notification", "server", c.name, "method", msg.Method)
+		default:
+			var id int64
+			if json.Unmarshal(msg.ID, &id) != nil {
+				continue
+			}
+			c.mu.Lock()
+			response, ok := c.pending[id]
+			c.mu.Unlock()
+			if ok {
+				response <- msg
+			}
+		}
+	}
+}
+
+// answer replies to a request of the server: ping is answered, everything else (sampling,
+// roots) is not supported
+func (c *Client) answer(request incomingMessage) {
+	reply := map[string]any{"jsonrpc": "2.0", "id": request.ID}
+	if request.Method == "ping" {
+		reply["result"] = map[string]any{}
+	} else {
+		reply["error"] = RPCError{Code: -32601, Message: "method not supported: " + request.Method}
+	}
+	msg, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if err := c.t.send(ctx, msg); err != nil {
+		log.Log.Warn("[MCP] ⚠️  Failed to answer the server", "server", c.name, "method", request.Method, "error", err)
+	}
+}
+
+// truncate cuts s to at most maxBytes bytes, on a character boundary, and marks the cut
+func truncate(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "\n... [truncated]"
+}
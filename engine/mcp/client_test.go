@@ -0,0 +1,242 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/config"
+	"github.com/sashabaranov/go-openai"
+)
+
+// TestMain runs the test binary as a stdio MCP server when asked to by the stdio tests
+func TestMain(m *testing.M) {
+	if os.Getenv("AGENTIZE_TEST_MCP_SERVER") == "1" {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if reply := fakeServer(scanner.Bytes()); reply != nil {
+				os.Stdout.Write(append(reply, '\n'))
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeServer answers one JSON-RPC message like an MCP server with an echo, a slow and a failing
+// tool, listed over two pages (nil for notifications)
+func fakeServer(data []byte) []byte {
+	var msg struct {
+		ID     *int64         `json:"id"`
+		Method string         `json:"method"`
+		Params map[string]any `json:"params"`
+	}
+	if json.Unmarshal(data, &msg) != nil || msg.ID == nil {
+		return nil
+	}
+	var result any
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{"protocolVersion": protocolVersion, "capabilities": map[string]any{"tools": map[string]any{}},
+			"serverInfo": map[string]any{"name": "fake", "version": "1.0"}}
+	case "tools/list":
+		if msg.Params["cursor"] == nil {
+			result = map[string]any{"nextCursor": "2", "tools": []map[string]any{{"name": "echo", "description": "Echoes text",
+				"inputSchema": map[string]any{"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}, "required": []string{"text"}}}}}
+		} else {
+			result = map[string]any{"tools": []map[string]any{{"name": "slow"}, {"name": "fail"}}}
+		}
+	case "tools/call":
+		args, _ := msg.Params["arguments"].(map[string]any)
+		switch msg.Params["name"] {
+		case "echo":
+			keys := make([]string, 0, len(args))
+			for key := range args {
+				keys = append(keys, key)
+			}
+			result = map[string]any{"content": []map[string]any{{"type": "text", "text": fmt.Sprintf("%v", args["text"])},
+				{"type": "text", "text": fmt.Sprintf("%d args", len(keys))}}}
+		case "slow":
+			time.Sleep(time.Second)
+			result = map[string]any{"content": []map[string]any{}}
+		default:
+			result = map[string]any{"isError": true, "content": []map[string]any{{"type": "text", "text": "ticket system is down"}}}
+		}
+	default:
+		reply, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": *msg.ID, "error": map[string]any{"code": -32601, "message": "unknown method"}})
+		return reply
+	}
+	reply, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": *msg.ID, "result": result})
+	return reply
+}
+
+// stdioServer returns the config of a stdio server running TestMain's fake server
+func stdioServer(t *testing.T) config.MCPServerConfig {
+	t.Setenv("AGENTIZE_TEST_MCP_SERVER", "1")
+	return config.MCPServerConfig{Transport: "stdio", Command: os.Args[0], Timeout: 300 * time.Millisecond, MaxResultBytes: 12}
+}
+
+// sseServer starts the fake server behind the HTTP+SSE transport, checking the auth header
+func sseServer(t *testing.T) config.MCPServerConfig {
+	var mu sync.Mutex
+	var stream chan []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			events := make(chan []byte, 16)
+			mu.Lock()
+			stream = events
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: endpoint\ndata: /messages?session=1\n\n")
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case event := <-events:
+					fmt.Fprintf(w, "event: message\ndata: %s\n\n", event)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		case http.MethodPost:
+			var body json.RawMessage
+			json.NewDecoder(r.Body).Decode(&body)
+			w.WriteHeader(http.StatusAccepted)
+			go func() {
+				if reply := fakeServer(body); reply != nil {
+					mu.Lock()
+					stream <- reply
+					mu.Unlock()
+				}
+			}()
+		}
+	}))
+	t.Cleanup(server.Close)
+	return config.MCPServerConfig{Transport: "sse", URL: server.URL + "/sse", Headers: map[string]string{"Authorization": "Bearer secret"},
+		Timeout: 300 * time.Millisecond, MaxResultBytes: 12}
+}
+
+func TestClient(t *testing.T) {
+	for _, transport := range []string{"stdio", "sse"} {
+		t.Run(transport, func(t *testing.T) {
+			server := stdioServer(t)
+			if transport == "sse" {
+				server = sseServer(t)
+			}
+			ctx := context.Background()
+			client, err := Dial(ctx, "tickets", server)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer client.Close()
+
+			var names []string
+			for _, tool := range client.Tools() {
+				names = append(names, tool.Name)
+			}
+			if strings.Join(names, ",") != "echo,slow,fail" {
+				t.Fatalf("Expected the tools of both pages, got %v", names)
+			}
+
+			result, err := client.CallTool(ctx, "echo", map[string]any{"text": "hello"})
+			if err != nil || result != "hello\n1 args" {
+				t.Fatalf("Expected the echoed text, got %q (%v)", result, err)
+			}
+			// Results are capped to MaxResultBytes
+			result, err = client.CallTool(ctx, "echo", map[string]any{"text": "hello world"})
+			if err != nil || result != "hello world\n\n... [truncated]" {
+				t.Fatalf("Expected a truncated result, got %q (%v)", result, err)
+			}
+			if _, err := client.CallTool(ctx, "fail", nil); err == nil || err.Error() != "ticket syste\n... [truncated]" {
+				t.Fatalf("Expected the tool's error, got %v", err)
+			}
+			if _, err := client.CallTool(ctx, "slow", nil); err == nil || !strings.Contains(err.Error(), "did not answer within 300ms") {
+				t.Fatalf("Expected a timeout, got %v", err)
+			}
+		})
+	}
+}
+
+// registrar records the tools registered by a Manager
+type registrar struct {
+	servers  map[string]string
+	defs     map[string]openai.FunctionDefinition
+	handlers map[string]func(ctx context.Context, args map[string]any) (string, error)
+}
+
+func (r *registrar) RegisterMCPFunction(server string, name string, def openai.FunctionDefinition, handler func(ctx context.Context, args map[string]any) (string, error)) error {
+	if _, ok := r.defs[name]; ok {
+		return fmt.Errorf("function already registered for tool: %s", name)
+	}
+	r.servers[name], r.defs[name], r.handlers[name] = server, def, handler
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	tickets := stdioServer(t)
+	tickets.ToolPrefix = "tickets_"
+	manager := Connect(context.Background(), map[string]config.MCPServerConfig{
+		"tickets": tickets,
+		"wiki":    sseServer(t),
+		"broken":  {Transport: "stdio", Command: "/nonexistent/mcp-server"},
+		"off":     {Transport: "sse", URL: "http://localhost:1", Disabled: true},
+	})
+	defer manager.Close()
+
+	// Unreachable servers are reported, without failing the others
+	statuses := map[string]ServerStatus{}
+	for _, status := range manager.Status() {
+		statuses[status.Name] = status
+	}
+	if statuses["broken"].Connected || statuses["broken"].Error == "" || statuses["off"].Error != "disabled" {
+		t.Fatalf("Expected broken and off to be unavailable, got %+v", statuses)
+	}
+	if !statuses["tickets"].Connected || !statuses["wiki"].Connected {
+		t.Fatalf("Expected tickets and wiki to be connected, got %+v", statuses)
+	}
+
+	r := &registrar{servers: map[string]string{}, defs: map[string]openai.FunctionDefinition{},
+		handlers: map[string]func(ctx context.Context, args map[string]any) (string, error){}}
+	manager.Register(r)
+	if len(r.defs) != 6 || r.servers["tickets_echo"] != "tickets" || r.servers["echo"] != "wiki" {
+		t.Fatalf("Expected the tools of tickets (prefixed) and wiki, got %v", r.servers)
+	}
+	schema, _ := json.Marshal(r.defs["tickets_echo"].Parameters)
+	if r.defs["tickets_echo"].Description != "Echoes text" || !strings.Contains(string(schema), `"required":["text"]`) {
+		t.Fatalf("Expected the tool's description and input schema, got %+v (%s)", r.defs["tickets_echo"], schema)
+	}
+	if schema, _ := json.Marshal(r.defs["slow"].Parameters); string(schema) != `{"properties":{},"type":"object"}` {
+		t.Fatalf("Expected an empty object schema for a tool without one, got %s", schema)
+	}
+
+	// The engine's internal arguments are not forwarded
+	result, err := r.handlers["tickets_echo"](context.Background(), map[string]any{"text": "hi", "__user_id__": "alice"})
+	if err != nil || result != "hi\n1 args" {
+		t.Fatalf("Expected the call to be proxied, got %q (%v)", result, err)
+	}
+	if got := manager.Status()[3]; got.Name != "wiki" || len(got.Tools) != 3 {
+		t.Fatalf("Expected wiki's registered tools in its status, got %+v", got)
+	}
+
+	// A server that goes away degrades to failing calls
+	manager.servers["tickets"].client.Close()
+	if _, err := r.handlers["tickets_echo"](context.Background(), map[string]any{"text": "hi"}); err == nil || !strings.Contains(err.Error(), "tickets is unavailable") {
+		t.Fatalf("Expected the closed server to be unavailable, got %v", err)
+	}
+	if status := manager.Status()[2]; status.Name != "tickets" || status.Connected {
+		t.Fatalf("Expected tickets to be reported disconnected, got %+v", status)
+	}
+}
@@ -0,0 +1,159 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghiac/agentize/config"
+	"github.com/ghiac/agentize/log"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Registrar is anything MCP tools can be registered on (engine.Engine, agentize.Agentize)
+type Registrar interface {
+	RegisterMCPFunction(server string, name string, def openai.FunctionDefinition, handler func(ctx context.Context, args map[string]any) (string, error)) error
+}
+
+// ServerStatus describes the connection to one configured server
+type ServerStatus struct {
+	Name      string   `json:"name"`
+	Transport string   `json:"transport"`
+	Connected bool     `json:"connected"`
+	Tools     []string `json:"tools,omitempty"` // names the tools are registered under
+	Error     string   `json:"error,omitempty"` // why the server is unavailable
+}
+
+// Manager holds the connections to the configured MCP servers
+type Manager struct {
+	mu      sync.RWMutex
+	servers map[string]*server
+}
+
+// server is a configured server and, once connected, its client
+type server struct {
+	config config.MCPServerConfig
+	client *Client
+	err    error
+	tools  []string
+}
+
+// Connect connects to every enabled server of servers (in parallel). A server that cannot be
+// reached is logged and reported by Status; it does not fail the others.
+func Connect(ctx context.Context, servers map[string]config.MCPServerConfig) *Manager {
+	m := &Manager{servers: make(map[string]*server, len(servers))}
+	var wg sync.WaitGroup
+	for name, cfg := range servers {
+		s := &server{config: cfg}
+		m.servers[name] = s
+		if cfg.Disabled {
+			s.err = fmt.Errorf("disabled")
+			continue
+		}
+		wg.Add(1)
+		go func(name string, s *server) {
+			defer wg.Done()
+			client, err := Dial(ctx, name, s.config)
+			if err != nil {
+				log.Log.Warn("[MCP] ⚠️  Server unavailable, its tools are not offered", "server", name, "error", err)
+			} else {
+				log.Log.Info("[MCP] ✅ Server connected", "server", name, "tools", len(client.Tools()))
+			}
+			m.mu.Lock()
+			s.client, s.err = client, err
+			m.mu.Unlock()
+		}(name, s)
+	}
+	wg.Wait()
+	return m
+}
+
+// Register registers the tools of every connected server on r, named with the server's
+// ToolPrefix. A tool whose name is already taken is skipped with a warning.
+func (m *Manager) Register(r Registrar) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.names() {
+		s := m.servers[name]
+		if s.client == nil {
+			continue
+		}
+		for _, tool := range s.client.Tools() {
+			toolName := s.config.ToolPrefix + tool.Name
+			if err := r.RegisterMCPFunction(name, toolName, Definition(toolName, tool), proxy(s.client, tool.Name)); err != nil {
+				log.Log.Warn("[MCP] ⚠️  Tool not registered", "server", name, "tool", toolName, "error", err)
+				continue
+			}
+			s.tools = append(s.tools, toolName)
+		}
+	}
+}
+
+// proxy returns a tool function calling tool on the server of client
+func proxy(client *Client, tool string) func(ctx context.Context, args map[string]any) (string, error) {
+	return func(ctx context.Context, args map[string]any) (string, error) {
+		// Drop the engine's internal arguments (__user_id__, __session_id__)
+		forwarded := make(map[string]any, len(args))
+		for key, value := range args {
+			if !strings.HasPrefix(key, "__") || !strings.HasSuffix(key, "__") {
+				forwarded[key] = value
+			}
+		}
+		return client.CallTool(ctx, tool, forwarded)
+	}
+}
+
+// Definition converts an MCP tool into a function definition named name for the model
+func Definition(name string, tool Tool) openai.FunctionDefinition {
+	var parameters any = json.RawMessage(tool.InputSchema)
+	if len(tool.InputSchema) == 0 || string(tool.InputSchema) == "null" {
+		parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	return openai.FunctionDefinition{Name: name, Description: tool.Description, Parameters: parameters}
+}
+
+// Status returns the state of every configured server, sorted by name
+func (m *Manager) Status() []ServerStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	statuses := make([]ServerStatus, 0, len(m.servers))
+	for _, name := range m.names() {
+		s := m.servers[name]
+		status := ServerStatus{Name: name, Transport: s.config.Transport, Tools: s.tools}
+		switch {
+		case s.err != nil:
+			status.Error = s.err.Error()
+		case s.client.closed():
+			status.Error = ErrClosed.Error()
+		default:
+			status.Connected = true
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Close disconnects from every server
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.servers {
+		if s.client != nil {
+			s.client.Close()
+		}
+	}
+	return nil
+}
+
+// names returns the configured server names, sorted
+func (m *Manager) names() []string {
+	names := make([]string, 0, len(m.servers))
+	for name := range m.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
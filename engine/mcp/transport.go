@@ -0,0 +1,255 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghiac/agentize/config"
+	"github.com/ghiac/agentize/log"
+)
+
+// stdioTransport talks to a server process over its stdin and stdout, one JSON message per line
+type stdioTransport struct {
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	in    chan []byte
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+	exited    chan struct{}
+}
+
+// startStdio starts the server command
+func startStdio(name string, server config.MCPServerConfig) (*stdioTransport, error) {
+	cmd := exec.Command(server.Command, server.Args...)
+	cmd.Env = os.Environ()
+	for key, value := range server.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	t := &stdioTransport{name: name, cmd: cmd, stdin: stdin, in: make(chan []byte, 16), exited: make(chan struct{})}
+	go func() {
+		defer close(t.in)
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				t.in <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		// The server logs to stderr
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Log.Debug("[MCP] stderr", "server", name, "line", scanner.Text())
+		}
+	}()
+	go func() {
+		err := cmd.Wait()
+		close(t.exited)
+		log.Log.Info("[MCP] 🔌 Server process exited", "server", name, "error", err)
+	}()
+	return t, nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, msg []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	select {
+	case <-t.exited:
+		return ErrClosed
+	default:
+	}
+	_, err := t.stdin.Write(append(msg, '\n'))
+	return err
+}
+
+func (t *stdioTransport) messages() <-chan []byte {
+	return t.in
+}
+
+// close closes the server's stdin, which asks it to exit, and kills it if it does not
+func (t *stdioTransport) close() error {
+	t.closeOnce.Do(func() {
+		t.stdin.Close()
+		select {
+		case <-t.exited:
+		case <-time.After(2 * time.Second):
+			t.cmd.Process.Kill()
+			<-t.exited
+		}
+	})
+	return nil
+}
+
+// sseTransport talks to a server with the HTTP+SSE transport: messages from the server arrive as
+// "message" events of an event stream, messages to it are POSTed to the endpoint announced by
+// the stream's first ("endpoint") event
+type sseTransport struct {
+	client   *http.Client
+	headers  map[string]string
+	endpoint string
+	body     io.ReadCloser
+	in       chan []byte
+}
+
+// dialSSE opens the event stream and waits for the endpoint to POST to
+func dialSSE(ctx context.Context, server config.MCPServerConfig) (*sseTransport, error) {
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		return nil, err
+	}
+	// The stream outlives ctx, which only bounds connecting
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for key, value := range server.Headers {
+		req.Header.Set(key, value)
+	}
+	t := &sseTransport{client: &http.Client{}, headers: server.Headers, in: make(chan []byte, 16)}
+
+	type connected struct {
+		resp *http.Response
+		err  error
+	}
+	done := make(chan connected, 1)
+	go func() {
+		resp, err := t.client.Do(req)
+		done <- connected{resp, err}
+	}()
+	var resp *http.Response
+	select {
+	case c := <-done:
+		if c.err != nil {
+			return nil, c.err
+		}
+		resp = c.resp
+	case <-ctx.Done():
+		go func() {
+			if c := <-done; c.err == nil {
+				c.resp.Body.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("event stream returned %s", resp.Status)
+	}
+	t.body = resp.Body
+
+	endpoint := make(chan string, 1)
+	go t.readEvents(base, endpoint)
+	select {
+	case e, ok := <-endpoint:
+		if !ok {
+			return nil, fmt.Errorf("event stream ended before announcing its endpoint")
+		}
+		t.endpoint = e
+		return t, nil
+	case <-ctx.Done():
+		t.close()
+		return nil, ctx.Err()
+	}
+}
+
+// readEvents parses the event stream: the first endpoint event is sent to endpoint (closed if
+// the stream ends without one), the data of message events to t.in
+func (t *sseTransport) readEvents(base *url.URL, endpoint chan<- string) {
+	defer close(t.in)
+	announced := false
+	defer func() {
+		if !announced {
+			close(endpoint)
+		}
+	}()
+
+	reader := bufio.NewReader(t.body)
+	event, data := "", []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "" && len(data) > 0:
+			payload := strings.Join(data, "\n")
+			switch event {
+			case "endpoint":
+				if ref, err := base.Parse(payload); err == nil && !announced {
+					announced = true
+					endpoint <- ref.String()
+				}
+			case "", "message":
+				t.in <- []byte(payload)
+			}
+			event, data = "", data[:0]
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *sseTransport) send(ctx context.Context, msg []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (t *sseTransport) messages() <-chan []byte {
+	return t.in
+}
+
+func (t *sseTransport) close() error {
+	return t.body.Close()
+}
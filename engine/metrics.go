@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// EventMessage is the UsageEvent type recorded (AfterAction only) when CoreHandler has answered
+// a user message. Name is the message content type, Duration the whole processing time.
+const EventMessage EventType = "message"
+
+// Defaults of PrometheusCallback
+const (
+	defaultActiveSessionWindow = 5 * time.Minute
+	// maxToolLabels caps the distinct tool names used as labels; models may call made-up tools
+	maxToolLabels = 200
+)
+
+var (
+	// Buckets (seconds) of the message and LLM call latency histograms
+	llmLatencyBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120}
+	// Buckets (seconds) of the tool call latency histogram
+	toolLatencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+)
+
+// PrometheusCallback is a Callback that aggregates usage events into Prometheus metrics on its own
+// registry, served by ServeHTTP (see Agentize.SetMetrics for the /metrics route).
+// It wraps an optional next Callback (e.g. billing): BeforeAction decisions are left to next and
+// every event is passed on to it.
+//
+//	metrics := engine.NewPrometheusCallback(billing)
+//	coreHandler.SetCallback(metrics)
+//	metrics.WatchBackups("core", coreHandler.BackupStatus)
+type PrometheusCallback struct {
+	next Callback
+
+	// ActiveSessionWindow is how recently a session must have had an event to count as active
+	// (default: 5 minutes)
+	ActiveSessionWindow time.Duration
+
+	registry        *prometheus.Registry
+	handler         http.Handler
+	messages        *prometheus.CounterVec // content type, result
+	messageDuration prometheus.Histogram
+	llmDuration     *prometheus.HistogramVec // model
+	llmTokens       *prometheus.CounterVec   // model, kind
+	llmCost         *prometheus.CounterVec   // model
+	toolDuration    *prometheus.HistogramVec // tool
+	toolErrors      *prometheus.CounterVec   // tool
+	agentCalls      *prometheus.CounterVec   // agent type, result
+	escalations     *prometheus.CounterVec   // trigger
+	feedback        *prometheus.CounterVec   // rating
+
+	mu        sync.Mutex
+	now       func() time.Time
+	tools     map[string]bool      // tool label values in use
+	sessions  map[string]time.Time // session ID -> last event, only counted
+	backups   []backupSource
+	nodeCache func() fsrepo.CacheStats
+}
+
+// backupSource is a backup chain whose provider health is exported at scrape time
+type backupSource struct {
+	component string
+	status    func() []ProviderStatus
+}
+
+// NewPrometheusCallback creates a PrometheusCallback passing events on to next (may be nil)
+func NewPrometheusCallback(next Callback) *PrometheusCallback {
+	p := &PrometheusCallback{
+		next:     next,
+		registry: prometheus.NewRegistry(),
+		now:      time.Now,
+		tools:    make(map[string]bool),
+		sessions: make(map[string]time.Time),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agentize_messages_processed_total",
+			Help: "User messages answered by the Core, by content type and result.",
+		}, []string{"content_type", "result"}),
+		messageDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "agentize_message_duration_seconds",
+			Help:    "Time to answer a user message.",
+			Buckets: llmLatencyBuckets,
+		}),
+		llmDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "agentize_llm_call_duration_seconds",
+			Help:    "LLM call latency, by model.",
+			Buckets: llmLatencyBuckets,
+		}, []string{"model"}),
+		llmTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agentize_llm_tokens_total",
+			Help: "LLM tokens consumed, by model and kind (input, output, cached_input).",
+		}, []string{"model", "kind"}),
+		llmCost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agentize_llm_cost_usd_total",
+			Help: "LLM cost in USD from the CostTable, by model.",
+		}, []string{"model"}),
+		toolDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "agentize_tool_call_duration_seconds",
+			Help:    "Tool call latency, by tool.",
+			Buckets: toolLatencyBuckets,
+		}, []string{"tool"}),
+		toolErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agentize_tool_call_errors_total",
+			Help: "Failed tool calls, by tool.",
+		}, []string{"tool"}),
+		agentCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agentize_agent_calls_total",
+			Help: "Messages routed to a UserAgent, by agent type and result.",
+		}, []string{"agent_type", "result"}),
+		escalations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agentize_escalations_total",
+			Help: "Messages escalated from the low to the high agent, by trigger.",
+		}, []string{"trigger"}),
+		feedback: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "agentize_feedback_total",
+			Help: "Ratings of answers recorded with CoreHandler.RecordFeedback, by rating (up, down).",
+		}, []string{"rating"}),
+	}
+	p.registry.MustRegister(
+		p.messages, p.messageDuration, p.llmDuration, p.llmTokens, p.llmCost,
+		p.toolDuration, p.toolErrors, p.agentCalls, p.escalations, p.feedback,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "agentize_active_sessions",
+			Help: "Sessions with activity within the active session window.",
+		}, p.activeSessions),
+		watchedCollector{p},
+	)
+	p.handler = promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+	return p
+}
+
+// Registry returns the registry the metrics are served from, to add the application's own collectors
+func (p *PrometheusCallback) Registry() *prometheus.Registry {
+	return p.registry
+}
+
+// WatchBackups exports the backup provider health of a CoreHandler or Engine (their BackupStatus)
+// under the given component label, e.g. "core" or "engine"
+func (p *PrometheusCallback) WatchBackups(component string, status func() []ProviderStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backups = append(p.backups, backupSource{component: component, status: status})
+}
+
+// WatchNodeCache exports the node cache counters of a knowledge tree (its GetCacheStats)
+func (p *PrometheusCallback) WatchNodeCache(stats func() fsrepo.CacheStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nodeCache = stats
+}
+
+// BeforeAction passes the event on to the wrapped callback
+func (p *PrometheusCallback) BeforeAction(ctx context.Context, event *UsageEvent) error {
+	if p.next != nil {
+		return p.next.BeforeAction(ctx, event)
+	}
+	return nil
+}
+
+// AfterAction records the event and passes it on to the wrapped callback
+func (p *PrometheusCallback) AfterAction(ctx context.Context, event *UsageEvent) {
+	p.record(event)
+	if p.next != nil {
+		p.next.AfterAction(ctx, event)
+	}
+}
+
+func (p *PrometheusCallback) record(event *UsageEvent) {
+	if event.SessionID != "" {
+		p.mu.Lock()
+		p.sessions[event.SessionID] = p.now()
+		p.mu.Unlock()
+	}
+	result := "success"
+	if event.Error != nil {
+		result = "error"
+	}
+
+	switch event.EventType {
+	case EventMessage:
+		p.messages.WithLabelValues(event.Name, result).Inc()
+		p.messageDuration.Observe(event.Duration.Seconds())
+	case EventLLMCall:
+		p.llmDuration.WithLabelValues(event.Model).Observe(event.Duration.Seconds())
+		p.llmTokens.WithLabelValues(event.Model, "input").Add(float64(event.InputTokens))
+		p.llmTokens.WithLabelValues(event.Model, "output").Add(float64(event.OutputTokens))
+		p.llmTokens.WithLabelValues(event.Model, "cached_input").Add(float64(event.CachedInputTokens))
+		if event.CostUSD > 0 {
+			p.llmCost.WithLabelValues(event.Model).Add(event.CostUSD)
+		}
+	case EventToolCall:
+		tool := p.toolLabel(event.Name)
+		p.toolDuration.WithLabelValues(tool).Observe(event.Duration.Seconds())
+		if event.Error != nil {
+			p.toolErrors.WithLabelValues(tool).Inc()
+		}
+	case EventAgentRouting:
+		p.agentCalls.WithLabelValues(event.Name, result).Inc()
+	case EventEscalation:
+		trigger, _ := event.Metadata["trigger"].(string)
+		p.escalations.WithLabelValues(trigger).Inc()
+	case EventFeedback:
+		p.feedback.WithLabelValues(event.Name).Inc()
+	}
+}
+
+// toolLabel returns the tool label of name: "other" once maxToolLabels distinct tools were seen
+func (p *PrometheusCallback) toolLabel(name string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.tools[name] {
+		if len(p.tools) >= maxToolLabels {
+			return "other"
+		}
+		p.tools[name] = true
+	}
+	return name
+}
+
+// activeSessions drops the sessions idle for longer than the window and counts the others
+func (p *PrometheusCallback) activeSessions() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	window := p.ActiveSessionWindow
+	if window <= 0 {
+		window = defaultActiveSessionWindow
+	}
+	cutoff := p.now().Add(-window)
+	for sessionID, lastSeen := range p.sessions {
+		if lastSeen.Before(cutoff) {
+			delete(p.sessions, sessionID)
+		}
+	}
+	return float64(len(p.sessions))
+}
+
+// ServeHTTP serves the metrics of the registry (see promhttp.HandlerFor)
+func (p *PrometheusCallback) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.handler.ServeHTTP(w, r)
+}
+
+// WriteMetrics writes the metrics in the Prometheus text exposition format
+func (p *PrometheusCallback) WriteMetrics(w io.Writer) error {
+	families, err := p.registry.Gather()
+	if err != nil {
+		return err
+	}
+	encoder := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	backupCallsDesc = prometheus.NewDesc("agentize_backup_llm_calls_total",
+		"Backup LLM provider calls, by component, provider and result.", []string{"component", "provider", "result"}, nil)
+	backupBreakerDesc = prometheus.NewDesc("agentize_backup_llm_breaker_open",
+		"1 while the circuit breaker of a backup LLM provider is open.", []string{"component", "provider"}, nil)
+	nodeCacheRequestsDesc = prometheus.NewDesc("agentize_node_cache_requests_total",
+		"Knowledge node loads, by result (hit, miss, stale).", []string{"result"}, nil)
+	nodeCacheEntriesDesc = prometheus.NewDesc("agentize_node_cache_entries",
+		"Knowledge nodes currently cached.", nil, nil)
+)
+
+// watchedCollector reads the watched backup chains and node cache at scrape time
+type watchedCollector struct {
+	p *PrometheusCallback
+}
+
+func (c watchedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- backupCallsDesc
+	ch <- backupBreakerDesc
+	ch <- nodeCacheRequestsDesc
+	ch <- nodeCacheEntriesDesc
+}
+
+func (c watchedCollector) Collect(ch chan<- prometheus.Metric) {
+	c.p.mu.Lock()
+	backups := append([]backupSource(nil), c.p.backups...)
+	nodeCache := c.p.nodeCache
+	c.p.mu.Unlock()
+
+	// Backup chains lock themselves; read them outside p.mu
+	for _, source := range backups {
+		for _, st := range source.status() {
+			ch <- prometheus.MustNewConstMetric(backupCallsDesc, prometheus.CounterValue, float64(st.TotalSuccesses), source.component, st.Name, "success")
+			ch <- prometheus.MustNewConstMetric(backupCallsDesc, prometheus.CounterValue, float64(st.TotalFailures), source.component, st.Name, "error")
+			open := 0.0
+			if st.State == BreakerOpen {
+				open = 1
+			}
+			ch <- prometheus.MustNewConstMetric(backupBreakerDesc, prometheus.GaugeValue, open, source.component, st.Name)
+		}
+	}
+
+	if nodeCache != nil {
+		stats := nodeCache()
+		ch <- prometheus.MustNewConstMetric(nodeCacheRequestsDesc, prometheus.CounterValue, float64(stats.Hits), "hit")
+		ch <- prometheus.MustNewConstMetric(nodeCacheRequestsDesc, prometheus.CounterValue, float64(stats.Misses), "miss")
+		ch <- prometheus.MustNewConstMetric(nodeCacheRequestsDesc, prometheus.CounterValue, float64(stats.Stale), "stale")
+		ch <- prometheus.MustNewConstMetric(nodeCacheEntriesDesc, prometheus.GaugeValue, float64(stats.Entries))
+	}
+}
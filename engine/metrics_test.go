@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/fsrepo"
+)
+
+func TestPrometheusCallback(t *testing.T) {
+	next := &budgetCallback{err: errors.New("balance exhausted")}
+	metrics := NewPrometheusCallback(next)
+	now := time.Unix(1700000000, 0)
+	metrics.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// BeforeAction decisions come from the wrapped callback
+	if err := metrics.BeforeAction(ctx, &UsageEvent{EventType: EventLLMCall}); err == nil {
+		t.Error("Expected the wrapped callback to block the LLM call")
+	}
+
+	metrics.AfterAction(ctx, &UsageEvent{SessionID: "s1", EventType: EventMessage, Name: "text", Duration: 3 * time.Second})
+	metrics.AfterAction(ctx, &UsageEvent{SessionID: "s1", EventType: EventLLMCall, Model: "gpt-4o", Duration: 800 * time.Millisecond, InputTokens: 100, OutputTokens: 20, CachedInputTokens: 50})
+	metrics.AfterAction(ctx, &UsageEvent{SessionID: "s1", EventType: EventLLMCall, Model: "gpt-4o", Duration: 4 * time.Second, InputTokens: 200, OutputTokens: 30})
+	metrics.AfterAction(ctx, &UsageEvent{SessionID: "s2", EventType: EventToolCall, Name: "web_search", Duration: 2 * time.Second, Error: errors.New("timeout")})
+	metrics.AfterAction(ctx, &UsageEvent{SessionID: "s2", EventType: EventAgentRouting, Name: "low"})
+	metrics.AfterAction(ctx, &UsageEvent{EventType: EventEscalation, Name: "high", Metadata: map[string]interface{}{"trigger": "tool"}})
+	metrics.AfterAction(ctx, &UsageEvent{EventType: EventFeedback, Name: "down"})
+	metrics.WatchNodeCache(func() fsrepo.CacheStats {
+		return fsrepo.CacheStats{Hits: 40, Misses: 2, Entries: 2}
+	})
+	metrics.WatchBackups("core", func() []ProviderStatus {
+		return []ProviderStatus{{Name: `cf "oss"`, State: BreakerOpen, TotalSuccesses: 4, TotalFailures: 3}}
+	})
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+	for _, want := range []string{
+		`agentize_messages_processed_total{content_type="text",result="success"} 1`,
+		`agentize_message_duration_seconds_bucket{le="2.5"} 0`,
+		`agentize_message_duration_seconds_bucket{le="5"} 1`,
+		`agentize_llm_call_duration_seconds_bucket{model="gpt-4o",le="1"} 1`,
+		`agentize_llm_call_duration_seconds_bucket{model="gpt-4o",le="+Inf"} 2`,
+		`agentize_llm_call_duration_seconds_sum{model="gpt-4o"} 4.8`,
+		`agentize_llm_call_duration_seconds_count{model="gpt-4o"} 2`,
+		`agentize_llm_tokens_total{kind="input",model="gpt-4o"} 300`,
+		`agentize_llm_tokens_total{kind="output",model="gpt-4o"} 50`,
+		`agentize_llm_tokens_total{kind="cached_input",model="gpt-4o"} 50`,
+		`agentize_tool_call_duration_seconds_count{tool="web_search"} 1`,
+		`agentize_tool_call_errors_total{tool="web_search"} 1`,
+		`agentize_agent_calls_total{agent_type="low",result="success"} 1`,
+		`agentize_escalations_total{trigger="tool"} 1`,
+		`agentize_feedback_total{rating="down"} 1`,
+		`agentize_active_sessions 2`,
+		`agentize_backup_llm_calls_total{component="core",provider="cf \"oss\"",result="success"} 4`,
+		`agentize_backup_llm_calls_total{component="core",provider="cf \"oss\"",result="error"} 3`,
+		`agentize_backup_llm_breaker_open{component="core",provider="cf \"oss\""} 1`,
+		`agentize_node_cache_requests_total{result="hit"} 40`,
+		`agentize_node_cache_requests_total{result="miss"} 2`,
+		`agentize_node_cache_entries 2`,
+		"# TYPE agentize_llm_call_duration_seconds histogram",
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("Metrics output is missing %q", want)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+
+	// Sessions without recent events are no longer active
+	now = now.Add(6 * time.Minute)
+	metrics.AfterAction(ctx, &UsageEvent{SessionID: "s3", EventType: EventLLMCall, Model: "gpt-4o"})
+	var b strings.Builder
+	if err := metrics.WriteMetrics(&b); err != nil {
+		t.Fatalf("WriteMetrics failed: %v", err)
+	}
+	if !strings.Contains(b.String(), "agentize_active_sessions 1\n") {
+		t.Error("Expected only the recent session to be active")
+	}
+
+	// Made-up tool names beyond the label cap share the "other" label
+	for i := 0; i < maxToolLabels+5; i++ {
+		metrics.AfterAction(ctx, &UsageEvent{EventType: EventToolCall, Name: fmt.Sprintf("tool_%d", i)})
+	}
+	b.Reset()
+	metrics.WriteMetrics(&b)
+	if !strings.Contains(b.String(), `agentize_tool_call_duration_seconds_count{tool="other"} 6`+"\n") {
+		t.Error("Expected the tools beyond the label cap to be counted as other")
+	}
+}
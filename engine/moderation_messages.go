@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ghiac/agentize/log"
+)
+
+// ModerationMessageType identifies a message shown to moderated users
+type ModerationMessageType string
+
+const (
+	// ModerationMessagePermanentBan is set by ban_user without a duration
+	ModerationMessagePermanentBan ModerationMessageType = "permanent_ban"
+	// ModerationMessageTemporaryBan is set by ban_user with a duration ({{.Hours}})
+	ModerationMessageTemporaryBan ModerationMessageType = "temporary_ban"
+	// ModerationMessageThrottle is the automatic ban after repeated irrelevant messages ({{.Hours}})
+	ModerationMessageThrottle ModerationMessageType = "throttle"
+	// ModerationMessageWarning answers an irrelevant message below the ban threshold
+	ModerationMessageWarning ModerationMessageType = "warning"
+	// ModerationMessageBanned answers a banned user whose ban has no message of its own
+	ModerationMessageBanned ModerationMessageType = "banned"
+)
+
+// ModerationMessageData is what moderation message templates are rendered with
+type ModerationMessageData struct {
+	Hours float64 // ban duration in hours (0 for permanent bans and warnings)
+}
+
+// ModerationConfig holds the nonsense detection thresholds and the messages shown to moderated
+// users, so deployments can tune and localize them. Zero values use the defaults.
+type ModerationConfig struct {
+	// Messages are text/template strings rendered with ModerationMessageData, keyed by type.
+	// Missing types use DefaultModerationMessages.
+	Messages map[ModerationMessageType]string
+	// LocalizedMessages are the messages for users with a language (model.User.Language), keyed
+	// by ISO 639-1 code then type. For those users they take precedence over Messages, which
+	// take precedence over the built-in translations (fr, es, de, fa).
+	LocalizedMessages map[string]map[ModerationMessageType]string
+
+	// WarningStrikes is the strike count from which irrelevant messages are answered with the
+	// warning; earlier strikes are only counted and the message is processed (default: 1)
+	WarningStrikes int
+	// BanStrikes is the strike count from which the user is temporarily banned (default: 3)
+	BanStrikes int
+	// BanDuration is the first temporary ban; it grows to 6x two strikes later and to 24x
+	// four strikes later (default: 1 hour)
+	BanDuration time.Duration
+
+	// DisableLLMCheck skips the LLM confirmation of repeated strikes: the fast check decides alone
+	DisableLLMCheck bool
+	// MinMessageLength skips the nonsense check for messages shorter than this many characters
+	// (after trimming spaces), e.g. to let "ok" through (default: 0, every message is checked)
+	MinMessageLength int
+	// AllowedUserIDs are never moderated: no nonsense checks and bans are not enforced (e.g. testers)
+	AllowedUserIDs []string
+	// FastCheck replaces the built-in heuristic (IsNonsenseMessageFast), e.g. with locale-specific rules
+	FastCheck func(message string) bool
+}
+
+const (
+	defaultWarningStrikes = 1
+	defaultBanStrikes     = 3
+	defaultBanDuration    = time.Hour
+)
+
+// banDuration returns the ban for nonsenseCount strikes, or 0 below the ban threshold.
+// With the defaults: 3 strikes = 1 hour, 5 strikes = 6 hours, 7+ strikes = 24 hours.
+func (c ModerationConfig) banDuration(nonsenseCount int) time.Duration {
+	banStrikes := c.BanStrikes
+	if banStrikes <= 0 {
+		banStrikes = defaultBanStrikes
+	}
+	duration := c.BanDuration
+	if duration <= 0 {
+		duration = defaultBanDuration
+	}
+	switch {
+	case nonsenseCount >= banStrikes+4:
+		return 24 * duration
+	case nonsenseCount >= banStrikes+2:
+		return 6 * duration
+	case nonsenseCount >= banStrikes:
+		return duration
+	default:
+		return 0
+	}
+}
+
+// warns reports whether a strike below the ban threshold is answered with the warning
+func (c ModerationConfig) warns(nonsenseCount int) bool {
+	warningStrikes := c.WarningStrikes
+	if warningStrikes <= 0 {
+		warningStrikes = defaultWarningStrikes
+	}
+	return nonsenseCount >= warningStrikes
+}
+
+// DefaultModerationMessages returns the built-in (English) moderation messages
+func DefaultModerationMessages() map[ModerationMessageType]string {
+	const hours = `{{if eq .Hours 1.0}}1 hour{{else}}{{printf "%.0f" .Hours}} hours{{end}}`
+	return map[ModerationMessageType]string{
+		ModerationMessagePermanentBan: "You have been permanently restricted.",
+		ModerationMessageTemporaryBan: "You have been restricted for " + hours + ".",
+		ModerationMessageThrottle:     "You have been restricted for " + hours + " due to repeated irrelevant messages.",
+		ModerationMessageWarning:      "Please send meaningful messages.",
+		ModerationMessageBanned:       "You have been temporarily restricted due to irrelevant messages. Please try again later.",
+	}
+}
+
+// moderationTranslations are the built-in translations of DefaultModerationMessages, keyed by
+// ISO 639-1 code
+func moderationTranslations() map[string]map[ModerationMessageType]string {
+	hours := func(one, many string) string {
+		return `{{if eq .Hours 1.0}}1 ` + one + `{{else}}{{printf "%.0f" .Hours}} ` + many + `{{end}}`
+	}
+	return map[string]map[ModerationMessageType]string{
+		"fr": {
+			ModerationMessagePermanentBan: "Votre accès a été restreint définitivement.",
+			ModerationMessageTemporaryBan: "Votre accès a été restreint pendant " + hours("heure", "heures") + ".",
+			ModerationMessageThrottle:     "Votre accès a été restreint pendant " + hours("heure", "heures") + " en raison de messages hors sujet répétés.",
+			ModerationMessageWarning:      "Merci d'envoyer des messages pertinents.",
+			ModerationMessageBanned:       "Votre accès est temporairement restreint en raison de messages hors sujet. Veuillez réessayer plus tard.",
+		},
+		"es": {
+			ModerationMessagePermanentBan: "Tu acceso ha sido restringido de forma permanente.",
+			ModerationMessageTemporaryBan: "Tu acceso ha sido restringido durante " + hours("hora", "horas") + ".",
+			ModerationMessageThrottle:     "Tu acceso ha sido restringido durante " + hours("hora", "horas") + " debido a mensajes irrelevantes repetidos.",
+			ModerationMessageWarning:      "Por favor, envía mensajes con sentido.",
+			ModerationMessageBanned:       "Tu acceso está restringido temporalmente debido a mensajes irrelevantes. Inténtalo de nuevo más tarde.",
+		},
+		"de": {
+			ModerationMessagePermanentBan: "Ihr Zugang wurde dauerhaft gesperrt.",
+			ModerationMessageTemporaryBan: "Ihr Zugang wurde für " + hours("Stunde", "Stunden") + " gesperrt.",
+			ModerationMessageThrottle:     "Ihr Zugang wurde wegen wiederholter irrelevanter Nachrichten für " + hours("Stunde", "Stunden") + " gesperrt.",
+			ModerationMessageWarning:      "Bitte senden Sie sinnvolle Nachrichten.",
+			ModerationMessageBanned:       "Ihr Zugang ist wegen irrelevanter Nachrichten vorübergehend gesperrt. Bitte versuchen Sie es später erneut.",
+		},
+		"fa": {
+			ModerationMessagePermanentBan: "دسترسی شما برای همیشه محدود شد.",
+			ModerationMessageTemporaryBan: "دسترسی شما به مدت " + hours("ساعت", "ساعت") + " محدود شد.",
+			ModerationMessageThrottle:     "دسترسی شما به دلیل پیام‌های نامرتبط مکرر به مدت " + hours("ساعت", "ساعت") + " محدود شد.",
+			ModerationMessageWarning:      "لطفاً پیام‌های معنادار ارسال کنید.",
+			ModerationMessageBanned:       "دسترسی شما به دلیل پیام‌های نامرتبط موقتاً محدود شده است. لطفاً بعداً دوباره تلاش کنید.",
+		},
+	}
+}
+
+// render returns the message of type messageType for a ban of hours, in language when it is
+// configured or translated (see LocalizedMessages). A configured template that fails to parse
+// or execute is logged and replaced by the next candidate.
+func (c ModerationConfig) render(messageType ModerationMessageType, hours float64, language string) string {
+	data := ModerationMessageData{Hours: hours}
+	candidates := []map[ModerationMessageType]string{c.LocalizedMessages[language], c.Messages, moderationTranslations()[language]}
+	for _, messages := range candidates {
+		text, ok := messages[messageType]
+		if !ok {
+			continue
+		}
+		if message, err := renderModerationMessage(text, data); err == nil {
+			return message
+		} else {
+			log.Log.Warn("[UserModeration] ⚠️  Invalid moderation message template, using the default", "type", messageType, "language", language, "error", err)
+		}
+	}
+	message, _ := renderModerationMessage(DefaultModerationMessages()[messageType], data)
+	return message
+}
+
+func renderModerationMessage(text string, data ModerationMessageData) (string, error) {
+	tmpl, err := template.New("moderation").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+)
+
+func TestModerationConfigRender(t *testing.T) {
+	// Defaults
+	var defaults ModerationConfig
+	if got := defaults.render(ModerationMessageTemporaryBan, 6, ""); got != "You have been restricted for 6 hours." {
+		t.Errorf("Unexpected default temporary ban message: %q", got)
+	}
+	if got := defaults.render(ModerationMessageThrottle, 1, ""); got != "You have been restricted for 1 hour due to repeated irrelevant messages." {
+		t.Errorf("Unexpected default throttle message: %q", got)
+	}
+
+	// Operator-provided English templates
+	config := ModerationConfig{Messages: map[ModerationMessageType]string{
+		ModerationMessageTemporaryBan: `Access paused for {{printf "%.0f" .Hours}}h. Contact support if this is a mistake.`,
+		ModerationMessagePermanentBan: "Your account has been closed.",
+	}}
+	if got := config.render(ModerationMessageTemporaryBan, 12, ""); got != "Access paused for 12h. Contact support if this is a mistake." {
+		t.Errorf("Unexpected temporary ban message: %q", got)
+	}
+	if got := config.render(ModerationMessagePermanentBan, 0, ""); got != "Your account has been closed." {
+		t.Errorf("Unexpected permanent ban message: %q", got)
+	}
+	// Types without a configured message fall back to the default
+	if got := config.render(ModerationMessageWarning, 0, ""); got != "Please send meaningful messages." {
+		t.Errorf("Unexpected warning message: %q", got)
+	}
+
+	// Invalid templates fall back to the default
+	broken := ModerationConfig{Messages: map[ModerationMessageType]string{
+		ModerationMessageTemporaryBan: "Restricted for {{.Hours",
+	}}
+	if got := broken.render(ModerationMessageTemporaryBan, 24, ""); got != "You have been restricted for 24 hours." {
+		t.Errorf("Expected fallback to default message, got %q", got)
+	}
+
+	// Users with a language get the configured translation, then Messages, then the built-in one
+	config.LocalizedMessages = map[string]map[ModerationMessageType]string{"fr": {ModerationMessageWarning: "Restez dans le sujet, svp."}}
+	if got := config.render(ModerationMessageWarning, 0, "fr"); got != "Restez dans le sujet, svp." {
+		t.Errorf("Unexpected localized warning: %q", got)
+	}
+	if got := config.render(ModerationMessageThrottle, 1, "fr"); got != "Votre accès a été restreint pendant 1 heure en raison de messages hors sujet répétés." {
+		t.Errorf("Unexpected translated throttle message: %q", got)
+	}
+	if got := config.render(ModerationMessagePermanentBan, 0, "fr"); got != "Your account has been closed." {
+		t.Errorf("Expected Messages to override the built-in translation, got %q", got)
+	}
+	if got := config.render(ModerationMessagePermanentBan, 0, "sv"); got != "Your account has been closed." {
+		t.Errorf("Expected untranslated languages to use Messages, got %q", got)
+	}
+}
+
+func TestUserModerationThrottleMessage(t *testing.T) {
+	um := NewUserModeration(nil, nil, nil, nil)
+	um.SetConfig(ModerationConfig{Messages: map[ModerationMessageType]string{
+		ModerationMessageThrottle: `Slow down: try again in {{printf "%.0f" .Hours}} hours.`,
+	}})
+
+	duration, message := um.calculateBanDuration(5, "")
+	if duration.Hours() != 6 {
+		t.Errorf("Expected a 6 hour ban, got %v", duration)
+	}
+	if message != "Slow down: try again in 6 hours." {
+		t.Errorf("Unexpected throttle message: %q", message)
+	}
+}
+
+func TestModerationConfigThresholds(t *testing.T) {
+	var defaults ModerationConfig
+	for count, want := range map[int]time.Duration{1: 0, 2: 0, 3: time.Hour, 5: 6 * time.Hour, 7: 24 * time.Hour, 10: 24 * time.Hour} {
+		if got := defaults.banDuration(count); got != want {
+			t.Errorf("Default ban after %d strikes = %v, want %v", count, got, want)
+		}
+	}
+
+	config := ModerationConfig{WarningStrikes: 2, BanStrikes: 4, BanDuration: 30 * time.Minute}
+	for count, want := range map[int]time.Duration{3: 0, 4: 30 * time.Minute, 6: 3 * time.Hour, 8: 12 * time.Hour} {
+		if got := config.banDuration(count); got != want {
+			t.Errorf("Ban after %d strikes = %v, want %v", count, got, want)
+		}
+	}
+	if config.warns(1) || !config.warns(2) {
+		t.Error("Expected warnings to start at the second strike")
+	}
+}
+
+func TestUserModerationConfig(t *testing.T) {
+	users := map[string]*model.User{}
+	getUser := func(userID string) (*model.User, error) {
+		if users[userID] == nil {
+			users[userID] = model.NewUser(userID)
+		}
+		return users[userID], nil
+	}
+	saveUser := func(user *model.User) error { return nil }
+	llmCalls := 0
+	isNonsenseLLM := func(context.Context, string) (bool, error) {
+		llmCalls++
+		return true, nil
+	}
+	um := NewUserModeration(IsNonsenseMessageFast, isNonsenseLLM, getUser, saveUser)
+	um.SetConfig(ModerationConfig{
+		WarningStrikes:   2,
+		BanStrikes:       3,
+		DisableLLMCheck:  true,
+		MinMessageLength: 3,
+		AllowedUserIDs:   []string{"tester"},
+		FastCheck:        func(message string) bool { return message == "blah blah" },
+	})
+	ctx := context.Background()
+
+	// Short messages are not evaluated, the custom check replaces the heuristic
+	for _, msg := range []string{"ok", "thanks"} {
+		if shouldBan, banMessage, _ := um.ProcessNonsenseCheck(ctx, "user1", msg); shouldBan || banMessage != "" {
+			t.Errorf("Expected %q to pass moderation", msg)
+		}
+	}
+	if users["user1"].NonsenseCount != 0 {
+		t.Errorf("Expected no strikes, got %d", users["user1"].NonsenseCount)
+	}
+
+	// The first strike is silent, the second warns, the third bans; the LLM is never asked
+	if _, banMessage, _ := um.ProcessNonsenseCheck(ctx, "user1", "blah blah"); banMessage != "" {
+		t.Errorf("Expected a silent first strike, got %q", banMessage)
+	}
+	if _, banMessage, _ := um.ProcessNonsenseCheck(ctx, "user1", "blah blah"); banMessage != "Please send meaningful messages." {
+		t.Errorf("Expected a warning on the second strike, got %q", banMessage)
+	}
+	if shouldBan, _, _ := um.ProcessNonsenseCheck(ctx, "user1", "blah blah"); !shouldBan {
+		t.Error("Expected a ban on the third strike")
+	}
+	if llmCalls != 0 {
+		t.Errorf("Expected the LLM check to be disabled, got %d calls", llmCalls)
+	}
+
+	// Allowlisted users are never moderated, even when banned
+	tester, _ := getUser("tester")
+	tester.Ban(time.Hour, "banned")
+	if banned, _ := um.CheckBanStatus("tester"); banned {
+		t.Error("Expected allowlisted user to bypass the ban")
+	}
+	if shouldBan, banMessage, _ := um.ProcessNonsenseCheck(ctx, "tester", "blah blah"); shouldBan || banMessage != "" || tester.NonsenseCount != 0 {
+		t.Error("Expected allowlisted user to skip the nonsense check")
+	}
+}
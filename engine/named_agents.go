@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// namedAgentNamePattern restricts agent names to what fits in a session ID
+var namedAgentNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// RegisterNamedAgent makes agent reachable from the Core as name (e.g. "billing" or "support")
+// through the call_agent tool, next to the high and low UserAgents. Each user gets separate
+// sessions per named agent. The agent must be initialized (Init) on the same session store as
+// the Core; it receives the Core's config, callback and LLM recording or replay like the
+// UserAgents. Registering a name again replaces its agent.
+func (ch *CoreHandler) RegisterNamedAgent(name string, agent *Engine) error {
+	if !namedAgentNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid agent name %q: use lowercase letters, digits and underscores", name)
+	}
+	switch model.AgentType(name) {
+	case model.AgentTypeCore, model.AgentTypeHigh, model.AgentTypeLow, model.AgentTypeUser:
+		return fmt.Errorf("agent name %q is reserved", name)
+	}
+	if agent == nil {
+		return fmt.Errorf("agent %q is nil", name)
+	}
+
+	ch.configureAgent(agent)
+	if ch.Callback != nil && agent.Callback == nil {
+		agent.Callback = ch.Callback
+	}
+	if ch.llmRecords != nil {
+		agent.UseRecording(ch.llmRecords)
+	}
+	if ch.replay != nil {
+		agent.UseReplay(ch.replay.Store)
+	}
+
+	ch.namedAgentsMu.Lock()
+	if ch.namedAgents == nil {
+		ch.namedAgents = make(map[string]*Engine)
+	}
+	ch.namedAgents[name] = agent
+	ch.namedAgentsMu.Unlock()
+
+	ch.logger().Info("[CoreHandler] 🧩 Named agent registered", "name", name)
+	return nil
+}
+
+// NamedAgents returns the names of the registered named agents, sorted
+func (ch *CoreHandler) NamedAgents() []string {
+	ch.namedAgentsMu.RLock()
+	defer ch.namedAgentsMu.RUnlock()
+	names := make([]string, 0, len(ch.namedAgents))
+	for name := range ch.namedAgents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namedAgent returns the named agent registered as name
+func (ch *CoreHandler) namedAgent(name string) (*Engine, bool) {
+	ch.namedAgentsMu.RLock()
+	defer ch.namedAgentsMu.RUnlock()
+	agent, ok := ch.namedAgents[name]
+	return agent, ok
+}
+
+// allAgents returns the high and low UserAgents and the named agents, each once
+func (ch *CoreHandler) allAgents() []*Engine {
+	var agents []*Engine
+	seen := make(map[*Engine]bool)
+	add := func(agent *Engine) {
+		if agent != nil && !seen[agent] {
+			seen[agent] = true
+			agents = append(agents, agent)
+		}
+	}
+	add(ch.userAgentHigh)
+	add(ch.userAgentLow)
+	for _, name := range ch.NamedAgents() {
+		agent, _ := ch.namedAgent(name)
+		add(agent)
+	}
+	return agents
+}
+
+// namedAgentToolDefinition returns the call_agent tool listing the registered named agents
+// (false when there are none)
+func (ch *CoreHandler) namedAgentToolDefinition() (openai.Tool, bool) {
+	names := ch.NamedAgents()
+	if len(names) == 0 {
+		return openai.Tool{}, false
+	}
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name: "call_agent",
+			Description: "Send a message to a named specialist agent when the request belongs to its domain. " +
+				"Available agents: " + strings.Join(names, ", ") + ". Session is managed automatically per agent.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"agent_name": map[string]interface{}{
+						"type":        "string",
+						"enum":        names,
+						"description": "The name of the agent to send the message to",
+					},
+					"message": map[string]interface{}{
+						"type":        "string",
+						"description": "The message to send to the agent",
+					},
+				},
+				"required": []string{"agent_name", "message"},
+			},
+		},
+	}, true
+}
+
+// callNamedAgentTool sends the message of a call_agent tool call to the named agent, in the
+// user's active session for that agent
+func (ch *CoreHandler) callNamedAgentTool(ctx context.Context, userID, sessionID string, args map[string]interface{}) (string, error) {
+	name, _ := args["agent_name"].(string)
+	if name == "" {
+		return "", fmt.Errorf("agent_name is required")
+	}
+	agent, ok := ch.namedAgent(name)
+	if !ok {
+		return "", fmt.Errorf("unknown agent %q (available: %s)", name, strings.Join(ch.NamedAgents(), ", "))
+	}
+	if !agent.IsDBReady() {
+		return "", fmt.Errorf("agent %q is not ready. Call Init() on it first", name)
+	}
+
+	notifyStatus(ctx, userID, "", StatusAgentCalling, name)
+	if ch.Callback != nil {
+		if cbErr := ch.Callback.BeforeAction(ctx, &UsageEvent{
+			UserID: userID, EventType: EventAgentRouting, Name: name,
+		}); cbErr != nil {
+			return FormatBlockedActionResult(cbErr), nil
+		}
+	}
+	result, err := ch.callUserAgent(ctx, userID, args, agent, model.NamedAgentType(name))
+	if ch.Callback != nil {
+		ch.Callback.AfterAction(ctx, &UsageEvent{
+			UserID: userID, SessionID: sessionID, EventType: EventAgentRouting, Name: name, Error: err,
+		})
+	}
+	notifyStatus(ctx, userID, "", StatusAgentDone, name)
+	return result, err
+}
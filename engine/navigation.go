@@ -0,0 +1,337 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrNoPreviousNode is returned by GoBack when the session has not advanced past its first node
+var ErrNoPreviousNode = errors.New("no previous node")
+
+// Breadcrumb is one node on the way from the root to the current node
+type Breadcrumb struct {
+	Path  string `json:"path"`
+	Title string `json:"title"`
+}
+
+// NavigationContext describes where a session is in the knowledge tree
+type NavigationContext struct {
+	Current     string             `json:"current"`      // node the session is at
+	Breadcrumbs []Breadcrumb       `json:"breadcrumbs"`  // ancestors of Current from the root, Current last
+	PathStack   []string           `json:"path_stack"`   // nodes GoBack returns through, Current last
+	OpenedNodes []model.NodeDigest `json:"opened_nodes"` // nodes opened in the session
+	Tools       []model.Tool       `json:"tools"`        // tools of the nodes from the root to Current (see PathTools)
+}
+
+// String renders the breadcrumb trail, e.g. "Root > Onboarding > Payment details"
+func (c *NavigationContext) String() string {
+	titles := make([]string, len(c.Breadcrumbs))
+	for i, crumb := range c.Breadcrumbs {
+		titles[i] = crumb.Title
+	}
+	return strings.Join(titles, " > ")
+}
+
+// GoBack returns the session to the node it advanced from: the last node of its PathStack is
+// popped and closed, and the previous one is (re)opened.
+// Tools are accumulated from the session's opened nodes, so closing the popped node also drops
+// its tools; tools it shadowed (override) or duplicated (append) resolve as they did before the Advance.
+func (e *Engine) GoBack(sessionID string) (*model.Session, error) {
+	session, err := e.Sessions.Get(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	if len(session.PathStack) < 2 {
+		return nil, ErrNoPreviousNode
+	}
+
+	top := len(session.PathStack) - 1
+	popped, previous := session.PathStack[top], session.PathStack[top-1]
+	session.PathStack = session.PathStack[:top]
+	if err := e.Sessions.Put(session); err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	// Keep the node open if the stack still passes through it (e.g. after routing back to it)
+	stillOnStack := false
+	for _, p := range session.PathStack {
+		if p == popped {
+			stillOnStack = true
+			break
+		}
+	}
+	if !stillOnStack && popped != "root" && isOpened(session, popped) {
+		if err := e.CloseFile(sessionID, popped); err != nil {
+			return nil, fmt.Errorf("failed to close %s: %w", popped, err)
+		}
+	}
+	if _, err := e.OpenFile(sessionID, previous); err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", previous, err)
+	}
+
+	// CloseFile/OpenFile persisted the session; return the latest copy
+	session, err = e.Sessions.Get(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	e.logger().Info("[Engine] ↩️  Went back", "session_id", sessionID, "from", popped, "to", previous)
+	return session, nil
+}
+
+// ResetOptions chooses what ResetSession clears besides the session's position in the tree
+type ResetOptions struct {
+	// ClearHistory moves the conversation out of Msgs into ArchivedMsgs, so the model starts
+	// over without it (the session summary is kept). By default the conversation is kept.
+	ClearHistory bool
+	// ClearVisitedNodes forgets the nodes the user has visited, across all of their sessions
+	ClearVisitedNodes bool
+}
+
+// ResetSession restarts the session's journey at the root of the knowledge tree: every node but
+// the root is closed, the PathStack and session variables are cleared and the reset is recorded
+// in RouteHistory. Tools are accumulated from the opened nodes, so only the root's tools remain.
+func (e *Engine) ResetSession(sessionID string, opts ResetOptions) error {
+	session, err := e.Sessions.Get(sessionID)
+	if err != nil {
+		return fmt.Errorf("session not found: %w", err)
+	}
+	rootNode, err := e.Repo.LoadNode("root")
+	if err != nil {
+		return fmt.Errorf("failed to load root node: %w", err)
+	}
+	if _, err := e.PathTools("root"); err != nil {
+		return err
+	}
+
+	var closed []string
+	for _, digest := range session.NodeDigests {
+		if digest.Path != "root" {
+			closed = append(closed, digest.Path)
+		}
+	}
+	from := currentPath(session)
+	session.NodeDigests = []model.NodeDigest{summarizeNode(rootNode)}
+	session.PathStack = nil
+	session.Vars = nil
+	session.RouteHistory = append(session.RouteHistory, model.RouteDecision{
+		From:   from,
+		To:     "root",
+		Reason: "reset",
+		At:     time.Now(),
+	})
+	archived := 0
+	if opts.ClearHistory {
+		archived = len(session.Msgs)
+		session.ArchivedMsgs = append(session.ArchivedMsgs, session.Msgs...)
+		session.Msgs = []openai.ChatCompletionMessage{}
+	}
+	session.UpdatedAt = time.Now()
+	if err := e.Sessions.Put(session); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	// Record closed files in database
+	if fileStore, ok := e.Sessions.(interface {
+		CloseOpenedFile(string, string) error
+	}); ok {
+		for _, p := range closed {
+			if err := fileStore.CloseOpenedFile(sessionID, p); err != nil {
+				e.logger().Warn("[Engine] ⚠️  Failed to record closed file", "session_id", sessionID, "path", p, "error", err)
+			}
+		}
+	}
+	if opts.ClearVisitedNodes {
+		if nodeStore, ok := e.Sessions.(interface{ ClearVisitedNodes(string) }); ok {
+			nodeStore.ClearVisitedNodes(session.UserID)
+		}
+	}
+
+	e.logger().Info("[Engine] 🔄 Session reset",
+		"session_id", sessionID, "from", from, "closed", len(closed), "archived_msgs", archived, "cleared_visited", opts.ClearVisitedNodes)
+	return nil
+}
+
+// GetContext returns the session's position in the tree: the current node, its breadcrumb
+// trail, the navigation stack and the opened nodes
+func (e *Engine) GetContext(sessionID string) (*NavigationContext, error) {
+	session, err := e.Sessions.Get(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %w", err)
+	}
+	current := currentPath(session)
+	tools, err := e.PathTools(current)
+	if err != nil {
+		return nil, err
+	}
+	return &NavigationContext{
+		Current:     current,
+		Breadcrumbs: e.breadcrumbs(current),
+		PathStack:   append([]string(nil), session.PathStack...),
+		OpenedNodes: append([]model.NodeDigest(nil), session.NodeDigests...),
+		Tools:       tools,
+	}, nil
+}
+
+// JumpTo moves the session straight to nodePath, for callers (such as the Core orchestrator)
+// that know where the conversation belongs. The user needs can_see and can_access_next on the
+// node. The jump is recorded in RouteHistory and pushed on the PathStack, so GoBack returns
+// to where the session was. The node's on_enter action, if any, runs once the session is there.
+func (e *Engine) JumpTo(sessionID string, nodePath string) (*model.Session, error) {
+	session, _, err := e.jumpTo(context.Background(), sessionID, nodePath)
+	return session, err
+}
+
+// jumpTo implements JumpTo, returning the note of the node's on_enter action too (see enterNode)
+func (e *Engine) jumpTo(ctx context.Context, sessionID string, nodePath string) (*model.Session, string, error) {
+	session, err := e.Sessions.Get(sessionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("session not found: %w", err)
+	}
+	if _, err := e.Repo.LoadNode(nodePath); err != nil {
+		return nil, "", fmt.Errorf("node not found: %s: %w", nodePath, err)
+	}
+	for _, flag := range []rune{model.PermSee, model.PermExecute} {
+		if !e.canUser(nodePath, session.UserID, flag) {
+			return nil, "", fmt.Errorf("%w: cannot jump to %s", ErrAccessDenied, nodePath)
+		}
+	}
+	// Tools are accumulated along the new path; fail before moving if they conflict
+	tools, err := e.PathTools(nodePath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := e.OpenFile(sessionID, nodePath); err != nil {
+		return nil, "", fmt.Errorf("failed to open %s: %w", nodePath, err)
+	}
+
+	// OpenFile persisted the session; reload it before recording the jump
+	session, err = e.Sessions.Get(sessionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("session not found: %w", err)
+	}
+	from := currentPath(session)
+	if len(session.PathStack) == 0 {
+		session.PathStack = []string{from}
+	}
+	session.PathStack = append(session.PathStack, nodePath)
+	session.RouteHistory = append(session.RouteHistory, model.RouteDecision{
+		From:   from,
+		To:     nodePath,
+		Reason: "jump",
+		At:     time.Now(),
+	})
+	note := e.enterNode(ctx, session, nodePath)
+	if err := e.Sessions.Put(session); err != nil {
+		return nil, "", fmt.Errorf("failed to update session: %w", err)
+	}
+
+	e.logger().Info("[Engine] 🦘 Jumped", "session_id", sessionID, "from", from, "to", nodePath, "tools", len(tools))
+	return session, note, nil
+}
+
+// PathTools accumulates the tools of the nodes from the root down to nodePath with the
+// configured ToolMergeStrategy (deeper nodes override by default) and each node's
+// tools_policy. Tools are ordered by the level that first added them, so the result is stable.
+func (e *Engine) PathTools(nodePath string) ([]model.Tool, error) {
+	registry := model.NewToolRegistry(e.llmConfig.ToolMergeStrategy)
+	for _, crumb := range e.breadcrumbs(nodePath) {
+		node, err := e.Repo.LoadNode(crumb.Path)
+		if err != nil {
+			continue
+		}
+		if err := registry.AddNodeTools(node.Tools, node.ToolsPolicy); err != nil {
+			return nil, fmt.Errorf("tools of %s: %w", crumb.Path, err)
+		}
+	}
+	return registry.GetTools(), nil
+}
+
+// RegisterNavigationTools registers the goto_node tool, which lets the model call JumpTo.
+// Fails unless the repository allows jumping (fsrepo.NodeRepository.SetAllowJump).
+func (e *Engine) RegisterNavigationTools() error {
+	if !e.Repo.AllowsJump() {
+		return fmt.Errorf("jumping to arbitrary nodes is not enabled for this knowledge tree")
+	}
+	def := openai.FunctionDefinition{
+		Name:        "goto_node",
+		Description: "Moves the conversation directly to a node of the knowledge tree, when it clearly belongs there, instead of following the routing step by step.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The path of the node in the knowledge tree (e.g., 'root/onboarding/payment')",
+				},
+			},
+			"required": []string{"path"},
+		},
+	}
+	return e.RegisterFunction("goto_node", def, func(ctx context.Context, args map[string]any) (string, error) {
+		nodePath, err := getStringArg(args, "path")
+		if err != nil {
+			return "", err
+		}
+		sessionID, _ := args["__session_id__"].(string)
+		if sessionID == "" {
+			return "", fmt.Errorf("session ID not available")
+		}
+		_, note, err := e.jumpTo(ctx, sessionID, nodePath)
+		if err != nil {
+			return fmt.Sprintf("Error moving to node: %v", err), nil
+		}
+		result := fmt.Sprintf("Moved to %s. The node is now open in your context.", nodePath)
+		if note != "" {
+			result += "\n\n" + note
+		}
+		return result, nil
+	})
+}
+
+// buildPositionPrompt tells the model where the session is, once it has advanced
+func (e *Engine) buildPositionPrompt(session *model.Session) string {
+	if len(session.PathStack) == 0 {
+		return ""
+	}
+	nav := &NavigationContext{Breadcrumbs: e.breadcrumbs(currentPath(session))}
+	return "# Current Position\n\nYou are at " + nav.String() + "\n"
+}
+
+// breadcrumbs returns the ancestors of nodePath from the root, nodePath last
+func (e *Engine) breadcrumbs(nodePath string) []Breadcrumb {
+	parts := strings.Split(nodePath, "/")
+	crumbs := make([]Breadcrumb, 0, len(parts))
+	for i := range parts {
+		p := strings.Join(parts[:i+1], "/")
+		crumb := Breadcrumb{Path: p, Title: path.Base(p)}
+		if node, err := e.Repo.LoadNode(p); err == nil && node.Title != "" {
+			crumb.Title = node.Title
+		}
+		crumbs = append(crumbs, crumb)
+	}
+	return crumbs
+}
+
+// currentPath is the top of the session's PathStack, or root before the first Advance
+func currentPath(session *model.Session) string {
+	if n := len(session.PathStack); n > 0 {
+		return session.PathStack[n-1]
+	}
+	return "root"
+}
+
+func isOpened(session *model.Session, nodePath string) bool {
+	for _, digest := range session.NodeDigests {
+		if digest.Path == nodePath {
+			return true
+		}
+	}
+	return false
+}
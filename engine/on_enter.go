@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// enterNode runs the on_enter action of nodePath (see model.OnEnterAction) for a session that
+// has just moved there, and returns the note describing its result ("" if the node has none).
+// The note is appended to session.Msgs as a system message, unless the move was made by a tool
+// call: the note is then the caller's to report in the tool result, as the conversation is in
+// flight. The caller persists the session.
+//
+// Actions don't chain: a move made while an on_enter action runs (e.g. its tool advances the
+// session) doesn't run the action of the node it moves to, and goto_node can't be an action.
+func (e *Engine) enterNode(ctx context.Context, session *model.Session, nodePath string) string {
+	node, err := e.Repo.LoadNode(nodePath)
+	if err != nil || node.OnEnter == nil || node.OnEnter.Tool == "" {
+		return ""
+	}
+	action := node.OnEnter
+	if action.Tool == "goto_node" {
+		e.logger().Warn("[Engine] ⚠️  goto_node can't be an on_enter action", "path", nodePath)
+		return ""
+	}
+	if _, running := e.enteringSessions.LoadOrStore(session.SessionID, nodePath); running {
+		e.logger().Warn("[Engine] ⚠️  Skipped nested on_enter action", "session_id", session.SessionID, "path", nodePath, "tool", action.Tool)
+		return ""
+	}
+	defer e.enteringSessions.Delete(session.SessionID)
+
+	args, err := renderOnEnterArgs(action.Args, e.templateContext(session))
+	if err != nil {
+		e.logger().Warn("[Engine] ⚠️  Failed to render on_enter arguments", "path", nodePath, "tool", action.Tool, "error", err)
+		return ""
+	}
+	result := e.runOnEnterTool(ctx, session, action.Tool, args)
+	note := fmt.Sprintf("Entered %s; its on_enter tool %s returned:\n%s", nodePath, action.Tool, result)
+
+	if _, inToolCall := model.ToolCallInfoFromContext(ctx); !inToolCall {
+		session.Msgs = append(session.Msgs, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: note,
+		})
+	}
+	e.logger().Info("[Engine] 🚪 Ran on_enter action", "session_id", session.SessionID, "path", nodePath, "tool", action.Tool, "len", len(result))
+	return note
+}
+
+// runOnEnterTool calls tool for session with the callbacks of a model tool call, and returns its
+// (processed) result or the error to report in its place. The call is not saved as a ToolCall:
+// it belongs to no model message.
+func (e *Engine) runOnEnterTool(ctx context.Context, session *model.Session, tool string, args map[string]interface{}) string {
+	args["__user_id__"] = session.UserID
+	args["__session_id__"] = session.SessionID
+
+	if e.Callback != nil {
+		if cbErr := e.Callback.BeforeAction(ctx, &UsageEvent{
+			UserID:    session.UserID,
+			SessionID: session.SessionID,
+			EventType: EventToolCall,
+			Name:      tool,
+		}); cbErr != nil {
+			return FormatBlockedActionResult(cbErr)
+		}
+	}
+
+	start := time.Now()
+	ctx = model.WithToolCallInfo(ctx, model.ToolCallInfo{
+		ToolName:  tool,
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+	})
+	result, err := e.runTool(ctx, tool, args)
+	if e.Callback != nil {
+		e.Callback.AfterAction(ctx, &UsageEvent{
+			UserID:    session.UserID,
+			SessionID: session.SessionID,
+			EventType: EventToolCall,
+			Name:      tool,
+			Duration:  time.Since(start),
+			Error:     err,
+		})
+	}
+	if err != nil {
+		e.logger().Warn("[Engine] on_enter tool error", "name", tool, "error", err)
+		return fmt.Sprintf("Error executing tool %s: %v", tool, err)
+	}
+	return e.processToolResult(session.SessionID, result)
+}
+
+// renderOnEnterArgs returns a copy of args with every string (in nested maps and lists too)
+// rendered as a template against data
+func renderOnEnterArgs(args map[string]interface{}, data TemplateContext) (map[string]interface{}, error) {
+	rendered := make(map[string]interface{}, len(args)+2)
+	for key, value := range args {
+		v, err := renderOnEnterValue(key, value, data)
+		if err != nil {
+			return nil, err
+		}
+		rendered[key] = v
+	}
+	return rendered, nil
+}
+
+func renderOnEnterValue(name string, value interface{}, data TemplateContext) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		tmpl, err := template.New(name).Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %w", name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("argument %s: %w", name, err)
+		}
+		return buf.String(), nil
+	case map[string]interface{}:
+		return renderOnEnterArgs(v, data)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderOnEnterValue(fmt.Sprintf("%s[%d]", name, i), item, data)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = rendered
+		}
+		return items, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+)
+
+// ErrPersistFailed is returned (wrapped) when FailFastOnPersistError is set and saving a
+// message, tool call or session fails during a turn
+var ErrPersistFailed = errors.New("failed to persist")
+
+// persistFailed handles a failed save of what during a turn: it counts the failure on the
+// session and returns an ErrPersistFailed error when failFast is set, nil to continue otherwise
+func persistFailed(failFast bool, session *model.Session, what string, err error) error {
+	if session != nil {
+		session.PersistErrors++
+	}
+	if !failFast {
+		return nil
+	}
+	return fmt.Errorf("%w: %s: %v", ErrPersistFailed, what, err)
+}
+
+// storedContentMarker ends content that was cut to MaxStoredContentBytes before being stored
+const storedContentMarker = "\n... [truncated: %d of %d bytes stored]"
+
+// truncateStoredContent cuts content longer than maxBytes (<= 0: no limit) at a UTF-8
+// character boundary and appends storedContentMarker with the original size
+func truncateStoredContent(content string, maxBytes int) (string, bool) {
+	if maxBytes <= 0 || len(content) <= maxBytes {
+		return content, false
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut] + fmt.Sprintf(storedContentMarker, cut, len(content)), true
+}
+
+// limitStoredContent truncates content to maxBytes before it is stored as what (e.g. the
+// message or tool call ID). The full content is logged at debug level only.
+func limitStoredContent(content string, maxBytes int, logPrefix, what string) string {
+	stored, truncated := truncateStoredContent(content, maxBytes)
+	if truncated {
+		log.Log.Warn("["+logPrefix+"] ✂️  Stored content truncated", "what", what, "bytes", len(content), "limit", maxBytes)
+		log.Log.Debug("["+logPrefix+"] 📄 Full stored content", "what", what, "content", content)
+	}
+	return stored
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+// failingMessageStore is a SQLite store whose message writes fail
+type failingMessageStore struct {
+	*store.SQLiteStore
+}
+
+func (s failingMessageStore) PutMessage(*model.Message) error {
+	return errors.New("disk full")
+}
+
+func TestCoreHandlerPersistErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "OK"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	failing := failingMessageStore{sqliteStore}
+	agent := &Engine{Repo: repo, Sessions: failing}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+
+	newHandler := func(failFast bool) *CoreHandler {
+		config := DefaultCoreHandlerConfig()
+		config.FailFastOnPersistError = failFast
+		ch := NewCoreHandler(model.NewSessionHandler(failing, model.DefaultSessionHandlerConfig()), agent, agent, config)
+		if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+			t.Fatalf("UseLLMConfig failed: %v", err)
+		}
+		return ch
+	}
+
+	// By default the turn continues and the failed saves are counted on the session
+	ch := newHandler(false)
+	if response, err := ch.ProcessMessage(context.Background(), "user1", "Hello"); err != nil || response != "OK" {
+		t.Fatalf("Expected an answer despite failed message saves, got %q (err %v)", response, err)
+	}
+	coreSession, err := ch.getOrCreateCoreSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to get core session: %v", err)
+	}
+	if coreSession.PersistErrors != 2 {
+		t.Errorf("Expected 2 persist errors (user and assistant message), got %d", coreSession.PersistErrors)
+	}
+
+	// With FailFastOnPersistError the turn is aborted before the LLM is asked
+	ch = newHandler(true)
+	response, err := ch.ProcessMessage(context.Background(), "user2", "Hello")
+	if !errors.Is(err, ErrPersistFailed) || response != "" {
+		t.Errorf("Expected ErrPersistFailed, got %q (err %v)", response, err)
+	}
+}
+
+func TestEngineMaxStoredContentBytes(t *testing.T) {
+	// Fake chat completions endpoint: calls dump_logs, then reports the size of its result
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		last := req.Messages[len(req.Messages)-1]
+		choice := openai.ChatCompletionChoice{
+			Message: openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleAssistant,
+				ToolCalls: []openai.ToolCall{{
+					ID:       "call_1",
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: "dump_logs", Arguments: `{}`},
+				}},
+			},
+			FinishReason: openai.FinishReasonToolCalls,
+		}
+		if last.Role == openai.ChatMessageRoleTool {
+			choice.Message = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: fmt.Sprintf("read %d bytes", len(last.Content))}
+			choice.FinishReason = openai.FinishReasonStop
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore, Functions: model.NewFunctionRegistry(), MaxStoredContentBytes: 200}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	// Results this large reach the model as they are instead of through collect_result
+	if err := e.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test", MaxToolResultLength: 2 << 20}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	oversized := strings.Repeat("log line ✓\n", 100000) // ~1.3 MB
+	err = e.RegisterFunction("dump_logs", openai.FunctionDefinition{
+		Description: "Dump the server logs",
+		Parameters:  map[string]any{"type": "object"},
+	}, func(ctx context.Context, args map[string]any) (string, error) {
+		return oversized, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunction failed: %v", err)
+	}
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// The model still gets the whole result; only the stored copies are cut
+	reply, _, err := e.ProcessMessage(context.Background(), session.SessionID, "Please show me the server logs. "+strings.Repeat("x", 500))
+	if err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	if want := fmt.Sprintf("read %d bytes", len(oversized)); reply != want {
+		t.Errorf("Expected %q, got %q", want, reply)
+	}
+
+	toolCalls, err := sqliteStore.GetToolCallsBySession(session.SessionID)
+	if err != nil || len(toolCalls) != 1 {
+		t.Fatalf("Expected 1 stored tool call, got %d (%v)", len(toolCalls), err)
+	}
+	stored := toolCalls[0].Response
+	if len(stored) > 300 || !strings.Contains(stored, fmt.Sprintf("of %d bytes stored]", len(oversized))) {
+		t.Errorf("Expected a truncated response with a marker, got %d bytes: %q", len(stored), stored)
+	}
+	if !utf8.ValidString(stored) {
+		t.Error("Expected the truncated response to stay valid UTF-8")
+	}
+
+	messages, err := sqliteStore.GetMessagesBySession(session.SessionID)
+	if err != nil {
+		t.Fatalf("GetMessagesBySession failed: %v", err)
+	}
+	for _, msg := range messages {
+		if msg.Role == openai.ChatMessageRoleUser && !strings.Contains(msg.Content, "[truncated: ") {
+			t.Errorf("Expected the long user message to be truncated, got %d bytes", len(msg.Content))
+		}
+	}
+}
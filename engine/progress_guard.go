@@ -1,6 +1,11 @@
 package engine
 
-import "sync"
+import (
+	"sync"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+)
 
 // ProgressGuard holds per-key in-progress flag and message queue.
 // It is used to avoid blocking on the process mutex when the handler is already
@@ -14,7 +19,16 @@ type ProgressGuard struct {
 
 type progressState struct {
 	InProgress bool
-	Queue      []string
+	Queue      []queuedMessage
+}
+
+// queuedMessage is a message that arrived while its key was in progress
+type queuedMessage struct {
+	Text        string
+	ContentType model.ContentType
+	QueuedAt    time.Time
+	// Status is the StatusFunc of the request that queued it, to reach its sender later
+	Status StatusFunc
 }
 
 // NewProgressGuard returns a new ProgressGuard.
@@ -26,19 +40,19 @@ func NewProgressGuard() *ProgressGuard {
 // in progress (caller should return without blocking). Returns false if the key
 // is not in progress (caller should proceed with processing).
 func (p *ProgressGuard) TryQueue(key, message string) (queued bool) {
-	p.mu.RLock()
-	s := p.state[key]
-	inProg := s != nil && s.InProgress
-	p.mu.RUnlock()
-	if !inProg {
-		return false
-	}
+	return p.tryQueueMessage(key, queuedMessage{Text: message, ContentType: model.ContentTypeText, QueuedAt: time.Now()})
+}
+
+// tryQueueMessage is TryQueue for a message with its content type and sender
+// (checked and queued under one lock, so drainOrRelease cannot miss it)
+func (p *ProgressGuard) tryQueueMessage(key string, message queuedMessage) (queued bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if p.state[key] == nil {
-		p.state[key] = &progressState{}
+	s := p.state[key]
+	if s == nil || !s.InProgress {
+		return false
 	}
-	p.state[key].Queue = append(p.state[key].Queue, message)
+	s.Queue = append(s.Queue, message)
 	return true
 }
 
@@ -56,10 +70,36 @@ func (p *ProgressGuard) SetInProgress(key string, inProgress bool) {
 // DrainQueue returns and clears the queue for the key. Caller should process
 // each message. Must be called while holding the process mutex.
 func (p *ProgressGuard) DrainQueue(key string) []string {
+	var out []string
+	for _, m := range p.drainQueuedMessages(key) {
+		out = append(out, m.Text)
+	}
+	return out
+}
+
+// drainQueuedMessages is DrainQueue returning the queued messages
+func (p *ProgressGuard) drainQueuedMessages(key string) []queuedMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.state[key]
+	if s == nil || len(s.Queue) == 0 {
+		return nil
+	}
+	out := s.Queue
+	s.Queue = nil
+	return out
+}
+
+// drainOrRelease drains the queue for the key, or clears its in-progress flag when the queue is
+// empty, atomically so no message can be queued in between and left waiting
+func (p *ProgressGuard) drainOrRelease(key string) []queuedMessage {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	s := p.state[key]
 	if s == nil || len(s.Queue) == 0 {
+		if s != nil {
+			s.InProgress = false
+		}
 		return nil
 	}
 	out := s.Queue
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Prompt caching (see LLMConfig.EnablePromptCaching): the system prompts that stay the same from
+// one turn to the next come first, and the last of them carries an Anthropic-style cache_control
+// breakpoint, so providers that cache explicitly (Anthropic models, directly or through an
+// OpenAI-compatible gateway such as OpenRouter) reuse the whole prefix. OpenAI caches long
+// prefixes on its own; it only needs the prefix to be stable.
+
+type promptCacheCtxKey struct{}
+
+// promptCachePrefix is the stable start of the system prompts of a request
+type promptCachePrefix struct {
+	count int    // number of leading system messages in the prefix
+	last  string // content of the last of them, which gets the breakpoint
+}
+
+// withPromptCachePrefix marks stable as the first system prompts of the requests sent with ctx.
+// Requests whose messages do not start with them (e.g. routing calls made with the same ctx)
+// are sent unchanged.
+func withPromptCachePrefix(ctx context.Context, stable []string) context.Context {
+	prefix := promptCachePrefix{count: len(stable)}
+	if len(stable) > 0 {
+		prefix.last = stable[len(stable)-1]
+	}
+	return context.WithValue(ctx, promptCacheCtxKey{}, prefix)
+}
+
+// promptCacheDoer adds the cache breakpoint of the request's context to chat completion requests
+type promptCacheDoer struct {
+	next openai.HTTPDoer
+}
+
+// withPromptCaching returns config with its HTTP client adding cache breakpoints
+// (config unchanged when llm does not enable prompt caching)
+func withPromptCaching(config openai.ClientConfig, llm LLMConfig) openai.ClientConfig {
+	if llm.EnablePromptCaching {
+		config.HTTPClient = promptCacheDoer{next: config.HTTPClient}
+	}
+	return config
+}
+
+// Do implements openai.HTTPDoer
+func (d promptCacheDoer) Do(req *http.Request) (*http.Response, error) {
+	prefix, ok := req.Context().Value(promptCacheCtxKey{}).(promptCachePrefix)
+	if !ok || prefix.count == 0 || req.Body == nil || !strings.HasSuffix(req.URL.Path, "/chat/completions") {
+		return d.next.Do(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if marked, ok := addCacheBreakpoint(body, prefix); ok {
+		body = marked
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return d.next.Do(req)
+}
+
+// addCacheBreakpoint turns the content of the last message of prefix into a text part with
+// cache_control, if the request's messages start with prefix
+func addCacheBreakpoint(body []byte, prefix promptCachePrefix) ([]byte, bool) {
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, false
+	}
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(request["messages"], &messages); err != nil || len(messages) < prefix.count {
+		return nil, false
+	}
+	for _, message := range messages[:prefix.count] {
+		var role string
+		if json.Unmarshal(message["role"], &role) != nil || role != openai.ChatMessageRoleSystem {
+			return nil, false
+		}
+	}
+	last := messages[prefix.count-1]
+	var content string
+	if json.Unmarshal(last["content"], &content) != nil || content != prefix.last {
+		return nil, false
+	}
+
+	parts, err := json.Marshal([]map[string]interface{}{{
+		"type":          "text",
+		"text":          content,
+		"cache_control": map[string]string{"type": "ephemeral"},
+	}})
+	if err != nil {
+		return nil, false
+	}
+	last["content"] = parts
+	if request["messages"], err = json.Marshal(messages); err != nil {
+		return nil, false
+	}
+	marked, err := json.Marshal(request)
+	if err != nil {
+		return nil, false
+	}
+	return marked, true
+}
+
+// logPromptCache logs how many prompt tokens of a response were served from the provider's cache:
+// every hit, and misses too when prompt caching is enabled
+func logPromptCache(logger log.FieldLogger, component, model string, usage openai.Usage, enabled bool) {
+	cached := 0
+	if usage.PromptTokensDetails != nil {
+		cached = usage.PromptTokensDetails.CachedTokens
+	}
+	if cached == 0 {
+		if enabled {
+			logger.Info("["+component+"] 💾 PROMPT CACHE MISS", "model", model, "prompt_tokens", usage.PromptTokens)
+		}
+		return
+	}
+	percent := 0
+	if usage.PromptTokens > 0 {
+		percent = cached * 100 / usage.PromptTokens
+	}
+	logger.Info("["+component+"] 💾 PROMPT CACHE HIT", "model", model,
+		"cached_tokens", cached, "prompt_tokens", usage.PromptTokens, "cached_percent", percent)
+}
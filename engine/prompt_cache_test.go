@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestCoreHandlerPromptCaching(t *testing.T) {
+	var requests [][]map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request struct {
+			Messages []map[string]any `json:"messages"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("Expected a JSON request, got %s", body)
+		}
+		requests = append(requests, request.Messages)
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Hello!"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: openai.Usage{PromptTokens: 2000, CompletionTokens: 5, TotalTokens: 2005,
+				PromptTokensDetails: &openai.PromptTokensDetails{CachedTokens: 1500}},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	var buf bytes.Buffer
+	config := DefaultCoreHandlerConfig()
+	config.Logger = log.New(slog.NewJSONHandler(&buf, nil))
+	agent := &Engine{Repo: repo, Sessions: sqliteStore, Functions: model.NewFunctionRegistry()}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	if err := agent.RegisterFunction("get_hours", openai.FunctionDefinition{Name: "get_hours", Description: "Opening hours"},
+		func(ctx context.Context, args map[string]any) (string, error) { return "9-17", nil }); err != nil {
+		t.Fatalf("RegisterFunction failed: %v", err)
+	}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	ctx := context.Background()
+
+	// Without the option, requests are sent as they are
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	if _, err := ch.ProcessMessage(ctx, "user1", "What are your opening hours?"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	for _, message := range requests[0] {
+		if _, ok := message["content"].(string); !ok {
+			t.Fatalf("Expected plain string contents without prompt caching, got %v", message)
+		}
+	}
+
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model", EnablePromptCaching: true}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	if _, err := ch.ProcessMessage(ctx, "user1", "And on weekends?"); err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	messages := requests[len(requests)-1]
+	prompts, stable, err := ch.buildSystemPrompts("user1")
+	if err != nil {
+		t.Fatalf("buildSystemPrompts failed: %v", err)
+	}
+	if stable != 2 || len(prompts) <= stable {
+		t.Fatalf("Expected the controller and tools prompts as the stable prefix, got %d of %d", stable, len(prompts))
+	}
+	for i, message := range messages {
+		parts, marked := message["content"].([]any)
+		if marked != (i == stable-1) {
+			t.Fatalf("Expected only message %d to carry the cache breakpoint, got %d: %v", stable-1, i, message)
+		}
+		if !marked {
+			continue
+		}
+		part := parts[0].(map[string]any)
+		cacheControl, _ := part["cache_control"].(map[string]any)
+		if len(parts) != 1 || part["text"] != prompts[stable-1] || cacheControl["type"] != "ephemeral" {
+			t.Fatalf("Expected the tools prompt as an ephemeral cache breakpoint, got %v", parts)
+		}
+	}
+	if !strings.Contains(buf.String(), `"msg":"[CoreHandler] 💾 PROMPT CACHE HIT","model":"test-model","cached_tokens":1500,"prompt_tokens":2000,"cached_percent":75`) {
+		t.Fatalf("Expected the cached tokens to be logged, got %s", buf.String())
+	}
+}
+
+func TestAddCacheBreakpoint(t *testing.T) {
+	body := []byte(`{"model":"m","messages":[{"role":"system","content":"base"},{"role":"system","content":"files"},{"role":"user","content":"hi"}]}`)
+
+	marked, ok := addCacheBreakpoint(body, promptCachePrefix{count: 1, last: "base"})
+	if !ok {
+		t.Fatal("Expected the base prompt to be marked")
+	}
+	want := `{"messages":[{"content":[{"cache_control":{"type":"ephemeral"},"text":"base","type":"text"}],"role":"system"},{"content":"files","role":"system"},{"content":"hi","role":"user"}],"model":"m"}`
+	if string(marked) != want {
+		t.Fatalf("Expected %s, got %s", want, marked)
+	}
+
+	// Requests not starting with the prefix (e.g. a routing call) are left alone
+	for _, prefix := range []promptCachePrefix{{count: 1, last: "other"}, {count: 3, last: "hi"}, {count: 4, last: "x"}} {
+		if _, ok := addCacheBreakpoint(body, prefix); ok {
+			t.Errorf("Expected no breakpoint for %+v", prefix)
+		}
+	}
+}
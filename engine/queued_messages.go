@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// QueueMode is how the Core answers messages a user sends while one of theirs is processed
+type QueueMode string
+
+const (
+	// QueueModeMerge adds queued messages to the conversation of the message in progress, so one
+	// answer covers them all (default)
+	QueueModeMerge QueueMode = "merge"
+	// QueueModeSeparate answers each queued message on its own, in order, once the message in
+	// progress is answered. The answers go to the StatusFunc of the request that queued the
+	// message, as StatusQueuedAnswer updates (SendAsNewMessage).
+	QueueModeSeparate QueueMode = "separate"
+)
+
+// defaultQueuedReply is returned for a queued message unless CoreHandlerConfig.QueuedReply is set
+const defaultQueuedReply = "⏳ Processing previous request... Please wait. 📋 Your message was queued and will be answered in order."
+
+// EventQueueExpired is the UsageEvent type recorded (AfterAction only) when a queued message is
+// dropped after waiting longer than CoreHandlerConfig.QueueTimeout. Name is its content type,
+// Duration how long it waited and Metadata has the message.
+const EventQueueExpired EventType = "queue_expired"
+
+// queuedReply returns the answer of ProcessMessage for a queued message
+func (ch *CoreHandler) queuedReply() string {
+	if ch.config.DisableQueuedReply {
+		return ""
+	}
+	if ch.config.QueuedReply != "" {
+		return ch.config.QueuedReply
+	}
+	return defaultQueuedReply
+}
+
+// isRepeatedSend reports whether a queued message is a repeated send of previous, the message
+// before it: always when previous was queued too, and with DropDuplicateOfCurrent when previous
+// is the message that was being answered
+func (ch *CoreHandler) isRepeatedSend(text, previous string, previousQueued bool) bool {
+	return text == previous && (previousQueued || ch.config.DropDuplicateOfCurrent)
+}
+
+// storeDuplicate stores a repeated send, with IsDuplicate, without answering it
+func (ch *CoreHandler) storeDuplicate(userID string, coreSession *model.Session, m queuedMessage) {
+	msgID, seqID := coreSession.GenerateMessageIDWithSeq()
+	msg := model.NewUserMessage(msgID, seqID, userID, coreSession.SessionID, m.Text, m.ContentType)
+	msg.IsDuplicate = true
+	ch.saveMessage(msg)
+}
+
+// dropExpiredMessages returns the messages of queue that waited at most QueueTimeout. The others
+// are dropped: their sender gets a StatusQueueExpired update and the Callback an EventQueueExpired.
+func (ch *CoreHandler) dropExpiredMessages(ctx context.Context, userID string, queue []queuedMessage) []queuedMessage {
+	if ch.config.QueueTimeout <= 0 {
+		return queue
+	}
+	var kept []queuedMessage
+	for _, m := range queue {
+		waited := time.Since(m.QueuedAt)
+		if waited <= ch.config.QueueTimeout {
+			kept = append(kept, m)
+			continue
+		}
+		ch.logger().Warn("[CoreHandler] ⌛ Queued message expired", "user_id", userID, "waited", waited, "timeout", ch.config.QueueTimeout)
+		senderCtx := withStatusMessages(WithStatusFunc(ctx, m.Status), ch.statusMessagesFor(ch.userLanguage(userID, m.Text)))
+		notifyStatus(senderCtx, userID, "", StatusQueueExpired, m.Text, OptSendAsNewMessage())
+		if ch.Callback != nil {
+			ch.Callback.AfterAction(ctx, &UsageEvent{
+				UserID:    userID,
+				EventType: EventQueueExpired,
+				Name:      string(m.ContentType),
+				Duration:  waited,
+				Metadata:  map[string]interface{}{"message": m.Text},
+			})
+		}
+	}
+	return kept
+}
+
+// mergeQueuedMessages drains the messages userID sent while current was being answered (see
+// ProgressGuard) and returns them as user messages to add to the conversation, so one answer
+// covers them all. They are stored and added to coreSession.Msgs like the first one. A message
+// identical to the one before it (or to current, with DropDuplicateOfCurrent) is a repeated
+// send: it is only stored, with IsDuplicate. Moderation flags queued messages as usual.
+// Nothing is merged with QueueModeSeparate (see answerQueuedMessages).
+// The error is only set when saving a message fails with FailFastOnPersistError set.
+func (ch *CoreHandler) mergeQueuedMessages(ctx context.Context, userID string, coreSession *model.Session, current string) ([]openai.ChatCompletionMessage, error) {
+	if coreSession == nil || ch.config.QueueMode == QueueModeSeparate {
+		return nil, nil
+	}
+	queue := ch.dropExpiredMessages(ctx, userID, ch.userProgress.drainQueuedMessages(userID))
+	if len(queue) == 0 {
+		return nil, nil
+	}
+
+	var merged []openai.ChatCompletionMessage
+	duplicates := 0
+	previous, previousQueued := current, false
+	for _, m := range queue {
+		repeated := ch.isRepeatedSend(m.Text, previous, previousQueued)
+		previous, previousQueued = m.Text, true
+		if repeated {
+			ch.storeDuplicate(userID, coreSession, m)
+			duplicates++
+			continue
+		}
+		msgID, seqID := coreSession.GenerateMessageIDWithSeq()
+		if _, blocked := ch.moderateUserMessage(withModerationMessageID(ctx, msgID), userID, coreSession, msgID, seqID, m.Text, m.Text, m.ContentType); blocked {
+			continue
+		}
+		msg := model.NewUserMessage(msgID, seqID, userID, coreSession.SessionID, m.Text, m.ContentType)
+		if err := ch.saveMessage(msg); err != nil {
+			if err := persistFailed(ch.config.FailFastOnPersistError, coreSession, "message", err); err != nil {
+				return nil, err
+			}
+		}
+		userMsg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: m.Text}
+		coreSession.Msgs = append(coreSession.Msgs, userMsg)
+		merged = append(merged, userMsg)
+	}
+	if err := ch.saveCoreSession(coreSession); err != nil {
+		ch.logger().Warn("[CoreHandler] ⚠️  Failed to save core session after merging queued messages", "user_id", userID, "error", err)
+	}
+	ch.logger().Info("[CoreHandler] 📋 Merged queued messages", "user_id", userID, "queued", len(queue), "merged", len(merged), "duplicates", duplicates)
+	return merged, nil
+}
+
+// answerQueuedMessages answers queue, the messages userID queued while previous was answered, one
+// full Core run each, then the ones queued meanwhile until none are left (QueueModeSeparate). It
+// holds userMu, handed over by ProcessMessageWithContentType, so new messages keep being queued
+// behind them. Repeated sends are dropped as in mergeQueuedMessages. Each answer (or failure) goes
+// to the StatusFunc of the request that queued the message, with the message in
+// Metadata["queued_message"].
+func (ch *CoreHandler) answerQueuedMessages(ctx context.Context, userID, previous string, queue []queuedMessage, userMu *sync.Mutex) {
+	defer ch.inFlight.Done()
+	defer userMu.Unlock()
+
+	previousQueued := false
+	for ; queue != nil; queue = ch.userProgress.drainOrRelease(userID) {
+		for _, m := range ch.dropExpiredMessages(ctx, userID, queue) {
+			repeated := ch.isRepeatedSend(m.Text, previous, previousQueued)
+			previous, previousQueued = m.Text, true
+			if repeated {
+				if coreSession, err := ch.getOrCreateCoreSession(userID); err == nil {
+					ch.storeDuplicate(userID, coreSession, m)
+				}
+				continue
+			}
+
+			senderCtx := withStatusMessages(WithStatusFunc(ctx, m.Status), ch.statusMessages)
+			withMessage := func(su *StatusUpdate) {
+				su.Metadata = map[string]interface{}{"queued_message": m.Text}
+			}
+			start := time.Now()
+			answer, err := ch.processOneMessageCore(senderCtx, userID, m.Text, m.ContentType)
+			ch.recordMessageProcessed(senderCtx, userID, m.ContentType, start, err)
+			senderCtx = withStatusMessages(senderCtx, ch.statusMessagesFor(ch.userLanguage(userID, m.Text)))
+			if err != nil {
+				ch.logger().Warn("[CoreHandler] ⚠️  Queued message failed", "user_id", userID, "error", err)
+				notifyStatus(senderCtx, userID, "", StatusError, err.Error(), OptSendAsNewMessage(), withMessage)
+				continue
+			}
+			notifyStatus(senderCtx, userID, "", StatusQueuedAnswer, answer, OptSendAsNewMessage(), withMessage)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+// TestCoreHandlerQueuedDuplicates verifies messages sent while the Core answers are merged into
+// its answer, with repeated sends dropped and stored as duplicates
+func TestCoreHandlerQueuedDuplicates(t *testing.T) {
+	const current = "What are your opening hours on Saturday?"
+	const followUp = "And are you open on Sunday as well?"
+
+	for _, dropCurrent := range []bool{false, true} {
+		var ch *CoreHandler
+		var mu sync.Mutex
+		var requests []openai.ChatCompletionRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req openai.ChatCompletionRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			mu.Lock()
+			requests = append(requests, req)
+			first := len(requests) == 1
+			mu.Unlock()
+			answer := "Sunday: closed."
+			if first {
+				// The user double-taps send while the first answer is being written
+				for _, text := range []string{current, followUp, followUp} {
+					if !ch.userProgress.TryQueue("user1", text) {
+						t.Errorf("Expected %q to be queued", text)
+					}
+				}
+				answer = "Saturday: 9 to 18."
+			}
+			json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer},
+				FinishReason: openai.FinishReasonStop,
+			}}})
+		}))
+
+		dir := t.TempDir()
+		os.MkdirAll(filepath.Join(dir, "root"), 0755)
+		os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+		repo, err := fsrepo.NewNodeRepository(dir)
+		if err != nil {
+			t.Fatalf("Failed to create repository: %v", err)
+		}
+		sqliteStore, err := store.NewSQLiteStore(":memory:")
+		if err != nil {
+			t.Fatalf("Failed to create SQLite store: %v", err)
+		}
+		agent := &Engine{Repo: repo, Sessions: sqliteStore}
+		if err := agent.Init(); err != nil {
+			t.Fatalf("Failed to init engine: %v", err)
+		}
+		config := DefaultCoreHandlerConfig()
+		config.DropDuplicateOfCurrent = dropCurrent
+		ch = NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+		if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+			t.Fatalf("UseLLMConfig failed: %v", err)
+		}
+
+		response, err := ch.ProcessMessage(context.Background(), "user1", current)
+		if err != nil {
+			t.Fatalf("ProcessMessage failed: %v", err)
+		}
+		coreSession, _ := ch.getOrCreateCoreSession("user1")
+		messages, _ := sqliteStore.GetMessagesBySession(coreSession.SessionID)
+		server.Close()
+		sqliteStore.Close()
+
+		// One reply answers the first message and the queued ones
+		if response != "Saturday: 9 to 18.\n\nSunday: closed." || len(requests) != 2 {
+			t.Fatalf("Expected one combined answer from 2 requests, got %q from %d", response, len(requests))
+		}
+		var sent []string
+		for _, m := range requests[1].Messages {
+			if m.Role == openai.ChatMessageRoleUser {
+				sent = append(sent, m.Content)
+			}
+		}
+		want := []string{current, current, followUp}
+		if dropCurrent {
+			want = []string{current, followUp}
+		}
+		if len(sent) != len(want) {
+			t.Fatalf("Expected user messages %q, got %q", want, sent)
+		}
+		for i := range want {
+			if sent[i] != want[i] {
+				t.Errorf("Expected user messages %q, got %q", want, sent)
+				break
+			}
+		}
+
+		// Dropped repeats are stored, flagged as duplicates
+		stored, duplicates := 0, 0
+		for _, m := range messages {
+			if m.Role != openai.ChatMessageRoleUser {
+				continue
+			}
+			stored++
+			if m.IsDuplicate {
+				duplicates++
+			}
+		}
+		wantDuplicates := 1
+		if dropCurrent {
+			wantDuplicates = 2
+		}
+		if stored != 4 || duplicates != wantDuplicates {
+			t.Errorf("Expected 4 stored user messages with %d duplicates, got %d with %d", wantDuplicates, stored, duplicates)
+		}
+	}
+}
+
+// expiryRecorder is a Callback that records the EventQueueExpired events it receives
+type expiryRecorder struct {
+	mu     sync.Mutex
+	events []UsageEvent
+}
+
+func (r *expiryRecorder) BeforeAction(context.Context, *UsageEvent) error { return nil }
+
+func (r *expiryRecorder) AfterAction(_ context.Context, event *UsageEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if event.EventType == EventQueueExpired {
+		r.events = append(r.events, *event)
+	}
+}
+
+// TestCoreHandlerQueueModeSeparate verifies QueueModeSeparate answers a queued message on its own
+// through its sender's StatusFunc, with the configured queue reply, and drops expired messages
+func TestCoreHandlerQueueModeSeparate(t *testing.T) {
+	const current = "What are your opening hours on Saturday?"
+	const followUp = "And are you open on Sunday as well?"
+	const stale = "Do you deliver to the city center?"
+
+	var ch *CoreHandler
+	var mu sync.Mutex
+	var requests []openai.ChatCompletionRequest
+	updates := make(chan *StatusUpdate, 10)
+	sender := WithStatusFunc(context.Background(), func(su *StatusUpdate) {
+		if su.Phase == StatusQueuedAnswer || su.Phase == StatusQueueExpired {
+			updates <- su
+		}
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		first := len(requests) == 1
+		mu.Unlock()
+		answer := "Sunday: closed."
+		if first {
+			// A message sent an hour ago that is still waiting, and one sent now
+			ch.userProgress.tryQueueMessage("user1", queuedMessage{Text: stale, ContentType: model.ContentTypeText, QueuedAt: time.Now().Add(-time.Hour), Status: statusFuncFromContext(sender)})
+			reply, err := ch.ProcessMessage(sender, "user1", followUp)
+			if err != nil || reply != "One moment, please." {
+				t.Errorf("Expected the configured queue reply, got %q (%v)", reply, err)
+			}
+			answer = "Saturday: 9 to 18."
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	config := DefaultCoreHandlerConfig()
+	config.QueueMode = QueueModeSeparate
+	config.QueuedReply = "One moment, please."
+	config.QueueTimeout = time.Minute
+	ch = NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	recorder := &expiryRecorder{}
+	ch.SetCallback(recorder)
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	// The first reply only answers the first message
+	response, err := ch.ProcessMessage(context.Background(), "user1", current)
+	if err != nil || response != "Saturday: 9 to 18." {
+		t.Fatalf("Expected the first message's own answer, got %q (%v)", response, err)
+	}
+
+	// The stale message is dropped, then the follow-up gets its own answer
+	var got []*StatusUpdate
+	for len(got) < 2 {
+		select {
+		case su := <-updates:
+			got = append(got, su)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected an expiry notice and a queued answer, got %d updates", len(got))
+		}
+	}
+	if got[0].Phase != StatusQueueExpired || got[0].Detail != stale || !got[0].SendAsNewMessage {
+		t.Errorf("Expected an expiry notice for the stale message, got %+v", got[0])
+	}
+	if got[1].Phase != StatusQueuedAnswer || got[1].Message != "Sunday: closed." || got[1].Metadata["queued_message"] != followUp {
+		t.Errorf("Expected the follow-up's answer, got %+v", got[1])
+	}
+	if err := ch.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+	last := requests[1].Messages[len(requests[1].Messages)-1]
+	if last.Role != openai.ChatMessageRoleUser || last.Content != followUp {
+		t.Errorf("Expected the second request to answer the follow-up, got %+v", last)
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.events) != 1 || recorder.events[0].Metadata["message"] != stale || recorder.events[0].Duration < time.Hour {
+		t.Errorf("Expected one EventQueueExpired for the stale message, got %+v", recorder.events)
+	}
+}
+
+func TestCoreHandlerQueueModeSeparateAfterFailure(t *testing.T) {
+	const followUp = "And are you open on Sunday as well?"
+
+	var ch *CoreHandler
+	var mu sync.Mutex
+	requests := 0
+	updates := make(chan *StatusUpdate, 10)
+	sender := WithStatusFunc(context.Background(), func(su *StatusUpdate) {
+		if su.Phase == StatusQueuedAnswer {
+			updates <- su
+		}
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		first := requests == 1
+		mu.Unlock()
+		if first {
+			ch.ProcessMessage(sender, "user1", followUp)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "bad request"}})
+			return
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Sunday: closed."},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	config := DefaultCoreHandlerConfig()
+	config.QueueMode = QueueModeSeparate
+	ch = NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	// The first message fails, the one queued behind it is still answered
+	if _, err := ch.ProcessMessage(context.Background(), "user1", "What are your opening hours on Saturday?"); err == nil {
+		t.Fatalf("Expected the first message to fail")
+	}
+	select {
+	case su := <-updates:
+		if su.Message != "Sunday: closed." || su.Metadata["queued_message"] != followUp {
+			t.Errorf("Expected the follow-up's answer, got %+v", su)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the queued message to be answered after the failure")
+	}
+	if err := ch.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+}
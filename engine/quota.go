@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+)
+
+// ErrQuotaExceeded is returned (wrapped) when a user's token quota is used up
+var ErrQuotaExceeded = errors.New("token quota exceeded")
+
+// EventQuotaExceeded is reported to the Callback (AfterAction only) when an LLM call is
+// blocked by the user's quota. Metadata holds "period", "limit", "used" and "resets_at".
+const EventQuotaExceeded EventType = "quota_exceeded"
+
+// Quota is a user's token allowance (prompt plus completion tokens); 0 means unlimited
+type Quota struct {
+	DailyTokens   int // per UTC day
+	MonthlyTokens int // per UTC calendar month
+}
+
+// QuotaPolicy returns the quota of a user, e.g. by plan (free: 50K/day, paid: 2M/month)
+type QuotaPolicy func(userID string) Quota
+
+// QuotaStatus is a user's quota and what is left of it
+type QuotaStatus struct {
+	UserID string `json:"user_id"`
+	Quota  Quota  `json:"quota"`
+
+	UsedToday     int `json:"used_today"`
+	UsedThisMonth int `json:"used_this_month"`
+	// Remaining tokens of each period, -1 when the period is unlimited
+	RemainingToday     int `json:"remaining_today"`
+	RemainingThisMonth int `json:"remaining_this_month"`
+
+	Exceeded bool `json:"exceeded"`
+	// ResetsAt is when the exhausted period starts over (zero when not exceeded)
+	ResetsAt time.Time `json:"resets_at,omitempty"`
+}
+
+// quotaGuard enforces a QuotaPolicy from the store's usage aggregate (model.UsageStore),
+// so quotas survive restarts and are shared by every replica using the store
+type quotaGuard struct {
+	policy QuotaPolicy
+	store  model.UsageStore
+	now    func() time.Time
+}
+
+// newQuotaGuard returns nil when policy is nil or the store keeps no usage aggregate
+func newQuotaGuard(policy QuotaPolicy, sessionStore interface{}) *quotaGuard {
+	if policy == nil {
+		return nil
+	}
+	usageStore, ok := sessionStore.(model.UsageStore)
+	if !ok {
+		log.Log.Warn("[Quota] ⚠️  QuotaPolicy ignored: the session store does not record usage")
+		return nil
+	}
+	return &quotaGuard{policy: policy, store: usageStore, now: time.Now}
+}
+
+// status computes the quota status of userID
+func (q *quotaGuard) status(userID string) (*QuotaStatus, error) {
+	quota := q.policy(userID)
+	status := &QuotaStatus{UserID: userID, Quota: quota, RemainingToday: -1, RemainingThisMonth: -1}
+	if quota.DailyTokens <= 0 && quota.MonthlyTokens <= 0 {
+		return status, nil
+	}
+
+	now := q.now().UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	if quota.DailyTokens > 0 {
+		summary, err := q.store.GetUsageSummary(userID, dayStart, time.Time{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get daily usage: %w", err)
+		}
+		status.UsedToday = summary.TotalTokens()
+		status.RemainingToday = max(quota.DailyTokens-status.UsedToday, 0)
+		if status.RemainingToday == 0 {
+			status.Exceeded = true
+			status.ResetsAt = dayStart.AddDate(0, 0, 1)
+		}
+	}
+	if quota.MonthlyTokens > 0 {
+		summary, err := q.store.GetUsageSummary(userID, monthStart, time.Time{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get monthly usage: %w", err)
+		}
+		status.UsedThisMonth = summary.TotalTokens()
+		status.RemainingThisMonth = max(quota.MonthlyTokens-status.UsedThisMonth, 0)
+		if status.RemainingThisMonth == 0 {
+			status.Exceeded = true
+			// The monthly reset is the later one, so it is when the user can continue
+			status.ResetsAt = monthStart.AddDate(0, 1, 0)
+		}
+	}
+	return status, nil
+}
+
+// check returns an ErrQuotaExceeded error when userID has no tokens left, and reports it to cb
+// as an EventQuotaExceeded event. Usage lookup failures are logged and do not block.
+func (q *quotaGuard) check(ctx context.Context, cb Callback, userID, sessionID string) error {
+	if q == nil || userID == "" {
+		return nil
+	}
+	status, err := q.status(userID)
+	if err != nil {
+		log.Log.Warn("[Quota] ⚠️  Quota check skipped", "user_id", userID, "error", err)
+		return nil
+	}
+	if !status.Exceeded {
+		return nil
+	}
+
+	period, limit, used := "daily", status.Quota.DailyTokens, status.UsedToday
+	if status.Quota.MonthlyTokens > 0 && status.RemainingThisMonth == 0 {
+		period, limit, used = "monthly", status.Quota.MonthlyTokens, status.UsedThisMonth
+	}
+	log.Log.Info("[Quota] 🚫 Quota exceeded", "user_id", userID, "period", period, "used", used, "limit", limit)
+	if cb != nil {
+		cb.AfterAction(ctx, &UsageEvent{
+			UserID:    userID,
+			SessionID: sessionID,
+			EventType: EventQuotaExceeded,
+			Name:      period,
+			Metadata: map[string]interface{}{
+				"period":    period,
+				"limit":     limit,
+				"used":      used,
+				"resets_at": status.ResetsAt,
+			},
+		})
+	}
+	return fmt.Errorf("%w: %s limit of %d tokens reached, resets at %s", ErrQuotaExceeded, period, limit, status.ResetsAt.Format(time.RFC3339))
+}
+
+// QuotaStatus returns the quota of userID and what is left of it. Fails when no QuotaPolicy is
+// configured or the session store does not record usage.
+func (ch *CoreHandler) QuotaStatus(userID string) (*QuotaStatus, error) {
+	if ch.quota == nil {
+		return nil, fmt.Errorf("quotas are not enabled")
+	}
+	return ch.quota.status(userID)
+}
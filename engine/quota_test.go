@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestCoreHandlerQuota(t *testing.T) {
+	llmRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		llmRequests++
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "OK"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: openai.Usage{PromptTokens: 800, CompletionTokens: 400, TotalTokens: 1200},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := agent.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+
+	config := DefaultCoreHandlerConfig()
+	config.QuotaPolicy = func(userID string) Quota {
+		if userID == "paid" {
+			return Quota{MonthlyTokens: 2_000_000}
+		}
+		return Quota{DailyTokens: 1000}
+	}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	callback := &usageCallback{}
+	ch.Callback = callback
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test-model", QuotaExceededMessage: "Daily limit reached."}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+
+	// The first message fits in the quota and uses it up
+	if response, err := ch.ProcessMessage(context.Background(), "free", "Hello"); err != nil || response != "OK" {
+		t.Fatalf("Expected an answer, got %q (err %v)", response, err)
+	}
+	status, err := ch.QuotaStatus("free")
+	if err != nil {
+		t.Fatalf("QuotaStatus failed: %v", err)
+	}
+	if status.UsedToday != 1200 || status.RemainingToday != 0 || status.RemainingThisMonth != -1 || !status.Exceeded || !status.ResetsAt.After(time.Now()) {
+		t.Errorf("Unexpected quota status: %+v", status)
+	}
+
+	// Further LLM calls are blocked with the configured message
+	if response, err := ch.ProcessMessage(context.Background(), "free", "Hello again"); err != nil || response != "Daily limit reached." {
+		t.Errorf("Expected the quota message, got %q (err %v)", response, err)
+	}
+	if llmRequests != 1 {
+		t.Errorf("Expected no LLM request once the quota is used up, got %d", llmRequests)
+	}
+	var exceeded *UsageEvent
+	for i := range callback.events {
+		if callback.events[i].EventType == EventQuotaExceeded {
+			exceeded = &callback.events[i]
+		}
+	}
+	if exceeded == nil || exceeded.UserID != "free" || exceeded.Metadata["period"] != "daily" || exceeded.Metadata["limit"] != 1000 {
+		t.Errorf("Expected a daily quota_exceeded event, got %+v", exceeded)
+	}
+
+	// Other users have their own quota
+	if response, err := ch.ProcessMessage(context.Background(), "paid", "Hello"); err != nil || response != "OK" {
+		t.Errorf("Expected an answer for another user, got %q (err %v)", response, err)
+	}
+	status, err = ch.QuotaStatus("paid")
+	if err != nil || status.Exceeded || status.RemainingThisMonth != 2_000_000-1200 || status.RemainingToday != -1 {
+		t.Errorf("Unexpected quota status of the paid user: %+v (err %v)", status, err)
+	}
+
+	// Without a policy quotas are off
+	plain := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	if _, err := plain.QuotaStatus("free"); err == nil {
+		t.Error("Expected QuotaStatus to fail without a QuotaPolicy")
+	}
+	if err := (*quotaGuard)(nil).check(context.Background(), nil, "free", ""); err != nil {
+		t.Errorf("Expected a nil guard to allow everything, got %v", err)
+	}
+}
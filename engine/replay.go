@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrReplayMiss is returned by a ReplayClient for a request that was never recorded
+var ErrReplayMiss = errors.New("no recorded LLM response for request")
+
+// ErrLLMRecordNotFound is returned by LLMRecordStore.LoadLLMRecord for an unknown key
+var ErrLLMRecordNotFound = errors.New("LLM record not found")
+
+// LLMRecord is one recorded LLM request/response pair
+type LLMRecord struct {
+	Key        string                        `json:"key"`
+	Request    openai.ChatCompletionRequest  `json:"request"`
+	Response   openai.ChatCompletionResponse `json:"response"`
+	RecordedAt time.Time                     `json:"recorded_at"`
+}
+
+// LLMRecordStore persists recorded LLM interactions keyed by LLMRequestKey
+type LLMRecordStore interface {
+	SaveLLMRecord(record *LLMRecord) error
+	// LoadLLMRecord returns ErrLLMRecordNotFound when nothing was recorded for key
+	LoadLLMRecord(key string) (*LLMRecord, error)
+}
+
+// LLMRequestKey identifies a request by the SHA-256 of its JSON encoding, so only a byte-for-byte
+// identical request (model, messages, tools and parameters) replays a recorded response
+func LLMRequestKey(request openai.ChatCompletionRequest) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode LLM request: %w", err)
+	}
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// FileRecordStore is an LLMRecordStore keeping one JSON file per request in a directory
+type FileRecordStore struct {
+	dir string
+}
+
+// NewFileRecordStore creates a FileRecordStore in dir, creating the directory if needed
+func NewFileRecordStore(dir string) (*FileRecordStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create LLM record directory: %w", err)
+	}
+	return &FileRecordStore{dir: dir}, nil
+}
+
+// SaveLLMRecord writes record to <dir>/<key>.json, replacing an earlier recording of the request
+func (s *FileRecordStore) SaveLLMRecord(record *LLMRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode LLM record: %w", err)
+	}
+	// Write to a temporary file first so a replay never reads a half-written record
+	tmp, err := os.CreateTemp(s.dir, ".record-*")
+	if err != nil {
+		return fmt.Errorf("failed to write LLM record: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write LLM record: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write LLM record: %w", err)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, record.Key+".json"))
+}
+
+// LoadLLMRecord reads the record of key
+func (s *FileRecordStore) LoadLLMRecord(key string) (*LLMRecord, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, key+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrLLMRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LLM record: %w", err)
+	}
+	var record LLMRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse LLM record %s: %w", key, err)
+	}
+	return &record, nil
+}
+
+// recordLLMCall saves a successful LLM call to store; failures are logged, never returned,
+// so recording cannot break a conversation
+func recordLLMCall(store LLMRecordStore, request openai.ChatCompletionRequest, resp openai.ChatCompletionResponse, logPrefix string) {
+	key, err := LLMRequestKey(request)
+	if err == nil {
+		err = store.SaveLLMRecord(&LLMRecord{Key: key, Request: request, Response: resp, RecordedAt: time.Now()})
+	}
+	if err != nil {
+		log.Log.Warn("["+logPrefix+"] ⚠️  Failed to record LLM call", "model", request.Model, "error", err)
+	}
+}
+
+// RecordingClient is a model.LLMClient recording every successful call of Client to Store
+type RecordingClient struct {
+	Client model.LLMClient
+	Store  LLMRecordStore
+}
+
+// NewRecordingClient wraps client so its calls are recorded to store
+func NewRecordingClient(client model.LLMClient, store LLMRecordStore) *RecordingClient {
+	return &RecordingClient{Client: client, Store: store}
+}
+
+// CreateChatCompletion implements model.LLMClient interface
+func (c *RecordingClient) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := c.Client.CreateChatCompletion(ctx, request)
+	if err == nil {
+		recordLLMCall(c.Store, request, resp, "RecordingClient")
+	}
+	return resp, err
+}
+
+// ReplayClient is a model.LLMClient serving recorded responses instead of calling a model.
+// A request that was not recorded fails with ErrReplayMiss rather than reaching a live model.
+type ReplayClient struct {
+	Store LLMRecordStore
+}
+
+// NewReplayClient creates a ReplayClient serving the records of store
+func NewReplayClient(store LLMRecordStore) *ReplayClient {
+	return &ReplayClient{Store: store}
+}
+
+// CreateChatCompletion implements model.LLMClient interface
+func (c *ReplayClient) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	key, err := LLMRequestKey(request)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	record, err := c.Store.LoadLLMRecord(key)
+	if errors.Is(err, ErrLLMRecordNotFound) {
+		log.Log.Error("[ReplayClient] ❌ Replay miss",
+			"key", key, "model", request.Model, "messages", len(request.Messages), "tools", len(request.Tools))
+		return openai.ChatCompletionResponse{}, fmt.Errorf("%w (key %s, model %s, %d messages)", ErrReplayMiss, key, request.Model, len(request.Messages))
+	}
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	log.Log.Debug("[ReplayClient] ⏪ Replaying recorded response", "key", key, "model", request.Model)
+	return record.Response, nil
+}
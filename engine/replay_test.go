@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEngineRecordReplay(t *testing.T) {
+	var served atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			ID: "chatcmpl-recorded",
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Hello from the model"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: openai.Usage{PromptTokens: 10, CompletionTokens: 4, TotalTokens: 14},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	records, err := NewFileRecordStore(filepath.Join(t.TempDir(), "records"))
+	if err != nil {
+		t.Fatalf("NewFileRecordStore failed: %v", err)
+	}
+
+	newEngine := func() *Engine {
+		sqliteStore, err := store.NewSQLiteStore(":memory:")
+		if err != nil {
+			t.Fatalf("Failed to create SQLite store: %v", err)
+		}
+		t.Cleanup(func() { sqliteStore.Close() })
+		e := &Engine{Repo: repo, Sessions: sqliteStore, Functions: model.NewFunctionRegistry()}
+		if err := e.Init(); err != nil {
+			t.Fatalf("Failed to init engine: %v", err)
+		}
+		return e
+	}
+	process := func(e *Engine, message string) (string, error) {
+		session, err := e.CreateSession("user1")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		reply, _, err := e.ProcessMessage(context.Background(), session.SessionID, message)
+		return reply, err
+	}
+
+	recording := newEngine()
+	if err := recording.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	recording.UseRecording(records)
+	if reply, err := process(recording, "hi"); err != nil || reply != "Hello from the model" {
+		t.Fatalf("Recorded run = %q, %v", reply, err)
+	}
+
+	// The replaying engine uses the same model; the server must not be called again
+	replaying := newEngine()
+	if err := replaying.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	replaying.UseReplay(records)
+	reply, err := process(replaying, "hi")
+	if err != nil || reply != "Hello from the model" {
+		t.Fatalf("Replayed run = %q, %v", reply, err)
+	}
+	if served.Load() != 1 {
+		t.Errorf("Expected the model to be called once, got %d calls", served.Load())
+	}
+
+	if _, err := process(replaying, "something else"); !errors.Is(err, ErrReplayMiss) {
+		t.Errorf("Expected ErrReplayMiss for an unrecorded request, got %v", err)
+	}
+}
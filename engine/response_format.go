@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrInvalidJSONResponse is returned when the model's answer is still not valid JSON (or does not
+// match the schema) after it was asked once to correct it
+var ErrInvalidJSONResponse = errors.New("invalid JSON response")
+
+// ResponseFormat asks the model for a JSON answer (OpenAI's response_format). Without a Schema
+// the model is in JSON mode: any JSON object is accepted, and the prompt must mention JSON, as
+// OpenAI requires. With a Schema the model gets the schema (json_schema) and its answer is
+// validated against it.
+type ResponseFormat struct {
+	// Name names the schema for the model (default: "response")
+	Name string
+	// Schema is the JSON Schema the answer must match
+	Schema map[string]interface{}
+	// Strict asks the provider to enforce the schema (OpenAI structured outputs). The answer is
+	// validated either way.
+	Strict bool
+}
+
+// request returns the response_format parameter of a chat completion request
+func (f *ResponseFormat) request() *openai.ChatCompletionResponseFormat {
+	if f.Schema == nil {
+		return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+	name := f.Name
+	if name == "" {
+		name = "response"
+	}
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   name,
+			Schema: jsonSchema(f.Schema),
+			Strict: f.Strict,
+		},
+	}
+}
+
+// check decodes an answer given in this format, or returns its problems
+func (f *ResponseFormat) check(content string) (interface{}, []string) {
+	value, problems := model.ParseJSONResponse(content, f.Schema)
+	if len(problems) == 0 && f.Schema == nil {
+		if _, ok := value.(map[string]interface{}); !ok {
+			return nil, []string{"the answer must be a JSON object"}
+		}
+	}
+	return value, problems
+}
+
+// correction is the message asking the model to answer again after an answer with problems
+func (f *ResponseFormat) correction(problems []string) string {
+	var sb strings.Builder
+	sb.WriteString("Your previous answer is not usable: ")
+	sb.WriteString(strings.Join(problems, "; "))
+	sb.WriteString(".\nAnswer again with JSON only, no other text")
+	if f.Schema != nil {
+		if schema, err := json.Marshal(f.Schema); err == nil {
+			fmt.Fprintf(&sb, ", matching this JSON Schema:\n%s", schema)
+		}
+	}
+	sb.WriteString(".")
+	return sb.String()
+}
+
+// jsonSchema is a JSON Schema as go-openai takes it
+type jsonSchema map[string]interface{}
+
+func (s jsonSchema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}(s))
+}
+
+// callLLMJSON sends request asking for an answer in format and returns the decoded answer. An
+// invalid answer is sent back once for correction; ErrInvalidJSONResponse is returned if the
+// second one is invalid too.
+func (e *Engine) callLLMJSON(ctx context.Context, request openai.ChatCompletionRequest, format *ResponseFormat) (interface{}, error) {
+	request.ResponseFormat = format.request()
+	request.Messages = append([]openai.ChatCompletionMessage{}, request.Messages...)
+	for retried := false; ; retried = true {
+		resp, err := e.callLLMRequest(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return nil, errors.New("empty response")
+		}
+		content := resp.Choices[0].Message.Content
+		value, problems := format.check(content)
+		if len(problems) == 0 {
+			return value, nil
+		}
+		if retried {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidJSONResponse, strings.Join(problems, "; "))
+		}
+		e.logger().Warn("[Engine] ⚠️  Invalid JSON answer, asking for a correction", "model", request.Model, "problems", strings.Join(problems, "; "))
+		request.Messages = append(request.Messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: format.correction(problems)},
+		)
+	}
+}
+
+type responseFormatCtxKey struct{}
+
+// WithResponseFormat overrides LLMConfig.ResponseFormat for the requests made with ctx. A nil
+// format asks for a plain text answer.
+func WithResponseFormat(ctx context.Context, format *ResponseFormat) context.Context {
+	return context.WithValue(ctx, responseFormatCtxKey{}, format)
+}
+
+// responseFormat returns the response format of the request made with ctx (nil: plain text)
+func (e *Engine) responseFormat(ctx context.Context) *ResponseFormat {
+	if format, ok := ctx.Value(responseFormatCtxKey{}).(*ResponseFormat); ok {
+		return format
+	}
+	return e.llmConfig.ResponseFormat
+}
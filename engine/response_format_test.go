@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// jsonModeRequest is the part of a chat completion request the JSON mode tests look at
+// (openai.ChatCompletionRequest can't decode a response_format schema)
+type jsonModeRequest struct {
+	Messages       []openai.ChatCompletionMessage `json:"messages"`
+	ResponseFormat *struct {
+		Type       string `json:"type"`
+		JSONSchema *struct {
+			Name   string                 `json:"name"`
+			Schema map[string]interface{} `json:"schema"`
+			Strict bool                   `json:"strict"`
+		} `json:"json_schema"`
+	} `json:"response_format"`
+}
+
+// newJSONModeServer answers with answers in turn (the last one once they run out) and records
+// the requests
+func newJSONModeServer(t *testing.T, answers ...string) (*httptest.Server, func() []jsonModeRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []jsonModeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req jsonModeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		answer := answers[min(len(requests), len(answers))-1]
+		mu.Unlock()
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []jsonModeRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]jsonModeRequest{}, requests...)
+	}
+}
+
+var answerFormat = &ResponseFormat{
+	Name: "answer",
+	Schema: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"answer": map[string]interface{}{"type": "string"}},
+		"required":   []interface{}{"answer"},
+	},
+	Strict: true,
+}
+
+func newJSONModeEngine(t *testing.T, serverURL string, format *ResponseFormat) (*Engine, *model.Session) {
+	t.Helper()
+	e, session := newRoutingTestEngine(t)
+	if err := e.UseLLMConfig(LLMConfig{BaseURL: serverURL, Model: "test-model", ResponseFormat: format}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	return e, session
+}
+
+func TestEngineProcessMessage_JSONResponseRetry(t *testing.T) {
+	server, requests := newJSONModeServer(t, "Sure! {answer: 42", "```json\n{\"answer\": \"42\"}\n```")
+	e, session := newJSONModeEngine(t, server.URL, answerFormat)
+
+	response, _, err := e.ProcessMessage(context.Background(), session.SessionID, "What is the answer?")
+	if err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	if !strings.Contains(response, `"answer": "42"`) {
+		t.Fatalf("Expected the corrected answer, got %q", response)
+	}
+
+	got := requests()
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 LLM calls (one retry), got %d", len(got))
+	}
+	format := got[0].ResponseFormat
+	if format == nil || format.Type != "json_schema" || format.JSONSchema == nil || format.JSONSchema.Name != "answer" || !format.JSONSchema.Strict {
+		t.Fatalf("Expected the json_schema response format, got %+v", format)
+	}
+	if format.JSONSchema.Schema["required"] == nil {
+		t.Errorf("Expected the schema to be sent, got %v", format.JSONSchema.Schema)
+	}
+	retry := got[1].Messages
+	last := retry[len(retry)-1]
+	if last.Role != openai.ChatMessageRoleSystem || !strings.Contains(last.Content, "not valid JSON") {
+		t.Errorf("Expected a correction message last, got %+v", last)
+	}
+	if previous := retry[len(retry)-2]; previous.Content != "Sure! {answer: 42" {
+		t.Errorf("Expected the invalid answer before the correction, got %+v", previous)
+	}
+
+	// Only the valid answer is kept in the session
+	stored, err := e.Sessions.Get(session.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	for _, msg := range stored.Msgs {
+		if msg.Role == openai.ChatMessageRoleSystem || strings.Contains(msg.Content, "Sure!") {
+			t.Errorf("Expected the invalid answer and its correction not to be stored, got %+v", msg)
+		}
+	}
+	if last := stored.Msgs[len(stored.Msgs)-1]; last.Content != response {
+		t.Errorf("Expected the corrected answer last, got %+v", last)
+	}
+}
+
+func TestEngineProcessMessage_JSONResponseRetryOnLastIteration(t *testing.T) {
+	// Tool calls use all but the last iteration, whose answer is invalid
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		choice := openai.ChatCompletionChoice{
+			Message: openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleAssistant,
+				ToolCalls: []openai.ToolCall{{
+					ID:       fmt.Sprintf("call_%d", n),
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: "lookup", Arguments: `{}`},
+				}},
+			},
+			FinishReason: openai.FinishReasonToolCalls,
+		}
+		switch {
+		case n == 10:
+			choice.Message = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "42"}
+			choice.FinishReason = openai.FinishReasonStop
+		case n > 10:
+			choice.Message = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: `{"answer": "42"}`}
+			choice.FinishReason = openai.FinishReasonStop
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+	}))
+	defer server.Close()
+
+	e, session := newJSONModeEngine(t, server.URL, answerFormat)
+	e.Functions = model.NewFunctionRegistry()
+	if err := e.Functions.Register("lookup", "", func(args map[string]interface{}) (string, error) { return "nothing yet", nil }); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	response, _, err := e.ProcessMessage(context.Background(), session.SessionID, "What is the answer?")
+	if err != nil {
+		t.Fatalf("ProcessMessage failed: %v", err)
+	}
+	if response != `{"answer": "42"}` {
+		t.Errorf("Expected the corrected answer, got %q", response)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 11 {
+		t.Errorf("Expected 11 LLM calls (one retry after the last iteration), got %d", calls)
+	}
+}
+
+func TestEngineProcessMessage_JSONResponseInvalid(t *testing.T) {
+	server, requests := newJSONModeServer(t, `{"answer": 42}`)
+	e, session := newJSONModeEngine(t, server.URL, answerFormat)
+
+	_, _, err := e.ProcessMessage(context.Background(), session.SessionID, "What is the answer?")
+	if !errors.Is(err, ErrInvalidJSONResponse) {
+		t.Fatalf("Expected ErrInvalidJSONResponse, got %v", err)
+	}
+	if n := len(requests()); n != 2 {
+		t.Fatalf("Expected 2 LLM calls (one retry), got %d", n)
+	}
+
+	// A nil per-call format asks for plain text
+	ctx := WithResponseFormat(context.Background(), nil)
+	if _, _, err := e.ProcessMessage(ctx, session.SessionID, "Just chat"); err != nil {
+		t.Fatalf("ProcessMessage without response format failed: %v", err)
+	}
+	got := requests()
+	if len(got) != 3 || got[2].ResponseFormat != nil {
+		t.Fatalf("Expected one plain text call, got %d calls (last format %+v)", len(got), got[len(got)-1].ResponseFormat)
+	}
+}
+
+func TestEngineChooseWithLLM_JSON(t *testing.T) {
+	server, requests := newJSONModeServer(t, `{"next": "billing"}`, `{"next": "technical"}`)
+	e, session := newJSONModeEngine(t, server.URL, &ResponseFormat{})
+	node, err := e.Repo.LoadNode("root/intake")
+	if err != nil {
+		t.Fatalf("LoadNode failed: %v", err)
+	}
+
+	next, _, err := e.chooseWithLLM(context.Background(), node, []string{"root/intake/refund", "root/intake/technical", "root/intake/sales"}, session)
+	if err != nil || next != "root/intake/technical" {
+		t.Fatalf("Expected technical after one retry, got %q (%v)", next, err)
+	}
+	got := requests()
+	if len(got) != 2 || got[0].ResponseFormat == nil || got[0].ResponseFormat.JSONSchema == nil {
+		t.Fatalf("Expected 2 json_schema calls, got %d", len(got))
+	}
+	if enum := got[0].ResponseFormat.JSONSchema.Schema["properties"]; !strings.Contains(mustJSON(t, enum), `"refund","technical","sales"`) {
+		t.Errorf("Expected the children as the enum, got %v", enum)
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to marshal %v: %v", v, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,290 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrNoNextNode is returned by Advance when the node has no child to advance to
+var ErrNoNextNode = errors.New("no next node")
+
+// routingHistoryMessages is how many recent conversation messages the model sees in llm routing
+const routingHistoryMessages = 10
+
+// HasNext reports whether the session can advance from path:
+// sequential/parallel need a child not yet visited, conditional needs a matching rule
+// or a default, and llm needs at least one child.
+func (e *Engine) HasNext(sessionID string, path string) (bool, error) {
+	session, err := e.Sessions.Get(sessionID)
+	if err != nil {
+		return false, fmt.Errorf("session not found: %w", err)
+	}
+	node, err := e.Repo.LoadNode(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to load node: %w", err)
+	}
+	children, err := e.Repo.GetChildren(path)
+	if err != nil || len(children) == 0 {
+		return false, err
+	}
+
+	switch node.Routing.EffectiveMode() {
+	case model.RoutingConditional:
+		_, _, err := chooseConditional(node, children, session)
+		return err == nil, nil
+	case model.RoutingLLM:
+		return true, nil
+	default:
+		_, ok := firstUnvisited(children, session)
+		return ok, nil
+	}
+}
+
+// Advance moves the session from fromPath to one of its children, opens the chosen node
+// and records the decision in the session's RouteHistory and PathStack (see GoBack).
+// choice, if non-empty, must name one of the children (directory name or full path) and
+// bypasses the node's routing mode. The chosen node's on_enter action, if any, runs once the
+// session is there. Returns the chosen child path.
+func (e *Engine) Advance(ctx context.Context, sessionID string, fromPath string, choice string) (string, error) {
+	session, err := e.Sessions.Get(sessionID)
+	if err != nil {
+		return "", fmt.Errorf("session not found: %w", err)
+	}
+	node, err := e.Repo.LoadNode(fromPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load node: %w", err)
+	}
+	if !e.canUser(fromPath, session.UserID, model.PermExecute) {
+		return "", fmt.Errorf("%w: cannot advance from %s", ErrAccessDenied, fromPath)
+	}
+	children, err := e.Repo.GetChildren(fromPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to list children: %w", err)
+	}
+	if len(children) == 0 {
+		return "", fmt.Errorf("%w: %s has no children", ErrNoNextNode, fromPath)
+	}
+
+	mode := node.Routing.EffectiveMode()
+	var next, reason string
+	switch {
+	case choice != "":
+		var ok bool
+		if next, ok = resolveChild(fromPath, children, choice); !ok {
+			return "", fmt.Errorf("%q is not a child of %s", choice, fromPath)
+		}
+		reason = "explicit choice"
+	case mode == model.RoutingConditional:
+		next, reason, err = chooseConditional(node, children, session)
+	case mode == model.RoutingLLM:
+		next, reason, err = e.chooseSemantically(ctx, node, children, session)
+	default:
+		var ok bool
+		if next, ok = firstUnvisited(children, session); !ok {
+			err = fmt.Errorf("%w: all children of %s have been visited", ErrNoNextNode, fromPath)
+		}
+		reason = "next unvisited child"
+	}
+	if err != nil {
+		return "", err
+	}
+	// Tools are accumulated along the new path; fail before moving if they conflict
+	if _, err := e.PathTools(next); err != nil {
+		return "", err
+	}
+
+	if _, err := e.OpenFile(sessionID, next); err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", next, err)
+	}
+
+	// OpenFile persisted the session; reload it before recording the decision
+	session, err = e.Sessions.Get(sessionID)
+	if err != nil {
+		return "", fmt.Errorf("session not found: %w", err)
+	}
+	session.RouteHistory = append(session.RouteHistory, model.RouteDecision{
+		From:   fromPath,
+		To:     next,
+		Mode:   mode,
+		Reason: reason,
+		At:     time.Now(),
+	})
+	if top := len(session.PathStack) - 1; top < 0 || session.PathStack[top] != fromPath {
+		session.PathStack = append(session.PathStack, fromPath)
+	}
+	session.PathStack = append(session.PathStack, next)
+	e.enterNode(ctx, session, next)
+	if err := e.Sessions.Put(session); err != nil {
+		return "", fmt.Errorf("failed to update session: %w", err)
+	}
+
+	e.logger().Info("[Engine] 🧭 Advanced", "session_id", sessionID, "from", fromPath, "to", next, "mode", mode, "reason", reason)
+	return next, nil
+}
+
+// SetSessionVar sets a session variable used by conditional routing rules
+func (e *Engine) SetSessionVar(sessionID string, key string, value string) error {
+	session, err := e.Sessions.Get(sessionID)
+	if err != nil {
+		return fmt.Errorf("session not found: %w", err)
+	}
+	if session.Vars == nil {
+		session.Vars = make(map[string]string)
+	}
+	session.Vars[key] = value
+	return e.Sessions.Put(session)
+}
+
+// chooseConditional returns the child of the first rule whose condition matches, or the default
+func chooseConditional(node *model.Node, children []string, session *model.Session) (string, string, error) {
+	for i, rule := range node.Routing.Rules {
+		matched, err := model.EvaluateCondition(rule.When, session.Vars, session.Tags)
+		if err != nil {
+			return "", "", fmt.Errorf("rule %d of %s: %w", i+1, node.Path, err)
+		}
+		if !matched {
+			continue
+		}
+		next, ok := resolveChild(node.Path, children, rule.Next)
+		if !ok {
+			return "", "", fmt.Errorf("rule %d of %s routes to %q which is not a child", i+1, node.Path, rule.Next)
+		}
+		return next, fmt.Sprintf("rule %d matched: %s", i+1, rule.When), nil
+	}
+	if node.Routing.Default != "" {
+		if next, ok := resolveChild(node.Path, children, node.Routing.Default); ok {
+			return next, "no rule matched, using default", nil
+		}
+		return "", "", fmt.Errorf("default %q of %s is not a child", node.Routing.Default, node.Path)
+	}
+	return "", "", fmt.Errorf("%w: no routing rule of %s matched", ErrNoNextNode, node.Path)
+}
+
+// chooseWithLLM asks the model to pick a child given their titles/descriptions and the recent conversation
+func (e *Engine) chooseWithLLM(ctx context.Context, node *model.Node, children []string, session *model.Session) (string, string, error) {
+	fallback := func(cause error) (string, string, error) {
+		if node.Routing.Default != "" {
+			if next, ok := resolveChild(node.Path, children, node.Routing.Default); ok {
+				return next, fmt.Sprintf("model choice unusable (%v), using default", cause), nil
+			}
+		}
+		return "", "", fmt.Errorf("llm routing for %s failed: %w", node.Path, cause)
+	}
+	if e.llmClient == nil && e.backups == nil && e.replay == nil {
+		return fallback(errors.New("LLM client not configured"))
+	}
+
+	// With JSON answers configured, the choice is asked for as {"next": "<name>"}
+	var format *ResponseFormat
+	names := make([]interface{}, len(children))
+	for i, child := range children {
+		names[i] = child[strings.LastIndex(child, "/")+1:]
+	}
+	if e.llmConfig.ResponseFormat != nil {
+		format = &ResponseFormat{
+			Name: "next_node",
+			Schema: map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{"next": map[string]interface{}{"type": "string", "enum": names}},
+				"required":             []interface{}{"next"},
+				"additionalProperties": false,
+			},
+			Strict: true,
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("You route a conversation to the next knowledge node.\n")
+	if format != nil {
+		sb.WriteString("Pick exactly one of the options below and reply with JSON: {\"next\": \"<name>\"}.\n\n")
+	} else {
+		sb.WriteString("Pick exactly one of the options below and reply with its name only.\n\n")
+	}
+	for i, child := range children {
+		name := names[i]
+		fmt.Fprintf(&sb, "- %s", name)
+		if childNode, err := e.Repo.LoadNode(child); err == nil {
+			if childNode.Title != "" {
+				fmt.Fprintf(&sb, ": %s", childNode.Title)
+			}
+			if childNode.Description != "" {
+				fmt.Fprintf(&sb, " — %s", childNode.Description)
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: sb.String()}}
+	history := session.Msgs
+	if len(history) > routingHistoryMessages {
+		history = history[len(history)-routingHistoryMessages:]
+	}
+	for _, msg := range history {
+		if (msg.Role == openai.ChatMessageRoleUser || msg.Role == openai.ChatMessageRoleAssistant) && msg.Content != "" {
+			messages = append(messages, openai.ChatCompletionMessage{Role: msg.Role, Content: msg.Content})
+		}
+	}
+	if len(messages) == 1 {
+		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "(no conversation yet)"})
+	}
+
+	if cbErr := checkLLMBudget(ctx, e.Callback, e.quota, session.UserID, session.SessionID, e.llmConfig.Model, messages, nil); cbErr != nil {
+		return fallback(fmt.Errorf("LLM call blocked: %w", cbErr))
+	}
+	var answer string
+	if format != nil {
+		value, err := e.callLLMJSON(ctx, openai.ChatCompletionRequest{Model: e.llmConfig.Model, Messages: messages}, format)
+		if err != nil {
+			return fallback(err)
+		}
+		answer, _ = value.(map[string]interface{})["next"].(string)
+	} else {
+		resp, err := e.callLLM(ctx, e.llmConfig.Model, messages, nil)
+		if err != nil {
+			return fallback(err)
+		}
+		if len(resp.Choices) == 0 {
+			return fallback(errors.New("empty response"))
+		}
+		answer = strings.Trim(strings.TrimSpace(resp.Choices[0].Message.Content), "`\"'.")
+	}
+	next, ok := resolveChild(node.Path, children, answer)
+	if !ok {
+		return fallback(fmt.Errorf("model answered %q", answer))
+	}
+	return next, fmt.Sprintf("model chose %q", answer), nil
+}
+
+// resolveChild maps a child directory name or full path to a child path
+func resolveChild(parent string, children []string, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	for _, child := range children {
+		if child == name || child == parent+"/"+name {
+			return child, true
+		}
+	}
+	return "", false
+}
+
+// firstUnvisited returns the first child not already opened or routed to in this session
+func firstUnvisited(children []string, session *model.Session) (string, bool) {
+	visited := make(map[string]bool)
+	for _, digest := range session.NodeDigests {
+		visited[digest.Path] = true
+	}
+	for _, decision := range session.RouteHistory {
+		visited[decision.To] = true
+	}
+	for _, child := range children {
+		if !visited[child] {
+			return child, true
+		}
+	}
+	return "", false
+}
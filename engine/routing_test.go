@@ -0,0 +1,455 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+// newRoutingTestEngine builds an Engine over a small tree:
+// root -> intake (conditional) -> refund | technical | sales
+func newRoutingTestEngine(t *testing.T) (*Engine, *model.Session) {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		full := filepath.Join(dir, rel)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", rel, err)
+		}
+	}
+	write("root/node.md", "# Root")
+	write("root/intake/node.yaml", `id: "intake"
+title: "Intake"
+routing:
+  mode: "conditional"
+  rules:
+    - when: 'vars.intent == "refund"'
+      next: "refund"
+    - when: 'tags contains "bug"'
+      next: "technical"
+  default: "sales"
+`)
+	write("root/intake/node.md", "# Intake")
+	for _, child := range []string{"refund", "technical", "sales"} {
+		write("root/intake/"+child+"/node.md", "# "+child)
+	}
+
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	return e, session
+}
+
+func TestEngineAdvance_Conditional(t *testing.T) {
+	e, session := newRoutingTestEngine(t)
+	ctx := context.Background()
+
+	// No rule matches -> default
+	next, err := e.Advance(ctx, session.SessionID, "root/intake", "")
+	if err != nil || next != "root/intake/sales" {
+		t.Fatalf("Expected default route to sales, got %q (%v)", next, err)
+	}
+
+	// Rule on session variable
+	if err := e.SetSessionVar(session.SessionID, "intent", "refund"); err != nil {
+		t.Fatalf("SetSessionVar failed: %v", err)
+	}
+	next, err = e.Advance(ctx, session.SessionID, "root/intake", "")
+	if err != nil || next != "root/intake/refund" {
+		t.Fatalf("Expected route to refund, got %q (%v)", next, err)
+	}
+
+	// Explicit choice bypasses the rules; unknown children are rejected
+	next, err = e.Advance(ctx, session.SessionID, "root/intake", "technical")
+	if err != nil || next != "root/intake/technical" {
+		t.Fatalf("Expected explicit route to technical, got %q (%v)", next, err)
+	}
+	if _, err := e.Advance(ctx, session.SessionID, "root/intake", "billing"); err == nil {
+		t.Fatal("Expected error for unknown child")
+	}
+
+	got, err := e.Sessions.Get(session.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to reload session: %v", err)
+	}
+	if len(got.RouteHistory) != 3 {
+		t.Fatalf("Expected 3 route decisions, got %d", len(got.RouteHistory))
+	}
+	last := got.RouteHistory[2]
+	if last.From != "root/intake" || last.To != "root/intake/technical" || last.Mode != model.RoutingConditional {
+		t.Errorf("Unexpected last decision: %+v", last)
+	}
+	opened := map[string]bool{}
+	for _, d := range got.NodeDigests {
+		opened[d.Path] = true
+	}
+	if !opened["root/intake/refund"] || !opened["root/intake/sales"] {
+		t.Errorf("Expected advanced nodes to be opened, got %v", got.NodeDigests)
+	}
+}
+
+func TestEngineAdvance_Sequential(t *testing.T) {
+	e, session := newRoutingTestEngine(t)
+	ctx := context.Background()
+
+	// root has a single child and no routing config (sequential)
+	if ok, err := e.HasNext(session.SessionID, "root"); err != nil || !ok {
+		t.Fatalf("Expected HasNext(root) = true, got %v (%v)", ok, err)
+	}
+	next, err := e.Advance(ctx, session.SessionID, "root", "")
+	if err != nil || next != "root/intake" {
+		t.Fatalf("Expected route to root/intake, got %q (%v)", next, err)
+	}
+	if ok, _ := e.HasNext(session.SessionID, "root"); ok {
+		t.Error("Expected HasNext(root) = false once every child was visited")
+	}
+	if _, err := e.Advance(ctx, session.SessionID, "root", ""); !errors.Is(err, ErrNoNextNode) {
+		t.Errorf("Expected ErrNoNextNode, got %v", err)
+	}
+}
+
+func TestEngineGoBack(t *testing.T) {
+	e, session := newRoutingTestEngine(t)
+	ctx := context.Background()
+
+	if _, err := e.GoBack(session.SessionID); !errors.Is(err, ErrNoPreviousNode) {
+		t.Fatalf("Expected ErrNoPreviousNode before advancing, got %v", err)
+	}
+
+	if _, err := e.Advance(ctx, session.SessionID, "root", "intake"); err != nil {
+		t.Fatalf("Advance to intake failed: %v", err)
+	}
+	if _, err := e.Advance(ctx, session.SessionID, "root/intake", "technical"); err != nil {
+		t.Fatalf("Advance to technical failed: %v", err)
+	}
+
+	nav, err := e.GetContext(session.SessionID)
+	if err != nil {
+		t.Fatalf("GetContext failed: %v", err)
+	}
+	if nav.Current != "root/intake/technical" || len(nav.Breadcrumbs) != 3 {
+		t.Fatalf("Unexpected context: %+v", nav)
+	}
+	if got := nav.String(); got != "root > Intake > technical" {
+		t.Errorf("Unexpected breadcrumb trail %q", got)
+	}
+
+	updated, err := e.GoBack(session.SessionID)
+	if err != nil {
+		t.Fatalf("GoBack failed: %v", err)
+	}
+	if got := currentPath(updated); got != "root/intake" {
+		t.Errorf("Expected to be back at root/intake, got %s", got)
+	}
+	if isOpened(updated, "root/intake/technical") {
+		t.Error("Expected popped node to be closed")
+	}
+	if !isOpened(updated, "root/intake") {
+		t.Error("Expected previous node to stay open")
+	}
+}
+
+func TestEngineJumpTo(t *testing.T) {
+	e, session := newRoutingTestEngine(t)
+
+	if _, err := e.JumpTo(session.SessionID, "root/missing"); err == nil {
+		t.Error("Expected error jumping to a missing node")
+	}
+
+	updated, err := e.JumpTo(session.SessionID, "root/intake/refund")
+	if err != nil {
+		t.Fatalf("JumpTo failed: %v", err)
+	}
+	if got := currentPath(updated); got != "root/intake/refund" {
+		t.Errorf("Expected to be at refund, got %s", got)
+	}
+	last := updated.RouteHistory[len(updated.RouteHistory)-1]
+	if last.From != "root" || last.To != "root/intake/refund" || last.Reason != "jump" {
+		t.Errorf("Unexpected route decision: %+v", last)
+	}
+
+	// GoBack returns to where the session was before the jump
+	updated, err = e.GoBack(session.SessionID)
+	if err != nil || currentPath(updated) != "root" {
+		t.Fatalf("Expected GoBack to root after jump, got %v (%v)", updated.PathStack, err)
+	}
+
+	// goto_node is only offered when the repository allows jumping
+	e.UseFunctionRegistry(nil)
+	if err := e.RegisterNavigationTools(); err == nil {
+		t.Error("Expected goto_node registration to fail without SetAllowJump")
+	}
+	e.Repo.SetAllowJump(true)
+	if err := e.RegisterNavigationTools(); err != nil {
+		t.Fatalf("RegisterNavigationTools failed: %v", err)
+	}
+	result, err := e.runTool(context.Background(), "goto_node", map[string]interface{}{
+		"path":           "root/intake/sales",
+		"__session_id__": session.SessionID,
+	})
+	if err != nil || !strings.HasPrefix(result, "Moved to") {
+		t.Fatalf("Unexpected goto_node result %q (%v)", result, err)
+	}
+}
+
+func TestEngineResetSession(t *testing.T) {
+	e, session := newRoutingTestEngine(t)
+	ctx := context.Background()
+
+	if err := e.SetSessionVar(session.SessionID, "intent", "refund"); err != nil {
+		t.Fatalf("SetSessionVar failed: %v", err)
+	}
+	if _, err := e.Advance(ctx, session.SessionID, "root", "intake"); err != nil {
+		t.Fatalf("Advance to intake failed: %v", err)
+	}
+	if _, err := e.Advance(ctx, session.SessionID, "root/intake", ""); err != nil {
+		t.Fatalf("Advance to refund failed: %v", err)
+	}
+	sqliteStore := e.Sessions.(*store.SQLiteStore)
+	sqliteStore.AddVisitedNode("user1", &model.NodeDigest{Path: "root/intake"})
+	got, _ := e.Sessions.Get(session.SessionID)
+	got.Msgs = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "refund please"}}
+	if err := e.Sessions.Put(got); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+
+	// Keeping the history
+	if err := e.ResetSession(session.SessionID, ResetOptions{}); err != nil {
+		t.Fatalf("ResetSession failed: %v", err)
+	}
+	got, _ = e.Sessions.Get(session.SessionID)
+	if currentPath(got) != "root" || len(got.NodeDigests) != 1 || got.NodeDigests[0].Path != "root" || len(got.Vars) != 0 {
+		t.Fatalf("Expected the session back at root, got stack %v, nodes %v, vars %v", got.PathStack, got.NodeDigests, got.Vars)
+	}
+	last := got.RouteHistory[len(got.RouteHistory)-1]
+	if last.From != "root/intake/refund" || last.To != "root" || last.Reason != "reset" {
+		t.Errorf("Unexpected route decision: %+v", last)
+	}
+	if len(got.Msgs) != 1 || !sqliteStore.HasVisitedNode("user1", "root/intake") {
+		t.Errorf("Expected history and visited nodes to be kept, got %d messages", len(got.Msgs))
+	}
+	if files, _ := sqliteStore.GetCurrentlyOpenedFilesBySession(session.SessionID); len(files) != 0 {
+		t.Errorf("Expected the non-root files to be closed, got %d open", len(files))
+	}
+
+	// Clearing the history and the visited nodes
+	if err := e.ResetSession(session.SessionID, ResetOptions{ClearHistory: true, ClearVisitedNodes: true}); err != nil {
+		t.Fatalf("ResetSession failed: %v", err)
+	}
+	got, _ = e.Sessions.Get(session.SessionID)
+	if len(got.Msgs) != 0 || len(got.ArchivedMsgs) != 1 {
+		t.Errorf("Expected the conversation to be archived, got %d active / %d archived", len(got.Msgs), len(got.ArchivedMsgs))
+	}
+	if sqliteStore.HasVisitedNode("user1", "root/intake") {
+		t.Error("Expected visited nodes to be cleared")
+	}
+}
+
+func TestEngineAdvance_ToolsPolicy(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		full := filepath.Join(dir, rel)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", rel, err)
+		}
+	}
+	tools := func(defs ...string) string {
+		var entries []string
+		for _, d := range defs {
+			name, desc, _ := strings.Cut(d, "=")
+			entries = append(entries, `{"name": "`+name+`", "description": "`+desc+`", "input_schema": {"type": "object"}}`)
+		}
+		return `{"tools": [` + strings.Join(entries, ", ") + `]}`
+	}
+	write("root/node.md", "# Root")
+	write("root/tools.json", tools("search=root search", "ticket=root ticket", "delete=root delete"))
+	write("root/support/node.yaml", `id: "support"
+tools_policy:
+  strategy: "append_dedupe"
+  add: ["ticket"]
+  remove: ["delete"]
+`)
+	write("root/support/node.md", "# Support")
+	write("root/support/tools.json", tools("search=support search", "ticket=support ticket", "refund=support refund"))
+	write("root/billing/node.md", "# Billing")
+	write("root/billing/tools.json", tools("search=billing search"))
+
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+
+	// Engine-level strategy rejects redefinitions; support's policy allows them
+	e := &Engine{Repo: repo, Sessions: sqliteStore, llmConfig: LLMConfig{ToolMergeStrategy: model.MergeStrategyError}}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	got, err := e.PathTools("root/support")
+	if err != nil {
+		t.Fatalf("PathTools failed: %v", err)
+	}
+	var names []string
+	for _, tool := range got {
+		names = append(names, tool.Name+"="+tool.Description)
+	}
+	want := "search=support search,ticket=root ticket,refund=support refund"
+	if strings.Join(names, ",") != want {
+		t.Errorf("Expected %s, got %s", want, strings.Join(names, ","))
+	}
+
+	ctx := context.Background()
+	if _, err := e.Advance(ctx, session.SessionID, "root", "billing"); err == nil {
+		t.Error("Expected Advance to billing to fail on the conflicting search tool")
+	}
+	if next, err := e.Advance(ctx, session.SessionID, "root", "support"); err != nil || next != "root/support" {
+		t.Errorf("Expected Advance to support, got %q (%v)", next, err)
+	}
+}
+
+func TestEngineOnEnter(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		full := filepath.Join(dir, rel)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", rel, err)
+		}
+	}
+	write("root/node.md", "# Root")
+	write("root/billing/node.yaml", `id: "billing"
+on_enter:
+  tool: "account_status"
+  args:
+    account: "{{.UserID}}"
+    plan: "{{.Vars.plan}}"
+    limit: 3
+`)
+	write("root/billing/node.md", "# Billing")
+	write("root/billing/invoices/node.yaml", `id: "invoices"
+on_enter:
+  tool: "bounce"
+`)
+	write("root/billing/invoices/node.md", "# Invoices")
+
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	repo.SetAllowJump(true)
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	e.UseFunctionRegistry(nil)
+	if err := e.RegisterNavigationTools(); err != nil {
+		t.Fatalf("RegisterNavigationTools failed: %v", err)
+	}
+	def := func(name string) openai.FunctionDefinition {
+		return openai.FunctionDefinition{Name: name, Parameters: map[string]any{"type": "object"}}
+	}
+	var statusCalls []map[string]any
+	e.RegisterFunction("account_status", def("account_status"), func(ctx context.Context, args map[string]any) (string, error) {
+		statusCalls = append(statusCalls, args)
+		return "status: active for " + args["account"].(string) + " (" + args["plan"].(string) + ")", nil
+	})
+	// bounce moves the session back to billing, whose action must not run again from here
+	e.RegisterFunction("bounce", def("bounce"), func(ctx context.Context, args map[string]any) (string, error) {
+		if _, err := e.JumpTo(args["__session_id__"].(string), "root/billing"); err != nil {
+			return "", err
+		}
+		return "bounced", nil
+	})
+
+	session, err := e.CreateSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := e.SetSessionVar(session.SessionID, "plan", "pro"); err != nil {
+		t.Fatalf("SetSessionVar failed: %v", err)
+	}
+	ctx := context.Background()
+
+	// Advance runs the action with templated arguments and adds its result to the context
+	if _, err := e.Advance(ctx, session.SessionID, "root", "billing"); err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	if len(statusCalls) != 1 {
+		t.Fatalf("Expected account_status to run once, got %d calls", len(statusCalls))
+	}
+	if args := statusCalls[0]; args["account"] != "user1" || args["plan"] != "pro" || args["limit"] != 3 {
+		t.Errorf("Expected rendered arguments, got %v", args)
+	}
+	updated, _ := e.Sessions.Get(session.SessionID)
+	last := updated.Msgs[len(updated.Msgs)-1]
+	if last.Role != openai.ChatMessageRoleSystem || !strings.Contains(last.Content, "status: active for user1 (pro)") {
+		t.Fatalf("Expected the on_enter result in the session context, got %+v", last)
+	}
+
+	// A move made by an action doesn't run the action of the node it moves to
+	if _, err := e.JumpTo(session.SessionID, "root/billing/invoices"); err != nil {
+		t.Fatalf("JumpTo failed: %v", err)
+	}
+	if len(statusCalls) != 1 {
+		t.Errorf("Expected the nested on_enter action to be skipped, got %d account_status calls", len(statusCalls))
+	}
+	updated, _ = e.Sessions.Get(session.SessionID)
+	if last := updated.Msgs[len(updated.Msgs)-1]; !strings.Contains(last.Content, "bounce returned:\nbounced") {
+		t.Errorf("Expected the bounce result in the session context, got %q", last.Content)
+	}
+
+	// goto_node reports the result in its tool result while the conversation is in flight
+	msgs := len(updated.Msgs)
+	toolCtx := model.WithToolCallInfo(ctx, model.ToolCallInfo{ToolName: "goto_node", SessionID: session.SessionID})
+	result, err := e.runTool(toolCtx, "goto_node", map[string]interface{}{
+		"path":           "root/billing",
+		"__session_id__": session.SessionID,
+	})
+	if err != nil || !strings.Contains(result, "status: active for user1 (pro)") {
+		t.Fatalf("Expected the on_enter result in the goto_node result, got %q (%v)", result, err)
+	}
+	updated, _ = e.Sessions.Get(session.SessionID)
+	if len(updated.Msgs) != msgs {
+		t.Errorf("Expected goto_node to leave the session messages alone, got %d messages (was %d)", len(updated.Msgs), msgs)
+	}
+}
@@ -44,6 +44,9 @@ type SessionSchedulerConfig struct {
 	// DisableLogs if true, SessionScheduler does not emit any logs
 	DisableLogs bool
 
+	// Logger receives the scheduler's logs (nil: log.Log)
+	Logger log.FieldLogger
+
 	// SummarizationPrompts holds customizable prompts for summarization
 	SummarizationPrompts SummarizationPrompts
 }
@@ -189,6 +192,11 @@ type SessionScheduler struct {
 	mu             sync.Mutex
 }
 
+// logger returns the scheduler's logger (see SessionSchedulerConfig.Logger)
+func (ss *SessionScheduler) logger() log.FieldLogger {
+	return log.Or(ss.config.Logger)
+}
+
 // NewSessionScheduler creates a new session scheduler
 func NewSessionScheduler(
 	sessionHandler *model.SessionHandler,
@@ -220,7 +228,7 @@ func (ss *SessionScheduler) Start(ctx context.Context) {
 
 	if ss.running {
 		if !ss.config.DisableLogs {
-			log.Log.Warnf("[SessionScheduler] ⚠️  Scheduler is already running")
+			ss.logger().Warn("[SessionScheduler] ⚠️  Scheduler is already running")
 		}
 		return
 	}
@@ -228,8 +236,8 @@ func (ss *SessionScheduler) Start(ctx context.Context) {
 	ss.running = true
 	ss.stopChan = make(chan struct{}) // Recreate stopChan in case it was closed
 	if !ss.config.DisableLogs {
-		log.Log.Infof("[SessionScheduler] 🚀 Starting session scheduler | CheckInterval: %v | FirstThreshold: %d msgs | SubsequentThreshold: %d msgs + %v",
-			ss.config.CheckInterval, ss.config.FirstSummarizationThreshold, ss.config.SubsequentMessageThreshold, ss.config.SubsequentTimeThreshold)
+		ss.logger().Info("[SessionScheduler] 🚀 Starting session scheduler",
+			"check_interval", ss.config.CheckInterval, "first_threshold", ss.config.FirstSummarizationThreshold, "subsequent_threshold", ss.config.SubsequentMessageThreshold, "subsequent_time_threshold", ss.config.SubsequentTimeThreshold)
 	}
 
 	go ss.run(ctx)
@@ -245,7 +253,7 @@ func (ss *SessionScheduler) Stop() {
 	}
 
 	if !ss.config.DisableLogs {
-		log.Log.Infof("[SessionScheduler] 🛑 Stopping session scheduler")
+		ss.logger().Info("[SessionScheduler] 🛑 Stopping session scheduler")
 	}
 	close(ss.stopChan)
 	ss.running = false
@@ -291,21 +299,21 @@ func (ss *SessionScheduler) sleepWithCancel(d time.Duration) bool {
 func (ss *SessionScheduler) chatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
 	// Try backup chain first (OSS 120B should be first in the chain for priority)
 	if ss.backups != nil {
-		log.Log.Infof("[SessionScheduler] 🔄 BACKUP CHAIN >> Attempting backup chain for summarization | BackupProviders: %d | RequestModel: %s",
-			len(ss.backups.providers), request.Model)
+		ss.logger().Info("[SessionScheduler] 🔄 BACKUP CHAIN >> Attempting backup chain for summarization",
+			"backup_providers", len(ss.backups.providers), "request_model", request.Model)
 		resp, ok := ss.backups.tryBackup(ctx, request.Messages, nil, "SessionScheduler")
 		if ok {
-			log.Log.Infof("[SessionScheduler] ✅ BACKUP CHAIN >> Success | UsedModel: %s | ResponseTokens: %d",
-				resp.Model, resp.Usage.TotalTokens)
+			ss.logger().Info("[SessionScheduler] ✅ BACKUP CHAIN >> Success",
+				"used_model", resp.Model, "response_tokens", resp.Usage.TotalTokens)
 			return resp, nil
 		}
-		log.Log.Warnf("[SessionScheduler] ⚠️ BACKUP CHAIN >> All backup providers failed, falling back to main LLM: %s", ss.config.SummaryModel)
+		ss.logger().Warn("[SessionScheduler] ⚠️ BACKUP CHAIN >> All backup providers failed, falling back to main LLM", "model", ss.config.SummaryModel)
 	} else {
-		log.Log.Warnf("[SessionScheduler] ⚠️ BACKUP CHAIN >> No backup chain configured, using main LLM: %s", ss.config.SummaryModel)
+		ss.logger().Warn("[SessionScheduler] ⚠️ BACKUP CHAIN >> No backup chain configured, using main LLM", "model", ss.config.SummaryModel)
 	}
 
 	// Fall back to main llmClient
-	log.Log.Infof("[SessionScheduler] 🔵 MAIN LLM >> Calling main LLM | Model: %s", ss.config.SummaryModel)
+	ss.logger().Info("[SessionScheduler] 🔵 MAIN LLM >> Calling main LLM", "model", ss.config.SummaryModel)
 	return ss.llmClient.CreateChatCompletion(ctx, request)
 }
 
@@ -314,26 +322,26 @@ func (ss *SessionScheduler) run(ctx context.Context) {
 	// Check for early shutdown before initial check
 	if ss.isStopping() || ctx.Err() != nil {
 		if !ss.config.DisableLogs {
-			log.Log.Infof("[SessionScheduler] ✅ Scheduler stopped before initial check")
+			ss.logger().Info("[SessionScheduler] ✅ Scheduler stopped before initial check")
 		}
 		return
 	}
 
 	if !ss.config.DisableLogs {
-		log.Log.Infof("[SessionScheduler] 🔍 Starting initial session check (checking all sessions immediately)...")
+		ss.logger().Info("[SessionScheduler] 🔍 Starting initial session check (checking all sessions immediately)...")
 	}
 	ss.checkAndSummarizeSessions(ctx)
 
 	// Check for shutdown after initial check
 	if ss.isStopping() || ctx.Err() != nil {
 		if !ss.config.DisableLogs {
-			log.Log.Infof("[SessionScheduler] ✅ Scheduler stopped after initial check")
+			ss.logger().Info("[SessionScheduler] ✅ Scheduler stopped after initial check")
 		}
 		return
 	}
 
 	if !ss.config.DisableLogs {
-		log.Log.Infof("[SessionScheduler] ✅ Initial session check completed, starting periodic checks...")
+		ss.logger().Info("[SessionScheduler] ✅ Initial session check completed, starting periodic checks...")
 	}
 
 	ticker := time.NewTicker(ss.config.CheckInterval)
@@ -345,12 +353,12 @@ func (ss *SessionScheduler) run(ctx context.Context) {
 			ss.checkAndSummarizeSessions(ctx)
 		case <-ss.stopChan:
 			if !ss.config.DisableLogs {
-				log.Log.Infof("[SessionScheduler] ✅ Scheduler stopped")
+				ss.logger().Info("[SessionScheduler] ✅ Scheduler stopped")
 			}
 			return
 		case <-ctx.Done():
 			if !ss.config.DisableLogs {
-				log.Log.Infof("[SessionScheduler] ✅ Scheduler stopped (context cancelled)")
+				ss.logger().Info("[SessionScheduler] ✅ Scheduler stopped (context cancelled)")
 			}
 			return
 		}
@@ -365,7 +373,7 @@ func (ss *SessionScheduler) checkAndSummarizeSessions(ctx context.Context) {
 	}
 
 	if !ss.config.DisableLogs {
-		log.Log.Infof("[SessionScheduler] 🔍 Checking sessions for summarization...")
+		ss.logger().Info("[SessionScheduler] 🔍 Checking sessions for summarization...")
 	}
 
 	// Get all sessions from store
@@ -373,7 +381,7 @@ func (ss *SessionScheduler) checkAndSummarizeSessions(ctx context.Context) {
 	debugStore, ok := sessionStore.(debuger.DebugStore)
 	if !ok {
 		if !ss.config.DisableLogs {
-			log.Log.Errorf("[SessionScheduler] ❌ Store does not implement DebugStore interface")
+			ss.logger().Error("[SessionScheduler] ❌ Store does not implement DebugStore interface")
 		}
 		return
 	}
@@ -381,7 +389,7 @@ func (ss *SessionScheduler) checkAndSummarizeSessions(ctx context.Context) {
 	sessionsByUser, err := debugStore.GetAllSessions()
 	if err != nil {
 		if !ss.config.DisableLogs {
-			log.Log.Errorf("[SessionScheduler] ❌ Failed to get all sessions: %v", err)
+			ss.logger().Error("[SessionScheduler] ❌ Failed to get all sessions", "error", err)
 		}
 		return
 	}
@@ -407,7 +415,7 @@ sessionLoop:
 			// Check for shutdown before processing each session
 			if ss.isStopping() || ctx.Err() != nil {
 				if !ss.config.DisableLogs {
-					log.Log.Infof("[SessionScheduler] 🛑 Shutdown requested, stopping session check early")
+					ss.logger().Info("[SessionScheduler] 🛑 Shutdown requested, stopping session check early")
 				}
 				stoppedEarly = true
 				break sessionLoop
@@ -460,40 +468,40 @@ sessionLoop:
 					}
 				}
 				if len(reasons) > 0 && !ss.config.DisableLogs {
-					log.Log.Debugf("[SessionScheduler] ⏭️  Session %s not eligible: %s | Messages: %d", session.SessionID, strings.Join(reasons, ", "), msgCount)
+					ss.logger().Debug("[SessionScheduler] ⏭️  Session not eligible", "session_id", session.SessionID, "reasons", strings.Join(reasons, ", "), "messages", msgCount)
 				}
 			}
 			if isEligible {
 				eligibleSessions++
 				if !ss.config.DisableLogs {
-					log.Log.Infof("[SessionScheduler] 🎯 Session eligible for summarization | SessionID: %s | UserID: %s | Messages: %d", session.SessionID, userID, msgCount)
+					ss.logger().Info("[SessionScheduler] 🎯 Session eligible for summarization", "session_id", session.SessionID, "user_id", userID, "messages", msgCount)
 				}
 				if err := ss.summarizeSession(ctx, session); err != nil {
 					// Check if error is due to context cancellation
 					if ctx.Err() != nil {
 						if !ss.config.DisableLogs {
-							log.Log.Infof("[SessionScheduler] 🛑 Summarization cancelled due to shutdown")
+							ss.logger().Info("[SessionScheduler] 🛑 Summarization cancelled due to shutdown")
 						}
 						stoppedEarly = true
 						break sessionLoop
 					}
 					if !ss.config.DisableLogs {
-						log.Log.Errorf("[SessionScheduler] ❌ Failed to summarize session %s: %v", session.SessionID, err)
+						ss.logger().Error("[SessionScheduler] ❌ Failed to summarize session", "session_id", session.SessionID, "error", err)
 					}
 				} else {
 					summarizedSessions++
 					if !ss.config.DisableLogs {
-						log.Log.Infof("[SessionScheduler] ✅ Summarized session %s (UserID: %s)", session.SessionID, userID)
+						ss.logger().Info("[SessionScheduler] ✅ Summarized session", "session_id", session.SessionID, "user_id", userID)
 					}
 				}
 
 				// Sleep with cancellation support
 				if !ss.config.DisableLogs {
-					log.Log.Infof("[SessionScheduler] ⏸️  Sleeping 10 seconds before next summarization...")
+					ss.logger().Info("[SessionScheduler] ⏸️  Sleeping 10 seconds before next summarization...")
 				}
 				if ss.sleepWithCancel(10 * time.Second) {
 					if !ss.config.DisableLogs {
-						log.Log.Infof("[SessionScheduler] 🛑 Sleep interrupted by shutdown")
+						ss.logger().Info("[SessionScheduler] 🛑 Sleep interrupted by shutdown")
 					}
 					stoppedEarly = true
 					break sessionLoop
@@ -507,9 +515,12 @@ sessionLoop:
 		if stoppedEarly {
 			status = "interrupted by shutdown"
 		}
-		log.Log.Infof("[SessionScheduler] 📊 Summary check %s | Total: %d | Users: %d | Messages: %d | WithMsgs: %d | NoMsgs: %d | AlreadySummarized: %d | NotEligible: %d | Eligible: %d | Summarized: %d | FirstThreshold: %d msgs | SubsequentThreshold: %d msgs + %v time",
-			status, totalSessions, totalUsers, totalMessages, sessionsWithMessages, sessionsWithoutMessages, alreadySummarizedSessions, sessionsNotEligible, eligibleSessions, summarizedSessions,
-			ss.config.FirstSummarizationThreshold, ss.config.SubsequentMessageThreshold, ss.config.SubsequentTimeThreshold)
+		ss.logger().Info("[SessionScheduler] 📊 Summary check",
+			"status", status, "total", totalSessions, "users", totalUsers, "messages", totalMessages,
+			"with_msgs", sessionsWithMessages, "no_msgs", sessionsWithoutMessages, "already_summarized", alreadySummarizedSessions,
+			"not_eligible", sessionsNotEligible, "eligible", eligibleSessions, "summarized", summarizedSessions,
+			"first_threshold", ss.config.FirstSummarizationThreshold, "subsequent_threshold", ss.config.SubsequentMessageThreshold,
+			"subsequent_time_threshold", ss.config.SubsequentTimeThreshold)
 	}
 }
 
@@ -534,8 +545,8 @@ func (ss *SessionScheduler) isEligibleForSummarization(session *model.Session, n
 	}
 	if msgCount >= immediateThreshold {
 		if !ss.config.DisableLogs {
-			log.Log.Infof("[SessionScheduler] ⚡ Immediate summarization triggered for session (messages: %d >= threshold: %d)",
-				msgCount, immediateThreshold)
+			ss.logger().Info("[SessionScheduler] ⚡ Immediate summarization triggered for session",
+				"messages", msgCount, "threshold", immediateThreshold)
 		}
 		return true
 	}
@@ -598,7 +609,7 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 	//				if l.GeneratedSummary != "" {
 	//					session.Summary = l.GeneratedSummary
 	//					if err := sessionStore.Put(session); err == nil && !ss.config.DisableLogs {
-	//						log.Log.Infof("[SessionScheduler] 🔧 Repaired session %s: restored Summary from summarization log", session.SessionID)
+	//						log.Log.Info("[SessionScheduler] 🔧 Repaired session: restored Summary from summarization log", "session_id", session.SessionID)
 	//					}
 	//					return nil
 	//				}
@@ -613,7 +624,7 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 	if msgCount == 0 {
 		if len(session.ArchivedMsgs) == 0 {
 			if !ss.config.DisableLogs {
-				log.Log.Infof("[SessionScheduler] ⏭️  Session %s has no messages and no archived messages, skipping", session.SessionID)
+				ss.logger().Info("[SessionScheduler] ⏭️  Session has no messages and no archived messages, skipping", "session_id", session.SessionID)
 			}
 			return nil
 		}
@@ -621,13 +632,13 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 		useArchivedForSummary = true
 		msgCount = len(session.ArchivedMsgs) // for log stats
 		if !ss.config.DisableLogs {
-			log.Log.Infof("[SessionScheduler] 📝 Session %s has no current Msgs, using %d archived messages for summarization", session.SessionID, msgCount)
+			ss.logger().Info("[SessionScheduler] 📝 Session has no current Msgs, using archived messages for summarization", "session_id", session.SessionID, "messages", msgCount)
 		}
 	}
 
 	if !ss.config.DisableLogs {
-		log.Log.Infof("[SessionScheduler] 📝 Summarizing session %s | Messages: %d | PreviousSummary: %s | ExistingTags: %v",
-			session.SessionID, msgCount, truncateStringForLog(session.Summary, 50), session.Tags)
+		ss.logger().Info("[SessionScheduler] 📝 Summarizing session",
+			"session_id", session.SessionID, "messages", msgCount, "previous_summary", truncateStringForLog(session.Summary, 50), "existing_tags", session.Tags)
 	}
 
 	// Ensure user_id is in context
@@ -661,7 +672,12 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 	if useArchivedForSummary {
 		conversationText = formatMessagesForSummary(session.ArchivedMsgs)
 	} else {
-		conversationText = formatMessagesForSummary(session.Msgs)
+		// Messages trimmed by the active history window were archived without being summarized
+		msgs := session.Msgs
+		if pending := min(session.TrimmedMsgs, len(session.ArchivedMsgs)); pending > 0 {
+			msgs = append(append([]openai.ChatCompletionMessage{}, session.ArchivedMsgs[len(session.ArchivedMsgs)-pending:]...), msgs...)
+		}
+		conversationText = formatMessagesForSummary(msgs)
 	}
 
 	// Track what we generate
@@ -673,7 +689,7 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 	summLog.PromptSent = promptSent // Store prompt for debug/DB (even on failure)
 	if err != nil {
 		if !ss.config.DisableLogs {
-			log.Log.Warnf("[SessionScheduler] ⚠️  Failed to generate summary for session %s: %v", session.SessionID, err)
+			ss.logger().Warn("[SessionScheduler] ⚠️  Failed to generate summary", "session_id", session.SessionID, "error", err)
 		}
 		summLog.ErrorMessage = fmt.Sprintf("summary generation failed: %v", err)
 		summLog.MarkCompleted("failed")
@@ -691,7 +707,7 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 			if err == nil {
 				user.Ban(0, "You have been restricted due to use of inappropriate language.")
 				if putErr := us.PutUser(user); putErr == nil && !ss.config.DisableLogs {
-					log.Log.Infof("[SessionScheduler] 🚫 User banned (offensive content) | UserID: %s", session.UserID)
+					ss.logger().Info("[SessionScheduler] 🚫 User banned (offensive content)", "user_id", session.UserID)
 				}
 			}
 		}
@@ -716,7 +732,7 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 	newTags, err := ss.generateAndMergeTags(ctx, existingTags, conversationText)
 	if err != nil {
 		if !ss.config.DisableLogs {
-			log.Log.Warnf("[SessionScheduler] ⚠️  Failed to generate tags for session %s: %v", session.SessionID, err)
+			ss.logger().Warn("[SessionScheduler] ⚠️  Failed to generate tags", "session_id", session.SessionID, "error", err)
 		}
 	} else if len(newTags) > 0 {
 		session.Tags = newTags
@@ -728,7 +744,7 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 		title, err := ss.generateTitle(ctx, conversationText)
 		if err != nil {
 			if !ss.config.DisableLogs {
-				log.Log.Warnf("[SessionScheduler] ⚠️  Failed to generate title for session %s: %v", session.SessionID, err)
+				ss.logger().Warn("[SessionScheduler] ⚠️  Failed to generate title", "session_id", session.SessionID, "error", err)
 			}
 		} else if title != "" {
 			session.Title = title
@@ -746,19 +762,25 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 	}
 
 	// When we had current Msgs: move them to ArchivedMsgs. When we used archived only: no move.
-	msgsToMove := make([]openai.ChatCompletionMessage, len(session.Msgs))
-	copy(msgsToMove, session.Msgs)
+	// A tool call still waiting for its results stays active with them, so the pair is never split.
+	previousMsgs := session.Msgs
+	moveCount := archivableMessages(session.Msgs)
+	msgsToMove := make([]openai.ChatCompletionMessage, moveCount)
+	copy(msgsToMove, session.Msgs[:moveCount])
 
 	var archivedMsgsBackupLen int
 	previousSummarizedAt := session.SummarizedAt
+	previousTrimmedMsgs := session.TrimmedMsgs
+	session.TrimmedMsgs = 0
 	if len(msgsToMove) > 0 {
 		archivedMsgsBackupLen = len(session.ArchivedMsgs)
 		session.ArchivedMsgs = append(session.ArchivedMsgs, msgsToMove...)
-		session.Msgs = []openai.ChatCompletionMessage{}
+		session.Msgs = append([]openai.ChatCompletionMessage{}, previousMsgs[moveCount:]...)
 	}
 
 	session.SummarizedAt = time.Now()
 	session.UpdatedAt = time.Now()
+	session.SummarizationTokens += summLog.TotalTokens
 
 	// Update log with after-state before save
 	summLog.MessagesAfterCount = len(session.Msgs)
@@ -767,11 +789,13 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 	// Save session - if this fails, rollback all in-memory changes
 	if err := sessionStore.Put(session); err != nil {
 		if len(msgsToMove) > 0 {
-			session.Msgs = msgsToMove
+			session.Msgs = previousMsgs
 			session.ArchivedMsgs = session.ArchivedMsgs[:archivedMsgsBackupLen]
 		}
 		session.Summary = previousSummary
 		session.SummarizedAt = previousSummarizedAt
+		session.TrimmedMsgs = previousTrimmedMsgs
+		session.SummarizationTokens -= summLog.TotalTokens
 		summLog.MarkCompleted("failed")
 		summLog.ErrorMessage = fmt.Sprintf("failed to save session: %v", err)
 		if hasDebugStore {
@@ -787,9 +811,9 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 	}
 
 	if !ss.config.DisableLogs {
-		log.Log.Infof("[SessionScheduler] ✅ Session %s summarized | Type: %s | Moved: %d msgs | Archived: %d | Summary: %s | Tags: %v | Duration: %dms",
-			session.SessionID, summarizationType, len(msgsToMove), len(session.ArchivedMsgs),
-			truncateStringForLog(session.Summary, 50), session.Tags, summLog.DurationMs)
+		ss.logger().Info("[SessionScheduler] ✅ Session summarized",
+			"session_id", session.SessionID, "type", summarizationType, "moved", len(msgsToMove), "archived", len(session.ArchivedMsgs),
+			"summary", truncateStringForLog(session.Summary, 50), "tags", session.Tags, "duration_ms", summLog.DurationMs)
 	}
 
 	return nil
@@ -798,8 +822,8 @@ func (ss *SessionScheduler) summarizeSession(ctx context.Context, session *model
 // generateImprovedSummaryWithResponse generates an improved summary and returns the full response and the prompt sent (for logging).
 func (ss *SessionScheduler) generateImprovedSummaryWithResponse(ctx context.Context, sessionID string, userID string, previousSummary string, conversationText string) (string, *openai.ChatCompletionResponse, string, error) {
 	if !ss.config.DisableLogs {
-		log.Log.Infof("[SessionScheduler] 🔍 generateImprovedSummaryWithResponse called | SessionID: %s | PreviousSummary: %s",
-			sessionID, truncateStringForLog(previousSummary, 50))
+		ss.logger().Info("[SessionScheduler] 🔍 generateImprovedSummaryWithResponse called",
+			"session_id", sessionID, "previous_summary", truncateStringForLog(previousSummary, 50))
 	}
 
 	// Use configured prompts
@@ -842,7 +866,7 @@ func (ss *SessionScheduler) generateImprovedSummaryWithResponse(ctx context.Cont
 	}
 
 	if !ss.config.DisableLogs {
-		log.Log.Infof("[SessionScheduler] 🔵 LLM >> Model: %s | Messages: %d (improved summary)", ss.config.SummaryModel, len(request.Messages))
+		ss.logger().Info("[SessionScheduler] 🔵 LLM >> Improved summary", "model", ss.config.SummaryModel, "messages", len(request.Messages))
 	}
 
 	resp, err := ss.chatCompletion(ctx, request)
@@ -857,7 +881,7 @@ func (ss *SessionScheduler) generateImprovedSummaryWithResponse(ctx context.Cont
 	summary := getMessageContentString(resp.Choices[0].Message)
 
 	if !ss.config.DisableLogs {
-		log.Log.Infof("[SessionScheduler] 📊 TOKEN USAGE >> total=%d (improved summary)", resp.Usage.TotalTokens)
+		ss.logger().Info("[SessionScheduler] 📊 TOKEN USAGE >> Improved summary", "total_tokens", resp.Usage.TotalTokens)
 	}
 
 	return summary, &resp, promptSent, nil
@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrNoSemanticMatch is returned by SemanticRouter.Choose when no candidate is similar enough
+var ErrNoSemanticMatch = errors.New("no semantically similar node")
+
+// defaultMinSimilarity is the cosine similarity a node needs to be chosen without the LLM
+const defaultMinSimilarity = 0.3
+
+// EmbeddingProvider computes embedding vectors, one per text
+type EmbeddingProvider interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// OpenAIEmbeddingProvider is an EmbeddingProvider backed by an OpenAI-compatible embeddings API
+type OpenAIEmbeddingProvider struct {
+	client *openai.Client
+	model  openai.EmbeddingModel
+}
+
+// NewOpenAIEmbeddingProvider creates an embedding provider using client and modelName
+// (e.g. "text-embedding-3-small")
+func NewOpenAIEmbeddingProvider(client *openai.Client, modelName string) *OpenAIEmbeddingProvider {
+	return &OpenAIEmbeddingProvider{client: client, model: openai.EmbeddingModel(modelName)}
+}
+
+// Embed implements EmbeddingProvider
+func (p *OpenAIEmbeddingProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	resp, err := p.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{Input: texts, Model: p.model})
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding response has %d vectors for %d texts", len(resp.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding response has an out of range index %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// SemanticRouterConfig configures a SemanticRouter
+type SemanticRouterConfig struct {
+	// CachePath is the file node embeddings are cached in, keyed by content hash
+	// (empty keeps them in memory only)
+	CachePath string
+	// MinSimilarity is the cosine similarity the best node needs; below it routing falls back
+	// to the LLM (default: 0.3)
+	MinSimilarity float64
+}
+
+// SemanticRouter picks the child node whose title and description embedding is most similar
+// to the user's message, so llm routing only asks the model when no node is a clear match
+type SemanticRouter struct {
+	provider      EmbeddingProvider
+	repo          *fsrepo.NodeRepository
+	minSimilarity float64
+}
+
+// NewSemanticRouter creates a semantic router over repo. Node embeddings are computed now if
+// the tree is already loaded, and on every load and reload after that.
+func NewSemanticRouter(provider EmbeddingProvider, repo *fsrepo.NodeRepository, config SemanticRouterConfig) *SemanticRouter {
+	if config.MinSimilarity <= 0 {
+		config.MinSimilarity = defaultMinSimilarity
+	}
+	repo.SetEmbedder(provider.Embed, config.CachePath)
+	if len(repo.CachedNodes()) > 0 {
+		if err := repo.EnsureEmbeddings(context.Background()); err != nil {
+			log.Log.Warn("[SemanticRouter] ⚠️  Failed to compute node embeddings", "error", err)
+		}
+	}
+	return &SemanticRouter{provider: provider, repo: repo, minSimilarity: config.MinSimilarity}
+}
+
+// Choose returns the candidate node most similar to message and its cosine similarity.
+// Candidates without an embedding are skipped; ErrNoSemanticMatch is returned when the best
+// one is below MinSimilarity.
+func (s *SemanticRouter) Choose(ctx context.Context, message string, candidates []string) (string, float64, error) {
+	if message == "" {
+		return "", 0, fmt.Errorf("%w: empty message", ErrNoSemanticMatch)
+	}
+	vectors, err := s.provider.Embed(ctx, []string{message})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to embed message: %w", err)
+	}
+	if len(vectors) != 1 {
+		return "", 0, fmt.Errorf("embedder returned %d vectors for 1 text", len(vectors))
+	}
+
+	best, bestScore := "", -1.0
+	for _, path := range candidates {
+		nodeVector, ok := s.repo.NodeEmbedding(path)
+		if !ok {
+			continue
+		}
+		if score := cosineSimilarity(vectors[0], nodeVector); score > bestScore {
+			best, bestScore = path, score
+		}
+	}
+	if best == "" || bestScore < s.minSimilarity {
+		return "", bestScore, fmt.Errorf("%w (best %.2f, need %.2f)", ErrNoSemanticMatch, bestScore, s.minSimilarity)
+	}
+	return best, bestScore, nil
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b (0 for mismatched or zero vectors)
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// SetSemanticRouter makes llm routing try router before asking the model (nil disables it)
+func (e *Engine) SetSemanticRouter(router *SemanticRouter) {
+	e.semanticRouter = router
+}
+
+// chooseSemantically picks a child of an llm-routed node with the semantic router, from the
+// latest user message, and falls back to chooseWithLLM when it has no confident match
+func (e *Engine) chooseSemantically(ctx context.Context, node *model.Node, children []string, session *model.Session) (string, string, error) {
+	if e.semanticRouter != nil {
+		next, score, err := e.semanticRouter.Choose(ctx, lastUserMessage(session), children)
+		if err == nil {
+			return next, fmt.Sprintf("semantic match (similarity %.2f)", score), nil
+		}
+		e.logger().Info("[Engine] 🧭 Semantic routing fell back to the LLM", "node", node.Path, "reason", err)
+	}
+	return e.chooseWithLLM(ctx, node, children, session)
+}
+
+// lastUserMessage returns the text of the session's most recent user message
+func lastUserMessage(session *model.Session) string {
+	for i := len(session.Msgs) - 1; i >= 0; i-- {
+		msg := session.Msgs[i]
+		if msg.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		if msg.Content != "" {
+			return msg.Content
+		}
+		for _, part := range msg.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText && part.Text != "" {
+				return part.Text
+			}
+		}
+	}
+	return ""
+}
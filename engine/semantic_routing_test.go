@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+// keywordEmbedder embeds texts as keyword counts and records how many texts it embedded
+type keywordEmbedder struct {
+	embedded int
+}
+
+func (k *keywordEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	k.embedded += len(texts)
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		text = strings.ToLower(text)
+		for _, word := range []string{"refund", "bug", "price"} {
+			vectors[i] = append(vectors[i], float32(strings.Count(text, word)))
+		}
+	}
+	return vectors, nil
+}
+
+func TestSemanticRouting(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		full := filepath.Join(dir, rel)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", rel, err)
+		}
+	}
+	write("root/node.md", "# Root")
+	write("root/help/node.yaml", "id: \"help\"\ntitle: \"Help\"\nrouting:\n  mode: \"llm\"\n  default: \"sales\"\n")
+	write("root/help/node.md", "# Help")
+	for child, description := range map[string]string{
+		"refund":    "Refund requests and refund status",
+		"technical": "Bug reports and crashes",
+		"sales":     "Price questions and plans",
+	} {
+		write("root/help/"+child+"/node.yaml", "id: \""+child+"\"\ntitle: \""+child+"\"\ndescription: \""+description+"\"\n")
+		write("root/help/"+child+"/node.md", "# "+child)
+	}
+
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	if err := repo.Load(); err != nil {
+		t.Fatalf("Failed to load repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+	e := &Engine{Repo: repo, Sessions: sqliteStore}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+
+	cachePath := filepath.Join(t.TempDir(), "embeddings.json")
+	embedder := &keywordEmbedder{}
+	e.SetSemanticRouter(NewSemanticRouter(embedder, repo, SemanticRouterConfig{CachePath: cachePath}))
+	if _, ok := repo.NodeEmbedding("root/help/technical"); !ok {
+		t.Fatal("Expected node embeddings to be computed for the loaded tree")
+	}
+
+	advance := func(message string) string {
+		t.Helper()
+		session, err := e.CreateSession("user1")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		session.Msgs = append(session.Msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: message})
+		if err := sqliteStore.Put(session); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+		next, err := e.Advance(context.Background(), session.SessionID, "root/help", "")
+		if err != nil {
+			t.Fatalf("Advance failed: %v", err)
+		}
+		return next
+	}
+
+	if next := advance("The app shows a bug on startup"); next != "root/help/technical" {
+		t.Errorf("Expected the semantic match technical, got %q", next)
+	}
+	// Without a similar node routing falls back to the LLM (here: its default)
+	if next := advance("Hello there"); next != "root/help/sales" {
+		t.Errorf("Expected the fallback to the default, got %q", next)
+	}
+
+	// A new repository over the same tree reuses the cached vectors
+	repo2, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	cached := &keywordEmbedder{}
+	NewSemanticRouter(cached, repo2, SemanticRouterConfig{CachePath: cachePath})
+	if err := repo2.Load(); err != nil {
+		t.Fatalf("Failed to load repository: %v", err)
+	}
+	if cached.embedded != 0 {
+		t.Errorf("Expected cached embeddings to be reused, embedded %d texts", cached.embedded)
+	}
+	if _, ok := repo2.NodeEmbedding("root/help/refund"); !ok {
+		t.Error("Expected node embeddings after loading with an embedder set")
+	}
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/ghiac/agentize/log"
+)
+
+// StatusMessageData is what status message templates are rendered with
+type StatusMessageData struct {
+	Detail string // the update's Detail: tool display name, agent type, custom text
+}
+
+// DefaultStatusMessages returns the built-in (English) text of each status phase.
+// StatusCustom always shows the text given to update_status and StatusQueuedAnswer the answer;
+// neither can be overridden.
+func DefaultStatusMessages() map[StatusPhase]string {
+	return map[StatusPhase]string{
+		StatusReceived:      "Message received",
+		StatusAnalyzing:     "Reading your message...",
+		StatusRouting:       "Choosing how to answer...",
+		StatusThinking:      "Thinking...",
+		StatusToolExecuting: "{{.Detail}}...",
+		StatusToolDone:      "{{.Detail}} done",
+		StatusAgentCalling:  "Asking the {{.Detail}} agent...",
+		StatusAgentDone:     "The {{.Detail}} agent answered",
+		StatusCompleted:     "Done",
+		StatusError:         "Something went wrong",
+		StatusQueueExpired:  "Your message waited too long and was not answered. Please send it again.",
+		StatusCustom:        "{{.Detail}}",
+		StatusQueuedAnswer:  "{{.Detail}}",
+	}
+}
+
+// statusTranslations are the built-in translations of DefaultStatusMessages, keyed by ISO 639-1 code
+func statusTranslations() map[string]map[StatusPhase]string {
+	return map[string]map[StatusPhase]string{
+		"fr": {
+			StatusReceived:      "Message reçu",
+			StatusAnalyzing:     "Lecture de votre message...",
+			StatusRouting:       "Choix de la réponse...",
+			StatusThinking:      "Réflexion...",
+			StatusToolExecuting: "{{.Detail}}...",
+			StatusToolDone:      "{{.Detail}} terminé",
+			StatusAgentCalling:  "Consultation de l'agent {{.Detail}}...",
+			StatusAgentDone:     "L'agent {{.Detail}} a répondu",
+			StatusCompleted:     "Terminé",
+			StatusError:         "Une erreur s'est produite",
+			StatusQueueExpired:  "Votre message a attendu trop longtemps et n'a pas reçu de réponse. Veuillez le renvoyer.",
+		},
+		"es": {
+			StatusReceived:      "Mensaje recibido",
+			StatusAnalyzing:     "Leyendo tu mensaje...",
+			StatusRouting:       "Eligiendo cómo responder...",
+			StatusThinking:      "Pensando...",
+			StatusToolExecuting: "{{.Detail}}...",
+			StatusToolDone:      "{{.Detail}} listo",
+			StatusAgentCalling:  "Consultando al agente {{.Detail}}...",
+			StatusAgentDone:     "El agente {{.Detail}} respondió",
+			StatusCompleted:     "Listo",
+			StatusError:         "Algo salió mal",
+			StatusQueueExpired:  "Tu mensaje esperó demasiado y no fue respondido. Por favor, envíalo de nuevo.",
+		},
+		"de": {
+			StatusReceived:      "Nachricht erhalten",
+			StatusAnalyzing:     "Ihre Nachricht wird gelesen...",
+			StatusRouting:       "Antwort wird vorbereitet...",
+			StatusThinking:      "Denke nach...",
+			StatusToolExecuting: "{{.Detail}}...",
+			StatusToolDone:      "{{.Detail}} erledigt",
+			StatusAgentCalling:  "Frage den Agenten {{.Detail}}...",
+			StatusAgentDone:     "Der Agent {{.Detail}} hat geantwortet",
+			StatusCompleted:     "Fertig",
+			StatusError:         "Etwas ist schiefgelaufen",
+			StatusQueueExpired:  "Ihre Nachricht hat zu lange gewartet und wurde nicht beantwortet. Bitte senden Sie sie erneut.",
+		},
+		"fa": {
+			StatusReceived:      "پیام دریافت شد",
+			StatusAnalyzing:     "در حال خواندن پیام شما...",
+			StatusRouting:       "در حال انتخاب نحوه پاسخ...",
+			StatusThinking:      "در حال فکر کردن...",
+			StatusToolExecuting: "{{.Detail}}...",
+			StatusToolDone:      "{{.Detail}} انجام شد",
+			StatusAgentCalling:  "در حال پرسیدن از عامل {{.Detail}}...",
+			StatusAgentDone:     "عامل {{.Detail}} پاسخ داد",
+			StatusCompleted:     "انجام شد",
+			StatusError:         "مشکلی پیش آمد",
+			StatusQueueExpired:  "پیام شما بیش از حد منتظر ماند و پاسخ داده نشد. لطفاً دوباره ارسال کنید.",
+		},
+	}
+}
+
+// newLocalizedStatusMessages parses the status messages of every language with a built-in
+// translation or an entry in localized. For a language, localized takes precedence over
+// messages, which take precedence over the built-in translation.
+func newLocalizedStatusMessages(messages map[StatusPhase]string, localized map[string]map[StatusPhase]string, suppress []StatusPhase) map[string]*statusMessages {
+	translations := statusTranslations()
+	codes := make(map[string]bool, len(translations)+len(localized))
+	for language := range translations {
+		codes[language] = true
+	}
+	for language := range localized {
+		codes[language] = true
+	}
+	byLanguage := make(map[string]*statusMessages, len(codes))
+	for language := range codes {
+		merged := make(map[StatusPhase]string)
+		for _, layer := range []map[StatusPhase]string{translations[language], messages, localized[language]} {
+			for phase, text := range layer {
+				merged[phase] = text
+			}
+		}
+		byLanguage[language] = newStatusMessages(merged, suppress)
+	}
+	return byLanguage
+}
+
+// statusMessages holds the parsed status templates and the phases that are not reported
+type statusMessages struct {
+	templates  map[StatusPhase]*template.Template
+	suppressed map[StatusPhase]bool
+}
+
+var defaultStatusMessages = newStatusMessages(nil, nil)
+
+// newStatusMessages parses messages over the defaults. A template that fails to parse is logged
+// and the default is used instead.
+func newStatusMessages(messages map[StatusPhase]string, suppress []StatusPhase) *statusMessages {
+	sm := &statusMessages{
+		templates:  make(map[StatusPhase]*template.Template),
+		suppressed: make(map[StatusPhase]bool, len(suppress)),
+	}
+	for phase, text := range DefaultStatusMessages() {
+		sm.templates[phase] = template.Must(template.New(string(phase)).Parse(text))
+	}
+	for phase, text := range messages {
+		if phase == StatusCustom || phase == StatusQueuedAnswer {
+			continue
+		}
+		tmpl, err := template.New(string(phase)).Parse(text)
+		if err != nil {
+			log.Log.Warn("[Status] ⚠️  Invalid status message template, using the default", "phase", phase, "error", err)
+			continue
+		}
+		sm.templates[phase] = tmpl
+	}
+	for _, phase := range suppress {
+		sm.suppressed[phase] = true
+	}
+	return sm
+}
+
+// message renders the text of phase for detail (the detail itself for phases without a template)
+func (sm *statusMessages) message(phase StatusPhase, detail string) string {
+	tmpl, ok := sm.templates[phase]
+	if !ok {
+		return detail
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, StatusMessageData{Detail: detail}); err != nil {
+		log.Log.Warn("[Status] ⚠️  Failed to render status message", "phase", phase, "error", err)
+		return detail
+	}
+	return b.String()
+}
+
+// Context helpers for the status messages of a request
+type statusMessagesCtxKey struct{}
+
+func withStatusMessages(ctx context.Context, sm *statusMessages) context.Context {
+	return context.WithValue(ctx, statusMessagesCtxKey{}, sm)
+}
+
+// statusMessagesFromContext returns the request's status messages, or the defaults
+func statusMessagesFromContext(ctx context.Context) *statusMessages {
+	if sm, ok := ctx.Value(statusMessagesCtxKey{}).(*statusMessages); ok && sm != nil {
+		return sm
+	}
+	return defaultStatusMessages
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNotifyStatusMessages(t *testing.T) {
+	var updates []*StatusUpdate
+	ctx := WithStatusFunc(context.Background(), func(status *StatusUpdate) {
+		updates = append(updates, status)
+	})
+
+	// Without configuration every phase is reported with the default text
+	notifyStatus(ctx, "user1", "", StatusToolExecuting, "web_search")
+	if len(updates) != 1 || updates[0].Message != "web_search..." {
+		t.Fatalf("Unexpected default status: %+v", updates)
+	}
+
+	sm := newStatusMessages(map[StatusPhase]string{
+		StatusToolExecuting: `{{if eq .Detail "web_search"}}جستجو در وب...{{else}}{{.Detail}}...{{end}}`,
+		StatusThinking:      "{{.Broken",
+		StatusCustom:        "ignored",
+	}, []StatusPhase{StatusToolDone})
+	ctx = withStatusMessages(ctx, sm)
+	updates = nil
+
+	notifyStatus(ctx, "user1", "", StatusToolExecuting, "web_search")
+	notifyStatus(ctx, "user1", "", StatusToolDone, "web_search")
+	notifyStatus(ctx, "user1", "", StatusThinking, "")
+	notifyStatus(ctx, "user1", "", StatusCustom, "Looking it up")
+
+	if len(updates) != 3 {
+		t.Fatalf("Expected the suppressed phase to be dropped, got %d updates", len(updates))
+	}
+	if updates[0].Message != "جستجو در وب..." {
+		t.Errorf("Unexpected overridden message: %q", updates[0].Message)
+	}
+	if updates[1].Message != "Thinking..." {
+		t.Errorf("Expected the default for an invalid template, got %q", updates[1].Message)
+	}
+	if updates[2].Message != "Looking it up" {
+		t.Errorf("Expected custom statuses to keep their text, got %q", updates[2].Message)
+	}
+}
+
+func TestLocalizedStatusMessagesPrecedence(t *testing.T) {
+	byLanguage := newLocalizedStatusMessages(
+		map[StatusPhase]string{StatusThinking: "Working on it..."},
+		map[string]map[StatusPhase]string{"fr": {StatusCompleted: "C'est fait !"}},
+		nil,
+	)
+	fr := byLanguage["fr"]
+	if got := fr.message(StatusCompleted, ""); got != "C'est fait !" {
+		t.Errorf("Expected LocalizedStatusMessages to come first, got %q", got)
+	}
+	if got := fr.message(StatusThinking, ""); got != "Working on it..." {
+		t.Errorf("Expected StatusMessages to override the built-in translation, got %q", got)
+	}
+	if got := fr.message(StatusError, ""); got != "Une erreur s'est produite" {
+		t.Errorf("Expected the built-in translation, got %q", got)
+	}
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+)
+
+// TemplateContext is the data node.md templates are rendered against, e.g.
+//
+//	Hello {{.UserName}}, today is {{.Now.Format "2006-01-02"}}.
+//	Your plan: {{.Vars.plan}} ({{index .Vars "credits"}} credits left)
+type TemplateContext struct {
+	UserID    string
+	UserName  string // display name of the user, empty if unknown
+	SessionID string
+	Now       time.Time
+	// Vars holds the values set with Engine.SetTemplateVars, overridden by the session's Vars
+	Vars map[string]interface{}
+}
+
+// nodeTemplates renders node content as text/template, caching parsed templates by content hash
+type nodeTemplates struct {
+	mu     sync.RWMutex
+	vars   map[string]interface{}
+	parsed map[string]*template.Template // node hash -> parsed template (nil if it failed to parse)
+}
+
+// SetTemplateVars sets application values available to node.md templates as .Vars
+// (e.g. plan tier). Session variables with the same key take precedence.
+func (e *Engine) SetTemplateVars(vars map[string]interface{}) {
+	e.templates.mu.Lock()
+	defer e.templates.mu.Unlock()
+	e.templates.vars = make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		e.templates.vars[k] = v
+	}
+}
+
+// renderNodeContent renders node.Content as a template for session.
+// Content without template actions is returned as-is; on a parse or execution error the raw
+// content is returned and a warning logged, so a broken template never fails a message.
+func (e *Engine) renderNodeContent(node *model.Node, session *model.Session) string {
+	if !strings.Contains(node.Content, "{{") {
+		return node.Content
+	}
+
+	tmpl := e.nodeTemplate(node)
+	if tmpl == nil {
+		return node.Content
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, e.templateContext(session)); err != nil {
+		e.logger().Warn("[Engine] ⚠️  Failed to render node template, using raw content",
+			"path", node.Path, "session_id", session.SessionID, "error", err)
+		return node.Content
+	}
+	return sb.String()
+}
+
+// nodeTemplate returns the parsed template for node, or nil if its content does not parse
+func (e *Engine) nodeTemplate(node *model.Node) *template.Template {
+	e.templates.mu.RLock()
+	tmpl, ok := e.templates.parsed[node.Hash]
+	e.templates.mu.RUnlock()
+	if ok {
+		return tmpl
+	}
+
+	tmpl, err := template.New(node.Path).Parse(node.Content)
+	if err != nil {
+		e.logger().Warn("[Engine] ⚠️  Failed to parse node template, using raw content", "path", node.Path, "error", err)
+		tmpl = nil
+	}
+
+	e.templates.mu.Lock()
+	if e.templates.parsed == nil {
+		e.templates.parsed = make(map[string]*template.Template)
+	}
+	e.templates.parsed[node.Hash] = tmpl
+	e.templates.mu.Unlock()
+	return tmpl
+}
+
+// templateContext builds the data a session's node templates are rendered against
+func (e *Engine) templateContext(session *model.Session) TemplateContext {
+	ctx := TemplateContext{
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+		Now:       time.Now(),
+		Vars:      make(map[string]interface{}),
+	}
+
+	e.templates.mu.RLock()
+	for k, v := range e.templates.vars {
+		ctx.Vars[k] = v
+	}
+	e.templates.mu.RUnlock()
+	for k, v := range session.Vars {
+		ctx.Vars[k] = v
+	}
+
+	if userStore, ok := e.Sessions.(interface {
+		GetUser(string) (*model.User, error)
+	}); ok {
+		if user, err := userStore.GetUser(session.UserID); err == nil && user != nil {
+			ctx.UserName = user.Name
+		}
+	}
+	return ctx
+}
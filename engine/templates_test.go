@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+)
+
+func TestRenderNodeContent(t *testing.T) {
+	repo, err := fsrepo.NewNodeRepositoryFromFS(fstest.MapFS{
+		"root/node.md":        {Data: []byte("# Root\nUser {{.UserID}} on {{.Vars.plan}}, {{.Vars.credits}} credits")},
+		"root/broken/node.md": {Data: []byte("Hello {{.Missing")},
+		"root/plain/node.md":  {Data: []byte("No placeholders here")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	e := &Engine{Repo: repo}
+	e.SetTemplateVars(map[string]interface{}{"plan": "free", "credits": 10})
+
+	session := &model.Session{
+		UserID:      "u1",
+		SessionID:   "u1-high-s0001",
+		Vars:        map[string]string{"plan": "pro"},
+		NodeDigests: []model.NodeDigest{{Path: "root"}, {Path: "root/broken"}, {Path: "root/plain"}},
+	}
+
+	prompts := e.getOpenedNodePrompts(session)
+	if len(prompts) != 3 {
+		t.Fatalf("got %d prompts, want 3", len(prompts))
+	}
+	if !strings.HasSuffix(prompts[0], "User u1 on pro, 10 credits") {
+		t.Errorf("root prompt not rendered with session vars over app vars:\n%s", prompts[0])
+	}
+	if !strings.HasSuffix(prompts[1], "Hello {{.Missing") {
+		t.Errorf("broken template should fall back to raw content:\n%s", prompts[1])
+	}
+	if !strings.HasSuffix(prompts[2], "No placeholders here") {
+		t.Errorf("plain content changed:\n%s", prompts[2])
+	}
+}
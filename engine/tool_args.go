@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+type offeredToolsCtxKey struct{}
+
+// withOfferedTools records the tools offered to the model in the current request, whose input
+// schemas the arguments of its tool calls are validated against (see checkToolArgs)
+func withOfferedTools(ctx context.Context, tools []openai.Tool) context.Context {
+	return context.WithValue(ctx, offeredToolsCtxKey{}, tools)
+}
+
+// offeredToolSchema returns the input schema of the tool name as offered to the model,
+// nil when the tool was not offered or has no parameters
+func offeredToolSchema(ctx context.Context, name string) map[string]interface{} {
+	tools, _ := ctx.Value(offeredToolsCtxKey{}).([]openai.Tool)
+	for _, tool := range tools {
+		if tool.Function == nil || tool.Function.Name != name || tool.Function.Parameters == nil {
+			continue
+		}
+		if schema, ok := tool.Function.Parameters.(map[string]interface{}); ok {
+			return schema
+		}
+		// Other parameter types (e.g. jsonschema.Definition) are read through their JSON form
+		data, err := json.Marshal(tool.Function.Parameters)
+		if err != nil {
+			return nil
+		}
+		var schema map[string]interface{}
+		if json.Unmarshal(data, &schema) != nil {
+			return nil
+		}
+		return schema
+	}
+	return nil
+}
+
+// checkToolArgs parses and repairs the arguments of toolCall and, unless skipValidation is set,
+// validates them against the offered tool's input schema (see model.ParseToolArguments)
+func checkToolArgs(ctx context.Context, toolCall openai.ToolCall, skipValidation bool, logPrefix string) *model.ToolArgsCheck {
+	var schema map[string]interface{}
+	if !skipValidation {
+		schema = offeredToolSchema(ctx, toolCall.Function.Name)
+	}
+	check := model.ParseToolArguments(toolCall.Function.Arguments, schema)
+	switch check.Outcome {
+	case model.ToolArgsRepaired:
+		log.Log.Info("["+logPrefix+"] 🩹 Tool arguments repaired",
+			"function", toolCall.Function.Name, "tool_call_id", toolCall.ID, "repairs", check.Detail())
+	case model.ToolArgsInvalid:
+		log.Log.Warn("["+logPrefix+"] ⚠️  Invalid tool arguments",
+			"function", toolCall.Function.Name, "tool_call_id", toolCall.ID, "problems", check.Detail())
+	}
+	return check
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ghiac/agentize/model"
+)
+
+// UnboundTool is a tool declared in the knowledge tree that has no registered handler
+type UnboundTool struct {
+	Name  string
+	Nodes []string // paths of the nodes declaring it
+}
+
+// BindTool binds handler to a tool declared in the nodes' tools.json, replacing any
+// previous handler of that name. Creates the function registry if there is none.
+func (e *Engine) BindTool(name string, handler model.ToolFunction) error {
+	if e.Functions == nil {
+		e.Functions = model.NewFunctionRegistry()
+	}
+	if err := e.Functions.RegisterOrReplace(name, "", handler); err != nil {
+		return err
+	}
+	e.forgetHTTPTool(name)
+	e.logger().Info("[Engine] 🔗 Tool bound", "name", name)
+	return nil
+}
+
+// SetStrictTools makes Init fail when a tool declared in the knowledge tree has no handler
+// (by default unbound tools are only logged)
+func (e *Engine) SetStrictTools(strict bool) {
+	e.strictTools = strict
+}
+
+// UnboundTools returns every active tool declared anywhere in the knowledge tree that has
+// no handler in the function registry, sorted by name. Returns nil if there is no registry,
+// since a custom Executor cannot be inspected.
+func (e *Engine) UnboundTools() []UnboundTool {
+	if e.Functions == nil || e.Repo == nil {
+		return nil
+	}
+	declared := make(map[string][]string)
+	e.collectDeclaredTools("root", declared, make(map[string]bool))
+
+	var unbound []UnboundTool
+	for name, nodes := range declared {
+		if !e.Functions.Has(name) {
+			unbound = append(unbound, UnboundTool{Name: name, Nodes: nodes})
+		}
+	}
+	sort.Slice(unbound, func(i, j int) bool { return unbound[i].Name < unbound[j].Name })
+	return unbound
+}
+
+// collectDeclaredTools maps the active tools of path and its descendants to the nodes declaring them
+func (e *Engine) collectDeclaredTools(path string, declared map[string][]string, seen map[string]bool) {
+	if seen[path] {
+		return
+	}
+	seen[path] = true
+	node, err := e.Repo.LoadNode(path)
+	if err != nil {
+		return
+	}
+	for i := range node.Tools {
+		if tool := &node.Tools[i]; tool.IsUsable() {
+			declared[tool.Name] = append(declared[tool.Name], path)
+		}
+	}
+	children, err := e.Repo.GetChildren(path)
+	if err != nil {
+		return
+	}
+	for _, child := range children {
+		e.collectDeclaredTools(child, declared, seen)
+	}
+}
+
+// VerifyTools logs every tool declared in the knowledge tree without a handler.
+// If strict is true it also returns a *model.MissingFunctionsError listing them.
+func (e *Engine) VerifyTools(strict bool) error {
+	unbound := e.UnboundTools()
+	if len(unbound) == 0 {
+		return nil
+	}
+	names := make([]string, len(unbound))
+	for i, tool := range unbound {
+		names[i] = tool.Name
+		e.logger().Warn("[Engine] ⚠️  Tool has no handler", "name", tool.Name, "nodes", tool.Nodes)
+	}
+	if strict {
+		return &model.MissingFunctionsError{MissingTools: names}
+	}
+	return nil
+}
+
+// toolNotImplementedResult is the tool result returned to the model when it calls a tool
+// without a handler, so it can carry on without that tool instead of retrying it
+func toolNotImplementedResult(name string) string {
+	data, _ := json.Marshal(map[string]string{
+		"error":   "tool_not_implemented",
+		"tool":    name,
+		"message": fmt.Sprintf("Tool %s is not implemented on this server. Do not call it again; continue without it.", name),
+	})
+	return string(data)
+}
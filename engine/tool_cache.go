@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ToolCacheScope is what cached tool results are shared across
+type ToolCacheScope string
+
+const (
+	// ToolCacheScopeSession reuses results within one Core session (default)
+	ToolCacheScopeSession ToolCacheScope = "session"
+	// ToolCacheScopeUser reuses results across all sessions of a user
+	ToolCacheScopeUser ToolCacheScope = "user"
+)
+
+// defaultToolCacheMaxEntries bounds the tool result cache when ToolCacheConfig.MaxEntries is 0
+const defaultToolCacheMaxEntries = 1000
+
+// defaultSearchCacheTTL is how long web_search results are reused
+const defaultSearchCacheTTL = 10 * time.Minute
+
+// ToolCacheConfig configures the result cache of tools opted in with FunctionRegistry.SetCacheTTL
+type ToolCacheConfig struct {
+	// Scope results are shared across (default: session)
+	Scope ToolCacheScope
+	// CheckBudgetOnHit sends cache hits through Callback.BeforeAction/AfterAction like executed
+	// calls (event metadata "cache_hit": true). By default hits skip the budget check.
+	CheckBudgetOnHit bool
+	// MaxEntries bounds the number of cached results (default: 1000)
+	MaxEntries int
+}
+
+// toolResultCache holds results of cacheable tools keyed by scope, tool name and arguments
+type toolResultCache struct {
+	mu         sync.Mutex
+	entries    map[string]toolCacheEntry
+	maxEntries int
+}
+
+type toolCacheEntry struct {
+	result  string
+	sources []model.Citation // citations of a web search result
+	expires time.Time
+}
+
+func newToolResultCache(maxEntries int) *toolResultCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultToolCacheMaxEntries
+	}
+	return &toolResultCache{entries: make(map[string]toolCacheEntry), maxEntries: maxEntries}
+}
+
+// get returns the cached result (and its sources) for key if it has not expired
+func (c *toolResultCache) get(key string) (string, []model.Citation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return "", nil, false
+	}
+	return entry.result, entry.sources, true
+}
+
+// put caches result under key for ttl, evicting expired entries (then the oldest) when full
+func (c *toolResultCache) put(key, result string, sources []model.Citation, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+				continue
+			}
+			if oldestKey == "" || entry.expires.Before(oldest) {
+				oldestKey, oldest = k, entry.expires
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			delete(c.entries, oldestKey)
+		}
+	}
+	c.entries[key] = toolCacheEntry{result: result, sources: sources, expires: now.Add(ttl)}
+}
+
+// toolCacheKey returns the cache key of a tool call: the scope (session or user), the tool name
+// and the arguments with sorted keys and trimmed strings, so formatting differences still hit
+func toolCacheKey(scope ToolCacheScope, userID, sessionID string, toolCall openai.ToolCall) string {
+	owner := "s:" + sessionID
+	if scope == ToolCacheScopeUser || sessionID == "" {
+		owner = "u:" + userID
+	}
+	return owner + "\x00" + toolCall.Function.Name + "\x00" + normalizeToolArguments(toolCall.Function.Arguments)
+}
+
+// normalizeToolArguments re-encodes JSON arguments canonically (invalid JSON is only trimmed)
+func normalizeToolArguments(arguments string) string {
+	var args interface{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return strings.TrimSpace(arguments)
+	}
+	normalized, err := json.Marshal(trimStrings(args))
+	if err != nil {
+		return strings.TrimSpace(arguments)
+	}
+	return string(normalized)
+}
+
+// trimStrings trims the surrounding whitespace of every string in a decoded JSON value
+func trimStrings(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return strings.TrimSpace(val)
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = trimStrings(item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = trimStrings(item)
+		}
+	}
+	return v
+}
+
+// cachedToolResult answers a tool call from the cache: the call is saved with the cached result
+// and status "cache_hit", and only goes through the Callback when CheckBudgetOnHit is set.
+// The error is the one the call was saved with (the Callback's when it blocks the call).
+func (ch *CoreHandler) cachedToolResult(
+	ctx context.Context,
+	userID, sessionID string,
+	persister *ToolCallPersister,
+	toolID string,
+	toolCall openai.ToolCall,
+	toolDetail, result string,
+	sources []model.Citation,
+) (string, error) {
+	event := func() *UsageEvent {
+		return &UsageEvent{
+			UserID:    userID,
+			SessionID: sessionID,
+			EventType: EventToolCall,
+			Name:      toolCall.Function.Name,
+			Metadata:  map[string]interface{}{"cache_hit": true},
+		}
+	}
+	checkBudget := ch.config.ToolCache.CheckBudgetOnHit && ch.Callback != nil
+	if checkBudget {
+		if cbErr := ch.Callback.BeforeAction(ctx, event()); cbErr != nil {
+			blocked := FormatBlockedActionResult(cbErr)
+			persister.Update(toolID, blocked, cbErr)
+			return blocked, cbErr
+		}
+	}
+
+	ch.logger().Info("[CoreHandler] ♻️  Tool result served from cache", "name", toolCall.Function.Name, "user_id", userID, "session_id", sessionID)
+	if checkBudget {
+		ch.Callback.AfterAction(ctx, event())
+	}
+	notifyStatus(ctx, userID, sessionID, StatusToolDone, toolDetail)
+	persister.Update(toolID, result, nil)
+	persister.MarkCacheHit(toolID)
+	persister.SetSources(toolID, sources)
+	return result, nil
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+// budgetRecorder is a Callback that counts BeforeAction calls per tool
+type budgetRecorder struct {
+	mu     sync.Mutex
+	checks map[string]int
+}
+
+func (r *budgetRecorder) BeforeAction(_ context.Context, event *UsageEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if event.EventType == EventToolCall {
+		r.checks[event.Name]++
+	}
+	return nil
+}
+
+func (r *budgetRecorder) AfterAction(context.Context, *UsageEvent) {}
+
+func TestNormalizeToolArguments(t *testing.T) {
+	a := normalizeToolArguments(`{"query": "  go generics ", "limit": 5}`)
+	b := normalizeToolArguments(`{"limit":5,"query":"go generics"}`)
+	if a != b {
+		t.Errorf("Expected equivalent arguments to normalize alike: %s vs %s", a, b)
+	}
+	if normalizeToolArguments(`{"query":"go"}`) == a {
+		t.Error("Expected different arguments to normalize differently")
+	}
+}
+
+func TestCoreHandlerToolCache(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, DefaultCoreHandlerConfig())
+	recorder := &budgetRecorder{checks: make(map[string]int)}
+	ch.SetCallback(recorder)
+	coreSession, err := ch.getOrCreateCoreSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create core session: %v", err)
+	}
+
+	calls := map[string]int{}
+	register := func(name string) {
+		def := openai.FunctionDefinition{Name: name, Parameters: map[string]any{"type": "object"}}
+		ch.RegisterFunction(name, def, func(ctx context.Context, args map[string]any) (string, error) {
+			calls[name]++
+			return name + " result", nil
+		})
+	}
+	register("lookup")
+	register("append_note")
+	if err := ch.GetCoreTools().SetCacheTTL("lookup", time.Minute); err != nil {
+		t.Fatalf("SetCacheTTL failed: %v", err)
+	}
+
+	n := 0
+	run := func(name, args string) string {
+		n++
+		results, err := ch.executeCoreToolCalls(context.Background(), "user1", coreSession.SessionID, coreSession, "msg-1", []openai.ToolCall{{
+			ID: fmt.Sprintf("call_%d", n), Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: args},
+		}})
+		if err != nil {
+			t.Fatalf("executeCoreToolCalls failed: %v", err)
+		}
+		return results[0]
+	}
+
+	run("lookup", `{"query":"refunds"}`)
+	if result := run("lookup", `{ "query": " refunds " }`); result != "lookup result" {
+		t.Errorf("Expected the cached result, got %q", result)
+	}
+	run("lookup", `{"query":"invoices"}`)
+	run("append_note", `{"note":"a"}`)
+	run("append_note", `{"note":"a"}`)
+
+	if calls["lookup"] != 2 {
+		t.Errorf("Expected lookup to run twice (one cache hit), ran %d times", calls["lookup"])
+	}
+	if calls["append_note"] != 2 {
+		t.Errorf("Expected the uncached tool to run every time, ran %d times", calls["append_note"])
+	}
+	if recorder.checks["lookup"] != 2 {
+		t.Errorf("Expected the cache hit to skip the budget check, got %d checks", recorder.checks["lookup"])
+	}
+
+	saved, err := sqliteStore.GetToolCallsBySession(coreSession.SessionID)
+	if err != nil || len(saved) != 5 {
+		t.Fatalf("Expected 5 saved tool calls, got %d (%v)", len(saved), err)
+	}
+	if saved[1].Status != model.ToolCallStatusCacheHit || saved[1].Response != "lookup result" {
+		t.Errorf("Expected the second call saved as a cache hit, got %s %q", saved[1].Status, saved[1].Response)
+	}
+	if saved[0].Status != model.ToolCallStatusSuccess {
+		t.Errorf("Expected the first call saved as success, got %s", saved[0].Status)
+	}
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
@@ -39,27 +40,48 @@ type ToolCallStore interface {
 type ToolCallPersister struct {
 	store  ToolCallStore
 	logger string // prefix for log messages
+
+	maxContentBytes int    // truncates stored arguments and responses (see withMaxContentBytes)
+	mcpServer       string // recorded as ToolCall.MCPServer (see withMCPServer)
 }
 
 // NewToolCallPersister creates a new ToolCallPersister if the session store supports it.
 // Returns nil if the store doesn't implement ToolCallStore (logs a warning).
 func NewToolCallPersister(sessionStore model.SessionStore, logPrefix string) *ToolCallPersister {
 	if sessionStore == nil {
-		log.Log.Warnf("[%s] session store is nil; tool calls will not be saved to DB", logPrefix)
+		log.Log.Warn("[" + logPrefix + "] session store is nil; tool calls will not be saved to DB")
 		return nil
 	}
 	tcStore, ok := sessionStore.(ToolCallStore)
 	if !ok {
-		log.Log.Warnf("[%s] session store (type=%T) does not implement ToolCallStore; tool calls will not be saved to DB", logPrefix, sessionStore)
+		log.Log.Warn("["+logPrefix+"] session store does not implement ToolCallStore; tool calls will not be saved to DB", "store_type", fmt.Sprintf("%T", sessionStore))
 		return nil
 	}
-	log.Log.Debugf("[%s] ToolCallPersister created successfully for store type=%T", logPrefix, sessionStore)
+	log.Log.Debug("["+logPrefix+"] ToolCallPersister created successfully", "store_type", fmt.Sprintf("%T", sessionStore))
 	return &ToolCallPersister{
 		store:  tcStore,
 		logger: logPrefix,
 	}
 }
 
+// withMaxContentBytes makes p truncate the arguments and responses it stores to maxBytes
+// (see CoreHandlerConfig.MaxStoredContentBytes); nil-safe
+func (p *ToolCallPersister) withMaxContentBytes(maxBytes int) *ToolCallPersister {
+	if p != nil {
+		p.maxContentBytes = maxBytes
+	}
+	return p
+}
+
+// withMCPServer makes p record the tool calls it saves as served by the named MCP server
+// (none if server is empty); nil-safe
+func (p *ToolCallPersister) withMCPServer(server string) *ToolCallPersister {
+	if p != nil {
+		p.mcpServer = server
+	}
+	return p
+}
+
 // Save persists a tool call to the database and returns the generated ToolID.
 // Returns empty string if save fails (error is logged).
 func (p *ToolCallPersister) Save(
@@ -67,35 +89,7 @@ func (p *ToolCallPersister) Save(
 	messageID string,
 	toolCall openai.ToolCall,
 ) string {
-	if p == nil || p.store == nil {
-		return ""
-	}
-
-	now := time.Now()
-	toolID := session.GenerateToolID()
-	tc := &model.ToolCall{
-		ToolID:       toolID,
-		ToolCallID:   toolCall.ID,
-		MessageID:    messageID,
-		SessionID:    session.SessionID,
-		UserID:       session.UserID,
-		AgentType:    session.AgentType,
-		FunctionName: toolCall.Function.Name,
-		Arguments:    toolCall.Function.Arguments,
-		Response:     "",
-		Status:       model.ToolCallStatusPending,
-		CreatedAt:    now,
-		UpdatedAt:    now,
-	}
-
-	if err := p.store.PutToolCall(tc); err != nil {
-		log.Log.Warnf("[%s] ⚠️  Failed to save tool call | ToolID: %s | ToolCallID: %s | Error: %v",
-			p.logger, toolID, toolCall.ID, err)
-		return ""
-	}
-
-	log.Log.Infof("[%s] 🔧 Tool call saved | ToolID: %s | ToolCallID: %s | Function: %s",
-		p.logger, toolID, toolCall.ID, toolCall.Function.Name)
+	toolID, _ := p.save(session, messageID, toolCall, session.AgentType)
 	return toolID
 }
 
@@ -106,8 +100,19 @@ func (p *ToolCallPersister) SaveWithAgentType(
 	toolCall openai.ToolCall,
 	agentType model.AgentType,
 ) string {
+	toolID, _ := p.save(session, messageID, toolCall, agentType)
+	return toolID
+}
+
+// save persists a tool call and returns its ToolID, or "" and the (logged) store error
+func (p *ToolCallPersister) save(
+	session *model.Session,
+	messageID string,
+	toolCall openai.ToolCall,
+	agentType model.AgentType,
+) (string, error) {
 	if p == nil || p.store == nil {
-		return ""
+		return "", nil
 	}
 
 	now := time.Now()
@@ -120,22 +125,23 @@ func (p *ToolCallPersister) SaveWithAgentType(
 		UserID:       session.UserID,
 		AgentType:    agentType,
 		FunctionName: toolCall.Function.Name,
-		Arguments:    toolCall.Function.Arguments,
+		Arguments:    limitStoredContent(toolCall.Function.Arguments, p.maxContentBytes, p.logger, "arguments of "+toolID),
 		Response:     "",
 		Status:       model.ToolCallStatusPending,
+		MCPServer:    p.mcpServer,
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
 
 	if err := p.store.PutToolCall(tc); err != nil {
-		log.Log.Warnf("[%s] ⚠️  Failed to save tool call | ToolID: %s | ToolCallID: %s | Error: %v",
-			p.logger, toolID, toolCall.ID, err)
-		return ""
+		log.Log.Warn("["+p.logger+"] ⚠️  Failed to save tool call",
+			"tool_id", toolID, "tool_call_id", toolCall.ID, "error", err)
+		return "", err
 	}
 
-	log.Log.Infof("[%s] 🔧 Tool call saved | ToolID: %s | ToolCallID: %s | Function: %s",
-		p.logger, toolID, toolCall.ID, toolCall.Function.Name)
-	return toolID
+	log.Log.Info("["+p.logger+"] 🔧 Tool call saved",
+		"tool_id", toolID, "tool_call_id", toolCall.ID, "function", toolCall.Function.Name)
+	return toolID, nil
 }
 
 // Update updates the response for a tool call by ToolID.
@@ -146,19 +152,74 @@ func (p *ToolCallPersister) Update(toolID, response string, execErr error) {
 		return
 	}
 
+	response = limitStoredContent(response, p.maxContentBytes, p.logger, "response of "+toolID)
 	if err := p.store.UpdateToolCallResponse(toolID, response, execErr); err != nil {
-		log.Log.Warnf("[%s] ⚠️  Failed to update tool call response | ToolID: %s | Error: %v",
-			p.logger, toolID, err)
+		log.Log.Warn("["+p.logger+"] ⚠️  Failed to update tool call response",
+			"tool_id", toolID, "error", err)
 	} else {
 		if execErr != nil {
-			log.Log.Infof("[%s] ⚠️ Tool call failed, saved status | ToolID: %s | Err: %v", p.logger, toolID, execErr)
+			log.Log.Info("["+p.logger+"] ⚠️ Tool call failed, saved status", "tool_id", toolID, "error", execErr)
 		} else {
-			log.Log.Infof("[%s] ✅ Tool call response updated | ToolID: %s", p.logger, toolID)
+			log.Log.Info("["+p.logger+"] ✅ Tool call response updated", "tool_id", toolID)
 		}
 	}
 }
 
+// MarkCacheHit marks a tool call as answered from the tool result cache, if the store supports it.
+// Does nothing if toolID is empty.
+func (p *ToolCallPersister) MarkCacheHit(toolID string) {
+	if p == nil || p.store == nil || toolID == "" {
+		return
+	}
+	marker, ok := p.store.(interface{ MarkToolCallCacheHit(string) error })
+	if !ok {
+		return
+	}
+	if err := marker.MarkToolCallCacheHit(toolID); err != nil {
+		log.Log.Warn("["+p.logger+"] ⚠️  Failed to mark tool call as cache hit", "tool_id", toolID, "error", err)
+	}
+}
+
+// SetSources stores the citations of a web search tool call, if the store supports it.
+// Does nothing if toolID is empty or there are no sources.
+func (p *ToolCallPersister) SetSources(toolID string, sources []model.Citation) {
+	if p == nil || p.store == nil || toolID == "" || len(sources) == 0 {
+		return
+	}
+	setter, ok := p.store.(interface {
+		SetToolCallSources(string, []model.Citation) error
+	})
+	if !ok {
+		return
+	}
+	if err := setter.SetToolCallSources(toolID, sources); err != nil {
+		log.Log.Warn("["+p.logger+"] ⚠️  Failed to save tool call sources", "tool_id", toolID, "error", err)
+	}
+}
+
+// SetArgsValidation stores the outcome of checking the tool call's arguments, if the store
+// supports it. Does nothing if toolID is empty.
+func (p *ToolCallPersister) SetArgsValidation(toolID string, check *model.ToolArgsCheck) {
+	if p == nil || p.store == nil || toolID == "" || check == nil {
+		return
+	}
+	setter, ok := p.store.(interface {
+		SetToolCallArgsValidation(string, string, string) error
+	})
+	if !ok {
+		return
+	}
+	if err := setter.SetToolCallArgsValidation(toolID, check.Outcome, check.Detail()); err != nil {
+		log.Log.Warn("["+p.logger+"] ⚠️  Failed to save tool call argument validation", "tool_id", toolID, "error", err)
+	}
+}
+
 // IsAvailable returns true if the persister can save tool calls.
 func (p *ToolCallPersister) IsAvailable() bool {
 	return p != nil && p.store != nil
 }
+
+// toolCallPersister returns the engine's ToolCallPersister, nil if its store cannot save tool calls
+func (e *Engine) toolCallPersister() *ToolCallPersister {
+	return NewToolCallPersister(e.Sessions, "Engine").withMaxContentBytes(e.MaxStoredContentBytes)
+}
@@ -1,7 +1,9 @@
 package engine
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -403,3 +405,42 @@ func TestToolCallPersister_SaveSetsTimestamps(t *testing.T) {
 		t.Errorf("UpdatedAt not in expected range: %v", saved.UpdatedAt)
 	}
 }
+
+// TestExecuteToolRecordsMCPServer checks that calls of tools registered with RegisterMCPFunction
+// name their server in the tool call record, and calls of other tools do not.
+func TestExecuteToolRecordsMCPServer(t *testing.T) {
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	e := &Engine{Sessions: sqliteStore, Functions: model.NewFunctionRegistry()}
+	handler := func(ctx context.Context, args map[string]any) (string, error) { return "ok", nil }
+	if err := e.RegisterMCPFunction("tickets", "create_ticket", openai.FunctionDefinition{Name: "create_ticket"}, handler); err != nil {
+		t.Fatalf("RegisterMCPFunction failed: %v", err)
+	}
+	if err := e.RegisterFunction("get_time", openai.FunctionDefinition{Name: "get_time"}, handler); err != nil {
+		t.Fatalf("RegisterFunction failed: %v", err)
+	}
+
+	session := &model.Session{SessionID: "mcp-session", UserID: "user1", AgentType: model.AgentTypeHigh}
+	for i, name := range []string{"create_ticket", "get_time"} {
+		toolCall := openai.ToolCall{ID: fmt.Sprintf("call_%d", i), Function: openai.FunctionCall{Name: name, Arguments: "{}"}}
+		if _, err := e.executeTool(context.Background(), session, "msg-1", toolCall); err != nil {
+			t.Fatalf("executeTool(%s) failed: %v", name, err)
+		}
+	}
+
+	toolCalls, err := sqliteStore.GetToolCallsBySession("mcp-session")
+	if err != nil {
+		t.Fatalf("GetToolCallsBySession failed: %v", err)
+	}
+	servers := map[string]string{}
+	for _, tc := range toolCalls {
+		servers[tc.FunctionName] = tc.MCPServer
+	}
+	if len(servers) != 2 || servers["create_ticket"] != "tickets" || servers["get_time"] != "" {
+		t.Fatalf("Expected only create_ticket to be recorded as served by tickets, got %v", servers)
+	}
+}
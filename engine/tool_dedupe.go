@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"encoding/json"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// toolCallKey identifies a tool call by its function name and arguments. Arguments that are
+// valid JSON are re-encoded, so key order and whitespace do not make calls differ.
+func toolCallKey(toolCall openai.ToolCall) string {
+	args := toolCall.Function.Arguments
+	var v interface{}
+	if err := json.Unmarshal([]byte(args), &v); err == nil {
+		if normalized, err := json.Marshal(v); err == nil {
+			args = string(normalized)
+		}
+	}
+	return toolCall.Function.Name + "\x00" + args
+}
+
+// duplicateToolCalls returns, for each tool call, the index of the first identical call before
+// it, or -1 when it is the first of its kind
+func duplicateToolCalls(toolCalls []openai.ToolCall) []int {
+	duplicateOf := make([]int, len(toolCalls))
+	first := make(map[string]int, len(toolCalls))
+	for i, toolCall := range toolCalls {
+		key := toolCallKey(toolCall)
+		if j, ok := first[key]; ok {
+			duplicateOf[i] = j
+			log.Log.Info("[ToolDedupe] ♻️  Reusing tool result",
+				"function", toolCall.Function.Name, "tool_call_id", toolCall.ID, "of", toolCalls[j].ID)
+			continue
+		}
+		first[key] = i
+		duplicateOf[i] = -1
+	}
+	return duplicateOf
+}
+
+// saveDuplicateToolCall records a repeated tool call with the result it reused
+func (e *Engine) saveDuplicateToolCall(session *model.Session, messageID string, toolCall openai.ToolCall, result string) {
+	if persister := e.toolCallPersister(); persister != nil {
+		persister.Update(persister.Save(session, messageID, toolCall), result, nil)
+	}
+}
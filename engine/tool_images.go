@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// toolImagesMessage returns the user message showing the images returned by a turn's tool calls
+// to the model (none without images). Tool messages only carry text, so the images follow them
+// in a multimodal user message. Models not marked LLMConfig.Vision get no message.
+func (e *Engine) toolImagesMessage(sessionID string, images []model.ImageResult) []openai.ChatCompletionMessage {
+	if len(images) == 0 {
+		return nil
+	}
+	if !e.llmConfig.Vision {
+		e.logger().Warn("[Engine] 🖼️  Tool images dropped, the model is not vision-capable", "session_id", sessionID, "images", len(images))
+		return nil
+	}
+
+	parts := make([]openai.ChatMessagePart, 0, 2*len(images))
+	for _, image := range images {
+		label := fmt.Sprintf("Image returned by the %s tool call (%s).", image.ToolName, image.ToolCallID)
+		if image.Caption != "" {
+			label += " " + image.Caption
+		}
+		parts = append(parts,
+			openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: label},
+			openai.ChatMessagePart{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{
+				URL:    image.DataURL(),
+				Detail: openai.ImageURLDetailAuto,
+			}},
+		)
+	}
+	e.logger().Info("[Engine] 🖼️  Sending tool images to the model", "session_id", sessionID, "images", len(images))
+	return []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, MultiContent: parts}}
+}
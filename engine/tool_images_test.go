@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+// TestEngineToolImageResult verifies an image returned by a tool is sent to a vision-capable
+// model with the next request, and not to other models nor stored in the session
+func TestEngineToolImageResult(t *testing.T) {
+	// Fake chat completions endpoint: calls draw_chart, then reports the images it was shown
+	var mu sync.Mutex
+	var followUps []openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		choice := openai.ChatCompletionChoice{
+			Message: openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleAssistant,
+				ToolCalls: []openai.ToolCall{{
+					ID:       "call_1",
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: "draw_chart", Arguments: `{"metric":"sales"}`},
+				}},
+			},
+			FinishReason: openai.FinishReasonToolCalls,
+		}
+		if req.Messages[len(req.Messages)-1].Role != openai.ChatMessageRoleUser || len(req.Messages[len(req.Messages)-1].MultiContent) > 0 {
+			mu.Lock()
+			followUps = append(followUps, req)
+			mu.Unlock()
+			choice.Message = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Sales are growing."}
+			choice.FinishReason = openai.FinishReasonStop
+		}
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{choice}})
+	}))
+	defer server.Close()
+
+	chart := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	chart.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, chart); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	e := &Engine{Repo: repo, Sessions: sqliteStore, Functions: model.NewFunctionRegistry()}
+	if err := e.Init(); err != nil {
+		t.Fatalf("Failed to init engine: %v", err)
+	}
+	err = model.RegisterImage(e.Functions, "draw_chart", "", func(ctx context.Context, args map[string]interface{}) (string, *model.ImageResult, error) {
+		return "Chart of " + args["metric"].(string) + " drawn.", &model.ImageResult{Data: pngData.Bytes(), Caption: "Monthly sales."}, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterImage failed: %v", err)
+	}
+
+	for _, vision := range []bool{true, false} {
+		if err := e.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "test", Vision: vision}); err != nil {
+			t.Fatalf("UseLLMConfig failed: %v", err)
+		}
+		session, err := e.CreateSession("user1")
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		reply, _, err := e.ProcessMessage(context.Background(), session.SessionID, "How are sales doing this year?")
+		if err != nil || reply != "Sales are growing." {
+			t.Fatalf("Vision %v: unexpected reply %q (%v)", vision, reply, err)
+		}
+
+		mu.Lock()
+		req := followUps[len(followUps)-1]
+		mu.Unlock()
+		last := req.Messages[len(req.Messages)-1]
+		if !vision {
+			if last.Role != openai.ChatMessageRoleTool || last.Content != "Chart of sales drawn." {
+				t.Errorf("Expected the tool result last without vision, got %+v", last)
+			}
+			continue
+		}
+		// The image follows the tool result it belongs to
+		if previous := req.Messages[len(req.Messages)-2]; previous.Role != openai.ChatMessageRoleTool || previous.Content != "Chart of sales drawn." {
+			t.Errorf("Expected the tool result before the image, got %+v", previous)
+		}
+		if last.Role != openai.ChatMessageRoleUser || len(last.MultiContent) != 2 {
+			t.Fatalf("Expected a multimodal user message with the image, got %+v", last)
+		}
+		if text := last.MultiContent[0].Text; !strings.Contains(text, "draw_chart") || !strings.Contains(text, "call_1") || !strings.Contains(text, "Monthly sales.") {
+			t.Errorf("Unexpected image label %q", text)
+		}
+		if url := last.MultiContent[1].ImageURL; url == nil || !strings.HasPrefix(url.URL, "data:image/png;base64,iVBORw0KGgo") {
+			t.Errorf("Expected the PNG as a data URL, got %+v", url)
+		}
+
+		// The image is not kept in the session history
+		stored, err := sqliteStore.Get(session.SessionID)
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		for _, msg := range stored.Msgs {
+			if len(msg.MultiContent) > 0 {
+				t.Errorf("Expected no image in the stored history, got %+v", msg)
+			}
+		}
+	}
+
+	// Outside the engine images have nowhere to go
+	if model.AttachImage(context.Background(), model.ImageResult{Data: pngData.Bytes()}) {
+		t.Error("Expected AttachImage to fail without an image collector")
+	}
+}
@@ -0,0 +1,264 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Calculator returns the calculator tool. It evaluates arithmetic expressions with
+// + - * / % ^, parentheses, the constants pi and e and the functions sqrt, abs, floor,
+// ceil, round, ln and log10. Nothing else is evaluated.
+func Calculator() Tool {
+	return Tool{
+		Definition: openai.FunctionDefinition{
+			Name:        "calculator",
+			Description: "Evaluate an arithmetic expression exactly, e.g. '(12.5 * 3) / 4 + sqrt(16)'. Supports + - * / % ^, parentheses, pi, e, sqrt, abs, floor, ceil, round, ln, log10.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"expression": map[string]interface{}{
+						"type":        "string",
+						"description": "The expression to evaluate",
+					},
+				},
+				"required": []string{"expression"},
+			},
+		},
+		Func: func(args map[string]interface{}) (string, error) {
+			expr := stringArg(args, "expression")
+			if strings.TrimSpace(expr) == "" {
+				return "", fmt.Errorf("expression is required")
+			}
+			v, err := Evaluate(expr)
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatFloat(v, 'g', 15, 64), nil
+		},
+	}
+}
+
+// Evaluate evaluates an arithmetic expression (see Calculator)
+func Evaluate(expr string) (float64, error) {
+	p := &exprParser{src: expr}
+	v, err := p.parseSum()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.src[p.pos], p.pos+1)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return v, nil
+}
+
+// maxExprDepth bounds nesting so hostile input cannot exhaust the stack
+const maxExprDepth = 100
+
+// exprParser is a recursive descent parser over src:
+//
+//	sum     = product { ("+" | "-") product }
+//	product = power { ("*" | "/" | "%") power }
+//	power   = unary [ "^" power ]
+//	unary   = [ "-" | "+" ] unary | primary
+//	primary = number | constant | func "(" sum ")" | "(" sum ")"
+type exprParser struct {
+	src   string
+	pos   int
+	depth int
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, 0 at the end
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) parseSum() (float64, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch p.peek() {
+		case '+', '-':
+			op := p.src[p.pos]
+			p.pos++
+			right, err := p.parseProduct()
+			if err != nil {
+				return 0, err
+			}
+			if op == '+' {
+				left += right
+			} else {
+				left -= right
+			}
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *exprParser) parseProduct() (float64, error) {
+	left, err := p.parsePower()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch p.peek() {
+		case '*', '/', '%':
+			op := p.src[p.pos]
+			p.pos++
+			right, err := p.parsePower()
+			if err != nil {
+				return 0, err
+			}
+			switch op {
+			case '*':
+				left *= right
+			case '/':
+				if right == 0 {
+					return 0, fmt.Errorf("division by zero")
+				}
+				left /= right
+			case '%':
+				if right == 0 {
+					return 0, fmt.Errorf("division by zero")
+				}
+				left = math.Mod(left, right)
+			}
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePower() (float64, error) {
+	base, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+	exp, err := p.parsePower()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exp), nil
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExprDepth {
+		return 0, fmt.Errorf("expression is nested too deeply")
+	}
+
+	switch p.peek() {
+	case '-':
+		p.pos++
+		v, err := p.parseUnary()
+		return -v, err
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (float64, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return 0, fmt.Errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		v, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return v, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '.' || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+			p.pos++
+		}
+		// Exponent notation, e.g. 1.5e3
+		if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+			end := p.pos + 1
+			if end < len(p.src) && (p.src[end] == '+' || p.src[end] == '-') {
+				end++
+			}
+			if end < len(p.src) && p.src[end] >= '0' && p.src[end] <= '9' {
+				for end < len(p.src) && p.src[end] >= '0' && p.src[end] <= '9' {
+					end++
+				}
+				p.pos = end
+			}
+		}
+		v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return v, nil
+	case unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.src) && (unicode.IsLetter(rune(p.src[p.pos])) || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+			p.pos++
+		}
+		name := strings.ToLower(p.src[start:p.pos])
+		switch name {
+		case "pi":
+			return math.Pi, nil
+		case "e":
+			return math.E, nil
+		}
+		fn, ok := exprFuncs[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown identifier %q", name)
+		}
+		if p.peek() != '(' {
+			return 0, fmt.Errorf("%s needs an argument in parentheses", name)
+		}
+		v, err := p.parsePrimary()
+		if err != nil {
+			return 0, err
+		}
+		return fn(v), nil
+	}
+	return 0, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
+
+// exprFuncs are the functions the calculator supports
+var exprFuncs = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+	"ln":    math.Log,
+	"log10": math.Log10,
+}
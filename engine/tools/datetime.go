@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// now is the clock of the datetime tool (replaced in tests)
+var now = time.Now
+
+// dateTimeFormats are the named formats accepted by the datetime tool
+var dateTimeFormats = map[string]string{
+	"rfc3339":  time.RFC3339,
+	"date":     "2006-01-02",
+	"time":     "15:04:05",
+	"datetime": "2006-01-02 15:04:05",
+	"rfc1123":  time.RFC1123,
+}
+
+// DateTime returns the datetime tool: the current date and time in an IANA timezone
+// (default UTC), in a named format (rfc3339, date, time, datetime, rfc1123, unix) or a Go layout
+func DateTime() Tool {
+	return Tool{
+		Definition: openai.FunctionDefinition{
+			Name:        "datetime",
+			Description: "Get the current date and time, optionally in a timezone (IANA name such as 'Europe/Berlin', default UTC) and format (rfc3339 (default), date, time, datetime, rfc1123, unix).",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"timezone": map[string]interface{}{
+						"type":        "string",
+						"description": "IANA timezone name, e.g. 'Asia/Tehran' (default: UTC)",
+					},
+					"format": map[string]interface{}{
+						"type":        "string",
+						"description": "rfc3339, date, time, datetime, rfc1123 or unix (default: rfc3339)",
+					},
+				},
+			},
+		},
+		Func: func(args map[string]interface{}) (string, error) {
+			loc := time.UTC
+			if tz := strings.TrimSpace(stringArg(args, "timezone")); tz != "" {
+				l, err := time.LoadLocation(tz)
+				if err != nil {
+					return "", fmt.Errorf("unknown timezone %q", tz)
+				}
+				loc = l
+			}
+			t := now().In(loc)
+
+			format := strings.TrimSpace(stringArg(args, "format"))
+			switch {
+			case format == "":
+				format = time.RFC3339
+			case strings.EqualFold(format, "unix"):
+				return fmt.Sprintf("%d", t.Unix()), nil
+			default:
+				if layout, ok := dateTimeFormats[strings.ToLower(format)]; ok {
+					format = layout
+				}
+			}
+			return fmt.Sprintf("%s (%s, %s)", t.Format(format), t.Weekday(), loc), nil
+		},
+	}
+}
@@ -0,0 +1,260 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrURLNotAllowed is returned by fetch_url for URLs the allowlist/denylist or the
+// private address check reject
+var ErrURLNotAllowed = errors.New("url not allowed")
+
+// FetchOption configures the fetch_url tool
+type FetchOption func(*fetchOptions)
+
+type fetchOptions struct {
+	allowHosts   []string
+	denyHosts    []string
+	allowPrivate bool
+	maxBytes     int64
+	timeout      time.Duration
+	contentTypes []string
+}
+
+// OptFetchAllowHosts only lets fetch_url reach these hosts (and their subdomains)
+func OptFetchAllowHosts(hosts ...string) FetchOption {
+	return func(o *fetchOptions) { o.allowHosts = append(o.allowHosts, hosts...) }
+}
+
+// OptFetchDenyHosts keeps fetch_url away from these hosts (and their subdomains)
+func OptFetchDenyHosts(hosts ...string) FetchOption {
+	return func(o *fetchOptions) { o.denyHosts = append(o.denyHosts, hosts...) }
+}
+
+// OptFetchAllowPrivate lets fetch_url reach loopback, private and link-local addresses,
+// which are blocked by default to prevent SSRF against internal services
+func OptFetchAllowPrivate() FetchOption {
+	return func(o *fetchOptions) { o.allowPrivate = true }
+}
+
+// OptFetchMaxBytes sets how much of a response is read (default: 1 MB)
+func OptFetchMaxBytes(n int64) FetchOption {
+	return func(o *fetchOptions) { o.maxBytes = n }
+}
+
+// OptFetchTimeout bounds a fetch, redirects included (default: 15s)
+func OptFetchTimeout(d time.Duration) FetchOption {
+	return func(o *fetchOptions) { o.timeout = d }
+}
+
+// OptFetchContentTypes replaces the accepted media types (default: text/*, JSON and XML).
+// An entry ending in "/" accepts the whole type, e.g. "text/".
+func OptFetchContentTypes(types ...string) FetchOption {
+	return func(o *fetchOptions) { o.contentTypes = types }
+}
+
+// maxFetchRedirects is the number of redirects fetch_url follows
+const maxFetchRedirects = 5
+
+// FetchURL returns the fetch_url tool: a GET of an http(s) URL whose text is returned to the
+// model (HTML is reduced to its visible text). Loopback, private and link-local addresses are
+// refused unless OptFetchAllowPrivate is given; redirects are checked like the original URL.
+func FetchURL(opts ...FetchOption) Tool {
+	o := &fetchOptions{
+		maxBytes:     1 << 20,
+		timeout:      15 * time.Second,
+		contentTypes: []string{"text/", "application/json", "application/xml", "application/xhtml+xml"},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	dialer := &net.Dialer{Timeout: o.timeout}
+	if !o.allowPrivate {
+		// Checked on the resolved address at connect time, so DNS cannot point around it
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+				return fmt.Errorf("%w: %s is an internal address", ErrURLNotAllowed, host)
+			}
+			return nil
+		}
+	}
+	client := &http.Client{
+		Timeout:   o.timeout,
+		Transport: &http.Transport{Proxy: nil, DialContext: dialer.DialContext, TLSHandshakeTimeout: o.timeout},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+			}
+			return o.checkURL(req.URL)
+		},
+	}
+
+	fetch := func(ctx context.Context, args map[string]interface{}) (string, error) {
+		raw := strings.TrimSpace(stringArg(args, "url"))
+		if raw == "" {
+			return "", fmt.Errorf("url is required")
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid url: %w", err)
+		}
+		if err := o.checkURL(u); err != nil {
+			return "", err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", fmt.Errorf("invalid url: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("fetch failed: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return "", fmt.Errorf("fetch failed: HTTP %d", resp.StatusCode)
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if !o.acceptsContentType(mediaType) {
+			return "", fmt.Errorf("unsupported content type %q", mediaType)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, o.maxBytes+1))
+		if err != nil {
+			return "", fmt.Errorf("failed to read response: %w", err)
+		}
+		truncated := int64(len(body)) > o.maxBytes
+		if truncated {
+			body = body[:o.maxBytes]
+		}
+
+		text := string(body)
+		if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+			text = HTMLToText(text)
+		}
+		if truncated {
+			text += "\n... [truncated]"
+		}
+		return text, nil
+	}
+
+	return Tool{
+		Definition: openai.FunctionDefinition{
+			Name:        "fetch_url",
+			Description: "Fetch a web page or text document with an HTTP GET and return its text content (HTML is converted to plain text).",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"url": map[string]interface{}{
+						"type":        "string",
+						"description": "The http:// or https:// URL to fetch",
+					},
+				},
+				"required": []string{"url"},
+			},
+		},
+		Func: func(args map[string]interface{}) (string, error) {
+			return fetch(context.Background(), args)
+		},
+		ContextFunc: fetch,
+	}
+}
+
+// checkURL applies the scheme, allowlist, denylist and literal IP checks to u
+func (o *fetchOptions) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: only http and https URLs can be fetched", ErrURLNotAllowed)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("%w: url has no host", ErrURLNotAllowed)
+	}
+	if len(o.allowHosts) > 0 && !matchesHost(host, o.allowHosts) {
+		return fmt.Errorf("%w: %s is not in the allowlist", ErrURLNotAllowed, host)
+	}
+	if matchesHost(host, o.denyHosts) {
+		return fmt.Errorf("%w: %s is denied", ErrURLNotAllowed, host)
+	}
+	if !o.allowPrivate {
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return fmt.Errorf("%w: %s is an internal address", ErrURLNotAllowed, host)
+		}
+		if ip := net.ParseIP(host); ip != nil && isInternalIP(ip) {
+			return fmt.Errorf("%w: %s is an internal address", ErrURLNotAllowed, host)
+		}
+	}
+	return nil
+}
+
+// acceptsContentType reports whether mediaType is one of the accepted content types
+func (o *fetchOptions) acceptsContentType(mediaType string) bool {
+	for _, t := range o.contentTypes {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesHost reports whether host is one of hosts or a subdomain of one
+func matchesHost(host string, hosts []string) bool {
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimPrefix(h, "."))
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInternalIP reports whether ip is loopback, private, link-local, unspecified or multicast
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+var (
+	htmlHiddenRe  = regexp.MustCompile(`(?is)<(script|style|noscript|template|head)\b.*?</(script|style|noscript|template|head)\s*>`)
+	htmlCommentRe = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlBlockRe   = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/h[1-6]|/li|/tr|/section|/article|/header|/footer|/blockquote|/pre|hr)\b[^>]*>`)
+	htmlTagRe     = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRe       = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLinesRe  = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// HTMLToText reduces an HTML document to its visible text: scripts, styles and tags are removed,
+// block elements become line breaks, entities are decoded and whitespace is collapsed
+func HTMLToText(doc string) string {
+	doc = htmlHiddenRe.ReplaceAllString(doc, " ")
+	doc = htmlCommentRe.ReplaceAllString(doc, " ")
+	doc = htmlBlockRe.ReplaceAllString(doc, "\n")
+	doc = htmlTagRe.ReplaceAllString(doc, " ")
+	doc = html.UnescapeString(doc)
+	doc = spaceRe.ReplaceAllString(doc, " ")
+
+	lines := strings.Split(doc, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	doc = strings.Join(lines, "\n")
+	doc = blankLinesRe.ReplaceAllString(doc, "\n\n")
+	return strings.TrimSpace(doc)
+}
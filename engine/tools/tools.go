@@ -0,0 +1,47 @@
+// Package tools provides ready-made utility tools (calculator, datetime, fetch_url) that can be
+// registered on an Engine, a CoreHandler or an Agentize instance with one call:
+//
+//	err := tools.Register(eng, tools.Calculator(), tools.DateTime(), tools.FetchURL())
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Tool is a ready-made tool: its definition for the model and its implementation
+type Tool struct {
+	Definition openai.FunctionDefinition
+	Func       model.ToolFunction
+	// ContextFunc, if set, is used by Register instead of Func so the tool stops with the message
+	ContextFunc model.ContextToolFunction
+}
+
+// Registrar is anything tools can be registered on (engine.Engine, engine.CoreHandler, agentize.Agentize)
+type Registrar interface {
+	RegisterFunction(name string, def openai.FunctionDefinition, handler func(ctx context.Context, args map[string]any) (string, error)) error
+}
+
+// Register registers every tool on r, stopping at the first error
+func Register(r Registrar, tools ...Tool) error {
+	for _, tool := range tools {
+		handler := tool.ContextFunc
+		if handler == nil {
+			fn := tool.Func
+			handler = func(_ context.Context, args map[string]interface{}) (string, error) { return fn(args) }
+		}
+		if err := r.RegisterFunction(tool.Definition.Name, tool.Definition, handler); err != nil {
+			return fmt.Errorf("failed to register %s: %w", tool.Definition.Name, err)
+		}
+	}
+	return nil
+}
+
+// stringArg returns a string argument, or "" if it is missing or not a string
+func stringArg(args map[string]interface{}, key string) string {
+	s, _ := args[key].(string)
+	return s
+}
@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/engine"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Engine and CoreHandler both accept ready-made tools
+var (
+	_ Registrar = (*engine.Engine)(nil)
+	_ Registrar = (*engine.CoreHandler)(nil)
+)
+
+func TestEvaluate(t *testing.T) {
+	cases := map[string]float64{
+		"1 + 2 * 3":          7,
+		"(1 + 2) * 3":        9,
+		"2 ^ 3 ^ 2":          512,
+		"-2 ^ 2":             4,
+		"10 % 4 + sqrt(16)":  6,
+		"1.5e3 / 3":          500,
+		"round(pi * 100)":    314,
+		"abs(-3) - floor(e)": 1,
+	}
+	for expr, want := range cases {
+		if got, err := Evaluate(expr); err != nil || got != want {
+			t.Errorf("Evaluate(%q) = %v, %v; want %v", expr, got, err, want)
+		}
+	}
+	for _, expr := range []string{"", "1 +", "1 / 0", "os.Exit(1)", "(1", "2 3", strings.Repeat("(", 500) + "1"} {
+		if _, err := Evaluate(expr); err == nil {
+			t.Errorf("Evaluate(%q) should fail", expr)
+		}
+	}
+}
+
+func TestDateTime(t *testing.T) {
+	now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	tool := DateTime()
+	got, err := tool.Func(map[string]interface{}{"timezone": "Asia/Tokyo", "format": "datetime"})
+	if err != nil || got != "2026-03-01 21:00:00 (Sunday, Asia/Tokyo)" {
+		t.Fatalf("Unexpected datetime result: %q, %v", got, err)
+	}
+	if got, _ := tool.Func(map[string]interface{}{"format": "unix"}); got != "1772366400" {
+		t.Errorf("Unexpected unix time: %q", got)
+	}
+	if _, err := tool.Func(map[string]interface{}{"timezone": "Mars/Olympus"}); err == nil {
+		t.Error("Expected an unknown timezone to fail")
+	}
+}
+
+func TestFetchURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><title>T</title><script>alert(1)</script></head><body><h1>Hello</h1><p>Fish &amp; chips</p></body></html>`))
+		case "/binary":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0, 1, 2})
+		case "/redirect":
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	// Internal addresses are refused by default, including the test server itself
+	if _, err := FetchURL().ContextFunc(ctx, map[string]interface{}{"url": server.URL + "/page"}); !errors.Is(err, ErrURLNotAllowed) {
+		t.Fatalf("Expected loopback to be refused, got %v", err)
+	}
+	for _, u := range []string{"http://localhost/", "http://10.0.0.1/", "http://[::1]/", "file:///etc/passwd"} {
+		if _, err := FetchURL().ContextFunc(ctx, map[string]interface{}{"url": u}); !errors.Is(err, ErrURLNotAllowed) {
+			t.Errorf("Expected %s to be refused, got %v", u, err)
+		}
+	}
+	if _, err := FetchURL(OptFetchAllowHosts("example.com")).ContextFunc(ctx, map[string]interface{}{"url": "https://evil.com/"}); !errors.Is(err, ErrURLNotAllowed) {
+		t.Errorf("Expected a host outside the allowlist to be refused, got %v", err)
+	}
+	if _, err := FetchURL(OptFetchDenyHosts("example.com")).ContextFunc(ctx, map[string]interface{}{"url": "https://api.example.com/"}); !errors.Is(err, ErrURLNotAllowed) {
+		t.Errorf("Expected a denied subdomain to be refused, got %v", err)
+	}
+
+	fetch := FetchURL(OptFetchAllowPrivate(), OptFetchMaxBytes(1000))
+	got, err := fetch.ContextFunc(ctx, map[string]interface{}{"url": server.URL + "/page"})
+	if err != nil || got != "Hello\nFish & chips" {
+		t.Fatalf("Unexpected page text: %q, %v", got, err)
+	}
+	if _, err := fetch.ContextFunc(ctx, map[string]interface{}{"url": server.URL + "/binary"}); err == nil || !strings.Contains(err.Error(), "content type") {
+		t.Errorf("Expected binary content to be refused, got %v", err)
+	}
+
+	// Redirects are checked like the original URL
+	guarded := FetchURL(OptFetchAllowHosts("127.0.0.1"), OptFetchAllowPrivate(), OptFetchTimeout(2*time.Second))
+	if _, err := guarded.ContextFunc(ctx, map[string]interface{}{"url": server.URL + "/redirect"}); !errors.Is(err, ErrURLNotAllowed) {
+		t.Errorf("Expected a redirect outside the allowlist to be refused, got %v", err)
+	}
+}
+
+type fakeRegistrar map[string]openai.FunctionDefinition
+
+func (f fakeRegistrar) RegisterFunction(name string, def openai.FunctionDefinition, _ func(ctx context.Context, args map[string]any) (string, error)) error {
+	f[name] = def
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	r := fakeRegistrar{}
+	if err := Register(r, Calculator(), DateTime(), FetchURL()); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	for _, name := range []string{"calculator", "datetime", "fetch_url"} {
+		if r[name].Description == "" {
+			t.Errorf("Tool %s not registered with its definition", name)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package engine
 import (
 	"context"
 	_ "embed"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -28,6 +27,24 @@ var schedulerOnce sync.Once
 var schedulerOnceMap = make(map[store.SessionStore]*sync.Once)
 var schedulerOnceMapMu sync.Mutex
 
+// Per-session locks shared by every Engine on a session store, so one session is processed
+// by one caller at a time even when several engines (e.g. the Agentize engine and the
+// CoreHandler's UserAgents) serve the same store. An entry only lives while its session is
+// locked or waited for, so the map does not grow with every session ever processed.
+var sessionLocks = make(map[sessionLockKey]*sessionLock)
+var sessionLocksMu sync.Mutex
+
+// sessionLockKey identifies a session of a store (of an engine when it has no store)
+type sessionLockKey struct {
+	owner     any
+	sessionID string
+}
+
+type sessionLock struct {
+	mu   sync.Mutex
+	refs int // holders and waiters
+}
+
 // LLMConfig holds configuration for LLM client
 type LLMConfig struct {
 	APIKey     string
@@ -38,6 +55,16 @@ type LLMConfig struct {
 	// Tool result truncation settings
 	MaxToolResultLength int    // Max chars before truncating (default: 250)
 	CollectResultModel  string // LLM model for collect_result tool (default: same as Model)
+	// HTTPToolMaxResponseBytes caps the response of tools with an http block (default: 16384)
+	HTTPToolMaxResponseBytes int
+	// HTTPToolEnvPrefix is the prefix of the environment variables http tool headers may
+	// reference (default: DefaultHTTPToolEnvPrefix); others expand to an empty string
+	HTTPToolEnvPrefix string
+	// HTTPToolSecrets are values for $NAME in http tool headers, looked up before the environment
+	HTTPToolSecrets map[string]string
+	// ToolTimeout bounds each tool call (default: 2 minutes, negative: no timeout).
+	// Overridden per tool with Engine.SetToolTimeout.
+	ToolTimeout time.Duration
 
 	// BackupProviders is a chain of backup LLM providers tried in order BEFORE the
 	// default OpenAI client. Each entry pairs a Provider with a Model name.
@@ -48,10 +75,92 @@ type LLMConfig struct {
 	// BackupDisabled if true, skips all backup providers and goes straight to the default LLM.
 	BackupDisabled bool
 
+	// QuotaExceededMessage is the answer when Callback.BeforeAction blocks an LLM call
+	// (e.g. the user's balance is exhausted). Default: the callback's error message.
+	QuotaExceededMessage string
+
 	// SchedulerDisableLogs if true, SessionScheduler does not emit any logs (overrides config from env)
 	SchedulerDisableLogs bool
 	// SummaryModel overrides the scheduler summarization model (from config/env) when non-empty
 	SummaryModel string
+
+	// NodeOverrideStrategy controls how llm overrides of opened nodes combine (default: override, deeper node wins)
+	NodeOverrideStrategy model.MergeStrategy
+	// ToolMergeStrategy controls how tools of the nodes from the root to the current node combine (default: override)
+	ToolMergeStrategy model.MergeStrategy
+
+	// ResponseFormat asks the model for JSON answers (default: plain text). An invalid answer is
+	// sent back once for correction. Overridden per request with WithResponseFormat.
+	ResponseFormat *ResponseFormat
+
+	// EnablePromptCaching marks the stable start of the system prompts (the base prompt, or the
+	// Core controller and tools prompts) as cacheable with an Anthropic-style cache_control
+	// breakpoint, for providers that only cache marked prefixes. Cached prompt tokens are logged
+	// either way.
+	EnablePromptCaching bool
+
+	// Vision marks Model as able to read images: images returned by tools (see model.ImageResult)
+	// are sent to it with the next request. Without it they are dropped.
+	Vision bool
+}
+
+// Inherit returns c with its unset fields taken from defaults, so the config of one agent only
+// needs what differs from the shared one. A config with its own BaseURL talks to another
+// provider: it keeps its own (possibly empty) APIKey, HTTPClient and BackupProviders.
+func (c LLMConfig) Inherit(defaults LLMConfig) LLMConfig {
+	if c.BaseURL == "" {
+		c.BaseURL = defaults.BaseURL
+		if c.APIKey == "" {
+			c.APIKey = defaults.APIKey
+		}
+		if c.HTTPClient == nil {
+			c.HTTPClient = defaults.HTTPClient
+		}
+		if c.BackupProviders == nil {
+			c.BackupProviders = defaults.BackupProviders
+		}
+	}
+	if c.Model == "" {
+		c.Model = defaults.Model
+		c.Vision = c.Vision || defaults.Vision
+	}
+	if c.MaxToolResultLength == 0 {
+		c.MaxToolResultLength = defaults.MaxToolResultLength
+	}
+	if c.CollectResultModel == "" {
+		c.CollectResultModel = defaults.CollectResultModel
+	}
+	if c.HTTPToolMaxResponseBytes == 0 {
+		c.HTTPToolMaxResponseBytes = defaults.HTTPToolMaxResponseBytes
+	}
+	if c.HTTPToolEnvPrefix == "" {
+		c.HTTPToolEnvPrefix = defaults.HTTPToolEnvPrefix
+	}
+	if c.HTTPToolSecrets == nil {
+		c.HTTPToolSecrets = defaults.HTTPToolSecrets
+	}
+	if c.ToolTimeout == 0 {
+		c.ToolTimeout = defaults.ToolTimeout
+	}
+	c.BackupDisabled = c.BackupDisabled || defaults.BackupDisabled
+	if c.QuotaExceededMessage == "" {
+		c.QuotaExceededMessage = defaults.QuotaExceededMessage
+	}
+	c.SchedulerDisableLogs = c.SchedulerDisableLogs || defaults.SchedulerDisableLogs
+	if c.SummaryModel == "" {
+		c.SummaryModel = defaults.SummaryModel
+	}
+	if c.NodeOverrideStrategy == "" {
+		c.NodeOverrideStrategy = defaults.NodeOverrideStrategy
+	}
+	if c.ToolMergeStrategy == "" {
+		c.ToolMergeStrategy = defaults.ToolMergeStrategy
+	}
+	if c.ResponseFormat == nil {
+		c.ResponseFormat = defaults.ResponseFormat
+	}
+	c.EnablePromptCaching = c.EnablePromptCaching || defaults.EnablePromptCaching
+	return c
 }
 
 // ToolExecutor executes a tool call and returns the result
@@ -75,12 +184,6 @@ type Engine struct {
 	scheduler   *SessionScheduler
 	schedulerMu sync.RWMutex
 
-	// Per-session mutex for serializing message processing
-	// Ensures only one message is processed at a time per session to prevent
-	// race conditions on sequence number generation and session updates
-	sessionMutexes   map[string]*sync.Mutex
-	sessionMutexesMu sync.RWMutex
-
 	// Per-session progress + queue: check before locking so we can return immediately
 	// when already in progress and queue the message instead of blocking
 	sessionProgress *ProgressGuard
@@ -90,6 +193,71 @@ type Engine struct {
 
 	// Callback for billing/usage metering (optional, set by application)
 	Callback Callback
+
+	// Recording and replay of LLM calls (see UseRecording and UseReplay)
+	llmRecords LLMRecordStore
+	replay     *ReplayClient
+
+	// CostTable prices this engine's LLM calls (see CoreHandlerConfig.CostTable)
+	CostTable CostTable
+
+	// DedupeToolCalls reuses the result of a tool call repeated within one LLM response
+	// (see CoreHandlerConfig.DedupeToolCalls)
+	DedupeToolCalls bool
+
+	// SkipToolArgValidation turns off checking tool call arguments against the tool's input
+	// schema (see CoreHandlerConfig.SkipToolArgValidation)
+	SkipToolArgValidation bool
+
+	// FailFastOnPersistError aborts a turn when a save fails (see CoreHandlerConfig.FailFastOnPersistError)
+	FailFastOnPersistError bool
+
+	// MaxStoredContentBytes truncates stored message contents and tool call arguments and
+	// responses (see CoreHandlerConfig.MaxStoredContentBytes). 0 means no limit.
+	MaxStoredContentBytes int
+
+	// Logger receives the engine's logs (see CoreHandlerConfig.Logger). nil logs to log.Log.
+	Logger log.FieldLogger
+
+	// MaxActiveMessages and MaxActiveTokens bound the session's active messages before each
+	// LLM request (see CoreHandlerConfig.MaxActiveMessages). 0 means no limit.
+	MaxActiveMessages int
+	MaxActiveTokens   int
+
+	// MaxSessionMessages caps the messages the session keeps when it is saved
+	// (see CoreHandlerConfig.MaxSessionMessages). 0 means no limit.
+	MaxSessionMessages int
+
+	// Token quotas of the CoreHandler this engine serves (see CoreHandlerConfig.QuotaPolicy)
+	quota *quotaGuard
+
+	// Template variables and parsed node.md templates (see SetTemplateVars)
+	templates nodeTemplates
+
+	// Specs of the http tools whose built-in handler is registered (see RegisterHTTPTools)
+	httpTools   map[string]model.HTTPTool
+	httpToolsMu sync.Mutex
+
+	// Sessions whose on_enter action is running, so moves it makes don't chain (see enterNode)
+	enteringSessions sync.Map
+
+	// Resolves a user's auth groups (optional, see SetGroupResolver)
+	groupResolver GroupResolver
+
+	// Tried before the model in llm routing (optional, see SetSemanticRouter)
+	semanticRouter *SemanticRouter
+
+	// Init fails on tools declared in the knowledge tree without a handler (see SetStrictTools)
+	strictTools bool
+
+	// Tools of this engine only, even when its function registry is shared (see addLocalTool)
+	localTools   map[string]localTool
+	localToolsMu sync.RWMutex
+}
+
+// logger returns the engine's logger (see Engine.Logger)
+func (e *Engine) logger() log.FieldLogger {
+	return log.Or(e.Logger)
 }
 
 // Init initializes the engine by loading the root node and verifying Sessions store is ready.
@@ -98,10 +266,6 @@ func (e *Engine) Init() error {
 	e.dbReadyMu.Lock()
 	defer e.dbReadyMu.Unlock()
 
-	// Initialize session mutexes map if nil
-	if e.sessionMutexes == nil {
-		e.sessionMutexes = make(map[string]*sync.Mutex)
-	}
 	if e.sessionProgress == nil {
 		e.sessionProgress = NewProgressGuard()
 	}
@@ -126,40 +290,56 @@ func (e *Engine) Init() error {
 		return fmt.Errorf("failed to initialize engine: Sessions store not ready - %w", err)
 	}
 
+	if err := e.RegisterHTTPTools(); err != nil {
+		e.dbReady = false
+		return fmt.Errorf("failed to initialize engine: %w", err)
+	}
+	if err := e.VerifyTools(e.strictTools); err != nil {
+		e.dbReady = false
+		return fmt.Errorf("failed to initialize engine: %w", err)
+	}
+
 	e.dbReady = true
-	log.Log.Infof("[Engine] ✅ Database initialized and ready (Repo + Sessions)")
+	e.logger().Info("[Engine] ✅ Database initialized and ready (Repo + Sessions)")
 	return nil
 }
 
-// getSessionMutex returns or creates a mutex for a specific session
-// This ensures only one message is processed at a time per session
-func (e *Engine) getSessionMutex(sessionID string) *sync.Mutex {
-	// First try with read lock (fast path for existing mutexes)
-	e.sessionMutexesMu.RLock()
-	if e.sessionMutexes != nil {
-		if mu, exists := e.sessionMutexes[sessionID]; exists {
-			e.sessionMutexesMu.RUnlock()
-			return mu
-		}
-	}
-	e.sessionMutexesMu.RUnlock()
-
-	// Need to create new mutex, acquire write lock
-	e.sessionMutexesMu.Lock()
-	defer e.sessionMutexesMu.Unlock()
-
-	// Double-check after acquiring write lock
-	if e.sessionMutexes == nil {
-		e.sessionMutexes = make(map[string]*sync.Mutex)
+// lockSession locks sessionID and returns the function unlocking it.
+// This ensures only one message is processed at a time per session, across all
+// engines sharing the Sessions store.
+func (e *Engine) lockSession(sessionID string) (unlock func()) {
+	lock, release := e.acquireSessionLock(sessionID)
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		release()
 	}
+}
 
-	if mu, exists := e.sessionMutexes[sessionID]; exists {
-		return mu
+// acquireSessionLock returns the lock of sessionID, created if needed, and the function to call
+// once the caller no longer holds nor waits for it; the last release drops the lock
+func (e *Engine) acquireSessionLock(sessionID string) (*sessionLock, func()) {
+	var owner any = e.Sessions
+	if e.Sessions == nil {
+		owner = e
+	}
+	key := sessionLockKey{owner: owner, sessionID: sessionID}
+
+	sessionLocksMu.Lock()
+	defer sessionLocksMu.Unlock()
+	lock, exists := sessionLocks[key]
+	if !exists {
+		lock = &sessionLock{}
+		sessionLocks[key] = lock
+	}
+	lock.refs++
+	return lock, func() {
+		sessionLocksMu.Lock()
+		defer sessionLocksMu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(sessionLocks, key)
+		}
 	}
-
-	mu := &sync.Mutex{}
-	e.sessionMutexes[sessionID] = mu
-	return mu
 }
 
 // IsDBReady returns whether the database is ready
@@ -175,6 +355,10 @@ func (e *Engine) UseFunctionRegistry(registry *model.FunctionRegistry) {
 		registry = model.NewFunctionRegistry()
 	}
 	e.Functions = registry
+	// The built-in handlers of http tools live in the previous registry
+	e.httpToolsMu.Lock()
+	e.httpTools = nil
+	e.httpToolsMu.Unlock()
 }
 
 // UseLLMConfig configures the LLM client for the engine
@@ -188,6 +372,7 @@ func (e *Engine) UseLLMConfig(config LLMConfig) error {
 	if config.HTTPClient != nil {
 		openaiConfig.HTTPClient = config.HTTPClient
 	}
+	openaiConfig = withPromptCaching(openaiConfig, config)
 
 	client := openai.NewClientWithConfig(openaiConfig)
 	e.llmClient = client
@@ -217,7 +402,7 @@ func (e *Engine) UseLLMConfig(config LLMConfig) error {
 				if e.scheduler == nil {
 					e.schedulerMu.Unlock()
 					if err := e.startScheduler(ctx, client); err != nil {
-						log.Log.Warnf("[Engine] ⚠️  Failed to start scheduler: %v", err)
+						e.logger().Warn("[Engine] ⚠️  Failed to start scheduler", "error", err)
 					}
 				} else {
 					e.schedulerMu.Unlock()
@@ -229,18 +414,58 @@ func (e *Engine) UseLLMConfig(config LLMConfig) error {
 	return nil
 }
 
+// UseRecording records every successful LLM call of the engine (request and response) to store,
+// so the conversation can later be replayed with UseReplay. A nil store stops recording.
+func (e *Engine) UseRecording(store LLMRecordStore) {
+	e.llmRecords = store
+}
+
+// UseReplay serves the engine's LLM calls from the responses recorded in store instead of calling
+// the model or the backup providers. Calls whose request was not recorded fail with ErrReplayMiss.
+// A nil store turns replay off.
+func (e *Engine) UseReplay(store LLMRecordStore) {
+	if store == nil {
+		e.replay = nil
+		return
+	}
+	e.replay = NewReplayClient(store)
+}
+
 const backupCooldownDuration = 1 * time.Second
 
 // callLLM tries the backup LLM providers in order (if configured and not disabled), then falls back
 // to the default OpenAI client. This is the single entry point for all LLM calls
 // in the Engine, ensuring consistent fallback behaviour.
 func (e *Engine) callLLM(ctx context.Context, model string, messages []openai.ChatCompletionMessage, tools []openai.Tool) (openai.ChatCompletionResponse, error) {
+	return e.callLLMRequest(ctx, openai.ChatCompletionRequest{Model: model, Messages: messages, Tools: tools})
+}
+
+// callLLMRequest is callLLM with full request parameters (temperature, max tokens).
+// Backup providers only receive the messages and tools.
+func (e *Engine) callLLMRequest(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if e.replay != nil {
+		return e.replay.CreateChatCompletion(ctx, request)
+	}
+	resp, err := e.callLLMProvider(ctx, request)
+	if err == nil && e.llmRecords != nil {
+		recordLLMCall(e.llmRecords, request, resp, "Engine")
+	}
+	return resp, err
+}
+
+// callLLMProvider sends request to the backup providers or the default OpenAI client
+func (e *Engine) callLLMProvider(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	model, messages, tools := request.Model, request.Messages, request.Tools
+
 	// Try backup providers chain first (only if not disabled)
 	if !e.llmConfig.BackupDisabled {
 		if resp, ok := e.backups.tryBackup(ctx, messages, tools, "Engine"); ok {
 			return resp, nil
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
 
 	// Default: OpenAI client
 	systemPromptLen := 0
@@ -249,20 +474,20 @@ func (e *Engine) callLLM(ctx context.Context, model string, messages []openai.Ch
 			systemPromptLen += len(m.Content)
 		}
 	}
-	log.Log.Infof("[Engine] 🔵 DEFAULT LLM >> Using OpenAI | Model: %s | Messages: %d | Tools: %d | system_prompt_len=%d", model, len(messages), len(tools), systemPromptLen)
-	request := openai.ChatCompletionRequest{
-		Model:    model,
-		Messages: messages,
-		Tools:    tools,
-	}
+	e.logger().Info("[Engine] 🔵 DEFAULT LLM >> Using OpenAI", "model", model, "messages", len(messages), "tools", len(tools), "system_prompt_len", systemPromptLen)
 	resp, err := e.llmClient.CreateChatCompletion(ctx, request)
 	if err == nil && resp.Usage.TotalTokens > 0 {
-		cacheTokens := 0
+		cacheTokens, reasoningTokens := 0, 0
 		if resp.Usage.PromptTokensDetails != nil {
 			cacheTokens = resp.Usage.PromptTokensDetails.CachedTokens
 		}
-		log.Log.Infof("[Engine] 📊 TOKEN USAGE >> Model: %s | prompt=%d | completion=%d | total=%d | cache=%d (input=prompt, output=completion, total=total, cache=cache)",
-			model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens, cacheTokens)
+		if resp.Usage.CompletionTokensDetails != nil {
+			reasoningTokens = resp.Usage.CompletionTokensDetails.ReasoningTokens
+		}
+		e.logger().Info("[Engine] 📊 TOKEN USAGE",
+			"model", model, "prompt_tokens", resp.Usage.PromptTokens, "completion_tokens", resp.Usage.CompletionTokens,
+			"total_tokens", resp.Usage.TotalTokens, "cache_tokens", cacheTokens, "reasoning_tokens", reasoningTokens)
+		logPromptCache(e.logger(), "Engine", model, resp.Usage, e.llmConfig.EnablePromptCaching)
 	}
 	return resp, err
 }
@@ -273,7 +498,7 @@ func (e *Engine) startScheduler(ctx context.Context, llmClient *openai.Client) e
 	cfg, err := config.Load()
 	var schedulerConfig config.SchedulerConfig
 	if err != nil {
-		log.Log.Warnf("[Engine] ⚠️  Failed to load config, using defaults: %v", err)
+		e.logger().Warn("[Engine] ⚠️  Failed to load config, using defaults", "error", err)
 		// Use default config (enabled by default)
 		schedulerConfig = config.SchedulerConfig{
 			Enabled:                     true, // Enabled by default
@@ -289,7 +514,7 @@ func (e *Engine) startScheduler(ctx context.Context, llmClient *openai.Client) e
 		schedulerConfig = cfg.Scheduler
 		// Scheduler is enabled by default, only disable if explicitly set to false
 		if !schedulerConfig.Enabled {
-			log.Log.Infof("[Engine] ⏸️  Scheduler is disabled via config")
+			e.logger().Info("[Engine] ⏸️  Scheduler is disabled via config")
 			return nil
 		}
 	}
@@ -329,6 +554,7 @@ func (e *Engine) startScheduler(ctx context.Context, llmClient *openai.Client) e
 	}
 	// DisableLogs: from config (env) or from LLMConfig (programmatic, e.g. TradeAgent yaml)
 	schedulerConfigStruct.DisableLogs = schedulerConfig.DisableLogs || e.llmConfig.SchedulerDisableLogs
+	schedulerConfigStruct.Logger = e.Logger
 
 	// Create and start scheduler
 	scheduler := NewSessionScheduler(sessionHandler, llmClient, schedulerConfigStruct)
@@ -337,7 +563,7 @@ func (e *Engine) startScheduler(ctx context.Context, llmClient *openai.Client) e
 	// This allows scheduler to use cheaper models (OSS 120B) for summarization
 	if e.backups != nil {
 		scheduler.SetBackupChain(e.backups)
-		log.Log.Infof("[Engine] 🔗 Scheduler using backup chain with %d providers", len(e.backups.providers))
+		e.logger().Info("[Engine] 🔗 Scheduler using backup chain", "providers", len(e.backups.providers))
 	}
 
 	e.schedulerMu.Lock()
@@ -346,8 +572,8 @@ func (e *Engine) startScheduler(ctx context.Context, llmClient *openai.Client) e
 	// Start scheduler in background goroutine to avoid blocking initialization
 	go scheduler.Start(ctx)
 
-	log.Log.Infof("[Engine] ✅ Session scheduler started | CheckInterval: %v | FirstThreshold: %d msgs | SubsequentThreshold: %d msgs + %v | SummaryModel: %s",
-		schedulerConfigStruct.CheckInterval, schedulerConfigStruct.FirstSummarizationThreshold, schedulerConfigStruct.SubsequentMessageThreshold, schedulerConfigStruct.SubsequentTimeThreshold, schedulerConfigStruct.SummaryModel)
+	e.logger().Info("[Engine] ✅ Session scheduler started",
+		"check_interval", schedulerConfigStruct.CheckInterval, "first_threshold", schedulerConfigStruct.FirstSummarizationThreshold, "subsequent_threshold", schedulerConfigStruct.SubsequentMessageThreshold, "subsequent_time_threshold", schedulerConfigStruct.SubsequentTimeThreshold, "summary_model", schedulerConfigStruct.SummaryModel)
 
 	return nil
 }
@@ -403,6 +629,9 @@ func (e *Engine) CreateSession(userID string) (*model.Session, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load root node: %w", err)
 	}
+	if _, err := e.PathTools("root"); err != nil {
+		return nil, err
+	}
 
 	session.NodeDigests = []model.NodeDigest{summarizeNode(rootNode)}
 
@@ -410,7 +639,7 @@ func (e *Engine) CreateSession(userID string) (*model.Session, error) {
 		return nil, fmt.Errorf("failed to persist session: %w", err)
 	}
 
-	log.Log.Infof("[Engine] ✅ Created new session | UserID: %s | SessionID: %s", userID, session.SessionID)
+	e.logger().Info("[Engine] ✅ Created new session", "user_id", userID, "session_id", session.SessionID)
 
 	return session, nil
 }
@@ -426,7 +655,7 @@ func (e *Engine) SetProgress(sessionID string, inProgress bool) error {
 }
 
 // OpenFile opens a node by path and adds it to the session's opened nodes.
-// Returns the node content if successfully opened, or an error if the path doesn't exist.
+// Returns the node content (with templates rendered) if successfully opened, or an error if the path doesn't exist.
 func (e *Engine) OpenFile(sessionID string, path string) (string, error) {
 	// Get session
 	session, err := e.Sessions.Get(sessionID)
@@ -434,6 +663,10 @@ func (e *Engine) OpenFile(sessionID string, path string) (string, error) {
 		return "", fmt.Errorf("session not found: %w", err)
 	}
 
+	if !e.canUser(path, session.UserID, model.PermRead) {
+		return "", fmt.Errorf("%w: %s", ErrAccessDenied, path)
+	}
+
 	// Check if already opened
 	alreadyOpened := false
 	for _, digest := range session.NodeDigests {
@@ -452,7 +685,7 @@ func (e *Engine) OpenFile(sessionID string, path string) (string, error) {
 			}); ok {
 				openedFiles, err := sqliteStore.GetCurrentlyOpenedFilesBySession(sessionID)
 				if err != nil {
-					log.Log.Warnf("[Engine] ⚠️  Failed to get opened files | SessionID: %s | Error: %v", sessionID, err)
+					e.logger().Warn("[Engine] ⚠️  Failed to get opened files", "session_id", sessionID, "error", err)
 				} else {
 					// Check if file is already recorded
 					isRecorded := false
@@ -471,13 +704,13 @@ func (e *Engine) OpenFile(sessionID string, path string) (string, error) {
 						}
 						openedFile := model.NewOpenedFile(session, path, fileName)
 						if err := sqliteStore.AddOpenedFile(openedFile); err != nil {
-							log.Log.Warnf("[Engine] ⚠️  Failed to record opened file | SessionID: %s | Path: %s | Error: %v", sessionID, path, err)
+							e.logger().Warn("[Engine] ⚠️  Failed to record opened file", "session_id", sessionID, "path", path, "error", err)
 						}
 					}
 				}
 			}
 
-			return node.Content, nil
+			return e.renderNodeContent(node, session), nil
 		}
 	}
 
@@ -506,14 +739,14 @@ func (e *Engine) OpenFile(sessionID string, path string) (string, error) {
 			}
 			openedFile := model.NewOpenedFile(session, path, fileName)
 			if err := sqliteStore.AddOpenedFile(openedFile); err != nil {
-				log.Log.Warnf("[Engine] ⚠️  Failed to record opened file | SessionID: %s | Path: %s | Error: %v", sessionID, path, err)
+				e.logger().Warn("[Engine] ⚠️  Failed to record opened file", "session_id", sessionID, "path", path, "error", err)
 			} else {
-				log.Log.Infof("[Engine] 📂 File opened recorded | SessionID: %s | Path: %s | FileID: %s", sessionID, path, openedFile.FileID)
+				e.logger().Info("[Engine] 📂 File opened recorded", "session_id", sessionID, "path", path, "file_id", openedFile.FileID)
 			}
 		}
 	}
 
-	return node.Content, nil
+	return e.renderNodeContent(node, session), nil
 }
 
 // CloseFile removes a node from the session's opened nodes.
@@ -557,9 +790,9 @@ func (e *Engine) CloseFile(sessionID string, path string) error {
 		CloseOpenedFile(string, string) error
 	}); ok {
 		if err := sqliteStore.CloseOpenedFile(sessionID, path); err != nil {
-			log.Log.Warnf("[Engine] ⚠️  Failed to record closed file | SessionID: %s | Path: %s | Error: %v", sessionID, path, err)
+			e.logger().Warn("[Engine] ⚠️  Failed to record closed file", "session_id", sessionID, "path", path, "error", err)
 		} else {
-			log.Log.Infof("[Engine] 📂 File closed recorded | SessionID: %s | Path: %s", sessionID, path)
+			e.logger().Info("[Engine] 📂 File closed recorded", "session_id", sessionID, "path", path)
 		}
 	}
 
@@ -579,21 +812,25 @@ func (e *Engine) ProcessMessage(
 		return "⏳ Processing previous request... Please wait. 📋 Your message was queued and will be answered in order.", 0, nil
 	}
 
-	// Lock session mutex
-	sessionMu := e.getSessionMutex(sessionID)
-	sessionMu.Lock()
-	defer sessionMu.Unlock()
+	// Lock the session: only one message is processed at a time per session to prevent
+	// race conditions on sequence number generation and session updates
+	defer e.lockSession(sessionID)()
 
 	e.sessionProgress.SetInProgress(sessionID, true)
 	defer e.sessionProgress.SetInProgress(sessionID, false)
 
-	log.Log.Infof("[Engine] 🚀 ProcessMessage | SessionID: %s | MsgLen: %d", sessionID, len(userMessage))
+	// The caller may have given up while we waited for the mutex
+	if err := ctx.Err(); err != nil {
+		return "", 0, err
+	}
+
+	e.logger().Info("[Engine] 🚀 ProcessMessage", "session_id", sessionID, "msg_len", len(userMessage))
 
 	// Validate prerequisites
 	if !e.IsDBReady() {
 		return "", 0, errors.New("database is not ready. Call Init() first")
 	}
-	if e.llmClient == nil {
+	if e.llmClient == nil && e.replay == nil {
 		return "", 0, errors.New("LLM client is not configured. Call UseLLMConfig first")
 	}
 
@@ -603,32 +840,40 @@ func (e *Engine) ProcessMessage(
 		return "", 0, fmt.Errorf("failed to get session: %w", err)
 	}
 
-	log.Log.Infof("[Engine] 🔍 Session loaded | SessionID: %s | UserID: %s | Messages: %d",
-		sessionID, session.UserID, len(session.Msgs))
+	e.logger().Info("[Engine] 🔍 Session loaded",
+		"session_id", sessionID, "user_id", session.UserID, "messages", len(session.Msgs))
 
 	// Clean old function calls if session is stale (> 2 hours)
 	if session.UpdatedAt.Before(time.Now().Add(-2 * time.Hour)) {
 		if err := e.removeFunctionCalls(sessionID); err != nil {
-			log.Log.Warnf("[Engine] ⚠️  Failed to clean function calls | Error: %v", err)
+			e.logger().Warn("[Engine] ⚠️  Failed to clean function calls", "error", err)
 		}
 	}
 
 	// Process the message
 	response, tokens, err := e.processOneMessageBody(ctx, sessionID, userMessage)
 	if err != nil {
-		log.Log.Errorf("[Engine] ❌ Processing failed | SessionID: %s | Error: %v", sessionID, err)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			e.logger().Warn("[Engine] ⏹️  Processing cancelled", "session_id", sessionID, "error", ctxErr)
+			return "", tokens, ctxErr
+		}
+		e.logger().Error("[Engine] ❌ Processing failed", "session_id", sessionID, "error", err)
 		return "", tokens, err
 	}
 
 	// Process any queued messages
 	for _, m := range e.sessionProgress.DrainQueue(sessionID) {
+		if ctx.Err() != nil {
+			e.logger().Warn("[Engine] ⏹️  Context done, queued messages dropped", "session_id", sessionID)
+			break
+		}
 		if _, _, qErr := e.processOneMessageBody(ctx, sessionID, m); qErr != nil {
-			log.Log.Warnf("[Engine] ⚠️  Queued message failed | Error: %v", qErr)
+			e.logger().Warn("[Engine] ⚠️  Queued message failed", "error", qErr)
 		}
 	}
 
-	log.Log.Infof("[Engine] ✅ Done | SessionID: %s | ResponseLen: %d | Tokens: %d",
-		sessionID, len(response), tokens)
+	e.logger().Info("[Engine] ✅ Done",
+		"session_id", sessionID, "response_len", len(response), "tokens", tokens)
 
 	return response, tokens, nil
 }
@@ -658,9 +903,10 @@ func (e *Engine) processOneMessageBody(ctx context.Context, sessionID string, us
 		// Save user message to messages table
 		userMsgID, userSeqID := session.GenerateMessageIDWithSeq()
 		userMsg := model.NewUserMessage(userMsgID, userSeqID, session.UserID, sessionID, userMessage, model.ContentTypeText)
+		userMsg.Content = limitStoredContent(userMsg.Content, e.MaxStoredContentBytes, "Engine", "message "+userMsgID)
 		if sqliteStore, ok := e.Sessions.(interface{ PutMessage(*model.Message) error }); ok {
 			if err := sqliteStore.PutMessage(userMsg); err != nil {
-				log.Log.Warnf("[Engine] ⚠️  Failed to save user message | Error: %v", err)
+				e.logger().Warn("[Engine] ⚠️  Failed to save user message", "error", err)
 			}
 		}
 	}
@@ -688,6 +934,7 @@ func summarizeNode(node *model.Node) model.NodeDigest {
 // 2. Session context - Summary and tags from previous conversations (if summarized)
 // 3. File index - List of all knowledge files with metadata
 // 4. Opened files - Content of currently opened nodes
+// 5. Current position - Breadcrumb trail of the node reached with Advance (if any)
 //
 // The order is deterministic to enable AI prompt caching.
 func (e *Engine) GetSystemPrompts(session *model.Session) []string {
@@ -715,6 +962,11 @@ func (e *Engine) GetSystemPrompts(session *model.Session) []string {
 	openedPrompts := e.getOpenedNodePrompts(session)
 	prompts = append(prompts, openedPrompts...)
 
+	// 5. Current position - last, since it changes with every Advance/GoBack
+	if position := e.buildPositionPrompt(session); position != "" {
+		prompts = append(prompts, position)
+	}
+
 	return prompts
 }
 
@@ -757,7 +1009,7 @@ func (e *Engine) buildFileIndex(session *model.Session) string {
 
 	// Collect all nodes recursively
 	var entries []string
-	e.collectFileIndexEntries("root", openedPaths, &entries)
+	e.collectFileIndexEntries("root", session.UserID, openedPaths, &entries)
 
 	if len(entries) == 0 {
 		return ""
@@ -775,12 +1027,16 @@ func (e *Engine) buildFileIndex(session *model.Session) string {
 	return sb.String()
 }
 
-// collectFileIndexEntries recursively collects file index entries
-func (e *Engine) collectFileIndexEntries(path string, openedPaths map[string]bool, entries *[]string) {
+// collectFileIndexEntries recursively collects file index entries, skipping nodes
+// that are not visible in docs to userID
+func (e *Engine) collectFileIndexEntries(path string, userID string, openedPaths map[string]bool, entries *[]string) {
 	node, err := e.Repo.LoadNode(path)
 	if err != nil {
 		return
 	}
+	if !e.canUser(path, userID, model.PermVisibleDocs) {
+		return
+	}
 
 	// Build entry: | Path | Description | Summary | Open | Len |
 	isOpen := "no"
@@ -803,7 +1059,7 @@ func (e *Engine) collectFileIndexEntries(path string, openedPaths map[string]boo
 	}
 
 	for _, childPath := range children {
-		e.collectFileIndexEntries(childPath, openedPaths, entries)
+		e.collectFileIndexEntries(childPath, userID, openedPaths, entries)
 	}
 }
 
@@ -858,7 +1114,7 @@ func (e *Engine) getOpenedNodePrompts(session *model.Session) []string {
 				header = fmt.Sprintf("**Path:** `%s`\n\n", path)
 			}
 
-			prompts = append(prompts, header+node.Content)
+			prompts = append(prompts, header+e.renderNodeContent(node, session))
 		}
 	}
 
@@ -893,18 +1149,99 @@ func (e *Engine) GetTools(session *model.Session) []openai.Tool {
 		if tool.Status != model.ToolStatusActive {
 			continue
 		}
-		tools = append(tools, openai.Tool{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        tool.Name,
-				Description: tool.Description,
-				Parameters:  tool.InputSchema,
-			},
-		})
+		tools = append(tools, toOpenAITool(tool))
+	}
+
+	// Functions registered with a definition at runtime (see RegisterFunction)
+	if e.Functions != nil {
+		seen := make(map[string]bool, len(tools))
+		for _, tool := range tools {
+			seen[tool.Function.Name] = true
+		}
+		for _, tool := range e.Functions.GetDefinitions() {
+			if !isBareTool(tool) && !seen[tool.Function.Name] {
+				tools = append(tools, tool)
+			}
+		}
+	}
+	for _, local := range e.localToolDefinitions() {
+		duplicate := false
+		for _, tool := range tools {
+			if tool.Function.Name == local.Function.Name {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			tools = append(tools, local)
+		}
 	}
 	return tools
 }
 
+// ToolDefinitions returns every tool the engine can expose, independent of any session:
+// the tools of all knowledge tree nodes plus the function registry's definitions
+// (open_file/close_file included when registered), de-duplicated and sorted by name
+func (e *Engine) ToolDefinitions() []openai.Tool {
+	var tools []openai.Tool
+	if allTools, err := e.Repo.LoadAllTools(); err == nil {
+		for _, tool := range allTools {
+			if tool.Status != "" && tool.Status != model.ToolStatusActive {
+				continue
+			}
+			tools = append(tools, toOpenAITool(tool))
+		}
+	} else {
+		e.logger().Warn("[Engine] ⚠️  Failed to load knowledge tree tools", "error", err)
+	}
+
+	if e.Functions != nil {
+		for _, tool := range GetFileToolDefinitions() {
+			if e.Functions.Has(tool.Name) {
+				tools = append(tools, toOpenAITool(tool))
+			}
+		}
+		tools = append(tools, e.Functions.GetDefinitions()...)
+	}
+	tools = append(tools, e.localToolDefinitions()...)
+	return MergeToolDefinitions(tools)
+}
+
+// MergeToolDefinitions de-duplicates tool lists by function name and sorts the result by name.
+// The first definition of a name wins, unless it is a bare name without description or parameters.
+func MergeToolDefinitions(lists ...[]openai.Tool) []openai.Tool {
+	byName := make(map[string]openai.Tool)
+	for _, list := range lists {
+		for _, tool := range list {
+			if tool.Function == nil {
+				continue
+			}
+			if existing, ok := byName[tool.Function.Name]; !ok || isBareTool(existing) {
+				byName[tool.Function.Name] = tool
+			}
+		}
+	}
+
+	merged := make([]openai.Tool, 0, len(byName))
+	for _, tool := range byName {
+		merged = append(merged, tool)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Function.Name < merged[j].Function.Name })
+	return merged
+}
+
+// toOpenAITool converts a knowledge tree tool to the OpenAI tool format
+func toOpenAITool(tool model.Tool) openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.InputSchema,
+		},
+	}
+}
+
 // removeFunctionCalls removes function/tool call messages
 func (e *Engine) removeFunctionCalls(sessionID string) error {
 	session, err := e.Sessions.Get(sessionID)
@@ -1075,7 +1412,7 @@ Your response must not exceed %d characters.`, maxLen)
 	if session.UserID != "" {
 		ctx = model.WithUserID(ctx, session.UserID)
 	} else {
-		log.Log.Warnf("[Engine] ⚠️  Session has no UserID | SessionID: %s", sessionID)
+		e.logger().Warn("[Engine] ⚠️  Session has no UserID", "session_id", sessionID)
 	}
 
 	// Make LLM call (tries backup provider first, then falls back to OpenAI)
@@ -1083,6 +1420,9 @@ Your response must not exceed %d characters.`, maxLen)
 		{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
 		{Role: openai.ChatMessageRoleUser, Content: userPrompt},
 	}
+	if cbErr := checkLLMBudget(ctx, e.Callback, e.quota, session.UserID, sessionID, modelName, msgs, nil); cbErr != nil {
+		return "", errors.New(blockedLLMMessage(e.llmConfig.QuotaExceededMessage, cbErr))
+	}
 	resp, err := e.callLLM(ctx, modelName, msgs, nil)
 
 	if err != nil {
@@ -1101,6 +1441,12 @@ func (e *Engine) GetLLMClient() *openai.Client {
 	return e.llmClient
 }
 
+// BackupStatus returns the health and circuit breaker state of each backup provider.
+// Returns nil when no backup providers are configured.
+func (e *Engine) BackupStatus() []ProviderStatus {
+	return e.backups.status()
+}
+
 // GetLLMConfig returns the LLM configuration
 func (e *Engine) GetLLMConfig() LLMConfig {
 	return e.llmConfig
@@ -1145,9 +1491,23 @@ func (e *Engine) processChatRequest(
 	// Get system prompts and tools (these don't change during the loop)
 	systemPrompts := e.GetSystemPrompts(session)
 	openaiTools := e.GetTools(session)
+	ctx = withOfferedTools(ctx, openaiTools)
+	// Only the base prompt is the same for every turn (this replaces the Core's prefix, if any)
+	if basePrompt != "" {
+		ctx = withPromptCachePrefix(ctx, systemPrompts[:1])
+	} else {
+		ctx = withPromptCachePrefix(ctx, nil)
+	}
 
-	// Set model
+	// Set model (node llm overrides take precedence over the engine default)
+	override, err := e.resolveLLMOverride(session)
+	if err != nil {
+		return "", 0, err
+	}
 	modelName := e.llmConfig.Model
+	if override.Model != "" {
+		modelName = override.Model
+	}
 	if modelName == "" {
 		modelName = "openai/gpt-5-nano"
 	}
@@ -1163,7 +1523,25 @@ func (e *Engine) processChatRequest(
 	// Work with a local copy of messages - this is the single source of truth for this request
 	localMsgs := append([]openai.ChatCompletionMessage{}, session.Msgs...)
 
-	for i := 0; i < maxIterations; i++ {
+	// JSON answers are checked, and an invalid one is sent back once for correction, with the
+	// next request only (not stored). The correction gets one more iteration when it is asked
+	// on the last one.
+	format := e.responseFormat(ctx)
+	formatRetried := false
+	var formatRetry []openai.ChatCompletionMessage
+	iterations := maxIterations
+
+	// Images returned by the last tool calls, sent with the next request only (not stored)
+	var toolImages []openai.ChatCompletionMessage
+
+	for i := 0; i < iterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", totalTokenUsage, err
+		}
+
+		// Move the oldest messages out when the active history window is exceeded
+		localMsgs = trimActiveMessages(session, localMsgs, e.MaxActiveMessages, e.MaxActiveTokens)
+
 		// Build request messages: system prompts + local messages
 		reqMessages := make([]openai.ChatCompletionMessage, 0, len(systemPrompts)+len(localMsgs))
 		for _, prompt := range systemPrompts {
@@ -1174,31 +1552,36 @@ func (e *Engine) processChatRequest(
 				})
 			}
 		}
-		reqMessages = append(reqMessages, localMsgs...)
+		reqMessages = append(reqMessages, dropOrphanToolMessages(localMsgs, "Engine")...)
+		reqMessages = append(reqMessages, formatRetry...)
+		reqMessages = append(reqMessages, toolImages...)
+		formatRetry, toolImages = nil, nil
 
-		log.Log.Infof("[Engine] LLM request | iteration=%d/%d | messages=%d | tools=%d",
-			i+1, maxIterations, len(reqMessages), len(openaiTools))
+		e.logger().Info("[Engine] LLM request",
+			"iteration", i+1, "max_iterations", iterations, "messages", len(reqMessages), "tools", len(openaiTools))
 
 		notifyStatus(ctx, session.UserID, sessionID, StatusThinking, "")
 
 		// BeforeAction: check quota/credit before LLM call (block without consuming tokens)
-		if e.Callback != nil {
-			if cbErr := e.Callback.BeforeAction(ctx, &UsageEvent{
-				UserID:    session.UserID,
-				SessionID: sessionID,
-				EventType: EventLLMCall,
-				Name:      EventNameLLMCall,
-				Model:     modelName,
-			}); cbErr != nil {
-				return cbErr.Error(), totalTokenUsage, nil
-			}
+		if cbErr := checkLLMBudget(ctx, e.Callback, e.quota, session.UserID, sessionID, modelName, reqMessages, openaiTools); cbErr != nil {
+			return blockedLLMMessage(e.llmConfig.QuotaExceededMessage, cbErr), totalTokenUsage, nil
 		}
 
 		// Call LLM
 		llmStart := time.Now()
-		resp, err := e.callLLM(ctx, modelName, reqMessages, openaiTools)
+		request := openai.ChatCompletionRequest{Model: modelName, Messages: reqMessages, Tools: openaiTools, MaxTokens: override.MaxTokens}
+		if override.Temperature != nil {
+			request.Temperature = *override.Temperature
+		}
+		if format != nil {
+			request.ResponseFormat = format.request()
+		}
+		resp, err := e.callLLMRequest(ctx, request)
 		llmDuration := time.Since(llmStart)
 		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return "", totalTokenUsage, ctxErr
+			}
 			return "", totalTokenUsage, formatLLMError(err)
 		}
 
@@ -1208,33 +1591,34 @@ func (e *Engine) processChatRequest(
 
 		choice := resp.Choices[0]
 		totalTokenUsage += resp.Usage.TotalTokens
+		session.AddTokenUsage(resp.Usage)
 
 		// Record usage callback
-		if e.Callback != nil {
-			ev := &UsageEvent{
-				UserID:       session.UserID,
-				SessionID:    sessionID,
-				EventType:    EventLLMCall,
-				Name:         EventNameLLMCall,
-				Tokens:       resp.Usage.TotalTokens,
-				InputTokens:  resp.Usage.PromptTokens,
-				OutputTokens: resp.Usage.CompletionTokens,
-				Model:        modelName,
-				Duration:     llmDuration,
-			}
-			if resp.Usage.PromptTokensDetails != nil {
-				ev.CachedInputTokens = resp.Usage.PromptTokensDetails.CachedTokens
-			}
-			e.Callback.AfterAction(ctx, ev)
+		ev := &UsageEvent{
+			UserID:       session.UserID,
+			SessionID:    sessionID,
+			EventType:    EventLLMCall,
+			Name:         EventNameLLMCall,
+			Tokens:       resp.Usage.TotalTokens,
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+			Model:        modelName,
+			Duration:     llmDuration,
+		}
+		if resp.Usage.PromptTokensDetails != nil {
+			ev.CachedInputTokens = resp.Usage.PromptTokensDetails.CachedTokens
 		}
+		recordLLMUsage(ctx, e.Callback, e.CostTable, e.Sessions, ev)
 
 		// Save LLM message to DB
-		request := openai.ChatCompletionRequest{Model: modelName, Messages: reqMessages, Tools: openaiTools}
-		messageID := e.saveMessage(session, request, resp, choice)
+		messageID, err := e.saveMessage(session, request, resp, choice)
+		if err != nil {
+			return "", totalTokenUsage, err
+		}
 
 		// Handle tool calls
 		if choice.FinishReason == openai.FinishReasonToolCalls {
-			if e.Executor == nil {
+			if e.Executor == nil && e.Functions == nil {
 				return "", totalTokenUsage, fmt.Errorf("tool calls received but no executor provided")
 			}
 
@@ -1245,8 +1629,26 @@ func (e *Engine) processChatRequest(
 			})
 
 			// Execute each tool and add results to local messages
-			for _, toolCall := range choice.Message.ToolCalls {
-				result := e.executeTool(ctx, session, messageID, toolCall)
+			var duplicateOf []int
+			if e.DedupeToolCalls {
+				duplicateOf = duplicateToolCalls(choice.Message.ToolCalls)
+			}
+			results := make([]string, len(choice.Message.ToolCalls))
+			toolCtx, images := model.WithImageResults(ctx)
+			for i, toolCall := range choice.Message.ToolCalls {
+				if err := ctx.Err(); err != nil {
+					return "", totalTokenUsage, err
+				}
+				var result string
+				if duplicateOf != nil && duplicateOf[i] >= 0 {
+					result = results[duplicateOf[i]]
+					e.saveDuplicateToolCall(session, messageID, toolCall, result)
+				} else {
+					if result, err = e.executeTool(toolCtx, session, messageID, toolCall); err != nil {
+						return "", totalTokenUsage, err
+					}
+				}
+				results[i] = result
 				localMsgs = append(localMsgs, openai.ChatCompletionMessage{
 					Role:       openai.ChatMessageRoleTool,
 					Content:    result,
@@ -1254,12 +1656,16 @@ func (e *Engine) processChatRequest(
 					ToolCallID: toolCall.ID,
 				})
 			}
+			toolImages = e.toolImagesMessage(sessionID, images())
 
 			// Save session with updated messages after tool execution
 			session.Msgs = localMsgs
 			session.UpdatedAt = time.Now()
-			if err := e.Sessions.Put(session); err != nil {
-				log.Log.Warnf("[Engine] ⚠️  Failed to save session after tools | SessionID: %s | Error: %v", sessionID, err)
+			if err := e.putCappedSession(session); err != nil {
+				e.logger().Warn("[Engine] ⚠️  Failed to save session after tools", "session_id", sessionID, "error", err)
+				if err := persistFailed(e.FailFastOnPersistError, session, "session", err); err != nil {
+					return "", totalTokenUsage, err
+				}
 			}
 
 			// Continue loop to process tool results
@@ -1268,16 +1674,46 @@ func (e *Engine) processChatRequest(
 
 		// Text response - we're done
 		textResponse := choice.Message.Content
-		localMsgs = append(localMsgs, openai.ChatCompletionMessage{
+		answer := openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleAssistant,
 			Content: textResponse,
-		})
+		}
+
+		var formatErr error
+		if format != nil {
+			if _, problems := format.check(textResponse); len(problems) > 0 {
+				if !formatRetried {
+					formatRetried = true
+					e.logger().Warn("[Engine] ⚠️  Invalid JSON answer, asking for a correction", "session_id", sessionID, "problems", strings.Join(problems, "; "))
+					formatRetry = []openai.ChatCompletionMessage{answer, {
+						Role:    openai.ChatMessageRoleSystem,
+						Content: format.correction(problems),
+					}}
+					if i == iterations-1 {
+						iterations++
+					}
+					continue
+				}
+				formatErr = fmt.Errorf("%w: %s", ErrInvalidJSONResponse, strings.Join(problems, "; "))
+			}
+		}
+		// An invalid answer is not kept in the conversation
+		if formatErr == nil {
+			localMsgs = append(localMsgs, answer)
+		}
 
 		// Save final session state
 		session.Msgs = localMsgs
+		e.capSessionMessages(session)
 		session.UpdatedAt = time.Now()
 		if err := e.Sessions.Put(session); err != nil {
-			log.Log.Warnf("[Engine] ⚠️  Failed to save session | SessionID: %s | Error: %v", sessionID, err)
+			e.logger().Warn("[Engine] ⚠️  Failed to save session", "session_id", sessionID, "error", err)
+			if err := persistFailed(e.FailFastOnPersistError, session, "session", err); err != nil {
+				return "", totalTokenUsage, err
+			}
+		}
+		if formatErr != nil {
+			return "", totalTokenUsage, formatErr
 		}
 
 		return textResponse, totalTokenUsage, nil
@@ -1286,13 +1722,14 @@ func (e *Engine) processChatRequest(
 	return "", totalTokenUsage, fmt.Errorf("max iterations (%d) reached without final response", maxIterations)
 }
 
-// saveMessage saves a message to the database and returns the messageID
+// saveMessage saves a message to the database and returns the messageID. A failed save is
+// handled by persistFailed.
 func (e *Engine) saveMessage(
 	session *model.Session,
 	request openai.ChatCompletionRequest,
 	response openai.ChatCompletionResponse,
 	choice openai.ChatCompletionChoice,
-) string {
+) (string, error) {
 	// Get user message content
 	content := choice.Message.Content
 	if content == "" && len(choice.Message.ToolCalls) > 0 {
@@ -1315,43 +1752,52 @@ func (e *Engine) saveMessage(
 		choice,
 	)
 
+	msg.Content = limitStoredContent(msg.Content, e.MaxStoredContentBytes, "Engine", "message "+messageID)
+
 	// Try to save to database if store supports it
 	if sqliteStore, ok := e.Sessions.(interface {
 		PutMessage(*model.Message) error
 	}); ok {
 		if err := sqliteStore.PutMessage(msg); err != nil {
-			log.Log.Warnf("[Engine] ⚠️  Failed to save message | SessionID: %s | Error: %v", session.SessionID, err)
-		} else {
-			log.Log.Infof("[Engine] 💾 Message saved | MessageID: %s | Model: %s | Tokens: %d", msg.MessageID, msg.Model, msg.TotalTokens)
+			e.logger().Warn("[Engine] ⚠️  Failed to save message", "session_id", session.SessionID, "error", err)
+			return msg.MessageID, persistFailed(e.FailFastOnPersistError, session, "message", err)
 		}
+		e.logger().Info("[Engine] 💾 Message saved", "message_id", msg.MessageID, "model", msg.Model, "tokens", msg.TotalTokens)
 	}
-	return msg.MessageID
+	return msg.MessageID, nil
 }
 
 // executeTool executes a single tool and returns the result string.
 // SIMPLIFIED: Does not modify session messages - caller is responsible for that.
+// The error is only set when saving the tool call fails with FailFastOnPersistError set.
 func (e *Engine) executeTool(
 	ctx context.Context,
 	session *model.Session,
 	messageID string,
 	toolCall openai.ToolCall,
-) string {
+) (string, error) {
 	sessionID := session.SessionID
 
-	log.Log.Infof("[Engine] 🔧 executeTool | Function=%s | SessionID=%s", toolCall.Function.Name, sessionID)
+	e.logger().Info("[Engine] 🔧 executeTool", "function", toolCall.Function.Name, "session_id", sessionID)
 
 	// Save tool call to DB
-	persister := NewToolCallPersister(e.Sessions, "Engine")
-	toolID := ""
-	if persister != nil {
-		toolID = persister.Save(session, messageID, toolCall)
+	persister := e.toolCallPersister().withMCPServer(e.mcpServer(toolCall.Function.Name))
+	toolID, err := persister.save(session, messageID, toolCall, session.AgentType)
+	if err != nil {
+		if err := persistFailed(e.FailFastOnPersistError, session, "tool call", err); err != nil {
+			return "", err
+		}
 	}
 
-	// Parse args
-	var args map[string]interface{}
-	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
-		args = make(map[string]interface{})
+	// Parse args, repairing near-valid JSON; invalid args are reported back to the model
+	check := checkToolArgs(ctx, toolCall, e.SkipToolArgValidation, "Engine")
+	persister.SetArgsValidation(toolID, check)
+	if check.Outcome == model.ToolArgsInvalid {
+		result := check.ErrorResult(toolCall.Function.Name)
+		persister.Update(toolID, result, check.Err(toolCall.Function.Name))
+		return result, nil
 	}
+	args := check.Args
 	args["__user_id__"] = session.UserID
 	args["__session_id__"] = sessionID
 
@@ -1375,20 +1821,34 @@ func (e *Engine) executeTool(
 			if persister != nil {
 				persister.Update(toolID, result, cbErr)
 			}
-			return result
+			return result, nil
 		}
 	}
 
 	// Execute tool
 	toolStart := time.Now()
-	result, err := e.Executor(toolCall.Function.Name, args)
+	ctx = model.WithToolCallInfo(ctx, model.ToolCallInfo{
+		ToolName:   toolCall.Function.Name,
+		ToolCallID: toolCall.ID,
+		UserID:     session.UserID,
+		SessionID:  sessionID,
+	})
+	result, err := e.runTool(ctx, toolCall.Function.Name, args)
 	toolDuration := time.Since(toolStart)
 
-	if err != nil {
+	var notFound *model.FunctionNotFoundError
+	if errors.As(err, &notFound) {
+		result = toolNotImplementedResult(toolCall.Function.Name)
+		e.logger().Warn("[Engine] Tool not implemented", "name", toolCall.Function.Name)
+	} else if timedOut := (*model.ToolTimeoutError)(nil); errors.As(err, &timedOut) {
+		result = fmt.Sprintf("Error executing tool %s: it did not finish within %s and was abandoned. Do not call it again with the same arguments.", toolCall.Function.Name, timedOut.Timeout)
+	} else if panicked := (*model.ToolPanicError)(nil); errors.As(err, &panicked) {
+		result = fmt.Sprintf("Error executing tool %s: the tool failed with an internal error.", toolCall.Function.Name)
+	} else if err != nil {
 		result = fmt.Sprintf("Error executing tool %s: %v", toolCall.Function.Name, err)
-		log.Log.Warnf("[Engine] Tool error | name=%s | error=%v", toolCall.Function.Name, err)
+		e.logger().Warn("[Engine] Tool error", "name", toolCall.Function.Name, "error", err)
 	} else {
-		log.Log.Infof("[Engine] Tool result | name=%s | len=%d", toolCall.Function.Name, len(result))
+		e.logger().Info("[Engine] Tool result", "name", toolCall.Function.Name, "len", len(result))
 	}
 
 	// Callback after execution
@@ -1418,7 +1878,7 @@ func (e *Engine) executeTool(
 		persister.Update(toolID, processedResult, err)
 	}
 
-	return processedResult
+	return processedResult, nil
 }
 
 // executeOneToolCall is kept for backward compatibility but deprecated.
@@ -1429,7 +1889,7 @@ func (e *Engine) executeOneToolCall(
 	messageID, sessionID string,
 	toolCall openai.ToolCall,
 ) openai.ChatCompletionMessage {
-	result := e.executeTool(ctx, session, messageID, toolCall)
+	result, _ := e.executeTool(ctx, session, messageID, toolCall)
 	return openai.ChatCompletionMessage{
 		Role:       openai.ChatMessageRoleTool,
 		Content:    result,
@@ -2,7 +2,10 @@ package engine
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/ghiac/agentize/log"
 	"github.com/ghiac/agentize/model"
@@ -17,6 +20,29 @@ type UserModeration struct {
 	// User management functions
 	getUser  func(string) (*model.User, error)
 	saveUser func(*model.User) error
+
+	// Thresholds and messages shown to moderated users
+	config ModerationConfig
+	// allowed holds config.AllowedUserIDs
+	allowed map[string]bool
+
+	// recordEvent adds an entry to the moderation audit trail (optional)
+	recordEvent func(*model.ModerationEvent)
+}
+
+// moderationMessageIDKey carries the ID of the user message being processed
+type moderationMessageIDKey struct{}
+
+// withModerationMessageID records the ID of the user message being processed,
+// so moderation events (strikes, bans) can point at the message that triggered them
+func withModerationMessageID(ctx context.Context, messageID string) context.Context {
+	return context.WithValue(ctx, moderationMessageIDKey{}, messageID)
+}
+
+// moderationMessageID returns the ID set by withModerationMessageID, or ""
+func moderationMessageID(ctx context.Context) string {
+	id, _ := ctx.Value(moderationMessageIDKey{}).(string)
+	return id
 }
 
 // NewUserModeration creates a new UserModeration helper
@@ -34,11 +60,42 @@ func NewUserModeration(
 	}
 }
 
+// SetConfig sets the thresholds, allowlist and messages shown to moderated users (see ModerationConfig)
+func (um *UserModeration) SetConfig(config ModerationConfig) {
+	um.config = config
+	um.allowed = make(map[string]bool, len(config.AllowedUserIDs))
+	for _, userID := range config.AllowedUserIDs {
+		um.allowed[userID] = true
+	}
+}
+
+// SetEventRecorder sets the function that records strikes and automatic bans in the moderation audit trail
+func (um *UserModeration) SetEventRecorder(record func(*model.ModerationEvent)) {
+	um.recordEvent = record
+}
+
+// record adds an event to the audit trail if a recorder is set
+func (um *UserModeration) record(ctx context.Context, user *model.User, eventType model.ModerationEventType, reason string, duration time.Duration) {
+	if um.recordEvent == nil {
+		return
+	}
+	event := model.NewModerationEvent(user.UserID, eventType, model.ModerationActorAuto)
+	event.MessageID = moderationMessageID(ctx)
+	event.Reason = reason
+	event.Duration = duration
+	event.NonsenseCount = user.NonsenseCount
+	um.recordEvent(event)
+}
+
 // CheckBanStatus checks if user is banned and returns ban message if applicable
 func (um *UserModeration) CheckBanStatus(userID string) (isBanned bool, banMessage string) {
+	if um.allowed[userID] {
+		return false, ""
+	}
+
 	user, err := um.getUser(userID)
 	if err != nil {
-		log.Log.Warnf("[UserModeration] ⚠️  Failed to get user | UserID: %s | Error: %v", userID, err)
+		log.Log.Warn("[UserModeration] ⚠️  Failed to get user", "user_id", userID, "error", err)
 		return false, ""
 	}
 
@@ -48,19 +105,26 @@ func (um *UserModeration) CheckBanStatus(userID string) (isBanned bool, banMessa
 
 	banMessage = user.BanMessage
 	if banMessage == "" {
-		banMessage = "You have been temporarily restricted due to irrelevant messages. Please try again later."
+		banMessage = um.config.render(ModerationMessageBanned, 0, user.Language)
 	}
 
-	log.Log.Infof("[UserModeration] 🚫 User is banned | UserID: %s | BanUntil: %v", userID, user.BanUntil)
+	log.Log.Info("[UserModeration] 🚫 User is banned", "user_id", userID, "ban_until", user.BanUntil)
 	return true, banMessage
 }
 
 // ProcessNonsenseCheck checks if message is nonsense and handles auto-ban logic
 // Returns (shouldBan, banMessage, error)
 func (um *UserModeration) ProcessNonsenseCheck(ctx context.Context, userID string, userMessage string) (shouldBan bool, banMessage string, err error) {
+	if um.allowed[userID] {
+		return false, "", nil
+	}
+	if utf8.RuneCountInString(strings.TrimSpace(userMessage)) < um.config.MinMessageLength {
+		return false, "", nil
+	}
+
 	user, err := um.getUser(userID)
 	if err != nil {
-		log.Log.Warnf("[UserModeration] ⚠️  Failed to get user | UserID: %s | Error: %v", userID, err)
+		log.Log.Warn("[UserModeration] ⚠️  Failed to get user", "user_id", userID, "error", err)
 		return false, "", err
 	}
 
@@ -69,20 +133,24 @@ func (um *UserModeration) ProcessNonsenseCheck(ctx context.Context, userID strin
 	}
 
 	// Fast check first
-	isNonsense := um.isNonsenseFast(userMessage)
+	isNonsenseFast := um.isNonsenseFast
+	if um.config.FastCheck != nil {
+		isNonsenseFast = um.config.FastCheck
+	}
+	isNonsense := isNonsenseFast(userMessage)
 
 	// Use LLM verification if user has previous warnings
-	if isNonsense && user.NonsenseCount > 0 {
+	if isNonsense && user.NonsenseCount > 0 && !um.config.DisableLLMCheck {
 		// Ensure user_id is in context for LLM call
 		ctx = model.WithUserID(ctx, userID)
 		llmNonsense, err := um.isNonsenseLLM(ctx, userMessage)
 		if err != nil {
-			log.Log.Warnf("[UserModeration] ⚠️  Failed to verify with LLM, using fast check result | Error: %v", err)
+			log.Log.Warn("[UserModeration] ⚠️  Failed to verify with LLM, using fast check result", "error", err)
 		} else {
 			isNonsense = llmNonsense
 		}
 	} else if isNonsense {
-		log.Log.Infof("[UserModeration] ⚠️  Fast check detected nonsense (first time) | UserID: %s", userID)
+		log.Log.Info("[UserModeration] ⚠️  Fast check detected nonsense (first time)", "user_id", userID)
 	}
 
 	if !isNonsense {
@@ -90,7 +158,7 @@ func (um *UserModeration) ProcessNonsenseCheck(ctx context.Context, userID strin
 		if user.NonsenseCount > 0 {
 			user.ResetNonsenseCount()
 			if err := um.saveUser(user); err != nil {
-				log.Log.Warnf("[UserModeration] ⚠️  Failed to reset nonsense count | UserID: %s | Error: %v", userID, err)
+				log.Log.Warn("[UserModeration] ⚠️  Failed to reset nonsense count", "user_id", userID, "error", err)
 			}
 		}
 		return false, "", nil
@@ -98,38 +166,91 @@ func (um *UserModeration) ProcessNonsenseCheck(ctx context.Context, userID strin
 
 	// Handle nonsense message
 	user.IncrementNonsenseCount()
-	log.Log.Infof("[UserModeration] ⚠️  Nonsense message detected | UserID: %s | Count: %d", userID, user.NonsenseCount)
+	log.Log.Info("[UserModeration] ⚠️  Nonsense message detected", "user_id", userID, "count", user.NonsenseCount)
 
-	banDuration, banMessage := um.calculateBanDuration(user.NonsenseCount)
+	banDuration, banMessage := um.calculateBanDuration(user.NonsenseCount, user.Language)
 
 	if banDuration > 0 {
 		user.Ban(banDuration, banMessage)
 		if err := um.saveUser(user); err != nil {
-			log.Log.Errorf("[UserModeration] ❌ Failed to save user ban | UserID: %s | Error: %v", userID, err)
+			log.Log.Error("[UserModeration] ❌ Failed to save user ban", "user_id", userID, "error", err)
 			return false, "", err
 		}
-		log.Log.Infof("[UserModeration] 🚫 User auto-banned | UserID: %s | Duration: %v | Count: %d", userID, banDuration, user.NonsenseCount)
+		log.Log.Info("[UserModeration] 🚫 User auto-banned", "user_id", userID, "duration", banDuration, "count", user.NonsenseCount)
+		um.record(ctx, user, model.ModerationEventNonsenseStrike, "", 0)
+		um.record(ctx, user, model.ModerationEventBan, banMessage, banDuration)
 		return true, banMessage, nil
 	}
 
 	// Save updated nonsense count (warning only, no ban)
 	if err := um.saveUser(user); err != nil {
-		log.Log.Warnf("[UserModeration] ⚠️  Failed to save user | UserID: %s | Error: %v", userID, err)
+		log.Log.Warn("[UserModeration] ⚠️  Failed to save user", "user_id", userID, "error", err)
 	}
+	um.record(ctx, user, model.ModerationEventNonsenseStrike, banMessage, 0)
 	return false, banMessage, nil
 }
 
+// UnbanUser lifts a user's ban in sessionStore and resets their nonsense strikes (admin action),
+// for callers without a CoreHandler. The store must support user management
+// (GetOrCreateUser/PutUser); the unban is recorded if it keeps a moderation history.
+func UnbanUser(sessionStore model.SessionStore, userID string, reason string) error {
+	return unbanUser(sessionStore, userID, model.ModerationActorAdmin, "", reason)
+}
+
+// unbanUser lifts a user's ban and records the unban on behalf of actor
+func unbanUser(sessionStore model.SessionStore, userID, actor, messageID, reason string) error {
+	if userID == "" {
+		return fmt.Errorf("user_id is required")
+	}
+	userStore, ok := sessionStore.(interface {
+		GetOrCreateUser(string) (*model.User, error)
+		PutUser(*model.User) error
+	})
+	if !ok {
+		return fmt.Errorf("store does not support user management")
+	}
+	user, err := userStore.GetOrCreateUser(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	wasBanned := user.IsCurrentlyBanned()
+	user.Unban()
+	if err := userStore.PutUser(user); err != nil {
+		return fmt.Errorf("failed to save user unban: %w", err)
+	}
+
+	event := model.NewModerationEvent(userID, model.ModerationEventUnban, actor)
+	event.MessageID = messageID
+	event.Reason = reason
+	recordModerationEvent(sessionStore, event)
+
+	log.Log.Info("[UserModeration] ✅ User unbanned", "user_id", userID, "actor", actor, "was_banned", wasBanned)
+	return nil
+}
+
+// recordModerationEvent adds an event to the moderation audit trail if the store keeps one
+func recordModerationEvent(sessionStore model.SessionStore, event *model.ModerationEvent) {
+	eventStore, ok := sessionStore.(model.ModerationEventStore)
+	if !ok {
+		return
+	}
+	if err := eventStore.PutModerationEvent(event); err != nil {
+		log.Log.Warn("[UserModeration] ⚠️  Failed to record moderation event", "user_id", event.UserID, "type", event.Type, "error", err)
+	}
+}
+
 // calculateBanDuration calculates ban duration and message based on nonsense count
-// Auto-ban thresholds: 3 messages = 1 hour, 5 messages = 6 hours, 7+ messages = 24 hours
-func (um *UserModeration) calculateBanDuration(nonsenseCount int) (time.Duration, string) {
-	switch {
-	case nonsenseCount >= 7:
-		return 24 * time.Hour, "You have been restricted for 24 hours due to repeated irrelevant messages."
-	case nonsenseCount >= 5:
-		return 6 * time.Hour, "You have been restricted for 6 hours due to repeated irrelevant messages."
-	case nonsenseCount >= 3:
-		return 1 * time.Hour, "You have been restricted for 1 hour due to repeated irrelevant messages."
-	default:
-		return 0, "Please send meaningful messages."
+// (see ModerationConfig.BanStrikes). Below the ban threshold the message is the warning,
+// or "" while the strike count is below ModerationConfig.WarningStrikes. The message is in
+// language when it is translated.
+func (um *UserModeration) calculateBanDuration(nonsenseCount int, language string) (time.Duration, string) {
+	duration := um.config.banDuration(nonsenseCount)
+	if duration == 0 {
+		if !um.config.warns(nonsenseCount) {
+			return 0, ""
+		}
+		return 0, um.config.render(ModerationMessageWarning, 0, language)
 	}
+	return duration, um.config.render(ModerationMessageThrottle, duration.Hours(), language)
 }
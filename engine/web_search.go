@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ghiac/agentize/model"
+)
+
+// defaultWebSearchMaxCitations is the number of citations kept when
+// CoreHandlerConfig.WebSearchMaxCitations is 0
+const defaultWebSearchMaxCitations = 5
+
+// maxCitationSnippetRunes bounds the snippet of a citation
+const maxCitationSnippetRunes = 200
+
+// WebSearchResult is the answer of a search model with the sources it cites
+type WebSearchResult struct {
+	Answer    string           `json:"answer"`
+	Citations []model.Citation `json:"citations,omitempty"`
+}
+
+// ToolContent returns what the web search tools give the model: compact JSON with the answer and
+// its citations, or the plain answer when the search model cited no sources
+func (r *WebSearchResult) ToolContent() string {
+	if len(r.Citations) == 0 {
+		return r.Answer
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return r.Answer
+	}
+	return string(data)
+}
+
+// limitCitations keeps the first max citations (max < 0 drops them all)
+func (r *WebSearchResult) limitCitations(max int) {
+	if max < 0 {
+		r.Citations = nil
+	} else if len(r.Citations) > max {
+		r.Citations = r.Citations[:max]
+	}
+}
+
+var (
+	markdownLinkRe = regexp.MustCompile(`\[([^\]]*)\]\((https?://[^\s)]+)\)`)
+	bareURLRe      = regexp.MustCompile(`https?://[^\s<>()\[\]"'*]+`)
+)
+
+// ParseWebSearchResult reads the sources cited in a search model's answer. The go-openai client
+// does not expose the url_citation annotations of search models, so citations are taken from the
+// markdown links and bare URLs in the answer, in order of appearance and without duplicates
+// (tracking parameters such as utm_source are ignored when comparing URLs).
+func ParseWebSearchResult(answer string) *WebSearchResult {
+	result := &WebSearchResult{Answer: strings.TrimSpace(answer)}
+	seen := make(map[string]bool)
+	add := func(title, rawURL, line string) {
+		cleaned := cleanCitationURL(rawURL)
+		if cleaned == "" || seen[cleaned] {
+			return
+		}
+		seen[cleaned] = true
+		if strings.TrimSpace(title) == "" || strings.HasPrefix(title, "http") {
+			if u, err := url.Parse(cleaned); err == nil {
+				title = strings.TrimPrefix(u.Hostname(), "www.")
+			}
+		}
+		result.Citations = append(result.Citations, model.Citation{
+			Title:   strings.TrimSpace(title),
+			URL:     cleaned,
+			Snippet: citationSnippet(line),
+		})
+	}
+
+	for _, line := range strings.Split(result.Answer, "\n") {
+		for _, m := range markdownLinkRe.FindAllStringSubmatch(line, -1) {
+			add(m[1], m[2], line)
+		}
+		for _, rawURL := range bareURLRe.FindAllString(markdownLinkRe.ReplaceAllString(line, "$1"), -1) {
+			add("", strings.TrimRight(rawURL, ".,;:!?"), line)
+		}
+	}
+	return result
+}
+
+// cleanCitationURL drops tracking parameters and the fragment of a cited URL ("" if invalid)
+func cleanCitationURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.Fragment = ""
+	return u.String()
+}
+
+// citationSnippet returns the answer line citing a source, with links reduced to their text
+func citationSnippet(line string) string {
+	snippet := markdownLinkRe.ReplaceAllString(line, "$1")
+	snippet = strings.Trim(strings.TrimSpace(snippet), "-*•() ")
+	if runes := []rune(snippet); len(runes) > maxCitationSnippetRunes {
+		snippet = string(runes[:maxCitationSnippetRunes]) + "…"
+	}
+	return snippet
+}
+
+// toolSources collects the citations a tool call produced, for its ToolCall record
+type toolSources struct {
+	mu      sync.Mutex
+	sources []model.Citation
+}
+
+func (s *toolSources) set(sources []model.Citation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources = sources
+}
+
+func (s *toolSources) get() []model.Citation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sources
+}
+
+type toolSourcesCtxKey struct{}
+
+// withToolSources attaches a collector the web search tools report their citations to
+func withToolSources(ctx context.Context, s *toolSources) context.Context {
+	return context.WithValue(ctx, toolSourcesCtxKey{}, s)
+}
+
+// reportToolSources records the citations of the running tool call, if it is collecting them
+func reportToolSources(ctx context.Context, sources []model.Citation) {
+	if s, ok := ctx.Value(toolSourcesCtxKey{}).(*toolSources); ok && s != nil {
+		s.set(sources)
+	}
+}
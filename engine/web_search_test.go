@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+	"github.com/sashabaranov/go-openai"
+)
+
+const citedAnswer = `Go 1.22 changed loop variable scoping ([go.dev](https://go.dev/blog/loopvar-preview?utm_source=openai)).
+- Range over integers is also new [Release notes](https://go.dev/doc/go1.22).
+See https://go.dev/blog/loopvar-preview for details, and https://example.com/faq.`
+
+func TestParseWebSearchResult(t *testing.T) {
+	result := ParseWebSearchResult(citedAnswer)
+	want := []model.Citation{
+		{Title: "go.dev", URL: "https://go.dev/blog/loopvar-preview"},
+		{Title: "Release notes", URL: "https://go.dev/doc/go1.22"},
+		{Title: "example.com", URL: "https://example.com/faq"},
+	}
+	if len(result.Citations) != len(want) {
+		t.Fatalf("Expected %d citations, got %+v", len(want), result.Citations)
+	}
+	for i, c := range result.Citations {
+		if c.Title != want[i].Title || c.URL != want[i].URL {
+			t.Errorf("Citation %d: expected %s %s, got %s %s", i, want[i].Title, want[i].URL, c.Title, c.URL)
+		}
+	}
+	if got := result.Citations[1].Snippet; got != "Range over integers is also new Release notes." {
+		t.Errorf("Unexpected snippet %q", got)
+	}
+
+	var decoded WebSearchResult
+	if err := json.Unmarshal([]byte(result.ToolContent()), &decoded); err != nil || len(decoded.Citations) != 3 {
+		t.Errorf("Expected the tool content to be JSON with citations, got %s (%v)", result.ToolContent(), err)
+	}
+
+	// Answers without sources stay plain text
+	plain := ParseWebSearchResult("Paris is the capital of France.")
+	if len(plain.Citations) != 0 || plain.ToolContent() != "Paris is the capital of France." {
+		t.Errorf("Expected a plain-text fallback, got %q", plain.ToolContent())
+	}
+
+	result.limitCitations(1)
+	if len(result.Citations) != 1 {
+		t.Errorf("Expected 1 citation after limiting, got %d", len(result.Citations))
+	}
+}
+
+func TestCoreHandlerWebSearchSources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: citedAnswer},
+			FinishReason: openai.FinishReasonStop,
+		}}})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "root"), 0755)
+	os.WriteFile(filepath.Join(dir, "root", "node.md"), []byte("# Root"), 0644)
+	repo, err := fsrepo.NewNodeRepository(dir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	sqliteStore, err := store.NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLite store: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	agent := &Engine{Repo: repo, Sessions: sqliteStore}
+	config := DefaultCoreHandlerConfig()
+	config.WebSearchMaxCitations = 2
+	ch := NewCoreHandler(model.NewSessionHandler(sqliteStore, model.DefaultSessionHandlerConfig()), agent, agent, config)
+	if err := ch.UseLLMConfig(LLMConfig{BaseURL: server.URL, Model: "core"}); err != nil {
+		t.Fatalf("UseLLMConfig failed: %v", err)
+	}
+	coreSession, err := ch.getOrCreateCoreSession("user1")
+	if err != nil {
+		t.Fatalf("Failed to create core session: %v", err)
+	}
+
+	for i, id := range []string{"call_1", "call_2"} {
+		results, err := ch.executeCoreToolCalls(context.Background(), "user1", coreSession.SessionID, coreSession, "msg-1", []openai.ToolCall{{
+			ID: id, Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "web_search", Arguments: `{"query":"go 1.22"}`},
+		}})
+		if err != nil {
+			t.Fatalf("executeCoreToolCalls failed: %v", err)
+		}
+		var content WebSearchResult
+		if err := json.Unmarshal([]byte(results[0]), &content); err != nil || len(content.Citations) != 2 {
+			t.Fatalf("Call %d: expected JSON with 2 citations, got %s (%v)", i+1, results[0], err)
+		}
+	}
+
+	// Both the executed call and the cache hit keep their sources
+	saved, err := sqliteStore.GetToolCallsBySession(coreSession.SessionID)
+	if err != nil || len(saved) != 2 {
+		t.Fatalf("Expected 2 saved tool calls, got %d (%v)", len(saved), err)
+	}
+	for _, tc := range saved {
+		if len(tc.Sources) != 2 || tc.Sources[0].URL != "https://go.dev/blog/loopvar-preview" {
+			t.Errorf("%s (%s): expected 2 sources, got %+v", tc.ToolCallID, tc.Status, tc.Sources)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ghiac/agentize/log"
+)
+
+// Headers of webhook requests. WebhookSignatureHeader is "sha256=" followed by the hex HMAC-SHA256,
+// keyed with WebhookConfig.Secret, of the WebhookTimestampHeader value, a dot and the raw body.
+const (
+	WebhookSignatureHeader = "X-Agentize-Signature"
+	WebhookTimestampHeader = "X-Agentize-Timestamp"
+)
+
+// webhookVerification is sent in every payload so receivers know how to check the signature
+const webhookVerification = "Compute HMAC-SHA256 with your webhook secret over the " + WebhookTimestampHeader +
+	" header value, a '.' and the raw request body; hex-encode it and compare it in constant time with the " +
+	WebhookSignatureHeader + " header after its 'sha256=' prefix. Reject old timestamps to prevent replays."
+
+// Defaults of WebhookConfig
+const (
+	defaultWebhookQueueSize     = 1000
+	defaultWebhookFlushInterval = 2 * time.Second
+	defaultWebhookTimeout       = 10 * time.Second
+	defaultWebhookMaxRetries    = 3
+	defaultWebhookRetryBackoff  = time.Second
+)
+
+// WebhookConfig configures a WebhookCallback
+type WebhookConfig struct {
+	// URL receives the events as a JSON POST
+	URL string
+	// Secret signs every request (see WebhookSignatureHeader); empty sends unsigned requests
+	Secret string
+	// Events are the event types sent (default: EventMessage only, i.e. completed messages)
+	Events []EventType
+	// BatchSize sends up to this many events per request (<= 1: one request per event)
+	BatchSize int
+	// FlushInterval is how long a partial batch waits for more events (default: 2s)
+	FlushInterval time.Duration
+	// QueueSize bounds the events waiting to be sent; events are dropped when it is full (default: 1000)
+	QueueSize int
+	// Timeout bounds each request (default: 10s)
+	Timeout time.Duration
+	// MaxRetries is how often a failed request (network error, 429 or 5xx) is retried (default: 3, < 0: never)
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled for each further retry (default: 1s)
+	RetryBackoff time.Duration
+	// Client sends the requests (default: an http.Client with Timeout)
+	Client *http.Client
+}
+
+// WebhookPayload is the JSON body of a webhook request
+type WebhookPayload struct {
+	Events []WebhookEvent `json:"events"`
+	SentAt time.Time      `json:"sent_at"`
+	// Verification explains how to verify the request signature
+	Verification string `json:"verification,omitempty"`
+}
+
+// WebhookEvent is a UsageEvent as sent by WebhookCallback
+type WebhookEvent struct {
+	Type              EventType              `json:"type"`
+	Name              string                 `json:"name"`
+	UserID            string                 `json:"user_id"`
+	SessionID         string                 `json:"session_id,omitempty"`
+	Model             string                 `json:"model,omitempty"`
+	InputTokens       int                    `json:"input_tokens,omitempty"`
+	OutputTokens      int                    `json:"output_tokens,omitempty"`
+	CachedInputTokens int                    `json:"cached_input_tokens,omitempty"`
+	CostUSD           float64                `json:"cost_usd,omitempty"`
+	DurationMS        int64                  `json:"duration_ms"`
+	Error             string                 `json:"error,omitempty"`
+	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+	Time              time.Time              `json:"time"`
+}
+
+// WebhookCallback is a Callback that POSTs usage events to a URL, signed with HMAC-SHA256.
+// Events are queued and sent by a background goroutine with retries, so a slow or failing
+// endpoint never blocks message processing. Like PrometheusCallback it wraps an optional next
+// Callback: BeforeAction decisions are left to next and every event is passed on to it.
+//
+//	webhook, err := engine.NewWebhookCallback(engine.WebhookConfig{URL: url, Secret: secret}, billing)
+//	coreHandler.SetCallback(webhook)
+//	defer webhook.Close(ctx)
+type WebhookCallback struct {
+	next   Callback
+	config WebhookConfig
+	events map[EventType]bool
+
+	queue chan WebhookEvent
+	done  chan struct{}
+
+	mu      sync.RWMutex
+	closed  bool
+	dropped int
+	now     func() time.Time
+}
+
+// NewWebhookCallback creates a WebhookCallback and starts its sender. next may be nil.
+func NewWebhookCallback(config WebhookConfig, next Callback) (*WebhookCallback, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("webhook URL is required")
+	}
+	if len(config.Events) == 0 {
+		config.Events = []EventType{EventMessage}
+	}
+	if config.BatchSize < 1 {
+		config.BatchSize = 1
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultWebhookFlushInterval
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultWebhookQueueSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultWebhookTimeout
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = defaultWebhookMaxRetries
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultWebhookRetryBackoff
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: config.Timeout}
+	}
+
+	w := &WebhookCallback{
+		next:   next,
+		config: config,
+		events: make(map[EventType]bool, len(config.Events)),
+		queue:  make(chan WebhookEvent, config.QueueSize),
+		done:   make(chan struct{}),
+		now:    time.Now,
+	}
+	for _, eventType := range config.Events {
+		w.events[eventType] = true
+	}
+	go w.run()
+	return w, nil
+}
+
+// BeforeAction passes the event on to the wrapped callback
+func (w *WebhookCallback) BeforeAction(ctx context.Context, event *UsageEvent) error {
+	if w.next != nil {
+		return w.next.BeforeAction(ctx, event)
+	}
+	return nil
+}
+
+// AfterAction queues the event when its type is sent and passes it on to the wrapped callback.
+// It never waits for the endpoint: when the queue is full the event is dropped.
+func (w *WebhookCallback) AfterAction(ctx context.Context, event *UsageEvent) {
+	if w.events[event.EventType] {
+		w.enqueue(w.toWebhookEvent(event))
+	}
+	if w.next != nil {
+		w.next.AfterAction(ctx, event)
+	}
+}
+
+// Dropped returns how many events were dropped because the queue was full or the callback closed
+func (w *WebhookCallback) Dropped() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.dropped
+}
+
+// Close stops accepting events and waits until the queued events are sent or ctx is done
+func (w *WebhookCallback) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *WebhookCallback) enqueue(event WebhookEvent) {
+	w.mu.RLock()
+	if !w.closed {
+		select {
+		case w.queue <- event:
+			w.mu.RUnlock()
+			return
+		default:
+		}
+	}
+	w.mu.RUnlock()
+
+	w.mu.Lock()
+	w.dropped++
+	dropped := w.dropped
+	w.mu.Unlock()
+	log.Log.Warn("[Webhook] ⚠️  Event dropped", "type", event.Type, "user_id", event.UserID, "dropped", dropped)
+}
+
+func (w *WebhookCallback) toWebhookEvent(event *UsageEvent) WebhookEvent {
+	we := WebhookEvent{
+		Type:              event.EventType,
+		Name:              event.Name,
+		UserID:            event.UserID,
+		SessionID:         event.SessionID,
+		Model:             event.Model,
+		InputTokens:       event.InputTokens,
+		OutputTokens:      event.OutputTokens,
+		CachedInputTokens: event.CachedInputTokens,
+		CostUSD:           event.CostUSD,
+		DurationMS:        event.Duration.Milliseconds(),
+		Time:              w.now(),
+	}
+	if event.Error != nil {
+		we.Error = event.Error.Error()
+	}
+	if len(event.Metadata) > 0 {
+		// Metadata values that cannot be encoded are left out rather than failing the batch
+		if _, err := json.Marshal(event.Metadata); err == nil {
+			we.Metadata = event.Metadata
+		}
+	}
+	return we
+}
+
+// run sends the queued events in batches until the queue is closed
+func (w *WebhookCallback) run() {
+	defer close(w.done)
+	var batch []WebhookEvent
+	timer := time.NewTimer(w.config.FlushInterval)
+	timer.Stop()
+
+	flush := func() {
+		if len(batch) > 0 {
+			w.send(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case event, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= w.config.BatchSize {
+				timer.Stop()
+				flush()
+			} else if len(batch) == 1 {
+				timer.Reset(w.config.FlushInterval)
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// send POSTs one batch, retrying network errors, 429 and 5xx responses with exponential backoff
+func (w *WebhookCallback) send(batch []WebhookEvent) {
+	body, err := json.Marshal(WebhookPayload{Events: batch, SentAt: w.now().UTC(), Verification: webhookVerification})
+	if err != nil {
+		log.Log.Error("[Webhook] ❌ Failed to encode events", "count", len(batch), "error", err)
+		return
+	}
+
+	backoff := w.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body)
+		if err == nil {
+			log.Log.Debug("[Webhook] ✅ Events sent", "count", len(batch), "attempt", attempt+1)
+			return
+		}
+		if !retry || attempt >= w.config.MaxRetries {
+			log.Log.Error("[Webhook] ❌ Failed to send events", "count", len(batch), "attempts", attempt+1, "error", err)
+			return
+		}
+		log.Log.Warn("[Webhook] ⚠️  Send failed, retrying", "count", len(batch), "attempt", attempt+1, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends body once; retry reports whether a failure is worth retrying
+func (w *WebhookCallback) post(body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.config.Secret != "" {
+		timestamp := strconv.FormatInt(w.now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(w.config.Secret, timestamp, body))
+	}
+
+	resp, err := w.config.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// SignWebhook returns the hex HMAC-SHA256 signature of a webhook request (see WebhookSignatureHeader)
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook reports whether signature, the WebhookSignatureHeader value of a request, matches
+// its timestamp and body. Receivers in Go can use it instead of computing the signature themselves.
+func VerifyWebhook(secret, timestamp string, body []byte, signature string) bool {
+	expected := "sha256=" + SignWebhook(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
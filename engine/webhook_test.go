@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookCallback(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []WebhookPayload
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if !VerifyWebhook("secret", r.Header.Get(WebhookTimestampHeader), body, r.Header.Get(WebhookSignatureHeader)) {
+			t.Errorf("Invalid signature %q", r.Header.Get(WebhookSignatureHeader))
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Invalid payload %s: %v", body, err)
+		}
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	next := &budgetCallback{err: errors.New("balance exhausted")}
+	webhook, err := NewWebhookCallback(WebhookConfig{
+		URL:          server.URL,
+		Secret:       "secret",
+		BatchSize:    2,
+		RetryBackoff: time.Millisecond,
+	}, next)
+	if err != nil {
+		t.Fatalf("NewWebhookCallback failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := webhook.BeforeAction(ctx, &UsageEvent{EventType: EventLLMCall}); err == nil {
+		t.Error("Expected the wrapped callback to block the LLM call")
+	}
+	webhook.AfterAction(ctx, &UsageEvent{UserID: "u1", EventType: EventMessage, Name: "text", Duration: 1500 * time.Millisecond})
+	webhook.AfterAction(ctx, &UsageEvent{UserID: "u1", EventType: EventLLMCall, Model: "gpt-4o"}) // not sent by default
+	webhook.AfterAction(ctx, &UsageEvent{UserID: "u2", EventType: EventMessage, Name: "image", Error: errors.New("failed")})
+	webhook.AfterAction(ctx, &UsageEvent{UserID: "u3", EventType: EventMessage, Name: "text"})
+
+	closeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := webhook.Close(closeCtx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	webhook.AfterAction(ctx, &UsageEvent{UserID: "u4", EventType: EventMessage})
+	if webhook.Dropped() != 1 {
+		t.Errorf("Expected the event after Close to be dropped, got %d dropped", webhook.Dropped())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 3 {
+		t.Errorf("Expected a retry and 2 batches, got %d attempts", attempts)
+	}
+	if len(payloads) != 2 || len(payloads[0].Events) != 2 || len(payloads[1].Events) != 1 {
+		t.Fatalf("Expected batches of 2 and 1 events, got %+v", payloads)
+	}
+	first := payloads[0].Events
+	if first[0].UserID != "u1" || first[0].DurationMS != 1500 || first[1].Error != "failed" {
+		t.Errorf("Unexpected events %+v", first)
+	}
+	if payloads[0].Verification == "" {
+		t.Error("Expected signature verification guidance in the payload")
+	}
+}
@@ -0,0 +1,230 @@
+package fsrepo
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+)
+
+// ErrRoutingCycle is returned when loading a tree whose routing contains a cycle
+// (unless cycles are allowed, see SetAllowCycles)
+var ErrRoutingCycle = errors.New("routing cycle in knowledge tree")
+
+// TreeGraph is the routing graph of a loaded knowledge tree.
+// Edges are the children a node can route to: the rule and default targets of conditional
+// nodes, and every child of other nodes, plus targets given as full paths anywhere in the tree.
+type TreeGraph struct {
+	Children    map[string][]string // node path -> routing targets, sorted
+	Parents     map[string][]string // node path -> nodes routing to it, sorted
+	Depth       map[string]int      // shortest routing distance from root; absent when unreachable
+	Cycles      [][]string          // each cycle as a path starting and ending at the same node
+	Unreachable []string            // nodes routing can never reach from root, sorted
+}
+
+// analyzeTree builds the routing graph of nodes and finds cycles and unreachable nodes
+func analyzeTree(nodes map[string]*model.Node) *TreeGraph {
+	g := &TreeGraph{
+		Children: make(map[string][]string, len(nodes)),
+		Parents:  make(map[string][]string, len(nodes)),
+		Depth:    make(map[string]int, len(nodes)),
+	}
+
+	paths := make([]string, 0, len(nodes))
+	for p := range nodes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		targets := routingTargets(p, nodes[p], nodes)
+		g.Children[p] = targets
+		for _, target := range targets {
+			g.Parents[target] = append(g.Parents[target], p)
+		}
+	}
+	for _, parents := range g.Parents {
+		sort.Strings(parents)
+	}
+
+	// Depth: breadth-first from root
+	if _, ok := nodes["root"]; ok {
+		g.Depth["root"] = 0
+		queue := []string{"root"}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, next := range g.Children[current] {
+				if _, seen := g.Depth[next]; !seen {
+					g.Depth[next] = g.Depth[current] + 1
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+	for _, p := range paths {
+		if _, ok := g.Depth[p]; !ok {
+			g.Unreachable = append(g.Unreachable, p)
+		}
+	}
+
+	// Cycles: depth-first search, a back edge to a node on the stack closes a cycle
+	const (
+		unvisited = iota
+		onStack
+		done
+	)
+	state := make(map[string]int, len(paths))
+	var stack []string
+	var visit func(p string)
+	visit = func(p string) {
+		state[p] = onStack
+		stack = append(stack, p)
+		for _, next := range g.Children[p] {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case onStack:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == next {
+						cycle := append(append([]string{}, stack[i:]...), next)
+						g.Cycles = append(g.Cycles, cycle)
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[p] = done
+	}
+	for _, p := range paths {
+		if state[p] == unvisited {
+			visit(p)
+		}
+	}
+	return g
+}
+
+// routingTargets returns the nodes the node at p can route to, sorted
+func routingTargets(p string, node *model.Node, nodes map[string]*model.Node) []string {
+	set := make(map[string]bool)
+	resolve := func(next string) {
+		if next == "" {
+			return
+		}
+		if _, ok := nodes[p+"/"+next]; ok {
+			set[p+"/"+next] = true
+		} else if _, ok := nodes[next]; ok {
+			set[next] = true
+		}
+	}
+	for _, rule := range node.Routing.Rules {
+		resolve(rule.Next)
+	}
+	resolve(node.Routing.Default)
+
+	// Only conditional routing is limited to its rules; other modes can pick any child
+	if node.Routing.EffectiveMode() != model.RoutingConditional {
+		for candidate := range nodes {
+			if path.Dir(candidate) == p && candidate != p {
+				set[candidate] = true
+			}
+		}
+	}
+
+	targets := make([]string, 0, len(set))
+	for target := range set {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// checkGraph logs what analyzeTree found and returns ErrRoutingCycle if the tree has a
+// cycle and cycles are not allowed
+func (r *NodeRepository) checkGraph(g *TreeGraph) error {
+	if len(g.Unreachable) > 0 {
+		log.Log.Warn("[NodeRepository] ⚠️  Nodes not reachable from root by routing", "paths", strings.Join(g.Unreachable, ", "))
+	}
+	if len(g.Cycles) == 0 {
+		return nil
+	}
+	cycles := make([]string, len(g.Cycles))
+	for i, cycle := range g.Cycles {
+		cycles[i] = strings.Join(cycle, " -> ")
+	}
+	if r.allowCycles {
+		log.Log.Warn("[NodeRepository] ⚠️  Routing cycles in knowledge tree", "cycles", strings.Join(cycles, "; "))
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrRoutingCycle, strings.Join(cycles, "; "))
+}
+
+// SetAllowCycles makes routing cycles a logged warning instead of a load error
+func (r *NodeRepository) SetAllowCycles(allow bool) {
+	r.allowCycles = allow
+}
+
+// SetAllowJump lets engines move sessions straight to any node of the tree (Engine.JumpTo
+// via the goto_node tool) instead of only along routing
+func (r *NodeRepository) SetAllowJump(allow bool) {
+	r.allowJump = allow
+}
+
+// AllowsJump reports whether SetAllowJump enabled jumping to arbitrary nodes
+func (r *NodeRepository) AllowsJump() bool {
+	return r.allowJump
+}
+
+// routingGraph returns the graph of the last full load, or nil before the tree was loaded
+func (r *NodeRepository) routingGraph() *TreeGraph {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.graph
+}
+
+// GetParents returns the nodes that can route to path (its directory parent and any node
+// naming it in routing rules), or nil before the tree was loaded with Load or Reload
+func (r *NodeRepository) GetParents(path string) []string {
+	if g := r.routingGraph(); g != nil {
+		return append([]string(nil), g.Parents[path]...)
+	}
+	return nil
+}
+
+// GetDepth returns the shortest routing distance from root to path (root is 0).
+// ok is false if path is unreachable or the tree was not loaded with Load or Reload.
+func (r *NodeRepository) GetDepth(path string) (depth int, ok bool) {
+	if g := r.routingGraph(); g != nil {
+		depth, ok = g.Depth[path]
+	}
+	return depth, ok
+}
+
+// GetAllPathsFrom returns every node reachable by routing from path, nearest first
+// (path itself excluded)
+func (r *NodeRepository) GetAllPathsFrom(path string) []string {
+	g := r.routingGraph()
+	if g == nil {
+		return nil
+	}
+	seen := map[string]bool{path: true}
+	var result []string
+	queue := []string{path}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range g.Children[current] {
+			if !seen[next] {
+				seen[next] = true
+				result = append(result, next)
+				queue = append(queue, next)
+			}
+		}
+	}
+	return result
+}
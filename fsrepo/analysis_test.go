@@ -0,0 +1,53 @@
+package fsrepo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNodeRepositoryRoutingGraph(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/node.yaml":     {Data: []byte("routing:\n  mode: \"conditional\"\n  rules:\n    - when: 'vars.x == \"1\"'\n      next: \"a\"\n  default: \"b\"\n")},
+		"root/a/node.md":     {Data: []byte("# A")},
+		"root/a/x/node.md":   {Data: []byte("# X")},
+		"root/b/node.md":     {Data: []byte("# B")},
+		"root/c/node.md":     {Data: []byte("# C")},
+		"root/c/sub/node.md": {Data: []byte("# Sub")},
+	}
+	repo, err := NewNodeRepositoryFromFS(fsys)
+	if err != nil {
+		t.Fatalf("NewNodeRepositoryFromFS failed: %v", err)
+	}
+	if err := repo.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if depth, ok := repo.GetDepth("root/a/x"); !ok || depth != 2 {
+		t.Errorf("GetDepth(root/a/x) = %d, %v; want 2, true", depth, ok)
+	}
+	if _, ok := repo.GetDepth("root/c/sub"); ok {
+		t.Error("root/c/sub should be unreachable: the conditional root never routes to c")
+	}
+	if got := repo.GetParents("root/a/x"); !reflect.DeepEqual(got, []string{"root/a"}) {
+		t.Errorf("GetParents(root/a/x) = %v", got)
+	}
+	if got := repo.GetAllPathsFrom("root"); !reflect.DeepEqual(got, []string{"root/a", "root/b", "root/a/x"}) {
+		t.Errorf("GetAllPathsFrom(root) = %v", got)
+	}
+
+	// A rule pointing back up the tree closes a cycle
+	fsys["root/a/x/node.yaml"] = &fstest.MapFile{Data: []byte("routing:\n  default: \"root\"\n")}
+	repo, _ = NewNodeRepositoryFromFS(fsys)
+	if err := repo.Load(); !errors.Is(err, ErrRoutingCycle) {
+		t.Fatalf("Load error = %v, want ErrRoutingCycle", err)
+	}
+	repo.SetAllowCycles(true)
+	if err := repo.Load(); err != nil {
+		t.Fatalf("Load with cycles allowed failed: %v", err)
+	}
+	if got := repo.GetParents("root"); !reflect.DeepEqual(got, []string{"root/a/x"}) {
+		t.Errorf("GetParents(root) = %v, want the cycle back edge", got)
+	}
+}
@@ -0,0 +1,47 @@
+package fsrepo
+
+import (
+	"path"
+
+	"github.com/ghiac/agentize/model"
+)
+
+// ResolvePermissions resolves the permissions of userID (member of groups) on the node at nodePath.
+// Explicit entries win first: the node's users, then groups, then those of each ancestor while
+// auth.inherit is set. Otherwise the nearest non-empty default applies, and finally the root's
+// auth.policy. Returns nil when nothing matches and the policy allows everyone.
+func (r *NodeRepository) ResolvePermissions(nodePath string, userID string, groups []string) *model.Permissions {
+	var chain []*model.Node
+	for p := nodePath; ; p = path.Dir(p) {
+		node, err := r.LoadNode(p)
+		if err != nil {
+			break
+		}
+		chain = append(chain, node)
+		if !node.Auth.Inherit || path.Dir(p) == "." {
+			break
+		}
+	}
+
+	for _, node := range chain {
+		if perms := node.MatchPermissions(userID, nil, groups); perms != nil {
+			return perms
+		}
+	}
+	for _, node := range chain {
+		if !node.Auth.Default.IsZero() {
+			return node.Auth.Default
+		}
+	}
+
+	if root, err := r.LoadNode("root"); err == nil && root.Auth.Policy == model.AuthPolicyDeny {
+		return &model.Permissions{}
+	}
+	return nil
+}
+
+// CanUser reports whether userID (member of groups) has flag (model.PermRead, ...) on the node at nodePath
+func (r *NodeRepository) CanUser(nodePath string, userID string, groups []string, flag rune) bool {
+	perms := r.ResolvePermissions(nodePath, userID, groups)
+	return perms == nil || perms.HasPermission(flag)
+}
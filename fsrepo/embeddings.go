@@ -0,0 +1,175 @@
+package fsrepo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+)
+
+// Embedder computes one embedding vector per text (e.g. engine.EmbeddingProvider.Embed)
+type Embedder func(ctx context.Context, texts []string) ([][]float32, error)
+
+// SetEmbedder enables node embeddings for semantic routing: every load and reload embeds the
+// title and description of each node. Vectors are cached in memory and, when cachePath is set,
+// in a JSON file keyed by the SHA256 of the embedded text, so only changed nodes are embedded
+// again across restarts. Use one cache file per embedding model.
+func (r *NodeRepository) SetEmbedder(embedder Embedder, cachePath string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.embedder = embedder
+	r.embeddingCachePath = cachePath
+	r.embeddingsByHash = nil
+}
+
+// NodeEmbedding returns the embedding of the node at path, if it has been computed
+func (r *NodeRepository) NodeEmbedding(path string) ([]float32, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	vector, ok := r.embeddings[path]
+	return vector, ok
+}
+
+// EnsureEmbeddings embeds the cached nodes whose text has no embedding yet. It runs after each
+// load when an embedder is set; call it directly to retry after a failure.
+func (r *NodeRepository) EnsureEmbeddings(ctx context.Context) error {
+	r.mu.RLock()
+	embedder := r.embedder
+	cachePath := r.embeddingCachePath
+	byHash := r.embeddingsByHash
+	nodes := make(map[string]*model.Node, len(r.cache))
+	for path, node := range r.cache {
+		nodes[path] = node
+	}
+	r.mu.RUnlock()
+
+	if embedder == nil {
+		return fmt.Errorf("embedder not configured")
+	}
+	if byHash == nil {
+		var err error
+		if byHash, err = loadEmbeddingCache(cachePath); err != nil {
+			log.Log.Warn("[NodeRepository] ⚠️  Ignoring unreadable embedding cache", "path", cachePath, "error", err)
+			byHash = make(map[string][]float32)
+		}
+	}
+
+	hashes := make(map[string]string, len(nodes)) // node path -> text hash
+	var missing, missingHashes []string
+	for path, node := range nodes {
+		text := embeddingText(node)
+		if text == "" {
+			continue
+		}
+		hash := r.calculateHash(text)
+		hashes[path] = hash
+		if _, ok := byHash[hash]; !ok {
+			missing = append(missing, text)
+			missingHashes = append(missingHashes, hash)
+		}
+	}
+
+	if len(missing) > 0 {
+		vectors, err := embedder(ctx, missing)
+		if err != nil {
+			return fmt.Errorf("failed to embed nodes: %w", err)
+		}
+		if len(vectors) != len(missing) {
+			return fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(missing))
+		}
+		for i, hash := range missingHashes {
+			byHash[hash] = vectors[i]
+		}
+		if cachePath != "" {
+			if err := saveEmbeddingCache(cachePath, byHash, hashes); err != nil {
+				log.Log.Warn("[NodeRepository] ⚠️  Failed to save embedding cache", "path", cachePath, "error", err)
+			}
+		}
+	}
+
+	embeddings := make(map[string][]float32, len(hashes))
+	for path, hash := range hashes {
+		embeddings[path] = byHash[hash]
+	}
+
+	r.mu.Lock()
+	r.embeddings = embeddings
+	r.embeddingsByHash = byHash
+	r.mu.Unlock()
+
+	log.Log.Info("[NodeRepository] 🧮 Node embeddings ready", "nodes", len(embeddings), "embedded", len(missing))
+	return nil
+}
+
+// refreshEmbeddings runs EnsureEmbeddings after a load when an embedder is set; failures are
+// logged and leave semantic routing to fall back
+func (r *NodeRepository) refreshEmbeddings() {
+	r.mu.RLock()
+	enabled := r.embedder != nil
+	r.mu.RUnlock()
+	if !enabled {
+		return
+	}
+	if err := r.EnsureEmbeddings(context.Background()); err != nil {
+		log.Log.Warn("[NodeRepository] ⚠️  Failed to compute node embeddings", "error", err)
+	}
+}
+
+// embeddingText is what a node is embedded from: its title and description
+// (the summary when it has no description)
+func embeddingText(node *model.Node) string {
+	description := node.Description
+	if description == "" {
+		description = node.Summary
+	}
+	return strings.TrimSpace(node.Title + "\n" + description)
+}
+
+// loadEmbeddingCache reads the hash -> vector cache file; a missing file is an empty cache
+func loadEmbeddingCache(path string) (map[string][]float32, error) {
+	cache := make(map[string][]float32)
+	if path == "" {
+		return cache, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// saveEmbeddingCache writes the vectors of the current nodes (keep: node path -> hash), so
+// vectors of deleted or edited nodes do not pile up in the file
+func saveEmbeddingCache(path string, byHash map[string][]float32, keep map[string]string) error {
+	current := make(map[string][]float32, len(keep))
+	for _, hash := range keep {
+		current[hash] = byHash[hash]
+	}
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
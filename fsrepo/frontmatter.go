@@ -0,0 +1,48 @@
+package fsrepo
+
+import (
+	"bytes"
+)
+
+// frontMatterDelimiter opens and closes a YAML front matter block at the top of node.md
+const frontMatterDelimiter = "---"
+
+// splitFrontMatter splits node.md into its leading YAML front matter and the markdown body.
+//
+//	---
+//	id: "billing"
+//	title: "Billing"
+//	---
+//	# Billing
+//
+// front is returned with the opening delimiter line blanked out, so YAML line numbers
+// match the lines of node.md. ok is false (and body is data) when there is no front matter.
+func splitFrontMatter(data []byte) (front []byte, body []byte, ok bool) {
+	firstEnd := bytes.IndexByte(data, '\n')
+	if firstEnd < 0 || string(bytes.TrimRight(data[:firstEnd], "\r")) != frontMatterDelimiter {
+		return nil, data, false
+	}
+
+	offset := firstEnd + 1
+	for offset <= len(data) {
+		lineEnd := bytes.IndexByte(data[offset:], '\n')
+		next := len(data)
+		if lineEnd >= 0 {
+			next = offset + lineEnd
+		}
+		line := string(bytes.TrimRight(data[offset:next], "\r"))
+		if line == frontMatterDelimiter || line == "..." {
+			front = append([]byte("\n"), data[firstEnd+1:offset]...)
+			if next < len(data) {
+				next++
+			}
+			return front, data[next:], true
+		}
+		if lineEnd < 0 {
+			break
+		}
+		offset = next + 1
+	}
+	// An unterminated block is treated as plain markdown
+	return nil, data, false
+}
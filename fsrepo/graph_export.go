@@ -0,0 +1,227 @@
+package fsrepo
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ghiac/agentize/model"
+)
+
+// GraphFormat is an output format of ExportGraph
+type GraphFormat string
+
+const (
+	GraphFormatDOT     GraphFormat = "dot"     // Graphviz DOT
+	GraphFormatMermaid GraphFormat = "mermaid" // Mermaid flowchart
+	GraphFormatJSON    GraphFormat = "json"    // Graph as JSON
+)
+
+// Graph is a machine-readable view of the knowledge tree
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is one knowledge tree node in a Graph
+type GraphNode struct {
+	Path       string            `json:"path"`
+	ID         string            `json:"id,omitempty"`
+	Title      string            `json:"title"`
+	Routing    model.RoutingMode `json:"routing"`
+	Tools      []string          `json:"tools,omitempty"`
+	Restricted bool              `json:"restricted,omitempty"` // node has its own auth rules
+}
+
+// GraphEdge links a node to one of its children; Label is the routing condition leading there, if any
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label,omitempty"`
+}
+
+// GraphOption configures BuildGraph and ExportGraph
+type GraphOption func(*graphOptions)
+
+type graphOptions struct {
+	userID string
+	groups []string
+}
+
+// OptGraphUser limits the graph to nodes visible in graph (visible_in_graph) to userID,
+// member of groups. Without it every node is included.
+func OptGraphUser(userID string, groups ...string) GraphOption {
+	return func(o *graphOptions) {
+		o.userID = userID
+		o.groups = groups
+	}
+}
+
+// ExportGraph renders the knowledge tree as Graphviz DOT, a Mermaid flowchart or JSON
+func (r *NodeRepository) ExportGraph(format GraphFormat, opts ...GraphOption) ([]byte, error) {
+	graph, err := r.BuildGraph(opts...)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case GraphFormatDOT:
+		return []byte(graph.DOT()), nil
+	case GraphFormatMermaid:
+		return []byte(graph.Mermaid()), nil
+	case GraphFormatJSON:
+		return json.MarshalIndent(graph, "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown graph format %q (expected dot, mermaid or json)", format)
+	}
+}
+
+// BuildGraph walks the knowledge tree from the root into a Graph.
+// Nodes hidden from the requesting user are left out together with their subtrees.
+func (r *NodeRepository) BuildGraph(opts ...GraphOption) (*Graph, error) {
+	var o graphOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	graph := &Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	if _, err := r.LoadNode("root"); err != nil {
+		return nil, fmt.Errorf("failed to load root node: %w", err)
+	}
+	if o.userID != "" && !r.CanUser("root", o.userID, o.groups, model.PermVisibleGraph) {
+		return graph, nil
+	}
+	r.buildGraphRecursive("root", &o, graph)
+	return graph, nil
+}
+
+func (r *NodeRepository) buildGraphRecursive(nodePath string, o *graphOptions, graph *Graph) {
+	node, err := r.LoadNode(nodePath)
+	if err != nil {
+		return
+	}
+	graph.Nodes = append(graph.Nodes, graphNodeFor(node))
+
+	children, err := r.GetChildren(nodePath)
+	if err != nil {
+		return
+	}
+	for _, child := range children {
+		if o.userID != "" && !r.CanUser(child, o.userID, o.groups, model.PermVisibleGraph) {
+			continue
+		}
+		graph.Edges = append(graph.Edges, GraphEdge{From: nodePath, To: child, Label: routingLabel(node, child)})
+		r.buildGraphRecursive(child, o, graph)
+	}
+}
+
+func graphNodeFor(node *model.Node) GraphNode {
+	gn := GraphNode{
+		Path:    node.Path,
+		ID:      node.ID,
+		Title:   node.Title,
+		Routing: node.Routing.EffectiveMode(),
+	}
+	if gn.Title == "" {
+		gn.Title = node.ID
+	}
+	if gn.Title == "" {
+		gn.Title = path.Base(node.Path)
+	}
+	for _, tool := range node.Tools {
+		if tool.Status != model.ToolStatusHidden {
+			gn.Tools = append(gn.Tools, tool.Name)
+		}
+	}
+	auth := node.Auth
+	gn.Restricted = len(auth.Users) > 0 || len(auth.Groups) > 0 || len(auth.Roles) > 0 ||
+		!auth.Default.IsZero() || auth.Policy == model.AuthPolicyDeny
+	return gn
+}
+
+// routingLabel describes when node routes to child: the conditions of matching rules and/or "default"
+func routingLabel(node *model.Node, child string) string {
+	matches := func(next string) bool {
+		return next != "" && (next == child || next == path.Base(child))
+	}
+	var parts []string
+	for _, rule := range node.Routing.Rules {
+		if matches(rule.Next) {
+			parts = append(parts, rule.When)
+		}
+	}
+	if matches(node.Routing.Default) {
+		parts = append(parts, "default")
+	}
+	return strings.Join(parts, " | ")
+}
+
+// nodeLabel is the multi-line label of n in DOT and Mermaid output
+func (n GraphNode) nodeLabel() []string {
+	lines := []string{n.Title}
+	if len(n.Tools) > 0 {
+		lines = append(lines, "tools: "+strings.Join(n.Tools, ", "))
+	}
+	if n.Restricted {
+		lines = append(lines, "(restricted)")
+	}
+	return lines
+}
+
+// DOT renders the graph as Graphviz DOT
+func (g *Graph) DOT() string {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var sb strings.Builder
+	sb.WriteString("digraph knowledge {\n")
+	sb.WriteString("  rankdir=TB;\n")
+	sb.WriteString("  node [shape=box, style=rounded];\n")
+	for _, n := range g.Nodes {
+		attrs := fmt.Sprintf(`label="%s"`, quote.Replace(strings.Join(n.nodeLabel(), "\n")))
+		if len(n.Tools) > 0 {
+			attrs += `, style="rounded,filled", fillcolor="#fff3cd"`
+		}
+		if n.Restricted {
+			attrs += `, color="#c0392b", penwidth=2`
+		}
+		fmt.Fprintf(&sb, "  \"%s\" [%s];\n", quote.Replace(n.Path), attrs)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&sb, "  \"%s\" -> \"%s\"", quote.Replace(e.From), quote.Replace(e.To))
+		if e.Label != "" {
+			fmt.Fprintf(&sb, " [label=\"%s\"]", quote.Replace(e.Label))
+		}
+		sb.WriteString(";\n")
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart
+func (g *Graph) Mermaid() string {
+	quote := strings.NewReplacer(`"`, "#quot;", "\n", "<br/>")
+	ids := make(map[string]string, len(g.Nodes))
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	for i, n := range g.Nodes {
+		ids[n.Path] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&sb, "  %s[\"%s\"]\n", ids[n.Path], quote.Replace(strings.Join(n.nodeLabel(), "\n")))
+	}
+	for _, e := range g.Edges {
+		if e.Label != "" {
+			fmt.Fprintf(&sb, "  %s -->|\"%s\"| %s\n", ids[e.From], quote.Replace(e.Label), ids[e.To])
+		} else {
+			fmt.Fprintf(&sb, "  %s --> %s\n", ids[e.From], ids[e.To])
+		}
+	}
+	sb.WriteString("  classDef tools fill:#fff3cd\n")
+	sb.WriteString("  classDef restricted stroke:#c0392b,stroke-width:2px\n")
+	for _, n := range g.Nodes {
+		if len(n.Tools) > 0 {
+			fmt.Fprintf(&sb, "  class %s tools\n", ids[n.Path])
+		}
+		if n.Restricted {
+			fmt.Fprintf(&sb, "  class %s restricted\n", ids[n.Path])
+		}
+	}
+	return sb.String()
+}
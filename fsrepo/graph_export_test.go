@@ -0,0 +1,82 @@
+package fsrepo
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExportGraph(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/node.yaml": {Data: []byte(`title: "Support"
+routing:
+  mode: "conditional"
+  rules:
+    - when: 'vars.intent == "refund"'
+      next: "refund"
+  default: "sales"
+auth:
+  policy: "deny"
+  groups:
+    staff:
+      perms: "rg"
+`)},
+		"root/node.md":              {Data: []byte("# Support")},
+		"root/refund/node.md":       {Data: []byte("# Refund")},
+		"root/refund/tools.yaml":    {Data: []byte("tools:\n  - name: issue_refund\n    description: Refund\n")},
+		"root/sales/node.yaml":      {Data: []byte("title: \"Sales\"\nauth:\n  users:\n    - user_id: \"bob\"\n      visible_in_graph: false\n")},
+		"root/sales/node.md":        {Data: []byte("# Sales")},
+		"root/sales/leads/node.md":  {Data: []byte("# Leads")},
+		"root/refund/extra/node.md": {Data: []byte("# Extra")},
+	}
+	repo, err := NewNodeRepositoryFromFS(fsys)
+	if err != nil {
+		t.Fatalf("NewNodeRepositoryFromFS failed: %v", err)
+	}
+
+	dot, err := repo.ExportGraph(GraphFormatDOT)
+	if err != nil {
+		t.Fatalf("ExportGraph(dot) failed: %v", err)
+	}
+	for _, want := range []string{
+		`"root" -> "root/refund" [label="vars.intent == \"refund\""];`,
+		`"root" -> "root/sales" [label="default"];`,
+		`tools: issue_refund`,
+		`penwidth=2`,
+	} {
+		if !strings.Contains(string(dot), want) {
+			t.Errorf("DOT output missing %q:\n%s", want, dot)
+		}
+	}
+
+	mermaid, err := repo.ExportGraph(GraphFormatMermaid)
+	if err != nil {
+		t.Fatalf("ExportGraph(mermaid) failed: %v", err)
+	}
+	if !strings.HasPrefix(string(mermaid), "flowchart TD\n") || !strings.Contains(string(mermaid), `-->|"default"|`) {
+		t.Errorf("unexpected Mermaid output:\n%s", mermaid)
+	}
+
+	if _, err := repo.ExportGraph("svg"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+
+	// bob is staff but hidden from sales (and so from its subtree) by a user entry
+	graph, err := repo.BuildGraph(OptGraphUser("bob", "staff"))
+	if err != nil {
+		t.Fatalf("BuildGraph failed: %v", err)
+	}
+	var paths []string
+	for _, n := range graph.Nodes {
+		paths = append(paths, n.Path)
+	}
+	if got := strings.Join(paths, ","); got != "root,root/refund,root/refund/extra" {
+		t.Errorf("bob sees %s, want root,root/refund,root/refund/extra", got)
+	}
+
+	// Nobody else matches a rule and the root policy denies
+	graph, err = repo.BuildGraph(OptGraphUser("carol"))
+	if err != nil || len(graph.Nodes) != 0 {
+		t.Errorf("carol sees %+v (%v), want an empty graph", graph, err)
+	}
+}
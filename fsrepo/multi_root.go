@@ -0,0 +1,163 @@
+package fsrepo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+)
+
+// NewMultiRootRepository creates a read-only repository presenting the knowledge trees at paths
+// as one merged tree, e.g. a shared base tree followed by a tenant-specific overlay:
+//
+//	repo, err := fsrepo.NewMultiRootRepository("./knowledge/base", "./knowledge/acme")
+//
+// Precedence goes from first to last: a later root overrides the node with the same path (and
+// thus the same default ID) from earlier roots, and adds the nodes earlier roots don't have.
+// A node is overridden as a whole: its node.md, node.yaml and tools file come from the last
+// root defining any of them, so an overlay node.md without node.yaml does not inherit the base
+// node.yaml. Child nodes are merged, so an overlay can add a child under a base node without
+// redefining it. Other files (e.g. shared tool definitions in _shared) are taken from the last
+// root containing them. Each path must exist; together they must provide the "root" node.
+func NewMultiRootRepository(paths ...string) (*NodeRepository, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no knowledge root paths given")
+	}
+	if len(paths) == 1 {
+		return NewNodeRepository(paths[0])
+	}
+
+	overlay := &overlayFS{}
+	absPaths := make([]string, 0, len(paths))
+	for _, p := range paths {
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root path: %w", err)
+		}
+		if info, err := os.Stat(absPath); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("root path does not exist: %s", absPath)
+		}
+		overlay.roots = append(overlay.roots, os.DirFS(absPath))
+		absPaths = append(absPaths, absPath)
+	}
+	if info, err := fs.Stat(overlay, "root"); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("none of the knowledge roots has a \"root\" directory: %s", strings.Join(absPaths, ", "))
+	}
+
+	return &NodeRepository{
+		fsys:         overlay,
+		diskRoots:    absPaths,
+		source:       strings.Join(absPaths, " + "),
+		cache:        make(map[string]*model.Node),
+		fingerprints: make(map[string]string),
+		checkedAt:    make(map[string]time.Time),
+	}, nil
+}
+
+// overlayFS merges several file systems, later ones taking precedence (see NewMultiRootRepository)
+type overlayFS struct {
+	roots []fs.FS // lowest precedence first
+}
+
+// owner returns the root name is read from, nil when name does not exist in the merged view
+func (o *overlayFS) owner(name string) fs.FS {
+	if name != "." && isNodeFile(path.Base(name)) {
+		// Node files all come from the last root defining the node
+		dir := path.Dir(name)
+		for i := len(o.roots) - 1; i >= 0; i-- {
+			if definesNode(o.roots[i], dir) {
+				if _, err := fs.Stat(o.roots[i], name); err == nil {
+					return o.roots[i]
+				}
+				return nil
+			}
+		}
+		return nil
+	}
+	for i := len(o.roots) - 1; i >= 0; i-- {
+		if _, err := fs.Stat(o.roots[i], name); err == nil {
+			return o.roots[i]
+		}
+	}
+	return nil
+}
+
+// definesNode reports whether dir in fsys contains any of the files that define a node
+func definesNode(fsys fs.FS, dir string) bool {
+	for _, name := range []string{"node.md", "node.yaml", "tools.json", "tools.yaml"} {
+		if info, err := fs.Stat(fsys, path.Join(dir, name)); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// Open implements fs.FS. Directories opened this way list only the owning root's entries;
+// use fs.ReadDir (ReadDir below) for the merged listing.
+func (o *overlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	root := o.owner(name)
+	if root == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return root.Open(name)
+}
+
+// Stat implements fs.StatFS
+func (o *overlayFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	root := o.owner(name)
+	if root == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return fs.Stat(root, name)
+}
+
+// ReadDir implements fs.ReadDirFS, listing the entries of name across all roots
+func (o *overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	names := make(map[string]bool)
+	var lastErr error
+	found := false
+	for _, root := range o.roots {
+		entries, err := fs.ReadDir(root, name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		found = true
+		for _, entry := range entries {
+			names[entry.Name()] = true
+		}
+	}
+	if !found {
+		if lastErr == nil || errors.Is(lastErr, fs.ErrNotExist) {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, lastErr
+	}
+
+	merged := make([]fs.DirEntry, 0, len(names))
+	for entryName := range names {
+		info, err := o.Stat(path.Join(name, entryName))
+		if err != nil {
+			continue // a node file hidden by an overriding root
+		}
+		merged = append(merged, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+	return merged, nil
+}
@@ -0,0 +1,79 @@
+package fsrepo
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// CacheStats describes how well the node cache serves LoadNode
+type CacheStats struct {
+	Hits    int64 // LoadNode calls answered from the cache
+	Misses  int64 // LoadNode calls that parsed the node's files
+	Stale   int64 // cached nodes re-read because their files changed (see SetCacheRevalidation)
+	Entries int   // nodes currently cached
+}
+
+// SetCacheRevalidation makes LoadNode check a cached node's files (their size and modification
+// time) at most once per interval and re-read the node when they changed. 0, the default, trusts
+// the cache until Reload or InvalidateCache; that suits a tree that never changes or one kept in
+// sync by Watch, which reloads the whole tree on any change.
+func (r *NodeRepository) SetCacheRevalidation(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revalidateEvery = interval
+}
+
+// GetCacheStats returns the node cache hit/miss counters
+func (r *NodeRepository) GetCacheStats() CacheStats {
+	r.mu.RLock()
+	entries := len(r.cache)
+	r.mu.RUnlock()
+	return CacheStats{
+		Hits:    r.cacheHits.Load(),
+		Misses:  r.cacheMisses.Load(),
+		Stale:   r.cacheStale.Load(),
+		Entries: entries,
+	}
+}
+
+// isFresh reports whether the cached node at path can be served without re-reading it
+func (r *NodeRepository) isFresh(path string) bool {
+	r.mu.RLock()
+	interval := r.revalidateEvery
+	cached := r.fingerprints[path]
+	checkedAt := r.checkedAt[path]
+	r.mu.RUnlock()
+
+	if interval <= 0 || time.Since(checkedAt) < interval {
+		return true
+	}
+	current := nodeFingerprint(r.files(), path)
+	if current != cached {
+		return false
+	}
+	r.mu.Lock()
+	r.checkedAt[path] = time.Now()
+	r.mu.Unlock()
+	return true
+}
+
+// nodeFingerprint identifies the current state of a node's directory and files from their size
+// and modification time. The directory itself is included, so added or removed files count.
+func nodeFingerprint(fsys fs.FS, path string) string {
+	var sb strings.Builder
+	for _, name := range []string{"", "node.md", "node.yaml", "tools.json", "tools.yaml"} {
+		file := path
+		if name != "" {
+			file = path + "/" + name
+		}
+		info, err := fs.Stat(fsys, file)
+		if err != nil {
+			fmt.Fprintf(&sb, "%s:-;", name)
+			continue
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+	}
+	return sb.String()
+}
@@ -0,0 +1,500 @@
+package fsrepo
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghiac/agentize/log"
+)
+
+// DefaultRemoteWatchInterval is the polling interval used by RemoteLoader.Watch when none is given
+const DefaultRemoteWatchInterval = time.Minute
+
+// maxRemoteTreeBytes caps the unpacked size of a downloaded knowledge tree
+const maxRemoteTreeBytes = 512 << 20
+
+// RemoteSource describes where a knowledge tree is fetched from.
+//
+// URL is either an HTTP(S) archive (.tar.gz/.tgz, .tar or .zip, detected from its content)
+// or a git repository. Git is used when Ref is set or the URL ends in ".git"; it requires
+// the git binary on PATH.
+type RemoteSource struct {
+	URL string
+	// Ref is the git branch, tag or commit to check out (defaults to HEAD)
+	Ref string
+	// Subdir is the directory inside the archive or checkout that holds the "root" node.
+	// When empty, the top level is used, or the single top-level directory when the
+	// archive wraps everything in one (as GitHub archives do).
+	Subdir string
+}
+
+// isGit reports whether the source is a git repository rather than an archive
+func (s RemoteSource) isGit() bool {
+	return s.Ref != "" || strings.HasSuffix(s.URL, ".git")
+}
+
+// String describes the source for logs
+func (s RemoteSource) String() string {
+	if s.Ref != "" {
+		return s.URL + "@" + s.Ref
+	}
+	return s.URL
+}
+
+// RemoteLoader fetches a knowledge tree from a RemoteSource into a temporary directory
+// and builds a NodeRepository from it. It remembers the ETag (archives) or commit (git)
+// of the current tree, so Refresh only downloads and reloads when the source changed.
+type RemoteLoader struct {
+	source RemoteSource
+	client *http.Client
+
+	mu      sync.Mutex
+	version string // ETag, Last-Modified, content hash or git commit of the current tree
+	dir     string // temporary directory holding the current tree
+}
+
+// NewRemoteLoader creates a loader for source
+func NewRemoteLoader(source RemoteSource) *RemoteLoader {
+	return &RemoteLoader{
+		source: source,
+		client: http.DefaultClient,
+	}
+}
+
+// SetHTTPClient sets the client used to download archives (e.g. to add auth headers or timeouts)
+func (l *RemoteLoader) SetHTTPClient(client *http.Client) {
+	l.client = client
+}
+
+// Version returns the ETag or commit of the currently loaded tree
+func (l *RemoteLoader) Version() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.version
+}
+
+// Load fetches the tree and returns a repository reading from the local copy
+func (l *RemoteLoader) Load(ctx context.Context) (*NodeRepository, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dir, version, _, err := l.fetch(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	treeDir, err := treeRoot(dir, l.source.Subdir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	repo, err := NewNodeRepository(treeDir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	repo.source = l.source.String()
+
+	l.replaceDir(dir, version)
+	log.Log.Info("[RemoteLoader] ✅ Knowledge tree fetched", "source", l.source, "version", version)
+	return repo, nil
+}
+
+// Refresh checks the source for a new version and, if there is one, fetches it and swaps it
+// into repo. It returns true when the tree was replaced. On error repo keeps its current tree.
+func (l *RemoteLoader) Refresh(ctx context.Context, repo *NodeRepository) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dir, version, changed, err := l.fetch(ctx, l.version)
+	if err != nil || !changed {
+		return false, err
+	}
+	treeDir, err := treeRoot(dir, l.source.Subdir)
+	if err == nil {
+		err = repo.swapSource(os.DirFS(treeDir), treeDir, l.source.String())
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return false, err
+	}
+
+	l.replaceDir(dir, version)
+	log.Log.Info("[RemoteLoader] 🔄 Knowledge tree updated", "source", l.source, "version", version)
+	return true, nil
+}
+
+// Watch calls Refresh every interval until ctx is cancelled.
+// onReload, if non-nil, is called after every successful swap.
+func (l *RemoteLoader) Watch(ctx context.Context, repo *NodeRepository, interval time.Duration, onReload func()) {
+	if interval <= 0 {
+		interval = DefaultRemoteWatchInterval
+	}
+	log.Log.Info("[RemoteLoader] 👀 Watching remote knowledge tree", "source", l.source, "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Log.Info("[RemoteLoader] 🛑 Remote knowledge tree watcher stopped")
+			return
+		case <-ticker.C:
+			changed, err := l.Refresh(ctx, repo)
+			if err != nil {
+				log.Log.Error("[RemoteLoader] ❌ Remote reload failed, keeping previous tree", "error", err)
+				continue
+			}
+			if changed && onReload != nil {
+				onReload()
+			}
+		}
+	}
+}
+
+// Close removes the local copy of the tree. Repositories built by Load must not be used afterwards.
+func (l *RemoteLoader) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(l.dir)
+	l.dir = ""
+	return err
+}
+
+// replaceDir records the new tree and removes the previous local copy (caller holds mu)
+func (l *RemoteLoader) replaceDir(dir, version string) {
+	if l.dir != "" && l.dir != dir {
+		if err := os.RemoveAll(l.dir); err != nil {
+			log.Log.Warn("[RemoteLoader] ⚠️  Failed to remove old tree copy", "dir", l.dir, "error", err)
+		}
+	}
+	l.dir = dir
+	l.version = version
+}
+
+// fetch downloads the source into a new temporary directory unless its version equals known.
+// When changed is false no directory is returned.
+func (l *RemoteLoader) fetch(ctx context.Context, known string) (dir, version string, changed bool, err error) {
+	if l.source.isGit() {
+		return l.fetchGit(ctx, known)
+	}
+	return l.fetchArchive(ctx, known)
+}
+
+// fetchArchive downloads and unpacks an archive, using the ETag (or Last-Modified) for a
+// conditional request. Servers without either are compared by content hash.
+func (l *RemoteLoader) fetchArchive(ctx context.Context, known string) (string, string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.source.URL, nil)
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid knowledge tree URL: %w", err)
+	}
+	switch {
+	case strings.HasPrefix(known, "etag:"):
+		req.Header.Set("If-None-Match", strings.TrimPrefix(known, "etag:"))
+	case strings.HasPrefix(known, "modified:"):
+		req.Header.Set("If-Modified-Since", strings.TrimPrefix(known, "modified:"))
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to download knowledge tree: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return "", known, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", "", false, fmt.Errorf("failed to download knowledge tree: %s returned %s", l.source.URL, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteTreeBytes+1))
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to download knowledge tree: %w", err)
+	}
+	if len(data) > maxRemoteTreeBytes {
+		return "", "", false, fmt.Errorf("knowledge tree archive is larger than %d bytes", maxRemoteTreeBytes)
+	}
+
+	var version string
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		version = "etag:" + etag
+	} else if modified := resp.Header.Get("Last-Modified"); modified != "" {
+		version = "modified:" + modified
+	} else {
+		h := sha256.Sum256(data)
+		version = "sha256:" + hex.EncodeToString(h[:])
+	}
+	if version == known {
+		return "", known, false, nil
+	}
+
+	dir, err := os.MkdirTemp("", "agentize-tree-")
+	if err != nil {
+		return "", "", false, err
+	}
+	if err := extractArchive(data, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", "", false, fmt.Errorf("failed to unpack knowledge tree from %s: %w", l.source.URL, err)
+	}
+	return dir, version, true, nil
+}
+
+// fetchGit checks out the source ref with a shallow fetch. ls-remote is used first so an
+// unchanged branch or tag is not fetched again.
+func (l *RemoteLoader) fetchGit(ctx context.Context, known string) (string, string, bool, error) {
+	ref := l.source.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// Both go to git as positional arguments; a leading "-" would be read as an option
+	if strings.HasPrefix(l.source.URL, "-") || strings.HasPrefix(ref, "-") {
+		return "", "", false, fmt.Errorf("invalid git source %q: URL and ref must not start with \"-\"", l.source)
+	}
+
+	if known != "" {
+		if head, err := gitRemoteCommit(ctx, l.source.URL, ref); err == nil && head == known {
+			return "", known, false, nil
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "agentize-tree-")
+	if err != nil {
+		return "", "", false, err
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"fetch", "-q", "--depth", "1", "--", l.source.URL, ref},
+		{"checkout", "-q", "FETCH_HEAD"},
+	} {
+		if _, err := runGit(ctx, dir, args...); err != nil {
+			os.RemoveAll(dir)
+			return "", "", false, err
+		}
+	}
+	commit, err := runGit(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", "", false, err
+	}
+	if commit == known {
+		os.RemoveAll(dir)
+		return "", known, false, nil
+	}
+	// The checkout is served as plain files; drop the git metadata and, as archive extraction
+	// does, the symlinks, which could point outside the tree
+	os.RemoveAll(filepath.Join(dir, ".git"))
+	if err := removeSymlinks(dir); err != nil {
+		os.RemoveAll(dir)
+		return "", "", false, fmt.Errorf("failed to remove symlinks from checkout: %w", err)
+	}
+	return dir, commit, true, nil
+}
+
+// removeSymlinks deletes every symbolic link below dir
+func removeSymlinks(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			log.Log.Warn("[RemoteLoader] ⚠️  Skipping symlink in git checkout", "path", path)
+			return os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// gitRemoteCommit returns the commit ref points to on the remote (empty when ref is a commit)
+func gitRemoteCommit(ctx context.Context, url, ref string) (string, error) {
+	out, err := runGit(ctx, "", "ls-remote", "--", url, ref)
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 {
+			return fields[0], nil
+		}
+	}
+	return "", nil
+}
+
+// runGit runs git in dir and returns its trimmed stdout
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// extractArchive unpacks a zip, gzip-compressed tar or plain tar archive into dir
+func extractArchive(data []byte, dir string) error {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return extractZip(data, dir)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(gz, dir)
+	}
+	return extractTar(bytes.NewReader(data), dir)
+}
+
+// extractTar unpacks regular files and directories; links and other entries are skipped
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	var written int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			target, err := archiveTarget(dir, hdr.Name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if written += hdr.Size; written > maxRemoteTreeBytes {
+				return fmt.Errorf("unpacked tree is larger than %d bytes", maxRemoteTreeBytes)
+			}
+			if err := writeArchiveFile(dir, hdr.Name, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// extractZip unpacks regular files and directories of a zip archive
+func extractZip(data []byte, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	var written uint64
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			target, err := archiveTarget(dir, f.Name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		if written += f.UncompressedSize64; written > maxRemoteTreeBytes {
+			return fmt.Errorf("unpacked tree is larger than %d bytes", maxRemoteTreeBytes)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveFile(dir, f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArchiveFile writes one archive entry below dir
+func writeArchiveFile(dir, name string, r io.Reader) error {
+	target, err := archiveTarget(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, io.LimitReader(r, maxRemoteTreeBytes)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// archiveTarget maps an archive entry name to a path below dir, rejecting entries that escape it
+func archiveTarget(dir, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("archive entry %q escapes the tree directory", name)
+	}
+	return target, nil
+}
+
+// treeRoot returns the directory inside an unpacked tree that contains the "root" node
+func treeRoot(dir, subdir string) (string, error) {
+	if subdir != "" {
+		target, err := archiveTarget(dir, subdir)
+		if err != nil {
+			return "", err
+		}
+		if !dirExists(filepath.Join(target, "root")) {
+			return "", fmt.Errorf("knowledge tree has no \"root\" directory in %q", subdir)
+		}
+		return target, nil
+	}
+	if dirExists(filepath.Join(dir, "root")) {
+		return dir, nil
+	}
+
+	// Archives like GitHub's wrap the repository in a single top-level directory
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	if len(dirs) == 1 && dirExists(filepath.Join(dir, dirs[0], "root")) {
+		return filepath.Join(dir, dirs[0]), nil
+	}
+	return "", errors.New("knowledge tree has no \"root\" directory; set RemoteSource.Subdir")
+}
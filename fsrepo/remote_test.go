@@ -0,0 +1,158 @@
+package fsrepo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tarGz builds a .tar.gz archive from name -> content, wrapped in a top-level directory like GitHub archives
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: "tree-main/" + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRemoteLoaderArchive(t *testing.T) {
+	var mu sync.Mutex
+	etag := `"v1"`
+	archive := tarGz(t, map[string]string{"root/node.md": "# Version 1"})
+	downloads := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", etag)
+		w.Write(archive)
+	}))
+	defer srv.Close()
+
+	loader := NewRemoteLoader(RemoteSource{URL: srv.URL + "/tree.tar.gz"})
+	defer loader.Close()
+
+	repo, err := loader.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	node, err := repo.LoadNode("root")
+	if err != nil || node.Content != "# Version 1" {
+		t.Fatalf("LoadNode(root) = %v, %v; want version 1", node, err)
+	}
+	firstDir := loader.dir
+
+	changed, err := loader.Refresh(context.Background(), repo)
+	if err != nil || changed {
+		t.Fatalf("Refresh with unchanged ETag = %v, %v; want no change", changed, err)
+	}
+
+	mu.Lock()
+	etag = `"v2"`
+	archive = tarGz(t, map[string]string{"root/node.md": "# Version 2", "root/child/node.md": "# Child"})
+	mu.Unlock()
+
+	changed, err = loader.Refresh(context.Background(), repo)
+	if err != nil || !changed {
+		t.Fatalf("Refresh with new ETag = %v, %v; want a change", changed, err)
+	}
+	node, err = repo.LoadNode("root")
+	if err != nil || node.Content != "# Version 2" {
+		t.Fatalf("LoadNode(root) after refresh = %v, %v; want version 2", node, err)
+	}
+	if children, _ := repo.GetChildren("root"); len(children) != 1 {
+		t.Errorf("children after refresh = %v, want root/child", children)
+	}
+	if downloads != 2 || loader.Version() != `etag:"v2"` {
+		t.Errorf("downloads = %d, version = %q; want 2 and the new ETag", downloads, loader.Version())
+	}
+	if _, err := os.Stat(firstDir); !os.IsNotExist(err) {
+		t.Errorf("previous tree copy %s was not removed", firstDir)
+	}
+}
+
+func TestExtractArchiveRejectsEscapingEntries(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+
+	if err := extractArchive(buf.Bytes(), t.TempDir()); err == nil {
+		t.Error("expected an error for an entry outside the tree directory")
+	}
+}
+
+func TestRemoteLoaderGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(secret, []byte("top secret"), 0644)
+
+	src := filepath.Join(t.TempDir(), "tree.git")
+	os.MkdirAll(filepath.Join(src, "root"), 0755)
+	os.WriteFile(filepath.Join(src, "root", "node.md"), []byte("# Root"), 0644)
+	if err := os.Symlink(secret, filepath.Join(src, "root", "leak.md")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "tree"},
+	} {
+		if _, err := runGit(context.Background(), src, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loader := NewRemoteLoader(RemoteSource{URL: src})
+	defer loader.Close()
+	repo, err := loader.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if node, err := repo.LoadNode("root"); err != nil || node.Content != "# Root" {
+		t.Fatalf("Unexpected root node %+v (err %v)", node, err)
+	}
+	if data, err := repo.ReadFile("root/leak.md"); err == nil {
+		t.Errorf("Expected the symlink to be removed from the checkout, read %q", data)
+	}
+
+	for _, source := range []RemoteSource{
+		{URL: "--upload-pack=touch /tmp/pwned", Ref: "main"},
+		{URL: src, Ref: "--upload-pack=touch /tmp/pwned"},
+	} {
+		if _, err := NewRemoteLoader(source).Load(context.Background()); err == nil || !strings.Contains(err.Error(), "must not start with") {
+			t.Errorf("Expected %v to be rejected, got %v", source, err)
+		}
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ghiac/agentize/log"
@@ -20,12 +24,61 @@ import (
 // It receives the node content and returns a short summary string
 type SummaryGenerator func(ctx context.Context, content string) (string, error)
 
+// ErrNodeNotFound is returned when a node path does not exist in the knowledge tree
+// (for example because it was removed and the tree was reloaded)
+var ErrNodeNotFound = errors.New("node not found")
+
+// ErrReadOnly is returned when writing to a repository that is not backed by a directory on disk
+var ErrReadOnly = errors.New("knowledge tree is read-only")
+
+// ErrPathEscapesRoot is returned by ReadFile for absolute paths or paths leaving the knowledge root
+var ErrPathEscapesRoot = errors.New("path escapes the knowledge root")
+
 // NodeRepository handles loading nodes from the filesystem
 type NodeRepository struct {
-	rootPath         string
+	fsys             fs.FS    // tree files; guarded by mu because RemoteLoader swaps it
+	rootPath         string   // directory behind fsys, empty when the tree is not on disk (e.g. embed.FS)
+	diskRoots        []string // directories behind a multi-root fsys, watched by Watch
+	source           string   // human readable origin of the tree for logs
 	cache            map[string]*model.Node
 	mu               sync.RWMutex
 	summaryGenerator SummaryGenerator
+
+	// Routing graph of the last full load (guarded by mu) and whether cycles in it are tolerated
+	graph       *TreeGraph
+	allowCycles bool
+	// Whether sessions may jump to any node instead of following routing (see SetAllowJump)
+	allowJump bool
+
+	// Node embeddings for semantic routing (guarded by mu, see SetEmbedder)
+	embedder           Embedder
+	embeddingCachePath string
+	embeddings         map[string][]float32 // node path -> vector
+	embeddingsByHash   map[string][]float32 // text hash -> vector, nil until first computed
+
+	// Functions run after every load of the whole tree (guarded by mu, see OnLoad)
+	loadHooks []func()
+
+	// Node cache validation (guarded by mu, see SetCacheRevalidation) and counters
+	fingerprints    map[string]string    // node path -> nodeFingerprint when it was read
+	checkedAt       map[string]time.Time // node path -> last time the fingerprint matched
+	revalidateEvery time.Duration
+	cacheHits       atomic.Int64
+	cacheMisses     atomic.Int64
+	cacheStale      atomic.Int64
+
+	// Reload bookkeeping (guarded by mu)
+	reloadCount     int
+	lastReload      time.Time
+	lastReloadError string
+}
+
+// ReloadStats describes the hot-reload history of a repository
+type ReloadStats struct {
+	Count     int       // number of successful reloads
+	LastAt    time.Time // time of the last successful reload
+	LastError string    // error of the last failed reload attempt (empty after a success)
+	NodeCount int       // number of nodes currently cached
 }
 
 // NewNodeRepository creates a new repository with the given root path
@@ -41,11 +94,60 @@ func NewNodeRepository(rootPath string) (*NodeRepository, error) {
 	}
 
 	return &NodeRepository{
-		rootPath: absPath,
-		cache:    make(map[string]*model.Node),
+		fsys:         os.DirFS(absPath),
+		rootPath:     absPath,
+		source:       absPath,
+		cache:        make(map[string]*model.Node),
+		fingerprints: make(map[string]string),
+		checkedAt:    make(map[string]time.Time),
 	}, nil
 }
 
+// NewNodeRepositoryFromFS creates a read-only repository backed by fsys, e.g. an embed.FS
+// shipped inside the binary. fsys must contain the "root" node directory at its top level;
+// use fs.Sub to strip the directory an embed.FS was declared with:
+//
+//	//go:embed knowledge
+//	var knowledge embed.FS
+//
+//	tree, _ := fs.Sub(knowledge, "knowledge")
+//	repo, err := fsrepo.NewNodeRepositoryFromFS(tree)
+func NewNodeRepositoryFromFS(fsys fs.FS) (*NodeRepository, error) {
+	if info, err := fs.Stat(fsys, "root"); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("knowledge tree has no \"root\" directory at the top of the file system")
+	}
+
+	return &NodeRepository{
+		fsys:         fsys,
+		source:       "fs.FS",
+		cache:        make(map[string]*model.Node),
+		fingerprints: make(map[string]string),
+		checkedAt:    make(map[string]time.Time),
+	}, nil
+}
+
+// files returns the file system the tree is currently read from
+func (r *NodeRepository) files() fs.FS {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.fsys
+}
+
+// ReadFile reads a file of the knowledge tree by its slash-separated path relative to the
+// knowledge root (e.g. "root/billing/node.md"). Absolute paths and paths that leave the
+// root through ".." fail with ErrPathEscapesRoot.
+func (r *NodeRepository) ReadFile(name string) ([]byte, error) {
+	name = filepath.ToSlash(strings.TrimSpace(name))
+	if name == "" || path.IsAbs(name) || filepath.IsAbs(name) {
+		return nil, fmt.Errorf("%w: %s", ErrPathEscapesRoot, name)
+	}
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") || !fs.ValidPath(cleaned) {
+		return nil, fmt.Errorf("%w: %s", ErrPathEscapesRoot, name)
+	}
+	return fs.ReadFile(r.files(), cleaned)
+}
+
 // SetSummaryGenerator sets the function used to generate summaries for nodes
 func (r *NodeRepository) SetSummaryGenerator(generator SummaryGenerator) {
 	r.summaryGenerator = generator
@@ -56,17 +158,46 @@ func (r *NodeRepository) SetSummaryGenerator(generator SummaryGenerator) {
 func (r *NodeRepository) LoadNode(path string) (*model.Node, error) {
 	// Check cache first
 	r.mu.RLock()
-	if cached, ok := r.cache[path]; ok {
-		r.mu.RUnlock()
-		return cached, nil
-	}
+	cached, ok := r.cache[path]
 	r.mu.RUnlock()
+	if ok {
+		if r.isFresh(path) {
+			r.cacheHits.Add(1)
+			return cached, nil
+		}
+		r.cacheStale.Add(1)
+		log.Log.Info("[NodeRepository] 🔄 Node files changed, re-reading", "path", path)
+	} else {
+		r.cacheMisses.Add(1)
+	}
 
-	// Build full path
-	fullPath := filepath.Join(r.rootPath, path)
+	fsys := r.files()
+	fingerprint := nodeFingerprint(fsys, path)
+	node, err := r.readNode(fsys, path)
+	if err != nil {
+		if ok && errors.Is(err, ErrNodeNotFound) {
+			r.InvalidateCache(path)
+		}
+		return nil, err
+	}
+
+	// Cache the node
+	r.mu.Lock()
+	r.cache[path] = node
+	r.fingerprints[path] = fingerprint
+	r.checkedAt[path] = time.Now()
+	r.mu.Unlock()
+
+	return node, nil
+}
 
+// readNode reads a node from fsys without touching the cache
+func (r *NodeRepository) readNode(fsys fs.FS, path string) (*model.Node, error) {
 	// Verify directory exists
-	info, err := os.Stat(fullPath)
+	info, err := fs.Stat(fsys, path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("node %q no longer exists in the knowledge tree: %w", path, ErrNodeNotFound)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("node path does not exist: %w", err)
 	}
@@ -79,8 +210,19 @@ func (r *NodeRepository) LoadNode(path string) (*model.Node, error) {
 		Path: path,
 	}
 
-	// Load node.yaml (optional)
-	meta, err := r.loadNodeMeta(fullPath)
+	// Load node.md (optional); it may start with a YAML front matter block
+	content, frontMatter, err := r.loadNodeContent(fsys, path)
+	if err == nil {
+		node.Content = content
+	}
+
+	// Load node.yaml (optional), falling back to the node.md front matter
+	meta, err := r.loadNodeMeta(fsys, path)
+	if err == nil && frontMatter != nil {
+		log.Log.Warn("[NodeRepository] ⚠️  node.md front matter ignored, node.yaml takes precedence", "path", path)
+	} else if errors.Is(err, fs.ErrNotExist) && frontMatter != nil {
+		meta, err = parseNodeMeta(frontMatter, path+"/node.md")
+	}
 	if err == nil {
 		node.ID = meta.ID
 		node.Title = meta.Title
@@ -88,8 +230,15 @@ func (r *NodeRepository) LoadNode(path string) (*model.Node, error) {
 		node.Summary = meta.Summary
 		node.Auth = meta.Auth
 		node.MCP = meta.MCP
+		node.Routing = meta.Routing
+		node.LLM = meta.LLM
+		if node.LLM.Model == "" {
+			node.LLM.Model = meta.Model
+		}
+		node.ToolsPolicy = meta.ToolsPolicy
+		node.OnEnter = meta.OnEnter
 	} else {
-		// Use defaults if node.yaml doesn't exist
+		// Use defaults if there is no node.yaml or front matter
 		node.ID = path
 		node.Auth = model.Auth{
 			Inherit: true,
@@ -97,39 +246,196 @@ func (r *NodeRepository) LoadNode(path string) (*model.Node, error) {
 		}
 	}
 
-	// Load node.md (optional)
-	content, err := r.loadNodeContent(fullPath)
-	if err == nil {
-		node.Content = content
-	}
-
-	// Load tools.json (optional)
-	tools, err := r.loadTools(fullPath)
+	// Load tools.json or tools.yaml (optional); a broken or unresolvable file fails the node
+	tools, err := r.loadTools(fsys, path)
 	if err == nil {
 		node.Tools = tools
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("node %q: %w", path, err)
 	}
 
 	// Calculate hash and set metadata
 	node.Hash = r.calculateHash(node.Content)
 	node.LoadedAt = time.Now()
 
-	// Cache the node
+	return node, nil
+}
+
+// Load parses the whole knowledge tree, checks its routing graph for cycles and unreachable
+// nodes, and fills the cache. Fails with ErrRoutingCycle on a cycle unless SetAllowCycles is set.
+func (r *NodeRepository) Load() error {
+	nodes, fingerprints, graph, err := r.readTree(r.files())
+	if err != nil {
+		return err
+	}
+
 	r.mu.Lock()
-	r.cache[path] = node
+	r.setTree(nodes, fingerprints)
+	r.graph = graph
 	r.mu.Unlock()
 
-	return node, nil
+	r.afterLoad()
+	return nil
+}
+
+// Reload re-parses the whole knowledge tree from disk and atomically replaces the cache.
+// The new tree is built off to the side, so readers see either the old or the new tree,
+// never a half-loaded one. On error the current tree is kept.
+func (r *NodeRepository) Reload() error {
+	nodes, fingerprints, graph, err := r.readTree(r.files())
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.setTree(nodes, fingerprints)
+	r.graph = graph
+	r.markReloaded()
+	r.mu.Unlock()
+
+	log.Log.Info("[NodeRepository] 🔄 Knowledge tree reloaded", "nodes", len(nodes))
+	r.afterLoad()
+	return nil
+}
+
+// swapSource parses the tree in fsys and, if it loads, makes it the repository's tree.
+// Used by RemoteLoader to switch to a freshly fetched tree; on error the current tree is kept.
+func (r *NodeRepository) swapSource(fsys fs.FS, rootPath, source string) error {
+	nodes, fingerprints, graph, err := r.readTree(fsys)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.fsys = fsys
+	r.rootPath = rootPath
+	r.source = source
+	r.setTree(nodes, fingerprints)
+	r.graph = graph
+	r.markReloaded()
+	r.mu.Unlock()
+
+	log.Log.Info("[NodeRepository] 🔄 Knowledge tree replaced", "source", source, "nodes", len(nodes))
+	r.afterLoad()
+	return nil
+}
+
+// OnLoad registers fn to run after every Load, Reload and tree swap, once the new tree is
+// cached and node embeddings are refreshed (e.g. to rebuild an index of node content)
+func (r *NodeRepository) OnLoad(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loadHooks = append(r.loadHooks, fn)
+}
+
+// afterLoad refreshes node embeddings and runs the OnLoad functions
+func (r *NodeRepository) afterLoad() {
+	r.refreshEmbeddings()
+	r.mu.RLock()
+	hooks := append([]func(){}, r.loadHooks...)
+	r.mu.RUnlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// readTree parses and analyzes the whole tree in fsys, recording a failure in the reload stats.
+// It also returns the fingerprint of each node's files as they were read.
+func (r *NodeRepository) readTree(fsys fs.FS) (map[string]*model.Node, map[string]string, *TreeGraph, error) {
+	nodes := make(map[string]*model.Node)
+	fingerprints := make(map[string]string)
+	err := r.readTreeRecursive(fsys, "root", nodes, fingerprints)
+	var graph *TreeGraph
+	if err == nil {
+		graph = analyzeTree(nodes)
+		err = r.checkGraph(graph)
+	}
+	if err != nil {
+		r.mu.Lock()
+		r.lastReloadError = err.Error()
+		r.mu.Unlock()
+		return nil, nil, nil, fmt.Errorf("failed to reload knowledge tree: %w", err)
+	}
+	return nodes, fingerprints, graph, nil
+}
+
+// setTree makes nodes the cache (caller holds mu)
+func (r *NodeRepository) setTree(nodes map[string]*model.Node, fingerprints map[string]string) {
+	now := time.Now()
+	r.cache = nodes
+	r.fingerprints = fingerprints
+	r.checkedAt = make(map[string]time.Time, len(nodes))
+	for path := range nodes {
+		r.checkedAt[path] = now
+	}
+}
+
+// markReloaded updates the reload counters (caller holds mu)
+func (r *NodeRepository) markReloaded() {
+	r.reloadCount++
+	r.lastReload = time.Now()
+	r.lastReloadError = ""
+}
+
+// readTreeRecursive reads a node and all its descendants into nodes, and their file
+// fingerprints into fingerprints when it is not nil
+func (r *NodeRepository) readTreeRecursive(fsys fs.FS, path string, nodes map[string]*model.Node, fingerprints map[string]string) error {
+	if fingerprints != nil {
+		fingerprints[path] = nodeFingerprint(fsys, path)
+	}
+	node, err := r.readNode(fsys, path)
+	if err != nil {
+		return err
+	}
+	nodes[path] = node
+
+	children, err := listChildren(fsys, path)
+	if err != nil {
+		return nil // No children, not an error
+	}
+	for _, childPath := range children {
+		if err := r.readTreeRecursive(fsys, childPath, nodes, fingerprints); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetReloadStats returns reload counters for the debug UI
+func (r *NodeRepository) GetReloadStats() ReloadStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return ReloadStats{
+		Count:     r.reloadCount,
+		LastAt:    r.lastReload,
+		LastError: r.lastReloadError,
+		NodeCount: len(r.cache),
+	}
+}
+
+// CachedNodes returns a snapshot of the currently cached nodes
+func (r *NodeRepository) CachedNodes() map[string]*model.Node {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	nodes := make(map[string]*model.Node, len(r.cache))
+	for k, v := range r.cache {
+		nodes[k] = v
+	}
+	return nodes
 }
 
 // GetChildren returns all child nodes for a given path
 // It scans the directory for subdirectories
 func (r *NodeRepository) GetChildren(path string) ([]string, error) {
-	fullPath := filepath.Join(r.rootPath, path)
+	return listChildren(r.files(), path)
+}
 
+// listChildren returns the child node paths of path in fsys
+func listChildren(fsys fs.FS, path string) ([]string, error) {
 	var children []string
 
 	// Scan directory for all subdirectories (excluding special files)
-	entries, err := os.ReadDir(fullPath)
+	entries, err := fs.ReadDir(fsys, path)
 	if err != nil {
 		return nil, err
 	}
@@ -167,57 +473,80 @@ func (r *NodeRepository) NextPath(path string) (string, bool) {
 }
 
 // loadNodeMeta loads and parses node.yaml
-func (r *NodeRepository) loadNodeMeta(dirPath string) (*model.NodeMeta, error) {
-	yamlPath := filepath.Join(dirPath, "node.yaml")
-	data, err := os.ReadFile(yamlPath)
+func (r *NodeRepository) loadNodeMeta(fsys fs.FS, dirPath string) (*model.NodeMeta, error) {
+	yamlPath := path.Join(dirPath, "node.yaml")
+	data, err := fs.ReadFile(fsys, yamlPath)
 	if err != nil {
 		return nil, err
 	}
+	return parseNodeMeta(data, yamlPath)
+}
 
+// parseNodeMeta parses node metadata from node.yaml or node.md front matter (source is used in logs)
+func parseNodeMeta(data []byte, source string) (*model.NodeMeta, error) {
 	// For now, use a simple YAML parser
 	// In production, use gopkg.in/yaml.v3
 	meta := &model.NodeMeta{}
 	if err := parseYAML(data, meta); err != nil {
-		return nil, fmt.Errorf("failed to parse node.yaml: %w", err)
+		return nil, fmt.Errorf("failed to parse %s: %w", path.Base(source), err)
+	}
+
+	// Routing rules, LLM overrides, the tools policy and on_enter are nested sections the simple parser doesn't handle
+	if err := parseNestedSections(data, meta); err != nil {
+		log.Log.Warn("[NodeRepository] ⚠️  Failed to parse routing/llm/tools_policy/on_enter sections", "path", source, "error", err)
 	}
 
 	return meta, nil
 }
 
-// loadNodeContent loads node.md
-func (r *NodeRepository) loadNodeContent(dirPath string) (string, error) {
-	mdPath := filepath.Join(dirPath, "node.md")
-	data, err := os.ReadFile(mdPath)
+// loadNodeContent loads node.md, returning the markdown body and its front matter (nil if none)
+func (r *NodeRepository) loadNodeContent(fsys fs.FS, dirPath string) (string, []byte, error) {
+	data, err := fs.ReadFile(fsys, path.Join(dirPath, "node.md"))
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return string(data), nil
+	front, body, _ := splitFrontMatter(data)
+	return string(body), front, nil
 }
 
-// loadTools loads and parses tools.json
-func (r *NodeRepository) loadTools(dirPath string) ([]model.Tool, error) {
-	jsonPath := filepath.Join(dirPath, "tools.json")
-	data, err := os.ReadFile(jsonPath)
+// loadTools loads and parses tools.json or tools.yaml, resolving "$ref": "shared/<name>"
+// entries against the shared definitions in <root>/_shared
+func (r *NodeRepository) loadTools(fsys fs.FS, dirPath string) ([]model.Tool, error) {
+	name, err := findToolsFile(fsys, dirPath)
 	if err != nil {
 		return nil, err
 	}
-
-	var toolsData struct {
-		Tools []model.Tool `json:"tools"`
+	data, err := fs.ReadFile(fsys, path.Join(dirPath, name))
+	if err != nil {
+		return nil, err
 	}
 
-	if err := json.Unmarshal(data, &toolsData); err != nil {
-		return nil, fmt.Errorf("failed to parse tools.json: %w", err)
+	entries, err := decodeToolsDocument(data, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	resolver := &toolRefResolver{fsys: fsys}
+	if entries, err = resolver.resolveToolEntries(entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	tools, err := toolsFromEntries(entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
 	}
 
 	// Set default status for tools that don't have one
-	for i := range toolsData.Tools {
-		if toolsData.Tools[i].Status == "" {
-			toolsData.Tools[i].Status = model.ToolStatusActive
+	for i := range tools {
+		if tools[i].Status == "" {
+			tools[i].Status = model.ToolStatusActive
+		}
+		if tools[i].HTTP != nil {
+			if err := tools[i].HTTP.Validate(); err != nil {
+				return nil, fmt.Errorf("%s: tool %q: %w", name, tools[i].Name, err)
+			}
 		}
 	}
 
-	return toolsData.Tools, nil
+	return tools, nil
 }
 
 // calculateHash calculates SHA256 hash of content
@@ -232,8 +561,12 @@ func (r *NodeRepository) InvalidateCache(path string) {
 	defer r.mu.Unlock()
 	if path == "" {
 		r.cache = make(map[string]*model.Node)
+		r.fingerprints = make(map[string]string)
+		r.checkedAt = make(map[string]time.Time)
 	} else {
 		delete(r.cache, path)
+		delete(r.fingerprints, path)
+		delete(r.checkedAt, path)
 	}
 }
 
@@ -277,7 +610,13 @@ func (r *NodeRepository) collectToolsRecursive(path string, tools *[]model.Tool)
 
 // saveNodeMeta writes the NodeMeta to node.yaml file
 func (r *NodeRepository) saveNodeMeta(path string, meta *model.NodeMeta) error {
-	fullPath := filepath.Join(r.rootPath, path, "node.yaml")
+	r.mu.RLock()
+	rootPath := r.rootPath
+	r.mu.RUnlock()
+	if rootPath == "" {
+		return ErrReadOnly
+	}
+	fullPath := filepath.Join(rootPath, filepath.FromSlash(path), "node.yaml")
 
 	data, err := yaml.Marshal(meta)
 	if err != nil {
@@ -325,16 +664,15 @@ func (r *NodeRepository) ensureSummariesRecursive(ctx context.Context, path stri
 		if forceSummary && node.Summary != "" {
 			action = "Regenerating"
 		}
-		log.Log.Infof("%s summary for node: %s", action, path)
+		log.Log.Info("[NodeRepository] 📝 Node summary", "action", action, "path", path)
 
 		// Generate summary using LLM
 		summary, err := r.summaryGenerator(ctx, node.Content)
 		if err != nil {
-			log.Log.Warnf("Failed to generate summary for %s: %v", path, err)
+			log.Log.Warn("[NodeRepository] ⚠️  Failed to generate summary", "path", path, "error", err)
 		} else {
 			// Load existing meta to preserve other fields
-			fullPath := filepath.Join(r.rootPath, path)
-			meta, err := r.loadNodeMeta(fullPath)
+			meta, err := r.loadNodeMeta(r.files(), path)
 			if err != nil {
 				// Create new meta if it doesn't exist
 				meta = &model.NodeMeta{
@@ -348,9 +686,9 @@ func (r *NodeRepository) ensureSummariesRecursive(ctx context.Context, path stri
 
 			// Save back to file
 			if err := r.saveNodeMeta(path, meta); err != nil {
-				log.Log.Warnf("Failed to save summary for %s: %v", path, err)
+				log.Log.Warn("[NodeRepository] ⚠️  Failed to save summary", "path", path, "error", err)
 			} else {
-				log.Log.Infof("Summary saved for node: %s", path)
+				log.Log.Info("[NodeRepository] ✅ Summary saved", "path", path)
 
 				// Update cache
 				r.mu.Lock()
@@ -371,7 +709,7 @@ func (r *NodeRepository) ensureSummariesRecursive(ctx context.Context, path stri
 	for _, childPath := range children {
 		if err := r.ensureSummariesRecursive(ctx, childPath, forceSummary); err != nil {
 			// Log warning but continue with other children
-			log.Log.Warnf("Error processing child %s: %v", childPath, err)
+			log.Log.Warn("[NodeRepository] ⚠️  Failed to process child", "path", childPath, "error", err)
 			continue
 		}
 	}
@@ -1,9 +1,17 @@
 package fsrepo
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ghiac/agentize/model"
 )
 
 func TestNodeRepository(t *testing.T) {
@@ -114,3 +122,403 @@ routing:
 		t.Errorf("Expected 'root/next', got '%s'", nextPathStr)
 	}
 }
+
+func TestNodeRepositoryReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootPath := filepath.Join(tmpDir, "root")
+	childPath := filepath.Join(rootPath, "child")
+	os.MkdirAll(childPath, 0755)
+	os.WriteFile(filepath.Join(rootPath, "node.md"), []byte("root v1"), 0644)
+	os.WriteFile(filepath.Join(childPath, "node.md"), []byte("child"), 0644)
+
+	repo, err := NewNodeRepository(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	if _, err := repo.LoadNode("root/child"); err != nil {
+		t.Fatalf("Failed to load child: %v", err)
+	}
+
+	// Edit root content and remove the child, then reload
+	os.WriteFile(filepath.Join(rootPath, "node.md"), []byte("root v2"), 0644)
+	os.RemoveAll(childPath)
+
+	if err := repo.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	root, err := repo.LoadNode("root")
+	if err != nil {
+		t.Fatalf("Failed to load root: %v", err)
+	}
+	if root.Content != "root v2" {
+		t.Errorf("Expected reloaded content 'root v2', got %q", root.Content)
+	}
+
+	if _, err := repo.LoadNode("root/child"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("Expected ErrNodeNotFound for removed node, got %v", err)
+	}
+
+	stats := repo.GetReloadStats()
+	if stats.Count != 1 || stats.LastAt.IsZero() || stats.NodeCount != 1 {
+		t.Errorf("Unexpected reload stats: %+v", stats)
+	}
+
+	// A broken tree keeps the previous nodes
+	os.RemoveAll(rootPath)
+	if err := repo.Reload(); err == nil {
+		t.Fatal("Expected reload of missing root to fail")
+	}
+	if _, err := repo.LoadNode("root"); err != nil {
+		t.Errorf("Expected previous tree to be kept after failed reload, got %v", err)
+	}
+	if stats := repo.GetReloadStats(); stats.Count != 1 || stats.LastError == "" {
+		t.Errorf("Unexpected reload stats after failure: %+v", stats)
+	}
+}
+
+// TestNodeRepositoryWatch verifies Watch reloads the tree when a node is added in a new directory
+// and when a node file in it is then edited, without waiting for a polling interval.
+func TestNodeRepositoryWatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootPath := filepath.Join(tmpDir, "root")
+	os.MkdirAll(rootPath, 0755)
+	os.WriteFile(filepath.Join(rootPath, "node.md"), []byte("root"), 0644)
+
+	repo, err := NewNodeRepository(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloads := make(chan struct{}, 16)
+	go repo.Watch(ctx, time.Hour, func() { reloads <- struct{}{} })
+
+	waitFor := func(what string, ok func() bool) {
+		t.Helper()
+		deadline := time.After(5 * time.Second)
+		for !ok() {
+			select {
+			case <-reloads:
+			case <-deadline:
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+		}
+	}
+	// Give the watcher time to register the tree before changing it
+	time.Sleep(100 * time.Millisecond)
+
+	childPath := filepath.Join(rootPath, "child")
+	os.MkdirAll(childPath, 0755)
+	os.WriteFile(filepath.Join(childPath, "node.md"), []byte("child v1"), 0644)
+	waitFor("the new child", func() bool {
+		node, err := repo.LoadNode("root/child")
+		return err == nil && node.Content == "child v1"
+	})
+
+	os.WriteFile(filepath.Join(childPath, "node.md"), []byte("child v2"), 0644)
+	waitFor("the edited child", func() bool {
+		node, err := repo.LoadNode("root/child")
+		return err == nil && node.Content == "child v2"
+	})
+}
+
+func TestNodeRepositoryCacheRevalidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootPath := filepath.Join(tmpDir, "root")
+	os.MkdirAll(rootPath, 0755)
+	os.WriteFile(filepath.Join(rootPath, "node.md"), []byte("v1"), 0644)
+
+	repo, err := NewNodeRepository(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := repo.LoadNode("root"); err != nil {
+			t.Fatalf("Failed to load root: %v", err)
+		}
+	}
+	if stats := repo.GetCacheStats(); stats.Misses != 1 || stats.Hits != 2 || stats.Entries != 1 {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+
+	// Without revalidation the cache is trusted until a reload
+	os.WriteFile(filepath.Join(rootPath, "node.md"), []byte("version 2"), 0644)
+	if node, _ := repo.LoadNode("root"); node.Content != "v1" {
+		t.Errorf("Expected the cached content, got %q", node.Content)
+	}
+
+	// With revalidation changed files are re-read
+	repo.SetCacheRevalidation(time.Nanosecond)
+	node, err := repo.LoadNode("root")
+	if err != nil || node.Content != "version 2" {
+		t.Fatalf("Expected the changed content, got %q (err %v)", node.Content, err)
+	}
+	// Adding a file is a change too
+	os.WriteFile(filepath.Join(rootPath, "node.yaml"), []byte("id: \"root\"\ntitle: \"Root\"\n"), 0644)
+	if node, _ := repo.LoadNode("root"); node.Title != "Root" {
+		t.Errorf("Expected the new node.yaml to be read, got title %q", node.Title)
+	}
+	if _, err := repo.LoadNode("root"); err != nil {
+		t.Fatalf("Failed to load root: %v", err)
+	}
+	if stats := repo.GetCacheStats(); stats.Stale != 2 || stats.Hits != 4 {
+		t.Errorf("Unexpected cache stats after revalidation: %+v", stats)
+	}
+}
+
+func TestNodeRepositorySharedToolRefs(t *testing.T) {
+	tmpDir := t.TempDir()
+	inlinePath := filepath.Join(tmpDir, "root", "inline")
+	refPath := filepath.Join(tmpDir, "root", "ref")
+	os.MkdirAll(inlinePath, 0755)
+	os.MkdirAll(refPath, 0755)
+	os.MkdirAll(filepath.Join(tmpDir, SharedDir), 0755)
+
+	sharedContent := `tools:
+  - name: search_docs
+    description: "Search the documentation"
+    input_schema:
+      type: object
+      properties:
+        query:
+          $ref: shared/query_param
+        limit:
+          type: integer
+          maximum: 20
+      required: [query]
+definitions:
+  query_param:
+    type: string
+    description: "Search query"
+`
+	os.WriteFile(filepath.Join(tmpDir, SharedDir, "tools.yaml"), []byte(sharedContent), 0644)
+
+	inlineContent := `{
+  "tools": [
+    {
+      "name": "search_docs",
+      "description": "Search the documentation",
+      "input_schema": {
+        "type": "object",
+        "properties": {
+          "query": { "type": "string", "description": "Search query" },
+          "limit": { "type": "integer", "maximum": 20 }
+        },
+        "required": ["query"]
+      }
+    }
+  ]
+}
+`
+	os.WriteFile(filepath.Join(inlinePath, "tools.json"), []byte(inlineContent), 0644)
+	os.WriteFile(filepath.Join(refPath, "tools.yaml"), []byte("tools:\n  - $ref: shared/search_docs\n"), 0644)
+
+	repo, err := NewNodeRepository(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	inline, err := repo.LoadNode("root/inline")
+	if err != nil {
+		t.Fatalf("Failed to load inline node: %v", err)
+	}
+	ref, err := repo.LoadNode("root/ref")
+	if err != nil {
+		t.Fatalf("Failed to load ref node: %v", err)
+	}
+	if !reflect.DeepEqual(inline.Tools, ref.Tools) {
+		t.Errorf("Referenced tools differ from inlined ones:\n inline: %+v\n ref:    %+v", inline.Tools, ref.Tools)
+	}
+
+	// An unresolved reference fails the node with a clear error
+	os.WriteFile(filepath.Join(refPath, "tools.yaml"), []byte("tools:\n  - $ref: shared/missing\n"), 0644)
+	repo.InvalidateCache("")
+	_, err = repo.LoadNode("root/ref")
+	if !errors.Is(err, ErrUnresolvedToolRef) {
+		t.Fatalf("Expected ErrUnresolvedToolRef, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"shared/missing"`) || !strings.Contains(err.Error(), "search_docs") {
+		t.Errorf("Expected error to name the ref and the known definitions, got %v", err)
+	}
+}
+
+func TestNodeRepositoryFrontMatter(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootPath := filepath.Join(tmpDir, "root")
+	childPath := filepath.Join(rootPath, "child")
+	os.MkdirAll(childPath, 0755)
+
+	os.WriteFile(filepath.Join(rootPath, "node.md"), []byte(`---
+id: "root"
+title: "Front Matter Root"
+description: "Metadata lives in node.md"
+auth:
+  users:
+    - user_id: "test"
+      perms: "rx"
+routing:
+  mode: "conditional"
+  default: "child"
+---
+# Root
+
+Body text.
+`), 0644)
+
+	// node.yaml wins over front matter
+	os.WriteFile(filepath.Join(childPath, "node.yaml"), []byte("id: \"child\"\ntitle: \"From YAML\"\n"), 0644)
+	os.WriteFile(filepath.Join(childPath, "node.md"), []byte("---\ntitle: \"From front matter\"\n---\n# Child\n"), 0644)
+
+	repo, err := NewNodeRepository(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+
+	root, err := repo.LoadNode("root")
+	if err != nil {
+		t.Fatalf("Failed to load root: %v", err)
+	}
+	if root.ID != "root" || root.Title != "Front Matter Root" || root.Description != "Metadata lives in node.md" {
+		t.Errorf("Front matter metadata not applied: id=%q title=%q description=%q", root.ID, root.Title, root.Description)
+	}
+	if root.Auth.Users["test"] == nil || root.Auth.Users["test"].Perms != "rx" {
+		t.Errorf("Expected auth user from front matter, got %+v", root.Auth.Users)
+	}
+	if root.Routing.Mode != "conditional" || root.Routing.Default != "child" {
+		t.Errorf("Expected routing from front matter, got %+v", root.Routing)
+	}
+	if root.Content != "# Root\n\nBody text.\n" {
+		t.Errorf("Expected front matter stripped from content, got %q", root.Content)
+	}
+
+	child, err := repo.LoadNode("root/child")
+	if err != nil {
+		t.Fatalf("Failed to load child: %v", err)
+	}
+	if child.Title != "From YAML" {
+		t.Errorf("Expected node.yaml to win over front matter, got title %q", child.Title)
+	}
+	if child.Content != "# Child\n" {
+		t.Errorf("Expected front matter stripped from content, got %q", child.Content)
+	}
+}
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name, input, front, body string
+		ok                       bool
+	}{
+		{"none", "# Title\n", "", "# Title\n", false},
+		{"basic", "---\nid: a\n---\n# Title\n", "\nid: a\n", "# Title\n", true},
+		{"crlf", "---\r\nid: a\r\n---\r\n# Title\r\n", "\nid: a\r\n", "# Title\r\n", true},
+		{"dots terminator", "---\nid: a\n...\nbody", "\nid: a\n", "body", true},
+		{"no body", "---\nid: a\n---", "\nid: a\n", "", true},
+		{"unterminated", "---\nid: a\n# Title\n", "", "---\nid: a\n# Title\n", false},
+		{"horizontal rule later", "# Title\n---\n", "", "# Title\n---\n", false},
+	}
+	for _, tt := range tests {
+		front, body, ok := splitFrontMatter([]byte(tt.input))
+		if ok != tt.ok || string(front) != tt.front || string(body) != tt.body {
+			t.Errorf("%s: got (%q, %q, %v), want (%q, %q, %v)", tt.name, front, body, ok, tt.front, tt.body, tt.ok)
+		}
+	}
+}
+
+func TestNewNodeRepositoryFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/node.md":          {Data: []byte("---\nid: \"root\"\ntitle: \"Embedded\"\n---\n# Embedded root")},
+		"root/child/node.md":    {Data: []byte("# Child")},
+		"root/child/tools.yaml": {Data: []byte("tools:\n  - $ref: shared/ping\n")},
+		"_shared/tools.yaml":    {Data: []byte("tools:\n  - name: ping\n    description: Ping\n")},
+	}
+
+	repo, err := NewNodeRepositoryFromFS(fsys)
+	if err != nil {
+		t.Fatalf("NewNodeRepositoryFromFS failed: %v", err)
+	}
+	if err := repo.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	root, err := repo.LoadNode("root")
+	if err != nil {
+		t.Fatalf("LoadNode(root) failed: %v", err)
+	}
+	if root.Title != "Embedded" || root.Content != "# Embedded root" {
+		t.Errorf("root = %q / %q, want front matter title and body", root.Title, root.Content)
+	}
+	child, err := repo.LoadNode("root/child")
+	if err != nil {
+		t.Fatalf("LoadNode(root/child) failed: %v", err)
+	}
+	if len(child.Tools) != 1 || child.Tools[0].Name != "ping" {
+		t.Errorf("child tools = %+v, want shared ping", child.Tools)
+	}
+
+	if err := repo.saveNodeMeta("root", &model.NodeMeta{ID: "root"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("saveNodeMeta error = %v, want ErrReadOnly", err)
+	}
+
+	if _, err := NewNodeRepositoryFromFS(fstest.MapFS{"knowledge/root/node.md": {}}); err == nil {
+		t.Error("expected an error for a file system without a top-level root directory")
+	}
+}
+
+func TestNewMultiRootRepository(t *testing.T) {
+	base := t.TempDir()
+	tenant := t.TempDir()
+	write := func(dir, name, content string) {
+		t.Helper()
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(full), 0755)
+		os.WriteFile(full, []byte(content), 0644)
+	}
+	write(base, "root/node.md", "base root")
+	write(base, "root/billing/node.md", "base billing")
+	write(base, "root/billing/node.yaml", "id: \"billing\"\ntitle: \"Billing\"\n")
+	write(base, "root/support/node.md", "base support")
+	write(tenant, "root/billing/node.md", "acme billing")
+	write(tenant, "root/support/acme/node.md", "acme support")
+
+	repo, err := NewMultiRootRepository(base, tenant)
+	if err != nil {
+		t.Fatalf("NewMultiRootRepository failed: %v", err)
+	}
+	if err := repo.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// The overlay replaces billing as a whole: its node.yaml is not inherited from the base
+	billing, err := repo.LoadNode("root/billing")
+	if err != nil {
+		t.Fatalf("LoadNode(root/billing) failed: %v", err)
+	}
+	if billing.Content != "acme billing" || billing.ID != "root/billing" || billing.Title != "" {
+		t.Errorf("billing = %q / %q / %q, want the overlay node only", billing.Content, billing.ID, billing.Title)
+	}
+
+	// support keeps the base node and gains the overlay child
+	support, err := repo.LoadNode("root/support")
+	if err != nil || support.Content != "base support" {
+		t.Fatalf("LoadNode(root/support) = %v, %v, want the base node", support, err)
+	}
+	if !repo.HasNext("root/support") || repo.HasNext("root/billing") {
+		t.Error("expected only root/support to have children in the merged tree")
+	}
+	if children, _ := repo.GetChildren("root"); len(children) != 2 {
+		t.Errorf("root children = %v, want billing and support", children)
+	}
+	if nodes := repo.CachedNodes(); len(nodes) != 4 || nodes["root/support/acme"] == nil {
+		t.Errorf("merged tree has %d nodes, want 4 including root/support/acme", len(nodes))
+	}
+
+	if err := repo.saveNodeMeta("root", &model.NodeMeta{ID: "root"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("saveNodeMeta error = %v, want ErrReadOnly", err)
+	}
+	if _, err := NewMultiRootRepository(tenant, filepath.Join(base, "missing")); err == nil {
+		t.Error("expected an error for a missing root path")
+	}
+	if _, err := NewMultiRootRepository(t.TempDir(), t.TempDir()); err == nil {
+		t.Error("expected an error when no root provides the root node")
+	}
+}
@@ -0,0 +1,271 @@
+package fsrepo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ghiac/agentize/model"
+	"gopkg.in/yaml.v3"
+)
+
+// SharedDir is the directory at the tree root holding tool definitions shared between nodes
+// (_shared/tools.yaml or _shared/tools.json). Nodes reference them with "$ref": "shared/<name>".
+const SharedDir = "_shared"
+
+// sharedRefPrefix marks a $ref that points into the shared definitions.
+// Other $ref values (e.g. "#/definitions/x" inside a JSON Schema) are left untouched.
+const sharedRefPrefix = "shared/"
+
+// maxRefDepth guards against reference cycles in shared definitions
+const maxRefDepth = 32
+
+// ErrUnresolvedToolRef is returned when a tools file references a shared definition that does not exist
+var ErrUnresolvedToolRef = errors.New("unresolved tool reference")
+
+// toolFileNames are the accepted tool definition files, in lookup order
+var toolFileNames = []string{"tools.json", "tools.yaml"}
+
+// findToolsFile returns the tools file in dir of fsys (tools.json or tools.yaml).
+// Returns an fs.ErrNotExist error when there is none and an error when both exist.
+func findToolsFile(fsys fs.FS, dir string) (string, error) {
+	var found []string
+	for _, name := range toolFileNames {
+		if info, err := fs.Stat(fsys, path.Join(dir, name)); err == nil && !info.IsDir() {
+			found = append(found, name)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no tools file in %s: %w", dir, fs.ErrNotExist)
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("both tools.json and tools.yaml found in %s; keep only one", dir)
+}
+
+// decodeToolsDocument parses a tools file into its raw "tools" entries.
+// YAML is normalised through JSON so it yields exactly what the equivalent tools.json would.
+func decodeToolsDocument(data []byte, name string) ([]interface{}, error) {
+	var doc struct {
+		Tools []interface{} `json:"tools" yaml:"tools"`
+	}
+	if strings.HasSuffix(name, ".yaml") {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if doc.Tools == nil {
+			return nil, nil
+		}
+		normalised, err := normaliseYAML(doc.Tools)
+		if err != nil {
+			return nil, err
+		}
+		return normalised.([]interface{}), nil
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Tools, nil
+}
+
+// normaliseYAML round-trips a decoded YAML value through JSON (ints become float64, etc.)
+func normaliseYAML(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported YAML value: %w", err)
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// toolRefResolver resolves "$ref": "shared/<name>" entries against the shared definitions.
+// The shared file is read lazily, the first time a reference is met.
+type toolRefResolver struct {
+	fsys   fs.FS // the knowledge tree, with SharedDir at its top level
+	defs   map[string]interface{}
+	loaded bool
+	err    error // error from reading the shared file, returned on every lookup
+}
+
+// loadShared reads the shared definitions once and returns the load error, if any
+func (res *toolRefResolver) loadShared() error {
+	if !res.loaded {
+		res.loaded = true
+		res.defs = make(map[string]interface{})
+		res.err = res.readShared()
+	}
+	return res.err
+}
+
+// readShared reads _shared/tools.{json,yaml}. Its "tools" entries are keyed by name and its
+// optional "definitions" map holds reusable schema fragments; both share one namespace.
+func (res *toolRefResolver) readShared() error {
+	name, err := findToolsFile(res.fsys, SharedDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	file := path.Join(SharedDir, name)
+	data, err := fs.ReadFile(res.fsys, file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	tools, err := decodeToolsDocument(data, name)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	for i, entry := range tools {
+		obj, _ := entry.(map[string]interface{})
+		toolName, _ := obj["name"].(string)
+		if toolName == "" {
+			return fmt.Errorf("%s: tool #%d has no name", file, i+1)
+		}
+		if _, dup := res.defs[toolName]; dup {
+			return fmt.Errorf("%s: shared definition %q is defined more than once", file, toolName)
+		}
+		res.defs[toolName] = obj
+	}
+
+	var doc struct {
+		Definitions map[string]interface{} `json:"definitions" yaml:"definitions"`
+	}
+	if strings.HasSuffix(name, ".yaml") {
+		err = yaml.Unmarshal(data, &doc)
+	} else {
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	for defName, def := range doc.Definitions {
+		if _, dup := res.defs[defName]; dup {
+			return fmt.Errorf("%s: shared definition %q is defined more than once", file, defName)
+		}
+		if strings.HasSuffix(name, ".yaml") {
+			if def, err = normaliseYAML(def); err != nil {
+				return fmt.Errorf("%s: definition %q: %w", file, defName, err)
+			}
+		}
+		res.defs[defName] = def
+	}
+	return nil
+}
+
+// resolve replaces every shared $ref in v with a copy of the referenced definition.
+// Keys next to the $ref override the definition's top-level keys.
+func (res *toolRefResolver) resolve(v interface{}, stack []string) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		ref, isShared := val["$ref"].(string)
+		if !isShared || !strings.HasPrefix(ref, sharedRefPrefix) {
+			out := make(map[string]interface{}, len(val))
+			for k, child := range val {
+				resolved, err := res.resolve(child, stack)
+				if err != nil {
+					return nil, err
+				}
+				out[k] = resolved
+			}
+			return out, nil
+		}
+
+		name := strings.TrimPrefix(ref, sharedRefPrefix)
+		for _, seen := range stack {
+			if seen == name {
+				return nil, fmt.Errorf("reference cycle: %s -> %s", strings.Join(stack, " -> "), name)
+			}
+		}
+		if len(stack) >= maxRefDepth {
+			return nil, fmt.Errorf("reference %q nested too deeply", ref)
+		}
+		if err := res.loadShared(); err != nil {
+			return nil, err
+		}
+		def, ok := res.defs[name]
+		if !ok {
+			return nil, fmt.Errorf("%w %q (known shared definitions: %s)", ErrUnresolvedToolRef, ref, res.knownNames())
+		}
+		resolved, err := res.resolve(def, append(stack, name))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(val) == 1 {
+			return resolved, nil
+		}
+		base, ok := resolved.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%q is not an object, so it cannot be combined with other keys", ref)
+		}
+		for k, child := range val {
+			if k == "$ref" {
+				continue
+			}
+			if base[k], err = res.resolve(child, stack); err != nil {
+				return nil, err
+			}
+		}
+		return base, nil
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, child := range val {
+			resolved, err := res.resolve(child, stack)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// knownNames lists the shared definition names for error messages
+func (res *toolRefResolver) knownNames() string {
+	if len(res.defs) == 0 {
+		return "none, add them to " + SharedDir + "/tools.yaml"
+	}
+	names := make([]string, 0, len(res.defs))
+	for name := range res.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// resolveToolEntries resolves the shared references of every tool entry (entries are numbered from 1 in errors)
+func (res *toolRefResolver) resolveToolEntries(entries []interface{}) ([]interface{}, error) {
+	out := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		resolved, err := res.resolve(entry, nil)
+		if err != nil {
+			return nil, fmt.Errorf("tool #%d: %w", i+1, err)
+		}
+		out[i] = resolved
+	}
+	return out, nil
+}
+
+// toolsFromEntries converts resolved raw entries into tools
+func toolsFromEntries(entries []interface{}) ([]model.Tool, error) {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+	var tools []model.Tool
+	if err := json.Unmarshal(data, &tools); err != nil {
+		return nil, err
+	}
+	return tools, nil
+}
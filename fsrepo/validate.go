@@ -0,0 +1,741 @@
+package fsrepo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghiac/agentize/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Severity is the severity of a validation issue
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // the tree will misbehave (e.g. tool ignored, node unreachable)
+	SeverityWarning Severity = "warning" // suspicious but loadable
+)
+
+// ValidationIssue describes one problem found in the knowledge tree
+type ValidationIssue struct {
+	NodePath string   // node path relative to the knowledge root (e.g. "root/next")
+	File     string   // file path relative to the knowledge root (e.g. "root/next/tools.json")
+	Line     int      // 1-based line number, 0 if unknown
+	Severity Severity // error or warning
+	Message  string
+}
+
+// String formats the issue as "file:line: severity: message"
+func (i ValidationIssue) String() string {
+	location := i.File
+	if location == "" {
+		location = i.NodePath
+	}
+	if i.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, i.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, i.Severity, i.Message)
+}
+
+// HasErrors reports whether any issue has error severity
+func HasErrors(issues []ValidationIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// validUserID matches user IDs and group names accepted in auth.users and auth.groups
+var validUserID = regexp.MustCompile(`^[A-Za-z0-9_.@:\-]+$`)
+
+// validPerms matches permission strings (see model.Permissions)
+var validPerms = regexp.MustCompile(`^[rwxsdg]*$`)
+
+// validSchemaTypes are the JSON Schema primitive type names
+var validSchemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// lineInError extracts "line N" from parser error messages
+var lineInError = regexp.MustCompile(`line (\d+)`)
+
+// Validate checks the knowledge tree at rootPath and returns every problem found:
+// YAML/JSON parse errors, duplicate node IDs, unknown routing modes, malformed auth
+// entries, tools with invalid JSON Schema, and node directories that can never be reached.
+// The returned error is non-nil only when the tree cannot be inspected at all.
+func Validate(rootPath string) ([]ValidationIssue, error) {
+	absPath, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid root path: %w", err)
+	}
+	if info, err := os.Stat(absPath); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("root path does not exist: %s", absPath)
+	}
+
+	v := &validator{
+		rootPath:  absPath,
+		ids:       make(map[string]string),
+		reachable: make(map[string]bool),
+		fsys:      os.DirFS(absPath),
+		refs:      &toolRefResolver{fsys: os.DirFS(absPath)},
+	}
+
+	if dirExists(filepath.Join(absPath, SharedDir)) {
+		if err := v.refs.loadShared(); err != nil {
+			v.add(ValidationIssue{NodePath: SharedDir, File: SharedDir, Line: errorLine(err), Severity: SeverityError, Message: err.Error()})
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(absPath, "root")); err != nil || !info.IsDir() {
+		v.add(ValidationIssue{NodePath: "root", Severity: SeverityError, Message: "root node directory \"root\" is missing"})
+	} else {
+		v.validateNodeRecursive("root")
+		v.validateRoutingGraph()
+	}
+	v.findUnreachable()
+
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		if v.issues[i].File != v.issues[j].File {
+			return v.issues[i].File < v.issues[j].File
+		}
+		return v.issues[i].Line < v.issues[j].Line
+	})
+	return v.issues, nil
+}
+
+// validator accumulates issues while walking the tree
+type validator struct {
+	rootPath  string
+	fsys      fs.FS // rootPath as a file system, for helpers shared with NodeRepository
+	issues    []ValidationIssue
+	ids       map[string]string // node id -> first node path that declared it
+	reachable map[string]bool   // node paths reachable from root
+	refs      *toolRefResolver  // shared tool definitions, loaded once
+}
+
+func (v *validator) add(issue ValidationIssue) {
+	v.issues = append(v.issues, issue)
+}
+
+// validateNodeRecursive validates a node and its children, following the same
+// child rules as NodeRepository.GetChildren
+func (v *validator) validateNodeRecursive(path string) {
+	v.reachable[path] = true
+	fullPath := filepath.Join(v.rootPath, path)
+
+	hasYAML := fileExists(filepath.Join(fullPath, "node.yaml"))
+	hasMD := fileExists(filepath.Join(fullPath, "node.md"))
+	if !hasYAML && !hasMD {
+		v.add(ValidationIssue{NodePath: path, Severity: SeverityWarning, Message: "node has neither node.md nor node.yaml"})
+	}
+
+	// Metadata comes from node.yaml, or from the node.md front matter when there is no node.yaml
+	metaFile := ""
+	_, hasFrontMatter := v.readMeta(path, "node.md")
+	switch {
+	case hasYAML:
+		metaFile = "node.yaml"
+		if hasFrontMatter {
+			v.add(ValidationIssue{
+				NodePath: path, File: filepath.ToSlash(filepath.Join(path, "node.md")), Line: 1, Severity: SeverityWarning,
+				Message: "front matter is ignored because node.yaml exists",
+			})
+		}
+	case hasFrontMatter:
+		metaFile = "node.md"
+	}
+
+	id := path
+	if metaFile != "" {
+		if declared := v.validateNodeMeta(path, metaFile); declared != "" {
+			id = declared
+		}
+	}
+	if first, exists := v.ids[id]; exists {
+		file := ""
+		if metaFile != "" {
+			file = filepath.ToSlash(filepath.Join(path, metaFile))
+		}
+		v.add(ValidationIssue{
+			NodePath: path,
+			File:     file,
+			Line:     v.idLine(path, metaFile),
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("duplicate node id %q (already used by %s)", id, first),
+		})
+	} else {
+		v.ids[id] = path
+	}
+
+	if name, err := findToolsFile(v.fsys, path); err == nil {
+		v.validateTools(path, name)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		v.add(ValidationIssue{NodePath: path, Severity: SeverityError, Message: "both tools.json and tools.yaml exist; only one is allowed"})
+	}
+
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		v.add(ValidationIssue{NodePath: path, Severity: SeverityError, Message: fmt.Sprintf("cannot read node directory: %v", err)})
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		v.validateNodeRecursive(path + "/" + entry.Name())
+	}
+}
+
+// readMeta returns the node metadata YAML held in metaFile: all of node.yaml, or the
+// front matter of node.md (with line numbers preserved). ok is false if there is none.
+func (v *validator) readMeta(path, metaFile string) ([]byte, bool) {
+	data, err := os.ReadFile(filepath.Join(v.rootPath, path, metaFile))
+	if err != nil {
+		return nil, false
+	}
+	if metaFile == "node.md" {
+		front, _, ok := splitFrontMatter(data)
+		return front, ok
+	}
+	return data, true
+}
+
+// validateNodeMeta validates node.yaml or the node.md front matter and returns the declared node id (if any)
+func (v *validator) validateNodeMeta(path, metaFile string) string {
+	file := filepath.ToSlash(filepath.Join(path, metaFile))
+	data, ok := v.readMeta(path, metaFile)
+	if !ok {
+		v.add(ValidationIssue{NodePath: path, File: file, Severity: SeverityError, Message: "cannot read node metadata"})
+		return ""
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		v.add(ValidationIssue{NodePath: path, File: file, Line: errorLine(err), Severity: SeverityError, Message: fmt.Sprintf("invalid YAML: %v", err)})
+		return ""
+	}
+	if len(doc.Content) == 0 {
+		return ""
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		v.add(ValidationIssue{NodePath: path, File: file, Line: root.Line, Severity: SeverityError, Message: "node metadata must be a mapping"})
+		return ""
+	}
+
+	id := ""
+	if idNode := mappingValue(root, "id"); idNode != nil {
+		id = strings.TrimSpace(idNode.Value)
+		if id == "" {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: idNode.Line, Severity: SeverityWarning, Message: "id is empty; the node path will be used"})
+		}
+	}
+
+	if routing := mappingValue(root, "routing"); routing != nil {
+		v.validateRouting(path, file, routing)
+	}
+
+	if auth := mappingValue(root, "auth"); auth != nil {
+		v.validateAuth(path, file, auth)
+	}
+
+	if llm := mappingValue(root, "llm"); llm != nil {
+		v.validateLLM(path, file, llm)
+		if modelNode, llmModel := mappingValue(root, "model"), mappingValue(llm, "model"); modelNode != nil && llmModel != nil && modelNode.Value != llmModel.Value {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: modelNode.Line, Severity: SeverityWarning, Message: fmt.Sprintf("model %q is ignored, llm.model %q takes precedence", modelNode.Value, llmModel.Value)})
+		}
+	}
+
+	if policy := mappingValue(root, "tools_policy"); policy != nil {
+		v.validateToolsPolicy(path, file, policy)
+	}
+
+	return id
+}
+
+// validateRouting checks the routing mode, conditional rules and their targets
+func (v *validator) validateRouting(path, file string, routing *yaml.Node) {
+	mode := mappingValue(routing, "mode")
+	if mode != nil && !model.IsValidRoutingMode(model.RoutingMode(mode.Value)) {
+		names := make([]string, len(model.ValidRoutingModes))
+		for i, m := range model.ValidRoutingModes {
+			names[i] = string(m)
+		}
+		v.add(ValidationIssue{
+			NodePath: path, File: file, Line: mode.Line, Severity: SeverityError,
+			Message: fmt.Sprintf("unknown routing mode %q (expected one of: %s)", mode.Value, strings.Join(names, ", ")),
+		})
+	}
+
+	checkTarget := func(target *yaml.Node, what string) {
+		if target == nil || target.Value == "" {
+			return
+		}
+		name := strings.TrimPrefix(target.Value, path+"/")
+		if strings.Contains(name, "/") || !dirExists(filepath.Join(v.rootPath, path, name)) {
+			v.add(ValidationIssue{
+				NodePath: path, File: file, Line: target.Line, Severity: SeverityError,
+				Message: fmt.Sprintf("%s %q is not a child of %s", what, target.Value, path),
+			})
+		}
+	}
+	checkTarget(mappingValue(routing, "default"), "routing default")
+
+	rules := mappingValue(routing, "rules")
+	if rules == nil {
+		if mode != nil && mode.Value == string(model.RoutingConditional) && mappingValue(routing, "default") == nil {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: mode.Line, Severity: SeverityWarning, Message: "conditional routing has no rules and no default"})
+		}
+		return
+	}
+	if rules.Kind != yaml.SequenceNode {
+		v.add(ValidationIssue{NodePath: path, File: file, Line: rules.Line, Severity: SeverityError, Message: "routing.rules must be a list"})
+		return
+	}
+	for i, rule := range rules.Content {
+		when := mappingValue(rule, "when")
+		if when == nil {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: rule.Line, Severity: SeverityError, Message: fmt.Sprintf("routing rule %d has no \"when\"", i+1)})
+		} else if err := model.ValidateCondition(when.Value); err != nil {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: when.Line, Severity: SeverityError, Message: fmt.Sprintf("routing rule %d: %v", i+1, err)})
+		}
+		next := mappingValue(rule, "next")
+		if next == nil {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: rule.Line, Severity: SeverityError, Message: fmt.Sprintf("routing rule %d has no \"next\"", i+1)})
+			continue
+		}
+		checkTarget(next, fmt.Sprintf("routing rule %d target", i+1))
+	}
+}
+
+// validateLLM checks the llm override section (temperature range, positive max_tokens)
+func (v *validator) validateLLM(path, file string, llm *yaml.Node) {
+	if llm.Kind != yaml.MappingNode {
+		v.add(ValidationIssue{NodePath: path, File: file, Line: llm.Line, Severity: SeverityError, Message: "llm must be a mapping"})
+		return
+	}
+	if temp := mappingValue(llm, "temperature"); temp != nil {
+		if t, err := strconv.ParseFloat(temp.Value, 64); err != nil || t < 0 || t > 2 {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: temp.Line, Severity: SeverityError, Message: fmt.Sprintf("llm.temperature %q must be a number between 0 and 2", temp.Value)})
+		}
+	}
+	if maxTokens := mappingValue(llm, "max_tokens"); maxTokens != nil {
+		if n, err := strconv.Atoi(maxTokens.Value); err != nil || n <= 0 {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: maxTokens.Line, Severity: SeverityError, Message: fmt.Sprintf("llm.max_tokens %q must be a positive integer", maxTokens.Value)})
+		}
+	}
+}
+
+// validateToolsPolicy checks the strategy and that add, remove and replace are lists of tool
+// names with no name in more than one of them
+func (v *validator) validateToolsPolicy(path, file string, policy *yaml.Node) {
+	if policy.Kind != yaml.MappingNode {
+		v.add(ValidationIssue{NodePath: path, File: file, Line: policy.Line, Severity: SeverityError, Message: "tools_policy must be a mapping"})
+		return
+	}
+	if strategy := mappingValue(policy, "strategy"); strategy != nil && !model.IsValidMergeStrategy(model.MergeStrategy(strategy.Value)) {
+		names := make([]string, len(model.ValidMergeStrategies))
+		for i, s := range model.ValidMergeStrategies {
+			names[i] = string(s)
+		}
+		v.add(ValidationIssue{
+			NodePath: path, File: file, Line: strategy.Line, Severity: SeverityError,
+			Message: fmt.Sprintf("unknown tools_policy.strategy %q (expected one of: %s)", strategy.Value, strings.Join(names, ", ")),
+		})
+	}
+
+	listedIn := make(map[string]string)
+	for _, list := range []string{"add", "remove", "replace"} {
+		names := mappingValue(policy, list)
+		if names == nil {
+			continue
+		}
+		if names.Kind != yaml.SequenceNode {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: names.Line, Severity: SeverityError, Message: fmt.Sprintf("tools_policy.%s must be a list of tool names", list)})
+			continue
+		}
+		for _, name := range names.Content {
+			if prev, ok := listedIn[name.Value]; ok {
+				v.add(ValidationIssue{
+					NodePath: path, File: file, Line: name.Line, Severity: SeverityError,
+					Message: fmt.Sprintf("tool %q is listed in both tools_policy.%s and tools_policy.%s", name.Value, prev, list),
+				})
+				continue
+			}
+			listedIn[name.Value] = list
+		}
+	}
+}
+
+// validateAuth checks auth.default, auth.policy and the auth.users and auth.groups entries
+func (v *validator) validateAuth(path, file string, auth *yaml.Node) {
+	if def := mappingValue(auth, "default"); def != nil {
+		v.validatePerms(path, file, mappingValue(def, "perms"))
+	}
+
+	if policy := mappingValue(auth, "policy"); policy != nil {
+		switch strings.ToLower(policy.Value) {
+		case model.AuthPolicyAllow, model.AuthPolicyDeny:
+			if path != "root" {
+				v.add(ValidationIssue{NodePath: path, File: file, Line: policy.Line, Severity: SeverityWarning, Message: "auth.policy is only read from the root node"})
+			}
+		default:
+			v.add(ValidationIssue{NodePath: path, File: file, Line: policy.Line, Severity: SeverityError, Message: fmt.Sprintf("auth.policy %q must be %q or %q", policy.Value, model.AuthPolicyAllow, model.AuthPolicyDeny)})
+		}
+	}
+
+	v.validateAuthEntries(path, file, auth, "users", "user_id", "user id")
+	v.validateAuthEntries(path, file, auth, "groups", "group_id", "group name")
+}
+
+// validateAuthEntries checks the entries of an auth subsection given as a mapping
+// (users: { "user123": { perms: "rw" } }) or a list (users: [ { user_id: "test", ... } ])
+func (v *validator) validateAuthEntries(path, file string, auth *yaml.Node, section, idKey, what string) {
+	entries := mappingValue(auth, section)
+	if entries == nil {
+		return
+	}
+	switch entries.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(entries.Content); i += 2 {
+			key, value := entries.Content[i], entries.Content[i+1]
+			v.validateAuthID(path, file, section, what, key.Value, key.Line)
+			v.validatePerms(path, file, mappingValue(value, "perms"))
+		}
+	case yaml.SequenceNode:
+		for _, entry := range entries.Content {
+			id := mappingValue(entry, idKey)
+			if id == nil {
+				v.add(ValidationIssue{NodePath: path, File: file, Line: entry.Line, Severity: SeverityError, Message: fmt.Sprintf("auth.%s entry is missing %s", section, idKey)})
+				continue
+			}
+			v.validateAuthID(path, file, section, what, id.Value, id.Line)
+			v.validatePerms(path, file, mappingValue(entry, "perms"))
+		}
+	default:
+		v.add(ValidationIssue{NodePath: path, File: file, Line: entries.Line, Severity: SeverityError, Message: fmt.Sprintf("auth.%s must be a mapping or a list", section)})
+	}
+}
+
+func (v *validator) validateAuthID(path, file, section, what, id string, line int) {
+	if !validUserID.MatchString(id) {
+		v.add(ValidationIssue{
+			NodePath: path, File: file, Line: line, Severity: SeverityError,
+			Message: fmt.Sprintf("malformed %s %q in auth.%s (allowed: letters, digits, _ . @ : -)", what, id, section),
+		})
+	}
+}
+
+func (v *validator) validatePerms(path, file string, perms *yaml.Node) {
+	if perms != nil && !validPerms.MatchString(perms.Value) {
+		v.add(ValidationIssue{
+			NodePath: path, File: file, Line: perms.Line, Severity: SeverityError,
+			Message: fmt.Sprintf("invalid perms %q (allowed letters: r w x s d g)", perms.Value),
+		})
+	}
+}
+
+// validateTools checks that tools.json/tools.yaml parses, its shared references resolve,
+// and every tool has a valid input schema
+func (v *validator) validateTools(path string, fileName string) {
+	file := filepath.ToSlash(filepath.Join(path, fileName))
+	data, err := os.ReadFile(filepath.Join(v.rootPath, path, fileName))
+	if err != nil {
+		v.add(ValidationIssue{NodePath: path, File: file, Severity: SeverityError, Message: fmt.Sprintf("cannot read file: %v", err)})
+		return
+	}
+
+	entries, err := decodeToolsDocument(data, fileName)
+	if err != nil {
+		line := errorLine(err)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) {
+			line = offsetLine(data, syntaxErr.Offset)
+		} else if errors.As(err, &typeErr) {
+			line = offsetLine(data, typeErr.Offset)
+		}
+		format := "JSON"
+		if strings.HasSuffix(fileName, ".yaml") {
+			format = "YAML"
+		}
+		v.add(ValidationIssue{NodePath: path, File: file, Line: line, Severity: SeverityError, Message: fmt.Sprintf("invalid %s: %v", format, err)})
+		return
+	}
+	if entries == nil {
+		v.add(ValidationIssue{NodePath: path, File: file, Severity: SeverityWarning, Message: `no "tools" array found; the node will have zero tools`})
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i, entry := range entries {
+		resolved, err := v.refs.resolve(entry, nil)
+		if err != nil {
+			ref, _ := entry.(map[string]interface{})["$ref"].(string)
+			v.add(ValidationIssue{NodePath: path, File: file, Line: refLine(data, ref), Severity: SeverityError, Message: fmt.Sprintf("tool #%d: %v", i+1, err)})
+			continue
+		}
+		tool, ok := resolved.(map[string]interface{})
+		if !ok {
+			v.add(ValidationIssue{NodePath: path, File: file, Severity: SeverityError, Message: fmt.Sprintf("tool #%d must be an object", i+1)})
+			continue
+		}
+		name, _ := tool["name"].(string)
+		line := toolLine(data, name)
+		if ref, _ := entry.(map[string]interface{})["$ref"].(string); ref != "" && line == 0 {
+			line = refLine(data, ref)
+		}
+		label := fmt.Sprintf("tool #%d", i+1)
+		if name == "" {
+			v.add(ValidationIssue{NodePath: path, File: file, Severity: SeverityError, Message: label + " has no name"})
+		} else {
+			label = fmt.Sprintf("tool %q", name)
+			if seen[name] {
+				v.add(ValidationIssue{NodePath: path, File: file, Line: line, Severity: SeverityWarning, Message: label + " is defined more than once"})
+			}
+			seen[name] = true
+		}
+
+		if desc, _ := tool["description"].(string); desc == "" {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: line, Severity: SeverityWarning, Message: label + " has no description"})
+		}
+
+		if block, ok := tool["http"]; ok {
+			if err := validateHTTPTool(block); err != nil {
+				v.add(ValidationIssue{NodePath: path, File: file, Line: line, Severity: SeverityError, Message: label + ": " + err.Error()})
+			}
+		}
+
+		schema, ok := tool["input_schema"]
+		if !ok {
+			continue
+		}
+		for _, msg := range validateSchema(schema, "input_schema") {
+			v.add(ValidationIssue{NodePath: path, File: file, Line: line, Severity: SeverityError, Message: label + ": " + msg})
+		}
+	}
+}
+
+// validateHTTPTool decodes a tool's http block and checks it with model.HTTPTool.Validate
+func validateHTTPTool(block interface{}) error {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	var h model.HTTPTool
+	if err := json.Unmarshal(data, &h); err != nil {
+		return fmt.Errorf("invalid http block: %v", err)
+	}
+	return h.Validate()
+}
+
+// validateSchema performs structural JSON Schema checks and returns problems found
+func validateSchema(schema interface{}, where string) []string {
+	obj, ok := schema.(map[string]interface{})
+	if !ok {
+		return []string{where + " must be an object"}
+	}
+	if _, isRef := obj["$ref"]; isRef {
+		return nil
+	}
+	for _, combinator := range []string{"anyOf", "oneOf", "allOf"} {
+		if _, ok := obj[combinator]; ok {
+			return nil
+		}
+	}
+
+	var problems []string
+	rawType, hasType := obj["type"]
+	if !hasType {
+		return append(problems, where+` is missing "type"`)
+	}
+	typeName, ok := rawType.(string)
+	if !ok || !validSchemaTypes[typeName] {
+		return append(problems, fmt.Sprintf("%s has invalid type %v", where, rawType))
+	}
+
+	switch typeName {
+	case "object":
+		props := map[string]interface{}{}
+		if rawProps, ok := obj["properties"]; ok {
+			props, ok = rawProps.(map[string]interface{})
+			if !ok {
+				problems = append(problems, where+".properties must be an object")
+			}
+		}
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			problems = append(problems, validateSchema(props[name], where+".properties."+name)...)
+		}
+		if rawRequired, ok := obj["required"]; ok {
+			required, ok := rawRequired.([]interface{})
+			if !ok {
+				problems = append(problems, where+".required must be an array of property names")
+				break
+			}
+			for _, r := range required {
+				name, ok := r.(string)
+				if !ok {
+					problems = append(problems, where+".required must contain only strings")
+					continue
+				}
+				if _, exists := props[name]; !exists {
+					problems = append(problems, fmt.Sprintf("%s.required lists %q which is not in properties", where, name))
+				}
+			}
+		}
+	case "array":
+		if items, ok := obj["items"]; ok {
+			problems = append(problems, validateSchema(items, where+".items")...)
+		}
+	}
+	return problems
+}
+
+// validateRoutingGraph loads the tree like NodeRepository and reports routing cycles and
+// nodes that routing can never reach from root (see TreeGraph)
+func (v *validator) validateRoutingGraph() {
+	repo := &NodeRepository{fsys: v.fsys, cache: make(map[string]*model.Node)}
+	nodes := make(map[string]*model.Node)
+	if err := repo.readTreeRecursive(v.fsys, "root", nodes, nil); err != nil {
+		return // parse errors are reported per file already
+	}
+	graph := analyzeTree(nodes)
+	for _, cycle := range graph.Cycles {
+		v.add(ValidationIssue{
+			NodePath: cycle[0], Severity: SeverityError,
+			Message: "routing cycle: " + strings.Join(cycle, " -> "),
+		})
+	}
+	for _, p := range graph.Unreachable {
+		v.add(ValidationIssue{
+			NodePath: p, Severity: SeverityWarning,
+			Message: "node is not reachable from root by routing (no conditional rule or default leads here)",
+		})
+	}
+}
+
+// findUnreachable reports directories holding node files that can't be reached from "root"
+// (siblings of root, or hidden directories inside the tree)
+func (v *validator) findUnreachable() {
+	_ = filepath.WalkDir(v.rootPath, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || p == v.rootPath {
+			return nil
+		}
+		rel, relErr := filepath.Rel(v.rootPath, p)
+		if relErr != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if v.reachable[rel] {
+			return nil
+		}
+		if rel == SharedDir {
+			return filepath.SkipDir
+		}
+		if fileExists(filepath.Join(p, "node.md")) || fileExists(filepath.Join(p, "node.yaml")) ||
+			fileExists(filepath.Join(p, "tools.json")) || fileExists(filepath.Join(p, "tools.yaml")) {
+			v.add(ValidationIssue{
+				NodePath: rel, Severity: SeverityWarning,
+				Message: "orphaned node: not reachable from root (nodes must live under root/ in non-hidden directories)",
+			})
+		}
+		return nil
+	})
+}
+
+// idLine returns the line of the id key in a node's metadata file (0 if unknown)
+func (v *validator) idLine(path, metaFile string) int {
+	if metaFile == "" {
+		return 0
+	}
+	data, ok := v.readMeta(path, metaFile)
+	if !ok {
+		return 0
+	}
+	var doc yaml.Node
+	if yaml.Unmarshal(data, &doc) != nil || len(doc.Content) == 0 {
+		return 0
+	}
+	if idNode := mappingValue(doc.Content[0], "id"); idNode != nil {
+		return idNode.Line
+	}
+	return 0
+}
+
+// mappingValue returns the value node for key in a YAML mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// errorLine extracts a line number from a parser error message (0 if absent)
+func errorLine(err error) int {
+	if m := lineInError.FindStringSubmatch(err.Error()); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	return 0
+}
+
+// offsetLine converts a byte offset into a 1-based line number
+func offsetLine(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return strings.Count(string(data[:offset]), "\n") + 1
+}
+
+// toolLine finds the line declaring a tool's name in tools.json or tools.yaml (0 if not found)
+func toolLine(data []byte, name string) int {
+	return keyValueLine(data, "name", name)
+}
+
+// refLine finds the line of a "$ref" entry in a tools file (0 if not found)
+func refLine(data []byte, ref string) int {
+	return keyValueLine(data, "$ref", ref)
+}
+
+// keyValueLine finds the first line where key is set to value, in JSON or YAML syntax
+func keyValueLine(data []byte, key, value string) int {
+	if value == "" {
+		return 0
+	}
+	re := regexp.MustCompile(`(?m)["']?` + regexp.QuoteMeta(key) + `["']?\s*:\s*["']?` + regexp.QuoteMeta(value) + `["']?\s*(?:,|$|\})`)
+	if loc := re.FindIndex(data); loc != nil {
+		return offsetLine(data, int64(loc[0]))
+	}
+	return 0
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,115 @@
+package fsrepo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	write := func(rel, content string) {
+		full := filepath.Join(tmpDir, rel)
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", rel, err)
+		}
+	}
+
+	write("root/node.yaml", `id: "root"
+title: "Root"
+routing:
+  mode: "sequentail"
+auth:
+  users:
+    - user_id: "bad user"
+      perms: "rw"
+`)
+	write("root/node.md", "# Root")
+	write("root/a/node.yaml", `id: "shared"`)
+	write("root/a/tools.json", `{
+  "tools": [
+    {
+      "name": "no_type",
+      "description": "missing schema type",
+      "input_schema": { "properties": { "x": { "type": "string" } } }
+    }
+  ]
+}`)
+	write("root/b/node.yaml", `id: "shared"`)
+	write("root/b/tools.json", "{\n  \"tools\": [\n")
+	write("root/c/node.yaml", "title: [unclosed\n")
+	write("root/d/node.md", "# D")
+	write("root/d/tools.yaml", "tools:\n  - $ref: shared/search_docs\n  - $ref: shared/missing\n")
+	write("_shared/tools.yaml", "tools:\n  - name: search_docs\n    description: \"Search\"\n    input_schema:\n      type: object\n")
+	write("root/e/node.md", "---\ntitle: \"E\"\nrouting:\n  mode: \"sideways\"\n---\n# E\n")
+	write("root/f/node.yaml", `id: "f"`)
+	write("root/f/node.md", "---\nid: \"other\"\n---\n# F\n")
+	write("root/.hidden/node.md", "# Hidden")
+	write("other/node.md", "# Orphan")
+
+	issues, err := Validate(tmpDir)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if !HasErrors(issues) {
+		t.Fatal("Expected errors")
+	}
+
+	expect := []struct {
+		file, contains string
+		line           int
+		severity       Severity
+	}{
+		{"root/node.yaml", "unknown routing mode", 4, SeverityError},
+		{"root/node.yaml", "malformed user id", 7, SeverityError},
+		{"root/a/tools.json", `missing "type"`, 4, SeverityError},
+		{"root/b/node.yaml", "duplicate node id", 1, SeverityError},
+		{"root/b/tools.json", "invalid JSON", 3, SeverityError},
+		{"root/c/node.yaml", "invalid YAML", 1, SeverityError},
+		{"root/d/tools.yaml", "unresolved tool reference", 3, SeverityError},
+		{"root/e/node.md", "unknown routing mode", 4, SeverityError},
+		{"root/f/node.md", "front matter is ignored", 1, SeverityWarning},
+		{"", "orphaned node", 0, SeverityWarning},
+	}
+	for _, e := range expect {
+		found := false
+		for _, issue := range issues {
+			if issue.File == e.file && strings.Contains(issue.Message, e.contains) && issue.Line == e.line && issue.Severity == e.severity {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s issue in %q at line %d, got:\n%v", e.contains, e.file, e.line, issues)
+		}
+	}
+
+	orphans := map[string]bool{}
+	for _, issue := range issues {
+		if strings.Contains(issue.Message, "orphaned") {
+			orphans[issue.NodePath] = true
+		}
+	}
+	if !orphans["other"] || !orphans["root/.hidden"] || orphans[SharedDir] {
+		t.Errorf("Expected other and root/.hidden (but not %s) to be reported as orphaned, got %v", SharedDir, orphans)
+	}
+}
+
+func TestValidate_CleanTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "root", "next"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "root", "node.yaml"), []byte("id: \"root\"\nrouting:\n  mode: \"sequential\"\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "root", "node.md"), []byte("# Root"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "root", "next", "node.md"), []byte("# Next"), 0644)
+
+	issues, err := Validate(tmpDir)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("Expected no issues, got %v", issues)
+	}
+}
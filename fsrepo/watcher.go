@@ -0,0 +1,244 @@
+package fsrepo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ghiac/agentize/log"
+)
+
+// DefaultWatchInterval is the polling interval used by Watch when none is given
+const DefaultWatchInterval = 2 * time.Second
+
+// watchDebounce is how long Watch waits after the last file event before reloading, so an
+// editor saving several files (or a git checkout) causes a single reload
+const watchDebounce = 250 * time.Millisecond
+
+// Watch watches the knowledge tree for changes to node.md, node.yaml and tools.json/tools.yaml
+// (including added or removed node directories) and calls Reload when something changed.
+// Trees on disk are watched with fsnotify (every directory is watched, events are debounced);
+// trees that are not on disk, or platforms where fsnotify fails, are polled every interval
+// instead. onReload, if non-nil, is called after every successful reload.
+// Watch blocks until ctx is cancelled.
+func (r *NodeRepository) Watch(ctx context.Context, interval time.Duration, onReload func()) {
+	if dirs := r.watchDirs(); len(dirs) > 0 {
+		watcher, err := fsnotify.NewWatcher()
+		if err == nil {
+			tw := &treeWatcher{watcher: watcher, dirs: make(map[string]bool)}
+			for _, dir := range dirs {
+				if err = tw.addTree(dir); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				r.watchEvents(ctx, tw, onReload)
+				return
+			}
+			watcher.Close()
+		}
+		log.Log.Warn("[NodeRepository] ⚠️  File notifications unavailable, polling knowledge tree", "error", err)
+	}
+	r.poll(ctx, interval, onReload)
+}
+
+// watchDirs returns the directories on disk behind the tree, nil when it is not on disk
+func (r *NodeRepository) watchDirs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.rootPath != "" {
+		return []string{r.rootPath}
+	}
+	return r.diskRoots
+}
+
+// treeWatcher is an fsnotify watcher over every directory of a tree
+type treeWatcher struct {
+	watcher *fsnotify.Watcher
+	dirs    map[string]bool // watched directories
+}
+
+// addTree watches dir and every non-hidden directory below it
+func (tw *treeWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			return fs.SkipDir
+		}
+		if err := tw.watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		tw.dirs[path] = true
+		return nil
+	})
+}
+
+// relevant reports whether ev may change the tree, watching directories created by it
+func (tw *treeWatcher) relevant(ev fsnotify.Event) bool {
+	name := filepath.Base(ev.Name)
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	if isNodeFile(name) {
+		return true
+	}
+	switch {
+	case ev.Has(fsnotify.Create):
+		if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+			if err := tw.addTree(ev.Name); err != nil {
+				log.Log.Warn("[NodeRepository] ⚠️  Failed to watch new directory", "path", ev.Name, "error", err)
+			}
+			return true
+		}
+	case ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename):
+		if tw.dirs[ev.Name] {
+			delete(tw.dirs, ev.Name)
+			return true
+		}
+	}
+	return false
+}
+
+// watchEvents reloads the tree after file events settle, until ctx is cancelled
+func (r *NodeRepository) watchEvents(ctx context.Context, tw *treeWatcher, onReload func()) {
+	defer tw.watcher.Close()
+	log.Log.Info("[NodeRepository] 👀 Watching knowledge tree", "path", r.sourceName(), "mode", "fsnotify", "directories", len(tw.dirs))
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Log.Info("[NodeRepository] 🛑 Knowledge tree watcher stopped")
+			return
+		case ev, ok := <-tw.watcher.Events:
+			if !ok {
+				return
+			}
+			if tw.relevant(ev) {
+				debounce.Reset(watchDebounce)
+			}
+		case err, ok := <-tw.watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been dropped (e.g. queue overflow): reload to be safe
+			log.Log.Warn("[NodeRepository] ⚠️  Knowledge tree watcher error", "error", err)
+			debounce.Reset(watchDebounce)
+		case <-debounce.C:
+			if err := r.Reload(); err != nil {
+				// The next change triggers another attempt
+				log.Log.Error("[NodeRepository] ❌ Hot reload failed, keeping previous tree", "error", err)
+				continue
+			}
+			if onReload != nil {
+				onReload()
+			}
+		}
+	}
+}
+
+// poll reloads the tree when its fingerprint changes, checking every interval, until ctx is cancelled
+func (r *NodeRepository) poll(ctx context.Context, interval time.Duration, onReload func()) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	last, err := r.fingerprint()
+	if err != nil {
+		log.Log.Warn("[NodeRepository] ⚠️  Failed to fingerprint knowledge tree", "error", err)
+	}
+	log.Log.Info("[NodeRepository] 👀 Watching knowledge tree", "path", r.sourceName(), "mode", "poll", "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Log.Info("[NodeRepository] 🛑 Knowledge tree watcher stopped")
+			return
+		case <-ticker.C:
+			current, err := r.fingerprint()
+			if err != nil {
+				log.Log.Warn("[NodeRepository] ⚠️  Failed to fingerprint knowledge tree", "error", err)
+				continue
+			}
+			if current == last {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				// Keep the old fingerprint so the reload is retried on the next tick
+				log.Log.Error("[NodeRepository] ❌ Hot reload failed, keeping previous tree", "error", err)
+				continue
+			}
+			last = current
+			if onReload != nil {
+				onReload()
+			}
+		}
+	}
+}
+
+// sourceName returns the human readable origin of the tree
+func (r *NodeRepository) sourceName() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.source
+}
+
+// fingerprint hashes the path, size and modification time of every node file and directory
+func (r *NodeRepository) fingerprint() (string, error) {
+	var entries []string
+	err := fs.WalkDir(r.files(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != "." {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !isNodeFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, fmt.Sprintf("%s|%t|%d|%d", path, d.IsDir(), info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(entries)
+	h := sha256.Sum256([]byte(strings.Join(entries, "\n")))
+	return hex.EncodeToString(h[:]), nil
+}
+
+// isNodeFile reports whether name is one of the files that define a node
+func isNodeFile(name string) bool {
+	switch name {
+	case "node.md", "node.yaml", "tools.json", "tools.yaml":
+		return true
+	}
+	return false
+}
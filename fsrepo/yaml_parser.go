@@ -3,6 +3,7 @@ package fsrepo
 import (
 	"fmt"
 	"github.com/ghiac/agentize/model"
+	"gopkg.in/yaml.v3"
 	"strings"
 )
 
@@ -19,15 +20,19 @@ func parseYAML(data []byte, v interface{}) error {
 
 	var currentSection string
 	var authStarted bool
+	var authSub string // "users", "groups" or "roles" while inside that auth subsection
 	var currentUserID string
 	var currentPerms *model.Permissions
 	var inDefaultSection bool
 	var inheritExplicitlySet bool
 
-	// Initialize Users map if nil
+	// Initialize Users and Groups maps if nil
 	if meta.Auth.Users == nil {
 		meta.Auth.Users = make(map[string]*model.Permissions)
 	}
+	if meta.Auth.Groups == nil {
+		meta.Auth.Groups = make(map[string]*model.Permissions)
+	}
 
 	// Initialize Default permissions if needed
 	if meta.Auth.Default == nil {
@@ -37,6 +42,24 @@ func parseYAML(data []byte, v interface{}) error {
 	// Default inherit to true (as documented)
 	meta.Auth.Inherit = true
 
+	// startEntry starts a permissions entry for name in the current auth subsection
+	startEntry := func(sub, name string) {
+		inDefaultSection = false
+		currentUserID = name
+		currentPerms = &model.Permissions{}
+		switch sub {
+		case "groups":
+			meta.Auth.Groups[name] = currentPerms
+		case "roles":
+			if meta.Auth.Roles == nil {
+				meta.Auth.Roles = make(map[string]*model.Permissions)
+			}
+			meta.Auth.Roles[name] = currentPerms
+		default:
+			meta.Auth.Users[name] = currentPerms
+		}
+	}
+
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -49,6 +72,7 @@ func parseYAML(data []byte, v interface{}) error {
 			currentSection = strings.TrimSpace(section)
 			if currentSection == "auth" {
 				authStarted = true
+				authSub = ""
 				currentUserID = ""
 				currentPerms = nil
 				inDefaultSection = false
@@ -57,18 +81,21 @@ func parseYAML(data []byte, v interface{}) error {
 				inDefaultSection = true
 				currentUserID = ""
 				currentPerms = meta.Auth.Default
-			} else if authStarted && !strings.Contains(section, ":") {
-				// This might be a user ID (quoted or unquoted)
-				userID := strings.Trim(section, `"'`)
-				if userID != "" && userID != "default" {
-					inDefaultSection = false
-					currentUserID = userID
-					currentPerms = &model.Permissions{}
-					meta.Auth.Users[currentUserID] = currentPerms
+			} else if authStarted && (currentSection == "users" || currentSection == "groups" || currentSection == "roles") {
+				authSub = currentSection
+				currentUserID = ""
+				currentPerms = nil
+				inDefaultSection = false
+			} else if authStarted && !topLevelSections[currentSection] && !strings.Contains(section, ":") {
+				// This might be a user, group or role name (quoted or unquoted)
+				name := strings.Trim(section, `"'`)
+				if name != "" && name != "default" {
+					startEntry(authSub, name)
 				}
 			} else {
 				// Reset all flags for other sections
 				authStarted = false
+				authSub = ""
 				currentUserID = ""
 				currentPerms = nil
 				inDefaultSection = false
@@ -76,7 +103,7 @@ func parseYAML(data []byte, v interface{}) error {
 			continue
 		}
 
-		// Handle array items in auth.users section (e.g., "- user_id: test")
+		// Handle array items in auth sections (e.g., "- user_id: test", "- group_id: staff")
 		if strings.HasPrefix(line, "-") && authStarted {
 			rest := strings.TrimSpace(strings.TrimPrefix(line, "-"))
 			if strings.Contains(rest, ":") {
@@ -85,10 +112,15 @@ func parseYAML(data []byte, v interface{}) error {
 					key := strings.TrimSpace(parts[0])
 					value := strings.TrimSpace(parts[1])
 					value = strings.Trim(value, `"'`)
-					if key == "user_id" && value != "" {
-						currentUserID = value
-						currentPerms = &model.Permissions{}
-						meta.Auth.Users[currentUserID] = currentPerms
+					if value != "" {
+						switch key {
+						case "user_id":
+							startEntry("users", value)
+						case "group_id", "group":
+							startEntry("groups", value)
+						case "role":
+							startEntry("roles", value)
+						}
 					}
 				}
 			}
@@ -117,6 +149,8 @@ func parseYAML(data []byte, v interface{}) error {
 			case key == "inherit" && authStarted:
 				meta.Auth.Inherit = parseBool(value)
 				inheritExplicitlySet = true
+			case key == "policy" && authStarted:
+				meta.Auth.Policy = strings.ToLower(value)
 			case currentPerms != nil && (currentUserID != "" || inDefaultSection):
 				// Parse user permissions or default permissions
 				switch key {
@@ -152,6 +186,11 @@ func parseYAML(data []byte, v interface{}) error {
 	return nil
 }
 
+// topLevelSections are node.yaml sections that end the auth block rather than name a user
+var topLevelSections = map[string]bool{
+	"mcp": true, "routing": true, "llm": true, "memory": true, "policy": true, "tools_policy": true,
+}
+
 func parseBool(s string) bool {
 	s = strings.ToLower(s)
 	return s == "true" || s == "yes" || s == "1"
@@ -197,3 +236,23 @@ func parseStringArray(s string) []string {
 	}
 	return result
 }
+
+// parseNestedSections decodes the routing, model, llm, tools_policy and on_enter sections of node.yaml into meta
+func parseNestedSections(data []byte, meta *model.NodeMeta) error {
+	var doc struct {
+		Model       string               `yaml:"model"`
+		Routing     model.Routing        `yaml:"routing"`
+		LLM         model.LLMOverride    `yaml:"llm"`
+		ToolsPolicy model.ToolsPolicy    `yaml:"tools_policy"`
+		OnEnter     *model.OnEnterAction `yaml:"on_enter"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	meta.Routing = doc.Routing
+	meta.Model = doc.Model
+	meta.LLM = doc.LLM
+	meta.ToolsPolicy = doc.ToolsPolicy
+	meta.OnEnter = doc.OnEnter
+	return nil
+}
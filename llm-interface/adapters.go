@@ -0,0 +1,158 @@
+package llminterface
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ProviderConfig is the connection of a built-in provider adapter (see NewProvider)
+type ProviderConfig struct {
+	APIKey     string
+	BaseURL    string       // default: the provider's public API
+	HTTPClient *http.Client // default: http.DefaultClient
+	// MaxTokens caps the answer of the Anthropic and Gemini adapters (default for Anthropic,
+	// which requires one: DefaultMaxTokens; Gemini: the model's limit)
+	MaxTokens int
+}
+
+// DefaultMaxTokens is the answer limit sent to Anthropic when ProviderConfig.MaxTokens is not set
+const DefaultMaxTokens = 4096
+
+// Provider names accepted by NewProvider
+const (
+	ProviderOpenAI    = "openai"    // any OpenAI-compatible chat completions endpoint
+	ProviderAnthropic = "anthropic" // the Anthropic Messages API
+	ProviderGemini    = "gemini"    // the Google Gemini generateContent API
+)
+
+// NewProvider returns the built-in adapter of the named provider API (ProviderOpenAI, the
+// default when name is empty, ProviderAnthropic or ProviderGemini)
+func NewProvider(name string, config ProviderConfig) (Provider, error) {
+	switch strings.ToLower(name) {
+	case "", ProviderOpenAI:
+		return NewOpenAIProvider(config), nil
+	case ProviderAnthropic:
+		return NewAnthropicProvider(config), nil
+	case ProviderGemini:
+		return NewGeminiProvider(config), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q (expected %s, %s or %s)", name, ProviderOpenAI, ProviderAnthropic, ProviderGemini)
+	}
+}
+
+// OpenAIProvider is a Provider calling an OpenAI-compatible chat completions endpoint
+type OpenAIProvider struct {
+	client *openai.Client
+}
+
+// NewOpenAIProvider returns a Provider for the OpenAI-compatible endpoint of config
+func NewOpenAIProvider(config ProviderConfig) *OpenAIProvider {
+	clientConfig := openai.DefaultConfig(config.APIKey)
+	if config.BaseURL != "" {
+		clientConfig.BaseURL = config.BaseURL
+	}
+	if config.HTTPClient != nil {
+		clientConfig.HTTPClient = config.HTTPClient
+	}
+	return &OpenAIProvider{client: openai.NewClientWithConfig(clientConfig)}
+}
+
+// ChatCompletion implements the Provider interface.
+func (p *OpenAIProvider) ChatCompletion(ctx context.Context, model string, messages []Message, tools []Tool) (*Response, error) {
+	request := openai.ChatCompletionRequest{Model: model, Messages: ToOpenAIMessages(messages)}
+	if len(tools) > 0 {
+		request.Tools = ToOpenAITools(tools)
+	}
+	resp, err := p.client.CreateChatCompletion(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return FromOpenAIResponse(resp), nil
+}
+
+// postJSON POSTs body as JSON to url and decodes the response into out. A non-2xx status is
+// returned as an error carrying the provider's error message (from decodeError).
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body any, out any, decodeError func([]byte) string) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		message := decodeError(respBody)
+		if message == "" {
+			message = strings.TrimSpace(string(respBody))
+		}
+		return fmt.Errorf("status %d: %s", resp.StatusCode, message)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// parseDataURL splits a base64 data URL (data:image/png;base64,...) into its media type and data
+func parseDataURL(url string) (mediaType string, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	header, data, found := strings.Cut(rest, ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(header, ";base64"), data, true
+}
+
+// toolArguments parses the JSON arguments of a tool call into an object for providers that take
+// them as one ({} when they are empty or invalid)
+func toolArguments(arguments string) json.RawMessage {
+	var object map[string]any
+	if json.Unmarshal([]byte(arguments), &object) != nil || object == nil {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// toolSchema returns the parameters of a tool as a JSON object (an empty object schema when unset)
+func toolSchema(parameters any) map[string]any {
+	schema := map[string]any{}
+	if parameters != nil {
+		if data, err := json.Marshal(parameters); err == nil {
+			json.Unmarshal(data, &schema)
+		}
+	}
+	if schema == nil {
+		schema = map[string]any{}
+	}
+	if _, ok := schema["type"]; !ok {
+		schema["type"] = "object"
+	}
+	return schema
+}
@@ -0,0 +1,202 @@
+package llminterface
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// conversation is a multi-turn tool calling exchange: the model called two tools, got their
+// results and the user then sent an image
+var conversation = []Message{
+	{Role: "system", Content: "You are a travel assistant."},
+	{Role: "system", Content: "Use metric units."},
+	{Role: "user", Content: "Weather in Paris and Rome?"},
+	{Role: "assistant", Content: "Let me check.", ToolCalls: []ToolCall{
+		{ID: "call_1", Name: "get_weather", Arguments: `{"city":"Paris"}`},
+		{ID: "call_2", Name: "get_weather", Arguments: `{"city":"Rome"}`},
+	}},
+	{Role: "tool", ToolCallID: "call_1", Content: "18°C"},
+	{Role: "tool", ToolCallID: "call_2", Content: "24°C"},
+	{Role: "user", Content: "And this place?", Images: []string{"data:image/png;base64,iVBORw0KGgo="}},
+}
+
+var tools = []Tool{
+	{Name: "get_weather", Description: "Current weather", Parameters: map[string]any{
+		"type": "object", "additionalProperties": false,
+		"properties": map[string]any{"city": map[string]any{"type": "string"}, "examples": map[string]any{"type": "string"}},
+	}},
+	{Name: "get_time", Description: "Current time"},
+}
+
+// serve starts a server answering every request with status and response, recording the last
+// request's path, headers and body
+func serve(t *testing.T, status int, response string) (*httptest.Server, *http.Request, *map[string]any) {
+	var last http.Request
+	body := map[string]any{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = *r
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("Expected a JSON request, got %s", data)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &last, &body
+}
+
+// jsonOf re-encodes a decoded request field for comparison
+func jsonOf(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func TestAnthropicProvider(t *testing.T) {
+	server, request, body := serve(t, http.StatusOK, `{"model":"claude-test","stop_reason":"tool_use",
+		"content":[{"type":"text","text":"Checking the time."},{"type":"tool_use","id":"toolu_1","name":"get_time","input":{}}],
+		"usage":{"input_tokens":100,"output_tokens":20,"cache_creation_input_tokens":10,"cache_read_input_tokens":50}}`)
+	provider, err := NewProvider(ProviderAnthropic, ProviderConfig{APIKey: "sk-ant", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	resp, err := provider.ChatCompletion(context.Background(), "claude-test", conversation, tools)
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	if request.URL.Path != "/messages" || request.Header.Get("x-api-key") != "sk-ant" || request.Header.Get("anthropic-version") == "" {
+		t.Errorf("Unexpected request %s %v", request.URL.Path, request.Header)
+	}
+
+	// System messages become the system prompt, tool results a user turn after the tool calls
+	if (*body)["system"] != "You are a travel assistant.\n\nUse metric units." || (*body)["max_tokens"] != float64(DefaultMaxTokens) {
+		t.Errorf("Unexpected system prompt or max_tokens: %v", *body)
+	}
+	want := `[{"content":[{"text":"Weather in Paris and Rome?","type":"text"}],"role":"user"},` +
+		`{"content":[{"text":"Let me check.","type":"text"},{"id":"call_1","input":{"city":"Paris"},"name":"get_weather","type":"tool_use"},{"id":"call_2","input":{"city":"Rome"},"name":"get_weather","type":"tool_use"}],"role":"assistant"},` +
+		`{"content":[{"content":"18°C","tool_use_id":"call_1","type":"tool_result"},{"content":"24°C","tool_use_id":"call_2","type":"tool_result"},` +
+		`{"source":{"data":"iVBORw0KGgo=","media_type":"image/png","type":"base64"},"type":"image"},{"text":"And this place?","type":"text"}],"role":"user"}]`
+	if got := jsonOf((*body)["messages"]); got != want {
+		t.Errorf("Unexpected messages:\n got %s\nwant %s", got, want)
+	}
+	if got := jsonOf((*body)["tools"]); !strings.Contains(got, `"input_schema":{"additionalProperties":false`) || !strings.Contains(got, `{"description":"Current time","input_schema":{"type":"object"},"name":"get_time"}`) {
+		t.Errorf("Unexpected tools: %s", got)
+	}
+
+	if resp.Content != "Checking the time." || len(resp.ToolCalls) != 1 || resp.ToolCalls[0] != (ToolCall{ID: "toolu_1", Name: "get_time", Arguments: "{}"}) {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	// Usage is mapped so the engine counts and prices the call like an OpenAI one
+	usage := ToOpenAIResponse(resp).Usage
+	if usage.PromptTokens != 160 || usage.CompletionTokens != 20 || usage.TotalTokens != 180 || usage.PromptTokensDetails.CachedTokens != 50 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+	if ToOpenAIResponse(resp).Choices[0].FinishReason != openai.FinishReasonToolCalls {
+		t.Errorf("Expected the tool_calls finish reason")
+	}
+
+	failing, _, _ := serve(t, http.StatusTooManyRequests, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+	provider = NewAnthropicProvider(ProviderConfig{BaseURL: failing.URL})
+	if _, err := provider.ChatCompletion(context.Background(), "claude-test", conversation, nil); err == nil || err.Error() != "anthropic: status 429: rate_limit_error: slow down" {
+		t.Errorf("Expected the provider's error, got %v", err)
+	}
+}
+
+func TestGeminiProvider(t *testing.T) {
+	server, request, body := serve(t, http.StatusOK, `{"modelVersion":"gemini-test-001",
+		"candidates":[{"finishReason":"MAX_TOKENS","content":{"role":"model","parts":[{"text":"thinking...","thought":true},{"text":"Paris is cooler."},{"functionCall":{"name":"get_time","args":{"zone":"CET"}}}]}}],
+		"usageMetadata":{"promptTokenCount":120,"candidatesTokenCount":15,"thoughtsTokenCount":5,"totalTokenCount":140,"cachedContentTokenCount":64}}`)
+	provider, err := NewProvider(ProviderGemini, ProviderConfig{APIKey: "gm-key", BaseURL: server.URL, MaxTokens: 512})
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	resp, err := provider.ChatCompletion(context.Background(), "gemini-test", conversation, tools)
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	if request.URL.Path != "/models/gemini-test:generateContent" || request.Header.Get("x-goog-api-key") != "gm-key" {
+		t.Errorf("Unexpected request %s %v", request.URL.Path, request.Header)
+	}
+
+	if got := jsonOf((*body)["systemInstruction"]); got != `{"parts":[{"text":"You are a travel assistant."},{"text":"Use metric units."}]}` {
+		t.Errorf("Unexpected system instruction: %s", got)
+	}
+	// Function responses are named after the call they answer
+	want := `[{"parts":[{"text":"Weather in Paris and Rome?"}],"role":"user"},` +
+		`{"parts":[{"text":"Let me check."},{"functionCall":{"args":{"city":"Paris"},"name":"get_weather"}},{"functionCall":{"args":{"city":"Rome"},"name":"get_weather"}}],"role":"model"},` +
+		`{"parts":[{"functionResponse":{"name":"get_weather","response":{"content":"18°C"}}},{"functionResponse":{"name":"get_weather","response":{"content":"24°C"}}},` +
+		`{"inlineData":{"data":"iVBORw0KGgo=","mimeType":"image/png"}},{"text":"And this place?"}],"role":"user"}]`
+	if got := jsonOf((*body)["contents"]); got != want {
+		t.Errorf("Unexpected contents:\n got %s\nwant %s", got, want)
+	}
+	// Schemas lose the keywords Gemini rejects (not properties named like them); tools without
+	// parameters are declared without any
+	want = `[{"functionDeclarations":[{"description":"Current weather","name":"get_weather","parameters":{"properties":{"city":{"type":"string"},"examples":{"type":"string"}},"type":"object"}},{"description":"Current time","name":"get_time"}]}]`
+	if got := jsonOf((*body)["tools"]); got != want {
+		t.Errorf("Unexpected tools:\n got %s\nwant %s", got, want)
+	}
+	if got := jsonOf((*body)["generationConfig"]); got != `{"maxOutputTokens":512}` {
+		t.Errorf("Unexpected generation config: %s", got)
+	}
+
+	if resp.Content != "Paris is cooler." || resp.Model != "gemini-test-001" || !resp.Truncated {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "get_time" || resp.ToolCalls[0].Arguments != `{"zone":"CET"}` || !strings.HasPrefix(resp.ToolCalls[0].ID, "call_") {
+		t.Errorf("Expected a function call with a made-up ID, got %+v", resp.ToolCalls)
+	}
+	usage := ToOpenAIResponse(resp).Usage
+	if usage.PromptTokens != 120 || usage.CompletionTokens != 20 || usage.TotalTokens != 140 || usage.PromptTokensDetails.CachedTokens != 64 {
+		t.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	blocked, _, _ := serve(t, http.StatusOK, `{"promptFeedback":{"blockReason":"SAFETY"}}`)
+	provider = NewGeminiProvider(ProviderConfig{BaseURL: blocked.URL})
+	if _, err := provider.ChatCompletion(context.Background(), "gemini-test", conversation, nil); err == nil || !strings.Contains(err.Error(), "prompt blocked: SAFETY") {
+		t.Errorf("Expected the blocked prompt to fail, got %v", err)
+	}
+}
+
+func TestOpenAIProvider(t *testing.T) {
+	server, request, body := serve(t, http.StatusOK, `{"model":"gpt-test","choices":[{"index":0,"finish_reason":"stop",
+		"message":{"role":"assistant","content":"Sunny."}}],"usage":{"prompt_tokens":30,"completion_tokens":2,"total_tokens":32}}`)
+	provider, err := NewProvider("", ProviderConfig{APIKey: "sk-oa", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	resp, err := provider.ChatCompletion(context.Background(), "gpt-test", conversation, tools)
+	if err != nil {
+		t.Fatalf("ChatCompletion failed: %v", err)
+	}
+	if request.URL.Path != "/chat/completions" || request.Header.Get("Authorization") != "Bearer sk-oa" {
+		t.Errorf("Unexpected request %s %v", request.URL.Path, request.Header)
+	}
+	messages := (*body)["messages"].([]any)
+	if len(messages) != len(conversation) {
+		t.Fatalf("Expected every message to be sent, got %s", jsonOf(messages))
+	}
+	if got := jsonOf(messages[3].(map[string]any)["tool_calls"]); !strings.Contains(got, `"id":"call_2"`) {
+		t.Errorf("Expected the tool calls, got %s", got)
+	}
+	if got := jsonOf(messages[6].(map[string]any)["content"]); got != `[{"text":"And this place?","type":"text"},{"image_url":{"url":"data:image/png;base64,iVBORw0KGgo="},"type":"image_url"}]` {
+		t.Errorf("Expected the image as a content part, got %s", got)
+	}
+	if resp.Content != "Sunny." || resp.Usage.TotalTokens != 32 {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+
+	if _, err := NewProvider("cohere", ProviderConfig{}); err == nil {
+		t.Error("Expected an unknown provider to fail")
+	}
+}
@@ -0,0 +1,181 @@
+package llminterface
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultAnthropicBaseURL is the Anthropic API used when ProviderConfig.BaseURL is not set
+	DefaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+	// anthropicVersion is the API version sent with every request
+	anthropicVersion = "2023-06-01"
+)
+
+// AnthropicProvider is a Provider calling the Anthropic Messages API. System messages become the
+// system prompt, tool calls tool_use blocks and tool results tool_result blocks of a user turn.
+type AnthropicProvider struct {
+	config ProviderConfig
+}
+
+// NewAnthropicProvider returns a Provider for the Anthropic Messages API
+func NewAnthropicProvider(config ProviderConfig) *AnthropicProvider {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultAnthropicBaseURL
+	}
+	if config.MaxTokens <= 0 {
+		config.MaxTokens = DefaultMaxTokens
+	}
+	return &AnthropicProvider{config: config}
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"` // "user" or "assistant"
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type string `json:"type"` // "text", "image", "tool_use" or "tool_result"
+	Text string `json:"text,omitempty"`
+
+	Source *anthropicImageSource `json:"source,omitempty"`
+
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"` // "base64" or "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicResponse struct {
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+}
+
+// ChatCompletion implements the Provider interface.
+func (p *AnthropicProvider) ChatCompletion(ctx context.Context, model string, messages []Message, tools []Tool) (*Response, error) {
+	request := anthropicRequest{Model: model, MaxTokens: p.config.MaxTokens}
+	var system []string
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			system = append(system, m.Content)
+		case "assistant":
+			var blocks []anthropicBlock
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Name, Input: toolArguments(tc.Arguments)})
+			}
+			request.Messages = appendAnthropicMessage(request.Messages, "assistant", blocks)
+		case "tool":
+			request.Messages = appendAnthropicMessage(request.Messages, "user",
+				[]anthropicBlock{{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}})
+		default:
+			var blocks []anthropicBlock
+			for _, image := range m.Images {
+				source := &anthropicImageSource{Type: "url", URL: image}
+				if mediaType, data, ok := parseDataURL(image); ok {
+					source = &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+				}
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: source})
+			}
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			request.Messages = appendAnthropicMessage(request.Messages, "user", blocks)
+		}
+	}
+	request.System = strings.Join(system, "\n\n")
+	for _, t := range tools {
+		request.Tools = append(request.Tools, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: toolSchema(t.Parameters)})
+	}
+
+	var resp anthropicResponse
+	headers := map[string]string{"x-api-key": p.config.APIKey, "anthropic-version": anthropicVersion}
+	if err := postJSON(ctx, p.config.HTTPClient, p.config.BaseURL+"/messages", headers, request, &resp, anthropicError); err != nil {
+		return nil, fmt.Errorf("anthropic: %w", err)
+	}
+
+	r := &Response{Model: resp.Model, Truncated: resp.StopReason == "max_tokens"}
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			r.Content += block.Text
+		case "tool_use":
+			arguments := string(block.Input)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			r.ToolCalls = append(r.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: arguments})
+		}
+	}
+	// input_tokens only counts the prompt tokens after the last cache breakpoint
+	r.Usage = Usage{
+		PromptTokens:     resp.Usage.InputTokens + resp.Usage.CacheCreationInputTokens + resp.Usage.CacheReadInputTokens,
+		CompletionTokens: resp.Usage.OutputTokens,
+		CachedTokens:     resp.Usage.CacheReadInputTokens,
+	}
+	r.Usage.TotalTokens = r.Usage.PromptTokens + r.Usage.CompletionTokens
+	return r, nil
+}
+
+// appendAnthropicMessage adds blocks as a turn of role, merged into the last turn when it has the
+// same role: the API wants user and assistant turns to alternate, and all results of one
+// assistant turn's tool calls in the next user turn
+func appendAnthropicMessage(messages []anthropicMessage, role string, blocks []anthropicBlock) []anthropicMessage {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, anthropicMessage{Role: role, Content: blocks})
+}
+
+// anthropicError returns the message of an Anthropic error response
+func anthropicError(body []byte) string {
+	var resp struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) != nil || resp.Error.Message == "" {
+		return ""
+	}
+	return resp.Error.Type + ": " + resp.Error.Message
+}
@@ -20,6 +20,20 @@ func FromOpenAIMessages(msgs []openai.ChatCompletionMessage) []Message {
 			Content:    m.Content,
 			ToolCallID: m.ToolCallID,
 		}
+		// Multi-part (vision) messages: text parts become Content, image parts become Images
+		for _, part := range m.MultiContent {
+			switch part.Type {
+			case openai.ChatMessagePartTypeText:
+				if msg.Content != "" {
+					msg.Content += "\n"
+				}
+				msg.Content += part.Text
+			case openai.ChatMessagePartTypeImageURL:
+				if part.ImageURL != nil {
+					msg.Images = append(msg.Images, part.ImageURL.URL)
+				}
+			}
+		}
 		for _, tc := range m.ToolCalls {
 			msg.ToolCalls = append(msg.ToolCalls, ToolCall{
 				ID:        tc.ID,
@@ -61,6 +75,9 @@ func ToOpenAIResponse(r *Response) openai.ChatCompletionResponse {
 	}
 
 	finishReason := openai.FinishReasonStop
+	if r.Truncated {
+		finishReason = openai.FinishReasonLength
+	}
 
 	for _, tc := range r.ToolCalls {
 		msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
@@ -74,6 +91,15 @@ func ToOpenAIResponse(r *Response) openai.ChatCompletionResponse {
 		finishReason = openai.FinishReasonToolCalls
 	}
 
+	usage := openai.Usage{
+		PromptTokens:     r.Usage.PromptTokens,
+		CompletionTokens: r.Usage.CompletionTokens,
+		TotalTokens:      r.Usage.TotalTokens,
+	}
+	if r.Usage.CachedTokens > 0 {
+		usage.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: r.Usage.CachedTokens}
+	}
+
 	return openai.ChatCompletionResponse{
 		Model: r.Model,
 		Choices: []openai.ChatCompletionChoice{
@@ -83,12 +109,84 @@ func ToOpenAIResponse(r *Response) openai.ChatCompletionResponse {
 				FinishReason: finishReason,
 			},
 		},
-		Usage: openai.Usage{
-			PromptTokens:     r.Usage.PromptTokens,
-			CompletionTokens: r.Usage.CompletionTokens,
-			TotalTokens:      r.Usage.TotalTokens,
+		Usage: usage,
+	}
+}
+
+// ToOpenAIMessages converts provider-agnostic Messages to OpenAI ChatCompletionMessages
+// (used by the OpenAI-compatible Provider). Images become image parts of a multi-part message.
+func ToOpenAIMessages(msgs []Message) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, 0, len(msgs))
+	for _, m := range msgs {
+		msg := openai.ChatCompletionMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			ToolCallID: m.ToolCallID,
+		}
+		if len(m.Images) > 0 {
+			msg.Content = ""
+			if m.Content != "" {
+				msg.MultiContent = append(msg.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: m.Content})
+			}
+			for _, image := range m.Images {
+				msg.MultiContent = append(msg.MultiContent, openai.ChatMessagePart{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: image},
+				})
+			}
+		}
+		for _, tc := range m.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, openai.ToolCall{
+				ID:       tc.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: tc.Name, Arguments: tc.Arguments},
+			})
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// ToOpenAITools converts provider-agnostic Tools to OpenAI Tool definitions.
+func ToOpenAITools(tools []Tool) []openai.Tool {
+	out := make([]openai.Tool, 0, len(tools))
+	for _, t := range tools {
+		out = append(out, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+	return out
+}
+
+// FromOpenAIResponse converts the first choice of an OpenAI ChatCompletionResponse to a
+// provider-agnostic Response.
+func FromOpenAIResponse(resp openai.ChatCompletionResponse) *Response {
+	r := &Response{
+		Model: resp.Model,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
 		},
 	}
+	if resp.Usage.PromptTokensDetails != nil {
+		r.Usage.CachedTokens = resp.Usage.PromptTokensDetails.CachedTokens
+	}
+	if len(resp.Choices) == 0 {
+		return r
+	}
+	choice := resp.Choices[0]
+	r.Content = choice.Message.Content
+	r.Truncated = choice.FinishReason == openai.FinishReasonLength
+	for _, tc := range choice.Message.ToolCalls {
+		r.ToolCalls = append(r.ToolCalls, ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+	}
+	return r
 }
 
 // ---------------------------------------------------------------------------
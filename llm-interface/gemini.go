@@ -0,0 +1,277 @@
+package llminterface
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultGeminiBaseURL is the Gemini API used when ProviderConfig.BaseURL is not set
+const DefaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// GeminiProvider is a Provider calling the Google Gemini generateContent API. System messages
+// become the system instruction, tool calls functionCall parts and tool results functionResponse
+// parts. Gemini may not give its function calls IDs, so the adapter makes them up.
+type GeminiProvider struct {
+	config ProviderConfig
+}
+
+// NewGeminiProvider returns a Provider for the Gemini API
+func NewGeminiProvider(config ProviderConfig) *GeminiProvider {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultGeminiBaseURL
+	}
+	return &GeminiProvider{config: config}
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent        `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent       `json:"contents"`
+	Tools             []geminiTool          `json:"tools,omitempty"`
+	GenerationConfig  *geminiGenerationConf `json:"generationConfig,omitempty"`
+}
+
+type geminiGenerationConf struct {
+	MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"` // "user" or "model"
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"` // a thought summary, not part of the answer
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFile             `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFile struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+}
+
+// ChatCompletion implements the Provider interface.
+func (p *GeminiProvider) ChatCompletion(ctx context.Context, model string, messages []Message, tools []Tool) (*Response, error) {
+	request := geminiRequest{}
+	if p.config.MaxTokens > 0 {
+		request.GenerationConfig = &geminiGenerationConf{MaxOutputTokens: p.config.MaxTokens}
+	}
+	// Function responses name their function, tool results only have the call's ID
+	callNames := map[string]string{}
+	var system []geminiPart
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			system = append(system, geminiPart{Text: m.Content})
+		case "assistant":
+			var parts []geminiPart
+			if m.Content != "" {
+				parts = append(parts, geminiPart{Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				callNames[tc.ID] = tc.Name
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: tc.Name, Args: toolArguments(tc.Arguments)}})
+			}
+			request.Contents = appendGeminiContent(request.Contents, "model", parts)
+		case "tool":
+			name := callNames[m.ToolCallID]
+			if name == "" {
+				name = "tool"
+			}
+			request.Contents = appendGeminiContent(request.Contents, "user", []geminiPart{{FunctionResponse: &geminiFunctionResponse{
+				Name: name, Response: map[string]any{"content": m.Content},
+			}}})
+		default:
+			var parts []geminiPart
+			for _, image := range m.Images {
+				if mediaType, data, ok := parseDataURL(image); ok {
+					parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: mediaType, Data: data}})
+				} else {
+					parts = append(parts, geminiPart{FileData: &geminiFile{FileURI: image}})
+				}
+			}
+			if m.Content != "" {
+				parts = append(parts, geminiPart{Text: m.Content})
+			}
+			request.Contents = appendGeminiContent(request.Contents, "user", parts)
+		}
+	}
+	if len(system) > 0 {
+		request.SystemInstruction = &geminiContent{Parts: system}
+	}
+	if len(tools) > 0 {
+		declarations := make([]geminiFunctionDeclaration, 0, len(tools))
+		for _, t := range tools {
+			declarations = append(declarations, geminiFunctionDeclaration{Name: t.Name, Description: t.Description, Parameters: geminiSchema(t.Parameters)})
+		}
+		request.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+	}
+
+	var resp geminiResponse
+	endpoint := p.config.BaseURL + "/models/" + url.PathEscape(model) + ":generateContent"
+	if err := postJSON(ctx, p.config.HTTPClient, endpoint, map[string]string{"x-goog-api-key": p.config.APIKey}, request, &resp, geminiError); err != nil {
+		return nil, fmt.Errorf("gemini: %w", err)
+	}
+	if resp.PromptFeedback.BlockReason != "" {
+		return nil, fmt.Errorf("gemini: prompt blocked: %s", resp.PromptFeedback.BlockReason)
+	}
+
+	r := &Response{Model: resp.ModelVersion}
+	if r.Model == "" {
+		r.Model = model
+	}
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		r.Truncated = candidate.FinishReason == "MAX_TOKENS"
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				id := part.FunctionCall.ID
+				if id == "" {
+					id = newGeminiCallID()
+				}
+				arguments := string(part.FunctionCall.Args)
+				if arguments == "" || arguments == "null" {
+					arguments = "{}"
+				}
+				r.ToolCalls = append(r.ToolCalls, ToolCall{ID: id, Name: part.FunctionCall.Name, Arguments: arguments})
+			case part.Text != "" && !part.Thought:
+				r.Content += part.Text
+			}
+		}
+	}
+	r.Usage = Usage{
+		PromptTokens:     resp.UsageMetadata.PromptTokenCount,
+		CompletionTokens: resp.UsageMetadata.CandidatesTokenCount + resp.UsageMetadata.ThoughtsTokenCount,
+		TotalTokens:      resp.UsageMetadata.TotalTokenCount,
+		CachedTokens:     resp.UsageMetadata.CachedContentTokenCount,
+	}
+	if r.Usage.TotalTokens == 0 {
+		r.Usage.TotalTokens = r.Usage.PromptTokens + r.Usage.CompletionTokens
+	}
+	return r, nil
+}
+
+// appendGeminiContent adds parts as a turn of role, merged into the last turn when it has the
+// same role (all responses to one turn's function calls go in one turn)
+func appendGeminiContent(contents []geminiContent, role string, parts []geminiPart) []geminiContent {
+	if len(parts) == 0 {
+		return contents
+	}
+	if n := len(contents); n > 0 && contents[n-1].Role == role {
+		contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+		return contents
+	}
+	return append(contents, geminiContent{Role: role, Parts: parts})
+}
+
+// geminiUnsupportedSchemaKeys are JSON Schema keywords Gemini's OpenAPI-style schemas reject
+var geminiUnsupportedSchemaKeys = []string{"$schema", "$id", "$defs", "definitions", "additionalProperties", "examples"}
+
+// geminiSchema returns the parameters of a tool without the keywords Gemini rejects, or nil
+// for a tool without parameters (Gemini rejects objects without properties)
+func geminiSchema(parameters any) map[string]any {
+	schema := toolSchema(parameters)
+	if properties, _ := schema["properties"].(map[string]any); len(properties) == 0 {
+		return nil
+	}
+	cleanGeminiSchema(schema)
+	return schema
+}
+
+// cleanGeminiSchema removes geminiUnsupportedSchemaKeys from schema and its subschemas (the
+// names of properties are left alone)
+func cleanGeminiSchema(value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range geminiUnsupportedSchemaKeys {
+			delete(v, key)
+		}
+		for key, child := range v {
+			if properties, ok := child.(map[string]any); ok && key == "properties" {
+				for _, property := range properties {
+					cleanGeminiSchema(property)
+				}
+				continue
+			}
+			cleanGeminiSchema(child)
+		}
+	case []any:
+		for _, child := range v {
+			cleanGeminiSchema(child)
+		}
+	}
+}
+
+// newGeminiCallID returns an ID for a function call Gemini gave none
+func newGeminiCallID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "call_" + hex.EncodeToString(b)
+}
+
+// geminiError returns the message of a Gemini error response
+func geminiError(body []byte) string {
+	var resp struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) != nil || resp.Error.Message == "" {
+		return ""
+	}
+	return strings.TrimSpace(resp.Error.Status + ": " + resp.Error.Message)
+}
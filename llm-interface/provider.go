@@ -8,6 +8,7 @@ type Message struct {
 	Content    string     // text content
 	ToolCallID string     // for tool result messages
 	ToolCalls  []ToolCall // for assistant messages requesting tool calls
+	Images     []string   // image URLs (or data: URLs) attached to a user message; only sent to vision-capable providers
 }
 
 // ToolCall represents a tool invocation requested by the model.
@@ -30,6 +31,7 @@ type Response struct {
 	ToolCalls []ToolCall // tool calls requested by the model
 	Usage     Usage      // token usage statistics
 	Model     string     // the model that was actually used
+	Truncated bool       // the answer stopped at the token limit
 }
 
 // Usage holds token usage statistics.
@@ -37,6 +39,7 @@ type Usage struct {
 	PromptTokens     int
 	CompletionTokens int
 	TotalTokens      int
+	CachedTokens     int // prompt tokens read from the provider's prompt cache
 }
 
 // Provider is the generic LLM provider interface.
@@ -1,41 +1,268 @@
 package log
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
 )
 
+// Format selects how the global logger writes records
+type Format string
+
+const (
+	// FormatText writes human-readable lines (default)
+	FormatText Format = "text"
+	// FormatJSON writes one JSON object per record with time, level, msg and the key/value fields,
+	// for log aggregators such as ELK or Loki
+	FormatJSON Format = "json"
+)
+
+// FieldLogger is a leveled logger taking key/value fields. *slog.Logger and *Logger implement
+// it, so an application can inject its own logger into engines, the CoreHandler, the session
+// scheduler and the stores.
+type FieldLogger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// Or returns l, or the global logger when l is nil
+func Or(l FieldLogger) FieldLogger {
+	if l == nil {
+		return Log
+	}
+	return l
+}
+
 // Logger provides a simple logging interface with formatted output methods
 type Logger struct {
-	logger *slog.Logger
+	logger     atomic.Pointer[slog.Logger]
+	structured atomic.Bool // fields are passed to the handler instead of rendered into the message
+	redact     atomic.Bool // see SetRedaction
+}
+
+// New creates a Logger writing key/value records to handler, e.g. one of the application's
+// slog handlers, so it can be redacted (see Logger.SetRedaction) and injected as a FieldLogger
+func New(handler slog.Handler) *Logger {
+	l := &Logger{}
+	l.logger.Store(slog.New(handler))
+	l.structured.Store(true)
+	return l
 }
 
+// level controls the minimum level of the global logger
+var level = new(slog.LevelVar)
+
 // Log is the global logger instance
-var Log = &Logger{
-	logger: slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	})),
+var Log = newLogger(FormatText)
+
+func newLogger(format Format) *Logger {
+	l := &Logger{}
+	l.setFormat(format)
+	return l
+}
+
+// SetLevel sets the minimum level emitted by the global logger (default: info)
+func SetLevel(l slog.Level) {
+	level.Set(l)
 }
 
-// Infof logs an info level message with formatting
+// SetFormat sets the output format of the global logger (default: FormatText).
+// Unknown formats fall back to FormatText.
+func SetFormat(format Format) {
+	Log.setFormat(format)
+}
+
+// SetRedaction turns redaction of the global logger on or off (see Logger.SetRedaction)
+func SetRedaction(on bool) {
+	Log.SetRedaction(on)
+}
+
+// SetRedaction turns redaction on or off. When on, ID fields (user_id, session_id, message_id)
+// are replaced by a short stable hash, so records of one user still correlate, and content
+// fields (content, message, query, summary, ...) are only logged at debug level. It applies to
+// the key/value methods; the printf-style ones are logged as is.
+func (l *Logger) SetRedaction(on bool) {
+	l.redact.Store(on)
+}
+
+func (l *Logger) setFormat(format Format) {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == FormatJSON {
+		l.logger.Store(slog.New(slog.NewJSONHandler(os.Stdout, opts)))
+		l.structured.Store(true)
+		return
+	}
+	l.logger.Store(slog.New(slog.NewTextHandler(os.Stdout, opts)))
+	l.structured.Store(false)
+}
+
+// Infof logs an info level message with formatting. Prefer Info with key/value fields,
+// which can be queried and redacted.
 func (l *Logger) Infof(format string, args ...any) {
-	l.logger.Info(sprintf(format, args...))
+	l.logger.Load().Info(sprintf(format, args...))
 }
 
 // Warnf logs a warning level message with formatting
 func (l *Logger) Warnf(format string, args ...any) {
-	l.logger.Warn(sprintf(format, args...))
+	l.logger.Load().Warn(sprintf(format, args...))
 }
 
 // Errorf logs an error level message with formatting
 func (l *Logger) Errorf(format string, args ...any) {
-	l.logger.Error(sprintf(format, args...))
+	l.logger.Load().Error(sprintf(format, args...))
 }
 
 // Debugf logs a debug level message with formatting
 func (l *Logger) Debugf(format string, args ...any) {
-	l.logger.Debug(sprintf(format, args...))
+	l.logger.Load().Debug(sprintf(format, args...))
+}
+
+// Info logs an info level message with key/value fields, e.g.
+//
+//	log.Log.Info("[CoreHandler] ✅ Done", "user_id", userID, "tokens", tokens)
+//
+// With FormatJSON the fields are separate JSON keys; with FormatText they are appended
+// to the message as "| UserID: ... | Tokens: ...".
+func (l *Logger) Info(msg string, fields ...any) {
+	l.log(slog.LevelInfo, msg, fields)
+}
+
+// Warn logs a warning level message with key/value fields (see Info)
+func (l *Logger) Warn(msg string, fields ...any) {
+	l.log(slog.LevelWarn, msg, fields)
+}
+
+// Error logs an error level message with key/value fields (see Info)
+func (l *Logger) Error(msg string, fields ...any) {
+	l.log(slog.LevelError, msg, fields)
+}
+
+// Debug logs a debug level message with key/value fields (see Info)
+func (l *Logger) Debug(msg string, fields ...any) {
+	l.log(slog.LevelDebug, msg, fields)
+}
+
+func (l *Logger) log(lvl slog.Level, msg string, fields []any) {
+	logger := l.logger.Load()
+	if !logger.Enabled(context.Background(), lvl) {
+		return
+	}
+	if l.redact.Load() {
+		fields = redactFields(lvl, fields)
+	}
+	if l.structured.Load() {
+		for i := 1; i < len(fields); i += 2 {
+			if err, ok := fields[i].(error); ok {
+				fields[i] = err.Error()
+			}
+		}
+		logger.Log(context.Background(), lvl, msg, fields...)
+		return
+	}
+	logger.Log(context.Background(), lvl, renderFields(msg, fields))
+}
+
+// renderFields appends key/value fields to msg in the text format: "msg | Key: value"
+func renderFields(msg string, fields []any) string {
+	if len(fields) == 0 {
+		return msg
+	}
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		if i+1 >= len(fields) {
+			fmt.Fprintf(&sb, " | %s", key)
+			break
+		}
+		fmt.Fprintf(&sb, " | %s: %v", displayKey(key), fields[i+1])
+	}
+	return sb.String()
+}
+
+// displayKey turns a snake_case field key into the text format's label ("user_id" -> "UserID")
+func displayKey(key string) string {
+	parts := strings.Split(key, "_")
+	for i, part := range parts {
+		if part == "id" {
+			parts[i] = "ID"
+			continue
+		}
+		parts[i] = capitalize(part)
+	}
+	return strings.Join(parts, "")
+}
+
+// redactedIDKeys are the fields holding IDs that identify a user; they are hashed when redacting
+var redactedIDKeys = map[string]bool{
+	"user_id":        true,
+	"session_id":     true,
+	"old_session_id": true,
+	"message_id":     true,
+}
+
+// redactedContentKeys are the fields holding message or model content; when redacting they are
+// only logged at debug level
+var redactedContentKeys = map[string]bool{
+	"content":          true,
+	"message":          true,
+	"text":             true,
+	"query":            true,
+	"prompt":           true,
+	"response":         true,
+	"arguments":        true,
+	"result":           true,
+	"summary":          true,
+	"previous_summary": true,
+	"title":            true,
+	"tags":             true,
+	"existing_tags":    true,
+}
+
+// redactedValue replaces a content field above debug level
+const redactedValue = "[redacted]"
+
+// redactFields returns a copy of fields with ID fields hashed and, above debug level,
+// content fields replaced
+func redactFields(lvl slog.Level, fields []any) []any {
+	redacted := make([]any, len(fields))
+	copy(redacted, fields)
+	for i := 0; i+1 < len(redacted); i += 2 {
+		key, _ := redacted[i].(string)
+		switch {
+		case redactedIDKeys[key]:
+			if id := fmt.Sprint(redacted[i+1]); id != "" {
+				redacted[i+1] = HashID(id)
+			}
+		case redactedContentKeys[key] && lvl > slog.LevelDebug:
+			redacted[i+1] = redactedValue
+		}
+	}
+	return redacted
+}
+
+// HashID returns the short stable hash a redacting logger logs in place of id
+func HashID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:6])
+}
+
+// capitalize upper-cases the first letter of a field key ("userID" -> "UserID")
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
 }
 
 // sprintf is a helper function to format strings
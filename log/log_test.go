@@ -0,0 +1,89 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestRenderFields(t *testing.T) {
+	got := renderFields("[CoreHandler] ✅ Done", []any{"userID", "u1", "tokens", 42})
+	want := "[CoreHandler] ✅ Done | UserID: u1 | Tokens: 42"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := renderFields("msg", nil); got != "msg" {
+		t.Errorf("Expected message unchanged without fields, got %q", got)
+	}
+}
+
+func TestJSONFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := &Logger{}
+	l.logger.Store(slog.New(slog.NewJSONHandler(&buf, nil)))
+	l.structured.Store(true)
+
+	l.Error("[CoreHandler] ❌ Failed", "userID", "u1", "tokens", 42, "error", errors.New("boom"))
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "[CoreHandler] ❌ Failed" || record["level"] != "ERROR" {
+		t.Errorf("Unexpected msg/level: %v", record)
+	}
+	if record["userID"] != "u1" || record["tokens"] != float64(42) || record["error"] != "boom" {
+		t.Errorf("Expected fields as separate keys, got %v", record)
+	}
+}
+
+func TestRenderSnakeCaseFields(t *testing.T) {
+	got := renderFields("[Engine] ✅ Done", []any{"user_id", "u1", "duration_ms", 12})
+	want := "[Engine] ✅ Done | UserID: u1 | DurationMs: 12"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	l.SetRedaction(true)
+	decode := func() map[string]any {
+		t.Helper()
+		var record map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("Expected a JSON record, got %q: %v", buf.String(), err)
+		}
+		buf.Reset()
+		return record
+	}
+
+	fields := []any{"user_id", "alice", "session_id", "alice-high-s0001", "content", "my card number is 1234", "model", "gpt-4o"}
+	l.Info("[Engine] ✅ Message saved", fields...)
+	record := decode()
+	if record["user_id"] != HashID("alice") || record["session_id"] != HashID("alice-high-s0001") {
+		t.Errorf("Expected hashed IDs, got %v", record)
+	}
+	if record["content"] != redactedValue || record["model"] != "gpt-4o" {
+		t.Errorf("Expected content redacted and other fields kept, got %v", record)
+	}
+	if fields[1] != "alice" {
+		t.Errorf("Redaction changed the caller's fields: %v", fields)
+	}
+
+	// Content is still available at debug level, with the IDs hashed
+	l.Debug("[Engine] 📄 Full content", "user_id", "alice", "content", "my card number is 1234")
+	record = decode()
+	if record["content"] != "my card number is 1234" || record["user_id"] != HashID("alice") {
+		t.Errorf("Expected content kept at debug level, got %v", record)
+	}
+
+	l.SetRedaction(false)
+	l.Info("[Engine] ✅ Message saved", "user_id", "alice", "content", "hello")
+	if record = decode(); record["user_id"] != "alice" || record["content"] != "hello" {
+		t.Errorf("Expected fields unchanged without redaction, got %v", record)
+	}
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Feedback ratings: a thumbs up or a thumbs down
+const (
+	FeedbackUp   = 1
+	FeedbackDown = -1
+)
+
+// ErrInvalidFeedback is returned by Feedback.Validate
+var ErrInvalidFeedback = errors.New("invalid feedback")
+
+// Feedback is a user's rating of an answer. A user has at most one rating per message: rating
+// it again replaces the previous one (see NewFeedback).
+type Feedback struct {
+	FeedbackID string    `json:"feedback_id"`
+	MessageID  string    `json:"message_id"`
+	SessionID  string    `json:"session_id"`
+	UserID     string    `json:"user_id"`
+	Rating     int       `json:"rating"` // FeedbackUp or FeedbackDown
+	Comment    string    `json:"comment,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NewFeedback creates the feedback of userID on messageID; the session is the one the message
+// ID was generated in (see MessageSessionID)
+func NewFeedback(userID, messageID string, rating int, comment string) *Feedback {
+	return &Feedback{
+		FeedbackID: fmt.Sprintf("%s-fb-%s", messageID, userID),
+		MessageID:  messageID,
+		SessionID:  MessageSessionID(messageID),
+		UserID:     userID,
+		Rating:     rating,
+		Comment:    comment,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// Validate reports whether the feedback names a message and a user and has a valid rating
+func (f *Feedback) Validate() error {
+	if f.MessageID == "" || f.UserID == "" {
+		return fmt.Errorf("%w: a message ID and a user ID are required", ErrInvalidFeedback)
+	}
+	if f.Rating != FeedbackUp && f.Rating != FeedbackDown {
+		return fmt.Errorf("%w: rating %d must be %d or %d", ErrInvalidFeedback, f.Rating, FeedbackUp, FeedbackDown)
+	}
+	return nil
+}
+
+// messageIDSuffix is the sequence part of IDs made by Session.GenerateMessageID
+var messageIDSuffix = regexp.MustCompile(`-m\d+$`)
+
+// MessageSessionID returns the session ID of a message ID made by Session.GenerateMessageID,
+// or "" if messageID has another format
+func MessageSessionID(messageID string) string {
+	loc := messageIDSuffix.FindStringIndex(messageID)
+	if loc == nil {
+		return ""
+	}
+	return messageID[:loc[0]]
+}
+
+// FeedbackFilter selects the feedback GetFeedbackStats aggregates; empty fields match everything
+// and zero times are open ends
+type FeedbackFilter struct {
+	UserID    string
+	SessionID string
+	MessageID string
+	From      time.Time
+	To        time.Time
+}
+
+// FeedbackStats aggregates feedback ratings
+type FeedbackStats struct {
+	Total    int `json:"total"`
+	Up       int `json:"up"`
+	Down     int `json:"down"`
+	Comments int `json:"comments"` // ratings with a comment
+}
+
+// UpRatio returns the share of thumbs up among the ratings (0 when there are none)
+func (s *FeedbackStats) UpRatio() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Up) / float64(s.Total)
+}
+
+// FeedbackStore is implemented by stores that keep the users' ratings of answers
+type FeedbackStore interface {
+	// PutFeedback stores feedback, replacing the user's previous rating of the message
+	PutFeedback(feedback *Feedback) error
+	// GetFeedbackByMessage returns the feedback on a message, newest first
+	GetFeedbackByMessage(messageID string) ([]*Feedback, error)
+	// GetFeedbackStats aggregates the feedback matching filter
+	GetFeedbackStats(filter FeedbackFilter) (*FeedbackStats, error)
+	// GetFeedbackStatsByMessages aggregates the feedback on each of messageIDs in one query,
+	// keyed by message ID; messages without feedback are left out
+	GetFeedbackStatsByMessages(messageIDs []string) (map[string]*FeedbackStats, error)
+}
@@ -1,25 +1,41 @@
 package model
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
 )
 
 // ToolFunction is the signature for tool execution functions
 // It receives a map of arguments and returns a result string and error
 type ToolFunction func(args map[string]interface{}) (string, error)
 
+// ContextToolFunction is a tool function that also receives the context of the message being processed
+type ContextToolFunction func(ctx context.Context, args map[string]interface{}) (string, error)
+
 // registeredEntry holds a tool function and its optional display name for UI/status
 type registeredEntry struct {
 	Fn          ToolFunction
+	CtxFn       ContextToolFunction // set for tools registered with RegisterContext
 	DisplayName string
+	Definition  *openai.FunctionDefinition // description and input schema (optional, see SetDefinition)
+	Timeout     time.Duration              // execution timeout override (optional, see SetTimeout)
+	Sequential  bool                       // never run concurrently with other tool calls (see SetSequential)
+	CacheTTL    time.Duration              // how long results are reused (optional, see SetCacheTTL)
+	MCPServer   string                     // MCP server the tool is proxied to (optional, see SetMCPServer)
 }
 
 // FunctionRegistry manages the mapping between tool names and their Go functions
 // This registry must be populated at application startup with all available functions
 type FunctionRegistry struct {
-	mu        sync.RWMutex
-	functions map[string]registeredEntry // tool name -> function + display name
+	mu          sync.RWMutex
+	functions   map[string]registeredEntry // tool name -> function + display name
+	middlewares []ToolMiddleware           // applied to every tool (see Use)
 }
 
 // NewFunctionRegistry creates a new function registry
@@ -53,6 +69,38 @@ func (fr *FunctionRegistry) Register(toolName string, displayName string, fn Too
 	return nil
 }
 
+// RegisterContext registers a context-aware function for a tool name (see ExecuteContext).
+// Like Register, it fails if the tool is already registered.
+func (fr *FunctionRegistry) RegisterContext(toolName string, displayName string, fn ContextToolFunction) error {
+	if fn == nil {
+		return fmt.Errorf("function cannot be nil for tool: %s", toolName)
+	}
+	if err := fr.Register(toolName, displayName, func(args map[string]interface{}) (string, error) {
+		return fn(context.Background(), args)
+	}); err != nil {
+		return err
+	}
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	entry := fr.functions[toolName]
+	entry.CtxFn = fn
+	fr.functions[toolName] = entry
+	return nil
+}
+
+// Unregister removes a tool and its definition. Returns false if it was not registered.
+func (fr *FunctionRegistry) Unregister(toolName string) bool {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if _, ok := fr.functions[toolName]; !ok {
+		return false
+	}
+	delete(fr.functions, toolName)
+	return true
+}
+
 // RegisterBatch registers multiple functions at once (display name defaults to tool name)
 func (fr *FunctionRegistry) RegisterBatch(registrations map[string]ToolFunction) error {
 	for toolName, fn := range registrations {
@@ -84,8 +132,15 @@ func (fr *FunctionRegistry) RegisterOrReplace(toolName string, displayName strin
 	defer fr.mu.Unlock()
 
 	entry := registeredEntry{Fn: fn, DisplayName: displayName}
+	existing, exists := fr.functions[toolName]
+	if exists {
+		entry.Definition = existing.Definition
+		entry.Timeout = existing.Timeout
+		entry.Sequential = existing.Sequential
+		entry.CacheTTL = existing.CacheTTL
+	}
 	if displayName == "" {
-		if existing, ok := fr.functions[toolName]; ok {
+		if exists {
 			entry.DisplayName = existing.DisplayName
 		} else {
 			entry.DisplayName = toolName
@@ -124,6 +179,96 @@ func (fr *FunctionRegistry) DisableToolTemporarily(toolName string, reason Disab
 	return fr.RegisterOrReplace(toolName, "", disabledFn)
 }
 
+// SetTimeout overrides the execution timeout of a registered tool (0 restores the engine's default,
+// a negative value runs it without a timeout)
+func (fr *FunctionRegistry) SetTimeout(toolName string, timeout time.Duration) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	entry, ok := fr.functions[toolName]
+	if !ok {
+		return &FunctionNotFoundError{ToolName: toolName}
+	}
+	entry.Timeout = timeout
+	fr.functions[toolName] = entry
+	return nil
+}
+
+// GetTimeout returns the timeout override set with SetTimeout (0 if none or not registered)
+func (fr *FunctionRegistry) GetTimeout(toolName string) time.Duration {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+	return fr.functions[toolName].Timeout
+}
+
+// SetSequential marks a registered tool as sequential: when the model requests several tool calls
+// at once, it waits for the calls before it and the calls after it wait for it. Use it for tools
+// that mutate shared state, such as the user's active session.
+func (fr *FunctionRegistry) SetSequential(toolName string, sequential bool) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	entry, ok := fr.functions[toolName]
+	if !ok {
+		return &FunctionNotFoundError{ToolName: toolName}
+	}
+	entry.Sequential = sequential
+	fr.functions[toolName] = entry
+	return nil
+}
+
+// IsSequential reports whether a tool was marked with SetSequential (false if not registered)
+func (fr *FunctionRegistry) IsSequential(toolName string) bool {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+	return fr.functions[toolName].Sequential
+}
+
+// SetCacheTTL opts a registered tool into result caching: a call repeating the name and arguments
+// of an earlier successful call is answered with its result for ttl (0 turns caching off).
+// Only use it for idempotent tools, such as searches and lookups.
+func (fr *FunctionRegistry) SetCacheTTL(toolName string, ttl time.Duration) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	entry, ok := fr.functions[toolName]
+	if !ok {
+		return &FunctionNotFoundError{ToolName: toolName}
+	}
+	entry.CacheTTL = ttl
+	fr.functions[toolName] = entry
+	return nil
+}
+
+// GetCacheTTL returns the cache TTL set with SetCacheTTL (0 if the tool is not cached or not registered)
+func (fr *FunctionRegistry) GetCacheTTL(toolName string) time.Duration {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+	return fr.functions[toolName].CacheTTL
+}
+
+// SetMCPServer records that a registered tool is served by the named MCP server, so its tool
+// call records name the server
+func (fr *FunctionRegistry) SetMCPServer(toolName string, server string) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	entry, ok := fr.functions[toolName]
+	if !ok {
+		return &FunctionNotFoundError{ToolName: toolName}
+	}
+	entry.MCPServer = server
+	fr.functions[toolName] = entry
+	return nil
+}
+
+// GetMCPServer returns the MCP server set with SetMCPServer ("" if none or not registered)
+func (fr *FunctionRegistry) GetMCPServer(toolName string) string {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+	return fr.functions[toolName].MCPServer
+}
+
 // GetDisplayName returns the display name for a tool, or toolName if not set, or empty if not registered
 func (fr *FunctionRegistry) GetDisplayName(toolName string) string {
 	fr.mu.RLock()
@@ -147,14 +292,35 @@ func (fr *FunctionRegistry) Get(toolName string) (ToolFunction, bool) {
 	return entry.Fn, ok
 }
 
-// Execute executes a tool function by name
+// Execute executes a tool function by name (wrapped in the middlewares added with Use)
 func (fr *FunctionRegistry) Execute(toolName string, args map[string]interface{}) (string, error) {
-	fn, ok := fr.Get(toolName)
+	return fr.ExecuteContext(context.Background(), toolName, args)
+}
+
+// ExecuteContext executes a tool function by name, passing ctx to functions registered with
+// RegisterContext (other functions are called without it). The middlewares added with Use
+// run around the call.
+func (fr *FunctionRegistry) ExecuteContext(ctx context.Context, toolName string, args map[string]interface{}) (string, error) {
+	fr.mu.RLock()
+	entry, ok := fr.functions[toolName]
+	fr.mu.RUnlock()
 	if !ok {
 		return "", &FunctionNotFoundError{ToolName: toolName}
 	}
+	fn := entry.CtxFn
+	if fn == nil {
+		fn = func(_ context.Context, args map[string]interface{}) (string, error) { return entry.Fn(args) }
+	}
+	return fr.Wrap(toolName, fn)(ctx, args)
+}
 
-	return fn(args)
+// HasContext checks if the tool was registered with a context-aware function (see RegisterContext)
+func (fr *FunctionRegistry) HasContext(toolName string) bool {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+
+	entry, ok := fr.functions[toolName]
+	return ok && entry.CtxFn != nil
 }
 
 // Has checks if a function is registered for a tool name
@@ -178,6 +344,46 @@ func (fr *FunctionRegistry) GetAllRegistered() []string {
 	return names
 }
 
+// SetDefinition attaches a tool definition (description and JSON schema parameters) to a
+// registered tool so it can be listed with GetDefinitions. def.Name is set to toolName.
+func (fr *FunctionRegistry) SetDefinition(toolName string, def openai.FunctionDefinition) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	entry, ok := fr.functions[toolName]
+	if !ok {
+		return &FunctionNotFoundError{ToolName: toolName}
+	}
+	def.Name = toolName
+	entry.Definition = &def
+	fr.functions[toolName] = entry
+	return nil
+}
+
+// GetDefinitions returns the definitions of all registered tools, sorted by name.
+// Tools registered without a definition are listed by name only.
+func (fr *FunctionRegistry) GetDefinitions() []openai.Tool {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+
+	tools := make([]openai.Tool, 0, len(fr.functions))
+	for name, entry := range fr.functions {
+		def := &openai.FunctionDefinition{Name: name}
+		if entry.Definition != nil {
+			copied := *entry.Definition
+			def = &copied
+		}
+		tools = append(tools, openai.Tool{Type: openai.ToolTypeFunction, Function: def})
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Function.Name < tools[j].Function.Name })
+	return tools
+}
+
+// ExportSchema returns GetDefinitions as a JSON array, for documentation or client-side rendering
+func (fr *FunctionRegistry) ExportSchema() ([]byte, error) {
+	return json.MarshalIndent(fr.GetDefinitions(), "", "  ")
+}
+
 // ValidateTools checks if all tools in a registry have corresponding functions
 // Returns a list of missing tool names
 func (fr *FunctionRegistry) ValidateTools(toolRegistry *ToolRegistry) []string {
@@ -217,6 +423,26 @@ func (e *FunctionNotFoundError) Error() string {
 	return fmt.Sprintf("function not found for tool: %s", e.ToolName)
 }
 
+// ToolTimeoutError is returned when a tool does not finish within its timeout
+type ToolTimeoutError struct {
+	ToolName string
+	Timeout  time.Duration
+}
+
+func (e *ToolTimeoutError) Error() string {
+	return fmt.Sprintf("tool %s timed out after %s", e.ToolName, e.Timeout)
+}
+
+// ToolPanicError is returned when a tool function panics; the panic is recovered
+type ToolPanicError struct {
+	ToolName string
+	Value    interface{}
+}
+
+func (e *ToolPanicError) Error() string {
+	return fmt.Sprintf("tool %s panicked: %v", e.ToolName, e.Value)
+}
+
 // MissingFunctionsError is returned when tools are missing their functions
 type MissingFunctionsError struct {
 	MissingTools []string
@@ -1,8 +1,14 @@
 package model
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"regexp"
 	"testing"
+
+	"github.com/sashabaranov/go-openai"
 )
 
 func TestFunctionRegistry(t *testing.T) {
@@ -268,3 +274,166 @@ func TestFunctionRegistry_DisableToolTemporarily(t *testing.T) {
 		t.Errorf("Expected ToolDisabledError, got %T", err)
 	}
 }
+
+func TestFunctionRegistry_Definitions(t *testing.T) {
+	registry := NewFunctionRegistry()
+	noop := func(args map[string]interface{}) (string, error) { return "", nil }
+	registry.MustRegister("search", "", noop)
+	registry.MustRegister("archive", "", noop)
+
+	if err := registry.SetDefinition("missing", openai.FunctionDefinition{}); err == nil {
+		t.Error("Expected error setting definition of unregistered tool")
+	}
+	if err := registry.SetDefinition("search", openai.FunctionDefinition{
+		Description: "Search documents",
+		Parameters:  map[string]interface{}{"type": "object"},
+	}); err != nil {
+		t.Fatalf("SetDefinition failed: %v", err)
+	}
+	// Replacing the function keeps the definition
+	registry.RegisterOrReplace("search", "", noop)
+
+	defs := registry.GetDefinitions()
+	if len(defs) != 2 || defs[0].Function.Name != "archive" || defs[1].Function.Name != "search" {
+		t.Fatalf("Expected archive and search sorted by name, got %+v", defs)
+	}
+	if defs[1].Function.Description != "Search documents" {
+		t.Errorf("Expected search description, got %q", defs[1].Function.Description)
+	}
+
+	data, err := registry.ExportSchema()
+	if err != nil {
+		t.Fatalf("ExportSchema failed: %v", err)
+	}
+	var exported []openai.Tool
+	if err := json.Unmarshal(data, &exported); err != nil || len(exported) != 2 {
+		t.Errorf("Expected a JSON array of 2 tools, got %s (%v)", data, err)
+	}
+}
+
+func TestRegisterTyped(t *testing.T) {
+	type searchArgs struct {
+		Query string   `json:"query" description:"Text to search for"`
+		Limit int      `json:"limit,omitempty"`
+		Sort  string   `json:"sort,omitempty" enum:"relevance,date"`
+		Tags  []string `json:"tags,omitempty"`
+	}
+	type searchResult struct {
+		Hits []string `json:"hits"`
+	}
+
+	registry := NewFunctionRegistry()
+	var got searchArgs
+	err := RegisterTyped(registry, "search", "", func(ctx context.Context, in searchArgs) (searchResult, error) {
+		got = in
+		return searchResult{Hits: []string{in.Query}}, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterTyped failed: %v", err)
+	}
+	if !registry.HasContext("search") {
+		t.Error("Expected a context-aware tool")
+	}
+
+	// The definition carries the schema derived from the struct tags
+	defs := registry.GetDefinitions()
+	schema, _ := defs[0].Function.Parameters.(map[string]interface{})
+	if required, _ := schema["required"].([]string); len(required) != 1 || required[0] != "query" {
+		t.Errorf("Expected only query to be required, got %v", schema["required"])
+	}
+	props, _ := schema["properties"].(map[string]interface{})
+	if query, _ := props["query"].(map[string]interface{}); query["description"] != "Text to search for" {
+		t.Errorf("Expected the query description, got %v", props["query"])
+	}
+
+	result, err := registry.ExecuteContext(context.Background(), "search", map[string]interface{}{
+		"query": "go", "limit": "5", "tags": []interface{}{"a"}, "__user_id__": "u1",
+	})
+	if err != nil || result != `{"hits":["go"]}` {
+		t.Fatalf("Expected the JSON result, got %q (%v)", result, err)
+	}
+	if got.Limit != 5 || len(got.Tags) != 1 {
+		t.Errorf("Expected decoded arguments, got %+v", got)
+	}
+
+	// Invalid arguments are reported to the model instead of calling the function
+	got = searchArgs{}
+	result, err = registry.ExecuteContext(context.Background(), "search", map[string]interface{}{
+		"limit": 1.5, "sort": "name", "extra": true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error for invalid arguments, got %v", err)
+	}
+	var argsErr struct {
+		Error    string   `json:"error"`
+		Problems []string `json:"problems"`
+	}
+	if err := json.Unmarshal([]byte(result), &argsErr); err != nil || argsErr.Error != "invalid_arguments" {
+		t.Fatalf("Expected an invalid_arguments result, got %s", result)
+	}
+	want := []string{
+		"argument 'query' is required",
+		"unknown argument 'extra'",
+		"argument 'limit' must be an integer, got 1.5",
+		`argument 'sort' must be one of ["relevance","date"], got "name"`,
+	}
+	if len(argsErr.Problems) != len(want) {
+		t.Fatalf("Expected problems %v, got %v", want, argsErr.Problems)
+	}
+	for i := range want {
+		if argsErr.Problems[i] != want[i] {
+			t.Errorf("Problem %d: expected %q, got %q", i, want[i], argsErr.Problems[i])
+		}
+	}
+	if got.Query != "" {
+		t.Error("Expected the function not to be called")
+	}
+
+	if err := RegisterTyped(registry, "bad", "", func(ctx context.Context, in string) (string, error) { return in, nil }); err == nil {
+		t.Error("Expected an error for non-object arguments")
+	}
+}
+
+func TestFunctionRegistry_Middleware(t *testing.T) {
+	registry := NewFunctionRegistry()
+	var order []string
+	trace := func(name string) ToolMiddleware {
+		return func(next ContextToolFunction) ContextToolFunction {
+			return func(ctx context.Context, args map[string]interface{}) (string, error) {
+				info, _ := ToolCallInfoFromContext(ctx)
+				order = append(order, name+":"+info.ToolName+":"+info.UserID)
+				args["tenant"] = "acme"
+				return next(ctx, args)
+			}
+		}
+	}
+	registry.Use(trace("outer"), trace("inner"))
+	registry.Use(RedactToolResults("", regexp.MustCompile(`sk-[a-z0-9]+`)))
+
+	registry.MustRegister("lookup", "", func(args map[string]interface{}) (string, error) {
+		return fmt.Sprintf("key sk-abc123 for %v", args["tenant"]), nil
+	})
+
+	ctx := WithToolCallInfo(context.Background(), ToolCallInfo{UserID: "u1"})
+	result, err := registry.ExecuteContext(ctx, "lookup", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("ExecuteContext failed: %v", err)
+	}
+	if result != "key [REDACTED] for acme" {
+		t.Errorf("Expected a redacted result with the injected argument, got %q", result)
+	}
+	if len(order) != 2 || order[0] != "outer:lookup:u1" || order[1] != "inner:lookup:u1" {
+		t.Errorf("Expected middlewares in registration order with the tool call info, got %v", order)
+	}
+
+	// Functions called outside the registry can be wrapped too
+	wrapped := registry.Wrap("external", func(ctx context.Context, args map[string]interface{}) (string, error) {
+		return "sk-zzz", nil
+	})
+	if result, _ := wrapped(context.Background(), map[string]interface{}{}); result != "[REDACTED]" {
+		t.Errorf("Expected the wrapped result to be redacted, got %q", result)
+	}
+	if order[len(order)-1] != "inner:external:" {
+		t.Errorf("Expected the tool name in the context, got %v", order)
+	}
+}
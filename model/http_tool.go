@@ -0,0 +1,70 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HTTP tool argument placements (see HTTPTool.ArgsIn)
+const (
+	HTTPArgsInQuery = "query"
+	HTTPArgsInBody  = "body"
+)
+
+// HTTPTool declares a tool executed by calling a REST endpoint instead of a Go handler.
+// Set on a tool in tools.json as the "http" block.
+type HTTPTool struct {
+	// URL is the endpoint; {name} placeholders are replaced by the path-escaped argument
+	URL string `json:"url" yaml:"url"`
+	// Method is the HTTP method (default: GET)
+	Method string `json:"method,omitempty" yaml:"method,omitempty"`
+	// Headers are sent with every request; $VAR and ${VAR} are replaced by the engine's configured
+	// secrets or by environment variables with the allowed prefix (default: AGENTIZE_TOOL_).
+	// Header values are never logged or stored.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// TimeoutSeconds bounds the whole request (default: 30)
+	TimeoutSeconds int `json:"timeout_seconds,omitempty" yaml:"timeout_seconds,omitempty"`
+	// ArgsIn is where the arguments not used in URL go: "query" or "body" (a JSON object).
+	// Default: query for GET and DELETE, body otherwise.
+	ArgsIn string `json:"args_in,omitempty" yaml:"args_in,omitempty"`
+}
+
+// RequestMethod returns the upper-cased method, GET if unset
+func (h *HTTPTool) RequestMethod() string {
+	if h.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(h.Method)
+}
+
+// ArgsPlacement returns where the arguments go, applying the method-based default
+func (h *HTTPTool) ArgsPlacement() string {
+	if h.ArgsIn != "" {
+		return h.ArgsIn
+	}
+	switch h.RequestMethod() {
+	case http.MethodGet, http.MethodDelete, http.MethodHead:
+		return HTTPArgsInQuery
+	}
+	return HTTPArgsInBody
+}
+
+// Validate checks the URL, method and args_in of the block
+func (h *HTTPTool) Validate() error {
+	if !strings.HasPrefix(h.URL, "http://") && !strings.HasPrefix(h.URL, "https://") {
+		return fmt.Errorf("http.url %q must be an http:// or https:// URL", h.URL)
+	}
+	switch h.RequestMethod() {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead:
+	default:
+		return fmt.Errorf("unsupported http.method %q", h.Method)
+	}
+	if h.ArgsIn != "" && h.ArgsIn != HTTPArgsInQuery && h.ArgsIn != HTTPArgsInBody {
+		return fmt.Errorf("http.args_in %q must be %q or %q", h.ArgsIn, HTTPArgsInQuery, HTTPArgsInBody)
+	}
+	if h.TimeoutSeconds < 0 {
+		return fmt.Errorf("http.timeout_seconds must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"sync"
+)
+
+// ImageResult is an image produced by a tool (e.g. a chart), returned alongside its string result
+// with AttachImage or RegisterImage. The engine sends it to the model with the next LLM request
+// when the model is vision-capable (see engine.LLMConfig.Vision).
+type ImageResult struct {
+	Data     []byte // the encoded image (PNG, JPEG, WebP or GIF)
+	MIMEType string // e.g. "image/png" (default: sniffed from Data)
+	Caption  string // optional description sent with the image
+
+	// ToolName and ToolCallID identify the call that returned the image (set by AttachImage)
+	ToolName   string
+	ToolCallID string
+}
+
+// ImageToolFunction is a context-aware tool function that may return an image along with its
+// result (see RegisterImage); a nil image means the call produced none
+type ImageToolFunction func(ctx context.Context, args map[string]interface{}) (string, *ImageResult, error)
+
+// DataURL returns the image as a base64 data URL
+func (r ImageResult) DataURL() string {
+	return fmt.Sprintf("data:%s;base64,%s", r.mimeType(), base64.StdEncoding.EncodeToString(r.Data))
+}
+
+// mimeType returns MIMEType, or the type sniffed from Data when unset
+func (r ImageResult) mimeType() string {
+	if r.MIMEType != "" {
+		return r.MIMEType
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(r.Data))
+	return sniffed
+}
+
+// imageResults collects the images attached by the tool calls of one LLM turn
+type imageResults struct {
+	mu     sync.Mutex
+	images []ImageResult
+}
+
+type imageResultsCtxKey struct{}
+
+// WithImageResults returns a copy of ctx collecting the images tools attach with AttachImage, and
+// a function returning the images collected so far
+func WithImageResults(ctx context.Context) (context.Context, func() []ImageResult) {
+	collected := &imageResults{}
+	return context.WithValue(ctx, imageResultsCtxKey{}, collected), func() []ImageResult {
+		collected.mu.Lock()
+		defer collected.mu.Unlock()
+		return append([]ImageResult(nil), collected.images...)
+	}
+}
+
+// AttachImage adds image to the result of the tool call being executed. The call's ToolName and
+// ToolCallID are taken from ctx (see ToolCallInfoFromContext). It returns false, dropping the
+// image, when ctx does not collect images (the tool is not called by the engine) or image is empty.
+func AttachImage(ctx context.Context, image ImageResult) bool {
+	collected, ok := ctx.Value(imageResultsCtxKey{}).(*imageResults)
+	if !ok || len(image.Data) == 0 {
+		return false
+	}
+	if info, ok := ToolCallInfoFromContext(ctx); ok {
+		image.ToolName, image.ToolCallID = info.ToolName, info.ToolCallID
+	}
+	collected.mu.Lock()
+	defer collected.mu.Unlock()
+	collected.images = append(collected.images, image)
+	return true
+}
+
+// RegisterImage registers fn as a context-aware tool whose image, if any, is attached to its
+// result (see AttachImage). Middlewares see the string result only.
+func RegisterImage(fr *FunctionRegistry, toolName string, displayName string, fn ImageToolFunction) error {
+	if fn == nil {
+		return fmt.Errorf("function cannot be nil for tool: %s", toolName)
+	}
+	return fr.RegisterContext(toolName, displayName, func(ctx context.Context, args map[string]interface{}) (string, error) {
+		result, image, err := fn(ctx, args)
+		if err == nil && image != nil {
+			AttachImage(ctx, *image)
+		}
+		return result, err
+	})
+}
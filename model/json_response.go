@@ -0,0 +1,25 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ParseJSONResponse parses an answer the model was asked to give as JSON (a response format) and,
+// when schema is set, validates it against the schema. A surrounding markdown code fence is
+// ignored. It returns the decoded value, or the problems that make the answer unusable.
+func ParseJSONResponse(content string, schema map[string]interface{}) (interface{}, []string) {
+	text := strings.TrimSpace(content)
+	if unfenced, ok := stripCodeFence(text); ok {
+		text = unfenced
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, []string{fmt.Sprintf("the answer is not valid JSON: %v", err)}
+	}
+	if problems := validateAgainstSchema(schema, value, ""); len(problems) > 0 {
+		return nil, problems
+	}
+	return value, nil
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// KnowledgeChunk is an excerpt of a node's content (node.md) with the embedding used to search it
+type KnowledgeChunk struct {
+	// ChunkID is "<node path>#<position of the excerpt in the node>" (see NewKnowledgeChunk)
+	ChunkID  string
+	NodePath string
+	Title    string
+	Text     string
+	// Hash is the SHA256 of the embedded text, so unchanged excerpts keep their embedding
+	Hash      string
+	Embedding []float32
+	IndexedAt time.Time
+}
+
+// NewKnowledgeChunk creates the index-th excerpt of the node at nodePath
+func NewKnowledgeChunk(nodePath string, index int, title, text, hash string, embedding []float32) *KnowledgeChunk {
+	return &KnowledgeChunk{
+		ChunkID:   fmt.Sprintf("%s#%d", nodePath, index),
+		NodePath:  nodePath,
+		Title:     title,
+		Text:      text,
+		Hash:      hash,
+		Embedding: embedding,
+		IndexedAt: time.Now(),
+	}
+}
+
+// KnowledgeIndexStore is implemented by stores that persist the knowledge search index
+type KnowledgeIndexStore interface {
+	// GetKnowledgeChunks returns every stored excerpt, ordered by chunk ID
+	GetKnowledgeChunks() ([]*KnowledgeChunk, error)
+	// ReplaceKnowledgeChunks replaces the stored index with chunks
+	ReplaceKnowledgeChunks(chunks []*KnowledgeChunk) error
+}
@@ -0,0 +1,63 @@
+package model
+
+import "fmt"
+
+// LLMOverride overrides the engine's LLM settings while a session is on a node
+//
+// Example YAML:
+//
+//	llm:
+//	  model: "openai/gpt-5"
+//	  temperature: 0.2
+//	  max_tokens: 2000
+type LLMOverride struct {
+	Model       string   `yaml:"model,omitempty"`
+	Temperature *float32 `yaml:"temperature,omitempty"` // nil keeps the engine default (0 is a valid temperature)
+	MaxTokens   int      `yaml:"max_tokens,omitempty"`
+}
+
+// IsZero reports whether the override sets nothing
+func (o LLMOverride) IsZero() bool {
+	return o.Model == "" && o.Temperature == nil && o.MaxTokens == 0
+}
+
+// LLMOverrideConflictError is returned by MergeLLMOverrides with MergeStrategyError
+// when two nodes set the same field to different values
+type LLMOverrideConflictError struct {
+	Field    string
+	Existing interface{}
+	New      interface{}
+}
+
+func (e *LLMOverrideConflictError) Error() string {
+	return fmt.Sprintf("llm override conflict on %s: %v vs %v", e.Field, e.Existing, e.New)
+}
+
+// MergeLLMOverrides combines overrides ordered from top-most to deepest node, field by field,
+// using the same semantics as ToolRegistry: override (and append, which has nothing to rename)
+// lets the later node win; error fails when two nodes set the same field differently.
+func MergeLLMOverrides(strategy MergeStrategy, overrides ...LLMOverride) (LLMOverride, error) {
+	var merged LLMOverride
+	for _, o := range overrides {
+		if o.Model != "" {
+			if strategy == MergeStrategyError && merged.Model != "" && merged.Model != o.Model {
+				return LLMOverride{}, &LLMOverrideConflictError{Field: "model", Existing: merged.Model, New: o.Model}
+			}
+			merged.Model = o.Model
+		}
+		if o.Temperature != nil {
+			if strategy == MergeStrategyError && merged.Temperature != nil && *merged.Temperature != *o.Temperature {
+				return LLMOverride{}, &LLMOverrideConflictError{Field: "temperature", Existing: *merged.Temperature, New: *o.Temperature}
+			}
+			t := *o.Temperature
+			merged.Temperature = &t
+		}
+		if o.MaxTokens != 0 {
+			if strategy == MergeStrategyError && merged.MaxTokens != 0 && merged.MaxTokens != o.MaxTokens {
+				return LLMOverride{}, &LLMOverrideConflictError{Field: "max_tokens", Existing: merged.MaxTokens, New: o.MaxTokens}
+			}
+			merged.MaxTokens = o.MaxTokens
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMergeLLMOverrides(t *testing.T) {
+	low, high := float32(0.2), float32(0.9)
+	parent := LLMOverride{Model: "cheap-model", Temperature: &low}
+	child := LLMOverride{Model: "reasoning-model", MaxTokens: 4000}
+
+	merged, err := MergeLLMOverrides(MergeStrategyOverride, parent, child)
+	if err != nil {
+		t.Fatalf("MergeLLMOverrides failed: %v", err)
+	}
+	if merged.Model != "reasoning-model" || merged.MaxTokens != 4000 || merged.Temperature == nil || *merged.Temperature != low {
+		t.Errorf("Unexpected merge result: %+v", merged)
+	}
+
+	// Same value on both nodes is not a conflict
+	if _, err := MergeLLMOverrides(MergeStrategyError, parent, LLMOverride{Temperature: &low}); err != nil {
+		t.Errorf("Expected no conflict for equal values, got %v", err)
+	}
+
+	_, err = MergeLLMOverrides(MergeStrategyError, parent, LLMOverride{Temperature: &high})
+	var conflict *LLMOverrideConflictError
+	if !errors.As(err, &conflict) || conflict.Field != "temperature" {
+		t.Errorf("Expected temperature conflict, got %v", err)
+	}
+}
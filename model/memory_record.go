@@ -0,0 +1,95 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// MemoryRecord is a fact remembered about a user across sessions, with the embedding used to recall it
+type MemoryRecord struct {
+	MemoryID string
+	UserID   string
+	// Key names the fact (e.g. "preferred_tone") when it was extracted from a conversation; a
+	// user has one fact per key. Facts stored with the remember tool have no key.
+	Key  string
+	Text string
+	// Confidence is how sure the extraction was of the fact, from 0 to 1 (1 for remembered facts)
+	Confidence float64
+	// SessionID is the session the fact was learned in
+	SessionID string
+	Embedding []float32
+	CreatedAt time.Time
+	// LastUsedAt is when the fact was last stored or recalled; the least recently used facts are
+	// evicted first when a user has too many
+	LastUsedAt time.Time
+}
+
+// memoryRecordSeq keeps memory IDs unique when memories are created within the same clock tick
+var memoryRecordSeq atomic.Int64
+
+// NewMemoryRecord creates a memory record of a user
+func NewMemoryRecord(userID, text string, embedding []float32) *MemoryRecord {
+	now := time.Now()
+	return &MemoryRecord{
+		MemoryID:   fmt.Sprintf("%s-memory-%d-%d", userID, now.UnixNano(), memoryRecordSeq.Add(1)),
+		UserID:     userID,
+		Text:       text,
+		Confidence: 1,
+		Embedding:  embedding,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+}
+
+// NewMemoryFact creates the fact key of a user learned in sessionID. Its ID is derived from the
+// key (see NormalizeMemoryKey), so storing it replaces the previous value of the key.
+func NewMemoryFact(userID, sessionID, key, value string, confidence float64, embedding []float32) *MemoryRecord {
+	now := time.Now()
+	key = NormalizeMemoryKey(key)
+	return &MemoryRecord{
+		MemoryID:   fmt.Sprintf("%s-memory-%s", userID, key),
+		UserID:     userID,
+		Key:        key,
+		Text:       value,
+		Confidence: confidence,
+		SessionID:  sessionID,
+		Embedding:  embedding,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+}
+
+// NormalizeMemoryKey returns key trimmed and lower-cased, with runs of other characters than
+// letters and digits replaced by an underscore
+func NormalizeMemoryKey(key string) string {
+	var sb strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(strings.TrimSpace(key)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pending && sb.Len() > 0 {
+				sb.WriteByte('_')
+			}
+			pending = false
+			sb.WriteRune(r)
+			continue
+		}
+		pending = true
+	}
+	return sb.String()
+}
+
+// MemoryStore is implemented by stores that keep the long-term memories of users
+type MemoryStore interface {
+	// PutMemory stores a memory, replacing the memory with the same ID
+	PutMemory(memory *MemoryRecord) error
+	// GetMemoriesByUser returns every memory of userID, oldest first
+	GetMemoriesByUser(userID string) ([]*MemoryRecord, error)
+	// DeleteMemories deletes the memories of userID with the given IDs (every memory of the user
+	// when none is given) and returns how many were deleted
+	DeleteMemories(userID string, memoryIDs ...string) (int, error)
+	// TouchMemories sets the LastUsedAt of the memories of userID with the given IDs
+	TouchMemories(userID string, memoryIDs []string, at time.Time) error
+}
@@ -49,6 +49,9 @@ type Message struct {
 	PromptTokens     int // Tokens used in the prompt
 	CompletionTokens int // Tokens used in the completion
 	TotalTokens      int // Total tokens used
+	// ReasoningTokens is the part of CompletionTokens the model spent reasoning (thinking)
+	// before answering; reported by reasoning models, 0 otherwise
+	ReasoningTokens int
 
 	// Request information
 	RequestModel string  // Model requested (may differ from actual model used)
@@ -61,6 +64,9 @@ type Message struct {
 
 	// Nonsense detection
 	IsNonsense bool // Whether this message was detected as nonsense
+	// IsDuplicate marks a queued user message dropped because it repeated the message before it
+	// (kept out of the conversation, see CoreHandlerConfig.DropDuplicateOfCurrent)
+	IsDuplicate bool
 
 	// Metadata
 	CreatedAt time.Time
@@ -106,6 +112,9 @@ func NewMessage(
 		FinishReason:     string(choice.FinishReason),
 		CreatedAt:        now,
 	}
+	if details := response.Usage.CompletionTokensDetails; details != nil {
+		msg.ReasoningTokens = details.ReasoningTokens
+	}
 
 	return msg
 }
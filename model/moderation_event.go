@@ -0,0 +1,63 @@
+package model
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ModerationEventType is the kind of moderation action recorded in the audit trail
+type ModerationEventType string
+
+const (
+	ModerationEventBan            ModerationEventType = "ban"
+	ModerationEventUnban          ModerationEventType = "unban"
+	ModerationEventNonsenseStrike ModerationEventType = "nonsense_strike"
+)
+
+// Who or what triggered a moderation event
+const (
+	ModerationActorAuto  = "auto_moderation" // nonsense detection
+	ModerationActorCore  = "core_tool"       // the Core LLM (ban_user / unban_user)
+	ModerationActorAdmin = "admin"           // CoreHandler.UnbanUser / debug pages
+)
+
+// ModerationEvent is one entry of a user's moderation history
+type ModerationEvent struct {
+	EventID   string
+	UserID    string
+	Type      ModerationEventType
+	Actor     string // see ModerationActor*
+	MessageID string // user message that triggered the event, when known
+	Reason    string // ban message or unban reason
+
+	// Bans: Duration is zero for permanent bans
+	Duration time.Duration
+	// NonsenseCount is the user's nonsense strike count after the event
+	NonsenseCount int
+
+	CreatedAt time.Time
+}
+
+// moderationEventSeq keeps event IDs unique when events are created within the same clock tick
+var moderationEventSeq atomic.Int64
+
+// NewModerationEvent creates a moderation event for a user
+func NewModerationEvent(userID string, eventType ModerationEventType, actor string) *ModerationEvent {
+	now := time.Now()
+	return &ModerationEvent{
+		EventID:   fmt.Sprintf("%s-mod-%d-%d", userID, now.UnixNano(), moderationEventSeq.Add(1)),
+		UserID:    userID,
+		Type:      eventType,
+		Actor:     actor,
+		CreatedAt: now,
+	}
+}
+
+// ModerationEventStore is implemented by stores that keep the moderation audit trail
+type ModerationEventStore interface {
+	// PutModerationEvent stores a moderation event (ban, unban, nonsense strike)
+	PutModerationEvent(event *ModerationEvent) error
+	// GetModerationEventsByUser returns a user's moderation events, newest first
+	GetModerationEventsByUser(userID string) ([]*ModerationEvent, error)
+}
@@ -21,6 +21,14 @@ type Node struct {
 	Tools []Tool
 	// MCP is a list of MCP servers that this node can connect to
 	MCP []MCP
+	// Routing controls how the node advances to one of its children
+	Routing Routing
+	// LLM overrides the engine's model settings while a session is on this node
+	LLM LLMOverride
+	// ToolsPolicy controls how Tools merge with the tools inherited from ancestors
+	ToolsPolicy ToolsPolicy
+	// OnEnter is a tool the engine runs when a session enters the node (optional)
+	OnEnter *OnEnterAction
 	// Metadata
 	LoadedAt time.Time
 	Hash     string // Content hash for cache invalidation
@@ -46,6 +54,7 @@ type Node struct {
 //	  users:
 //	    "user123":
 //	      perms: "rw"  # Override: read+write for specific user
+//	  policy: "deny"  # Root only: users matching no rule are denied (default: allow)
 //
 // Permission flags:
 //   - r: read (can read node content)
@@ -62,6 +71,10 @@ type Node struct {
 //  4. Inherited from parent (if inherit: true)
 //  5. Default permissions
 //  6. Deny all
+//
+// The engine resolves permissions across the whole tree instead (see Engine.SetGroupResolver):
+// explicit user/group/role entries of the node and its inherited ancestors first, then the
+// nearest non-empty default, then the root policy.
 type Auth struct {
 	// Inherit from parent node (default: true)
 	// When true, permissions from parent node are inherited
@@ -85,8 +98,18 @@ type Auth struct {
 	// Groups can be defined globally and referenced here
 	// Example: groups: { developers: { perms: "rwx" } }
 	Groups map[string]*Permissions `yaml:"groups,omitempty"`
+
+	// Policy applied by the engine to users matching no rule anywhere on the node's path
+	// Only read from the root node: "allow" (default) or "deny"
+	Policy string `yaml:"policy,omitempty"`
 }
 
+// Auth policies for users that match no rule (see Auth.Policy)
+const (
+	AuthPolicyAllow = "allow"
+	AuthPolicyDeny  = "deny"
+)
+
 // Permissions defines what actions are allowed
 // Uses permission strings (like Unix: rwx) for flexibility
 type Permissions struct {
@@ -140,6 +163,12 @@ func (p *Permissions) HasPermission(flag rune) bool {
 	return false
 }
 
+// IsZero reports whether p grants nothing and sets no flag explicitly
+func (p *Permissions) IsZero() bool {
+	return p == nil || (p.Perms == "" && p.Read == nil && p.Write == nil && p.Execute == nil &&
+		p.See == nil && p.VisibleDocs == nil && p.VisibleGraph == nil)
+}
+
 // Permission flags constants
 const (
 	PermRead         = 'r' // Read content
@@ -197,16 +226,40 @@ type Tool struct {
 
 	// ErrorMessage provides additional details about why the tool is disabled
 	ErrorMessage string `json:"error_message,omitempty"`
+
+	// HTTP makes the engine execute the tool by calling an endpoint (optional, see HTTPTool)
+	HTTP *HTTPTool `json:"http,omitempty"`
 }
 
 // NodeMeta is the parsed structure from node.yaml
 type NodeMeta struct {
-	ID          string `yaml:"id"`
-	Title       string `yaml:"title"`
-	Description string `yaml:"description"`
-	Summary     string `yaml:"summary,omitempty"`
-	Auth        Auth   `yaml:"auth"`
-	MCP         []MCP  `yaml:"mcp,omitempty"`
+	ID          string         `yaml:"id"`
+	Title       string         `yaml:"title"`
+	Description string         `yaml:"description"`
+	Summary     string         `yaml:"summary,omitempty"`
+	Auth        Auth           `yaml:"auth"`
+	MCP         []MCP          `yaml:"mcp,omitempty"`
+	Routing     Routing        `yaml:"routing,omitempty"`
+	Model       string         `yaml:"model,omitempty"` // shorthand for llm.model (which takes precedence)
+	LLM         LLMOverride    `yaml:"llm,omitempty"`
+	ToolsPolicy ToolsPolicy    `yaml:"tools_policy,omitempty"`
+	OnEnter     *OnEnterAction `yaml:"on_enter,omitempty"`
+}
+
+// OnEnterAction is a tool call the engine makes once each time a session enters the node
+// (Engine.Advance and Engine.JumpTo); its result is added to the session's context.
+// String arguments are text/template templates rendered against the session (see TemplateContext).
+//
+// Example YAML:
+//
+//	on_enter:
+//	  tool: "get_account_status"
+//	  args:
+//	    account: "{{.UserID}}"
+//	    plan: "{{.Vars.plan}}"
+type OnEnterAction struct {
+	Tool string                 `yaml:"tool"`
+	Args map[string]interface{} `yaml:"args,omitempty"`
 }
 
 // ResolvePermissions resolves permissions for a user, considering inheritance
@@ -222,6 +275,33 @@ func (n *Node) ResolvePermissions(userID string, parentNode *Node, userRoles []s
 	// 5. Default permissions
 	// 6. Deny all (if nothing matches)
 
+	// 1-3. Check user, group and role entries
+	if perms := n.MatchPermissions(userID, userRoles, userGroups); perms != nil {
+		return perms
+	}
+
+	// 4. Inherit from parent if enabled (default: true)
+	if n.Auth.Inherit && parentNode != nil {
+		// Recursively resolve parent permissions (without passing parent again to avoid infinite loop)
+		parentPerms := parentNode.ResolvePermissions(userID, nil, userRoles, userGroups)
+		if parentPerms != nil {
+			return parentPerms
+		}
+	}
+
+	// 5. Use default permissions
+	if n.Auth.Default != nil {
+		return n.Auth.Default
+	}
+
+	// 6. Deny all (return nil)
+	return nil
+}
+
+// MatchPermissions returns the node's own entry for a user, checking users, then groups,
+// then roles (first match wins). Returns nil if no entry matches; defaults and inheritance
+// are not considered.
+func (n *Node) MatchPermissions(userID string, userRoles []string, userGroups []string) *Permissions {
 	// 1. Check user-specific override
 	if n.Auth.Users != nil {
 		if perms, ok := n.Auth.Users[userID]; ok && perms != nil {
@@ -246,22 +326,6 @@ func (n *Node) ResolvePermissions(userID string, parentNode *Node, userRoles []s
 			}
 		}
 	}
-
-	// 4. Inherit from parent if enabled (default: true)
-	if n.Auth.Inherit && parentNode != nil {
-		// Recursively resolve parent permissions (without passing parent again to avoid infinite loop)
-		parentPerms := parentNode.ResolvePermissions(userID, nil, userRoles, userGroups)
-		if parentPerms != nil {
-			return parentPerms
-		}
-	}
-
-	// 5. Use default permissions
-	if n.Auth.Default != nil {
-		return n.Auth.Default
-	}
-
-	// 6. Deny all (return nil)
 	return nil
 }
 
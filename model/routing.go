@@ -0,0 +1,184 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RoutingMode controls how a node advances to one of its children
+type RoutingMode string
+
+const (
+	RoutingSequential  RoutingMode = "sequential"  // advance to the first child not yet visited
+	RoutingParallel    RoutingMode = "parallel"    // all children are open; advance behaves like sequential
+	RoutingConditional RoutingMode = "conditional" // first rule whose condition matches the session wins
+	RoutingLLM         RoutingMode = "llm"         // the model picks a child from titles/descriptions
+)
+
+// ValidRoutingModes lists every routing mode accepted in node.yaml
+var ValidRoutingModes = []RoutingMode{RoutingSequential, RoutingParallel, RoutingConditional, RoutingLLM}
+
+// IsValidRoutingMode reports whether mode is a known routing mode (empty means sequential)
+func IsValidRoutingMode(mode RoutingMode) bool {
+	if mode == "" {
+		return true
+	}
+	for _, m := range ValidRoutingModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Routing is the routing configuration of a node
+//
+// Example YAML:
+//
+//	routing:
+//	  mode: "conditional"
+//	  rules:
+//	    - when: 'vars.intent == "refund"'
+//	      next: "refund"
+//	    - when: 'tags contains "bug" || vars.intent == "technical"'
+//	      next: "technical"
+//	  default: "sales"
+type Routing struct {
+	Mode RoutingMode `yaml:"mode"`
+	// Rules are evaluated in order for conditional routing; the first match wins
+	Rules []RoutingRule `yaml:"rules,omitempty"`
+	// Default is the child used when no rule matches (or the model's answer is unusable)
+	Default string `yaml:"default,omitempty"`
+}
+
+// RoutingRule routes to Next when the When expression matches the session
+type RoutingRule struct {
+	When string `yaml:"when"`
+	Next string `yaml:"next"` // child directory name (e.g. "refund") or full path (e.g. "root/intake/refund")
+}
+
+// EffectiveMode returns the routing mode, defaulting to sequential
+func (r Routing) EffectiveMode() RoutingMode {
+	if r.Mode == "" {
+		return RoutingSequential
+	}
+	return r.Mode
+}
+
+// RouteDecision records one Advance step so the path taken through the tree is auditable
+type RouteDecision struct {
+	From   string
+	To     string
+	Mode   RoutingMode
+	Reason string // matched rule, model answer, explicit choice, ...
+	At     time.Time
+}
+
+// EvaluateCondition evaluates a routing rule expression against session variables and tags.
+//
+// Grammar (no parentheses; && binds tighter than ||):
+//
+//	expr   := and ( "||" and )*
+//	and    := clause ( "&&" clause )*
+//	clause := "true" | "false" | ident "exists" | ident op value
+//	op     := "==" | "!=" | "contains"
+//	ident  := "tags" | "vars.<name>" | "<name>"   (bare names refer to vars)
+//	value  := "quoted string" | 'quoted string' | bare-word
+//
+// "tags contains X" checks tag membership; "<var> contains X" is a substring check.
+func EvaluateCondition(expr string, vars map[string]string, tags []string) (bool, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return false, fmt.Errorf("empty condition")
+	}
+	for _, alternative := range strings.Split(expr, "||") {
+		matched := true
+		for _, clause := range strings.Split(alternative, "&&") {
+			ok, err := evaluateClause(strings.TrimSpace(clause), vars, tags)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ValidateCondition checks the syntax of every clause in a routing rule expression
+func ValidateCondition(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return fmt.Errorf("empty condition")
+	}
+	for _, alternative := range strings.Split(expr, "||") {
+		for _, clause := range strings.Split(alternative, "&&") {
+			if _, err := evaluateClause(strings.TrimSpace(clause), nil, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evaluateClause evaluates a single comparison
+func evaluateClause(clause string, vars map[string]string, tags []string) (bool, error) {
+	switch clause {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return false, fmt.Errorf("empty clause")
+	}
+
+	fields := strings.Fields(clause)
+	ident := fields[0]
+	if len(fields) == 2 && fields[1] == "exists" {
+		if ident == "tags" {
+			return len(tags) > 0, nil
+		}
+		_, ok := vars[strings.TrimPrefix(ident, "vars.")]
+		return ok, nil
+	}
+	if len(fields) < 3 {
+		return false, fmt.Errorf("invalid clause %q (expected: <name> ==|!=|contains <value>)", clause)
+	}
+
+	op := fields[1]
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(clause[len(ident):]), op))
+	value := strings.Trim(rest, `"'`)
+
+	if ident == "tags" {
+		has := false
+		for _, tag := range tags {
+			if strings.EqualFold(tag, value) {
+				has = true
+				break
+			}
+		}
+		switch op {
+		case "contains", "==":
+			return has, nil
+		case "!=":
+			return !has, nil
+		}
+		return false, fmt.Errorf("unknown operator %q in clause %q", op, clause)
+	}
+
+	actual := vars[strings.TrimPrefix(ident, "vars.")]
+	switch op {
+	case "==":
+		return actual == value, nil
+	case "!=":
+		return actual != value, nil
+	case "contains":
+		return strings.Contains(strings.ToLower(actual), strings.ToLower(value)), nil
+	}
+	return false, fmt.Errorf("unknown operator %q in clause %q", op, clause)
+}
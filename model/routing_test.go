@@ -0,0 +1,48 @@
+package model
+
+import "testing"
+
+func TestEvaluateCondition(t *testing.T) {
+	vars := map[string]string{"intent": "refund", "plan": "Pro Annual"}
+	tags := []string{"billing", "urgent"}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`vars.intent == "refund"`, true},
+		{`intent == refund`, true},
+		{`intent != "refund"`, false},
+		{`plan contains "annual"`, true},
+		{`tags contains "billing"`, true},
+		{`tags contains "sales"`, false},
+		{`tags != "sales"`, true},
+		{`vars.country exists`, false},
+		{`vars.plan exists`, true},
+		{`intent == "sales" || tags contains "urgent"`, true},
+		{`intent == "refund" && tags contains "sales"`, false},
+		{`intent == "sales" && tags contains "billing" || plan contains "pro"`, true},
+		{`true`, true},
+	}
+	for _, tt := range tests {
+		got, err := EvaluateCondition(tt.expr, vars, tags)
+		if err != nil {
+			t.Errorf("EvaluateCondition(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("EvaluateCondition(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCondition(t *testing.T) {
+	for _, expr := range []string{"", `intent`, `intent ~= "x"`, `intent == "a" && `, `true || intent`} {
+		if err := ValidateCondition(expr); err == nil {
+			t.Errorf("ValidateCondition(%q) expected error", expr)
+		}
+	}
+	if err := ValidateCondition(`intent == "a" || tags contains b`); err != nil {
+		t.Errorf("ValidateCondition returned unexpected error: %v", err)
+	}
+}
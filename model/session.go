@@ -34,6 +34,23 @@ const (
 	AgentTypeUser AgentType = "user"
 )
 
+// namedAgentPrefix marks the agent type of a named specialist agent (see NamedAgentType)
+const namedAgentPrefix = "agent:"
+
+// NamedAgentType returns the agent type of the sessions of the named specialist agent name
+// (e.g. "agent:billing"), so each user has separate sessions per named agent
+func NamedAgentType(name string) AgentType {
+	return AgentType(namedAgentPrefix + name)
+}
+
+// AgentName returns the name of a named agent type ("" for core, high, low and user)
+func (t AgentType) AgentName() string {
+	if name, ok := strings.CutPrefix(string(t), namedAgentPrefix); ok {
+		return name
+	}
+	return ""
+}
+
 // Session represents a user session in the agent system
 // All fields are flattened for simple database storage and loading
 type Session struct {
@@ -52,6 +69,10 @@ type Session struct {
 	// When Msgs is empty, the scheduler uses ArchivedMsgs for summarization (e.g. re-summarize when Summary was lost).
 	ArchivedMsgs []openai.ChatCompletionMessage
 
+	// TrimmedMsgs counts the last ArchivedMsgs that the active history window (MaxActiveMessages /
+	// MaxActiveTokens) moved out of Msgs and that are not summarized yet
+	TrimmedMsgs int
+
 	// ==================== Runtime State (not persisted to database) ====================
 	// InProgress indicates if a message is currently being processed
 	InProgress bool `bson:"-" json:"-"`
@@ -66,11 +87,25 @@ type Session struct {
 	// ToolResults stores tool execution results by unique ID (for large results)
 	ToolResults map[string]string
 
+	// ==================== Routing ====================
+	// Vars are session variables used by conditional routing rules (e.g. "intent": "refund")
+	Vars map[string]string
+	// RouteHistory records every Advance step, in order
+	RouteHistory []RouteDecision
+	// PathStack is the navigation stack of node paths (root end first): Advance pushes the chosen
+	// node and GoBack pops it
+	PathStack []string
+
 	// ==================== Timestamps ====================
 	CreatedAt    time.Time
 	UpdatedAt    time.Time // Also serves as LastActivity
 	SummarizedAt time.Time // When the session was last summarized
 
+	// ==================== Archival ====================
+	// Archived sessions are hidden from session lists, prompts and core routing but kept in the store
+	Archived   bool
+	ArchivedAt time.Time
+
 	// ==================== Summarization ====================
 	Tags    []string // User-defined or auto-generated tags for categorization
 	Title   string   // Session title (auto-generated or user-set)
@@ -82,6 +117,21 @@ type Session struct {
 	OpenedFileSeq       int // Sequence counter for opened files
 	SummarizationLogSeq int // Sequence counter for summarization logs
 
+	// ==================== Token Usage ====================
+	// Tokens spent by the conversation's LLM calls (see AddTokenUsage)
+	TotalPromptTokens     int
+	TotalCompletionTokens int
+	TotalTokens           int
+	// TotalReasoningTokens is the part of TotalCompletionTokens spent reasoning
+	TotalReasoningTokens int
+	// SummarizationTokens are spent summarizing the session and are not part of the totals above
+	SummarizationTokens int
+
+	// ==================== Persistence ====================
+	// PersistErrors counts failed saves of the session's messages, tool calls and state that a
+	// turn continued past (see engine.CoreHandlerConfig.FailFastOnPersistError)
+	PersistErrors int
+
 	// ==================== Internal (not persisted) ====================
 	seqMu sync.Mutex `bson:"-" json:"-"` // Mutex for thread-safe sequence operations
 }
@@ -156,6 +206,9 @@ func GenerateSessionID(userID string, agentType AgentType, seq int) string {
 
 // agentTypeShortCode returns short code for agent type
 func agentTypeShortCode(agentType AgentType) string {
+	if name := agentType.AgentName(); name != "" {
+		return name
+	}
 	switch agentType {
 	case AgentTypeCore:
 		return "core"
@@ -274,6 +327,72 @@ func (s *Session) GenerateSummarizationLogIDWithSeq() (string, int) {
 	return logID, s.SummarizationLogSeq
 }
 
+// AddTokenUsage adds the usage of one conversation LLM call to the session's token totals
+// Thread-safe via mutex
+func (s *Session) AddTokenUsage(usage openai.Usage) {
+	s.seqMu.Lock()
+	defer s.seqMu.Unlock()
+	s.TotalPromptTokens += usage.PromptTokens
+	s.TotalCompletionTokens += usage.CompletionTokens
+	s.TotalTokens += usage.TotalTokens
+	if usage.CompletionTokensDetails != nil {
+		s.TotalReasoningTokens += usage.CompletionTokensDetails.ReasoningTokens
+	}
+}
+
+// CapMessages keeps at most maxMessages messages in Msgs (<= 0: no limit) and returns how many
+// were moved out. The oldest ones are moved to ArchivedMsgs, whole turns (a user message and
+// everything answering it) first, and counted in TrimmedMsgs so the next summary covers them.
+// When the current turn alone exceeds the cap its oldest messages go too, but an assistant tool
+// call is never separated from its tool results, so Msgs can stay above the cap by those.
+func (s *Session) CapMessages(maxMessages int) int {
+	if maxMessages <= 0 || len(s.Msgs) <= maxMessages {
+		return 0
+	}
+
+	// The first turn boundary that brings Msgs within the cap
+	cut := -1
+	for i := len(s.Msgs) - maxMessages; i < len(s.Msgs); i++ {
+		if s.Msgs[i].Role == openai.ChatMessageRoleUser {
+			cut = i
+			break
+		}
+	}
+	if cut < 0 {
+		// Otherwise any message but a tool result can start Msgs
+		cut = WindowStart(s.Msgs, func(window []openai.ChatCompletionMessage) bool {
+			return len(window) <= maxMessages
+		})
+	}
+	if cut <= 0 {
+		return 0
+	}
+
+	s.ArchivedMsgs = append(s.ArchivedMsgs, s.Msgs[:cut]...)
+	s.TrimmedMsgs += cut
+	s.Msgs = append([]openai.ChatCompletionMessage{}, s.Msgs[cut:]...)
+	return cut
+}
+
+// WindowStart returns where the most recent messages of msgs that fit start: the first index
+// whose window msgs[i:] fits, moved forward past tool results so an assistant tool call is never
+// separated from its results. The last message (with its tool results) is always kept, even when
+// it does not fit alone.
+func WindowStart(msgs []openai.ChatCompletionMessage, fits func(window []openai.ChatCompletionMessage) bool) int {
+	last := len(msgs) - 1
+	for last > 0 && msgs[last].Role == openai.ChatMessageRoleTool {
+		last--
+	}
+	start := 0
+	for start < last && !fits(msgs[start:]) {
+		start++
+		for start < last && msgs[start].Role == openai.ChatMessageRoleTool {
+			start++
+		}
+	}
+	return start
+}
+
 // ==================== Backward Compatibility Methods ====================
 
 // GetConversationState returns a ConversationState-like view of the session
@@ -318,6 +437,7 @@ func (s *Session) Clone() *Session {
 		ToolSeq:             s.ToolSeq,
 		OpenedFileSeq:       s.OpenedFileSeq,
 		SummarizationLogSeq: s.SummarizationLogSeq,
+		TrimmedMsgs:         s.TrimmedMsgs,
 		// seqMu is NOT copied - new mutex for the clone
 	}
 
@@ -0,0 +1,179 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghiac/agentize/log"
+	"github.com/sashabaranov/go-openai"
+)
+
+// SessionExportVersion is the format version written by ExportSession
+const SessionExportVersion = 1
+
+// SessionExport is a self-contained, store-independent copy of a session and the records
+// that belong to it, used to move conversations between stores or environments
+type SessionExport struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+
+	Session           *Session            `json:"session"`
+	Messages          []*Message          `json:"messages,omitempty"`
+	ToolCalls         []*ToolCall         `json:"tool_calls,omitempty"`
+	OpenedFiles       []*OpenedFile       `json:"opened_files,omitempty"`
+	SummarizationLogs []*SummarizationLog `json:"summarization_logs,omitempty"`
+}
+
+// ImportOptions modifies how ImportSession writes a SessionExport
+type ImportOptions struct {
+	// UserID assigns the session to another user ("" keeps the exported owner)
+	UserID string
+}
+
+// ExportSession collects a session and its messages, tool calls, opened files and
+// summarization logs. Records the store does not keep are left out.
+func (sh *SessionHandler) ExportSession(sessionID string) (*SessionExport, error) {
+	session, err := sh.store.Get(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	doc := &SessionExport{Version: SessionExportVersion, ExportedAt: time.Now(), Session: session}
+
+	if s, ok := sh.store.(interface {
+		GetMessagesBySession(string) ([]*Message, error)
+	}); ok {
+		if doc.Messages, err = s.GetMessagesBySession(sessionID); err != nil {
+			return nil, fmt.Errorf("failed to get messages: %w", err)
+		}
+	}
+	if s, ok := sh.store.(interface {
+		GetToolCallsBySession(string) ([]*ToolCall, error)
+	}); ok {
+		if doc.ToolCalls, err = s.GetToolCallsBySession(sessionID); err != nil {
+			return nil, fmt.Errorf("failed to get tool calls: %w", err)
+		}
+	}
+	if s, ok := sh.store.(interface {
+		GetOpenedFilesBySession(string) ([]*OpenedFile, error)
+	}); ok {
+		if doc.OpenedFiles, err = s.GetOpenedFilesBySession(sessionID); err != nil {
+			return nil, fmt.Errorf("failed to get opened files: %w", err)
+		}
+	}
+	if s, ok := sh.store.(interface {
+		GetSummarizationLogsBySession(string) ([]*SummarizationLog, error)
+	}); ok {
+		if doc.SummarizationLogs, err = s.GetSummarizationLogsBySession(sessionID); err != nil {
+			return nil, fmt.Errorf("failed to get summarization logs: %w", err)
+		}
+	}
+	return doc, nil
+}
+
+// ImportSession writes an exported session and its records into the handler's store.
+// The session keeps its ID unless that ID is taken or the owner changes; then it gets the
+// owner's next session ID, every record ID derived from the old one is rewritten and the
+// tool call IDs (a store-wide key) are prefixed with the new session ID.
+func (sh *SessionHandler) ImportSession(doc *SessionExport, opts ImportOptions) (*Session, error) {
+	if doc == nil || doc.Session == nil {
+		return nil, fmt.Errorf("export has no session")
+	}
+	if doc.Version > SessionExportVersion {
+		return nil, fmt.Errorf("unsupported export version %d", doc.Version)
+	}
+
+	session := doc.Session
+	oldID := session.SessionID
+	userID := session.UserID
+	if opts.UserID != "" {
+		userID = opts.UserID
+	}
+
+	newID := oldID
+	if _, err := sh.store.Get(oldID); err == nil || userID != session.UserID {
+		seq, err := sh.store.GetNextSessionSeq(userID, session.AgentType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next session seq: %w", err)
+		}
+		newID = GenerateSessionID(userID, session.AgentType, seq)
+		if _, err := sh.store.Get(newID); err == nil {
+			return nil, fmt.Errorf("session %s already exists", newID)
+		}
+	}
+	remap := func(id string) string {
+		if newID != oldID && strings.HasPrefix(id, oldID) {
+			return newID + strings.TrimPrefix(id, oldID)
+		}
+		return id
+	}
+	remapCall := func(id string) string {
+		if newID == oldID || id == "" {
+			return id
+		}
+		if strings.HasPrefix(id, oldID+"-") {
+			return remap(id)
+		}
+		return newID + "-" + id
+	}
+	for _, msgs := range [][]openai.ChatCompletionMessage{session.Msgs, session.ArchivedMsgs} {
+		for i := range msgs {
+			msgs[i].ToolCallID = remapCall(msgs[i].ToolCallID)
+			for j := range msgs[i].ToolCalls {
+				msgs[i].ToolCalls[j].ID = remapCall(msgs[i].ToolCalls[j].ID)
+			}
+		}
+	}
+
+	session.SessionID = newID
+	session.UserID = userID
+	if err := sh.store.Put(session); err != nil {
+		return nil, fmt.Errorf("failed to store session: %w", err)
+	}
+
+	if s, ok := sh.store.(interface{ PutMessage(*Message) error }); ok {
+		for _, m := range doc.Messages {
+			m.MessageID, m.SessionID, m.UserID = remap(m.MessageID), newID, userID
+			if err := s.PutMessage(m); err != nil {
+				return nil, fmt.Errorf("failed to store message %s: %w", m.MessageID, err)
+			}
+		}
+	}
+	if s, ok := sh.store.(interface{ PutToolCall(*ToolCall) error }); ok {
+		for _, tc := range doc.ToolCalls {
+			tc.ToolID, tc.MessageID, tc.SessionID, tc.UserID = remap(tc.ToolID), remap(tc.MessageID), newID, userID
+			tc.ToolCallID = remapCall(tc.ToolCallID)
+			if err := s.PutToolCall(tc); err != nil {
+				return nil, fmt.Errorf("failed to store tool call %s: %w", tc.ToolID, err)
+			}
+		}
+	}
+	if s, ok := sh.store.(interface{ AddOpenedFile(*OpenedFile) error }); ok {
+		for _, f := range doc.OpenedFiles {
+			f.FileID, f.SessionID, f.UserID = remap(f.FileID), newID, userID
+			if err := s.AddOpenedFile(f); err != nil {
+				return nil, fmt.Errorf("failed to store opened file %s: %w", f.FileID, err)
+			}
+		}
+	}
+	if s, ok := sh.store.(interface {
+		PutSummarizationLog(*SummarizationLog) error
+	}); ok {
+		for _, l := range doc.SummarizationLogs {
+			l.LogID, l.SessionID, l.UserID = remap(l.LogID), newID, userID
+			if err := s.PutSummarizationLog(l); err != nil {
+				return nil, fmt.Errorf("failed to store summarization log %s: %w", l.LogID, err)
+			}
+		}
+	}
+
+	sh.mu.Lock()
+	sh.userIndex[userID] = append(sh.userIndex[userID], newID)
+	sh.mu.Unlock()
+
+	if !sh.config.DisableLogs {
+		log.Log.Info("[SessionHandler] 📥 Imported session",
+			"session_id", newID, "from", oldID, "user_id", userID, "messages", len(doc.Messages), "tool_calls", len(doc.ToolCalls))
+	}
+	return session, nil
+}
@@ -34,6 +34,13 @@ type SessionHandlerConfig struct {
 	SummaryModel           string // LLM model for summarization (default: gpt-4o-mini)
 	SummaryMaxTokens       int    // Max tokens for summary (default: 200)
 	DisableLogs            bool   // If true, SessionHandler does not emit any logs
+	// MaxSessionMessages is a hard cap on a session's Msgs, enforced when AddMessage saves it:
+	// the oldest turns are moved to ArchivedMsgs (see Session.CapMessages). Unlike
+	// AutoSummarizeThreshold it needs no LLM call. 0 means no limit.
+	MaxSessionMessages int
+	// Namespace the handler's sessions belong to (default: the store's namespace, if it has one).
+	// The store applies the isolation; the handler uses it to keep per-session locks apart.
+	Namespace string
 }
 
 // DefaultSessionHandlerConfig returns default configuration
@@ -55,11 +62,15 @@ type SessionHandler struct {
 	// In-memory index for quick lookups
 	userIndex map[string][]string // userID -> []sessionID
 	mu        sync.RWMutex
+}
 
-	// Per-session locks to prevent race conditions during summarization
-	sessionLocks   map[string]*sync.Mutex
+// Per-session locks to prevent race conditions during summarization.
+// They are process-wide (not per handler) because Engine, the scheduler and the
+// debug UI each create their own SessionHandler over the same store.
+var (
+	sessionLocks   = make(map[string]*sync.Mutex)
 	sessionLocksMu sync.Mutex
-}
+)
 
 // GetStore returns the underlying SessionStore for direct access
 func (sh *SessionHandler) GetStore() SessionStore {
@@ -77,26 +88,40 @@ func NewSessionHandler(store SessionStore, config SessionHandlerConfig) *Session
 	if config.SummaryMaxTokens <= 0 {
 		config.SummaryMaxTokens = 200
 	}
+	if config.Namespace == "" {
+		if namespaced, ok := store.(interface{ Namespace() string }); ok {
+			config.Namespace = namespaced.Namespace()
+		}
+	}
 
 	return &SessionHandler{
-		store:        store,
-		config:       config,
-		userIndex:    make(map[string][]string),
-		sessionLocks: make(map[string]*sync.Mutex),
+		store:     store,
+		config:    config,
+		userIndex: make(map[string][]string),
 	}
 }
 
+// Namespace returns the namespace the handler's sessions belong to ("" if none)
+func (sh *SessionHandler) Namespace() string {
+	return sh.config.Namespace
+}
+
 // getSessionLock returns the mutex for a specific session (creates one if not exists)
 func (sh *SessionHandler) getSessionLock(sessionID string) *sync.Mutex {
-	sh.sessionLocksMu.Lock()
-	defer sh.sessionLocksMu.Unlock()
+	sessionLocksMu.Lock()
+	defer sessionLocksMu.Unlock()
+
+	// Session IDs repeat across namespaces, so the lock is keyed by both
+	if sh.config.Namespace != "" {
+		sessionID = sh.config.Namespace + ":" + sessionID
+	}
 
-	if lock, exists := sh.sessionLocks[sessionID]; exists {
+	if lock, exists := sessionLocks[sessionID]; exists {
 		return lock
 	}
 
 	lock := &sync.Mutex{}
-	sh.sessionLocks[sessionID] = lock
+	sessionLocks[sessionID] = lock
 	return lock
 }
 
@@ -143,9 +168,9 @@ func (sh *SessionHandler) CreateSession(userID string, agentType AgentType) (*Se
 	sh.mu.Unlock()
 
 	if !sh.config.DisableLogs {
-		log.Log.Infof("[SessionHandler] ✅ Created new session | UserID: %s | SessionID: %s | AgentType: %s", userID, session.SessionID, agentType)
+		log.Log.Info("[SessionHandler] ✅ Created new session", "user_id", userID, "session_id", session.SessionID, "agent_type", agentType)
 		allSessions, _ := sh.store.List(userID)
-		log.Log.Infof("[SessionHandler] 📊 Total sessions for user %s: %d", userID, len(allSessions))
+		log.Log.Info("[SessionHandler] 📊 Total sessions for user", "user_id", userID, "total", len(allSessions))
 	}
 
 	return session, nil
@@ -178,17 +203,17 @@ func (sh *SessionHandler) CreateSessionForUser(user *User, agentType AgentType)
 	}); ok {
 		if err := userStore.PutUser(user); err != nil {
 			if !sh.config.DisableLogs {
-				log.Log.Warnf("[SessionHandler] ⚠️  Failed to save user with active session | UserID: %s | Error: %v", user.UserID, err)
+				log.Log.Warn("[SessionHandler] ⚠️  Failed to save user with active session", "user_id", user.UserID, "error", err)
 			}
 		} else if !sh.config.DisableLogs {
-			log.Log.Infof("[SessionHandler] 📌 Set active session | UserID: %s | AgentType: %s | SessionID: %s", user.UserID, agentType, session.SessionID)
+			log.Log.Info("[SessionHandler] 📌 Set active session", "user_id", user.UserID, "agent_type", agentType, "session_id", session.SessionID)
 		}
 	}
 
 	if !sh.config.DisableLogs {
-		log.Log.Infof("[SessionHandler] ✅ Created new session | UserID: %s | SessionID: %s | AgentType: %s", user.UserID, session.SessionID, agentType)
+		log.Log.Info("[SessionHandler] ✅ Created new session", "user_id", user.UserID, "session_id", session.SessionID, "agent_type", agentType)
 		allSessions, _ := sh.store.List(user.UserID)
-		log.Log.Infof("[SessionHandler] 📊 Total sessions for user %s: %d", user.UserID, len(allSessions))
+		log.Log.Info("[SessionHandler] 📊 Total sessions for user", "user_id", user.UserID, "total", len(allSessions))
 	}
 
 	return session, nil
@@ -199,13 +224,13 @@ func (sh *SessionHandler) GetSession(sessionID string) (*Session, error) {
 	session, err := sh.store.Get(sessionID)
 	if err != nil {
 		if !sh.config.DisableLogs {
-			log.Log.Warnf("[SessionHandler] ⚠️  Session not found | SessionID: %s | Error: %v", sessionID, err)
+			log.Log.Warn("[SessionHandler] ⚠️  Session not found", "session_id", sessionID, "error", err)
 		}
 		return nil, err
 	}
 	if !sh.config.DisableLogs {
-		log.Log.Infof("[SessionHandler] 🔍 Retrieved session | SessionID: %s | UserID: %s | AgentType: %s | Title: %s",
-			sessionID, session.UserID, session.AgentType, getSessionTitle(session))
+		log.Log.Info("[SessionHandler] 🔍 Retrieved session",
+			"session_id", sessionID, "user_id", session.UserID, "agent_type", session.AgentType, "title", getSessionTitle(session))
 	}
 	return session, nil
 }
@@ -218,18 +243,50 @@ func getSessionTitle(s *Session) string {
 	return "Untitled"
 }
 
-// ListUserSessions returns all sessions for a user
-func (sh *SessionHandler) ListUserSessions(userID string) ([]*Session, error) {
+// ListSessionsOption modifies which sessions ListUserSessions, ListUserSessionsByType and GetSessionsPrompt return.
+type ListSessionsOption func(*listSessionsOptions)
+
+type listSessionsOptions struct {
+	includeArchived bool
+}
+
+// OptIncludeArchived includes archived sessions, which are left out by default.
+func OptIncludeArchived() ListSessionsOption {
+	return func(o *listSessionsOptions) { o.includeArchived = true }
+}
+
+// listSessions returns the user's sessions, without archived ones unless OptIncludeArchived is given
+func (sh *SessionHandler) listSessions(userID string, opts []ListSessionsOption) ([]*Session, error) {
+	var o listSessionsOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	sessions, err := sh.store.List(userID)
+	if err != nil || o.includeArchived {
+		return sessions, err
+	}
+	visible := sessions[:0]
+	for _, s := range sessions {
+		if !s.Archived {
+			visible = append(visible, s)
+		}
+	}
+	return visible, nil
+}
+
+// ListUserSessions returns all non-archived sessions for a user (see OptIncludeArchived)
+func (sh *SessionHandler) ListUserSessions(userID string, opts ...ListSessionsOption) ([]*Session, error) {
+	sessions, err := sh.listSessions(userID, opts)
 	if err != nil {
 		if !sh.config.DisableLogs {
-			log.Log.Errorf("[SessionHandler] ❌ Failed to list sessions | UserID: %s | Error: %v", userID, err)
+			log.Log.Error("[SessionHandler] ❌ Failed to list sessions", "user_id", userID, "error", err)
 		}
 		return nil, err
 	}
 
 	if !sh.config.DisableLogs {
-		log.Log.Infof("[SessionHandler] 📋 Listing sessions | UserID: %s | Total: %d", userID, len(sessions))
+		log.Log.Info("[SessionHandler] 📋 Listing sessions", "user_id", userID, "total", len(sessions))
 	}
 
 	// Group by agent type for better visibility
@@ -250,25 +307,68 @@ func (sh *SessionHandler) ListUserSessions(userID string) ([]*Session, error) {
 				title = "Untitled"
 			}
 			timeAgo := formatTimeAgo(s.UpdatedAt)
-			log.Log.Infof("[SessionHandler]   ├─ [%s] %s | Title: \"%s\" | Active: %d msgs | Archived: %d msgs | Last: %s",
-				s.SessionID, agentTypeDisplayName(s.AgentType), title, activeMsgs, archivedMsgs, timeAgo)
+			log.Log.Info("[SessionHandler]   ├─ Session", "session_id", s.SessionID, "agent_type", agentTypeDisplayName(s.AgentType),
+				"title", title, "active_msgs", activeMsgs, "archived_msgs", archivedMsgs, "last", timeAgo)
 		}
 	}
 
 	if !sh.config.DisableLogs {
 		for agentType, count := range byType {
-			log.Log.Infof("[SessionHandler]   └─ %s sessions: %d", agentTypeDisplayName(agentType), count)
+			log.Log.Info("[SessionHandler]   └─ Sessions", "agent_type", agentTypeDisplayName(agentType), "count", count)
 		}
-		log.Log.Infof("[SessionHandler] 📊 Sessions Summary | Total: %d | Active messages: %d | Archived messages: %d",
-			len(sessions), totalActiveMessages, totalArchivedMessages)
+		log.Log.Info("[SessionHandler] 📊 Sessions Summary",
+			"total", len(sessions), "active_messages", totalActiveMessages, "archived_messages", totalArchivedMessages)
 	}
 
 	return sessions, nil
 }
 
-// ListUserSessionsByType returns sessions for a user filtered by agent type
-func (sh *SessionHandler) ListUserSessionsByType(userID string, agentType AgentType) ([]*Session, error) {
-	allSessions, err := sh.store.List(userID)
+// FindSessionsByTags returns the non-archived sessions of a user carrying any of tags (every one of
+// them when matchAll is set), most recently updated first (see OptIncludeArchived). The store's tag
+// index is used when it implements SessionTagStore; otherwise the user's sessions are filtered.
+func (sh *SessionHandler) FindSessionsByTags(userID string, tags []string, matchAll bool, opts ...ListSessionsOption) ([]*Session, error) {
+	tags = NormalizeTags(tags)
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("at least one tag is required")
+	}
+	var o listSessionsOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var sessions []*Session
+	if tagStore, ok := sh.store.(SessionTagStore); ok {
+		found, err := tagStore.FindSessionsByTags(userID, tags, matchAll)
+		if err != nil {
+			return nil, err
+		}
+		sessions = found
+	} else {
+		all, err := sh.store.List(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range all {
+			if s.MatchesTags(tags, matchAll) {
+				sessions = append(sessions, s)
+			}
+		}
+	}
+	if o.includeArchived {
+		return sessions, nil
+	}
+	visible := sessions[:0]
+	for _, s := range sessions {
+		if !s.Archived {
+			visible = append(visible, s)
+		}
+	}
+	return visible, nil
+}
+
+// ListUserSessionsByType returns non-archived sessions for a user filtered by agent type (see OptIncludeArchived)
+func (sh *SessionHandler) ListUserSessionsByType(userID string, agentType AgentType, opts ...ListSessionsOption) ([]*Session, error) {
+	allSessions, err := sh.listSessions(userID, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -281,8 +381,8 @@ func (sh *SessionHandler) ListUserSessionsByType(userID string, agentType AgentT
 	}
 
 	if !sh.config.DisableLogs {
-		log.Log.Infof("[SessionHandler] 🔎 Filtered sessions | UserID: %s | AgentType: %s | Found: %d (out of %d total)",
-			userID, agentType, len(filtered), len(allSessions))
+		log.Log.Info("[SessionHandler] 🔎 Filtered sessions",
+			"user_id", userID, "agent_type", agentType, "found", len(filtered), "total", len(allSessions))
 	}
 
 	return filtered, nil
@@ -307,8 +407,77 @@ func (sh *SessionHandler) DeleteSession(sessionID string) error {
 	}
 	sh.mu.Unlock()
 
+	sh.clearActiveSessionRef(session)
+
+	return sh.store.Delete(sessionID)
+}
+
+// ArchiveSession hides a session from session lists, the sessions prompt and core routing
+// without deleting it. If it was the user's active session for its agent type, the reference
+// is cleared so the next message starts (or picks) another session.
+func (sh *SessionHandler) ArchiveSession(sessionID string) error {
+	session, err := sh.store.Get(sessionID)
+	if err != nil {
+		return err
+	}
+	if session.Archived {
+		return nil
+	}
+
+	session.Archived = true
+	session.ArchivedAt = time.Now()
+	if err := sh.store.Put(session); err != nil {
+		return err
+	}
+	sh.clearActiveSessionRef(session)
+
+	if !sh.config.DisableLogs {
+		log.Log.Info("[SessionHandler] 📦 Session archived",
+			"session_id", sessionID, "user_id", session.UserID, "agent_type", session.AgentType)
+	}
+	return nil
+}
+
+// UnarchiveSession makes an archived session visible again.
+// A core session can only be unarchived while the user has no other active core session.
+func (sh *SessionHandler) UnarchiveSession(sessionID string) error {
+	session, err := sh.store.Get(sessionID)
+	if err != nil {
+		return err
+	}
+	if !session.Archived {
+		return nil
+	}
+
+	if session.AgentType == AgentTypeCore {
+		if coreStore, ok := sh.store.(interface {
+			GetCoreSession(string) (*Session, error)
+		}); ok {
+			if current, err := coreStore.GetCoreSession(session.UserID); err == nil && current != nil && current.SessionID != sessionID {
+				return fmt.Errorf("user %s already has an active core session (%s); archive it first", session.UserID, current.SessionID)
+			}
+		}
+	}
+
+	session.Archived = false
+	session.ArchivedAt = time.Time{}
+	if err := sh.store.Put(session); err != nil {
+		return err
+	}
+
+	if !sh.config.DisableLogs {
+		log.Log.Info("[SessionHandler] 📤 Session unarchived",
+			"session_id", sessionID, "user_id", session.UserID, "agent_type", session.AgentType)
+	}
+	return nil
+}
+
+// clearActiveSessionRef clears the user's active session reference if it points to session
+func (sh *SessionHandler) clearActiveSessionRef(session *Session) {
+	sessionID := session.SessionID
+
 	// Clean up active session reference in user if this session was active
-	// This prevents stale references when a session is deleted
+	// This prevents stale references when a session is deleted or archived
 	// Note: We check all agent types (Core, High, Low) to ensure no stale references
 	if session.AgentType == AgentTypeCore || session.AgentType == AgentTypeHigh || session.AgentType == AgentTypeLow {
 		if userStore, ok := sh.store.(interface {
@@ -321,15 +490,13 @@ func (sh *SessionHandler) DeleteSession(sessionID string) error {
 					user.SetActiveSessionID(session.AgentType, "") // Clear the reference
 					_ = userStore.PutUser(user)                    // Best effort save
 					if !sh.config.DisableLogs {
-						log.Log.Infof("[SessionHandler] 🧹 Cleared active session reference | UserID: %s | AgentType: %s | SessionID: %s",
-							session.UserID, session.AgentType, sessionID)
+						log.Log.Info("[SessionHandler] 🧹 Cleared active session reference",
+							"user_id", session.UserID, "agent_type", session.AgentType, "session_id", sessionID)
 					}
 				}
 			}
 		}
 	}
-
-	return sh.store.Delete(sessionID)
 }
 
 // UpdateSessionMetadata updates the title, tags, and summary of a session
@@ -365,6 +532,7 @@ func (sh *SessionHandler) AddMessage(ctx context.Context, sessionID string, msg
 	}
 
 	session.Msgs = append(session.Msgs, msg)
+	session.CapMessages(sh.config.MaxSessionMessages)
 	session.UpdatedAt = time.Now()
 
 	if err := sh.store.Put(session); err != nil {
@@ -386,8 +554,23 @@ func (sh *SessionHandler) AddMessage(ctx context.Context, sessionID string, msg
 
 // SummarizeSession generates a summary of the conversation and archives messages
 func (sh *SessionHandler) SummarizeSession(ctx context.Context, sessionID string) error {
+	_, err := sh.summarize(ctx, sessionID, "auto")
+	return err
+}
+
+// SummarizeNow summarizes a session immediately, regardless of scheduler thresholds
+// (e.g. when an operator triggers it from the debug UI). It takes the same session lock
+// as auto-summarization, so the two never run concurrently on one session.
+// The returned log describes the outcome; it is nil only if the session could not be loaded
+// or has no messages to summarize.
+func (sh *SessionHandler) SummarizeNow(ctx context.Context, sessionID string) (*SummarizationLog, error) {
+	return sh.summarize(ctx, sessionID, "manual")
+}
+
+// summarize runs the summarizer for a session under its lock and records a SummarizationLog
+func (sh *SessionHandler) summarize(ctx context.Context, sessionID string, summarizationType string) (*SummarizationLog, error) {
 	if sh.llmClient == nil {
-		return fmt.Errorf("LLM client not configured")
+		return nil, fmt.Errorf("LLM client not configured")
 	}
 
 	// Lock the session to prevent race conditions
@@ -396,12 +579,12 @@ func (sh *SessionHandler) SummarizeSession(ctx context.Context, sessionID string
 
 	session, err := sh.store.Get(sessionID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Skip if no messages to summarize
 	if len(session.Msgs) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	// Format messages for summarization
@@ -415,6 +598,13 @@ func (sh *SessionHandler) SummarizeSession(ctx context.Context, sessionID string
 	// Create log entry before making the request
 	summLog := NewSummarizationLog(session)
 	summLog.ModelUsed = sh.config.SummaryModel
+	summLog.RequestedModel = sh.config.SummaryModel
+	summLog.SummarizationType = summarizationType
+	summLog.SessionTitle = session.Title
+	summLog.PreviousSummary = session.Summary
+	summLog.PreviousTags = strings.Join(session.Tags, ", ")
+	summLog.MessagesBeforeCount = len(session.Msgs)
+	summLog.ArchivedMessagesCount = len(session.ArchivedMsgs)
 	summLog.Status = "pending"
 	// PromptSent will be set in generateConversationSummary with full prompt
 
@@ -423,27 +613,23 @@ func (sh *SessionHandler) SummarizeSession(ctx context.Context, sessionID string
 	}); ok {
 		if err := debugStore.PutSummarizationLog(summLog); err != nil {
 			if !sh.config.DisableLogs {
-				log.Log.Warnf("[SessionHandler] ⚠️  Failed to save summarization log: %v", err)
+				log.Log.Warn("[SessionHandler] ⚠️  Failed to save summarization log", "error", err)
 			}
 		} else if !sh.config.DisableLogs {
-			log.Log.Infof("[SessionHandler] ✅ Saved summarization log (pending) | LogID: %s | SessionID: %s", summLog.LogID, sessionID)
+			log.Log.Info("[SessionHandler] ✅ Saved summarization log (pending)", "log_id", summLog.LogID, "session_id", sessionID)
 		}
 	} else if !sh.config.DisableLogs {
-		log.Log.Warnf("[SessionHandler] ⚠️  Store does not implement PutSummarizationLog, skipping log")
+		log.Log.Warn("[SessionHandler] ⚠️  Store does not implement PutSummarizationLog, skipping log")
 	}
 
 	// Generate summary using LLM
 	summary, err := sh.generateConversationSummary(ctx, conversationText, summLog)
 	if err != nil {
 		// Update log with error
-		summLog.Status = "failed"
+		summLog.MarkCompleted("failed")
 		summLog.ErrorMessage = err.Error()
-		if debugStore, ok := sh.store.(interface {
-			PutSummarizationLog(log *SummarizationLog) error
-		}); ok {
-			_ = debugStore.PutSummarizationLog(summLog)
-		}
-		return fmt.Errorf("failed to generate summary: %w", err)
+		sh.putSummarizationLog(summLog)
+		return summLog, fmt.Errorf("failed to generate summary: %w", err)
 	}
 
 	// Generate title if not set
@@ -451,6 +637,7 @@ func (sh *SessionHandler) SummarizeSession(ctx context.Context, sessionID string
 		title, err := sh.generateSessionTitle(ctx, conversationText)
 		if err == nil {
 			session.Title = title
+			summLog.GeneratedTitle = title
 		}
 	}
 
@@ -461,14 +648,64 @@ func (sh *SessionHandler) SummarizeSession(ctx context.Context, sessionID string
 	session.SummarizedAt = time.Now()
 	session.UpdatedAt = time.Now()
 
-	return sh.store.Put(session)
+	session.SummarizationTokens += summLog.TotalTokens
+
+	summLog.GeneratedSummary = summary
+	summLog.MessagesAfterCount = len(session.Msgs)
+	summLog.ArchivedMessagesCount = len(session.ArchivedMsgs)
+
+	if err := sh.store.Put(session); err != nil {
+		summLog.MarkCompleted("failed")
+		summLog.ErrorMessage = fmt.Sprintf("failed to save session: %v", err)
+		sh.putSummarizationLog(summLog)
+		return summLog, fmt.Errorf("failed to save session: %w", err)
+	}
+
+	summLog.MarkCompleted("success")
+	sh.putSummarizationLog(summLog)
+	return summLog, nil
+}
+
+// SessionTokenUsage is the token spend of a session
+type SessionTokenUsage struct {
+	PromptTokens        int
+	CompletionTokens    int
+	TotalTokens         int // conversation LLM calls (PromptTokens + CompletionTokens)
+	ReasoningTokens     int // part of CompletionTokens spent reasoning
+	SummarizationTokens int // summarizing the session, counted separately
+}
+
+// GetSessionTokenUsage returns the accumulated token usage of a session
+func (sh *SessionHandler) GetSessionTokenUsage(sessionID string) (*SessionTokenUsage, error) {
+	session, err := sh.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionTokenUsage{
+		PromptTokens:        session.TotalPromptTokens,
+		CompletionTokens:    session.TotalCompletionTokens,
+		TotalTokens:         session.TotalTokens,
+		ReasoningTokens:     session.TotalReasoningTokens,
+		SummarizationTokens: session.SummarizationTokens,
+	}, nil
+}
+
+// putSummarizationLog saves the log if the store supports it
+func (sh *SessionHandler) putSummarizationLog(summLog *SummarizationLog) {
+	if debugStore, ok := sh.store.(interface {
+		PutSummarizationLog(log *SummarizationLog) error
+	}); ok {
+		if err := debugStore.PutSummarizationLog(summLog); err != nil && !sh.config.DisableLogs {
+			log.Log.Warn("[SessionHandler] ⚠️  Failed to update summarization log", "error", err)
+		}
+	}
 }
 
-// GetSessionsPrompt generates a formatted prompt showing all user sessions
+// GetSessionsPrompt generates a formatted prompt showing all non-archived user sessions (see OptIncludeArchived)
 // This is used by CoreHandler to understand the user's session history
 // Note: Only uses Summary, Tags, and Msgs from sessions. ExMsgs is only for debug purposes and is not used here.
-func (sh *SessionHandler) GetSessionsPrompt(userID string) (string, error) {
-	sessions, err := sh.store.List(userID)
+func (sh *SessionHandler) GetSessionsPrompt(userID string, opts ...ListSessionsOption) (string, error) {
+	sessions, err := sh.listSessions(userID, opts)
 	if err != nil {
 		return "", err
 	}
@@ -527,6 +764,26 @@ func (sh *SessionHandler) GetSessionsPrompt(userID string) (string, error) {
 	return sb.String(), nil
 }
 
+// GetTaggedSessionsPrompt formats the non-archived sessions FindSessionsByTags returns, most recently
+// updated first, for the Core's find_sessions tool
+func (sh *SessionHandler) GetTaggedSessionsPrompt(userID string, tags []string, matchAll bool) (string, error) {
+	sessions, err := sh.FindSessionsByTags(userID, tags, matchAll)
+	if err != nil {
+		return "", err
+	}
+	tags = NormalizeTags(tags)
+	if len(sessions) == 0 {
+		return fmt.Sprintf("No sessions tagged %s.", strings.Join(tags, ", ")), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("## Sessions tagged %s\n\n", strings.Join(tags, ", ")))
+	for i, s := range sessions {
+		sh.formatSessionEntry(&sb, i+1, s)
+	}
+	return sb.String(), nil
+}
+
 // formatSessionEntry formats a single session entry for the prompt
 func (sh *SessionHandler) formatSessionEntry(sb *strings.Builder, index int, s *Session) {
 	title := s.Title
@@ -539,6 +796,10 @@ func (sh *SessionHandler) formatSessionEntry(sb *strings.Builder, index int, s *
 
 	sb.WriteString(fmt.Sprintf("%d. [%s] \"%s\" - Last: %s\n", index, s.SessionID, title, timeAgo))
 
+	if s.Archived {
+		sb.WriteString("   Archived\n")
+	}
+
 	if s.Summary != "" {
 		sb.WriteString(fmt.Sprintf("   Summary: %s\n", s.Summary))
 	}
@@ -606,10 +867,11 @@ Example: "Debugged Kubernetes pod restart issue. Found memory limits too low. Ap
 	}); ok {
 		if err := debugStore.PutSummarizationLog(summLog); err != nil {
 			if !sh.config.DisableLogs {
-				log.Log.Warnf("[SessionHandler] ⚠️  Failed to update summarization log: %v", err)
+				log.Log.Warn("[SessionHandler] ⚠️  Failed to update summarization log", "error", err)
 			}
 		} else if !sh.config.DisableLogs {
-			log.Log.Infof("[SessionHandler] ✅ Updated summarization log (success) | LogID: %s | SessionID: %s | Tokens: %d", summLog.LogID, summLog.SessionID, summLog.TotalTokens)
+			log.Log.Info("[SessionHandler] ✅ Updated summarization log (success)",
+				"log_id", summLog.LogID, "session_id", summLog.SessionID, "tokens", summLog.TotalTokens)
 		}
 	}
 
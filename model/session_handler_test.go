@@ -0,0 +1,235 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// memorySessionStore is a minimal in-memory SessionStore for tests
+type memorySessionStore struct {
+	sessions map[string]*Session
+	logs     []*SummarizationLog
+}
+
+func (m *memorySessionStore) Get(id string) (*Session, error) {
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("session not found: %s", id)
+	}
+	return s, nil
+}
+func (m *memorySessionStore) Put(s *Session) error   { m.sessions[s.SessionID] = s; return nil }
+func (m *memorySessionStore) Delete(id string) error { delete(m.sessions, id); return nil }
+func (m *memorySessionStore) List(userID string) ([]*Session, error) {
+	var sessions []*Session
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+func (m *memorySessionStore) GetNextSessionSeq(string, AgentType) (int, error) {
+	return 1, nil
+}
+func (m *memorySessionStore) PutSummarizationLog(l *SummarizationLog) error {
+	m.logs = append(m.logs, l)
+	return nil
+}
+
+// fakeLLMClient returns a fixed completion
+type fakeLLMClient struct {
+	content string
+	usage   openai.Usage
+}
+
+func (f fakeLLMClient) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: f.content}}},
+		Usage:   f.usage,
+	}, nil
+}
+
+func TestSessionHandlerSummarizeNow(t *testing.T) {
+	store := &memorySessionStore{sessions: map[string]*Session{
+		"u1-high-s0001": {
+			SessionID: "u1-high-s0001",
+			UserID:    "u1",
+			AgentType: AgentTypeHigh,
+			Title:     "Existing",
+			Msgs: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "hello"},
+				{Role: openai.ChatMessageRoleAssistant, Content: "hi there"},
+			},
+		},
+	}}
+	sh := NewSessionHandler(store, DefaultSessionHandlerConfig())
+	sh.SetLLMClient(fakeLLMClient{content: "Greeting exchanged."})
+
+	summLog, err := sh.SummarizeNow(context.Background(), "u1-high-s0001")
+	if err != nil {
+		t.Fatalf("SummarizeNow failed: %v", err)
+	}
+	if summLog == nil || summLog.Status != "success" || summLog.SummarizationType != "manual" {
+		t.Fatalf("Unexpected log: %+v", summLog)
+	}
+	if summLog.MessagesBeforeCount != 2 || summLog.ArchivedMessagesCount != 2 {
+		t.Errorf("Unexpected message counts in log: before=%d archived=%d", summLog.MessagesBeforeCount, summLog.ArchivedMessagesCount)
+	}
+
+	session := store.sessions["u1-high-s0001"]
+	if len(session.Msgs) != 0 || len(session.ArchivedMsgs) != 2 || session.Summary != "Greeting exchanged." {
+		t.Errorf("Session not updated: msgs=%d archived=%d summary=%q", len(session.Msgs), len(session.ArchivedMsgs), session.Summary)
+	}
+	if len(store.logs) == 0 || store.logs[len(store.logs)-1].Status != "success" {
+		t.Errorf("Expected final summarization log to be persisted with success status")
+	}
+
+	// Nothing left to summarize
+	summLog, err = sh.SummarizeNow(context.Background(), "u1-high-s0001")
+	if err != nil || summLog != nil {
+		t.Errorf("Expected no-op for empty session, got log=%v err=%v", summLog, err)
+	}
+}
+
+func TestSessionHandlerTokenUsage(t *testing.T) {
+	session := &Session{
+		SessionID: "u1-high-s0001",
+		UserID:    "u1",
+		AgentType: AgentTypeHigh,
+		Title:     "Existing",
+		Msgs:      []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+	}
+	session.AddTokenUsage(openai.Usage{PromptTokens: 80, CompletionTokens: 20, TotalTokens: 100})
+	session.AddTokenUsage(openai.Usage{PromptTokens: 150, CompletionTokens: 30, TotalTokens: 180})
+	store := &memorySessionStore{sessions: map[string]*Session{session.SessionID: session}}
+	sh := NewSessionHandler(store, DefaultSessionHandlerConfig())
+	sh.SetLLMClient(fakeLLMClient{content: "Greeting.", usage: openai.Usage{PromptTokens: 40, CompletionTokens: 10, TotalTokens: 50}})
+
+	// Summarization tokens are counted separately from the conversation
+	if _, err := sh.SummarizeNow(context.Background(), session.SessionID); err != nil {
+		t.Fatalf("SummarizeNow failed: %v", err)
+	}
+	usage, err := sh.GetSessionTokenUsage(session.SessionID)
+	if err != nil {
+		t.Fatalf("GetSessionTokenUsage failed: %v", err)
+	}
+	want := SessionTokenUsage{PromptTokens: 230, CompletionTokens: 50, TotalTokens: 280, SummarizationTokens: 50}
+	if *usage != want {
+		t.Errorf("GetSessionTokenUsage() = %+v, want %+v", *usage, want)
+	}
+}
+
+func TestSessionHandlerArchiveSession(t *testing.T) {
+	store := &memorySessionStore{sessions: map[string]*Session{
+		"u1-high-s0001": {SessionID: "u1-high-s0001", UserID: "u1", AgentType: AgentTypeHigh, Title: "Old trip"},
+		"u1-high-s0002": {SessionID: "u1-high-s0002", UserID: "u1", AgentType: AgentTypeHigh, Title: "Current"},
+	}}
+	config := DefaultSessionHandlerConfig()
+	config.DisableLogs = true
+	sh := NewSessionHandler(store, config)
+
+	if err := sh.ArchiveSession("u1-high-s0001"); err != nil {
+		t.Fatalf("ArchiveSession failed: %v", err)
+	}
+	if s := store.sessions["u1-high-s0001"]; !s.Archived || s.ArchivedAt.IsZero() {
+		t.Fatalf("session not marked archived: %+v", s)
+	}
+
+	sessions, err := sh.ListUserSessions("u1")
+	if err != nil || len(sessions) != 1 || sessions[0].SessionID != "u1-high-s0002" {
+		t.Fatalf("ListUserSessions = %v, %v; want only the active session", sessions, err)
+	}
+	if sessions, _ := sh.ListUserSessions("u1", OptIncludeArchived()); len(sessions) != 2 {
+		t.Errorf("ListUserSessions with OptIncludeArchived returned %d sessions, want 2", len(sessions))
+	}
+	if prompt, _ := sh.GetSessionsPrompt("u1"); strings.Contains(prompt, "Old trip") {
+		t.Errorf("sessions prompt includes the archived session:\n%s", prompt)
+	}
+
+	if err := sh.UnarchiveSession("u1-high-s0001"); err != nil {
+		t.Fatalf("UnarchiveSession failed: %v", err)
+	}
+	if sessions, _ := sh.ListUserSessions("u1"); len(sessions) != 2 {
+		t.Errorf("ListUserSessions after unarchive returned %d sessions, want 2", len(sessions))
+	}
+}
+
+func TestSessionHandlerFindSessionsByTags(t *testing.T) {
+	store := &memorySessionStore{sessions: map[string]*Session{
+		"u1-high-s0001": {SessionID: "u1-high-s0001", UserID: "u1", AgentType: AgentTypeHigh, Title: "Berlin trip", Tags: []string{"Travel", "berlin"}},
+		"u1-high-s0002": {SessionID: "u1-high-s0002", UserID: "u1", AgentType: AgentTypeHigh, Title: "Paris trip", Tags: []string{"travel", "paris"}},
+		"u1-high-s0003": {SessionID: "u1-high-s0003", UserID: "u1", AgentType: AgentTypeHigh, Title: "Old Berlin", Tags: []string{"berlin"}, Archived: true},
+		"u2-high-s0001": {SessionID: "u2-high-s0001", UserID: "u2", AgentType: AgentTypeHigh, Tags: []string{"berlin"}},
+	}}
+	sh := NewSessionHandler(store, DefaultSessionHandlerConfig())
+
+	sessions, err := sh.FindSessionsByTags("u1", []string{" BERLIN ", "paris"}, false)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("FindSessionsByTags(any) = %d sessions, %v; want 2", len(sessions), err)
+	}
+	sessions, _ = sh.FindSessionsByTags("u1", []string{"travel", "berlin"}, true)
+	if len(sessions) != 1 || sessions[0].SessionID != "u1-high-s0001" {
+		t.Errorf("FindSessionsByTags(all) = %v; want only the Berlin trip", sessions)
+	}
+	if sessions, _ = sh.FindSessionsByTags("u1", []string{"berlin"}, false, OptIncludeArchived()); len(sessions) != 2 {
+		t.Errorf("FindSessionsByTags with OptIncludeArchived returned %d sessions, want 2", len(sessions))
+	}
+	if _, err := sh.FindSessionsByTags("u1", []string{" "}, false); err == nil {
+		t.Error("Expected an error without tags")
+	}
+
+	prompt, err := sh.GetTaggedSessionsPrompt("u1", []string{"paris"}, false)
+	if err != nil || !strings.Contains(prompt, "Paris trip") || strings.Contains(prompt, "Berlin") {
+		t.Errorf("Unexpected tagged sessions prompt (err %v):\n%s", err, prompt)
+	}
+}
+
+func TestSessionHandlerMaxSessionMessages(t *testing.T) {
+	store := &memorySessionStore{sessions: map[string]*Session{
+		"u1-high-s0001": {SessionID: "u1-high-s0001", UserID: "u1", Msgs: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "find my order"},
+			{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "c1"}}},
+			{Role: openai.ChatMessageRoleTool, ToolCallID: "c1", Content: "order 42"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "It is order 42."},
+			{Role: openai.ChatMessageRoleUser, Content: "when does it arrive?"},
+		}},
+	}}
+	config := DefaultSessionHandlerConfig()
+	config.MaxSessionMessages = 5
+	sh := NewSessionHandler(store, config)
+
+	// Within the cap: nothing moves
+	session := store.sessions["u1-high-s0001"]
+	if session.CapMessages(config.MaxSessionMessages) != 0 || len(session.Msgs) != 5 {
+		t.Fatalf("Expected no messages moved within the cap, got %d left", len(session.Msgs))
+	}
+
+	// Past the cap the oldest complete turn, tool call and result included, is archived
+	if err := sh.AddMessage(context.Background(), "u1-high-s0001", openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Tomorrow."}); err != nil {
+		t.Fatalf("AddMessage failed: %v", err)
+	}
+	session = store.sessions["u1-high-s0001"]
+	if len(session.Msgs) != 2 || session.Msgs[0].Content != "when does it arrive?" {
+		t.Fatalf("Expected the last turn to be kept, got %+v", session.Msgs)
+	}
+	if len(session.ArchivedMsgs) != 4 || session.ArchivedMsgs[2].ToolCallID != "c1" || session.TrimmedMsgs != 4 {
+		t.Errorf("Expected the first turn archived and pending summary, got %d archived, %d pending", len(session.ArchivedMsgs), session.TrimmedMsgs)
+	}
+
+	// A single turn over the cap loses its oldest messages, never a tool call without its results
+	session = &Session{Msgs: []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "compare both"},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "a"}, {ID: "b"}}},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "a", Content: "A"},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "b", Content: "B"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "A is cheaper."},
+	}}
+	if moved := session.CapMessages(3); moved != 4 || len(session.Msgs) != 1 {
+		t.Errorf("Expected the tool call moved with both results, got %d moved, %+v kept", moved, session.Msgs)
+	}
+}
@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// SessionStats holds aggregate statistics for a single session, computed by the store
+// without loading the session's messages, tool calls or summarization logs
+type SessionStats struct {
+	SessionID string
+
+	// MessagesByRole counts stored messages per role (user, assistant, system, tool)
+	MessagesByRole map[string]int
+	TotalMessages  int
+	TotalTokens    int
+
+	// FirstMessageAt and LastMessageAt are zero when the session has no messages
+	FirstMessageAt time.Time
+	LastMessageAt  time.Time
+
+	ToolCalls      int
+	Summarizations int
+}
+
+// UserStats holds aggregate statistics for a user, computed by the store with aggregate
+// queries instead of loading the user's sessions, messages or files
+type UserStats struct {
+	UserID string
+
+	Sessions         int
+	ArchivedSessions int
+	TotalMessages    int
+	TotalTokens      int
+	ToolCalls        int
+	OpenedFiles      int
+
+	// IsBanned is the current ban status; BanUntil is zero for a permanent ban
+	IsBanned bool
+	BanUntil time.Time
+
+	// LastActiveAt is the latest session update or message (zero when the user has neither)
+	LastActiveAt time.Time
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"sort"
+	"strings"
+)
+
+// SessionTagStore is implemented by stores that index session tags
+type SessionTagStore interface {
+	// FindSessionsByTags returns the sessions of userID carrying any of tags (every one of them
+	// when matchAll is set), most recently updated first. Tags are compared as NormalizeTags does.
+	FindSessionsByTags(userID string, tags []string, matchAll bool) ([]*Session, error)
+}
+
+// NormalizeTags returns tags trimmed, lower-cased, without empty entries and duplicates, sorted
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// MatchesTags reports whether the session carries any of tags (every one of them when matchAll is
+// set). tags must be normalized (see NormalizeTags); an empty list matches every session.
+func (s *Session) MatchesTags(tags []string, matchAll bool) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	own := make(map[string]bool, len(s.Tags))
+	for _, tag := range NormalizeTags(s.Tags) {
+		own[tag] = true
+	}
+	for _, tag := range tags {
+		if own[tag] && !matchAll {
+			return true
+		}
+		if !own[tag] && matchAll {
+			return false
+		}
+	}
+	return matchAll
+}
@@ -0,0 +1,451 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Outcomes of ParseToolArguments, stored as ToolCall.ArgsValidation
+const (
+	ToolArgsValid    = "valid"
+	ToolArgsRepaired = "repaired"
+	ToolArgsInvalid  = "invalid"
+)
+
+// ToolArgsCheck is the result of ParseToolArguments
+type ToolArgsCheck struct {
+	// Args are the parsed (and possibly repaired) arguments; nil when Outcome is ToolArgsInvalid
+	Args map[string]interface{}
+	// Outcome is ToolArgsValid, ToolArgsRepaired or ToolArgsInvalid
+	Outcome string
+	// Repairs describe the fixes applied to the arguments
+	Repairs []string
+	// Problems describe why the arguments are invalid, one per argument
+	Problems []string
+}
+
+// Detail returns the problems of invalid arguments, or the repairs applied, as one line
+func (c *ToolArgsCheck) Detail() string {
+	if c.Outcome == ToolArgsInvalid {
+		return strings.Join(c.Problems, "; ")
+	}
+	return strings.Join(c.Repairs, "; ")
+}
+
+// Err returns a *ToolArgumentsError when the arguments are invalid, nil otherwise
+func (c *ToolArgsCheck) Err(toolName string) error {
+	if c.Outcome != ToolArgsInvalid {
+		return nil
+	}
+	return &ToolArgumentsError{ToolName: toolName, Problems: c.Problems}
+}
+
+// ErrorResult returns the tool result telling the model why its arguments are invalid
+// (see ToolArgumentsError.Result)
+func (c *ToolArgsCheck) ErrorResult(toolName string) string {
+	return (&ToolArgumentsError{ToolName: toolName, Problems: c.Problems}).Result()
+}
+
+// isReservedToolArg reports whether key is an argument the engine adds to every tool call
+// (__user_id__, __session_id__), which tool schemas do not declare
+func isReservedToolArg(key string) bool {
+	return len(key) > 4 && strings.HasPrefix(key, "__") && strings.HasSuffix(key, "__")
+}
+
+// ParseToolArguments parses the JSON arguments of a tool call as the model sent them. Almost-valid
+// JSON is repaired (code fences, trailing commas, single-quoted strings, double-encoded JSON) and,
+// when schema (the tool's input schema) is set, string values are coerced to the number or boolean
+// the schema declares before the arguments are validated against it. Empty arguments are {}.
+func ParseToolArguments(raw string, schema map[string]interface{}) *ToolArgsCheck {
+	check := &ToolArgsCheck{Outcome: ToolArgsValid}
+	invalid := func(problem string) *ToolArgsCheck {
+		check.Outcome = ToolArgsInvalid
+		check.Problems = []string{problem}
+		return check
+	}
+
+	text := strings.TrimSpace(raw)
+	if unfenced, ok := stripCodeFence(text); ok {
+		text = unfenced
+		check.Repairs = append(check.Repairs, "stripped code fence")
+	}
+	if text == "" {
+		text = "{}"
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		repaired, repairs := repairJSON(text)
+		if len(repairs) == 0 || json.Unmarshal([]byte(repaired), &value) != nil {
+			return invalid(fmt.Sprintf("arguments are not valid JSON: %v", err))
+		}
+		check.Repairs = append(check.Repairs, repairs...)
+	}
+	if encoded, ok := value.(string); ok {
+		var decoded map[string]interface{}
+		if json.Unmarshal([]byte(encoded), &decoded) == nil {
+			value = decoded
+			check.Repairs = append(check.Repairs, "decoded double-encoded JSON")
+		}
+	}
+
+	var args map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		args = v
+	case nil:
+		args = map[string]interface{}{}
+	default:
+		return invalid(fmt.Sprintf("arguments must be a JSON object, got %s", describeJSONValue(value)))
+	}
+
+	if schema != nil {
+		check.Repairs = append(check.Repairs, coerceToSchema(schema, args, "")...)
+		if problems := validateAgainstSchema(schema, args, ""); len(problems) > 0 {
+			check.Outcome = ToolArgsInvalid
+			check.Problems = problems
+			return check
+		}
+	}
+	check.Args = args
+	if len(check.Repairs) > 0 {
+		check.Outcome = ToolArgsRepaired
+	}
+	return check
+}
+
+// stripCodeFence returns text without a surrounding markdown code fence (```json ... ```)
+func stripCodeFence(text string) (string, bool) {
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") || len(text) < 6 {
+		return text, false
+	}
+	inner := text[3 : len(text)-3]
+	if newline := strings.IndexByte(inner, '\n'); newline >= 0 && !strings.ContainsAny(inner[:newline], "{[\"") {
+		inner = inner[newline+1:] // language tag
+	}
+	return strings.TrimSpace(inner), true
+}
+
+// repairJSON fixes trailing commas and single-quoted strings outside of string literals and
+// returns the fixed text with the repairs made
+func repairJSON(text string) (string, []string) {
+	var b strings.Builder
+	trailingComma, singleQuotes := false, false
+	var quote byte // quote of the string being copied, 0 outside strings
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			switch {
+			case c == '\\' && i+1 < len(text):
+				if quote == '\'' && text[i+1] == '\'' {
+					b.WriteByte('\'')
+				} else {
+					b.WriteByte(c)
+					b.WriteByte(text[i+1])
+				}
+				i++
+			case c == quote:
+				b.WriteByte('"')
+				quote = 0
+			case c == '"': // a double quote inside a single-quoted string
+				b.WriteString(`\"`)
+			default:
+				b.WriteByte(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			quote = '"'
+			b.WriteByte(c)
+		case '\'':
+			quote = '\''
+			singleQuotes = true
+			b.WriteByte('"')
+		case ',':
+			j := i + 1
+			for j < len(text) && strings.IndexByte(" \t\r\n", text[j]) >= 0 {
+				j++
+			}
+			if j < len(text) && (text[j] == '}' || text[j] == ']') {
+				trailingComma = true
+				continue
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	var repairs []string
+	if trailingComma {
+		repairs = append(repairs, "removed trailing commas")
+	}
+	if singleQuotes {
+		repairs = append(repairs, "replaced single quotes")
+	}
+	return b.String(), repairs
+}
+
+// coerceToSchema converts string values of obj to the number, integer or boolean their property
+// schema declares, when they parse as one, and returns the coercions made
+func coerceToSchema(schema map[string]interface{}, obj map[string]interface{}, path string) []string {
+	properties, _ := schema["properties"].(map[string]interface{})
+	var repairs []string
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		prop, ok := properties[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := joinArgPath(path, key)
+		value, coerced := coerceValue(prop, obj[key])
+		if coerced {
+			obj[key] = value
+			repairs = append(repairs, fmt.Sprintf("coerced argument '%s' to %s", name, schemaTypes(prop)[0]))
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			repairs = append(repairs, coerceToSchema(prop, v, name)...)
+		case []interface{}:
+			items, _ := prop["items"].(map[string]interface{})
+			for i, item := range v {
+				itemName := fmt.Sprintf("%s[%d]", name, i)
+				if coercedItem, ok := coerceValue(items, item); ok {
+					v[i] = coercedItem
+					repairs = append(repairs, fmt.Sprintf("coerced argument '%s' to %s", itemName, schemaTypes(items)[0]))
+				} else if itemObj, ok := item.(map[string]interface{}); ok {
+					repairs = append(repairs, coerceToSchema(items, itemObj, itemName)...)
+				}
+			}
+		}
+	}
+	return repairs
+}
+
+// coerceValue converts a string value to the single scalar type of schema when it parses as one
+func coerceValue(schema map[string]interface{}, value interface{}) (interface{}, bool) {
+	s, ok := value.(string)
+	types := schemaTypes(schema)
+	if !ok || len(types) != 1 {
+		return value, false
+	}
+	s = strings.TrimSpace(s)
+	switch types[0] {
+	case "number":
+		if n, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(n) && !math.IsInf(n, 0) {
+			return n, true
+		}
+	case "integer":
+		if n, err := strconv.ParseFloat(s, 64); err == nil && n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return n, true
+		}
+	case "boolean":
+		if strings.EqualFold(s, "true") || strings.EqualFold(s, "false") {
+			return strings.EqualFold(s, "true"), true
+		}
+	}
+	return value, false
+}
+
+// validateAgainstSchema returns the problems of value, a decoded JSON value, against a JSON Schema
+// (type, enum, properties, required, additionalProperties and items are checked)
+func validateAgainstSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	if len(schema) == 0 {
+		return nil
+	}
+	if enum, ok := toInterfaceSlice(schema["enum"]); ok && !containsJSONValue(enum, value) {
+		return []string{fmt.Sprintf("%s must be one of %s, got %s", describeArgPath(path), describeJSONValue(enum), describeJSONValue(value))}
+	}
+	if types := schemaTypes(schema); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if matchesJSONType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return []string{fmt.Sprintf("%s must be %s, got %s", describeArgPath(path), describeJSONTypes(types), describeJSONValue(value))}
+		}
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		items, _ := schema["items"].(map[string]interface{})
+		var problems []string
+		for i, item := range v {
+			problems = append(problems, validateAgainstSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return problems
+	case map[string]interface{}:
+		return validateObject(schema, v, path)
+	}
+	return nil
+}
+
+// validateObject checks the required, declared and additional properties of obj
+func validateObject(schema map[string]interface{}, obj map[string]interface{}, path string) []string {
+	var problems []string
+	required, _ := toInterfaceSlice(schema["required"])
+	isRequired := make(map[string]bool, len(required))
+	for _, r := range required {
+		key, _ := r.(string)
+		isRequired[key] = true
+		if _, ok := obj[key]; !ok {
+			problems = append(problems, fmt.Sprintf("%s is required", describeArgPath(joinArgPath(path, key))))
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := joinArgPath(path, key)
+		if prop, ok := properties[key].(map[string]interface{}); ok {
+			if obj[key] == nil && !isRequired[key] {
+				continue
+			}
+			problems = append(problems, validateAgainstSchema(prop, obj[key], name)...)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				problems = append(problems, fmt.Sprintf("unknown argument '%s'", name))
+			}
+		case map[string]interface{}:
+			problems = append(problems, validateAgainstSchema(additional, obj[key], name)...)
+		}
+	}
+	return problems
+}
+
+// schemaTypes returns the types a schema allows ("type" as a string or a list)
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// matchesJSONType reports whether a decoded JSON value has the JSON Schema type t
+func matchesJSONType(t string, value interface{}) bool {
+	switch t {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == float64(int64(n))
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// toInterfaceSlice returns a schema list ([]interface{} from JSON or []string from Go)
+func toInterfaceSlice(v interface{}) ([]interface{}, bool) {
+	switch list := v.(type) {
+	case []interface{}:
+		return list, true
+	case []string:
+		values := make([]interface{}, len(list))
+		for i, s := range list {
+			values[i] = s
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// containsJSONValue reports whether value equals one of values when both are encoded as JSON
+func containsJSONValue(values []interface{}, value interface{}) bool {
+	encoded, _ := json.Marshal(value)
+	for _, v := range values {
+		if candidate, _ := json.Marshal(v); string(candidate) == string(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinArgPath appends key to the argument path
+func joinArgPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// describeArgPath names an argument in a validation problem
+func describeArgPath(path string) string {
+	if path == "" {
+		return "arguments"
+	}
+	return "argument '" + path + "'"
+}
+
+// describeJSONTypes names the allowed types, e.g. "a number or null"
+func describeJSONTypes(types []string) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		switch t {
+		case "integer", "array", "object":
+			names[i] = "an " + t
+		case "null":
+			names[i] = t
+		default:
+			names[i] = "a " + t
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+// describeJSONValue shows a value in a validation problem as short JSON
+func describeJSONValue(value interface{}) string {
+	const maxLen = 60
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	if len(data) > maxLen {
+		return string(data[:maxLen]) + "…"
+	}
+	return string(data)
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseToolArguments(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title":          map[string]interface{}{"type": "string"},
+			"duration_hours": map[string]interface{}{"type": "number"},
+			"notify":         map[string]interface{}{"type": "boolean"},
+			"tags":           map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+		"required": []interface{}{"title"},
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		outcome string
+		detail  string
+	}{
+		{"valid", `{"title": "Standup", "duration_hours": 1}`, ToolArgsValid, ""},
+		{"empty", ``, ToolArgsInvalid, "argument 'title' is required"},
+		{"code fence", "```json\n{\"title\": \"Standup\"}\n```", ToolArgsRepaired, "stripped code fence"},
+		{"trailing commas", `{"title": "Standup", "tags": ["a", "b",],}`, ToolArgsRepaired, "removed trailing commas"},
+		{"single quotes", `{'title': 'Bob\'s "sync"'}`, ToolArgsRepaired, "replaced single quotes"},
+		{"double encoded", `"{\"title\": \"Standup\"}"`, ToolArgsRepaired, "decoded double-encoded JSON"},
+		{"numeric string", `{"title": "Standup", "duration_hours": " 1.5 ", "notify": "TRUE"}`, ToolArgsRepaired,
+			"coerced argument 'duration_hours' to number; coerced argument 'notify' to boolean"},
+		{"wrong type", `{"title": "Standup", "duration_hours": "two"}`, ToolArgsInvalid,
+			`argument 'duration_hours' must be a number, got "two"`},
+		{"not json", `{"title": Standup}`, ToolArgsInvalid, "arguments are not valid JSON"},
+		{"not an object", `[1, 2]`, ToolArgsInvalid, "arguments must be a JSON object, got [1,2]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := ParseToolArguments(tt.raw, schema)
+			if check.Outcome != tt.outcome {
+				t.Fatalf("Expected outcome %s, got %s (%s)", tt.outcome, check.Outcome, check.Detail())
+			}
+			if !strings.HasPrefix(check.Detail(), tt.detail) {
+				t.Errorf("Expected detail %q, got %q", tt.detail, check.Detail())
+			}
+			if tt.outcome != ToolArgsInvalid && check.Args["title"] == nil {
+				t.Errorf("Expected parsed arguments, got %v", check.Args)
+			}
+		})
+	}
+
+	check := ParseToolArguments(`{'title': 'Bob\'s "sync"'}`, schema)
+	if check.Args["title"] != `Bob's "sync"` {
+		t.Errorf("Expected quotes to survive the repair, got %q", check.Args["title"])
+	}
+
+	// Without a schema arguments are only parsed
+	if check := ParseToolArguments(`{"duration_hours": "two",}`, nil); check.Outcome != ToolArgsRepaired || check.Args["duration_hours"] != "two" {
+		t.Errorf("Expected a repaired unvalidated result, got %+v", check)
+	}
+}
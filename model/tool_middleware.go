@@ -0,0 +1,101 @@
+package model
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/ghiac/agentize/log"
+)
+
+// ToolMiddleware wraps a tool function with behavior shared by every tool call, such as logging,
+// argument enrichment or result redaction (see FunctionRegistry.Use)
+type ToolMiddleware func(next ContextToolFunction) ContextToolFunction
+
+// ToolCallInfo identifies the tool call being executed. Middlewares and context-aware tools read
+// it with ToolCallInfoFromContext; the engine sets it for every call (ToolName at least).
+type ToolCallInfo struct {
+	ToolName   string
+	ToolCallID string
+	UserID     string
+	SessionID  string
+}
+
+type toolCallInfoCtxKey struct{}
+
+// WithToolCallInfo returns a copy of ctx carrying info
+func WithToolCallInfo(ctx context.Context, info ToolCallInfo) context.Context {
+	return context.WithValue(ctx, toolCallInfoCtxKey{}, info)
+}
+
+// ToolCallInfoFromContext returns the tool call info of ctx (false if none was set)
+func ToolCallInfoFromContext(ctx context.Context) (ToolCallInfo, bool) {
+	info, ok := ctx.Value(toolCallInfoCtxKey{}).(ToolCallInfo)
+	return info, ok
+}
+
+// Use adds middlewares applied to every tool of the registry, including tools registered later.
+// Middlewares run in the order they were added: the first one added is the outermost.
+func (fr *FunctionRegistry) Use(middlewares ...ToolMiddleware) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	for _, mw := range middlewares {
+		if mw != nil {
+			fr.middlewares = append(fr.middlewares, mw)
+		}
+	}
+}
+
+// Wrap returns fn wrapped in the registry's middlewares, for tools executed outside the registry
+// (Execute and ExecuteContext already apply them). The context passed on carries a ToolCallInfo
+// with toolName when the caller did not set one.
+func (fr *FunctionRegistry) Wrap(toolName string, fn ContextToolFunction) ContextToolFunction {
+	fr.mu.RLock()
+	middlewares := fr.middlewares
+	fr.mu.RUnlock()
+
+	wrapped := fn
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		wrapped = middlewares[i](wrapped)
+	}
+	return func(ctx context.Context, args map[string]interface{}) (string, error) {
+		if info, ok := ToolCallInfoFromContext(ctx); !ok || info.ToolName != toolName {
+			info.ToolName = toolName
+			ctx = WithToolCallInfo(ctx, info)
+		}
+		return wrapped(ctx, args)
+	}
+}
+
+// RedactToolResults returns a middleware replacing every match of patterns in tool results with
+// mask (default "[REDACTED]"), so secrets never reach the model or the stored ToolCall.Response
+func RedactToolResults(mask string, patterns ...*regexp.Regexp) ToolMiddleware {
+	if mask == "" {
+		mask = "[REDACTED]"
+	}
+	return func(next ContextToolFunction) ContextToolFunction {
+		return func(ctx context.Context, args map[string]interface{}) (string, error) {
+			result, err := next(ctx, args)
+			for _, pattern := range patterns {
+				result = pattern.ReplaceAllString(result, mask)
+			}
+			return result, err
+		}
+	}
+}
+
+// LogSlowToolCalls returns a middleware logging a warning for tool calls taking longer than threshold
+func LogSlowToolCalls(threshold time.Duration) ToolMiddleware {
+	return func(next ContextToolFunction) ContextToolFunction {
+		return func(ctx context.Context, args map[string]interface{}) (string, error) {
+			start := time.Now()
+			result, err := next(ctx, args)
+			if elapsed := time.Since(start); elapsed > threshold {
+				info, _ := ToolCallInfoFromContext(ctx)
+				log.Log.Warn("[ToolMiddleware] 🐢 Slow tool call",
+					"tool", info.ToolName, "user_id", info.UserID, "session_id", info.SessionID, "duration", elapsed, "threshold", threshold)
+			}
+			return result, err
+		}
+	}
+}
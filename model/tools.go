@@ -10,14 +10,56 @@ const (
 	MergeStrategyOverride MergeStrategy = "override"
 	// MergeStrategyAppend keeps all tools, renaming duplicates
 	MergeStrategyAppend MergeStrategy = "append"
+	// MergeStrategyAppendDedupe keeps the union of all levels' tools, one per name; the
+	// lower level's definition wins but the tool keeps its inherited position
+	MergeStrategyAppendDedupe MergeStrategy = "append_dedupe"
 	// MergeStrategyError returns an error if duplicate names are found
 	MergeStrategyError MergeStrategy = "error"
 )
 
+// ValidMergeStrategies lists every merge strategy accepted in tools_policy.strategy
+var ValidMergeStrategies = []MergeStrategy{MergeStrategyOverride, MergeStrategyAppend, MergeStrategyAppendDedupe, MergeStrategyError}
+
+// IsValidMergeStrategy reports whether strategy is a known merge strategy (empty means the default)
+func IsValidMergeStrategy(strategy MergeStrategy) bool {
+	if strategy == "" {
+		return true
+	}
+	for _, s := range ValidMergeStrategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolsPolicy is the tools_policy section of node.yaml: how the node's tools merge with
+// the tools inherited from its ancestors.
+//
+// Example YAML:
+//
+//	tools_policy:
+//	  strategy: "append_dedupe"  # overrides the engine-level strategy for this node
+//	  add: ["search"]            # added only if no ancestor defines the name
+//	  replace: ["create_ticket"] # this node's definition replaces the inherited one
+//	  remove: ["delete_account"] # inherited tool dropped from here down
+type ToolsPolicy struct {
+	Strategy MergeStrategy `yaml:"strategy,omitempty"`
+	Add      []string      `yaml:"add,omitempty"`
+	Remove   []string      `yaml:"remove,omitempty"`
+	Replace  []string      `yaml:"replace,omitempty"`
+}
+
+// IsZero reports whether the policy changes nothing
+func (p ToolsPolicy) IsZero() bool {
+	return p.Strategy == "" && len(p.Add) == 0 && len(p.Remove) == 0 && len(p.Replace) == 0
+}
+
 // ToolRegistry manages tool aggregation and conflict resolution
 type ToolRegistry struct {
 	strategy MergeStrategy
 	tools    map[string]Tool // name -> tool
+	order    []string        // names in the order they were first added
 }
 
 // NewToolRegistry creates a new tool registry with the specified merge strategy
@@ -43,20 +85,30 @@ func (tr *ToolRegistry) AddTools(tools []Tool) error {
 
 // AddTool adds a single tool to the registry
 func (tr *ToolRegistry) AddTool(tool Tool) error {
+	return tr.addTool(tool, tr.strategy)
+}
+
+func (tr *ToolRegistry) addTool(tool Tool, strategy MergeStrategy) error {
 	existing, exists := tr.tools[tool.Name]
 
-	switch tr.strategy {
+	switch strategy {
 	case MergeStrategyOverride:
-		// Lower level (later added) wins
-		tr.tools[tool.Name] = tool
+		// Lower level (later added) wins and moves to the end
+		tr.remove(tool.Name)
+		tr.set(tool)
 
 	case MergeStrategyAppend:
 		if exists {
 			// Rename the existing tool
+			tr.remove(existing.Name)
 			existing.Name = existing.Name + "_prev"
-			tr.tools[existing.Name] = existing
+			tr.set(existing)
 		}
-		tr.tools[tool.Name] = tool
+		tr.set(tool)
+
+	case MergeStrategyAppendDedupe:
+		// Lower level wins, in place
+		tr.set(tool)
 
 	case MergeStrategyError:
 		if exists {
@@ -66,20 +118,81 @@ func (tr *ToolRegistry) AddTool(tool Tool) error {
 				New:      tool,
 			}
 		}
-		tr.tools[tool.Name] = tool
+		tr.set(tool)
 
 	default:
 		// Default to override
-		tr.tools[tool.Name] = tool
+		tr.remove(tool.Name)
+		tr.set(tool)
 	}
 
 	return nil
 }
 
-// GetTools returns all tools as a slice, excluding hidden tools
+// AddNodeTools merges one level's tools with policy: names in Remove are dropped first,
+// tools named in Replace override and tools named in Add are kept only when not inherited,
+// whatever the strategy; the rest merge with policy.Strategy, or the registry's strategy.
+func (tr *ToolRegistry) AddNodeTools(tools []Tool, policy ToolsPolicy) error {
+	for _, name := range policy.Remove {
+		tr.remove(name)
+	}
+	strategy := tr.strategy
+	if policy.Strategy != "" {
+		strategy = policy.Strategy
+	}
+	for _, tool := range tools {
+		switch {
+		case containsName(policy.Replace, tool.Name):
+			tr.set(tool)
+		case containsName(policy.Add, tool.Name):
+			if _, exists := tr.tools[tool.Name]; !exists {
+				tr.set(tool)
+			}
+		default:
+			if err := tr.addTool(tool, strategy); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// set stores tool, keeping the position of a tool already registered under its name
+func (tr *ToolRegistry) set(tool Tool) {
+	if _, exists := tr.tools[tool.Name]; !exists {
+		tr.order = append(tr.order, tool.Name)
+	}
+	tr.tools[tool.Name] = tool
+}
+
+// remove drops the tool registered under name, if any
+func (tr *ToolRegistry) remove(name string) {
+	if _, exists := tr.tools[name]; !exists {
+		return
+	}
+	delete(tr.tools, name)
+	for i, n := range tr.order {
+		if n == name {
+			tr.order = append(tr.order[:i], tr.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTools returns all tools as a slice, excluding hidden tools, in the order they were added
 func (tr *ToolRegistry) GetTools() []Tool {
 	tools := make([]Tool, 0, len(tr.tools))
-	for _, tool := range tr.tools {
+	for _, name := range tr.order {
+		tool := tr.tools[name]
 		// Skip hidden tools
 		if tool.Status == ToolStatusHidden {
 			continue
@@ -89,11 +202,11 @@ func (tr *ToolRegistry) GetTools() []Tool {
 	return tools
 }
 
-// GetToolsIncludingHidden returns all tools including hidden ones
+// GetToolsIncludingHidden returns all tools including hidden ones, in the order they were added
 func (tr *ToolRegistry) GetToolsIncludingHidden() []Tool {
 	tools := make([]Tool, 0, len(tr.tools))
-	for _, tool := range tr.tools {
-		tools = append(tools, tool)
+	for _, name := range tr.order {
+		tools = append(tools, tr.tools[name])
 	}
 	return tools
 }
@@ -221,6 +334,13 @@ func (t *Tool) SetActive() {
 	t.ErrorMessage = ""
 }
 
+// Citation is a source a web search answer was based on
+type Citation struct {
+	Title   string `json:"title,omitempty"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
 // ToolCall represents a tool call execution record
 type ToolCall struct {
 	// ToolID is a sequential unique identifier for this tool call within the session
@@ -258,12 +378,25 @@ type ToolCall struct {
 	// DurationMs is the execution time in milliseconds (from creation to response)
 	DurationMs int64
 
-	// Status: "pending", "success", "failed"
+	// Status: "pending", "success", "failed", "cache_hit"
 	Status string
 
 	// Error holds the error message when Status is "failed"
 	Error string
 
+	// Sources are the citations of a web search result (empty for other tools)
+	Sources []Citation `json:",omitempty"`
+
+	// ArgsValidation is the outcome of checking the arguments: "valid", "repaired" or "invalid"
+	// (see ParseToolArguments; empty for calls recorded before it was tracked)
+	ArgsValidation string `json:",omitempty"`
+
+	// ArgsValidationDetail lists the repairs applied to the arguments or why they are invalid
+	ArgsValidationDetail string `json:",omitempty"`
+
+	// MCPServer is the name of the MCP server that served the call (empty for other tools)
+	MCPServer string `json:",omitempty"`
+
 	// Metadata
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -273,4 +406,6 @@ const (
 	ToolCallStatusPending = "pending"
 	ToolCallStatusSuccess = "success"
 	ToolCallStatusFailed  = "failed"
+	// ToolCallStatusCacheHit marks a call answered from the tool result cache without running the tool
+	ToolCallStatusCacheHit = "cache_hit"
 )
@@ -259,3 +259,84 @@ func containsMiddle(s, substr string) bool {
 	}
 	return false
 }
+
+func TestToolRegistryStrategiesAcrossLevels(t *testing.T) {
+	tool := func(name, desc string) Tool {
+		return Tool{Name: name, Description: desc, Status: ToolStatusActive}
+	}
+	root := []Tool{tool("search", "root search"), tool("ticket", "root ticket")}
+	child := []Tool{tool("search", "child search"), tool("refund", "child refund")}
+
+	summary := func(tools []Tool) []string {
+		var out []string
+		for _, tl := range tools {
+			out = append(out, tl.Name+"="+tl.Description)
+		}
+		return out
+	}
+	equal := func(a, b []string) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	tests := []struct {
+		strategy MergeStrategy
+		want     []string
+		wantErr  bool
+	}{
+		{MergeStrategyOverride, []string{"ticket=root ticket", "search=child search", "refund=child refund"}, false},
+		{MergeStrategyAppendDedupe, []string{"search=child search", "ticket=root ticket", "refund=child refund"}, false},
+		{MergeStrategyAppend, []string{"ticket=root ticket", "search_prev=root search", "search=child search", "refund=child refund"}, false},
+		{MergeStrategyError, nil, true},
+	}
+	for _, tt := range tests {
+		registry := NewToolRegistry(tt.strategy)
+		registry.AddTools(root)
+		err := registry.AddTools(child)
+		var conflict *ToolConflictError
+		if tt.wantErr {
+			if !errors.As(err, &conflict) || conflict.ToolName != "search" {
+				t.Errorf("%s: expected conflict on search, got %v", tt.strategy, err)
+			}
+			continue
+		}
+		if got := summary(registry.GetTools()); err != nil || !equal(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v (%v)", tt.strategy, tt.want, got, err)
+		}
+	}
+
+	// tools_policy overrides the registry strategy for one level
+	registry := NewToolRegistry(MergeStrategyError)
+	registry.AddTools(root)
+	err := registry.AddNodeTools(
+		[]Tool{tool("search", "child search"), tool("ticket", "child ticket"), tool("refund", "child refund")},
+		ToolsPolicy{Add: []string{"search"}, Replace: []string{"ticket"}, Remove: []string{"search"}},
+	)
+	if err != nil {
+		t.Fatalf("AddNodeTools failed: %v", err)
+	}
+	// search was removed before add, so the child's definition is added back at the end
+	want := []string{"ticket=child ticket", "search=child search", "refund=child refund"}
+	if got := summary(registry.GetTools()); !equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	registry = NewToolRegistry(MergeStrategyError)
+	registry.AddTools(root)
+	if err := registry.AddNodeTools(child, ToolsPolicy{Strategy: MergeStrategyAppendDedupe}); err != nil {
+		t.Fatalf("Expected the node strategy to avoid the conflict, got %v", err)
+	}
+	if err := registry.AddNodeTools([]Tool{tool("search", "grandchild")}, ToolsPolicy{Add: []string{"search"}}); err != nil {
+		t.Fatalf("AddNodeTools failed: %v", err)
+	}
+	if got, _ := registry.GetTool("search"); got.Description != "child search" {
+		t.Errorf("Expected add to keep the inherited search, got %q", got.Description)
+	}
+}
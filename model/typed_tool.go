@@ -0,0 +1,209 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// TypedToolFunction is a tool function taking its arguments decoded into In and returning a
+// result marshalled to JSON (see RegisterTyped)
+type TypedToolFunction[In any, Out any] func(ctx context.Context, in In) (Out, error)
+
+// RegisterTyped registers fn as a context-aware tool whose arguments are decoded into In and whose
+// result is marshalled to JSON (a string result is returned as-is). The tool's definition gets the
+// JSON Schema derived from In (see JSONSchemaFor); use JSONSchemaFor to write the input_schema of
+// a tools.json declaration, so the declared schema and the Go type stay the same.
+//
+// Arguments that do not match the schema are not passed to fn: the tool returns a
+// ToolArgumentsError as its JSON result instead, so the model can correct the call.
+func RegisterTyped[In any, Out any](fr *FunctionRegistry, toolName string, displayName string, fn TypedToolFunction[In, Out]) error {
+	if fn == nil {
+		return fmt.Errorf("function cannot be nil for tool: %s", toolName)
+	}
+	schema, err := jsonSchemaOf(reflect.TypeOf((*In)(nil)).Elem())
+	if err != nil {
+		return fmt.Errorf("invalid argument type for tool %s: %w", toolName, err)
+	}
+	if schema["type"] != "object" {
+		return fmt.Errorf("invalid argument type for tool %s: arguments must be a struct or map", toolName)
+	}
+
+	handler := func(ctx context.Context, args map[string]interface{}) (string, error) {
+		// The engine's own arguments (__user_id__, __session_id__) are not part of In
+		declared := make(map[string]interface{}, len(args))
+		for key, value := range args {
+			if !isReservedToolArg(key) {
+				declared[key] = value
+			}
+		}
+		args = declared
+		coerceToSchema(schema, args, "")
+		if problems := validateAgainstSchema(schema, args, ""); len(problems) > 0 {
+			return (&ToolArgumentsError{ToolName: toolName, Problems: problems, Schema: schema}).Result(), nil
+		}
+		data, err := json.Marshal(args)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode arguments of %s: %w", toolName, err)
+		}
+		var in In
+		if err := json.Unmarshal(data, &in); err != nil {
+			return (&ToolArgumentsError{ToolName: toolName, Problems: []string{err.Error()}, Schema: schema}).Result(), nil
+		}
+
+		out, err := fn(ctx, in)
+		if err != nil {
+			return "", err
+		}
+		if s, ok := any(out).(string); ok {
+			return s, nil
+		}
+		result, err := json.Marshal(out)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode result of %s: %w", toolName, err)
+		}
+		return string(result), nil
+	}
+
+	if err := fr.RegisterContext(toolName, displayName, handler); err != nil {
+		return err
+	}
+	return fr.SetDefinition(toolName, openai.FunctionDefinition{Parameters: schema})
+}
+
+// MustRegisterTyped is RegisterTyped that panics if there's an error
+func MustRegisterTyped[In any, Out any](fr *FunctionRegistry, toolName string, displayName string, fn TypedToolFunction[In, Out]) {
+	if err := RegisterTyped(fr, toolName, displayName, fn); err != nil {
+		panic(fmt.Sprintf("failed to register tool function %s: %v", toolName, err))
+	}
+}
+
+// ToolArgumentsError describes tool arguments that do not match the tool's schema.
+// RegisterTyped returns it to the model as the tool result (see Result).
+type ToolArgumentsError struct {
+	ToolName string                 `json:"tool"`
+	Problems []string               `json:"problems"`
+	Schema   map[string]interface{} `json:"schema,omitempty"`
+}
+
+func (e *ToolArgumentsError) Error() string {
+	return fmt.Sprintf("invalid arguments for tool %s: %s", e.ToolName, strings.Join(e.Problems, "; "))
+}
+
+// Result returns the error as the JSON tool result shown to the model
+func (e *ToolArgumentsError) Result() string {
+	data, _ := json.Marshal(struct {
+		Error string `json:"error"`
+		*ToolArgumentsError
+	}{Error: "invalid_arguments", ToolArgumentsError: e})
+	return string(data)
+}
+
+// JSONSchemaFor returns the JSON Schema of T, as used for tool input schemas. Struct fields are
+// named by their json tag and required unless tagged omitempty or a pointer; the tags
+// description:"..." and enum:"a,b,c" (string fields) add a description and allowed values. Unknown properties
+// are not allowed.
+func JSONSchemaFor[T any]() (map[string]interface{}, error) {
+	return jsonSchemaOf(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// jsonSchemaOf builds the schema of t (see JSONSchemaFor)
+func jsonSchemaOf(t reflect.Type) (map[string]interface{}, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := jsonSchemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map key of %s must be a string", t)
+		}
+		values, err := jsonSchemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		schema := map[string]interface{}{"type": "object"}
+		if len(values) > 0 {
+			schema["additionalProperties"] = values
+		}
+		return schema, nil
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// structSchema builds the object schema of the exported fields of the struct type t
+func structSchema(t reflect.Type) (map[string]interface{}, error) {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop, err := jsonSchemaOf(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop["description"] = desc
+		}
+		if enum := field.Tag.Get("enum"); enum != "" && prop["type"] == "string" {
+			values := []interface{}{}
+			for _, v := range strings.Split(enum, ",") {
+				values = append(values, strings.TrimSpace(v))
+			}
+			prop["enum"] = values
+		}
+		properties[name] = prop
+
+		optional := field.Type.Kind() == reflect.Pointer
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "omitempty" || opt == "omitzero" {
+				optional = true
+			}
+		}
+		if !optional {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, nil
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// UsageRecord is one metered LLM call, recorded for the per-user usage aggregate
+type UsageRecord struct {
+	RecordID         string
+	UserID           string
+	SessionID        string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64 // 0 when the model has no price
+	CreatedAt        time.Time
+}
+
+// usageRecordSeq keeps record IDs unique when records are created within the same clock tick
+var usageRecordSeq atomic.Int64
+
+// NewUsageRecord creates a usage record for an LLM call of a user
+func NewUsageRecord(userID, sessionID, modelName string) *UsageRecord {
+	now := time.Now()
+	return &UsageRecord{
+		RecordID:  fmt.Sprintf("%s-usage-%d-%d", userID, now.UnixNano(), usageRecordSeq.Add(1)),
+		UserID:    userID,
+		SessionID: sessionID,
+		Model:     modelName,
+		CreatedAt: now,
+	}
+}
+
+// ModelUsage is the usage of one model within a UsageSummary
+type ModelUsage struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// UsageSummary aggregates the usage records of a user (or of every user) over a time range
+type UsageSummary struct {
+	UserID string `json:"user_id,omitempty"` // "" for every user
+	// From and To bound the range; zero values are open ends
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+
+	ByModel map[string]*ModelUsage `json:"by_model"`
+}
+
+// TotalTokens returns the prompt plus completion tokens
+func (s *UsageSummary) TotalTokens() int {
+	return s.PromptTokens + s.CompletionTokens
+}
+
+// Add adds a group of calls of a model to the summary
+func (s *UsageSummary) Add(modelName string, usage ModelUsage) {
+	s.Calls += usage.Calls
+	s.PromptTokens += usage.PromptTokens
+	s.CompletionTokens += usage.CompletionTokens
+	s.CostUSD += usage.CostUSD
+	if s.ByModel == nil {
+		s.ByModel = make(map[string]*ModelUsage)
+	}
+	m, ok := s.ByModel[modelName]
+	if !ok {
+		m = &ModelUsage{}
+		s.ByModel[modelName] = m
+	}
+	m.Calls += usage.Calls
+	m.PromptTokens += usage.PromptTokens
+	m.CompletionTokens += usage.CompletionTokens
+	m.CostUSD += usage.CostUSD
+}
+
+// UsageStore is implemented by stores that keep the per-user LLM usage aggregate
+type UsageStore interface {
+	// PutUsageRecord stores a metered LLM call
+	PutUsageRecord(record *UsageRecord) error
+	// GetUsageSummary aggregates the usage of userID ("" for every user) between from and to
+	// (zero values are open ends)
+	GetUsageSummary(userID string, from, to time.Time) (*UsageSummary, error)
+}
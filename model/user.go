@@ -11,6 +11,10 @@ type User struct {
 	Name     string // User's display name (optional)
 	Username string // User's username (optional)
 
+	// Language is the user's preferred language as an ISO 639-1 code (e.g. "fr"), detected from
+	// their first message or set explicitly; empty until known
+	Language string
+
 	// Ban status
 	IsBanned   bool      // Whether the user is currently banned
 	BanUntil   time.Time // When the ban expires (zero time means permanent ban)
@@ -99,6 +103,12 @@ func (u *User) ResetNonsenseCount() {
 	u.UpdatedAt = time.Now()
 }
 
+// SetLanguage sets the user's preferred language (ISO 639-1 code, "" to detect it again)
+func (u *User) SetLanguage(language string) {
+	u.Language = language
+	u.UpdatedAt = time.Now()
+}
+
 // GetActiveSessionID returns the active session ID for a given agent type
 // Returns empty string if no active session exists
 func (u *User) GetActiveSessionID(agentType AgentType) string {
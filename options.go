@@ -0,0 +1,234 @@
+package agentize
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ghiac/agentize/engine"
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/llmutils"
+	"github.com/ghiac/agentize/log"
+	"github.com/ghiac/agentize/model"
+	"github.com/ghiac/agentize/store"
+)
+
+// Option configures an Agentize built by New
+type Option func(*Options)
+
+// EngineConfig configures one agent of the CoreHandler built with WithAgents
+type EngineConfig struct {
+	// Model is the agent's model (default: CoreHandlerConfig.UserAgentHighModel or
+	// UserAgentLowModel for "high" and "low", the WithLLM model for named agents)
+	Model string
+	// LLM is this agent's LLM config, e.g. another provider; unset fields inherit the WithLLM
+	// config (see engine.LLMConfig.Inherit)
+	LLM *engine.LLMConfig
+	// Repository gives the agent its own knowledge tree (default: the tree New loads)
+	Repository *fsrepo.NodeRepository
+	// Functions gives the agent its own function registry (default: the shared registry)
+	Functions *model.FunctionRegistry
+}
+
+// WithStore sets the session store (default: the SQLite DBStore)
+func WithStore(sessionStore store.SessionStore) Option {
+	return func(o *Options) { o.SessionStore = sessionStore }
+}
+
+// WithRepository uses an existing knowledge repository instead of loading the path given to New
+func WithRepository(repo *fsrepo.NodeRepository) Option {
+	return func(o *Options) { o.Repository = repo }
+}
+
+// WithFunctionRegistry sets the function registry shared by the agents
+func WithFunctionRegistry(registry *model.FunctionRegistry) Option {
+	return func(o *Options) { o.FunctionRegistry = registry }
+}
+
+// WithStrict validates the knowledge tree before loading it (see Options.Strict)
+func WithStrict(strict bool) Option {
+	return func(o *Options) { o.Strict = strict }
+}
+
+// WithAllowCycles tolerates routing cycles in the knowledge tree (see Options.AllowCycles)
+func WithAllowCycles(allow bool) Option {
+	return func(o *Options) { o.AllowCycles = allow }
+}
+
+// WithAllowJump lets sessions jump to any node (see Options.AllowJump)
+func WithAllowJump(allow bool) Option {
+	return func(o *Options) { o.AllowJump = allow }
+}
+
+// WithMergeStrategy sets how the tools of the nodes from the root to the current node combine
+// for every agent (engine.LLMConfig.ToolMergeStrategy; default: override)
+func WithMergeStrategy(strategy model.MergeStrategy) Option {
+	return func(o *Options) { o.MergeStrategy = strategy }
+}
+
+// WithLLM configures the LLM and builds a CoreHandler with high and low UserAgents,
+// available from GetCoreHandler
+func WithLLM(config engine.LLMConfig) Option {
+	return func(o *Options) { o.LLM = &config }
+}
+
+// WithVisionLLM configures the CoreHandler's LLM for image messages (requires WithLLM)
+func WithVisionLLM(config engine.LLMConfig) Option {
+	return func(o *Options) { o.VisionLLM = &config }
+}
+
+// WithCoreLLM configures the LLM of the Core's own decisions (requires WithLLM); unset fields
+// inherit the WithLLM config (see engine.LLMConfig.Inherit)
+func WithCoreLLM(config engine.LLMConfig) Option {
+	return func(o *Options) { o.CoreLLM = &config }
+}
+
+// WithSummarizerLLM configures the LLM that summarizes sessions, for the scheduler and the
+// CoreHandler (requires WithLLM); unset fields inherit the WithLLM config. Its Model is the
+// summary model unless SummaryModel is set.
+func WithSummarizerLLM(config engine.LLMConfig) Option {
+	return func(o *Options) { o.SummarizerLLM = &config }
+}
+
+// WithCoreConfig sets the CoreHandler config (default: engine.DefaultCoreHandlerConfig())
+func WithCoreConfig(config engine.CoreHandlerConfig) Option {
+	return func(o *Options) { o.CoreConfig = &config }
+}
+
+// WithAgents configures the CoreHandler's agents by name (requires WithLLM): "high" and "low"
+// configure the UserAgents, any other name adds a named agent (see CoreHandler.RegisterNamedAgent)
+func WithAgents(agents map[string]EngineConfig) Option {
+	return func(o *Options) { o.Agents = agents }
+}
+
+// WithScheduler sets the session summarization scheduler config used instead of the
+// AGENTIZE_SCHEDULER_* environment variables when the scheduler starts
+func WithScheduler(config engine.SessionSchedulerConfig) Option {
+	return func(o *Options) { o.Scheduler = &config }
+}
+
+// WithLogger sends the logs of the engines, the CoreHandler, the scheduler and the session store
+// (when it has SetLogger) to logger instead of log.Log, e.g. an application *slog.Logger or a
+// redacting log.New logger
+func WithLogger(logger log.FieldLogger) Option {
+	return func(o *Options) { o.Logger = logger }
+}
+
+// newCoreHandler builds the CoreHandler of opts.LLM: high and low UserAgents sharing the
+// repository, store and function registry (unless opts.Agents says otherwise) and the named agents
+func (ag *Agentize) newCoreHandler(llm engine.LLMConfig, opts *Options) (*engine.CoreHandler, error) {
+	coreConfig := engine.DefaultCoreHandlerConfig()
+	if opts.CoreConfig != nil {
+		coreConfig = *opts.CoreConfig
+	}
+	if coreConfig.Logger == nil {
+		coreConfig.Logger = ag.engine.Logger
+	}
+
+	high, err := ag.newAgent(llm, coreConfig.UserAgentHighModel, opts.Agents["high"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize high UserAgent: %w", err)
+	}
+	low, err := ag.newAgent(llm, coreConfig.UserAgentLowModel, opts.Agents["low"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize low UserAgent: %w", err)
+	}
+
+	sessionHandlerConfig := model.DefaultSessionHandlerConfig()
+	if summaryModel := ag.summarizationLLMConfig().SummaryModel; ag.summarizerLLM != nil && summaryModel != "" {
+		sessionHandlerConfig.SummaryModel = summaryModel
+	}
+	sessionHandler := model.NewSessionHandler(ag.engine.Sessions, sessionHandlerConfig)
+	ch := engine.NewCoreHandler(sessionHandler, high, low, coreConfig)
+	coreLLM := llm
+	if opts.CoreLLM != nil {
+		coreLLM = opts.CoreLLM.Inherit(llm)
+	}
+	if err := ch.UseLLMConfig(coreLLM); err != nil {
+		return nil, err
+	}
+	if ag.summarizerLLM != nil {
+		summarizer := ag.summarizationLLMConfig()
+		sessionHandler.SetLLMClient(&OpenAIClientWrapperForSessionHandler{
+			Client: llmutils.NewOpenAIClientWithUserIDHeader(summarizer.APIKey, summarizer.BaseURL, summarizer.HTTPClient),
+		})
+	} else if client := high.GetLLMClient(); client != nil {
+		sessionHandler.SetLLMClient(client)
+	}
+	if opts.VisionLLM != nil {
+		if err := ch.UseVisionLLMConfig(*opts.VisionLLM); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(opts.Agents))
+	for name := range opts.Agents {
+		if name != "high" && name != "low" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		agent, err := ag.newAgent(llm, llm.Model, opts.Agents[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize agent %s: %w", name, err)
+		}
+		if err := ch.RegisterNamedAgent(name, agent); err != nil {
+			return nil, err
+		}
+	}
+	return ch, nil
+}
+
+// newAgent creates and initializes an agent engine on the shared store, using defaultModel
+// unless cfg sets a model
+func (ag *Agentize) newAgent(llm engine.LLMConfig, defaultModel string, cfg EngineConfig) (*engine.Engine, error) {
+	base := ag.engine
+	eng := &engine.Engine{
+		Repo:      base.Repo,
+		Sessions:  base.Sessions,
+		Functions: base.Functions,
+		Executor:  base.Executor,
+		Logger:    base.Logger,
+	}
+	if cfg.Repository != nil {
+		eng.Repo = cfg.Repository
+	}
+	if cfg.Functions != nil {
+		// The shared executor runs the shared registry; without it the engine uses its own
+		eng.Functions = cfg.Functions
+		eng.Executor = nil
+	}
+	if err := eng.Init(); err != nil {
+		return nil, err
+	}
+
+	agentLLM := llm
+	agentLLM.Model = defaultModel
+	if cfg.LLM != nil {
+		agentLLM = cfg.LLM.Inherit(agentLLM)
+	}
+	if cfg.Model != "" {
+		agentLLM.Model = cfg.Model
+	}
+	if agentLLM.ToolMergeStrategy == "" {
+		agentLLM.ToolMergeStrategy = ag.mergeStrategy
+	}
+	if err := eng.UseLLMConfig(agentLLM); err != nil {
+		return nil, err
+	}
+	return eng, nil
+}
+
+// summarizationLLMConfig returns the LLM config of session summaries: the WithSummarizerLLM
+// config inheriting the engine's, or the engine's
+func (ag *Agentize) summarizationLLMConfig() engine.LLMConfig {
+	llm := ag.engine.GetLLMConfig()
+	if ag.summarizerLLM == nil {
+		return llm
+	}
+	summarizer := *ag.summarizerLLM
+	if summarizer.SummaryModel == "" {
+		summarizer.SummaryModel = summarizer.Model
+	}
+	return summarizer.Inherit(llm)
+}
@@ -0,0 +1,110 @@
+package agentize
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghiac/agentize/engine"
+	"github.com/ghiac/agentize/log"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ReplaySession re-runs the user messages of a stored session through the engine with modelName
+// (the configured model if empty) in a new throwaway session and returns its transcript, e.g. to
+// compare a model upgrade on real conversations. The original session is only read.
+//
+// The throwaway session belongs to a temporary user, so tools see that user ID rather than the
+// original one; tools still run, so tools with side effects should be stubbed for replays.
+// The temporary user's data is deleted afterwards (only the session when the store does not
+// implement DeleteUserData).
+func (ag *Agentize) ReplaySession(ctx context.Context, sessionID string, modelName string) ([]openai.ChatCompletionMessage, error) {
+	if ag.engine.GetLLMClient() == nil {
+		return nil, fmt.Errorf("LLM client is not configured. Call UseLLMConfig first")
+	}
+	original, err := ag.engine.Sessions.Get(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	userMessages := replayUserMessages(append(append([]openai.ChatCompletionMessage(nil), original.ArchivedMsgs...), original.Msgs...))
+	if len(userMessages) == 0 {
+		return nil, fmt.Errorf("session %s has no user messages to replay", sessionID)
+	}
+
+	replayEngine := &engine.Engine{
+		Repo:      ag.engine.Repo,
+		Sessions:  ag.engine.Sessions,
+		Functions: ag.engine.Functions,
+		Executor:  ag.engine.Executor,
+	}
+	if err := replayEngine.Init(); err != nil {
+		return nil, err
+	}
+	llm := ag.engine.GetLLMConfig()
+	if modelName != "" {
+		llm.Model = modelName
+	}
+	if err := replayEngine.UseLLMConfig(llm); err != nil {
+		return nil, err
+	}
+
+	replayUserID := fmt.Sprintf("replay-%d", time.Now().UnixNano())
+	session, err := replayEngine.CreateSession(replayUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create replay session: %w", err)
+	}
+	defer ag.deleteReplaySession(replayUserID, session.SessionID)
+
+	log.Log.Info("[Agentize] ⏪ Replaying session",
+		"session_id", sessionID, "model", llm.Model, "messages", len(userMessages), "replay_session_id", session.SessionID)
+	for i, msg := range userMessages {
+		if _, _, err := replayEngine.ProcessMessage(ctx, session.SessionID, msg); err != nil {
+			return nil, fmt.Errorf("failed to replay message %d of %d: %w", i+1, len(userMessages), err)
+		}
+	}
+
+	replayed, err := replayEngine.Sessions.Get(session.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replay session: %w", err)
+	}
+	return append(append([]openai.ChatCompletionMessage(nil), replayed.ArchivedMsgs...), replayed.Msgs...), nil
+}
+
+// replayUserMessages returns the text of the user messages in msgs, in order
+func replayUserMessages(msgs []openai.ChatCompletionMessage) []string {
+	var texts []string
+	for _, msg := range msgs {
+		if msg.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		text := msg.Content
+		if text == "" {
+			// Image messages keep their text parts only
+			var parts []string
+			for _, part := range msg.MultiContent {
+				if part.Type == openai.ChatMessagePartTypeText && part.Text != "" {
+					parts = append(parts, part.Text)
+				}
+			}
+			text = strings.Join(parts, "\n")
+		}
+		if strings.TrimSpace(text) != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// deleteReplaySession removes the data of a replay's temporary user
+func (ag *Agentize) deleteReplaySession(userID, sessionID string) {
+	var err error
+	if deleter, ok := ag.engine.Sessions.(interface{ DeleteUserData(string) error }); ok {
+		err = deleter.DeleteUserData(userID)
+	} else {
+		err = ag.engine.Sessions.Delete(sessionID)
+	}
+	if err != nil {
+		log.Log.Warn("[Agentize] ⚠️  Failed to delete replay session", "session_id", sessionID, "error", err)
+	}
+}
@@ -1,38 +1,66 @@
 package agentize
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ghiac/agentize/debuger"
 	"github.com/ghiac/agentize/debuger/pages"
+	"github.com/ghiac/agentize/debuger/ui/components"
 	"github.com/ghiac/agentize/documents"
+	"github.com/ghiac/agentize/engine"
+	"github.com/ghiac/agentize/fsrepo"
+	"github.com/ghiac/agentize/model"
 	"github.com/gin-gonic/gin"
 )
 
 // RegisterRoutes registers HTTP routes on the given gin.Engine
-// Routes: /agentize, /agentize/graph, /agentize/docs, /agentize/health, /agentize/debug/*
+// Routes: /agentize, /agentize/graph, /api/graph, /api/usage, /api/quota, /api/sessions, /api/messages/:messageID/feedback,
+// /api/feedback/stats, /agentize/docs, /agentize/tools.json, /agentize/health, /agentize/debug/*,
+// and /metrics when SetMetrics was called
 func (ag *Agentize) RegisterRoutes(router *gin.Engine) {
 	router.GET("/agentize", ag.handleIndex)
 	router.GET("/agentize/graph", ag.handleGraph)
+	router.GET("/api/graph", ag.handleGraphExport)
+	router.GET("/api/usage", ag.handleUsageExport)
+	router.GET("/api/quota", ag.handleQuotaStatus)
+	router.GET("/api/sessions", ag.handleSessionList)
+	router.GET("/api/sessions/:sessionID/export", ag.handleSessionExport)
+	router.POST("/api/sessions/import", ag.handleSessionImport)
+	router.POST("/api/messages/:messageID/feedback", ag.handleMessageFeedback)
+	router.GET("/api/feedback/stats", ag.handleFeedbackStats)
+	router.GET("/api/users/:userID/memories", ag.handleUserMemories)
+	router.DELETE("/api/users/:userID/memories", ag.handleUserMemoriesDelete)
+	router.DELETE("/api/users/:userID/memories/:memoryID", ag.handleUserMemoriesDelete)
 	router.GET("/agentize/docs", ag.handleDocs)
+	router.GET("/agentize/tools.json", ag.handleToolsJSON)
 	router.GET("/agentize/health", ag.handleHealth)
 	router.GET("/agentize/debug", ag.handleDebug)
 	router.GET("/agentize/debug/users", ag.handleDebugUsers)
 	router.GET("/agentize/debug/users/:userID", ag.handleDebugUserDetail)
 	router.POST("/agentize/debug/users/:userID/delete-data", ag.handleDebugUserDeleteData)
+	router.POST("/agentize/debug/users/:userID/unban", ag.handleDebugUserUnban)
 	router.GET("/agentize/debug/sessions", ag.handleDebugSessions)
 	router.GET("/agentize/debug/sessions/:sessionID", ag.handleDebugSessionDetail)
+	router.POST("/agentize/debug/sessions/:sessionID/summarize", ag.handleDebugSessionSummarize)
 	router.GET("/agentize/debug/messages", ag.handleDebugMessages)
 	router.GET("/agentize/debug/files", ag.handleDebugFiles)
 	router.GET("/agentize/debug/tool-calls", ag.handleDebugToolCalls)
 	router.GET("/agentize/debug/tool-calls/:toolID", ag.handleDebugToolCallDetail)
 	router.GET("/agentize/debug/summarized", ag.handleDebugSummarized)
 	router.GET("/agentize/debug/summarized/:logID", ag.handleDebugSummarizationLogDetail)
+	router.GET("/agentize/debug/usage", ag.handleDebugUsage)
+	router.GET("/agentize/debug/knowledge", ag.handleDebugKnowledge)
+
+	if ag.metrics != nil {
+		router.GET("/metrics", gin.WrapH(ag.metrics))
+	}
 
 	// Register extra debug pages from applications
 	for _, p := range ag.extraDebugPages {
@@ -73,6 +101,320 @@ func (ag *Agentize) handleGraph(c *gin.Context) {
 	c.String(200, contentStr)
 }
 
+// handleGraphExport returns the knowledge tree as DOT, Mermaid or JSON (?format=, default json).
+// With ?user_id= only nodes visible in graph to that user are included.
+func (ag *Agentize) handleGraphExport(c *gin.Context) {
+	format := fsrepo.GraphFormat(c.DefaultQuery("format", string(fsrepo.GraphFormatJSON)))
+
+	var opts []fsrepo.GraphOption
+	if userID := c.Query("user_id"); userID != "" {
+		opts = append(opts, fsrepo.OptGraphUser(userID, ag.engine.UserGroups(userID)...))
+	}
+
+	data, err := ag.GetRepository().ExportGraph(format, opts...)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	switch format {
+	case fsrepo.GraphFormatJSON:
+		contentType = "application/json; charset=utf-8"
+	case fsrepo.GraphFormatDOT:
+		contentType = "text/vnd.graphviz; charset=utf-8"
+	}
+	c.Data(200, contentType, data)
+}
+
+// handleUsageExport returns the LLM usage summary (calls, tokens and cost per model) as JSON,
+// for the user in ?user= (every user when empty) within ?from=&to=
+func (ag *Agentize) handleUsageExport(c *gin.Context) {
+	handler, err := ag.createDebugHandler()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	usageStore, ok := handler.GetStore().(model.UsageStore)
+	if !ok {
+		c.JSON(501, gin.H{"error": "the store does not record LLM usage"})
+		return
+	}
+
+	tr, ok := getTimeRangeParam(c)
+	if !ok {
+		return
+	}
+	summary, err := usageStore.GetUsageSummary(c.Query("user"), tr.From, tr.To)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to get usage summary: %v", err)})
+		return
+	}
+	c.JSON(200, summary)
+}
+
+// handleQuotaStatus returns the token quota of the user in ?user= and what is left of it as JSON
+func (ag *Agentize) handleQuotaStatus(c *gin.Context) {
+	userID := c.Query("user")
+	if userID == "" {
+		c.JSON(400, gin.H{"error": "user parameter is required"})
+		return
+	}
+	if ag.coreHandler == nil {
+		c.JSON(501, gin.H{"error": "no CoreHandler configured"})
+		return
+	}
+	status, err := ag.coreHandler.QuotaStatus(userID)
+	if err != nil {
+		c.JSON(501, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, status)
+}
+
+// sessionListItem is a session in the /api/sessions response
+type sessionListItem struct {
+	SessionID string          `json:"session_id"`
+	AgentType model.AgentType `json:"agent_type"`
+	Title     string          `json:"title"`
+	Summary   string          `json:"summary"`
+	Tags      []string        `json:"tags"`
+	Archived  bool            `json:"archived"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// handleSessionList returns the sessions of the user in ?user= as JSON, most recently updated
+// first. ?tags=a,b keeps the sessions carrying any of the tags (every one of them with ?match=all);
+// archived sessions are left out unless ?archived=true.
+func (ag *Agentize) handleSessionList(c *gin.Context) {
+	userID := c.Query("user")
+	if userID == "" {
+		c.JSON(400, gin.H{"error": "user parameter is required"})
+		return
+	}
+	sh := model.NewSessionHandler(ag.engine.Sessions, model.DefaultSessionHandlerConfig())
+	var opts []model.ListSessionsOption
+	if c.Query("archived") == "true" {
+		opts = append(opts, model.OptIncludeArchived())
+	}
+
+	var sessions []*model.Session
+	var err error
+	if tags := splitTags(c.Query("tags")); len(tags) > 0 {
+		sessions, err = sh.FindSessionsByTags(userID, tags, c.Query("match") == "all", opts...)
+	} else {
+		sessions, err = sh.ListUserSessions(userID, opts...)
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to list sessions: %v", err)})
+		return
+	}
+
+	items := make([]sessionListItem, 0, len(sessions))
+	for _, s := range sessions {
+		items = append(items, sessionListItem{
+			SessionID: s.SessionID,
+			AgentType: s.AgentType,
+			Title:     s.Title,
+			Summary:   s.Summary,
+			Tags:      s.Tags,
+			Archived:  s.Archived,
+			CreatedAt: s.CreatedAt,
+			UpdatedAt: s.UpdatedAt,
+		})
+	}
+	c.JSON(200, gin.H{"sessions": items})
+}
+
+// splitTags splits a comma-separated ?tags= value (empty entries are dropped by model.NormalizeTags)
+func splitTags(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return model.NormalizeTags(strings.Split(value, ","))
+}
+
+// handleSessionExport returns a session and its records as a portable JSON document
+func (ag *Agentize) handleSessionExport(c *gin.Context) {
+	sessionID := c.Param("sessionID")
+	doc, err := model.NewSessionHandler(ag.engine.Sessions, model.DefaultSessionHandlerConfig()).ExportSession(sessionID)
+	if err != nil {
+		c.JSON(404, gin.H{"error": fmt.Sprintf("Failed to export session: %v", err)})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", sessionID+".json"))
+	c.JSON(200, doc)
+}
+
+// handleSessionImport writes a session exported by handleSessionExport into the store,
+// assigned to the user in ?user= when given
+func (ag *Agentize) handleSessionImport(c *gin.Context) {
+	var doc model.SessionExport
+	if err := c.ShouldBindJSON(&doc); err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid session export: %v", err)})
+		return
+	}
+	session, err := model.NewSessionHandler(ag.engine.Sessions, model.DefaultSessionHandlerConfig()).
+		ImportSession(&doc, model.ImportOptions{UserID: c.Query("user")})
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to import session: %v", err)})
+		return
+	}
+	c.JSON(200, gin.H{"session_id": session.SessionID, "user_id": session.UserID})
+}
+
+// feedbackRequest is the body of POST /api/messages/:messageID/feedback
+type feedbackRequest struct {
+	UserID  string `json:"user_id"` // optional; must be the owner of the message's session
+	Rating  int    `json:"rating"`  // 1 (thumbs up) or -1 (thumbs down)
+	Comment string `json:"comment"`
+}
+
+// handleMessageFeedback records a user's rating of an answer (see CoreHandler.RecordFeedback).
+// The rating is recorded for the owner of the message's session, not the user_id of the body.
+func (ag *Agentize) handleMessageFeedback(c *gin.Context) {
+	if ag.coreHandler == nil {
+		c.JSON(501, gin.H{"error": "no CoreHandler configured"})
+		return
+	}
+	var req feedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid feedback: %v", err)})
+		return
+	}
+	messageID := c.Param("messageID")
+	session, err := ag.coreHandler.GetSessionHandler().GetStore().Get(model.MessageSessionID(messageID))
+	if err != nil {
+		c.JSON(404, gin.H{"error": fmt.Sprintf("%v: %s", engine.ErrMessageNotFound, messageID)})
+		return
+	}
+	if req.UserID != "" && req.UserID != session.UserID {
+		c.JSON(403, gin.H{"error": fmt.Sprintf("%v: message %s belongs to another user", engine.ErrAccessDenied, messageID)})
+		return
+	}
+	feedback, err := ag.coreHandler.RecordFeedback(c.Request.Context(), session.UserID, messageID, req.Rating, req.Comment)
+	switch {
+	case errors.Is(err, model.ErrInvalidFeedback):
+		c.JSON(400, gin.H{"error": err.Error()})
+	case errors.Is(err, engine.ErrMessageNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, engine.ErrAccessDenied):
+		c.JSON(403, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to record feedback: %v", err)})
+	default:
+		c.JSON(200, feedback)
+	}
+}
+
+// handleFeedbackStats returns the feedback stats as JSON, optionally filtered by ?user=,
+// ?session=, ?message= and the ?from=/?to= time range
+func (ag *Agentize) handleFeedbackStats(c *gin.Context) {
+	handler, err := ag.createDebugHandler()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	feedbackStore, ok := handler.GetStore().(model.FeedbackStore)
+	if !ok {
+		c.JSON(501, gin.H{"error": "the store does not record feedback"})
+		return
+	}
+
+	tr, ok := getTimeRangeParam(c)
+	if !ok {
+		return
+	}
+	stats, err := feedbackStore.GetFeedbackStats(model.FeedbackFilter{
+		UserID:    c.Query("user"),
+		SessionID: c.Query("session"),
+		MessageID: c.Query("message"),
+		From:      tr.From,
+		To:        tr.To,
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to get feedback stats: %v", err)})
+		return
+	}
+	c.JSON(200, stats)
+}
+
+// memoryItem is a memory in the /api/users/:userID/memories response (without its embedding)
+type memoryItem struct {
+	MemoryID   string    `json:"memory_id"`
+	Key        string    `json:"key,omitempty"`
+	Text       string    `json:"text"`
+	Confidence float64   `json:"confidence"`
+	SessionID  string    `json:"session_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// handleUserMemories returns the long-term memories of a user as JSON, oldest first
+func (ag *Agentize) handleUserMemories(c *gin.Context) {
+	handler, err := ag.createDebugHandler()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	memoryStore, ok := handler.GetStore().(model.MemoryStore)
+	if !ok {
+		c.JSON(501, gin.H{"error": "the store does not keep memories"})
+		return
+	}
+
+	memories, err := memoryStore.GetMemoriesByUser(c.Param("userID"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to get memories: %v", err)})
+		return
+	}
+	items := make([]memoryItem, 0, len(memories))
+	for _, m := range memories {
+		items = append(items, memoryItem{
+			MemoryID:   m.MemoryID,
+			Key:        m.Key,
+			Text:       m.Text,
+			Confidence: m.Confidence,
+			SessionID:  m.SessionID,
+			CreatedAt:  m.CreatedAt,
+			LastUsedAt: m.LastUsedAt,
+		})
+	}
+	c.JSON(200, gin.H{"memories": items})
+}
+
+// handleUserMemoriesDelete deletes one memory of a user, or all of them when no memory ID is given
+func (ag *Agentize) handleUserMemoriesDelete(c *gin.Context) {
+	handler, err := ag.createDebugHandler()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	memoryStore, ok := handler.GetWriteStore().(model.MemoryStore)
+	if !ok {
+		c.JSON(501, gin.H{"error": "the store does not keep memories"})
+		return
+	}
+
+	var ids []string
+	if memoryID := c.Param("memoryID"); memoryID != "" {
+		ids = append(ids, memoryID)
+	}
+	deleted, err := memoryStore.DeleteMemories(c.Param("userID"), ids...)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to delete memories: %v", err)})
+		return
+	}
+	if len(ids) > 0 && deleted == 0 {
+		c.JSON(404, gin.H{"error": "memory not found"})
+		return
+	}
+	c.JSON(200, gin.H{"deleted": deleted})
+}
+
 // handleDocs handles documentation requests
 func (ag *Agentize) handleDocs(c *gin.Context) {
 	nodes := ag.GetAllNodes()
@@ -93,12 +435,33 @@ func (ag *Agentize) handleDocs(c *gin.Context) {
 	c.String(200, string(html))
 }
 
+// handleToolsJSON returns the agents' tool definitions as a JSON array
+func (ag *Agentize) handleToolsJSON(c *gin.Context) {
+	c.JSON(200, ag.ToolDefinitions())
+}
+
 // handleHealth handles health check requests
 func (ag *Agentize) handleHealth(c *gin.Context) {
+	reload := ag.GetRepository().GetReloadStats()
+	reloadInfo := gin.H{
+		"count":      reload.Count,
+		"last_error": reload.LastError,
+	}
+	if !reload.LastAt.IsZero() {
+		reloadInfo["last_at"] = reload.LastAt
+	}
+	cache := ag.GetRepository().GetCacheStats()
 	c.JSON(200, gin.H{
 		"status":  "ok",
-		"nodes":   len(ag.nodes),
+		"nodes":   len(ag.GetAllNodes()),
 		"version": Version(),
+		"reload":  reloadInfo,
+		"cache": gin.H{
+			"hits":    cache.Hits,
+			"misses":  cache.Misses,
+			"stale":   cache.Stale,
+			"entries": cache.Entries,
+		},
 	})
 }
 
@@ -129,6 +492,12 @@ func (ag *Agentize) createDebugHandler() (*debuger.DebugHandler, error) {
 	if ag.userBillingHTMLProvider != nil {
 		handler.SetUserBillingHTMLProvider(ag.userBillingHTMLProvider)
 	}
+	handler.SetRefreshInterval(ag.debugRefreshInterval)
+	if ag.debugReadStore != nil {
+		if err := handler.SetReadStore(ag.debugReadStore); err != nil {
+			return nil, err
+		}
+	}
 	return handler, nil
 }
 
@@ -145,6 +514,30 @@ func getPageParam(c *gin.Context) int {
 	return page
 }
 
+// getLimitOffsetParams extracts the page size (limit, defaults to components.DefaultItemsPerPage,
+// capped at components.MaxItemsPerPage) and the offset. Without an offset param it is derived from page.
+func getLimitOffsetParams(c *gin.Context) (limit, offset int) {
+	limit = components.DefaultItemsPerPage
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 {
+		limit = min(n, components.MaxItemsPerPage)
+	}
+	if n, err := strconv.Atoi(c.Query("offset")); err == nil && n >= 0 {
+		return limit, n
+	}
+	return limit, (getPageParam(c) - 1) * limit
+}
+
+// getTimeRangeParam parses the optional from/to query params (RFC3339 or relative like "1h").
+// On an invalid value it responds with 400 and returns false.
+func getTimeRangeParam(c *gin.Context) (debuger.TimeRange, bool) {
+	tr, err := debuger.ParseTimeRange(c.Query("from"), c.Query("to"), time.Now())
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return debuger.TimeRange{}, false
+	}
+	return tr, true
+}
+
 // handleDebug handles debug page requests for dashboard
 func (ag *Agentize) handleDebug(c *gin.Context) {
 	handler, err := ag.createDebugHandler()
@@ -153,7 +546,11 @@ func (ag *Agentize) handleDebug(c *gin.Context) {
 		return
 	}
 
-	html, err := pages.RenderDashboard(handler)
+	tr, ok := getTimeRangeParam(c)
+	if !ok {
+		return
+	}
+	html, err := pages.RenderDashboard(handler, tr)
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate debug page: %v", err)})
 		return
@@ -221,7 +618,7 @@ func (ag *Agentize) handleDebugUserDeleteData(c *gin.Context) {
 		return
 	}
 
-	if err := handler.GetStore().DeleteUserData(userID); err != nil {
+	if err := handler.GetWriteStore().DeleteUserData(userID); err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to delete user data: %v", err)})
 		return
 	}
@@ -236,6 +633,28 @@ func (ag *Agentize) handleDebugUserDeleteData(c *gin.Context) {
 	c.Redirect(302, "/agentize/debug/users/"+url.PathEscape(userID)+"?deleted=1")
 }
 
+// handleDebugUserUnban lifts a user's ban and redirects back to the user detail page
+func (ag *Agentize) handleDebugUserUnban(c *gin.Context) {
+	userID := c.Param("userID")
+	if userID == "" {
+		c.JSON(400, gin.H{"error": "userID parameter is required"})
+		return
+	}
+
+	handler, err := ag.createDebugHandler()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := engine.UnbanUser(handler.GetSessionStore(), userID, "Unbanned from the debug page"); err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to unban user: %v", err)})
+		return
+	}
+
+	c.Redirect(302, "/agentize/debug/users/"+url.PathEscape(userID))
+}
+
 // handleDebugSessions handles sessions list page requests
 func (ag *Agentize) handleDebugSessions(c *gin.Context) {
 	handler, err := ag.createDebugHandler()
@@ -245,7 +664,15 @@ func (ag *Agentize) handleDebugSessions(c *gin.Context) {
 	}
 
 	page := getPageParam(c)
-	html, err := pages.RenderSessions(handler, page)
+	tr, ok := getTimeRangeParam(c)
+	if !ok {
+		return
+	}
+	archived := c.Query("archived")
+	if archived != pages.ArchivedFilterActive && archived != pages.ArchivedFilterArchive {
+		archived = pages.ArchivedFilterAll
+	}
+	html, err := pages.RenderSessions(handler, page, tr, archived, splitTags(c.Query("tags")), c.Query("match") == "all")
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate sessions page: %v", err)})
 		return
@@ -269,7 +696,10 @@ func (ag *Agentize) handleDebugSessionDetail(c *gin.Context) {
 		return
 	}
 
-	html, err := pages.RenderSessionDetail(handler, sessionID)
+	html, err := pages.RenderSessionDetail(handler, sessionID, pages.SessionDetailOptions{
+		SummarizedLogID: c.Query("summarized"),
+		SummarizeError:  c.Query("summarize_error"),
+	})
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate session detail page: %v", err)})
 		return
@@ -279,6 +709,28 @@ func (ag *Agentize) handleDebugSessionDetail(c *gin.Context) {
 	c.String(200, html)
 }
 
+// handleDebugSessionSummarize force-summarizes a session and redirects back to its detail page
+func (ag *Agentize) handleDebugSessionSummarize(c *gin.Context) {
+	sessionID := c.Param("sessionID")
+	if sessionID == "" {
+		c.JSON(400, gin.H{"error": "sessionID parameter is required"})
+		return
+	}
+
+	redirectURL := "/agentize/debug/sessions/" + url.PathEscape(sessionID)
+	summLog, err := ag.SummarizeSessionNow(c.Request.Context(), sessionID)
+	switch {
+	case err != nil:
+		redirectURL += "?summarize_error=" + url.QueryEscape(err.Error())
+	case summLog == nil:
+		redirectURL += "?summarize_error=" + url.QueryEscape("session has no active messages to summarize")
+	default:
+		redirectURL += "?summarized=" + url.QueryEscape(summLog.LogID)
+	}
+
+	c.Redirect(302, redirectURL)
+}
+
 // handleDebugMessages handles messages list page requests
 func (ag *Agentize) handleDebugMessages(c *gin.Context) {
 	handler, err := ag.createDebugHandler()
@@ -290,7 +742,12 @@ func (ag *Agentize) handleDebugMessages(c *gin.Context) {
 	page := getPageParam(c)
 	userID := c.Query("user")
 	sessionID := c.Query("session")
-	html, err := pages.RenderMessages(handler, page, userID, sessionID)
+	role := c.Query("role")
+	tr, ok := getTimeRangeParam(c)
+	if !ok {
+		return
+	}
+	html, err := pages.RenderMessages(handler, page, userID, sessionID, role, tr)
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate messages page: %v", err)})
 		return
@@ -327,9 +784,13 @@ func (ag *Agentize) handleDebugToolCalls(c *gin.Context) {
 		return
 	}
 
-	page := getPageParam(c)
+	limit, offset := getLimitOffsetParams(c)
 	sessionID := c.Query("session")
-	html, err := pages.RenderToolCalls(handler, page, sessionID)
+	tr, ok := getTimeRangeParam(c)
+	if !ok {
+		return
+	}
+	html, err := pages.RenderToolCalls(handler, offset, limit, sessionID, tr)
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate tool calls page: %v", err)})
 		return
@@ -354,6 +815,10 @@ func (ag *Agentize) handleDebugToolCallDetail(c *gin.Context) {
 	}
 
 	html, err := pages.RenderToolCallDetail(handler, toolID)
+	if errors.Is(err, pages.ErrToolCallNotFound) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate tool call detail page: %v", err)})
 		return
@@ -371,8 +836,8 @@ func (ag *Agentize) handleDebugSummarized(c *gin.Context) {
 		return
 	}
 
-	page := getPageParam(c)
-	html, err := pages.RenderSummarized(handler, page)
+	limit, offset := getLimitOffsetParams(c)
+	html, err := pages.RenderSummarized(handler, offset, limit)
 	if err != nil {
 		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate summarization logs page: %v", err)})
 		return
@@ -498,3 +963,55 @@ const indexPageTemplate = `<!DOCTYPE html>
     </div>
 </body>
 </html>`
+
+// handleDebugUsage handles LLM usage page requests
+func (ag *Agentize) handleDebugUsage(c *gin.Context) {
+	handler, err := ag.createDebugHandler()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	tr, ok := getTimeRangeParam(c)
+	if !ok {
+		return
+	}
+	html, err := pages.RenderUsage(handler, c.Query("user"), tr)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate usage page: %v", err)})
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.String(200, html)
+}
+
+// handleDebugKnowledge handles the knowledge search index page requests
+func (ag *Agentize) handleDebugKnowledge(c *gin.Context) {
+	handler, err := ag.createDebugHandler()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	var stats *debuger.KnowledgeIndexStats
+	if ag.knowledgeIndex != nil {
+		index := ag.knowledgeIndex.Stats()
+		stats = &debuger.KnowledgeIndexStats{
+			TreeNodes: len(ag.GetAllNodes()),
+			Nodes:     index.Nodes,
+			Chunks:    index.Chunks,
+			Embedded:  index.Embedded,
+			LastBuilt: index.LastBuilt,
+			LastError: index.LastError,
+		}
+	}
+	html, err := pages.RenderKnowledge(handler, stats)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to generate knowledge page: %v", err)})
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.String(200, html)
+}
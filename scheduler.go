@@ -55,10 +55,52 @@ func (ag *Agentize) GetSchedulerMessageThreshold() int {
 // It reads configuration from environment variables or uses defaults
 // This should be called after UseLLMConfig to ensure LLM client is configured
 func (ag *Agentize) StartScheduler(ctx context.Context) error {
-	// Get LLM config from engine
-	llmConfig := ag.engine.GetLLMConfig()
-	if llmConfig.APIKey == "" {
-		return fmt.Errorf("LLM client is not configured. Call UseLLMConfig first")
+	sessionHandler, llmClient, err := ag.newSummarizationSessionHandler()
+	if err != nil {
+		return err
+	}
+
+	// Use the WithScheduler config, or load it from environment or use defaults
+	schedulerConfig := loadSchedulerConfig()
+	if ag.schedulerConfig != nil {
+		schedulerConfig = *ag.schedulerConfig
+	}
+	if summaryModel := ag.summarizationLLMConfig().SummaryModel; ag.summarizerLLM != nil && summaryModel != "" {
+		schedulerConfig.SummaryModel = summaryModel
+	}
+
+	// Check if scheduler is enabled
+	if enabled := os.Getenv("AGENTIZE_SCHEDULER_ENABLED"); enabled == "false" {
+		log.Log.Info("[Agentize] ⏸️  Scheduler is disabled via AGENTIZE_SCHEDULER_ENABLED=false")
+		return nil
+	}
+
+	// Create scheduler
+	if schedulerConfig.Logger == nil {
+		schedulerConfig.Logger = ag.engine.Logger
+	}
+	scheduler := engine.NewSessionScheduler(sessionHandler, llmClient, schedulerConfig)
+
+	ag.schedulerMu.Lock()
+	ag.scheduler = scheduler
+	ag.schedulerMu.Unlock()
+
+	// Start scheduler
+	scheduler.Start(ctx)
+
+	log.Log.Info("[Agentize] ✅ Session scheduler started",
+		"check_interval", schedulerConfig.CheckInterval, "first_threshold", schedulerConfig.FirstSummarizationThreshold, "subsequent_threshold", schedulerConfig.SubsequentMessageThreshold, "subsequent_time_threshold", schedulerConfig.SubsequentTimeThreshold, "summary_model", schedulerConfig.SummaryModel)
+
+	return nil
+}
+
+// newSummarizationSessionHandler creates a SessionHandler over the engine's store with an
+// LLM client that adds the user_id header from context
+func (ag *Agentize) newSummarizationSessionHandler() (*model.SessionHandler, *openai.Client, error) {
+	llmConfig := ag.summarizationLLMConfig()
+	// A summarizer on its own provider (e.g. a local model) may need no API key
+	if llmConfig.APIKey == "" && (ag.summarizerLLM == nil || ag.summarizerLLM.BaseURL == "") {
+		return nil, nil, fmt.Errorf("LLM client is not configured. Call UseLLMConfig first")
 	}
 
 	// Create a new LLM client with HTTP client wrapper that adds user_id header from context
@@ -71,42 +113,31 @@ func (ag *Agentize) StartScheduler(ctx context.Context) error {
 	// Get session store from engine
 	sessionStore := ag.engine.Sessions
 	if sessionStore == nil {
-		return fmt.Errorf("session store is not available")
+		return nil, nil, fmt.Errorf("session store is not available")
 	}
 
 	// Create session handler from session store
 	sessionHandlerConfig := model.DefaultSessionHandlerConfig()
+	if llmConfig.SummaryModel != "" {
+		sessionHandlerConfig.SummaryModel = llmConfig.SummaryModel
+	}
 	sessionHandler := model.NewSessionHandler(sessionStore, sessionHandlerConfig)
 
 	// Set LLM client for session handler
 	llmClientWrapper := &OpenAIClientWrapperForSessionHandler{Client: llmClient}
 	sessionHandler.SetLLMClient(llmClientWrapper)
 
-	// Load scheduler config from environment or use defaults
-	schedulerConfig := loadSchedulerConfig()
+	return sessionHandler, llmClient, nil
+}
 
-	// Check if scheduler is enabled
-	if enabled := os.Getenv("AGENTIZE_SCHEDULER_ENABLED"); enabled == "false" {
-		log.Log.Infof("[Agentize] ⏸️  Scheduler is disabled via AGENTIZE_SCHEDULER_ENABLED=false")
-		return nil
+// SummarizeSessionNow force-summarizes a session immediately, ignoring scheduler thresholds.
+// It returns the summarization log so callers (e.g. the debug UI) can show the outcome.
+func (ag *Agentize) SummarizeSessionNow(ctx context.Context, sessionID string) (*model.SummarizationLog, error) {
+	sessionHandler, _, err := ag.newSummarizationSessionHandler()
+	if err != nil {
+		return nil, err
 	}
-
-	// Create scheduler
-	scheduler := engine.NewSessionScheduler(sessionHandler, llmClient, schedulerConfig)
-
-	ag.schedulerMu.Lock()
-	ag.scheduler = scheduler
-	ag.schedulerMu.Unlock()
-
-	// Start scheduler
-	scheduler.Start(ctx)
-
-	log.Log.Infof("[Agentize] ✅ Session scheduler started | CheckInterval: %v | FirstThreshold: %d msgs | SubsequentThreshold: %d msgs + %v | SummaryModel: %s",
-		schedulerConfig.CheckInterval, schedulerConfig.FirstSummarizationThreshold,
-		schedulerConfig.SubsequentMessageThreshold, schedulerConfig.SubsequentTimeThreshold,
-		schedulerConfig.SummaryModel)
-
-	return nil
+	return sessionHandler.SummarizeNow(ctx, sessionID)
 }
 
 // loadSchedulerConfig loads scheduler configuration from environment variables
@@ -153,7 +184,7 @@ func (ag *Agentize) StopScheduler() {
 
 	if scheduler != nil {
 		scheduler.Stop()
-		log.Log.Infof("[Agentize] 🛑 Session scheduler stopped")
+		log.Log.Info("[Agentize] 🛑 Session scheduler stopped")
 	}
 }
 
@@ -53,7 +53,7 @@ func ExampleNewSQLiteStoreFromFile() {
 	// Output: SQLite store created successfully
 }
 
-func ExampleAgentizeWithSQLite() {
+func Example_sqlite() {
 	// Example of using SQLiteStore with Agentize
 	// This would be in your application code:
 
@@ -71,9 +71,7 @@ func ExampleAgentizeWithSQLite() {
 		defer sqliteStore.Close()
 
 		// Create Agentize with SQLite store
-		ag, err := agentize.NewWithOptions("./knowledge", &agentize.Options{
-			SessionStore: sqliteStore,
-		})
+		ag, err := agentize.New("./knowledge", agentize.WithStore(sqliteStore))
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -128,7 +126,7 @@ func ExampleNewMongoDBStoreFromURI() {
 	// If MongoDB is not running: "Error creating MongoDB store: failed to ping MongoDB: ..."
 }
 
-func ExampleAgentizeWithMongoDB() {
+func Example_mongoDB() {
 	// Example of using MongoDBStore with Agentize
 	// This would be in your application code:
 
@@ -151,9 +149,7 @@ func ExampleAgentizeWithMongoDB() {
 		defer mongoStore.Close()
 
 		// Create Agentize with MongoDB store
-		ag, err := agentize.NewWithOptions("./knowledge", &agentize.Options{
-			SessionStore: mongoStore,
-		})
+		ag, err := agentize.New("./knowledge", agentize.WithStore(mongoStore))
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -1,8 +1,16 @@
 package store
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 // parseToolSeqFromToolID extracts sequence number from ToolID.
@@ -18,3 +26,113 @@ func parseToolSeqFromToolID(toolID string) int {
 	}
 	return seq
 }
+
+// timeRangeWhere builds a " WHERE column >= ? AND column <= ?" clause over unix-second columns.
+// Zero bounds are omitted; returns an empty clause when both are zero.
+func timeRangeWhere(column string, from, to time.Time) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if !from.IsZero() {
+		conds = append(conds, column+" >= ?")
+		args = append(args, from.Unix())
+	}
+	if !to.IsZero() {
+		conds = append(conds, column+" <= ?")
+		args = append(args, to.Unix())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// timeRangeFilter builds a MongoDB filter on a date field; zero bounds are omitted
+func timeRangeFilter(field string, from, to time.Time) bson.M {
+	cond := bson.M{}
+	if !from.IsZero() {
+		cond["$gte"] = from
+	}
+	if !to.IsZero() {
+		cond["$lte"] = to
+	}
+	if len(cond) == 0 {
+		return bson.M{}
+	}
+	return bson.M{field: cond}
+}
+
+// namespaceSeparator separates a store namespace from the IDs it is prefixed onto
+const namespaceSeparator = ":"
+
+// validateNamespace rejects namespaces containing the separator, which could make the IDs of
+// two namespaces collide ("a" + "b:1" and "a:b" + "1")
+func validateNamespace(namespace string) error {
+	if strings.Contains(namespace, namespaceSeparator) {
+		return fmt.Errorf("namespace %q must not contain %q", namespace, namespaceSeparator)
+	}
+	return nil
+}
+
+// namespacedID prefixes namespace onto a user, session, message, tool call or file ID.
+// Empty IDs stay empty so unset columns are not given a value.
+func namespacedID(namespace, id string) string {
+	if namespace == "" || id == "" {
+		return id
+	}
+	return namespace + namespaceSeparator + id
+}
+
+// localID strips namespace from an ID read from the database
+func localID(namespace, id string) string {
+	if namespace == "" {
+		return id
+	}
+	return strings.TrimPrefix(id, namespace+namespaceSeparator)
+}
+
+// namespaceLikePattern returns the LIKE pattern (escape character '\') matching the IDs of namespace
+func namespaceLikePattern(namespace string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(namespace + namespaceSeparator)
+	return escaped + "%"
+}
+
+// namespaceRegex returns the MongoDB regex matching the IDs of namespace
+func namespaceRegex(namespace string) bson.M {
+	return bson.M{"$regex": "^" + regexp.QuoteMeta(namespace+namespaceSeparator)}
+}
+
+// sourcesColumn stores ToolCall.Sources as JSON in a TEXT column (” when there are none)
+type sourcesColumn []model.Citation
+
+// Value implements driver.Valuer
+func (c sourcesColumn) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal([]model.Citation(c))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sources: %w", err)
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (c *sourcesColumn) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("unsupported sources value %T", src)
+	}
+	if len(data) == 0 {
+		*c = nil
+		return nil
+	}
+	return json.Unmarshal(data, (*[]model.Citation)(c))
+}
@@ -21,12 +21,6 @@ type DBStore struct {
 	// Read cache for users
 	usersCache map[string]*model.User
 	usersMu    sync.RWMutex
-
-	// UserNodes tracks visited nodes for each user (user-level, not session-level)
-	// This stays in-memory for performance as it's frequently accessed
-	userNodes sync.Map
-	userLock  map[string]*sync.Mutex
-	nodesMu   sync.RWMutex // Protects userLock map
 }
 
 // UserNodes represents visited nodes for a user
@@ -52,7 +46,6 @@ func NewDBStoreWithPath(dbPath string) (*DBStore, error) {
 		sqliteStore:   sqliteStore,
 		sessionsCache: make(map[string]*model.Session),
 		usersCache:    make(map[string]*model.User),
-		userLock:      make(map[string]*sync.Mutex),
 	}, nil
 }
 
@@ -64,29 +57,6 @@ func (s *DBStore) Close() error {
 	return nil
 }
 
-// getOrCreateLock gets or creates a mutex for a userID
-func (s *DBStore) getOrCreateLock(userID string) *sync.Mutex {
-	s.nodesMu.RLock()
-	lock, exists := s.userLock[userID]
-	s.nodesMu.RUnlock()
-
-	if exists {
-		return lock
-	}
-
-	s.nodesMu.Lock()
-	defer s.nodesMu.Unlock()
-
-	// Double check after acquiring write lock
-	if lock, exists := s.userLock[userID]; exists {
-		return lock
-	}
-
-	lock = &sync.Mutex{}
-	s.userLock[userID] = lock
-	return lock
-}
-
 // Get retrieves a session by ID
 // First checks cache, then falls back to database
 func (s *DBStore) Get(sessionID string) (*model.Session, error) {
@@ -161,94 +131,35 @@ func (s *DBStore) GetAllSessions() (map[string][]*model.Session, error) {
 	return s.sqliteStore.GetAllSessions()
 }
 
-// AddVisitedNode adds a visited node for a user
-// This tracks nodes at user level, across all sessions (in-memory only for performance)
-func (s *DBStore) AddVisitedNode(userID string, nodeDigest *model.NodeDigest) {
-	if nodeDigest == nil {
-		return
-	}
+// GetSessionsByTimeRange implements debuger.DebugStore (delegates to SQLiteStore)
+func (s *DBStore) GetSessionsByTimeRange(from, to time.Time) (map[string][]*model.Session, error) {
+	return s.sqliteStore.GetSessionsByTimeRange(from, to)
+}
 
-	lock := s.getOrCreateLock(userID)
-	lock.Lock()
-	defer lock.Unlock()
-
-	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		if un.VisitedNodes == nil {
-			un.VisitedNodes = make(map[string]*model.NodeDigest)
-		}
-		un.VisitedNodes[nodeDigest.Path] = nodeDigest
-		un.LastActivity = time.Now()
-		s.userNodes.Store(userID, un)
-	} else {
-		un := &UserNodes{
-			VisitedNodes: map[string]*model.NodeDigest{
-				nodeDigest.Path: nodeDigest,
-			},
-			LastActivity: time.Now(),
-		}
-		s.userNodes.Store(userID, un)
-	}
+// AddVisitedNode adds a visited node for a user (delegates to SQLiteStore)
+// This tracks nodes at user level, across all sessions
+func (s *DBStore) AddVisitedNode(userID string, nodeDigest *model.NodeDigest) {
+	s.sqliteStore.AddVisitedNode(userID, nodeDigest)
 }
 
-// GetVisitedNodes returns all visited nodes for a user
+// GetVisitedNodes returns all visited nodes for a user (delegates to SQLiteStore)
 func (s *DBStore) GetVisitedNodes(userID string) map[string]*model.NodeDigest {
-	lock := s.getOrCreateLock(userID)
-	lock.Lock()
-	defer lock.Unlock()
-
-	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		// Return a copy to prevent external modification
-		result := make(map[string]*model.NodeDigest)
-		for k, v := range un.VisitedNodes {
-			// Create a copy of NodeDigest
-			digestCopy := *v
-			result[k] = &digestCopy
-		}
-		return result
-	}
-	return make(map[string]*model.NodeDigest)
+	return s.sqliteStore.GetVisitedNodes(userID)
 }
 
-// GetVisitedNodePaths returns a list of visited node paths for a user
+// GetVisitedNodePaths returns a list of visited node paths for a user (delegates to SQLiteStore)
 func (s *DBStore) GetVisitedNodePaths(userID string) []string {
-	lock := s.getOrCreateLock(userID)
-	lock.Lock()
-	defer lock.Unlock()
-
-	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		paths := make([]string, 0, len(un.VisitedNodes))
-		for path := range un.VisitedNodes {
-			paths = append(paths, path)
-		}
-		return paths
-	}
-	return []string{}
+	return s.sqliteStore.GetVisitedNodePaths(userID)
 }
 
-// HasVisitedNode checks if a user has visited a specific node
+// HasVisitedNode checks if a user has visited a specific node (delegates to SQLiteStore)
 func (s *DBStore) HasVisitedNode(userID string, nodePath string) bool {
-	lock := s.getOrCreateLock(userID)
-	lock.Lock()
-	defer lock.Unlock()
-
-	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		_, exists := un.VisitedNodes[nodePath]
-		return exists
-	}
-	return false
+	return s.sqliteStore.HasVisitedNode(userID, nodePath)
 }
 
-// ClearVisitedNodes clears all visited nodes for a user
+// ClearVisitedNodes clears all visited nodes for a user (delegates to SQLiteStore)
 func (s *DBStore) ClearVisitedNodes(userID string) {
-	lock := s.getOrCreateLock(userID)
-	lock.Lock()
-	defer lock.Unlock()
-
-	s.userNodes.Delete(userID)
+	s.sqliteStore.ClearVisitedNodes(userID)
 }
 
 // GetUser retrieves a user by ID
@@ -348,6 +259,11 @@ func (s *DBStore) GetAllMessages() ([]*model.Message, error) {
 	return s.sqliteStore.GetAllMessages()
 }
 
+// GetMessagesByTimeRange implements debuger.DebugStore (delegates to SQLiteStore)
+func (s *DBStore) GetMessagesByTimeRange(from, to time.Time) ([]*model.Message, error) {
+	return s.sqliteStore.GetMessagesByTimeRange(from, to)
+}
+
 // GetAllOpenedFiles returns all opened files (delegates to SQLiteStore)
 func (s *DBStore) GetAllOpenedFiles() ([]*model.OpenedFile, error) {
 	return s.sqliteStore.GetAllOpenedFiles()
@@ -363,6 +279,16 @@ func (s *DBStore) GetAllToolCalls() ([]*model.ToolCall, error) {
 	return s.sqliteStore.GetAllToolCalls()
 }
 
+// GetToolCallsPaginated implements debuger.DebugStore (delegates to SQLiteStore)
+func (s *DBStore) GetToolCallsPaginated(offset, limit int) ([]*model.ToolCall, int, error) {
+	return s.sqliteStore.GetToolCallsPaginated(offset, limit)
+}
+
+// GetToolCallsByTimeRange implements debuger.DebugStore (delegates to SQLiteStore)
+func (s *DBStore) GetToolCallsByTimeRange(from, to time.Time) ([]*model.ToolCall, error) {
+	return s.sqliteStore.GetToolCallsByTimeRange(from, to)
+}
+
 // GetToolCallsBySession returns all tool calls for a session (delegates to SQLiteStore)
 func (s *DBStore) GetToolCallsBySession(sessionID string) ([]*model.ToolCall, error) {
 	return s.sqliteStore.GetToolCallsBySession(sessionID)
@@ -378,6 +304,11 @@ func (s *DBStore) GetToolCallByToolID(toolID string) (*model.ToolCall, error) {
 	return s.sqliteStore.GetToolCallByToolID(toolID)
 }
 
+// GetToolCall implements debuger.DebugStore (delegates to SQLiteStore)
+func (s *DBStore) GetToolCall(toolID string) (*model.ToolCall, error) {
+	return s.sqliteStore.GetToolCall(toolID)
+}
+
 // PutToolCall stores a tool call (delegates to SQLiteStore)
 func (s *DBStore) PutToolCall(toolCall *model.ToolCall) error {
 	return s.sqliteStore.PutToolCall(toolCall)
@@ -388,6 +319,101 @@ func (s *DBStore) UpdateToolCallResponse(toolID string, response string, execErr
 	return s.sqliteStore.UpdateToolCallResponse(toolID, response, execErr)
 }
 
+// SetToolCallSources stores the citations of a web search tool call (delegates to SQLiteStore)
+func (s *DBStore) SetToolCallSources(toolID string, sources []model.Citation) error {
+	return s.sqliteStore.SetToolCallSources(toolID, sources)
+}
+
+// MarkToolCallCacheHit marks a tool call answered from the tool result cache (delegates to SQLiteStore)
+func (s *DBStore) MarkToolCallCacheHit(toolID string) error {
+	return s.sqliteStore.MarkToolCallCacheHit(toolID)
+}
+
+// PutModerationEvent implements model.ModerationEventStore (delegates to SQLiteStore)
+func (s *DBStore) PutModerationEvent(event *model.ModerationEvent) error {
+	return s.sqliteStore.PutModerationEvent(event)
+}
+
+// GetModerationEventsByUser implements model.ModerationEventStore (delegates to SQLiteStore)
+func (s *DBStore) GetModerationEventsByUser(userID string) ([]*model.ModerationEvent, error) {
+	return s.sqliteStore.GetModerationEventsByUser(userID)
+}
+
+// PutUsageRecord implements model.UsageStore (delegates to SQLiteStore)
+func (s *DBStore) PutUsageRecord(record *model.UsageRecord) error {
+	return s.sqliteStore.PutUsageRecord(record)
+}
+
+// GetUsageSummary implements model.UsageStore (delegates to SQLiteStore)
+func (s *DBStore) GetUsageSummary(userID string, from, to time.Time) (*model.UsageSummary, error) {
+	return s.sqliteStore.GetUsageSummary(userID, from, to)
+}
+
+// PutFeedback implements model.FeedbackStore (delegates to SQLiteStore)
+func (s *DBStore) PutFeedback(feedback *model.Feedback) error {
+	return s.sqliteStore.PutFeedback(feedback)
+}
+
+// GetFeedbackByMessage implements model.FeedbackStore (delegates to SQLiteStore)
+func (s *DBStore) GetFeedbackByMessage(messageID string) ([]*model.Feedback, error) {
+	return s.sqliteStore.GetFeedbackByMessage(messageID)
+}
+
+// GetFeedbackStats implements model.FeedbackStore (delegates to SQLiteStore)
+func (s *DBStore) GetFeedbackStats(filter model.FeedbackFilter) (*model.FeedbackStats, error) {
+	return s.sqliteStore.GetFeedbackStats(filter)
+}
+
+// GetFeedbackStatsByMessages implements model.FeedbackStore (delegates to SQLiteStore)
+func (s *DBStore) GetFeedbackStatsByMessages(messageIDs []string) (map[string]*model.FeedbackStats, error) {
+	return s.sqliteStore.GetFeedbackStatsByMessages(messageIDs)
+}
+
+// FindSessionsByTags implements model.SessionTagStore (delegates to SQLiteStore)
+func (s *DBStore) FindSessionsByTags(userID string, tags []string, matchAll bool) ([]*model.Session, error) {
+	return s.sqliteStore.FindSessionsByTags(userID, tags, matchAll)
+}
+
+// PutMemory implements model.MemoryStore (delegates to SQLiteStore)
+func (s *DBStore) PutMemory(memory *model.MemoryRecord) error {
+	return s.sqliteStore.PutMemory(memory)
+}
+
+// GetMemoriesByUser implements model.MemoryStore (delegates to SQLiteStore)
+func (s *DBStore) GetMemoriesByUser(userID string) ([]*model.MemoryRecord, error) {
+	return s.sqliteStore.GetMemoriesByUser(userID)
+}
+
+// DeleteMemories implements model.MemoryStore (delegates to SQLiteStore)
+func (s *DBStore) DeleteMemories(userID string, memoryIDs ...string) (int, error) {
+	return s.sqliteStore.DeleteMemories(userID, memoryIDs...)
+}
+
+// TouchMemories implements model.MemoryStore (delegates to SQLiteStore)
+func (s *DBStore) TouchMemories(userID string, memoryIDs []string, at time.Time) error {
+	return s.sqliteStore.TouchMemories(userID, memoryIDs, at)
+}
+
+// GetKnowledgeChunks implements model.KnowledgeIndexStore (delegates to SQLiteStore)
+func (s *DBStore) GetKnowledgeChunks() ([]*model.KnowledgeChunk, error) {
+	return s.sqliteStore.GetKnowledgeChunks()
+}
+
+// ReplaceKnowledgeChunks implements model.KnowledgeIndexStore (delegates to SQLiteStore)
+func (s *DBStore) ReplaceKnowledgeChunks(chunks []*model.KnowledgeChunk) error {
+	return s.sqliteStore.ReplaceKnowledgeChunks(chunks)
+}
+
+// GetSessionStats returns aggregate statistics for a session
+func (s *DBStore) GetSessionStats(sessionID string) (*model.SessionStats, error) {
+	return s.sqliteStore.GetSessionStats(sessionID)
+}
+
+// GetUserStats returns aggregate statistics for a user
+func (s *DBStore) GetUserStats(userID string) (*model.UserStats, error) {
+	return s.sqliteStore.GetUserStats(userID)
+}
+
 // DeleteUserData deletes all sessions, messages, tool calls, summarization logs,
 // and opened files for a user (delegates to SQLiteStore and clears caches)
 func (s *DBStore) DeleteUserData(userID string) error {
@@ -413,6 +439,23 @@ func (s *DBStore) DeleteUserData(userID string) error {
 	return nil
 }
 
+// DeleteSessionsBefore implements SessionPurger (delegates to SQLiteStore and clears the
+// deleted sessions from the cache)
+func (s *DBStore) DeleteSessionsBefore(cutoff time.Time, core bool) ([]string, error) {
+	sessionIDs, err := s.sqliteStore.DeleteSessionsBefore(cutoff, core)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sessionsMu.Lock()
+	for _, sessionID := range sessionIDs {
+		delete(s.sessionsCache, sessionID)
+	}
+	s.sessionsMu.Unlock()
+
+	return sessionIDs, nil
+}
+
 // SessionStore is an alias for model.SessionStore for backward compatibility
 type SessionStore = model.SessionStore
 
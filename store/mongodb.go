@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ghiac/agentize/log"
@@ -14,6 +15,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 // MongoDBStore is a MongoDB implementation of SessionStore and DebugStore
@@ -30,11 +32,29 @@ type MongoDBStore struct {
 	toolCallsCollection         *mongo.Collection
 	openedFilesCollection       *mongo.Collection
 	summarizationLogsCollection *mongo.Collection
-
-	// UserNodes tracks visited nodes for each user (user-level, not session-level)
+	moderationEventsCollection  *mongo.Collection
+	usageRecordsCollection      *mongo.Collection
+	memoriesCollection          *mongo.Collection
+	knowledgeChunksCollection   *mongo.Collection
+	feedbackCollection          *mongo.Collection
+	visitedNodesCollection      *mongo.Collection
+
+	// UserNodes caches visited nodes for each user (user-level, not session-level);
+	// the visited_nodes collection is the source of truth
 	userNodes sync.Map
 	userLock  map[string]*sync.Mutex
 	nodesMu   sync.RWMutex // Protects userLock map
+
+	// namespace scopes the store to one tenant (see MongoDBStoreConfig.Namespace)
+	namespace string
+
+	// logs receives the store's logs (see SetLogger)
+	logs atomic.Pointer[log.FieldLogger]
+
+	// Operation timeouts (see MongoDBStoreConfig)
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	scanTimeout  time.Duration
 }
 
 // MongoDBStoreConfig holds configuration for MongoDBStore
@@ -42,19 +62,46 @@ type MongoDBStoreConfig struct {
 	URI        string // MongoDB connection URI (e.g., "mongodb://localhost:27017")
 	Database   string // Database name (default: "agentize")
 	Collection string // Collection name (default: "sessions")
+	// Namespace isolates tenants sharing one database: it is prefixed onto every user, session,
+	// message, tool call and file ID the store writes, and every listing only covers its own IDs.
+	// Empty means no namespace (sees every document). Must not contain ":".
+	Namespace string
+	// ReadPreference selects the replica set members reads go to: "primary" (default),
+	// "primaryPreferred", "secondary", "secondaryPreferred" or "nearest". Writes always go to the primary.
+	ReadPreference string
+
+	// ReadTimeout bounds single-record reads (a session, a user, one session's messages),
+	// WriteTimeout every write and ScanTimeout operations over many records (all users' data,
+	// paginated lists, aggregates, deleting a user's data). Zero uses the defaults below.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	ScanTimeout  time.Duration
 }
 
+// Default operation timeouts of MongoDBStore (see MongoDBStoreConfig)
+const (
+	DefaultMongoReadTimeout  = 12 * time.Second
+	DefaultMongoWriteTimeout = 10 * time.Second
+	DefaultMongoScanTimeout  = 30 * time.Second
+)
+
 // DefaultMongoDBStoreConfig returns default configuration
 func DefaultMongoDBStoreConfig() MongoDBStoreConfig {
 	return MongoDBStoreConfig{
-		URI:        "mongodb://localhost:27017",
-		Database:   "agentize",
-		Collection: "sessions",
+		URI:          "mongodb://localhost:27017",
+		Database:     "agentize",
+		Collection:   "sessions",
+		ReadTimeout:  DefaultMongoReadTimeout,
+		WriteTimeout: DefaultMongoWriteTimeout,
+		ScanTimeout:  DefaultMongoScanTimeout,
 	}
 }
 
 // NewMongoDBStore creates a new MongoDB session store
 func NewMongoDBStore(config MongoDBStoreConfig) (*MongoDBStore, error) {
+	if err := validateNamespace(config.Namespace); err != nil {
+		return nil, err
+	}
 	if config.URI == "" {
 		config.URI = "mongodb://localhost:27017"
 	}
@@ -64,6 +111,25 @@ func NewMongoDBStore(config MongoDBStoreConfig) (*MongoDBStore, error) {
 	if config.Collection == "" {
 		config.Collection = "sessions"
 	}
+	if config.ReadTimeout <= 0 {
+		config.ReadTimeout = DefaultMongoReadTimeout
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = DefaultMongoWriteTimeout
+	}
+	if config.ScanTimeout <= 0 {
+		config.ScanTimeout = DefaultMongoScanTimeout
+	}
+	readPref := readpref.Primary()
+	if config.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(config.ReadPreference)
+		if err != nil {
+			return nil, fmt.Errorf("invalid read preference %q: %w", config.ReadPreference, err)
+		}
+		if readPref, err = readpref.New(mode); err != nil {
+			return nil, fmt.Errorf("invalid read preference %q: %w", config.ReadPreference, err)
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -76,6 +142,7 @@ func NewMongoDBStore(config MongoDBStoreConfig) (*MongoDBStore, error) {
 		SetMaxConnIdleTime(30 * time.Minute).      // Close idle connections after 30 minutes
 		SetRetryWrites(true).                      // Retry write operations on transient errors
 		SetRetryReads(true).                       // Retry read operations on transient errors
+		SetReadPreference(readPref).               // Replica set members reads go to
 		SetServerSelectionTimeout(5 * time.Second) // Timeout for server selection
 
 	client, err := mongo.Connect(ctx, clientOptions)
@@ -100,7 +167,17 @@ func NewMongoDBStore(config MongoDBStoreConfig) (*MongoDBStore, error) {
 		toolCallsCollection:         database.Collection("tool_calls"),
 		openedFilesCollection:       database.Collection("opened_files"),
 		summarizationLogsCollection: database.Collection("summarization_logs"),
+		moderationEventsCollection:  database.Collection("moderation_events"),
+		usageRecordsCollection:      database.Collection("usage_records"),
+		memoriesCollection:          database.Collection("memories"),
+		knowledgeChunksCollection:   database.Collection("knowledge_chunks"),
+		feedbackCollection:          database.Collection("feedback"),
+		visitedNodesCollection:      database.Collection("visited_nodes"),
 		userLock:                    make(map[string]*sync.Mutex),
+		namespace:                   config.Namespace,
+		readTimeout:                 config.ReadTimeout,
+		writeTimeout:                config.WriteTimeout,
+		scanTimeout:                 config.ScanTimeout,
 	}
 
 	// Create indexes
@@ -109,9 +186,35 @@ func NewMongoDBStore(config MongoDBStoreConfig) (*MongoDBStore, error) {
 		return nil, fmt.Errorf("failed to create indexes: %w", err)
 	}
 
+	if err := store.backfillSessionTags(ctx); err != nil {
+		store.logger().Warn("[MongoDBStore] ⚠️  Failed to index the tags of existing sessions", "error", err)
+	}
+
 	return store, nil
 }
 
+// backfillSessionTags sets the tags field of sessions stored before it existed
+func (s *MongoDBStore) backfillSessionTags(ctx context.Context) error {
+	cursor, err := s.collection.Find(ctx, bson.M{"tags": bson.M{"$exists": false}}, options.Find().SetProjection(bson.M{"data": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc sessionDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		var session struct{ Tags []string }
+		_ = unmarshalJSONOrBSON(doc.Data, &session)
+		if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": doc.SessionID},
+			bson.M{"$set": bson.M{"tags": model.NormalizeTags(session.Tags)}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
 // unmarshalJSONOrBSON tries to unmarshal JSON first, falls back to BSON for backward compatibility
 // This handles the case where old data was stored as BSON but new code expects JSON
 func unmarshalJSONOrBSON(data string, v interface{}) error {
@@ -141,14 +244,28 @@ func (s *MongoDBStore) initIndexes(ctx context.Context) error {
 		return fmt.Errorf("failed to create updated_at index: %w", err)
 	}
 
-	// Unique index for Core sessions (one Core session per user)
+	// Multikey index for FindSessionsByTags: user_id + tags
+	_, err = s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user_id", Value: 1},
+			{Key: "tags", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create user_id+tags index: %w", err)
+	}
+
+	// Unique index for Core sessions (one non-archived Core session per user).
+	// It replaces the older index that also covered archived sessions.
+	_, _ = s.collection.Indexes().DropOne(ctx, "user_id_1_agent_type_1")
 	_, err = s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys: bson.D{
 			{Key: "user_id", Value: 1},
 			{Key: "agent_type", Value: 1},
 		},
-		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+		Options: options.Index().SetName("user_id_1_agent_type_1_active_core").SetUnique(true).SetPartialFilterExpression(bson.M{
 			"agent_type": "core",
+			"archived":   false,
 		}),
 	})
 	if err != nil {
@@ -215,6 +332,14 @@ func (s *MongoDBStore) initIndexes(ctx context.Context) error {
 		return fmt.Errorf("failed to create messages user_id+created_at index: %w", err)
 	}
 
+	// Index for GetMessagesByTimeRange: created_at DESC
+	_, err = s.messagesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create messages created_at index: %w", err)
+	}
+
 	// ============================================================================
 	// ToolCalls Collection Indexes
 	// ============================================================================
@@ -230,6 +355,14 @@ func (s *MongoDBStore) initIndexes(ctx context.Context) error {
 		return fmt.Errorf("failed to create tool_calls session_id+created_at index: %w", err)
 	}
 
+	// Index for GetToolCallsByTimeRange: created_at DESC
+	_, err = s.toolCallsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create tool_calls created_at index: %w", err)
+	}
+
 	// Unique index for GetToolCallByToolID: tool_id (prevents duplicates)
 	// Use partial filter to only index non-null tool_id values (for backward compatibility with old data)
 	// This allows documents with null/missing tool_id to coexist without violating unique constraint
@@ -291,6 +424,76 @@ func (s *MongoDBStore) initIndexes(ctx context.Context) error {
 		return fmt.Errorf("failed to create summarization_logs session_id+created_at index: %w", err)
 	}
 
+	// Index for GetSummarizationLogsPaginated: created_at DESC
+	_, err = s.summarizationLogsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create summarization_logs created_at index: %w", err)
+	}
+
+	// Index for CountSummarizationLogsByStatus
+	_, err = s.summarizationLogsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create summarization_logs status index: %w", err)
+	}
+
+	// Index for GetModerationEventsByUser: user_id + created_at DESC
+	_, err = s.moderationEventsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user_id", Value: 1},
+			{Key: "created_at", Value: -1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create moderation_events user_id+created_at index: %w", err)
+	}
+
+	// Index for GetUsageSummary: user_id + created_at
+	_, err = s.usageRecordsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user_id", Value: 1},
+			{Key: "created_at", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create usage_records user_id+created_at index: %w", err)
+	}
+
+	// Index for GetMemoriesByUser: user_id + created_at
+	_, err = s.memoriesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user_id", Value: 1},
+			{Key: "created_at", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create memories user_id+created_at index: %w", err)
+	}
+
+	// Indexes for GetFeedbackByMessage and GetFeedbackStats: message_id, user_id + created_at
+	_, err = s.feedbackCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "message_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create feedback indexes: %w", err)
+	}
+
+	// Unique index for visited nodes: one document per user and node path
+	_, err = s.visitedNodesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user_id", Value: 1},
+			{Key: "node_path", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create visited_nodes user_id+node_path index: %w", err)
+	}
+
 	return nil
 }
 
@@ -301,6 +504,42 @@ func (s *MongoDBStore) Close() error {
 	return s.client.Disconnect(ctx)
 }
 
+// Namespace returns the namespace the store is scoped to ("" if none)
+func (s *MongoDBStore) Namespace() string {
+	return s.namespace
+}
+
+// SetLogger sets the logger receiving the store's logs (nil: log.Log)
+func (s *MongoDBStore) SetLogger(l log.FieldLogger) {
+	s.logs.Store(&l)
+}
+
+// logger returns the store's logger (see SetLogger)
+func (s *MongoDBStore) logger() log.FieldLogger {
+	if l := s.logs.Load(); l != nil {
+		return log.Or(*l)
+	}
+	return log.Log
+}
+
+// id prefixes the store namespace onto an ID written to or looked up in the database
+func (s *MongoDBStore) id(id string) string {
+	return namespacedID(s.namespace, id)
+}
+
+// scope adds the namespace condition on field to filter, so listings never return
+// documents of another namespace
+func (s *MongoDBStore) scope(filter bson.M, field string) bson.M {
+	if s.namespace == "" {
+		return filter
+	}
+	scoped := bson.M{field: namespaceRegex(s.namespace)}
+	for k, v := range filter {
+		scoped[k] = v
+	}
+	return scoped
+}
+
 // getOrCreateLock gets or creates a mutex for a userID
 func (s *MongoDBStore) getOrCreateLock(userID string) *sync.Mutex {
 	s.nodesMu.RLock()
@@ -331,6 +570,8 @@ type sessionDocument struct {
 	AgentType  string    `bson:"agent_type"`
 	SessionSeq int       `bson:"session_seq"`
 	Data       string    `bson:"data"` // JSON serialized Session
+	Archived   bool      `bson:"archived"`
+	Tags       []string  `bson:"tags"` // normalized Session.Tags, for FindSessionsByTags
 	CreatedAt  time.Time `bson:"created_at"`
 	UpdatedAt  time.Time `bson:"updated_at"`
 }
@@ -355,11 +596,11 @@ func extractSessionSeqFromID(sessionID string) int {
 // Get retrieves a session by ID
 func (s *MongoDBStore) Get(sessionID string) (*model.Session, error) {
 	// MongoDB is thread-safe, no mutex needed
-	ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
 	var doc sessionDocument
-	err := s.collection.FindOne(ctx, bson.M{"_id": sessionID}).Decode(&doc)
+	err := s.collection.FindOne(ctx, bson.M{"_id": s.id(sessionID)}).Decode(&doc)
 	if err == mongo.ErrNoDocuments {
 		return nil, fmt.Errorf("session not found: %s", sessionID)
 	}
@@ -387,10 +628,10 @@ func (s *MongoDBStore) Get(sessionID string) (*model.Session, error) {
 	// Restore ToolSeq from tool_calls so we never reuse a tool ID (ensures new tool calls are stored with unique IDs)
 	maxToolSeq := s.getMaxToolSeqForSession(ctx, sessionID)
 	if maxToolSeq > session.ToolSeq {
-		log.Log.Debugf("[MongoDBStore] Get | Restoring ToolSeq | SessionID: %s | OldToolSeq: %d | MaxToolSeq: %d", sessionID, session.ToolSeq, maxToolSeq)
+		s.logger().Debug("[MongoDBStore] Get | Restoring ToolSeq", "session_id", sessionID, "old_tool_seq", session.ToolSeq, "max_tool_seq", maxToolSeq)
 		session.ToolSeq = maxToolSeq
 	}
-	log.Log.Debugf("[MongoDBStore] Get | Final ToolSeq | SessionID: %s | ToolSeq: %d", sessionID, session.ToolSeq)
+	s.logger().Debug("[MongoDBStore] Get | Final ToolSeq", "session_id", sessionID, "tool_seq", session.ToolSeq)
 
 	return session, nil
 }
@@ -401,7 +642,7 @@ func (s *MongoDBStore) Get(sessionID string) (*model.Session, error) {
 func (s *MongoDBStore) getMaxSeqIDForSession(ctx context.Context, sessionID string) int {
 	// Use aggregation pipeline to find MAX(seq_id) efficiently
 	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.M{"session_id": sessionID}}},
+		{{Key: "$match", Value: bson.M{"session_id": s.id(sessionID)}}},
 		{{Key: "$group", Value: bson.M{
 			"_id":      nil,
 			"maxSeqID": bson.M{"$max": "$seq_id"},
@@ -429,9 +670,9 @@ func (s *MongoDBStore) getMaxSeqIDForSession(ctx context.Context, sessionID stri
 
 // getMaxToolSeqForSession returns the maximum tool sequence number for a session from tool_calls collection.
 func (s *MongoDBStore) getMaxToolSeqForSession(ctx context.Context, sessionID string) int {
-	cursor, err := s.toolCallsCollection.Find(ctx, bson.M{"session_id": sessionID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	cursor, err := s.toolCallsCollection.Find(ctx, bson.M{"session_id": s.id(sessionID)}, options.Find().SetProjection(bson.M{"_id": 1}))
 	if err != nil {
-		log.Log.Warnf("[MongoDBStore] getMaxToolSeqForSession query error | SessionID: %s | Error: %v", sessionID, err)
+		s.logger().Warn("[MongoDBStore] getMaxToolSeqForSession query error", "session_id", sessionID, "error", err)
 		return 0
 	}
 	defer cursor.Close(ctx)
@@ -449,14 +690,14 @@ func (s *MongoDBStore) getMaxToolSeqForSession(ctx context.Context, sessionID st
 			maxSeq = seq
 		}
 	}
-	log.Log.Debugf("[MongoDBStore] getMaxToolSeqForSession | SessionID: %s | Found: %d tool_calls | MaxSeq: %d", sessionID, count, maxSeq)
+	s.logger().Debug("[MongoDBStore] getMaxToolSeqForSession", "session_id", sessionID, "tool_calls", count, "max_seq", maxSeq)
 	return maxSeq
 }
 
 // getMaxSeqIDForSessionFallback is a fallback method for old data without seq_id field.
 // Reads all messages and unmarshals JSON to find max SeqID.
 func (s *MongoDBStore) getMaxSeqIDForSessionFallback(ctx context.Context, sessionID string) int {
-	cursor, err := s.messagesCollection.Find(ctx, bson.M{"session_id": sessionID})
+	cursor, err := s.messagesCollection.Find(ctx, bson.M{"session_id": s.id(sessionID)})
 	if err != nil {
 		return 0
 	}
@@ -510,20 +751,22 @@ func (s *MongoDBStore) Put(session *model.Session) error {
 	}
 
 	doc := sessionDocument{
-		SessionID:  session.SessionID,
-		UserID:     session.UserID,
+		SessionID:  s.id(session.SessionID),
+		UserID:     s.id(session.UserID),
 		AgentType:  string(session.AgentType),
 		SessionSeq: extractSessionSeqFromID(session.SessionID),
 		Data:       string(data),
+		Archived:   session.Archived,
+		Tags:       model.NormalizeTags(session.Tags),
 		CreatedAt:  session.CreatedAt,
 		UpdatedAt:  session.UpdatedAt,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
 	defer cancel()
 
 	opts := options.Replace().SetUpsert(true)
-	_, err = s.collection.ReplaceOne(ctx, bson.M{"_id": session.SessionID}, doc, opts)
+	_, err = s.collection.ReplaceOne(ctx, bson.M{"_id": doc.SessionID}, doc, opts)
 	if err != nil {
 		return fmt.Errorf("failed to store session: %w", err)
 	}
@@ -534,10 +777,10 @@ func (s *MongoDBStore) Put(session *model.Session) error {
 // Delete removes a session
 func (s *MongoDBStore) Delete(sessionID string) error {
 	// MongoDB is thread-safe, no mutex needed
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
 	defer cancel()
 
-	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": sessionID})
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": s.id(sessionID)})
 	if err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
@@ -545,13 +788,63 @@ func (s *MongoDBStore) Delete(sessionID string) error {
 	return nil
 }
 
+// DeleteSessionsBefore implements SessionPurger
+func (s *MongoDBStore) DeleteSessionsBefore(cutoff time.Time, core bool) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+	defer cancel()
+
+	agentType := bson.M{"$ne": string(model.AgentTypeCore)}
+	if core {
+		agentType = bson.M{"$eq": string(model.AgentTypeCore)}
+	}
+	filter := s.scope(bson.M{"updated_at": bson.M{"$lt": cutoff}, "agent_type": agentType}, "_id")
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired sessions: %w", err)
+	}
+	var docs []struct {
+		SessionID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode expired sessions: %w", err)
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, 0, len(docs))
+	sessionIDs := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.SessionID)
+		sessionIDs = append(sessionIDs, localID(s.namespace, doc.SessionID))
+	}
+
+	// Child collections first, so an interrupted run leaves no orphaned records behind
+	sessionFilter := bson.M{"session_id": bson.M{"$in": ids}}
+	for name, collection := range map[string]*mongo.Collection{
+		"messages":           s.messagesCollection,
+		"tool_calls":         s.toolCallsCollection,
+		"summarization_logs": s.summarizationLogsCollection,
+		"opened_files":       s.openedFilesCollection,
+	} {
+		if _, err := collection.DeleteMany(ctx, sessionFilter); err != nil {
+			return nil, fmt.Errorf("failed to delete %s: %w", name, err)
+		}
+	}
+	// A session updated since it was selected is kept
+	filter["_id"] = bson.M{"$in": ids}
+	if _, err := s.collection.DeleteMany(ctx, filter); err != nil {
+		return nil, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return sessionIDs, nil
+}
+
 // DeleteUserData deletes all sessions, messages, tool calls, summarization logs,
-// and opened files for a user. Resets user's ActiveSessionIDs and SessionSeqs.
+// opened files and visited nodes for a user. Resets user's ActiveSessionIDs and SessionSeqs.
 func (s *MongoDBStore) DeleteUserData(userID string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
 	defer cancel()
 
-	userFilter := bson.M{"user_id": userID}
+	userFilter := bson.M{"user_id": s.id(userID)}
 
 	// Get session IDs for this user (needed for collections that use session_id)
 	sessions, err := s.List(userID)
@@ -560,13 +853,26 @@ func (s *MongoDBStore) DeleteUserData(userID string) error {
 	}
 	sessionIDs := make([]string, 0, len(sessions))
 	for _, sess := range sessions {
-		sessionIDs = append(sessionIDs, sess.SessionID)
+		sessionIDs = append(sessionIDs, s.id(sess.SessionID))
 	}
 
 	// Delete messages by user_id
 	if _, err := s.messagesCollection.DeleteMany(ctx, userFilter); err != nil {
 		return fmt.Errorf("failed to delete messages: %w", err)
 	}
+	if _, err := s.usageRecordsCollection.DeleteMany(ctx, userFilter); err != nil {
+		return fmt.Errorf("failed to delete usage_records: %w", err)
+	}
+	if _, err := s.memoriesCollection.DeleteMany(ctx, userFilter); err != nil {
+		return fmt.Errorf("failed to delete memories: %w", err)
+	}
+	if _, err := s.feedbackCollection.DeleteMany(ctx, userFilter); err != nil {
+		return fmt.Errorf("failed to delete feedback: %w", err)
+	}
+	if _, err := s.visitedNodesCollection.DeleteMany(ctx, userFilter); err != nil {
+		return fmt.Errorf("failed to delete visited_nodes: %w", err)
+	}
+	s.userNodes.Delete(userID)
 
 	// Delete tool_calls and summarization_logs by session_id (these don't have user_id at top level)
 	if len(sessionIDs) > 0 {
@@ -589,7 +895,7 @@ func (s *MongoDBStore) DeleteUserData(userID string) error {
 
 	// Reset user's ActiveSessionIDs and SessionSeqs
 	var doc userDocument
-	err = s.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&doc)
+	err = s.usersCollection.FindOne(ctx, bson.M{"_id": s.id(userID)}).Decode(&doc)
 	if err == nil {
 		user := &model.User{}
 		if json.Unmarshal([]byte(doc.Data), user) == nil {
@@ -600,7 +906,7 @@ func (s *MongoDBStore) DeleteUserData(userID string) error {
 				opts := options.Replace().SetUpsert(true)
 				doc.Data = string(userData)
 				doc.UpdatedAt = user.UpdatedAt
-				_, _ = s.usersCollection.ReplaceOne(ctx, bson.M{"_id": userID}, doc, opts)
+				_, _ = s.usersCollection.ReplaceOne(ctx, bson.M{"_id": doc.UserID}, doc, opts)
 			}
 		}
 	}
@@ -611,10 +917,10 @@ func (s *MongoDBStore) DeleteUserData(userID string) error {
 // List returns all sessions for a user
 func (s *MongoDBStore) List(userID string) ([]*model.Session, error) {
 	// MongoDB is thread-safe, no mutex needed
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
-	cursor, err := s.collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	cursor, err := s.collection.Find(ctx, bson.M{"user_id": s.id(userID)}, options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query sessions: %w", err)
 	}
@@ -646,16 +952,56 @@ func (s *MongoDBStore) List(userID string) ([]*model.Session, error) {
 	return sessions, nil
 }
 
+// FindSessionsByTags implements model.SessionTagStore using the user_id + tags multikey index
+func (s *MongoDBStore) FindSessionsByTags(userID string, tags []string, matchAll bool) ([]*model.Session, error) {
+	tags = model.NormalizeTags(tags)
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
+	defer cancel()
+
+	operator := "$in"
+	if matchAll {
+		operator = "$all"
+	}
+	filter := bson.M{"user_id": s.id(userID), "tags": bson.M{operator: tags}}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions by tags: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []*model.Session
+	for cursor.Next(ctx) {
+		var doc sessionDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode session: %w", err)
+		}
+		session := &model.Session{}
+		if err := unmarshalJSONOrBSON(doc.Data, session); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+		}
+		session.CreatedAt = doc.CreatedAt
+		session.UpdatedAt = doc.UpdatedAt
+		sessions = append(sessions, session)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+	return sessions, nil
+}
+
 // GetNextSessionSeq returns the next session sequence number for a user and agent type
 // Uses MAX(session_seq) to avoid duplicate IDs when sessions are deleted
 func (s *MongoDBStore) GetNextSessionSeq(userID string, agentType model.AgentType) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
 	// Use aggregation to find MAX(session_seq) for this user and agent type
 	pipeline := mongo.Pipeline{
 		{{Key: "$match", Value: bson.M{
-			"user_id":    userID,
+			"user_id":    s.id(userID),
 			"agent_type": string(agentType),
 		}}},
 		{{Key: "$group", Value: bson.M{
@@ -691,13 +1037,14 @@ func (s *MongoDBStore) GetNextSessionSeq(userID string, agentType model.AgentTyp
 // If no Core session exists, it returns nil without error
 func (s *MongoDBStore) GetCoreSession(userID string) (*model.Session, error) {
 	// MongoDB is thread-safe, no mutex needed
-	ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
 	var doc sessionDocument
 	err := s.collection.FindOne(ctx, bson.M{
-		"user_id":    userID,
+		"user_id":    s.id(userID),
 		"agent_type": string(model.AgentTypeCore),
+		"archived":   bson.M{"$ne": true},
 	}).Decode(&doc)
 
 	if err == mongo.ErrNoDocuments {
@@ -738,13 +1085,17 @@ func (s *MongoDBStore) PutCoreSession(session *model.Session) error {
 	}
 
 	// MongoDB is thread-safe, no mutex needed
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
 	defer cancel()
 
-	// Delete any existing Core sessions for this user
+	// Delete any existing Core sessions for this user (archived ones are kept)
 	_, err := s.collection.DeleteMany(ctx, bson.M{
-		"user_id":    session.UserID,
+		"user_id":    s.id(session.UserID),
 		"agent_type": string(model.AgentTypeCore),
+		"$or": bson.A{
+			bson.M{"archived": bson.M{"$ne": true}},
+			bson.M{"_id": s.id(session.SessionID)},
+		},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete existing core sessions: %w", err)
@@ -759,11 +1110,13 @@ func (s *MongoDBStore) PutCoreSession(session *model.Session) error {
 	}
 
 	doc := sessionDocument{
-		SessionID:  session.SessionID,
-		UserID:     session.UserID,
+		SessionID:  s.id(session.SessionID),
+		UserID:     s.id(session.UserID),
 		AgentType:  string(session.AgentType),
 		SessionSeq: extractSessionSeqFromID(session.SessionID),
 		Data:       string(data),
+		Archived:   session.Archived,
+		Tags:       model.NormalizeTags(session.Tags),
 		CreatedAt:  session.CreatedAt,
 		UpdatedAt:  session.UpdatedAt,
 	}
@@ -776,8 +1129,17 @@ func (s *MongoDBStore) PutCoreSession(session *model.Session) error {
 	return nil
 }
 
+// visitedNodeDocument represents a user's visited node in MongoDB
+type visitedNodeDocument struct {
+	UserID    string    `bson:"user_id"`
+	NodePath  string    `bson:"node_path"`
+	Data      string    `bson:"data"` // JSON serialized NodeDigest
+	VisitedAt time.Time `bson:"visited_at"`
+}
+
 // AddVisitedNode adds a visited node for a user
-// This tracks nodes at user level, across all sessions
+// This tracks nodes at user level, across all sessions. The node is written to the
+// visited_nodes collection; the in-memory map is a write-through cache of it.
 func (s *MongoDBStore) AddVisitedNode(userID string, nodeDigest *model.NodeDigest) {
 	if nodeDigest == nil {
 		return
@@ -787,23 +1149,74 @@ func (s *MongoDBStore) AddVisitedNode(userID string, nodeDigest *model.NodeDiges
 	lock.Lock()
 	defer lock.Unlock()
 
+	un := s.loadVisitedNodes(userID)
+	un.VisitedNodes[nodeDigest.Path] = nodeDigest
+	un.LastActivity = time.Now()
+	s.userNodes.Store(userID, un)
+
+	data, err := json.Marshal(nodeDigest)
+	if err != nil {
+		s.logger().Warn("[MongoDBStore] ⚠️  Failed to marshal visited node", "user_id", userID, "path", nodeDigest.Path, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+
+	doc := visitedNodeDocument{
+		UserID:    s.id(userID),
+		NodePath:  nodeDigest.Path,
+		Data:      string(data),
+		VisitedAt: un.LastActivity,
+	}
+	filter := bson.M{"user_id": doc.UserID, "node_path": doc.NodePath}
+	if _, err := s.visitedNodesCollection.ReplaceOne(ctx, filter, doc, options.Replace().SetUpsert(true)); err != nil {
+		s.logger().Warn("[MongoDBStore] ⚠️  Failed to store visited node", "user_id", userID, "path", nodeDigest.Path, "error", err)
+	}
+}
+
+// loadVisitedNodes returns the cached visited nodes of a user, reading them from the
+// visited_nodes collection on first access (caller must hold the user's lock)
+func (s *MongoDBStore) loadVisitedNodes(userID string) *UserNodes {
 	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		if un.VisitedNodes == nil {
-			un.VisitedNodes = make(map[string]*model.NodeDigest)
+		return userNodes.(*UserNodes)
+	}
+
+	un := &UserNodes{VisitedNodes: make(map[string]*model.NodeDigest)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
+	defer cancel()
+
+	cursor, err := s.visitedNodesCollection.Find(ctx, bson.M{"user_id": s.id(userID)})
+	if err != nil {
+		s.logger().Warn("[MongoDBStore] ⚠️  Failed to load visited nodes", "user_id", userID, "error", err)
+		return un
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc visitedNodeDocument
+		if err := cursor.Decode(&doc); err != nil {
+			s.logger().Warn("[MongoDBStore] ⚠️  Failed to decode visited node", "user_id", userID, "error", err)
+			return un
 		}
-		un.VisitedNodes[nodeDigest.Path] = nodeDigest
-		un.LastActivity = time.Now()
-		s.userNodes.Store(userID, un)
-	} else {
-		un := &UserNodes{
-			VisitedNodes: map[string]*model.NodeDigest{
-				nodeDigest.Path: nodeDigest,
-			},
-			LastActivity: time.Now(),
+		digest := &model.NodeDigest{}
+		if err := json.Unmarshal([]byte(doc.Data), digest); err != nil {
+			continue
 		}
-		s.userNodes.Store(userID, un)
+		digest.Path = doc.NodePath
+		un.VisitedNodes[doc.NodePath] = digest
+		if doc.VisitedAt.After(un.LastActivity) {
+			un.LastActivity = doc.VisitedAt
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		s.logger().Warn("[MongoDBStore] ⚠️  Failed to load visited nodes", "user_id", userID, "error", err)
+		return un
 	}
+
+	s.userNodes.Store(userID, un)
+	return un
 }
 
 // GetVisitedNodes returns all visited nodes for a user
@@ -812,18 +1225,15 @@ func (s *MongoDBStore) GetVisitedNodes(userID string) map[string]*model.NodeDige
 	lock.Lock()
 	defer lock.Unlock()
 
-	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		// Return a copy to prevent external modification
-		result := make(map[string]*model.NodeDigest)
-		for k, v := range un.VisitedNodes {
-			// Create a copy of NodeDigest
-			digestCopy := *v
-			result[k] = &digestCopy
-		}
-		return result
+	un := s.loadVisitedNodes(userID)
+	// Return a copy to prevent external modification
+	result := make(map[string]*model.NodeDigest, len(un.VisitedNodes))
+	for k, v := range un.VisitedNodes {
+		// Create a copy of NodeDigest
+		digestCopy := *v
+		result[k] = &digestCopy
 	}
-	return make(map[string]*model.NodeDigest)
+	return result
 }
 
 // GetVisitedNodePaths returns a list of visited node paths for a user
@@ -832,15 +1242,12 @@ func (s *MongoDBStore) GetVisitedNodePaths(userID string) []string {
 	lock.Lock()
 	defer lock.Unlock()
 
-	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		paths := make([]string, 0, len(un.VisitedNodes))
-		for path := range un.VisitedNodes {
-			paths = append(paths, path)
-		}
-		return paths
+	un := s.loadVisitedNodes(userID)
+	paths := make([]string, 0, len(un.VisitedNodes))
+	for path := range un.VisitedNodes {
+		paths = append(paths, path)
 	}
-	return []string{}
+	return paths
 }
 
 // HasVisitedNode checks if a user has visited a specific node
@@ -849,12 +1256,8 @@ func (s *MongoDBStore) HasVisitedNode(userID string, nodePath string) bool {
 	lock.Lock()
 	defer lock.Unlock()
 
-	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		_, exists := un.VisitedNodes[nodePath]
-		return exists
-	}
-	return false
+	_, exists := s.loadVisitedNodes(userID).VisitedNodes[nodePath]
+	return exists
 }
 
 // ClearVisitedNodes clears all visited nodes for a user
@@ -864,6 +1267,12 @@ func (s *MongoDBStore) ClearVisitedNodes(userID string) {
 	defer lock.Unlock()
 
 	s.userNodes.Delete(userID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+	if _, err := s.visitedNodesCollection.DeleteMany(ctx, bson.M{"user_id": s.id(userID)}); err != nil {
+		s.logger().Warn("[MongoDBStore] ⚠️  Failed to clear visited nodes", "user_id", userID, "error", err)
+	}
 }
 
 // NewMongoDBStoreFromURI creates a new MongoDB session store from a connection URI
@@ -886,11 +1295,21 @@ func (s *MongoDBStore) GetSession(sessionID string) (*model.Session, error) {
 
 // GetAllSessions returns all sessions grouped by userID
 func (s *MongoDBStore) GetAllSessions() (map[string][]*model.Session, error) {
+	return s.findSessionsByUser(s.scope(bson.M{}, "user_id"))
+}
+
+// GetSessionsByTimeRange implements debuger.DebugStore
+func (s *MongoDBStore) GetSessionsByTimeRange(from, to time.Time) (map[string][]*model.Session, error) {
+	return s.findSessionsByUser(s.scope(timeRangeFilter("updated_at", from, to), "user_id"))
+}
+
+// findSessionsByUser queries sessions matching filter, newest activity first, grouped by userID
+func (s *MongoDBStore) findSessionsByUser(filter bson.M) (map[string][]*model.Session, error) {
 	// MongoDB is thread-safe, no mutex needed
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
 	defer cancel()
 
-	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query sessions: %w", err)
 	}
@@ -911,7 +1330,7 @@ func (s *MongoDBStore) GetAllSessions() (map[string][]*model.Session, error) {
 		session.CreatedAt = doc.CreatedAt
 		session.UpdatedAt = doc.UpdatedAt
 
-		result[doc.UserID] = append(result[doc.UserID], session)
+		result[session.UserID] = append(result[session.UserID], session)
 	}
 
 	return result, cursor.Err()
@@ -927,11 +1346,11 @@ type userDocument struct {
 
 // GetUser retrieves a user by ID
 func (s *MongoDBStore) GetUser(userID string) (*model.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
 	var doc userDocument
-	err := s.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&doc)
+	err := s.usersCollection.FindOne(ctx, bson.M{"_id": s.id(userID)}).Decode(&doc)
 	if err == mongo.ErrNoDocuments {
 		return nil, nil // User not found
 	}
@@ -963,7 +1382,7 @@ func (s *MongoDBStore) PutUser(user *model.User) error {
 		return fmt.Errorf("user cannot be nil")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
 	defer cancel()
 
 	data, err := json.Marshal(user)
@@ -972,14 +1391,14 @@ func (s *MongoDBStore) PutUser(user *model.User) error {
 	}
 
 	doc := userDocument{
-		UserID:    user.UserID,
+		UserID:    s.id(user.UserID),
 		Data:      string(data),
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: time.Now(),
 	}
 
 	opts := options.Replace().SetUpsert(true)
-	_, err = s.usersCollection.ReplaceOne(ctx, bson.M{"_id": user.UserID}, doc, opts)
+	_, err = s.usersCollection.ReplaceOne(ctx, bson.M{"_id": doc.UserID}, doc, opts)
 	if err != nil {
 		return fmt.Errorf("failed to store user: %w", err)
 	}
@@ -1072,10 +1491,10 @@ func (s *MongoDBStore) computeActiveSessionIDs(user *model.User) error {
 		return err
 	}
 
-	// Find the most recent session for each agent type
+	// Find the most recent session for each agent type (an archived session is never active)
 	latestByType := make(map[model.AgentType]*model.Session)
 	for _, session := range sessions {
-		if session.AgentType == "" {
+		if session.AgentType == "" || session.Archived {
 			continue
 		}
 		existing := latestByType[session.AgentType]
@@ -1097,10 +1516,10 @@ func (s *MongoDBStore) computeActiveSessionIDs(user *model.User) error {
 
 // GetAllUsers returns all users
 func (s *MongoDBStore) GetAllUsers() ([]*model.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
 	defer cancel()
 
-	cursor, err := s.usersCollection.Find(ctx, bson.M{})
+	cursor, err := s.usersCollection.Find(ctx, s.scope(bson.M{}, "_id"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
@@ -1126,12 +1545,16 @@ func (s *MongoDBStore) GetAllUsers() ([]*model.User, error) {
 
 // messageDocument represents a message document in MongoDB
 type messageDocument struct {
-	MessageID string    `bson:"_id"`
-	SessionID string    `bson:"session_id"`
-	UserID    string    `bson:"user_id"`
-	SeqID     int       `bson:"seq_id,omitempty"` // Sequence ID for efficient querying (added for optimization)
-	Data      string    `bson:"data"`             // JSON serialized Message
-	CreatedAt time.Time `bson:"created_at"`
+	MessageID string `bson:"_id"`
+	SessionID string `bson:"session_id"`
+	UserID    string `bson:"user_id"`
+	SeqID     int    `bson:"seq_id,omitempty"` // Sequence ID for efficient querying (added for optimization)
+	// Role and TotalTokens duplicate Data for GetSessionStats aggregation
+	// (documents written before they were added are counted with an empty role and no tokens)
+	Role        string    `bson:"role"`
+	TotalTokens int       `bson:"total_tokens"`
+	Data        string    `bson:"data"` // JSON serialized Message
+	CreatedAt   time.Time `bson:"created_at"`
 }
 
 // PutMessage stores a message
@@ -1140,7 +1563,7 @@ func (s *MongoDBStore) PutMessage(message *model.Message) error {
 		return fmt.Errorf("message cannot be nil")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
 	defer cancel()
 
 	data, err := json.Marshal(message)
@@ -1149,16 +1572,18 @@ func (s *MongoDBStore) PutMessage(message *model.Message) error {
 	}
 
 	doc := messageDocument{
-		MessageID: message.MessageID,
-		SessionID: message.SessionID,
-		UserID:    message.UserID,
-		SeqID:     message.SeqID, // Store seq_id separately for efficient querying
-		Data:      string(data),
-		CreatedAt: message.CreatedAt,
+		MessageID:   s.id(message.MessageID),
+		SessionID:   s.id(message.SessionID),
+		UserID:      s.id(message.UserID),
+		SeqID:       message.SeqID, // Store seq_id separately for efficient querying
+		Role:        message.Role,
+		TotalTokens: message.TotalTokens,
+		Data:        string(data),
+		CreatedAt:   message.CreatedAt,
 	}
 
 	opts := options.Replace().SetUpsert(true)
-	_, err = s.messagesCollection.ReplaceOne(ctx, bson.M{"_id": message.MessageID}, doc, opts)
+	_, err = s.messagesCollection.ReplaceOne(ctx, bson.M{"_id": doc.MessageID}, doc, opts)
 	if err != nil {
 		return fmt.Errorf("failed to store message: %w", err)
 	}
@@ -1168,10 +1593,10 @@ func (s *MongoDBStore) PutMessage(message *model.Message) error {
 
 // GetMessagesBySession returns all messages for a session
 func (s *MongoDBStore) GetMessagesBySession(sessionID string) ([]*model.Message, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
-	cursor, err := s.messagesCollection.Find(ctx, bson.M{"session_id": sessionID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	cursor, err := s.messagesCollection.Find(ctx, bson.M{"session_id": s.id(sessionID)}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
 	}
@@ -1197,10 +1622,10 @@ func (s *MongoDBStore) GetMessagesBySession(sessionID string) ([]*model.Message,
 
 // GetMessagesByUser returns all messages for a user
 func (s *MongoDBStore) GetMessagesByUser(userID string) ([]*model.Message, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
-	cursor, err := s.messagesCollection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	cursor, err := s.messagesCollection.Find(ctx, bson.M{"user_id": s.id(userID)}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
 	}
@@ -1226,10 +1651,20 @@ func (s *MongoDBStore) GetMessagesByUser(userID string) ([]*model.Message, error
 
 // GetAllMessages returns all messages
 func (s *MongoDBStore) GetAllMessages() ([]*model.Message, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return s.findMessages(s.scope(bson.M{}, "user_id"))
+}
+
+// GetMessagesByTimeRange implements debuger.DebugStore
+func (s *MongoDBStore) GetMessagesByTimeRange(from, to time.Time) ([]*model.Message, error) {
+	return s.findMessages(s.scope(timeRangeFilter("created_at", from, to), "user_id"))
+}
+
+// findMessages queries messages matching filter, newest first
+func (s *MongoDBStore) findMessages(filter bson.M) ([]*model.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
 	defer cancel()
 
-	cursor, err := s.messagesCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	cursor, err := s.messagesCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
 	}
@@ -1269,7 +1704,7 @@ func (s *MongoDBStore) AddOpenedFile(openedFile *model.OpenedFile) error {
 		return fmt.Errorf("openedFile cannot be nil")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
 	defer cancel()
 
 	data, err := json.Marshal(openedFile)
@@ -1277,10 +1712,10 @@ func (s *MongoDBStore) AddOpenedFile(openedFile *model.OpenedFile) error {
 		return fmt.Errorf("failed to marshal opened file: %w", err)
 	}
 
-	id := fmt.Sprintf("%s:%s", openedFile.SessionID, openedFile.FilePath)
+	id := fmt.Sprintf("%s:%s", s.id(openedFile.SessionID), openedFile.FilePath)
 	doc := openedFileDocument{
 		ID:        id,
-		SessionID: openedFile.SessionID,
+		SessionID: s.id(openedFile.SessionID),
 		FilePath:  openedFile.FilePath,
 		Data:      string(data),
 		OpenedAt:  openedFile.OpenedAt,
@@ -1297,10 +1732,10 @@ func (s *MongoDBStore) AddOpenedFile(openedFile *model.OpenedFile) error {
 
 // CloseOpenedFile marks a file as closed
 func (s *MongoDBStore) CloseOpenedFile(sessionID string, filePath string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
 	defer cancel()
 
-	id := fmt.Sprintf("%s:%s", sessionID, filePath)
+	id := fmt.Sprintf("%s:%s", s.id(sessionID), filePath)
 	_, err := s.openedFilesCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
 		"$set": bson.M{"closed_at": time.Now()},
 	})
@@ -1313,10 +1748,10 @@ func (s *MongoDBStore) CloseOpenedFile(sessionID string, filePath string) error
 
 // GetOpenedFilesBySession returns all opened files for a session
 func (s *MongoDBStore) GetOpenedFilesBySession(sessionID string) ([]*model.OpenedFile, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
-	cursor, err := s.openedFilesCollection.Find(ctx, bson.M{"session_id": sessionID})
+	cursor, err := s.openedFilesCollection.Find(ctx, bson.M{"session_id": s.id(sessionID)})
 	if err != nil {
 		return nil, fmt.Errorf("failed to query opened files: %w", err)
 	}
@@ -1342,11 +1777,11 @@ func (s *MongoDBStore) GetOpenedFilesBySession(sessionID string) ([]*model.Opene
 
 // GetCurrentlyOpenedFilesBySession returns only currently open files
 func (s *MongoDBStore) GetCurrentlyOpenedFilesBySession(sessionID string) ([]*model.OpenedFile, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
 	cursor, err := s.openedFilesCollection.Find(ctx, bson.M{
-		"session_id": sessionID,
+		"session_id": s.id(sessionID),
 		"closed_at":  bson.M{"$exists": false},
 	})
 	if err != nil {
@@ -1374,10 +1809,10 @@ func (s *MongoDBStore) GetCurrentlyOpenedFilesBySession(sessionID string) ([]*mo
 
 // GetAllOpenedFiles returns all opened files
 func (s *MongoDBStore) GetAllOpenedFiles() ([]*model.OpenedFile, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
 	defer cancel()
 
-	cursor, err := s.openedFilesCollection.Find(ctx, bson.M{})
+	cursor, err := s.openedFilesCollection.Find(ctx, s.scope(bson.M{}, "session_id"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query opened files: %w", err)
 	}
@@ -1418,7 +1853,7 @@ func (s *MongoDBStore) PutToolCall(toolCall *model.ToolCall) error {
 		return fmt.Errorf("toolCall cannot be nil")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
 	defer cancel()
 
 	data, err := json.Marshal(toolCall)
@@ -1427,16 +1862,16 @@ func (s *MongoDBStore) PutToolCall(toolCall *model.ToolCall) error {
 	}
 
 	doc := toolCallDocument{
-		ID:         toolCall.ToolID,
-		ToolCallID: toolCall.ToolCallID,
-		ToolID:     toolCall.ToolID,
-		SessionID:  toolCall.SessionID,
+		ID:         s.id(toolCall.ToolID),
+		ToolCallID: s.id(toolCall.ToolCallID),
+		ToolID:     s.id(toolCall.ToolID),
+		SessionID:  s.id(toolCall.SessionID),
 		Data:       string(data),
 		CreatedAt:  toolCall.CreatedAt,
 	}
 
 	opts := options.Replace().SetUpsert(true)
-	_, err = s.toolCallsCollection.ReplaceOne(ctx, bson.M{"_id": toolCall.ToolID}, doc, opts)
+	_, err = s.toolCallsCollection.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, opts)
 	if err != nil {
 		return fmt.Errorf("failed to store tool call: %w", err)
 	}
@@ -1446,10 +1881,10 @@ func (s *MongoDBStore) PutToolCall(toolCall *model.ToolCall) error {
 
 // GetToolCallsBySession returns all tool calls for a session
 func (s *MongoDBStore) GetToolCallsBySession(sessionID string) ([]*model.ToolCall, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
-	cursor, err := s.toolCallsCollection.Find(ctx, bson.M{"session_id": sessionID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	cursor, err := s.toolCallsCollection.Find(ctx, bson.M{"session_id": s.id(sessionID)}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query tool calls: %w", err)
 	}
@@ -1475,11 +1910,11 @@ func (s *MongoDBStore) GetToolCallsBySession(sessionID string) ([]*model.ToolCal
 
 // GetToolCallByID returns a tool call by ID
 func (s *MongoDBStore) GetToolCallByID(toolCallID string) (*model.ToolCall, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
 	var doc toolCallDocument
-	err := s.toolCallsCollection.FindOne(ctx, bson.M{"_id": toolCallID}).Decode(&doc)
+	err := s.toolCallsCollection.FindOne(ctx, bson.M{"_id": s.id(toolCallID)}).Decode(&doc)
 	if err == mongo.ErrNoDocuments {
 		return nil, nil
 	}
@@ -1497,11 +1932,11 @@ func (s *MongoDBStore) GetToolCallByID(toolCallID string) (*model.ToolCall, erro
 
 // GetToolCallByToolID returns a tool call by ToolID (sequential ID)
 func (s *MongoDBStore) GetToolCallByToolID(toolID string) (*model.ToolCall, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 12*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
 	var doc toolCallDocument
-	err := s.toolCallsCollection.FindOne(ctx, bson.M{"tool_id": toolID}).Decode(&doc)
+	err := s.toolCallsCollection.FindOne(ctx, bson.M{"tool_id": s.id(toolID)}).Decode(&doc)
 	if err == mongo.ErrNoDocuments {
 		return nil, nil
 	}
@@ -1517,12 +1952,48 @@ func (s *MongoDBStore) GetToolCallByToolID(toolID string) (*model.ToolCall, erro
 	return tc, nil
 }
 
+// GetToolCall implements debuger.DebugStore
+func (s *MongoDBStore) GetToolCall(toolID string) (*model.ToolCall, error) {
+	tc, err := s.GetToolCallByToolID(toolID)
+	if err != nil || tc != nil {
+		return tc, err
+	}
+	return s.GetToolCallByID(toolID)
+}
+
 // GetAllToolCalls returns all tool calls
 func (s *MongoDBStore) GetAllToolCalls() ([]*model.ToolCall, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return s.findToolCalls(s.scope(bson.M{}, "session_id"), options.Find())
+}
+
+// GetToolCallsPaginated implements debuger.DebugStore
+func (s *MongoDBStore) GetToolCallsPaginated(offset, limit int) ([]*model.ToolCall, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+	defer cancel()
+
+	filter := s.scope(bson.M{}, "session_id")
+	total, err := s.toolCallsCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count tool calls: %w", err)
+	}
+	toolCalls, err := s.findToolCalls(filter, options.Find().SetSkip(int64(offset)).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, err
+	}
+	return toolCalls, int(total), nil
+}
+
+// GetToolCallsByTimeRange implements debuger.DebugStore
+func (s *MongoDBStore) GetToolCallsByTimeRange(from, to time.Time) ([]*model.ToolCall, error) {
+	return s.findToolCalls(s.scope(timeRangeFilter("created_at", from, to), "session_id"), options.Find())
+}
+
+// findToolCalls queries tool calls matching filter, newest first, with the given options (skip/limit)
+func (s *MongoDBStore) findToolCalls(filter bson.M, opts *options.FindOptions) ([]*model.ToolCall, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
 	defer cancel()
 
-	cursor, err := s.toolCallsCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	cursor, err := s.toolCallsCollection.Find(ctx, filter, opts.SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query tool calls: %w", err)
 	}
@@ -1549,14 +2020,14 @@ func (s *MongoDBStore) GetAllToolCalls() ([]*model.ToolCall, error) {
 // UpdateToolCallResponse updates the response for a tool call by ToolID and calculates duration.
 // When execErr != nil, sets status=failed and error=execErr.Error().
 func (s *MongoDBStore) UpdateToolCallResponse(toolID string, response string, execErr error) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
 	defer cancel()
 
 	now := time.Now()
 
 	// First, get the existing tool call to calculate duration (_id is ToolID)
 	var doc toolCallDocument
-	err := s.toolCallsCollection.FindOne(ctx, bson.M{"_id": toolID}).Decode(&doc)
+	err := s.toolCallsCollection.FindOne(ctx, bson.M{"_id": s.id(toolID)}).Decode(&doc)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return fmt.Errorf("tool call not found (PutToolCall may have failed earlier): %w", err)
@@ -1595,7 +2066,7 @@ func (s *MongoDBStore) UpdateToolCallResponse(toolID string, response string, ex
 	doc.Data = string(data)
 
 	opts := options.Replace().SetUpsert(false)
-	_, err = s.toolCallsCollection.ReplaceOne(ctx, bson.M{"_id": toolID}, doc, opts)
+	_, err = s.toolCallsCollection.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, opts)
 	if err != nil {
 		return fmt.Errorf("failed to update tool call response: %w", err)
 	}
@@ -1603,32 +2074,83 @@ func (s *MongoDBStore) UpdateToolCallResponse(toolID string, response string, ex
 	return nil
 }
 
-// summarizationLogDocument represents a summarization log document in MongoDB
-type summarizationLogDocument struct {
-	ID        string    `bson:"_id"`
-	SessionID string    `bson:"session_id"`
-	Data      string    `bson:"data"` // JSON serialized SummarizationLog
-	CreatedAt time.Time `bson:"created_at"`
+// MarkToolCallCacheHit marks a tool call answered from the tool result cache (status "cache_hit")
+func (s *MongoDBStore) MarkToolCallCacheHit(toolID string) error {
+	return s.updateToolCall(toolID, func(tc *model.ToolCall) {
+		tc.Status = model.ToolCallStatusCacheHit
+		tc.UpdatedAt = time.Now()
+	})
 }
 
-// PutSummarizationLog stores a summarization log
-func (s *MongoDBStore) PutSummarizationLog(log *model.SummarizationLog) error {
-	if log == nil {
-		return fmt.Errorf("log cannot be nil")
-	}
+// SetToolCallSources stores the citations of a web search tool call
+func (s *MongoDBStore) SetToolCallSources(toolID string, sources []model.Citation) error {
+	return s.updateToolCall(toolID, func(tc *model.ToolCall) {
+		tc.Sources = sources
+	})
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// SetToolCallArgsValidation stores the outcome of checking a tool call's arguments
+func (s *MongoDBStore) SetToolCallArgsValidation(toolID, outcome, detail string) error {
+	return s.updateToolCall(toolID, func(tc *model.ToolCall) {
+		tc.ArgsValidation = outcome
+		tc.ArgsValidationDetail = detail
+	})
+}
+
+// updateToolCall applies update to the stored tool call with the given ToolID
+func (s *MongoDBStore) updateToolCall(toolID string, update func(*model.ToolCall)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
 	defer cancel()
 
-	data, err := json.Marshal(log)
-	if err != nil {
+	var doc toolCallDocument
+	if err := s.toolCallsCollection.FindOne(ctx, bson.M{"_id": s.id(toolID)}).Decode(&doc); err != nil {
+		return fmt.Errorf("failed to find tool call: %w", err)
+	}
+	tc := &model.ToolCall{}
+	if err := unmarshalJSONOrBSON(doc.Data, tc); err != nil {
+		return fmt.Errorf("failed to unmarshal tool call: %w", err)
+	}
+	update(tc)
+	data, err := json.Marshal(tc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tool call: %w", err)
+	}
+	doc.Data = string(data)
+
+	if _, err := s.toolCallsCollection.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, options.Replace().SetUpsert(false)); err != nil {
+		return fmt.Errorf("failed to update tool call: %w", err)
+	}
+	return nil
+}
+
+// summarizationLogDocument represents a summarization log document in MongoDB
+type summarizationLogDocument struct {
+	ID        string    `bson:"_id"`
+	SessionID string    `bson:"session_id"`
+	Status    string    `bson:"status,omitempty"` // copied from Data for CountSummarizationLogsByStatus
+	Data      string    `bson:"data"`             // JSON serialized SummarizationLog
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// PutSummarizationLog stores a summarization log
+func (s *MongoDBStore) PutSummarizationLog(log *model.SummarizationLog) error {
+	if log == nil {
+		return fmt.Errorf("log cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(log)
+	if err != nil {
 		return fmt.Errorf("failed to marshal summarization log: %w", err)
 	}
 
-	id := fmt.Sprintf("%s:%d", log.SessionID, log.CreatedAt.UnixNano())
+	id := fmt.Sprintf("%s:%d", s.id(log.SessionID), log.CreatedAt.UnixNano())
 	doc := summarizationLogDocument{
 		ID:        id,
-		SessionID: log.SessionID,
+		SessionID: s.id(log.SessionID),
+		Status:    log.Status,
 		Data:      string(data),
 		CreatedAt: log.CreatedAt,
 	}
@@ -1644,10 +2166,10 @@ func (s *MongoDBStore) PutSummarizationLog(log *model.SummarizationLog) error {
 
 // GetSummarizationLogsBySession returns all summarization logs for a session
 func (s *MongoDBStore) GetSummarizationLogsBySession(sessionID string) ([]*model.SummarizationLog, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
 	defer cancel()
 
-	cursor, err := s.summarizationLogsCollection.Find(ctx, bson.M{"session_id": sessionID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	cursor, err := s.summarizationLogsCollection.Find(ctx, bson.M{"session_id": s.id(sessionID)}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query summarization logs: %w", err)
 	}
@@ -1673,10 +2195,736 @@ func (s *MongoDBStore) GetSummarizationLogsBySession(sessionID string) ([]*model
 
 // GetAllSummarizationLogs returns all summarization logs
 func (s *MongoDBStore) GetAllSummarizationLogs() ([]*model.SummarizationLog, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return s.findSummarizationLogs(s.scope(bson.M{}, "session_id"), options.Find())
+}
+
+// GetSummarizationLogsPaginated implements debuger.DebugStore
+func (s *MongoDBStore) GetSummarizationLogsPaginated(offset, limit int) ([]*model.SummarizationLog, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+	defer cancel()
+
+	filter := s.scope(bson.M{}, "session_id")
+	total, err := s.summarizationLogsCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count summarization logs: %w", err)
+	}
+	logs, err := s.findSummarizationLogs(filter, options.Find().SetSkip(int64(offset)).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, int(total), nil
+}
+
+// CountSummarizationLogsByStatus returns the number of summarization logs per status.
+// Logs stored before the status field was added are counted under "".
+func (s *MongoDBStore) CountSummarizationLogsByStatus() (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+	defer cancel()
+
+	cursor, err := s.summarizationLogsCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: s.scope(bson.M{}, "session_id")}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$status"}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count summarization logs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	counts := make(map[string]int)
+	for cursor.Next(ctx) {
+		var row struct {
+			Status *string `bson:"_id"`
+			Count  int     `bson:"count"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, fmt.Errorf("failed to decode summarization log count: %w", err)
+		}
+		status := ""
+		if row.Status != nil {
+			status = *row.Status
+		}
+		counts[status] += row.Count
+	}
+	return counts, cursor.Err()
+}
+
+// moderationEventDocument represents a moderation event document in MongoDB
+type moderationEventDocument struct {
+	ID        string    `bson:"_id"`
+	UserID    string    `bson:"user_id"`
+	Data      string    `bson:"data"` // JSON serialized ModerationEvent
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// PutModerationEvent implements model.ModerationEventStore
+func (s *MongoDBStore) PutModerationEvent(event *model.ModerationEvent) error {
+	if event == nil {
+		return fmt.Errorf("event cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal moderation event: %w", err)
+	}
+
+	doc := moderationEventDocument{
+		ID:        s.id(event.EventID),
+		UserID:    s.id(event.UserID),
+		Data:      string(data),
+		CreatedAt: event.CreatedAt,
+	}
+	_, err = s.moderationEventsCollection.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to store moderation event: %w", err)
+	}
+	return nil
+}
+
+// GetModerationEventsByUser implements model.ModerationEventStore
+func (s *MongoDBStore) GetModerationEventsByUser(userID string) ([]*model.ModerationEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
+	defer cancel()
+
+	cursor, err := s.moderationEventsCollection.Find(ctx, bson.M{"user_id": s.id(userID)}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query moderation events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var events []*model.ModerationEvent
+	for cursor.Next(ctx) {
+		var doc moderationEventDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode moderation event: %w", err)
+		}
+		var event model.ModerationEvent
+		if err := json.Unmarshal([]byte(doc.Data), &event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal moderation event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	return events, cursor.Err()
+}
+
+// usageRecordDocument represents a usage record document in MongoDB
+type usageRecordDocument struct {
+	ID               string    `bson:"_id"`
+	UserID           string    `bson:"user_id"`
+	SessionID        string    `bson:"session_id"`
+	Model            string    `bson:"model"`
+	PromptTokens     int       `bson:"prompt_tokens"`
+	CompletionTokens int       `bson:"completion_tokens"`
+	CostUSD          float64   `bson:"cost_usd"`
+	CreatedAt        time.Time `bson:"created_at"`
+}
+
+// PutUsageRecord implements model.UsageStore
+func (s *MongoDBStore) PutUsageRecord(record *model.UsageRecord) error {
+	if record == nil {
+		return fmt.Errorf("record cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+
+	doc := usageRecordDocument{
+		ID:               s.id(record.RecordID),
+		UserID:           s.id(record.UserID),
+		Model:            record.Model,
+		PromptTokens:     record.PromptTokens,
+		CompletionTokens: record.CompletionTokens,
+		CostUSD:          record.CostUSD,
+		CreatedAt:        record.CreatedAt,
+	}
+	if record.SessionID != "" {
+		doc.SessionID = s.id(record.SessionID)
+	}
+	_, err := s.usageRecordsCollection.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to store usage record: %w", err)
+	}
+	return nil
+}
+
+// GetUsageSummary implements model.UsageStore
+func (s *MongoDBStore) GetUsageSummary(userID string, from, to time.Time) (*model.UsageSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+	defer cancel()
+
+	filter := timeRangeFilter("created_at", from, to)
+	if userID != "" {
+		filter["user_id"] = s.id(userID)
+	} else {
+		filter = s.scope(filter, "user_id")
+	}
+
+	cursor, err := s.usageRecordsCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$model"},
+			{Key: "calls", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "prompt_tokens", Value: bson.D{{Key: "$sum", Value: "$prompt_tokens"}}},
+			{Key: "completion_tokens", Value: bson.D{{Key: "$sum", Value: "$completion_tokens"}}},
+			{Key: "cost_usd", Value: bson.D{{Key: "$sum", Value: "$cost_usd"}}},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage records: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	summary := &model.UsageSummary{UserID: userID, From: from, To: to, ByModel: make(map[string]*model.ModelUsage)}
+	for cursor.Next(ctx) {
+		var row struct {
+			Model            string  `bson:"_id"`
+			Calls            int     `bson:"calls"`
+			PromptTokens     int     `bson:"prompt_tokens"`
+			CompletionTokens int     `bson:"completion_tokens"`
+			CostUSD          float64 `bson:"cost_usd"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, fmt.Errorf("failed to decode usage summary: %w", err)
+		}
+		summary.Add(row.Model, model.ModelUsage{
+			Calls:            row.Calls,
+			PromptTokens:     row.PromptTokens,
+			CompletionTokens: row.CompletionTokens,
+			CostUSD:          row.CostUSD,
+		})
+	}
+	return summary, cursor.Err()
+}
+
+// memoryDocument represents a long-term memory document in MongoDB
+type memoryDocument struct {
+	ID         string    `bson:"_id"`
+	UserID     string    `bson:"user_id"`
+	Key        string    `bson:"key,omitempty"`
+	Text       string    `bson:"text"`
+	Confidence *float64  `bson:"confidence,omitempty"`
+	SessionID  string    `bson:"session_id,omitempty"`
+	Embedding  []float32 `bson:"embedding"`
+	CreatedAt  time.Time `bson:"created_at"`
+	LastUsedAt time.Time `bson:"last_used_at,omitempty"`
+}
+
+// PutMemory implements model.MemoryStore
+func (s *MongoDBStore) PutMemory(memory *model.MemoryRecord) error {
+	if memory == nil {
+		return fmt.Errorf("memory cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+
+	confidence := memory.Confidence
+	doc := memoryDocument{
+		ID:         s.id(memory.MemoryID),
+		UserID:     s.id(memory.UserID),
+		Key:        memory.Key,
+		Text:       memory.Text,
+		Confidence: &confidence,
+		Embedding:  memory.Embedding,
+		CreatedAt:  memory.CreatedAt,
+		LastUsedAt: memory.LastUsedAt,
+	}
+	if memory.SessionID != "" {
+		doc.SessionID = s.id(memory.SessionID)
+	}
+	_, err := s.memoriesCollection.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to store memory: %w", err)
+	}
+	return nil
+}
+
+// GetMemoriesByUser implements model.MemoryStore. Memories stored before facts had a
+// confidence and a last use count as certain and used when they were created.
+func (s *MongoDBStore) GetMemoriesByUser(userID string) ([]*model.MemoryRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
+	defer cancel()
+
+	cursor, err := s.memoriesCollection.Find(ctx, bson.M{"user_id": s.id(userID)},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query memories: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var memories []*model.MemoryRecord
+	for cursor.Next(ctx) {
+		var doc memoryDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode memory: %w", err)
+		}
+		memory := &model.MemoryRecord{
+			MemoryID:   localID(s.namespace, doc.ID),
+			UserID:     localID(s.namespace, doc.UserID),
+			Key:        doc.Key,
+			Text:       doc.Text,
+			Confidence: 1,
+			Embedding:  doc.Embedding,
+			CreatedAt:  doc.CreatedAt,
+			LastUsedAt: doc.LastUsedAt,
+		}
+		if doc.Confidence != nil {
+			memory.Confidence = *doc.Confidence
+		}
+		if doc.SessionID != "" {
+			memory.SessionID = localID(s.namespace, doc.SessionID)
+		}
+		if memory.LastUsedAt.IsZero() {
+			memory.LastUsedAt = doc.CreatedAt
+		}
+		memories = append(memories, memory)
+	}
+	return memories, cursor.Err()
+}
+
+// DeleteMemories implements model.MemoryStore
+func (s *MongoDBStore) DeleteMemories(userID string, memoryIDs ...string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+
+	filter := bson.M{"user_id": s.id(userID)}
+	if len(memoryIDs) > 0 {
+		ids := make([]string, len(memoryIDs))
+		for i, id := range memoryIDs {
+			ids[i] = s.id(id)
+		}
+		filter["_id"] = bson.M{"$in": ids}
+	}
+	result, err := s.memoriesCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete memories: %w", err)
+	}
+	return int(result.DeletedCount), nil
+}
+
+// TouchMemories implements model.MemoryStore
+func (s *MongoDBStore) TouchMemories(userID string, memoryIDs []string, at time.Time) error {
+	if len(memoryIDs) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+
+	ids := make([]string, len(memoryIDs))
+	for i, id := range memoryIDs {
+		ids[i] = s.id(id)
+	}
+	_, err := s.memoriesCollection.UpdateMany(ctx,
+		bson.M{"user_id": s.id(userID), "_id": bson.M{"$in": ids}},
+		bson.M{"$set": bson.M{"last_used_at": at}})
+	if err != nil {
+		return fmt.Errorf("failed to update memories: %w", err)
+	}
+	return nil
+}
+
+// knowledgeChunkDocument represents an excerpt of the knowledge index in MongoDB
+type knowledgeChunkDocument struct {
+	ID        string    `bson:"_id"`
+	NodePath  string    `bson:"node_path"`
+	Title     string    `bson:"title,omitempty"`
+	Text      string    `bson:"text"`
+	Hash      string    `bson:"hash"`
+	Embedding []float32 `bson:"embedding"`
+	IndexedAt time.Time `bson:"indexed_at"`
+}
+
+// GetKnowledgeChunks implements model.KnowledgeIndexStore
+func (s *MongoDBStore) GetKnowledgeChunks() ([]*model.KnowledgeChunk, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
+	defer cancel()
+
+	cursor, err := s.knowledgeChunksCollection.Find(ctx, s.scope(bson.M{}, "_id"),
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query knowledge chunks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var chunks []*model.KnowledgeChunk
+	for cursor.Next(ctx) {
+		var doc knowledgeChunkDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode knowledge chunk: %w", err)
+		}
+		chunks = append(chunks, &model.KnowledgeChunk{
+			ChunkID:   localID(s.namespace, doc.ID),
+			NodePath:  doc.NodePath,
+			Title:     doc.Title,
+			Text:      doc.Text,
+			Hash:      doc.Hash,
+			Embedding: doc.Embedding,
+			IndexedAt: doc.IndexedAt,
+		})
+	}
+	return chunks, cursor.Err()
+}
+
+// ReplaceKnowledgeChunks implements model.KnowledgeIndexStore. The old excerpts are deleted
+// before the new ones are inserted, so a concurrent reader may see an empty index.
+func (s *MongoDBStore) ReplaceKnowledgeChunks(chunks []*model.KnowledgeChunk) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+
+	if _, err := s.knowledgeChunksCollection.DeleteMany(ctx, s.scope(bson.M{}, "_id")); err != nil {
+		return fmt.Errorf("failed to delete knowledge chunks: %w", err)
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(chunks))
+	for i, chunk := range chunks {
+		docs[i] = knowledgeChunkDocument{
+			ID:        s.id(chunk.ChunkID),
+			NodePath:  chunk.NodePath,
+			Title:     chunk.Title,
+			Text:      chunk.Text,
+			Hash:      chunk.Hash,
+			Embedding: chunk.Embedding,
+			IndexedAt: chunk.IndexedAt,
+		}
+	}
+	if _, err := s.knowledgeChunksCollection.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("failed to store knowledge chunks: %w", err)
+	}
+	return nil
+}
+
+// feedbackDocument represents a rating of a message in MongoDB
+type feedbackDocument struct {
+	ID        string    `bson:"_id"`
+	MessageID string    `bson:"message_id"`
+	SessionID string    `bson:"session_id"`
+	UserID    string    `bson:"user_id"`
+	Rating    int       `bson:"rating"`
+	Comment   string    `bson:"comment"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// PutFeedback implements model.FeedbackStore
+func (s *MongoDBStore) PutFeedback(feedback *model.Feedback) error {
+	if feedback == nil {
+		return fmt.Errorf("feedback cannot be nil")
+	}
+	if err := feedback.Validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+	defer cancel()
+
+	doc := feedbackDocument{
+		ID:        s.id(feedback.FeedbackID),
+		MessageID: s.id(feedback.MessageID),
+		UserID:    s.id(feedback.UserID),
+		Rating:    feedback.Rating,
+		Comment:   feedback.Comment,
+		CreatedAt: feedback.CreatedAt,
+	}
+	if feedback.SessionID != "" {
+		doc.SessionID = s.id(feedback.SessionID)
+	}
+	_, err := s.feedbackCollection.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to store feedback: %w", err)
+	}
+	return nil
+}
+
+// GetFeedbackByMessage implements model.FeedbackStore
+func (s *MongoDBStore) GetFeedbackByMessage(messageID string) ([]*model.Feedback, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.readTimeout)
+	defer cancel()
+
+	cursor, err := s.feedbackCollection.Find(ctx, bson.M{"message_id": s.id(messageID)},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feedback: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var feedbacks []*model.Feedback
+	for cursor.Next(ctx) {
+		var doc feedbackDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode feedback: %w", err)
+		}
+		feedback := &model.Feedback{
+			FeedbackID: localID(s.namespace, doc.ID),
+			MessageID:  localID(s.namespace, doc.MessageID),
+			UserID:     localID(s.namespace, doc.UserID),
+			Rating:     doc.Rating,
+			Comment:    doc.Comment,
+			CreatedAt:  doc.CreatedAt,
+		}
+		if doc.SessionID != "" {
+			feedback.SessionID = localID(s.namespace, doc.SessionID)
+		}
+		feedbacks = append(feedbacks, feedback)
+	}
+	return feedbacks, cursor.Err()
+}
+
+// GetFeedbackStats implements model.FeedbackStore
+func (s *MongoDBStore) GetFeedbackStats(filter model.FeedbackFilter) (*model.FeedbackStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+	defer cancel()
+
+	match := timeRangeFilter("created_at", filter.From, filter.To)
+	if filter.UserID != "" {
+		match["user_id"] = s.id(filter.UserID)
+	} else {
+		match = s.scope(match, "user_id")
+	}
+	if filter.SessionID != "" {
+		match["session_id"] = s.id(filter.SessionID)
+	}
+	if filter.MessageID != "" {
+		match["message_id"] = s.id(filter.MessageID)
+	}
+
+	countIf := func(cond bson.D) bson.D {
+		return bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{cond, 1, 0}}}}}
+	}
+	cursor, err := s.feedbackCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "up", Value: countIf(bson.D{{Key: "$gt", Value: bson.A{"$rating", 0}}})},
+			{Key: "down", Value: countIf(bson.D{{Key: "$lt", Value: bson.A{"$rating", 0}}})},
+			{Key: "comments", Value: countIf(bson.D{{Key: "$ne", Value: bson.A{"$comment", ""}}})},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate feedback: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	stats := &model.FeedbackStats{}
+	if cursor.Next(ctx) {
+		var row struct {
+			Total    int `bson:"total"`
+			Up       int `bson:"up"`
+			Down     int `bson:"down"`
+			Comments int `bson:"comments"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, fmt.Errorf("failed to decode feedback stats: %w", err)
+		}
+		stats.Total, stats.Up, stats.Down, stats.Comments = row.Total, row.Up, row.Down, row.Comments
+	}
+	return stats, cursor.Err()
+}
+
+// GetFeedbackStatsByMessages implements model.FeedbackStore
+func (s *MongoDBStore) GetFeedbackStatsByMessages(messageIDs []string) (map[string]*model.FeedbackStats, error) {
+	byMessage := make(map[string]*model.FeedbackStats)
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+	defer cancel()
+
+	ids := make([]string, len(messageIDs))
+	for i, id := range messageIDs {
+		ids[i] = s.id(id)
+	}
+	countIf := func(cond bson.D) bson.D {
+		return bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{cond, 1, 0}}}}}
+	}
+	cursor, err := s.feedbackCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: s.scope(bson.M{"message_id": bson.M{"$in": ids}}, "user_id")}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$message_id"},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "up", Value: countIf(bson.D{{Key: "$gt", Value: bson.A{"$rating", 0}}})},
+			{Key: "down", Value: countIf(bson.D{{Key: "$lt", Value: bson.A{"$rating", 0}}})},
+			{Key: "comments", Value: countIf(bson.D{{Key: "$ne", Value: bson.A{"$comment", ""}}})},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate feedback: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var row struct {
+			MessageID string `bson:"_id"`
+			Total     int    `bson:"total"`
+			Up        int    `bson:"up"`
+			Down      int    `bson:"down"`
+			Comments  int    `bson:"comments"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, fmt.Errorf("failed to decode feedback stats: %w", err)
+		}
+		byMessage[localID(s.namespace, row.MessageID)] = &model.FeedbackStats{Total: row.Total, Up: row.Up, Down: row.Down, Comments: row.Comments}
+	}
+	return byMessage, cursor.Err()
+}
+
+// GetSessionStats returns aggregate statistics for a session using $group pipelines
+func (s *MongoDBStore) GetSessionStats(sessionID string) (*model.SessionStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+	defer cancel()
+
+	id := s.id(sessionID)
+	stats := &model.SessionStats{SessionID: sessionID, MessagesByRole: make(map[string]int)}
+
+	cursor, err := s.messagesCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"session_id": id}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$role"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "tokens", Value: bson.D{{Key: "$sum", Value: "$total_tokens"}}},
+			{Key: "first", Value: bson.D{{Key: "$min", Value: "$created_at"}}},
+			{Key: "last", Value: bson.D{{Key: "$max", Value: "$created_at"}}},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate messages: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var row struct {
+			Role   *string   `bson:"_id"`
+			Count  int       `bson:"count"`
+			Tokens int       `bson:"tokens"`
+			First  time.Time `bson:"first"`
+			Last   time.Time `bson:"last"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return nil, fmt.Errorf("failed to decode message stats: %w", err)
+		}
+		role := ""
+		if row.Role != nil {
+			role = *row.Role
+		}
+		stats.MessagesByRole[role] += row.Count
+		stats.TotalMessages += row.Count
+		stats.TotalTokens += row.Tokens
+		if stats.FirstMessageAt.IsZero() || row.First.Before(stats.FirstMessageAt) {
+			stats.FirstMessageAt = row.First
+		}
+		if row.Last.After(stats.LastMessageAt) {
+			stats.LastMessageAt = row.Last
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating message stats: %w", err)
+	}
+
+	toolCalls, err := s.toolCallsCollection.CountDocuments(ctx, bson.M{"session_id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tool calls: %w", err)
+	}
+	stats.ToolCalls = int(toolCalls)
+
+	summarizations, err := s.summarizationLogsCollection.CountDocuments(ctx, bson.M{"session_id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count summarization logs: %w", err)
+	}
+	stats.Summarizations = int(summarizations)
+
+	return stats, nil
+}
+
+// GetUserStats returns aggregate statistics for a user using $group pipelines
+func (s *MongoDBStore) GetUserStats(userID string) (*model.UserStats, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	stats := &model.UserStats{UserID: userID}
+	if user != nil && user.IsCurrentlyBanned() {
+		stats.IsBanned = true
+		stats.BanUntil = user.BanUntil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
+	defer cancel()
+	id := s.id(userID)
+
+	var sessions struct {
+		Count    int       `bson:"count"`
+		Archived int       `bson:"archived"`
+		Last     time.Time `bson:"last"`
+	}
+	if err := s.aggregateOne(ctx, s.collection, id, bson.D{
+		{Key: "_id", Value: nil},
+		{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		{Key: "archived", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{"$archived", 1, 0}}}}}},
+		{Key: "last", Value: bson.D{{Key: "$max", Value: "$updated_at"}}},
+	}, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to aggregate sessions: %w", err)
+	}
+	var messages struct {
+		Count  int       `bson:"count"`
+		Tokens int       `bson:"tokens"`
+		Last   time.Time `bson:"last"`
+	}
+	if err := s.aggregateOne(ctx, s.messagesCollection, id, bson.D{
+		{Key: "_id", Value: nil},
+		{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		{Key: "tokens", Value: bson.D{{Key: "$sum", Value: "$total_tokens"}}},
+		{Key: "last", Value: bson.D{{Key: "$max", Value: "$created_at"}}},
+	}, &messages); err != nil {
+		return nil, fmt.Errorf("failed to aggregate messages: %w", err)
+	}
+	stats.Sessions, stats.ArchivedSessions = sessions.Count, sessions.Archived
+	stats.TotalMessages, stats.TotalTokens = messages.Count, messages.Tokens
+	stats.LastActiveAt = sessions.Last
+	if messages.Last.After(stats.LastActiveAt) {
+		stats.LastActiveAt = messages.Last
+	}
+
+	toolCalls, err := s.toolCallsCollection.CountDocuments(ctx, bson.M{"user_id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tool calls: %w", err)
+	}
+	stats.ToolCalls = int(toolCalls)
+	openedFiles, err := s.openedFilesCollection.CountDocuments(ctx, bson.M{"user_id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count opened files: %w", err)
+	}
+	stats.OpenedFiles = int(openedFiles)
+
+	return stats, nil
+}
+
+// aggregateOne runs a single $group stage over the user's documents in collection and decodes
+// the result into out (left unchanged when the user has no documents)
+func (s *MongoDBStore) aggregateOne(ctx context.Context, collection *mongo.Collection, userID string, group bson.D, out interface{}) error {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: group}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	if cursor.Next(ctx) {
+		return cursor.Decode(out)
+	}
+	return cursor.Err()
+}
+
+// findSummarizationLogs queries summarization logs matching filter, newest first, with the given options (skip/limit)
+func (s *MongoDBStore) findSummarizationLogs(filter bson.M, opts *options.FindOptions) ([]*model.SummarizationLog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.scanTimeout)
 	defer cancel()
 
-	cursor, err := s.summarizationLogsCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	cursor, err := s.summarizationLogsCollection.Find(ctx, filter, opts.SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query summarization logs: %w", err)
 	}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ghiac/agentize/log"
+)
+
+// SessionPurger is a store that deletes expired sessions in bulk (SQLiteStore, DBStore and
+// MongoDBStore implement it)
+type SessionPurger interface {
+	// DeleteSessionsBefore deletes the sessions last updated before cutoff and their records,
+	// core sessions only when core is set and every other agent type otherwise. Returns the IDs
+	// of the deleted sessions.
+	DeleteSessionsBefore(cutoff time.Time, core bool) ([]string, error)
+}
+
+// SessionReaperConfig configures a SessionReaper
+type SessionReaperConfig struct {
+	// Interval between two passes (default: DefaultReaperInterval)
+	Interval time.Duration
+	// MaxAge is how long a session may go without update before it is deleted (0: never).
+	// It applies to every agent type but core.
+	MaxAge time.Duration
+	// CoreMaxAge is the MaxAge of core sessions (0: core sessions are never deleted). A core
+	// session holds the user's whole conversation with the Core, so it usually gets a longer one.
+	CoreMaxAge time.Duration
+}
+
+// DefaultReaperInterval is the SessionReaperConfig.Interval used when none is set
+const DefaultReaperInterval = time.Hour
+
+// SessionReaper periodically deletes the sessions nobody has used for a while, with their
+// messages, tool calls, summarization logs and opened files. Usage records, feedback and
+// memories are kept. A user whose active session was deleted gets a new one on their next
+// message.
+type SessionReaper struct {
+	store  SessionPurger
+	config SessionReaperConfig
+
+	mu   sync.Mutex // serializes passes
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewSessionReaper returns a reaper for store; call Start to run it in the background
+func NewSessionReaper(store SessionPurger, config SessionReaperConfig) *SessionReaper {
+	if config.Interval <= 0 {
+		config.Interval = DefaultReaperInterval
+	}
+	return &SessionReaper{store: store, config: config}
+}
+
+// Reap runs one pass and returns the number of deleted sessions. The core and other sessions
+// are deleted independently: a failure of one does not stop the other.
+func (r *SessionReaper) Reap() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	var firstErr error
+	for _, policy := range []struct {
+		core   bool
+		maxAge time.Duration
+	}{{false, r.config.MaxAge}, {true, r.config.CoreMaxAge}} {
+		if policy.maxAge <= 0 {
+			continue
+		}
+		sessionIDs, err := r.store.DeleteSessionsBefore(time.Now().Add(-policy.maxAge), policy.core)
+		if err != nil {
+			log.Log.Warn("[SessionReaper] ⚠️  Failed to delete expired sessions", "core", policy.core, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		deleted += len(sessionIDs)
+		if len(sessionIDs) > 0 {
+			log.Log.Info("[SessionReaper] 🧹 Deleted expired sessions", "core", policy.core, "count", len(sessionIDs), "max_age", policy.maxAge)
+		}
+	}
+	return deleted, firstErr
+}
+
+// Start runs Reap every Interval in the background until ctx is done or Stop is called.
+// It returns r, so a reaper can be created and started in one expression.
+func (r *SessionReaper) Start(ctx context.Context) *SessionReaper {
+	ctx, cancel := context.WithCancel(ctx)
+	r.stop = cancel
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Reap()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// Stop stops a started reaper and waits for a pass in progress to finish
+func (r *SessionReaper) Stop() {
+	if r.stop == nil {
+		return
+	}
+	r.stop()
+	<-r.done
+}
+
+// StartReaper starts a SessionReaper deleting the sessions of s not updated for maxAge, every
+// interval. Core sessions are exempt; use NewSessionReaper with CoreMaxAge to expire them too.
+func (s *SQLiteStore) StartReaper(ctx context.Context, interval, maxAge time.Duration) *SessionReaper {
+	return NewSessionReaper(s, SessionReaperConfig{Interval: interval, MaxAge: maxAge}).Start(ctx)
+}
+
+// StartReaper starts a SessionReaper for the store (see SQLiteStore.StartReaper)
+func (s *DBStore) StartReaper(ctx context.Context, interval, maxAge time.Duration) *SessionReaper {
+	return NewSessionReaper(s, SessionReaperConfig{Interval: interval, MaxAge: maxAge}).Start(ctx)
+}
+
+// StartReaper starts a SessionReaper for the store (see SQLiteStore.StartReaper)
+func (s *MongoDBStore) StartReaper(ctx context.Context, interval, maxAge time.Duration) *SessionReaper {
+	return NewSessionReaper(s, SessionReaperConfig{Interval: interval, MaxAge: maxAge}).Start(ctx)
+}
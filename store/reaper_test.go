@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+)
+
+func TestSessionReaper(t *testing.T) {
+	// Through DBStore, so deleted sessions must also leave its cache
+	store, err := NewDBStoreWithPath(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create DBStore: %v", err)
+	}
+	defer store.Close()
+	sqliteStore := store.sqliteStore
+
+	put := func(userID string, agentType model.AgentType, age time.Duration) *model.Session {
+		session := model.NewSessionWithType(userID, agentType)
+		if err := store.Put(session); err != nil {
+			t.Fatalf("Failed to put session: %v", err)
+		}
+		// Put stamps UpdatedAt with the current time
+		if _, err := sqliteStore.db.Exec("UPDATE sessions SET updated_at = ? WHERE session_id = ?", time.Now().Add(-age).Unix(), session.SessionID); err != nil {
+			t.Fatalf("Failed to age session: %v", err)
+		}
+		if err := sqliteStore.PutMessage(&model.Message{MessageID: session.SessionID + "-m1", UserID: userID, SessionID: session.SessionID, Role: "user"}); err != nil {
+			t.Fatalf("Failed to put message: %v", err)
+		}
+		if err := sqliteStore.PutToolCall(&model.ToolCall{ToolCallID: "call-" + session.SessionID, ToolID: session.SessionID + "-t0001", SessionID: session.SessionID, UserID: userID}); err != nil {
+			t.Fatalf("Failed to put tool call: %v", err)
+		}
+		return session
+	}
+	old := put("alice", model.AgentTypeHigh, 48*time.Hour)
+	fresh := put("bob", model.AgentTypeLow, time.Minute)
+	oldCore := put("alice", model.AgentTypeCore, 48*time.Hour)
+
+	reaper := NewSessionReaper(store, SessionReaperConfig{MaxAge: 24 * time.Hour})
+	if deleted, err := reaper.Reap(); err != nil || deleted != 1 {
+		t.Fatalf("Expected one expired session to be deleted, got %d (%v)", deleted, err)
+	}
+	if _, err := store.Get(old.SessionID); err == nil {
+		t.Error("Expected the old session to be deleted")
+	}
+	if messages, _ := sqliteStore.GetMessagesBySession(old.SessionID); len(messages) != 0 {
+		t.Errorf("Expected the old session's messages to be deleted, got %d", len(messages))
+	}
+	if toolCalls, _ := sqliteStore.GetToolCallsBySession(old.SessionID); len(toolCalls) != 0 {
+		t.Errorf("Expected the old session's tool calls to be deleted, got %d", len(toolCalls))
+	}
+	for _, kept := range []*model.Session{fresh, oldCore} {
+		if _, err := store.Get(kept.SessionID); err != nil {
+			t.Errorf("Expected session %s to be kept: %v", kept.SessionID, err)
+		}
+		if messages, _ := sqliteStore.GetMessagesBySession(kept.SessionID); len(messages) != 1 {
+			t.Errorf("Expected the messages of %s to be kept, got %d", kept.SessionID, len(messages))
+		}
+	}
+
+	// Core sessions have their own policy
+	reaper = NewSessionReaper(store, SessionReaperConfig{MaxAge: 24 * time.Hour, CoreMaxAge: 72 * time.Hour})
+	if deleted, _ := reaper.Reap(); deleted != 0 {
+		t.Errorf("Expected the core session to be kept for 72h, got %d deleted", deleted)
+	}
+	reaper = NewSessionReaper(store, SessionReaperConfig{CoreMaxAge: 24 * time.Hour})
+	if deleted, _ := reaper.Reap(); deleted != 1 {
+		t.Errorf("Expected the old core session to be deleted, got %d", deleted)
+	}
+	if _, err := store.Get(fresh.SessionID); err != nil {
+		t.Errorf("Expected the fresh session to be kept: %v", err)
+	}
+
+	// Started in the background, it runs until stopped
+	expiring := put("carol", model.AgentTypeHigh, time.Hour)
+	running := sqliteStore.StartReaper(context.Background(), 10*time.Millisecond, 30*time.Minute)
+	defer running.Stop()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := sqliteStore.Get(expiring.SessionID); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the started reaper to delete the expired session")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,296 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// snapshotVersion is the format version written by SaveSnapshot
+const snapshotVersion = 1
+
+// snapshotTables are the tables saved and restored by SaveSnapshot/LoadSnapshot
+var snapshotTables = []string{"sessions", "users", "messages", "opened_files", "tool_calls", "summarization_logs", "moderation_events", "usage_records", "feedback", "visited_nodes"}
+
+// Snapshot is the JSON document written by SaveSnapshot: every row of every store table,
+// keyed by column name
+type Snapshot struct {
+	Version   int                                 `json:"version"`
+	CreatedAt time.Time                           `json:"created_at"`
+	Tables    map[string][]map[string]interface{} `json:"tables"`
+	// VisitedNodes holds the users' visited nodes in snapshots written before they had a
+	// table; it is only read, to restore such snapshots
+	VisitedNodes map[string]*UserNodes `json:"visited_nodes,omitempty"`
+}
+
+// memoryStoreSeq names the shared in-memory databases of NewMemoryStoreWithPersistence
+var memoryStoreSeq atomic.Int64
+
+// snapshotState is the auto-flush state of a store created by NewMemoryStoreWithPersistence
+type snapshotState struct {
+	path string
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewMemoryStoreWithPersistence creates an in-memory SQLite store backed by a JSON snapshot
+// at path: the snapshot is loaded if it exists, written every flushInterval (0 disables the
+// periodic flush) and written again on Close. A zero-dependency persistent option for
+// local development and demos; use a file-based SQLiteStore for real deployments.
+func NewMemoryStoreWithPersistence(path string, flushInterval time.Duration) (*SQLiteStore, error) {
+	// A named shared-cache database, so every pooled connection sees the same data
+	dsn := fmt.Sprintf("file:agentize-mem-%d?mode=memory&cache=shared", memoryStoreSeq.Add(1))
+	s, err := NewSQLiteStore(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.LoadSnapshot(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.db.Close()
+		return nil, err
+	}
+
+	s.snapshot = &snapshotState{path: path, stop: make(chan struct{}), done: make(chan struct{})}
+	go s.flushLoop(flushInterval)
+	return s, nil
+}
+
+// flushLoop writes the snapshot every interval until Close
+func (s *SQLiteStore) flushLoop(interval time.Duration) {
+	defer close(s.snapshot.done)
+	if interval <= 0 {
+		<-s.snapshot.stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.SaveSnapshot(s.snapshot.path); err != nil {
+				s.logger().Warn("[SQLiteStore] ⚠️  Failed to flush snapshot", "path", s.snapshot.path, "error", err)
+			}
+		case <-s.snapshot.stop:
+			return
+		}
+	}
+}
+
+// closeSnapshot stops the flush loop and writes a final snapshot
+func (s *SQLiteStore) closeSnapshot() error {
+	var err error
+	s.snapshot.once.Do(func() {
+		close(s.snapshot.stop)
+		<-s.snapshot.done
+		err = s.SaveSnapshot(s.snapshot.path)
+	})
+	return err
+}
+
+// SaveSnapshot writes every session, user, message, opened file, tool call and
+// summarization log of the store to a single JSON file at path.
+// The file is replaced atomically, so a crash never leaves a half-written snapshot.
+func (s *SQLiteStore) SaveSnapshot(path string) error {
+	snap := Snapshot{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now(),
+		Tables:    make(map[string][]map[string]interface{}, len(snapshotTables)),
+	}
+
+	s.mu.RLock()
+	for _, table := range snapshotTables {
+		rows, err := s.dumpTable(table)
+		if err != nil {
+			s.mu.RUnlock()
+			return fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		snap.Tables[table] = rows
+	}
+	s.mu.RUnlock()
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create snapshot directory: %w", err)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot replaces the contents of the store with the snapshot at path written by
+// SaveSnapshot. Tables missing from the snapshot are left untouched; columns the current
+// schema does not know are ignored. Returns an error wrapping fs.ErrNotExist if there is no file.
+func (s *SQLiteStore) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var snap Snapshot
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	if err := dec.Decode(&snap); err != nil {
+		return fmt.Errorf("failed to decode snapshot %s: %w", path, err)
+	}
+	if snap.Version > snapshotVersion {
+		return fmt.Errorf("snapshot %s has version %d, newer than supported %d", path, snap.Version, snapshotVersion)
+	}
+
+	s.mu.Lock()
+	err = s.restoreTables(snap.Tables)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// The visited_nodes table was replaced, so drop the cached copies of it
+	s.userNodes.Range(func(key, _ interface{}) bool {
+		s.userNodes.Delete(key)
+		return true
+	})
+	for userID, nodes := range snap.VisitedNodes {
+		if nodes == nil {
+			continue
+		}
+		for _, digest := range nodes.VisitedNodes {
+			s.AddVisitedNode(userID, digest)
+		}
+	}
+	return nil
+}
+
+// dumpTable returns every row of table (in the store namespace) keyed by column name (caller must hold s.mu)
+func (s *SQLiteStore) dumpTable(table string) ([]map[string]interface{}, error) {
+	where, args := s.scope("", "user_id", nil)
+	rows, err := s.db.Query("SELECT * FROM "+table+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// restoreTables replaces the rows of every snapshot table in one transaction (caller must hold s.mu).
+// A namespaced store only replaces, and only restores, the rows of its namespace.
+func (s *SQLiteStore) restoreTables(tables map[string][]map[string]interface{}) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range snapshotTables {
+		rows, ok := tables[table]
+		if !ok {
+			continue
+		}
+		known, err := s.tableColumns(table)
+		if err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		where, args := s.scope("", "user_id", nil)
+		if _, err := tx.Exec("DELETE FROM "+table+where, args...); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+		for _, row := range rows {
+			if userID, _ := row["user_id"].(string); s.namespace != "" && !strings.HasPrefix(userID, s.namespace+namespaceSeparator) {
+				continue
+			}
+			columns := make([]string, 0, len(row))
+			for column := range row {
+				if known[column] {
+					columns = append(columns, column)
+				}
+			}
+			if len(columns) == 0 {
+				continue
+			}
+			sort.Strings(columns)
+			args := make([]interface{}, len(columns))
+			for i, column := range columns {
+				args[i] = snapshotValue(row[column])
+			}
+			query := fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s)",
+				table, strings.Join(columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+			if _, err := tx.Exec(query, args...); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", table, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// tableColumns returns the column names of table in the current schema
+func (s *SQLiteStore) tableColumns(table string) (map[string]bool, error) {
+	rows, err := s.db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// snapshotValue converts a decoded JSON number back to an integer or float column value
+func snapshotValue(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghiac/agentize/model"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestSQLiteStore_SnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	src, err := NewMemoryStoreWithPersistence(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	session := model.NewSessionWithType("user1", model.AgentTypeCore)
+	session.Title = "Demo"
+	session.Msgs = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}
+	if err := src.Put(session); err != nil {
+		t.Fatalf("Failed to put session: %v", err)
+	}
+	if err := src.PutUser(model.NewUser("user1")); err != nil {
+		t.Fatalf("Failed to put user: %v", err)
+	}
+	msg := model.NewUserMessage(session.SessionID+"-m0001", 1, "user1", session.SessionID, "hi", model.ContentTypeText)
+	if err := src.PutMessage(msg); err != nil {
+		t.Fatalf("Failed to put message: %v", err)
+	}
+	if err := src.PutToolCall(&model.ToolCall{
+		ToolCallID: "call_1", MessageID: msg.MessageID, SessionID: session.SessionID, UserID: "user1",
+		FunctionName: "search", Arguments: `{"q":"x"}`, CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}); err != nil {
+		t.Fatalf("Failed to put tool call: %v", err)
+	}
+	src.AddVisitedNode("user1", &model.NodeDigest{Path: "root/a", Title: "A"})
+
+	// Close writes the final snapshot
+	if err := src.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+
+	dst, err := NewMemoryStoreWithPersistence(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to restore store: %v", err)
+	}
+	defer dst.Close()
+
+	got, err := dst.Get(session.SessionID)
+	if err != nil || got.Title != "Demo" || len(got.Msgs) != 1 {
+		t.Fatalf("Expected restored session, got %+v (%v)", got, err)
+	}
+	if _, err := dst.GetUser("user1"); err != nil {
+		t.Errorf("Expected restored user: %v", err)
+	}
+	if msgs, err := dst.GetMessagesBySession(session.SessionID); err != nil || len(msgs) != 1 || msgs[0].Content != "hi" {
+		t.Errorf("Expected restored message, got %v (%v)", msgs, err)
+	}
+	if calls, err := dst.GetToolCallsBySession(session.SessionID); err != nil || len(calls) != 1 || calls[0].FunctionName != "search" {
+		t.Errorf("Expected restored tool call, got %v (%v)", calls, err)
+	}
+	if nodes := dst.GetVisitedNodes("user1"); nodes["root/a"] == nil {
+		t.Errorf("Expected restored visited nodes, got %v", nodes)
+	}
+}
@@ -9,9 +9,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
+	"github.com/ghiac/agentize/log"
 	"github.com/ghiac/agentize/model"
 	_ "modernc.org/sqlite"
 )
@@ -23,17 +25,52 @@ type SQLiteStore struct {
 	mu   sync.RWMutex
 	path string
 
-	// UserNodes tracks visited nodes for each user (user-level, not session-level)
+	// UserNodes caches visited nodes for each user (user-level, not session-level);
+	// the visited_nodes table is the source of truth
 	userNodes sync.Map
 	userLock  map[string]*sync.Mutex
 	nodesMu   sync.RWMutex // Protects userLock map
+
+	// JSON snapshot auto-flush (only for NewMemoryStoreWithPersistence)
+	snapshot *snapshotState
+
+	// namespace scopes the store to one tenant (see SQLiteStoreConfig.Namespace)
+	namespace string
+
+	// logs receives the store's logs (see SetLogger)
+	logs atomic.Pointer[log.FieldLogger]
+}
+
+// SQLiteStoreConfig holds configuration for SQLiteStore
+type SQLiteStoreConfig struct {
+	Path string // Database path (default: ":memory:")
+	// Namespace isolates tenants sharing one database: it is prefixed onto every user, session,
+	// message, tool call and file ID the store writes, stripped from the IDs it returns, and
+	// every listing only covers its own IDs. Empty means no namespace (sees every row).
+	// Must not contain ":".
+	Namespace string
+	// BusyTimeout is how long a statement waits for a lock held by another connection or
+	// process before failing with SQLITE_BUSY (default: 5s; negative fails immediately)
+	BusyTimeout time.Duration
 }
 
+// DefaultSQLiteBusyTimeout is the SQLiteStoreConfig.BusyTimeout used when none is set
+const DefaultSQLiteBusyTimeout = 5 * time.Second
+
 // NewSQLiteStore creates a new SQLite session store
 // If dbPath is empty, it uses ":memory:" for in-memory database
 // For file-based storage, use a path like "./data/sessions.db"
 // The function automatically creates the directory if it doesn't exist
 func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	return NewSQLiteStoreWithConfig(SQLiteStoreConfig{Path: dbPath})
+}
+
+// NewSQLiteStoreWithConfig creates a new SQLite session store, optionally scoped to a namespace
+func NewSQLiteStoreWithConfig(config SQLiteStoreConfig) (*SQLiteStore, error) {
+	if err := validateNamespace(config.Namespace); err != nil {
+		return nil, err
+	}
+	dbPath := config.Path
 	if dbPath == "" {
 		dbPath = ":memory:"
 	}
@@ -48,15 +85,26 @@ func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	busyTimeout := config.BusyTimeout
+	if busyTimeout == 0 {
+		busyTimeout = DefaultSQLiteBusyTimeout
+	}
+	// The pragma is applied by the driver to every connection of the pool
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	dsn := fmt.Sprintf("%s%s_pragma=busy_timeout(%d)", dbPath, sep, max(busyTimeout.Milliseconds(), 0))
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	store := &SQLiteStore{
-		db:       db,
-		path:     dbPath,
-		userLock: make(map[string]*sync.Mutex),
+		db:        db,
+		path:      dbPath,
+		userLock:  make(map[string]*sync.Mutex),
+		namespace: config.Namespace,
 	}
 
 	// Create tables
@@ -84,7 +132,15 @@ func (s *SQLiteStore) initSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
 	CREATE INDEX IF NOT EXISTS idx_sessions_updated_at ON sessions(updated_at);
 	CREATE INDEX IF NOT EXISTS idx_sessions_user_agent ON sessions(user_id, agent_type);
-	CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_user_core ON sessions(user_id, agent_type) WHERE agent_type = 'core';
+
+	CREATE TABLE IF NOT EXISTS session_tags (
+		session_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (session_id, tag)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_session_tags_user_tag ON session_tags(user_id, tag);
 	
 	CREATE TABLE IF NOT EXISTS users (
 		user_id TEXT PRIMARY KEY,
@@ -106,12 +162,14 @@ func (s *SQLiteStore) initSchema() error {
 		prompt_tokens INTEGER DEFAULT 0,
 		completion_tokens INTEGER DEFAULT 0,
 		total_tokens INTEGER DEFAULT 0,
+		reasoning_tokens INTEGER DEFAULT 0,
 		request_model TEXT,
 		max_tokens INTEGER,
 		temperature REAL,
 		has_tool_calls INTEGER DEFAULT 0,
 		finish_reason TEXT,
 		is_nonsense INTEGER DEFAULT 0,
+		is_duplicate INTEGER DEFAULT 0,
 		created_at INTEGER NOT NULL
 	);
 	
@@ -188,6 +246,80 @@ func (s *SQLiteStore) initSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_summarization_logs_user_id ON summarization_logs(user_id);
 	CREATE INDEX IF NOT EXISTS idx_summarization_logs_created_at ON summarization_logs(created_at);
 	CREATE INDEX IF NOT EXISTS idx_summarization_logs_status ON summarization_logs(status);
+	
+	CREATE TABLE IF NOT EXISTS moderation_events (
+		event_id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		actor TEXT DEFAULT '',
+		message_id TEXT DEFAULT '',
+		reason TEXT DEFAULT '',
+		duration_ms INTEGER DEFAULT 0,
+		nonsense_count INTEGER DEFAULT 0,
+		created_at INTEGER NOT NULL
+	);
+	
+	CREATE INDEX IF NOT EXISTS idx_moderation_events_user_id ON moderation_events(user_id, created_at);
+
+	CREATE TABLE IF NOT EXISTS usage_records (
+		record_id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		session_id TEXT DEFAULT '',
+		model TEXT DEFAULT '',
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		cost_usd REAL DEFAULT 0,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_usage_records_user_id ON usage_records(user_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_usage_records_created_at ON usage_records(created_at);
+
+	CREATE TABLE IF NOT EXISTS memories (
+		memory_id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		memory_key TEXT DEFAULT '',
+		text TEXT NOT NULL,
+		confidence REAL DEFAULT 1,
+		session_id TEXT DEFAULT '',
+		embedding TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		last_used_at INTEGER DEFAULT 0
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_memories_user_id ON memories(user_id, created_at);
+
+	CREATE TABLE IF NOT EXISTS feedback (
+		feedback_id TEXT PRIMARY KEY,
+		message_id TEXT NOT NULL,
+		session_id TEXT DEFAULT '',
+		user_id TEXT NOT NULL,
+		rating INTEGER NOT NULL,
+		comment TEXT DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_feedback_message_id ON feedback(message_id);
+	CREATE INDEX IF NOT EXISTS idx_feedback_user_id ON feedback(user_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_feedback_created_at ON feedback(created_at);
+
+	CREATE TABLE IF NOT EXISTS knowledge_chunks (
+		chunk_id TEXT PRIMARY KEY,
+		node_path TEXT NOT NULL,
+		title TEXT DEFAULT '',
+		text TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		embedding TEXT NOT NULL,
+		indexed_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS visited_nodes (
+		user_id TEXT NOT NULL,
+		node_path TEXT NOT NULL,
+		data TEXT NOT NULL,
+		visited_at INTEGER NOT NULL,
+		PRIMARY KEY (user_id, node_path)
+	);
 	`
 
 	_, err := s.db.Exec(schema)
@@ -199,6 +331,9 @@ func (s *SQLiteStore) initSchema() error {
 	// SQLite doesn't support IF NOT EXISTS for ALTER TABLE ADD COLUMN, so we ignore errors
 	_ = s.migrateAddIsNonsenseColumn()
 
+	// Migration: Add is_duplicate column to messages table if it doesn't exist
+	_ = s.migrateAddIsDuplicateColumn()
+
 	// Migration: Add new columns to summarization_logs table for existing databases
 	_ = s.migrateSummarizationLogsColumns()
 
@@ -208,9 +343,22 @@ func (s *SQLiteStore) initSchema() error {
 	// Migration: Add seq_id column to messages table if it doesn't exist (for existing databases)
 	_ = s.migrateAddSeqIDColumn()
 
+	// Migration: Add the fact columns to memories table
+	_ = s.migrateAddMemoryFactColumns()
+
 	// Migration: Add session_seq column to sessions table if it doesn't exist (for existing databases)
 	_ = s.migrateAddSessionSeqColumn()
 
+	// Migration: Add archived column and limit core session uniqueness to non-archived sessions
+	if err := s.migrateAddArchivedColumn(); err != nil {
+		return err
+	}
+
+	// Migration: Fill session_tags from the tags of sessions stored before it existed
+	if err := s.migrateSessionTags(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -221,6 +369,13 @@ func (s *SQLiteStore) migrateAddIsNonsenseColumn() error {
 	return nil
 }
 
+// migrateAddIsDuplicateColumn adds is_duplicate column to messages table if it doesn't exist
+func (s *SQLiteStore) migrateAddIsDuplicateColumn() error {
+	_, _ = s.db.Exec(`ALTER TABLE messages ADD COLUMN is_duplicate INTEGER DEFAULT 0`)
+	// Ignore error if column already exists
+	return nil
+}
+
 // migrateAddMessageTypeColumns adds agent_type and content_type columns to messages table
 func (s *SQLiteStore) migrateAddMessageTypeColumns() error {
 	_, _ = s.db.Exec(`ALTER TABLE messages ADD COLUMN agent_type TEXT DEFAULT ''`)
@@ -236,6 +391,15 @@ func (s *SQLiteStore) migrateAddMessageTypeColumns() error {
 	// Add status and error to tool_calls table (pending|success|failed)
 	_, _ = s.db.Exec(`ALTER TABLE tool_calls ADD COLUMN status TEXT DEFAULT 'pending'`)
 	_, _ = s.db.Exec(`ALTER TABLE tool_calls ADD COLUMN error TEXT DEFAULT ''`)
+	// Add sources to tool_calls table (web search citations as JSON)
+	_, _ = s.db.Exec(`ALTER TABLE tool_calls ADD COLUMN sources TEXT DEFAULT ''`)
+	// Add args_validation and args_validation_detail to tool_calls table (argument check outcome)
+	_, _ = s.db.Exec(`ALTER TABLE tool_calls ADD COLUMN args_validation TEXT DEFAULT ''`)
+	_, _ = s.db.Exec(`ALTER TABLE tool_calls ADD COLUMN args_validation_detail TEXT DEFAULT ''`)
+	// Add mcp_server to tool_calls table (the MCP server that served the call)
+	_, _ = s.db.Exec(`ALTER TABLE tool_calls ADD COLUMN mcp_server TEXT DEFAULT ''`)
+	// Add reasoning_tokens to messages table (reasoning part of the completion tokens)
+	_, _ = s.db.Exec(`ALTER TABLE messages ADD COLUMN reasoning_tokens INTEGER DEFAULT 0`)
 	// Ignore errors if columns already exist
 	return nil
 }
@@ -249,6 +413,19 @@ func (s *SQLiteStore) migrateAddSeqIDColumn() error {
 	return nil
 }
 
+// migrateAddMemoryFactColumns adds the key, confidence, source session and last use of facts
+// to memories table. Memories stored before count as used when they were created.
+func (s *SQLiteStore) migrateAddMemoryFactColumns() error {
+	_, _ = s.db.Exec(`ALTER TABLE memories ADD COLUMN memory_key TEXT DEFAULT ''`)
+	_, _ = s.db.Exec(`ALTER TABLE memories ADD COLUMN confidence REAL DEFAULT 1`)
+	_, _ = s.db.Exec(`ALTER TABLE memories ADD COLUMN session_id TEXT DEFAULT ''`)
+	if _, err := s.db.Exec(`ALTER TABLE memories ADD COLUMN last_used_at INTEGER DEFAULT 0`); err == nil {
+		_, _ = s.db.Exec(`UPDATE memories SET last_used_at = created_at`)
+	}
+	// Ignore errors if columns already exist
+	return nil
+}
+
 // migrateAddSessionSeqColumn adds session_seq column to sessions table if it doesn't exist
 // This is needed for backward compatibility with older databases
 // Also creates the index for (user_id, agent_type) if it doesn't exist
@@ -261,6 +438,79 @@ func (s *SQLiteStore) migrateAddSessionSeqColumn() error {
 	return nil
 }
 
+// migrateAddArchivedColumn adds the archived column to sessions. Archived core sessions are kept,
+// so the one-core-session-per-user index only covers non-archived sessions.
+func (s *SQLiteStore) migrateAddArchivedColumn() error {
+	// Ignore error if column already exists
+	_, _ = s.db.Exec(`ALTER TABLE sessions ADD COLUMN archived INTEGER NOT NULL DEFAULT 0`)
+	if _, err := s.db.Exec(`DROP INDEX IF EXISTS idx_sessions_user_core`); err != nil {
+		return fmt.Errorf("failed to drop core session index: %w", err)
+	}
+	if _, err := s.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_user_active_core ON sessions(user_id) WHERE agent_type = 'core' AND archived = 0`); err != nil {
+		return fmt.Errorf("failed to create core session index: %w", err)
+	}
+	return nil
+}
+
+// migrateSessionTags indexes the tags of existing sessions when session_tags is still empty
+func (s *SQLiteStore) migrateSessionTags() error {
+	var indexed int
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM session_tags)`).Scan(&indexed); err != nil {
+		return fmt.Errorf("failed to check session tags: %w", err)
+	}
+	if indexed == 1 {
+		return nil
+	}
+	rows, err := s.db.Query(`SELECT session_id, user_id, data FROM sessions`)
+	if err != nil {
+		return fmt.Errorf("failed to query sessions for tags: %w", err)
+	}
+	type taggedSession struct {
+		sessionID, userID string
+		tags              []string
+	}
+	var tagged []taggedSession
+	for rows.Next() {
+		var sessionID, userID, data string
+		if err := rows.Scan(&sessionID, &userID, &data); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan session: %w", err)
+		}
+		var session struct{ Tags []string }
+		if json.Unmarshal([]byte(data), &session) == nil && len(session.Tags) > 0 {
+			tagged = append(tagged, taggedSession{sessionID, userID, session.Tags})
+		}
+	}
+	rows.Close()
+	for _, t := range tagged {
+		if err := replaceSessionTags(s.db, t.sessionID, t.userID, t.tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlExecer is implemented by *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// replaceSessionTags replaces the session_tags rows of a session (IDs already namespaced)
+func replaceSessionTags(db sqlExecer, sessionID, userID string, tags []string) error {
+	if _, err := db.Exec("DELETE FROM session_tags WHERE session_id = ?", sessionID); err != nil {
+		return fmt.Errorf("failed to delete session tags: %w", err)
+	}
+	for _, tag := range model.NormalizeTags(tags) {
+		if _, err := db.Exec(
+			"INSERT OR IGNORE INTO session_tags (session_id, user_id, tag) VALUES (?, ?, ?)",
+			sessionID, userID, tag,
+		); err != nil {
+			return fmt.Errorf("failed to store session tag: %w", err)
+		}
+	}
+	return nil
+}
+
 // migrateSummarizationLogsColumns adds new columns to summarization_logs table for existing databases
 func (s *SQLiteStore) migrateSummarizationLogsColumns() error {
 	// Add new columns - ignore errors if columns already exist
@@ -292,9 +542,56 @@ func (s *SQLiteStore) migrateSummarizationLogsColumns() error {
 
 // Close closes the database connection
 func (s *SQLiteStore) Close() error {
+	if s.snapshot != nil {
+		if err := s.closeSnapshot(); err != nil {
+			s.logger().Warn("[SQLiteStore] ⚠️  Failed to write snapshot on close", "path", s.snapshot.path, "error", err)
+		}
+	}
 	return s.db.Close()
 }
 
+// Namespace returns the namespace the store is scoped to ("" if none)
+func (s *SQLiteStore) Namespace() string {
+	return s.namespace
+}
+
+// SetLogger sets the logger receiving the store's logs (nil: log.Log)
+func (s *SQLiteStore) SetLogger(l log.FieldLogger) {
+	s.logs.Store(&l)
+}
+
+// logger returns the store's logger (see SetLogger)
+func (s *SQLiteStore) logger() log.FieldLogger {
+	if l := s.logs.Load(); l != nil {
+		return log.Or(*l)
+	}
+	return log.Log
+}
+
+// id prefixes the store namespace onto an ID written to or looked up in the database
+func (s *SQLiteStore) id(id string) string {
+	return namespacedID(s.namespace, id)
+}
+
+// local strips the store namespace from an ID read from the database
+func (s *SQLiteStore) local(id string) string {
+	return localID(s.namespace, id)
+}
+
+// scope adds the namespace condition on column to a WHERE clause built by timeRangeWhere
+// (or an empty one), so listings never return rows of another namespace
+func (s *SQLiteStore) scope(where, column string, args []interface{}) (string, []interface{}) {
+	if s.namespace == "" {
+		return where, args
+	}
+	cond := column + ` LIKE ? ESCAPE '\'`
+	args = append(args, namespaceLikePattern(s.namespace))
+	if where == "" {
+		return " WHERE " + cond, args
+	}
+	return where + " AND " + cond, args
+}
+
 // getOrCreateLock gets or creates a mutex for a userID
 func (s *SQLiteStore) getOrCreateLock(userID string) *sync.Mutex {
 	s.nodesMu.RLock()
@@ -328,7 +625,7 @@ func (s *SQLiteStore) Get(sessionID string) (*model.Session, error) {
 
 	err := s.db.QueryRow(
 		"SELECT data, created_at, updated_at FROM sessions WHERE session_id = ?",
-		sessionID,
+		s.id(sessionID),
 	).Scan(&data, &createdAt, &updatedAt)
 
 	if err == sql.ErrNoRows {
@@ -372,7 +669,7 @@ func (s *SQLiteStore) getMaxSeqIDForSession(sessionID string) int {
 	var maxSeqID sql.NullInt64
 	err := s.db.QueryRow(
 		"SELECT MAX(seq_id) FROM messages WHERE session_id = ?",
-		sessionID,
+		s.id(sessionID),
 	).Scan(&maxSeqID)
 	if err != nil || !maxSeqID.Valid {
 		return 0
@@ -384,7 +681,7 @@ func (s *SQLiteStore) getMaxSeqIDForSession(sessionID string) int {
 func (s *SQLiteStore) getMaxToolSeqForSession(sessionID string) int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	rows, err := s.db.Query("SELECT tool_id FROM tool_calls WHERE session_id = ?", sessionID)
+	rows, err := s.db.Query("SELECT tool_id FROM tool_calls WHERE session_id = ?", s.id(sessionID))
 	if err != nil {
 		return 0
 	}
@@ -433,22 +730,23 @@ func (s *SQLiteStore) Put(session *model.Session) error {
 
 	// Use INSERT OR REPLACE for upsert behavior
 	_, err = s.db.Exec(
-		`INSERT OR REPLACE INTO sessions (session_id, user_id, agent_type, session_seq, data, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		session.SessionID,
-		session.UserID,
+		`INSERT OR REPLACE INTO sessions (session_id, user_id, agent_type, session_seq, data, created_at, updated_at, archived)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.id(session.SessionID),
+		s.id(session.UserID),
 		string(session.AgentType),
 		sessionSeq,
 		string(data),
 		createdAt,
 		updatedAt,
+		session.Archived,
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to store session: %w", err)
 	}
 
-	return nil
+	return replaceSessionTags(s.db, s.id(session.SessionID), s.id(session.UserID), session.Tags)
 }
 
 // extractSessionSeq extracts the sequence number from a session ID
@@ -473,26 +771,33 @@ func (s *SQLiteStore) Delete(sessionID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	_, err := s.db.Exec("DELETE FROM sessions WHERE session_id = ?", sessionID)
+	_, err := s.db.Exec("DELETE FROM sessions WHERE session_id = ?", s.id(sessionID))
 	if err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
+	if _, err := s.db.Exec("DELETE FROM session_tags WHERE session_id = ?", s.id(sessionID)); err != nil {
+		return fmt.Errorf("failed to delete session tags: %w", err)
+	}
 
 	return nil
 }
 
 // DeleteUserData deletes all sessions, messages, tool calls, summarization logs,
-// and opened files for a user. Resets user's ActiveSessionIDs and SessionSeqs.
+// opened files and visited nodes for a user. Resets user's ActiveSessionIDs and SessionSeqs.
 func (s *SQLiteStore) DeleteUserData(userID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.userNodes.Delete(userID)
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	userID = s.id(userID)
+
 	// Delete in order (child tables first, then sessions, then update user)
 	if _, err := tx.Exec("DELETE FROM messages WHERE user_id = ?", userID); err != nil {
 		return fmt.Errorf("failed to delete messages: %w", err)
@@ -506,6 +811,21 @@ func (s *SQLiteStore) DeleteUserData(userID string) error {
 	if _, err := tx.Exec("DELETE FROM opened_files WHERE user_id = ?", userID); err != nil {
 		return fmt.Errorf("failed to delete opened_files: %w", err)
 	}
+	if _, err := tx.Exec("DELETE FROM usage_records WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete usage_records: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM memories WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete memories: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM feedback WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete feedback: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM visited_nodes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete visited_nodes: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM session_tags WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete session_tags: %w", err)
+	}
 	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
 		return fmt.Errorf("failed to delete sessions: %w", err)
 	}
@@ -537,6 +857,61 @@ func (s *SQLiteStore) DeleteUserData(userID string) error {
 	return tx.Commit()
 }
 
+// DeleteSessionsBefore implements SessionPurger. The sessions are deleted with their messages,
+// tool calls, summarization logs, opened files and tags in one transaction.
+func (s *SQLiteStore) DeleteSessionsBefore(cutoff time.Time, core bool) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	op := "!="
+	if core {
+		op = "="
+	}
+	where, args := s.scope(" WHERE updated_at < ? AND agent_type "+op+" ?", "session_id", []interface{}{cutoff.Unix(), string(model.AgentTypeCore)})
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT session_id FROM sessions"+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired sessions: %w", err)
+	}
+	var sessionIDs []string
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessionIDs = append(sessionIDs, s.local(sessionID))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query expired sessions: %w", err)
+	}
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+
+	// Child tables first; the store lock keeps the selection the same for every statement
+	expired := "SELECT session_id FROM sessions" + where
+	for _, table := range []string{"messages", "tool_calls", "summarization_logs", "opened_files", "session_tags"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE session_id IN ("+expired+")", args...); err != nil {
+			return nil, fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM sessions"+where, args...); err != nil {
+		return nil, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit session deletion: %w", err)
+	}
+	return sessionIDs, nil
+}
+
 // List returns all sessions for a user
 func (s *SQLiteStore) List(userID string) ([]*model.Session, error) {
 	s.mu.RLock()
@@ -544,7 +919,7 @@ func (s *SQLiteStore) List(userID string) ([]*model.Session, error) {
 
 	rows, err := s.db.Query(
 		"SELECT data, created_at, updated_at FROM sessions WHERE user_id = ? ORDER BY updated_at DESC",
-		userID,
+		s.id(userID),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query sessions: %w", err)
@@ -588,7 +963,7 @@ func (s *SQLiteStore) GetNextSessionSeq(userID string, agentType model.AgentType
 	var maxSeq sql.NullInt64
 	err := s.db.QueryRow(
 		"SELECT MAX(session_seq) FROM sessions WHERE user_id = ? AND agent_type = ?",
-		userID, string(agentType),
+		s.id(userID), string(agentType),
 	).Scan(&maxSeq)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get max session seq: %w", err)
@@ -605,8 +980,25 @@ func (s *SQLiteStore) GetAllSessions() (map[string][]*model.Session, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	where, args := s.scope("", "user_id", nil)
+	return s.querySessionsByUser(where, args)
+}
+
+// GetSessionsByTimeRange implements debuger.DebugStore
+func (s *SQLiteStore) GetSessionsByTimeRange(from, to time.Time) (map[string][]*model.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	where, args := timeRangeWhere("updated_at", from, to)
+	where, args = s.scope(where, "user_id", args)
+	return s.querySessionsByUser(where, args)
+}
+
+// querySessionsByUser runs a sessions SELECT with an optional WHERE clause (caller must hold s.mu)
+func (s *SQLiteStore) querySessionsByUser(where string, args []interface{}) (map[string][]*model.Session, error) {
 	rows, err := s.db.Query(
-		"SELECT data, created_at, updated_at FROM sessions ORDER BY updated_at DESC",
+		"SELECT data, created_at, updated_at FROM sessions"+where+" ORDER BY updated_at DESC",
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query all sessions: %w", err)
@@ -642,7 +1034,7 @@ func (s *SQLiteStore) GetAllSessions() (map[string][]*model.Session, error) {
 }
 
 // GetCoreSession returns the Core session for a user
-// For each user, there should be only one Core session
+// For each user, there should be only one non-archived Core session; archived ones are never returned
 // If no Core session exists, it returns nil without error
 func (s *SQLiteStore) GetCoreSession(userID string) (*model.Session, error) {
 	s.mu.RLock()
@@ -652,8 +1044,8 @@ func (s *SQLiteStore) GetCoreSession(userID string) (*model.Session, error) {
 	var createdAt, updatedAt int64
 
 	err := s.db.QueryRow(
-		"SELECT data, created_at, updated_at FROM sessions WHERE user_id = ? AND agent_type = ? LIMIT 1",
-		userID,
+		"SELECT data, created_at, updated_at FROM sessions WHERE user_id = ? AND agent_type = ? AND archived = 0 LIMIT 1",
+		s.id(userID),
 		string(model.AgentTypeCore),
 	).Scan(&data, &createdAt, &updatedAt)
 
@@ -677,7 +1069,7 @@ func (s *SQLiteStore) GetCoreSession(userID string) (*model.Session, error) {
 }
 
 // PutCoreSession stores or updates a Core session for a user
-// This ensures only one Core session exists per user by deleting any existing Core sessions first
+// This ensures only one Core session exists per user by deleting any existing non-archived Core sessions first
 func (s *SQLiteStore) PutCoreSession(session *model.Session) error {
 	if session == nil {
 		return fmt.Errorf("session cannot be nil")
@@ -689,11 +1081,22 @@ func (s *SQLiteStore) PutCoreSession(session *model.Session) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Delete any existing Core sessions for this user
+	// Delete any existing Core sessions for this user (archived ones are kept), with their tags
 	_, err := s.db.Exec(
-		"DELETE FROM sessions WHERE user_id = ? AND agent_type = ?",
-		session.UserID,
+		`DELETE FROM session_tags WHERE session_id IN (
+			SELECT session_id FROM sessions WHERE user_id = ? AND agent_type = ? AND (archived = 0 OR session_id = ?))`,
+		s.id(session.UserID),
+		string(model.AgentTypeCore),
+		s.id(session.SessionID),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete existing core session tags: %w", err)
+	}
+	_, err = s.db.Exec(
+		"DELETE FROM sessions WHERE user_id = ? AND agent_type = ? AND (archived = 0 OR session_id = ?)",
+		s.id(session.UserID),
 		string(model.AgentTypeCore),
+		s.id(session.SessionID),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to delete existing core sessions: %w", err)
@@ -717,26 +1120,78 @@ func (s *SQLiteStore) PutCoreSession(session *model.Session) error {
 	// Use INSERT OR REPLACE to handle case where session_id might already exist
 	// (e.g., from a previous session with different agent_type)
 	_, err = s.db.Exec(
-		`INSERT OR REPLACE INTO sessions (session_id, user_id, agent_type, session_seq, data, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		session.SessionID,
-		session.UserID,
+		`INSERT OR REPLACE INTO sessions (session_id, user_id, agent_type, session_seq, data, created_at, updated_at, archived)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.id(session.SessionID),
+		s.id(session.UserID),
 		string(session.AgentType),
 		sessionSeq,
 		string(data),
 		createdAt,
 		updatedAt,
+		session.Archived,
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to store core session: %w", err)
 	}
 
-	return nil
+	return replaceSessionTags(s.db, s.id(session.SessionID), s.id(session.UserID), session.Tags)
+}
+
+// FindSessionsByTags implements model.SessionTagStore using the session_tags index
+func (s *SQLiteStore) FindSessionsByTags(userID string, tags []string, matchAll bool) ([]*model.Session, error) {
+	tags = model.NormalizeTags(tags)
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	args := []interface{}{s.id(userID)}
+	for _, tag := range tags {
+		args = append(args, tag)
+	}
+	having := ""
+	if matchAll {
+		having = " HAVING COUNT(*) = ?"
+		args = append(args, len(tags))
+	}
+	query := `SELECT data, created_at, updated_at FROM sessions WHERE session_id IN (
+		SELECT session_id FROM session_tags WHERE user_id = ? AND tag IN (?` + strings.Repeat(", ?", len(tags)-1) + `)
+		GROUP BY session_id` + having + `) ORDER BY updated_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions by tags: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*model.Session
+	for rows.Next() {
+		var data string
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&data, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		session := &model.Session{}
+		if err := json.Unmarshal([]byte(data), session); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+		}
+		session.CreatedAt = time.Unix(createdAt, 0)
+		session.UpdatedAt = time.Unix(updatedAt, 0)
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+	return sessions, nil
 }
 
 // AddVisitedNode adds a visited node for a user
-// This tracks nodes at user level, across all sessions
+// This tracks nodes at user level, across all sessions. The node is written to the
+// visited_nodes table; the in-memory map is a write-through cache of it.
 func (s *SQLiteStore) AddVisitedNode(userID string, nodeDigest *model.NodeDigest) {
 	if nodeDigest == nil {
 		return
@@ -746,23 +1201,68 @@ func (s *SQLiteStore) AddVisitedNode(userID string, nodeDigest *model.NodeDigest
 	lock.Lock()
 	defer lock.Unlock()
 
+	un := s.loadVisitedNodes(userID)
+	un.VisitedNodes[nodeDigest.Path] = nodeDigest
+	un.LastActivity = time.Now()
+	s.userNodes.Store(userID, un)
+
+	data, err := json.Marshal(nodeDigest)
+	if err != nil {
+		s.logger().Warn("[SQLiteStore] ⚠️  Failed to marshal visited node", "user_id", userID, "path", nodeDigest.Path, "error", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.db.Exec(
+		`INSERT OR REPLACE INTO visited_nodes (user_id, node_path, data, visited_at) VALUES (?, ?, ?, ?)`,
+		s.id(userID), nodeDigest.Path, string(data), un.LastActivity.Unix(),
+	); err != nil {
+		s.logger().Warn("[SQLiteStore] ⚠️  Failed to store visited node", "user_id", userID, "path", nodeDigest.Path, "error", err)
+	}
+}
+
+// loadVisitedNodes returns the cached visited nodes of a user, reading them from the
+// visited_nodes table on first access (caller must hold the user's lock)
+func (s *SQLiteStore) loadVisitedNodes(userID string) *UserNodes {
 	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		if un.VisitedNodes == nil {
-			un.VisitedNodes = make(map[string]*model.NodeDigest)
+		return userNodes.(*UserNodes)
+	}
+
+	un := &UserNodes{VisitedNodes: make(map[string]*model.NodeDigest)}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT node_path, data, visited_at FROM visited_nodes WHERE user_id = ?`, s.id(userID))
+	if err != nil {
+		s.logger().Warn("[SQLiteStore] ⚠️  Failed to load visited nodes", "user_id", userID, "error", err)
+		return un
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var path, data string
+		var visitedAt int64
+		if err := rows.Scan(&path, &data, &visitedAt); err != nil {
+			s.logger().Warn("[SQLiteStore] ⚠️  Failed to scan visited node", "user_id", userID, "error", err)
+			return un
 		}
-		un.VisitedNodes[nodeDigest.Path] = nodeDigest
-		un.LastActivity = time.Now()
-		s.userNodes.Store(userID, un)
-	} else {
-		un := &UserNodes{
-			VisitedNodes: map[string]*model.NodeDigest{
-				nodeDigest.Path: nodeDigest,
-			},
-			LastActivity: time.Now(),
+		digest := &model.NodeDigest{}
+		if err := json.Unmarshal([]byte(data), digest); err != nil {
+			continue
+		}
+		digest.Path = path
+		un.VisitedNodes[path] = digest
+		if t := time.Unix(visitedAt, 0); t.After(un.LastActivity) {
+			un.LastActivity = t
 		}
-		s.userNodes.Store(userID, un)
 	}
+	if err := rows.Err(); err != nil {
+		s.logger().Warn("[SQLiteStore] ⚠️  Failed to load visited nodes", "user_id", userID, "error", err)
+		return un
+	}
+
+	s.userNodes.Store(userID, un)
+	return un
 }
 
 // GetVisitedNodes returns all visited nodes for a user
@@ -771,18 +1271,15 @@ func (s *SQLiteStore) GetVisitedNodes(userID string) map[string]*model.NodeDiges
 	lock.Lock()
 	defer lock.Unlock()
 
-	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		// Return a copy to prevent external modification
-		result := make(map[string]*model.NodeDigest)
-		for k, v := range un.VisitedNodes {
-			// Create a copy of NodeDigest
-			digestCopy := *v
-			result[k] = &digestCopy
-		}
-		return result
+	un := s.loadVisitedNodes(userID)
+	// Return a copy to prevent external modification
+	result := make(map[string]*model.NodeDigest, len(un.VisitedNodes))
+	for k, v := range un.VisitedNodes {
+		// Create a copy of NodeDigest
+		digestCopy := *v
+		result[k] = &digestCopy
 	}
-	return make(map[string]*model.NodeDigest)
+	return result
 }
 
 // GetVisitedNodePaths returns a list of visited node paths for a user
@@ -791,15 +1288,12 @@ func (s *SQLiteStore) GetVisitedNodePaths(userID string) []string {
 	lock.Lock()
 	defer lock.Unlock()
 
-	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		paths := make([]string, 0, len(un.VisitedNodes))
-		for path := range un.VisitedNodes {
-			paths = append(paths, path)
-		}
-		return paths
+	un := s.loadVisitedNodes(userID)
+	paths := make([]string, 0, len(un.VisitedNodes))
+	for path := range un.VisitedNodes {
+		paths = append(paths, path)
 	}
-	return []string{}
+	return paths
 }
 
 // HasVisitedNode checks if a user has visited a specific node
@@ -808,12 +1302,8 @@ func (s *SQLiteStore) HasVisitedNode(userID string, nodePath string) bool {
 	lock.Lock()
 	defer lock.Unlock()
 
-	if userNodes, ok := s.userNodes.Load(userID); ok {
-		un := userNodes.(*UserNodes)
-		_, exists := un.VisitedNodes[nodePath]
-		return exists
-	}
-	return false
+	_, exists := s.loadVisitedNodes(userID).VisitedNodes[nodePath]
+	return exists
 }
 
 // ClearVisitedNodes clears all visited nodes for a user
@@ -823,6 +1313,12 @@ func (s *SQLiteStore) ClearVisitedNodes(userID string) {
 	defer lock.Unlock()
 
 	s.userNodes.Delete(userID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.db.Exec(`DELETE FROM visited_nodes WHERE user_id = ?`, s.id(userID)); err != nil {
+		s.logger().Warn("[SQLiteStore] ⚠️  Failed to clear visited nodes", "user_id", userID, "error", err)
+	}
 }
 
 // NewSQLiteStoreFromFile creates a new SQLite session store from a file path
@@ -842,7 +1338,7 @@ func (s *SQLiteStore) GetUser(userID string) (*model.User, error) {
 
 	err := s.db.QueryRow(
 		"SELECT data, created_at, updated_at FROM users WHERE user_id = ?",
-		userID,
+		s.id(userID),
 	).Scan(&data, &createdAt, &updatedAt)
 
 	if err == sql.ErrNoRows {
@@ -898,7 +1394,7 @@ func (s *SQLiteStore) PutUser(user *model.User) error {
 	_, err = s.db.Exec(
 		`INSERT OR REPLACE INTO users (user_id, data, created_at, updated_at)
 		 VALUES (?, ?, ?, ?)`,
-		user.UserID,
+		s.id(user.UserID),
 		string(data),
 		createdAt,
 		updatedAt,
@@ -962,7 +1458,7 @@ func (s *SQLiteStore) computeSessionSeqs(user *model.User) error {
 	// Get max session_seq for each agent type
 	rows, err := s.db.Query(
 		`SELECT agent_type, MAX(session_seq) FROM sessions WHERE user_id = ? GROUP BY agent_type`,
-		user.UserID,
+		s.id(user.UserID),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to query max session seqs: %w", err)
@@ -1002,10 +1498,10 @@ func (s *SQLiteStore) computeActiveSessionIDs(user *model.User) error {
 		return err
 	}
 
-	// Find the most recent session for each agent type
+	// Find the most recent session for each agent type (an archived session is never active)
 	latestByType := make(map[model.AgentType]*model.Session)
 	for _, session := range sessions {
-		if session.AgentType == "" {
+		if session.AgentType == "" || session.Archived {
 			continue
 		}
 		existing := latestByType[session.AgentType]
@@ -1045,19 +1541,23 @@ func (s *SQLiteStore) PutMessage(message *model.Message) error {
 	if message.IsNonsense {
 		isNonsense = 1
 	}
+	isDuplicate := 0
+	if message.IsDuplicate {
+		isDuplicate = 1
+	}
 
 	// Use INSERT OR REPLACE for upsert behavior
 	_, err := s.db.Exec(
 		`INSERT OR REPLACE INTO messages (
 			message_id, seq_id, user_id, session_id, role, content, model,
 			agent_type, content_type,
-			prompt_tokens, completion_tokens, total_tokens,
-			request_model, max_tokens, temperature, has_tool_calls, finish_reason, is_nonsense, created_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		message.MessageID,
+			prompt_tokens, completion_tokens, total_tokens, reasoning_tokens,
+			request_model, max_tokens, temperature, has_tool_calls, finish_reason, is_nonsense, is_duplicate, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.id(message.MessageID),
 		message.SeqID,
-		message.UserID,
-		message.SessionID,
+		s.id(message.UserID),
+		s.id(message.SessionID),
 		message.Role,
 		message.Content,
 		message.Model,
@@ -1066,12 +1566,14 @@ func (s *SQLiteStore) PutMessage(message *model.Message) error {
 		message.PromptTokens,
 		message.CompletionTokens,
 		message.TotalTokens,
+		message.ReasoningTokens,
 		message.RequestModel,
 		message.MaxTokens,
 		message.Temperature,
 		hasToolCalls,
 		message.FinishReason,
 		isNonsense,
+		isDuplicate,
 		createdAt,
 	)
 
@@ -1090,10 +1592,10 @@ func (s *SQLiteStore) GetMessagesBySession(sessionID string) ([]*model.Message,
 	rows, err := s.db.Query(
 		`SELECT message_id, seq_id, user_id, session_id, role, content, model,
 			agent_type, content_type,
-			prompt_tokens, completion_tokens, total_tokens,
-			request_model, max_tokens, temperature, has_tool_calls, finish_reason, is_nonsense, created_at
+			prompt_tokens, completion_tokens, total_tokens, reasoning_tokens,
+			request_model, max_tokens, temperature, has_tool_calls, finish_reason, is_nonsense, is_duplicate, created_at
 		FROM messages WHERE session_id = ? ORDER BY created_at DESC`,
-		sessionID,
+		s.id(sessionID),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
@@ -1105,7 +1607,7 @@ func (s *SQLiteStore) GetMessagesBySession(sessionID string) ([]*model.Message,
 		msg := &model.Message{}
 		var createdAt int64
 		var hasToolCallsInt int
-		var isNonsenseInt int
+		var isNonsenseInt, isDuplicateInt int
 		var agentType, contentType string
 
 		err := rows.Scan(
@@ -1121,12 +1623,14 @@ func (s *SQLiteStore) GetMessagesBySession(sessionID string) ([]*model.Message,
 			&msg.PromptTokens,
 			&msg.CompletionTokens,
 			&msg.TotalTokens,
+			&msg.ReasoningTokens,
 			&msg.RequestModel,
 			&msg.MaxTokens,
 			&msg.Temperature,
 			&hasToolCallsInt,
 			&msg.FinishReason,
 			&isNonsenseInt,
+			&isDuplicateInt,
 			&createdAt,
 		)
 		if err != nil {
@@ -1137,7 +1641,9 @@ func (s *SQLiteStore) GetMessagesBySession(sessionID string) ([]*model.Message,
 		msg.ContentType = model.ContentType(contentType)
 		msg.HasToolCalls = hasToolCallsInt != 0
 		msg.IsNonsense = isNonsenseInt != 0
+		msg.IsDuplicate = isDuplicateInt != 0
 		msg.CreatedAt = time.Unix(createdAt, 0)
+		s.localMessage(msg)
 		messages = append(messages, msg)
 	}
 
@@ -1156,10 +1662,10 @@ func (s *SQLiteStore) GetMessagesByUser(userID string) ([]*model.Message, error)
 	rows, err := s.db.Query(
 		`SELECT message_id, seq_id, user_id, session_id, role, content, model,
 			agent_type, content_type,
-			prompt_tokens, completion_tokens, total_tokens,
-			request_model, max_tokens, temperature, has_tool_calls, finish_reason, is_nonsense, created_at
+			prompt_tokens, completion_tokens, total_tokens, reasoning_tokens,
+			request_model, max_tokens, temperature, has_tool_calls, finish_reason, is_nonsense, is_duplicate, created_at
 		FROM messages WHERE user_id = ? ORDER BY created_at DESC`,
-		userID,
+		s.id(userID),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
@@ -1171,7 +1677,7 @@ func (s *SQLiteStore) GetMessagesByUser(userID string) ([]*model.Message, error)
 		msg := &model.Message{}
 		var createdAt int64
 		var hasToolCallsInt int
-		var isNonsenseInt int
+		var isNonsenseInt, isDuplicateInt int
 		var agentType, contentType string
 
 		err := rows.Scan(
@@ -1187,12 +1693,14 @@ func (s *SQLiteStore) GetMessagesByUser(userID string) ([]*model.Message, error)
 			&msg.PromptTokens,
 			&msg.CompletionTokens,
 			&msg.TotalTokens,
+			&msg.ReasoningTokens,
 			&msg.RequestModel,
 			&msg.MaxTokens,
 			&msg.Temperature,
 			&hasToolCallsInt,
 			&msg.FinishReason,
 			&isNonsenseInt,
+			&isDuplicateInt,
 			&createdAt,
 		)
 		if err != nil {
@@ -1203,7 +1711,9 @@ func (s *SQLiteStore) GetMessagesByUser(userID string) ([]*model.Message, error)
 		msg.ContentType = model.ContentType(contentType)
 		msg.HasToolCalls = hasToolCallsInt != 0
 		msg.IsNonsense = isNonsenseInt != 0
+		msg.IsDuplicate = isDuplicateInt != 0
 		msg.CreatedAt = time.Unix(createdAt, 0)
+		s.localMessage(msg)
 		messages = append(messages, msg)
 	}
 
@@ -1238,9 +1748,9 @@ func (s *SQLiteStore) AddOpenedFile(openedFile *model.OpenedFile) error {
 		`INSERT OR REPLACE INTO opened_files (
 			file_id, session_id, user_id, file_path, file_name, opened_at, closed_at, is_open
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		openedFile.FileID,
-		openedFile.SessionID,
-		openedFile.UserID,
+		s.id(openedFile.FileID),
+		s.id(openedFile.SessionID),
+		s.id(openedFile.UserID),
 		openedFile.FilePath,
 		openedFile.FileName,
 		openedAt,
@@ -1267,7 +1777,7 @@ func (s *SQLiteStore) CloseOpenedFile(sessionID string, filePath string) error {
 		 SET is_open = 0, closed_at = ? 
 		 WHERE session_id = ? AND file_path = ? AND is_open = 1`,
 		closedAt,
-		sessionID,
+		s.id(sessionID),
 		filePath,
 	)
 
@@ -1286,7 +1796,7 @@ func (s *SQLiteStore) GetOpenedFilesBySession(sessionID string) ([]*model.Opened
 	rows, err := s.db.Query(
 		`SELECT file_id, session_id, user_id, file_path, file_name, opened_at, closed_at, is_open
 		FROM opened_files WHERE session_id = ? ORDER BY opened_at ASC`,
-		sessionID,
+		s.id(sessionID),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query opened files: %w", err)
@@ -1318,6 +1828,7 @@ func (s *SQLiteStore) GetOpenedFilesBySession(sessionID string) ([]*model.Opened
 			f.ClosedAt = time.Unix(closedAt, 0)
 		}
 		f.IsOpen = isOpenInt != 0
+		s.localOpenedFile(f)
 		files = append(files, f)
 	}
 
@@ -1336,7 +1847,7 @@ func (s *SQLiteStore) GetCurrentlyOpenedFilesBySession(sessionID string) ([]*mod
 	rows, err := s.db.Query(
 		`SELECT file_id, session_id, user_id, file_path, file_name, opened_at, closed_at, is_open
 		FROM opened_files WHERE session_id = ? AND is_open = 1 ORDER BY opened_at ASC`,
-		sessionID,
+		s.id(sessionID),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query opened files: %w", err)
@@ -1368,6 +1879,7 @@ func (s *SQLiteStore) GetCurrentlyOpenedFilesBySession(sessionID string) ([]*mod
 			f.ClosedAt = time.Unix(closedAt, 0)
 		}
 		f.IsOpen = isOpenInt != 0
+		s.localOpenedFile(f)
 		files = append(files, f)
 	}
 
@@ -1383,8 +1895,10 @@ func (s *SQLiteStore) GetAllUsers() ([]*model.User, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	where, args := s.scope("", "user_id", nil)
 	rows, err := s.db.Query(
-		"SELECT data, created_at, updated_at FROM users ORDER BY created_at DESC",
+		"SELECT data, created_at, updated_at FROM users"+where+" ORDER BY created_at DESC",
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
@@ -1424,12 +1938,29 @@ func (s *SQLiteStore) GetAllMessages() ([]*model.Message, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	where, args := s.scope("", "user_id", nil)
+	return s.queryMessages(where, args)
+}
+
+// GetMessagesByTimeRange implements debuger.DebugStore
+func (s *SQLiteStore) GetMessagesByTimeRange(from, to time.Time) ([]*model.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	where, args := timeRangeWhere("created_at", from, to)
+	where, args = s.scope(where, "user_id", args)
+	return s.queryMessages(where, args)
+}
+
+// queryMessages runs a messages SELECT with an optional WHERE clause (caller must hold s.mu)
+func (s *SQLiteStore) queryMessages(where string, args []interface{}) ([]*model.Message, error) {
 	rows, err := s.db.Query(
 		`SELECT message_id, seq_id, user_id, session_id, role, content, model,
 			agent_type, content_type,
-			prompt_tokens, completion_tokens, total_tokens,
-			request_model, max_tokens, temperature, has_tool_calls, finish_reason, is_nonsense, created_at
-		FROM messages ORDER BY created_at DESC`,
+			prompt_tokens, completion_tokens, total_tokens, reasoning_tokens,
+			request_model, max_tokens, temperature, has_tool_calls, finish_reason, is_nonsense, is_duplicate, created_at
+		FROM messages`+where+` ORDER BY created_at DESC`,
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
@@ -1441,7 +1972,7 @@ func (s *SQLiteStore) GetAllMessages() ([]*model.Message, error) {
 		msg := &model.Message{}
 		var createdAt int64
 		var hasToolCallsInt int
-		var isNonsenseInt int
+		var isNonsenseInt, isDuplicateInt int
 		var agentType, contentType string
 
 		err := rows.Scan(
@@ -1457,12 +1988,14 @@ func (s *SQLiteStore) GetAllMessages() ([]*model.Message, error) {
 			&msg.PromptTokens,
 			&msg.CompletionTokens,
 			&msg.TotalTokens,
+			&msg.ReasoningTokens,
 			&msg.RequestModel,
 			&msg.MaxTokens,
 			&msg.Temperature,
 			&hasToolCallsInt,
 			&msg.FinishReason,
 			&isNonsenseInt,
+			&isDuplicateInt,
 			&createdAt,
 		)
 		if err != nil {
@@ -1473,7 +2006,9 @@ func (s *SQLiteStore) GetAllMessages() ([]*model.Message, error) {
 		msg.ContentType = model.ContentType(contentType)
 		msg.HasToolCalls = hasToolCallsInt != 0
 		msg.IsNonsense = isNonsenseInt != 0
+		msg.IsDuplicate = isDuplicateInt != 0
 		msg.CreatedAt = time.Unix(createdAt, 0)
+		s.localMessage(msg)
 		messages = append(messages, msg)
 	}
 
@@ -1489,9 +2024,11 @@ func (s *SQLiteStore) GetAllOpenedFiles() ([]*model.OpenedFile, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	where, args := s.scope("", "user_id", nil)
 	rows, err := s.db.Query(
 		`SELECT file_id, session_id, user_id, file_path, file_name, opened_at, closed_at, is_open
-		FROM opened_files ORDER BY opened_at DESC`,
+		FROM opened_files`+where+` ORDER BY opened_at DESC`,
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query opened files: %w", err)
@@ -1523,6 +2060,7 @@ func (s *SQLiteStore) GetAllOpenedFiles() ([]*model.OpenedFile, error) {
 			f.ClosedAt = time.Unix(closedAt, 0)
 		}
 		f.IsOpen = isOpenInt != 0
+		s.localOpenedFile(f)
 		files = append(files, f)
 	}
 
@@ -1557,13 +2095,13 @@ func (s *SQLiteStore) PutToolCall(toolCall *model.ToolCall) error {
 	// Use INSERT OR REPLACE for upsert behavior
 	_, err := s.db.Exec(
 		`INSERT OR REPLACE INTO tool_calls (
-			tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		toolCall.ToolCallID,
-		toolCall.ToolID,
-		toolCall.MessageID,
-		toolCall.SessionID,
-		toolCall.UserID,
+			tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, sources, args_validation, args_validation_detail, mcp_server, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.id(toolCall.ToolCallID),
+		s.id(toolCall.ToolID),
+		s.id(toolCall.MessageID),
+		s.id(toolCall.SessionID),
+		s.id(toolCall.UserID),
 		string(toolCall.AgentType),
 		toolCall.FunctionName,
 		toolCall.Arguments,
@@ -1572,6 +2110,10 @@ func (s *SQLiteStore) PutToolCall(toolCall *model.ToolCall) error {
 		toolCall.DurationMs,
 		status,
 		toolCall.Error,
+		sourcesColumn(toolCall.Sources),
+		toolCall.ArgsValidation,
+		toolCall.ArgsValidationDetail,
+		toolCall.MCPServer,
 		createdAt,
 		updatedAt,
 	)
@@ -1600,6 +2142,8 @@ func (s *SQLiteStore) UpdateToolCallResponse(toolID string, response string, exe
 		errorMsg = execErr.Error()
 	}
 
+	toolID = s.id(toolID)
+
 	// Get created_at to calculate duration (look up by tool_id)
 	var createdAtUnix int64
 	err := s.db.QueryRow(
@@ -1633,22 +2177,64 @@ func (s *SQLiteStore) UpdateToolCallResponse(toolID string, response string, exe
 	return nil
 }
 
-// GetToolCallsBySession returns all tool calls for a session
-func (s *SQLiteStore) GetToolCallsBySession(sessionID string) ([]*model.ToolCall, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// SetToolCallSources stores the citations of a web search tool call
+func (s *SQLiteStore) SetToolCallSources(toolID string, sources []model.Citation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	rows, err := s.db.Query(
-		`SELECT tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, created_at, updated_at
-		FROM tool_calls WHERE session_id = ? ORDER BY created_at DESC`,
-		sessionID,
-	)
+	value, err := sourcesColumn(sources).Value()
 	if err != nil {
-		return nil, fmt.Errorf("failed to query tool calls: %w", err)
+		return err
 	}
-	defer rows.Close()
+	if _, err := s.db.Exec("UPDATE tool_calls SET sources = ? WHERE tool_id = ?", value, s.id(toolID)); err != nil {
+		return fmt.Errorf("failed to store tool call sources: %w", err)
+	}
+	return nil
+}
 
-	var toolCalls []*model.ToolCall
+// SetToolCallArgsValidation stores the outcome of checking a tool call's arguments
+func (s *SQLiteStore) SetToolCallArgsValidation(toolID, outcome, detail string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec("UPDATE tool_calls SET args_validation = ?, args_validation_detail = ? WHERE tool_id = ?",
+		outcome, detail, s.id(toolID)); err != nil {
+		return fmt.Errorf("failed to store tool call argument validation: %w", err)
+	}
+	return nil
+}
+
+// MarkToolCallCacheHit marks a tool call answered from the tool result cache (status "cache_hit")
+func (s *SQLiteStore) MarkToolCallCacheHit(toolID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(
+		"UPDATE tool_calls SET status = ?, updated_at = ? WHERE tool_id = ?",
+		model.ToolCallStatusCacheHit, time.Now().Unix(), s.id(toolID),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark tool call as cache hit: %w", err)
+	}
+	return nil
+}
+
+// GetToolCallsBySession returns all tool calls for a session
+func (s *SQLiteStore) GetToolCallsBySession(sessionID string) ([]*model.ToolCall, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(
+		`SELECT tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, sources, args_validation, args_validation_detail, mcp_server, created_at, updated_at
+		FROM tool_calls WHERE session_id = ? ORDER BY created_at DESC`,
+		s.id(sessionID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tool calls: %w", err)
+	}
+	defer rows.Close()
+
+	var toolCalls []*model.ToolCall
 	for rows.Next() {
 		tc := &model.ToolCall{}
 		var createdAt, updatedAt int64
@@ -1668,6 +2254,10 @@ func (s *SQLiteStore) GetToolCallsBySession(sessionID string) ([]*model.ToolCall
 			&tc.DurationMs,
 			&tc.Status,
 			&tc.Error,
+			(*sourcesColumn)(&tc.Sources),
+			&tc.ArgsValidation,
+			&tc.ArgsValidationDetail,
+			&tc.MCPServer,
 			&createdAt,
 			&updatedAt,
 		)
@@ -1678,6 +2268,7 @@ func (s *SQLiteStore) GetToolCallsBySession(sessionID string) ([]*model.ToolCall
 		tc.AgentType = model.AgentType(agentType)
 		tc.CreatedAt = time.Unix(createdAt, 0)
 		tc.UpdatedAt = time.Unix(updatedAt, 0)
+		s.localToolCall(tc)
 		toolCalls = append(toolCalls, tc)
 	}
 
@@ -1693,9 +2284,43 @@ func (s *SQLiteStore) GetAllToolCalls() ([]*model.ToolCall, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	where, args := s.scope("", "user_id", nil)
+	return s.queryToolCalls(where+" ORDER BY created_at DESC", args)
+}
+
+// GetToolCallsByTimeRange implements debuger.DebugStore
+func (s *SQLiteStore) GetToolCallsByTimeRange(from, to time.Time) ([]*model.ToolCall, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	where, args := timeRangeWhere("created_at", from, to)
+	where, args = s.scope(where, "user_id", args)
+	return s.queryToolCalls(where+" ORDER BY created_at DESC", args)
+}
+
+// GetToolCallsPaginated implements debuger.DebugStore
+func (s *SQLiteStore) GetToolCallsPaginated(offset, limit int) ([]*model.ToolCall, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	where, args := s.scope("", "user_id", nil)
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM tool_calls"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count tool calls: %w", err)
+	}
+	toolCalls, err := s.queryToolCalls(where+" ORDER BY created_at DESC LIMIT ? OFFSET ?", append(args, limit, offset))
+	if err != nil {
+		return nil, 0, err
+	}
+	return toolCalls, total, nil
+}
+
+// queryToolCalls runs a tool_calls SELECT followed by clause (WHERE/ORDER BY/LIMIT; caller must hold s.mu)
+func (s *SQLiteStore) queryToolCalls(clause string, args []interface{}) ([]*model.ToolCall, error) {
 	rows, err := s.db.Query(
-		`SELECT tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, created_at, updated_at
-		FROM tool_calls ORDER BY created_at DESC`,
+		`SELECT tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, sources, args_validation, args_validation_detail, mcp_server, created_at, updated_at
+		FROM tool_calls`+clause,
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query tool calls: %w", err)
@@ -1722,6 +2347,10 @@ func (s *SQLiteStore) GetAllToolCalls() ([]*model.ToolCall, error) {
 			&tc.DurationMs,
 			&tc.Status,
 			&tc.Error,
+			(*sourcesColumn)(&tc.Sources),
+			&tc.ArgsValidation,
+			&tc.ArgsValidationDetail,
+			&tc.MCPServer,
 			&createdAt,
 			&updatedAt,
 		)
@@ -1732,6 +2361,7 @@ func (s *SQLiteStore) GetAllToolCalls() ([]*model.ToolCall, error) {
 		tc.AgentType = model.AgentType(agentType)
 		tc.CreatedAt = time.Unix(createdAt, 0)
 		tc.UpdatedAt = time.Unix(updatedAt, 0)
+		s.localToolCall(tc)
 		toolCalls = append(toolCalls, tc)
 	}
 
@@ -1748,9 +2378,9 @@ func (s *SQLiteStore) GetToolCallByID(toolCallID string) (*model.ToolCall, error
 	defer s.mu.RUnlock()
 
 	row := s.db.QueryRow(
-		`SELECT tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, created_at, updated_at
+		`SELECT tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, sources, args_validation, args_validation_detail, mcp_server, created_at, updated_at
 		FROM tool_calls WHERE tool_call_id = ?`,
-		toolCallID,
+		s.id(toolCallID),
 	)
 
 	tc := &model.ToolCall{}
@@ -1771,6 +2401,10 @@ func (s *SQLiteStore) GetToolCallByID(toolCallID string) (*model.ToolCall, error
 		&tc.DurationMs,
 		&tc.Status,
 		&tc.Error,
+		(*sourcesColumn)(&tc.Sources),
+		&tc.ArgsValidation,
+		&tc.ArgsValidationDetail,
+		&tc.MCPServer,
 		&createdAt,
 		&updatedAt,
 	)
@@ -1781,6 +2415,7 @@ func (s *SQLiteStore) GetToolCallByID(toolCallID string) (*model.ToolCall, error
 	tc.AgentType = model.AgentType(agentType)
 	tc.CreatedAt = time.Unix(createdAt, 0)
 	tc.UpdatedAt = time.Unix(updatedAt, 0)
+	s.localToolCall(tc)
 
 	return tc, nil
 }
@@ -1791,9 +2426,9 @@ func (s *SQLiteStore) GetToolCallByToolID(toolID string) (*model.ToolCall, error
 	defer s.mu.RUnlock()
 
 	row := s.db.QueryRow(
-		`SELECT tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, created_at, updated_at
+		`SELECT tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, sources, args_validation, args_validation_detail, mcp_server, created_at, updated_at
 		FROM tool_calls WHERE tool_id = ?`,
-		toolID,
+		s.id(toolID),
 	)
 
 	tc := &model.ToolCall{}
@@ -1814,6 +2449,10 @@ func (s *SQLiteStore) GetToolCallByToolID(toolID string) (*model.ToolCall, error
 		&tc.DurationMs,
 		&tc.Status,
 		&tc.Error,
+		(*sourcesColumn)(&tc.Sources),
+		&tc.ArgsValidation,
+		&tc.ArgsValidationDetail,
+		&tc.MCPServer,
 		&createdAt,
 		&updatedAt,
 	)
@@ -1824,6 +2463,59 @@ func (s *SQLiteStore) GetToolCallByToolID(toolID string) (*model.ToolCall, error
 	tc.AgentType = model.AgentType(agentType)
 	tc.CreatedAt = time.Unix(createdAt, 0)
 	tc.UpdatedAt = time.Unix(updatedAt, 0)
+	s.localToolCall(tc)
+
+	return tc, nil
+}
+
+// GetToolCall implements debuger.DebugStore
+func (s *SQLiteStore) GetToolCall(toolID string) (*model.ToolCall, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	row := s.db.QueryRow(
+		`SELECT tool_call_id, tool_id, message_id, session_id, user_id, agent_type, function_name, arguments, response, response_length, duration_ms, status, error, sources, args_validation, args_validation_detail, mcp_server, created_at, updated_at
+		FROM tool_calls WHERE tool_id = ? OR tool_call_id = ?
+		ORDER BY tool_id = ? DESC LIMIT 1`,
+		s.id(toolID), s.id(toolID), s.id(toolID),
+	)
+
+	tc := &model.ToolCall{}
+	var createdAt, updatedAt int64
+	var agentType string
+
+	err := row.Scan(
+		&tc.ToolCallID,
+		&tc.ToolID,
+		&tc.MessageID,
+		&tc.SessionID,
+		&tc.UserID,
+		&agentType,
+		&tc.FunctionName,
+		&tc.Arguments,
+		&tc.Response,
+		&tc.ResponseLength,
+		&tc.DurationMs,
+		&tc.Status,
+		&tc.Error,
+		(*sourcesColumn)(&tc.Sources),
+		&tc.ArgsValidation,
+		&tc.ArgsValidationDetail,
+		&tc.MCPServer,
+		&createdAt,
+		&updatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tool call: %w", err)
+	}
+
+	tc.AgentType = model.AgentType(agentType)
+	tc.CreatedAt = time.Unix(createdAt, 0)
+	tc.UpdatedAt = time.Unix(updatedAt, 0)
+	s.localToolCall(tc)
 
 	return tc, nil
 }
@@ -1858,9 +2550,9 @@ func (s *SQLiteStore) PutSummarizationLog(log *model.SummarizationLog) error {
 			prompt_tokens, completion_tokens, total_tokens, duration_ms,
 			status, error_message, summarization_type, created_at, completed_at
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		log.LogID,
-		log.SessionID,
-		log.UserID,
+		s.id(log.LogID),
+		s.id(log.SessionID),
+		s.id(log.UserID),
 		log.SessionTitle,
 		log.PreviousSummary,
 		log.PreviousTags,
@@ -1905,7 +2597,7 @@ func (s *SQLiteStore) GetSummarizationLogsBySession(sessionID string) ([]*model.
 			prompt_tokens, completion_tokens, total_tokens, duration_ms,
 			status, error_message, summarization_type, created_at, completed_at
 		FROM summarization_logs WHERE session_id = ? ORDER BY created_at DESC`,
-		sessionID,
+		s.id(sessionID),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query summarization logs: %w", err)
@@ -1920,6 +2612,7 @@ func (s *SQLiteStore) GetAllSummarizationLogs() ([]*model.SummarizationLog, erro
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	where, args := s.scope("", "user_id", nil)
 	rows, err := s.db.Query(
 		`SELECT log_id, session_id, user_id, session_title, previous_summary, previous_tags,
 			messages_before_count, messages_after_count, archived_messages_count,
@@ -1927,7 +2620,8 @@ func (s *SQLiteStore) GetAllSummarizationLogs() ([]*model.SummarizationLog, erro
 			generated_summary, generated_tags, generated_title,
 			prompt_tokens, completion_tokens, total_tokens, duration_ms,
 			status, error_message, summarization_type, created_at, completed_at
-		FROM summarization_logs ORDER BY created_at DESC`,
+		FROM summarization_logs`+where+` ORDER BY created_at DESC`,
+		args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query summarization logs: %w", err)
@@ -1937,6 +2631,604 @@ func (s *SQLiteStore) GetAllSummarizationLogs() ([]*model.SummarizationLog, erro
 	return s.scanSummarizationLogs(rows)
 }
 
+// GetSummarizationLogsPaginated implements debuger.DebugStore
+func (s *SQLiteStore) GetSummarizationLogsPaginated(offset, limit int) ([]*model.SummarizationLog, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	where, args := s.scope("", "user_id", nil)
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM summarization_logs"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count summarization logs: %w", err)
+	}
+
+	rows, err := s.db.Query(
+		`SELECT log_id, session_id, user_id, session_title, previous_summary, previous_tags,
+			messages_before_count, messages_after_count, archived_messages_count,
+			prompt_sent, response_received, model_used, requested_model,
+			generated_summary, generated_tags, generated_title,
+			prompt_tokens, completion_tokens, total_tokens, duration_ms,
+			status, error_message, summarization_type, created_at, completed_at
+		FROM summarization_logs`+where+` ORDER BY created_at DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query summarization logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs, err := s.scanSummarizationLogs(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// CountSummarizationLogsByStatus returns the number of summarization logs per status
+func (s *SQLiteStore) CountSummarizationLogsByStatus() (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	where, args := s.scope("", "user_id", nil)
+	rows, err := s.db.Query("SELECT status, COUNT(*) FROM summarization_logs"+where+" GROUP BY status", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count summarization logs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status sql.NullString
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan summarization log count: %w", err)
+		}
+		counts[status.String] += count
+	}
+	return counts, rows.Err()
+}
+
+// PutModerationEvent implements model.ModerationEventStore
+func (s *SQLiteStore) PutModerationEvent(event *model.ModerationEvent) error {
+	if event == nil {
+		return fmt.Errorf("event cannot be nil")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messageID := ""
+	if event.MessageID != "" {
+		messageID = s.id(event.MessageID)
+	}
+	_, err := s.db.Exec(
+		`INSERT OR REPLACE INTO moderation_events
+			(event_id, user_id, event_type, actor, message_id, reason, duration_ms, nonsense_count, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.id(event.EventID), s.id(event.UserID), string(event.Type), event.Actor, messageID, event.Reason,
+		event.Duration.Milliseconds(), event.NonsenseCount, event.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store moderation event: %w", err)
+	}
+	return nil
+}
+
+// GetModerationEventsByUser implements model.ModerationEventStore
+func (s *SQLiteStore) GetModerationEventsByUser(userID string) ([]*model.ModerationEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(
+		`SELECT event_id, user_id, event_type, actor, message_id, reason, duration_ms, nonsense_count, created_at
+		FROM moderation_events WHERE user_id = ? ORDER BY created_at DESC`,
+		s.id(userID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query moderation events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*model.ModerationEvent
+	for rows.Next() {
+		event := &model.ModerationEvent{}
+		var eventType string
+		var durationMs, createdAt int64
+		if err := rows.Scan(&event.EventID, &event.UserID, &eventType, &event.Actor, &event.MessageID,
+			&event.Reason, &durationMs, &event.NonsenseCount, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan moderation event: %w", err)
+		}
+		event.EventID = s.local(event.EventID)
+		event.UserID = s.local(event.UserID)
+		if event.MessageID != "" {
+			event.MessageID = s.local(event.MessageID)
+		}
+		event.Type = model.ModerationEventType(eventType)
+		event.Duration = time.Duration(durationMs) * time.Millisecond
+		event.CreatedAt = time.Unix(0, createdAt)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// PutUsageRecord implements model.UsageStore
+func (s *SQLiteStore) PutUsageRecord(record *model.UsageRecord) error {
+	if record == nil {
+		return fmt.Errorf("record cannot be nil")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessionID := ""
+	if record.SessionID != "" {
+		sessionID = s.id(record.SessionID)
+	}
+	_, err := s.db.Exec(
+		`INSERT OR REPLACE INTO usage_records
+			(record_id, user_id, session_id, model, prompt_tokens, completion_tokens, cost_usd, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.id(record.RecordID), s.id(record.UserID), sessionID, record.Model,
+		record.PromptTokens, record.CompletionTokens, record.CostUSD, record.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store usage record: %w", err)
+	}
+	return nil
+}
+
+// GetUsageSummary implements model.UsageStore
+func (s *SQLiteStore) GetUsageSummary(userID string, from, to time.Time) (*model.UsageSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	where, args := timeRangeWhere("created_at", from, to)
+	if userID != "" {
+		if where == "" {
+			where = " WHERE user_id = ?"
+		} else {
+			where += " AND user_id = ?"
+		}
+		args = append(args, s.id(userID))
+	} else {
+		where, args = s.scope(where, "user_id", args)
+	}
+
+	rows, err := s.db.Query(
+		`SELECT model, COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost_usd), 0)
+		FROM usage_records`+where+` GROUP BY model`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage records: %w", err)
+	}
+	defer rows.Close()
+
+	summary := &model.UsageSummary{UserID: userID, From: from, To: to, ByModel: make(map[string]*model.ModelUsage)}
+	for rows.Next() {
+		var modelName string
+		var usage model.ModelUsage
+		if err := rows.Scan(&modelName, &usage.Calls, &usage.PromptTokens, &usage.CompletionTokens, &usage.CostUSD); err != nil {
+			return nil, fmt.Errorf("failed to scan usage summary: %w", err)
+		}
+		summary.Add(modelName, usage)
+	}
+	return summary, rows.Err()
+}
+
+// PutMemory implements model.MemoryStore
+func (s *SQLiteStore) PutMemory(memory *model.MemoryRecord) error {
+	if memory == nil {
+		return fmt.Errorf("memory cannot be nil")
+	}
+
+	embedding, err := json.Marshal(memory.Embedding)
+	if err != nil {
+		return fmt.Errorf("failed to marshal memory embedding: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessionID := ""
+	if memory.SessionID != "" {
+		sessionID = s.id(memory.SessionID)
+	}
+	_, err = s.db.Exec(
+		`INSERT OR REPLACE INTO memories (memory_id, user_id, memory_key, text, confidence, session_id, embedding, created_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.id(memory.MemoryID), s.id(memory.UserID), memory.Key, memory.Text, memory.Confidence, sessionID,
+		string(embedding), memory.CreatedAt.UnixNano(), memory.LastUsedAt.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store memory: %w", err)
+	}
+	return nil
+}
+
+// GetMemoriesByUser implements model.MemoryStore
+func (s *SQLiteStore) GetMemoriesByUser(userID string) ([]*model.MemoryRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(
+		`SELECT memory_id, user_id, memory_key, text, confidence, session_id, embedding, created_at, last_used_at
+		FROM memories WHERE user_id = ? ORDER BY created_at ASC`,
+		s.id(userID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query memories: %w", err)
+	}
+	defer rows.Close()
+
+	var memories []*model.MemoryRecord
+	for rows.Next() {
+		memory := &model.MemoryRecord{}
+		var embedding string
+		var createdAt, lastUsedAt int64
+		if err := rows.Scan(&memory.MemoryID, &memory.UserID, &memory.Key, &memory.Text, &memory.Confidence,
+			&memory.SessionID, &embedding, &createdAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan memory: %w", err)
+		}
+		if err := json.Unmarshal([]byte(embedding), &memory.Embedding); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal memory embedding: %w", err)
+		}
+		memory.MemoryID = s.local(memory.MemoryID)
+		memory.UserID = s.local(memory.UserID)
+		if memory.SessionID != "" {
+			memory.SessionID = s.local(memory.SessionID)
+		}
+		memory.CreatedAt = time.Unix(0, createdAt)
+		memory.LastUsedAt = time.Unix(0, lastUsedAt)
+		memories = append(memories, memory)
+	}
+	return memories, rows.Err()
+}
+
+// DeleteMemories implements model.MemoryStore
+func (s *SQLiteStore) DeleteMemories(userID string, memoryIDs ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := `DELETE FROM memories WHERE user_id = ?`
+	args := []interface{}{s.id(userID)}
+	if len(memoryIDs) > 0 {
+		query += ` AND memory_id IN (?` + strings.Repeat(", ?", len(memoryIDs)-1) + `)`
+		for _, id := range memoryIDs {
+			args = append(args, s.id(id))
+		}
+	}
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete memories: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+	return int(deleted), nil
+}
+
+// TouchMemories implements model.MemoryStore
+func (s *SQLiteStore) TouchMemories(userID string, memoryIDs []string, at time.Time) error {
+	if len(memoryIDs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	args := []interface{}{at.UnixNano(), s.id(userID)}
+	for _, id := range memoryIDs {
+		args = append(args, s.id(id))
+	}
+	_, err := s.db.Exec(
+		`UPDATE memories SET last_used_at = ? WHERE user_id = ? AND memory_id IN (?`+strings.Repeat(", ?", len(memoryIDs)-1)+`)`,
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update memories: %w", err)
+	}
+	return nil
+}
+
+// GetKnowledgeChunks implements model.KnowledgeIndexStore
+func (s *SQLiteStore) GetKnowledgeChunks() ([]*model.KnowledgeChunk, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	where, args := s.scope("", "chunk_id", nil)
+	rows, err := s.db.Query(
+		`SELECT chunk_id, node_path, title, text, hash, embedding, indexed_at FROM knowledge_chunks`+where+` ORDER BY chunk_id ASC`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query knowledge chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []*model.KnowledgeChunk
+	for rows.Next() {
+		chunk := &model.KnowledgeChunk{}
+		var embedding string
+		var indexedAt int64
+		if err := rows.Scan(&chunk.ChunkID, &chunk.NodePath, &chunk.Title, &chunk.Text, &chunk.Hash, &embedding, &indexedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan knowledge chunk: %w", err)
+		}
+		if err := json.Unmarshal([]byte(embedding), &chunk.Embedding); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal knowledge chunk embedding: %w", err)
+		}
+		chunk.ChunkID = s.local(chunk.ChunkID)
+		chunk.IndexedAt = time.Unix(indexedAt, 0)
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+// ReplaceKnowledgeChunks implements model.KnowledgeIndexStore in one transaction
+func (s *SQLiteStore) ReplaceKnowledgeChunks(chunks []*model.KnowledgeChunk) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, args := s.scope("", "chunk_id", nil)
+	if _, err := tx.Exec(`DELETE FROM knowledge_chunks`+where, args...); err != nil {
+		return fmt.Errorf("failed to delete knowledge chunks: %w", err)
+	}
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO knowledge_chunks (chunk_id, node_path, title, text, hash, embedding, indexed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare knowledge chunk insert: %w", err)
+	}
+	defer stmt.Close()
+	for _, chunk := range chunks {
+		embedding, err := json.Marshal(chunk.Embedding)
+		if err != nil {
+			return fmt.Errorf("failed to marshal knowledge chunk embedding: %w", err)
+		}
+		if _, err := stmt.Exec(s.id(chunk.ChunkID), chunk.NodePath, chunk.Title, chunk.Text, chunk.Hash,
+			string(embedding), chunk.IndexedAt.Unix()); err != nil {
+			return fmt.Errorf("failed to store knowledge chunk: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// PutFeedback implements model.FeedbackStore
+func (s *SQLiteStore) PutFeedback(feedback *model.Feedback) error {
+	if feedback == nil {
+		return fmt.Errorf("feedback cannot be nil")
+	}
+	if err := feedback.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessionID := ""
+	if feedback.SessionID != "" {
+		sessionID = s.id(feedback.SessionID)
+	}
+	_, err := s.db.Exec(
+		`INSERT OR REPLACE INTO feedback (feedback_id, message_id, session_id, user_id, rating, comment, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		s.id(feedback.FeedbackID), s.id(feedback.MessageID), sessionID, s.id(feedback.UserID),
+		feedback.Rating, feedback.Comment, feedback.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store feedback: %w", err)
+	}
+	return nil
+}
+
+// GetFeedbackByMessage implements model.FeedbackStore
+func (s *SQLiteStore) GetFeedbackByMessage(messageID string) ([]*model.Feedback, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(
+		`SELECT feedback_id, message_id, session_id, user_id, rating, comment, created_at
+		FROM feedback WHERE message_id = ? ORDER BY created_at DESC, rowid DESC`,
+		s.id(messageID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feedback: %w", err)
+	}
+	defer rows.Close()
+
+	var feedbacks []*model.Feedback
+	for rows.Next() {
+		feedback := &model.Feedback{}
+		var createdAt int64
+		if err := rows.Scan(&feedback.FeedbackID, &feedback.MessageID, &feedback.SessionID, &feedback.UserID,
+			&feedback.Rating, &feedback.Comment, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feedback: %w", err)
+		}
+		feedback.FeedbackID = s.local(feedback.FeedbackID)
+		feedback.MessageID = s.local(feedback.MessageID)
+		if feedback.SessionID != "" {
+			feedback.SessionID = s.local(feedback.SessionID)
+		}
+		feedback.UserID = s.local(feedback.UserID)
+		feedback.CreatedAt = time.Unix(createdAt, 0)
+		feedbacks = append(feedbacks, feedback)
+	}
+	return feedbacks, rows.Err()
+}
+
+// GetFeedbackStats implements model.FeedbackStore
+func (s *SQLiteStore) GetFeedbackStats(filter model.FeedbackFilter) (*model.FeedbackStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	where, args := timeRangeWhere("created_at", filter.From, filter.To)
+	for _, cond := range []struct{ column, value string }{
+		{"user_id", filter.UserID},
+		{"session_id", filter.SessionID},
+		{"message_id", filter.MessageID},
+	} {
+		if cond.value == "" {
+			continue
+		}
+		if where == "" {
+			where = " WHERE " + cond.column + " = ?"
+		} else {
+			where += " AND " + cond.column + " = ?"
+		}
+		args = append(args, s.id(cond.value))
+	}
+	where, args = s.scope(where, "user_id", args)
+
+	stats := &model.FeedbackStats{}
+	err := s.db.QueryRow(
+		`SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN rating < 0 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN comment != '' THEN 1 ELSE 0 END), 0)
+		FROM feedback`+where,
+		args...,
+	).Scan(&stats.Total, &stats.Up, &stats.Down, &stats.Comments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feedback stats: %w", err)
+	}
+	return stats, nil
+}
+
+// GetFeedbackStatsByMessages implements model.FeedbackStore
+func (s *SQLiteStore) GetFeedbackStatsByMessages(messageIDs []string) (map[string]*model.FeedbackStats, error) {
+	byMessage := make(map[string]*model.FeedbackStats)
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = s.id(id)
+	}
+	where, args := s.scope(` WHERE message_id IN (?`+strings.Repeat(", ?", len(messageIDs)-1)+`)`, "user_id", args)
+	rows, err := s.db.Query(
+		`SELECT message_id, COUNT(*),
+			COALESCE(SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN rating < 0 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN comment != '' THEN 1 ELSE 0 END), 0)
+		FROM feedback`+where+` GROUP BY message_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feedback stats: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		stats := &model.FeedbackStats{}
+		if err := rows.Scan(&messageID, &stats.Total, &stats.Up, &stats.Down, &stats.Comments); err != nil {
+			return nil, fmt.Errorf("failed to scan feedback stats: %w", err)
+		}
+		byMessage[s.local(messageID)] = stats
+	}
+	return byMessage, rows.Err()
+}
+
+// GetSessionStats returns aggregate statistics for a session using GROUP BY/COUNT queries
+func (s *SQLiteStore) GetSessionStats(sessionID string) (*model.SessionStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id := s.id(sessionID)
+	stats := &model.SessionStats{SessionID: sessionID, MessagesByRole: make(map[string]int)}
+
+	rows, err := s.db.Query(
+		`SELECT role, COUNT(*), COALESCE(SUM(total_tokens), 0), MIN(created_at), MAX(created_at)
+		FROM messages WHERE session_id = ? GROUP BY role`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate messages: %w", err)
+	}
+	defer rows.Close()
+
+	var first, last int64
+	for rows.Next() {
+		var role string
+		var count, tokens int
+		var minCreatedAt, maxCreatedAt int64
+		if err := rows.Scan(&role, &count, &tokens, &minCreatedAt, &maxCreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message stats: %w", err)
+		}
+		stats.MessagesByRole[role] = count
+		stats.TotalMessages += count
+		stats.TotalTokens += tokens
+		if first == 0 || minCreatedAt < first {
+			first = minCreatedAt
+		}
+		if maxCreatedAt > last {
+			last = maxCreatedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating message stats: %w", err)
+	}
+	if stats.TotalMessages > 0 {
+		stats.FirstMessageAt = time.Unix(first, 0)
+		stats.LastMessageAt = time.Unix(last, 0)
+	}
+
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM tool_calls WHERE session_id = ?", id).Scan(&stats.ToolCalls); err != nil {
+		return nil, fmt.Errorf("failed to count tool calls: %w", err)
+	}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM summarization_logs WHERE session_id = ?", id).Scan(&stats.Summarizations); err != nil {
+		return nil, fmt.Errorf("failed to count summarization logs: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetUserStats returns aggregate statistics for a user using COUNT/SUM/MAX queries
+func (s *SQLiteStore) GetUserStats(userID string) (*model.UserStats, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	stats := &model.UserStats{UserID: userID}
+	if user != nil && user.IsCurrentlyBanned() {
+		stats.IsBanned = true
+		stats.BanUntil = user.BanUntil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id := s.id(userID)
+
+	var sessionsUpdatedAt, lastMessageAt int64
+	if err := s.db.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(archived), 0), COALESCE(MAX(updated_at), 0) FROM sessions WHERE user_id = ?", id,
+	).Scan(&stats.Sessions, &stats.ArchivedSessions, &sessionsUpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to aggregate sessions: %w", err)
+	}
+	if err := s.db.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(total_tokens), 0), COALESCE(MAX(created_at), 0) FROM messages WHERE user_id = ?", id,
+	).Scan(&stats.TotalMessages, &stats.TotalTokens, &lastMessageAt); err != nil {
+		return nil, fmt.Errorf("failed to aggregate messages: %w", err)
+	}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM tool_calls WHERE user_id = ?", id).Scan(&stats.ToolCalls); err != nil {
+		return nil, fmt.Errorf("failed to count tool calls: %w", err)
+	}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM opened_files WHERE user_id = ?", id).Scan(&stats.OpenedFiles); err != nil {
+		return nil, fmt.Errorf("failed to count opened files: %w", err)
+	}
+
+	if last := max(sessionsUpdatedAt, lastMessageAt); last > 0 {
+		stats.LastActiveAt = time.Unix(last, 0)
+	}
+	return stats, nil
+}
+
 // scanSummarizationLogs scans rows into SummarizationLog objects
 func (s *SQLiteStore) scanSummarizationLogs(rows *sql.Rows) ([]*model.SummarizationLog, error) {
 	var logs []*model.SummarizationLog
@@ -2008,6 +3300,7 @@ func (s *SQLiteStore) scanSummarizationLogs(rows *sql.Rows) ([]*model.Summarizat
 			log.SummarizationType = summarizationType.String
 		}
 
+		s.localSummarizationLog(log)
 		logs = append(logs, log)
 	}
 
@@ -2018,6 +3311,36 @@ func (s *SQLiteStore) scanSummarizationLogs(rows *sql.Rows) ([]*model.Summarizat
 	return logs, nil
 }
 
+// localMessage strips the store namespace from the IDs of a message read from the database
+func (s *SQLiteStore) localMessage(msg *model.Message) {
+	msg.MessageID = s.local(msg.MessageID)
+	msg.UserID = s.local(msg.UserID)
+	msg.SessionID = s.local(msg.SessionID)
+}
+
+// localOpenedFile strips the store namespace from the IDs of an opened file read from the database
+func (s *SQLiteStore) localOpenedFile(f *model.OpenedFile) {
+	f.FileID = s.local(f.FileID)
+	f.SessionID = s.local(f.SessionID)
+	f.UserID = s.local(f.UserID)
+}
+
+// localToolCall strips the store namespace from the IDs of a tool call read from the database
+func (s *SQLiteStore) localToolCall(tc *model.ToolCall) {
+	tc.ToolCallID = s.local(tc.ToolCallID)
+	tc.ToolID = s.local(tc.ToolID)
+	tc.MessageID = s.local(tc.MessageID)
+	tc.SessionID = s.local(tc.SessionID)
+	tc.UserID = s.local(tc.UserID)
+}
+
+// localSummarizationLog strips the store namespace from the IDs of a summarization log read from the database
+func (s *SQLiteStore) localSummarizationLog(log *model.SummarizationLog) {
+	log.LogID = s.local(log.LogID)
+	log.SessionID = s.local(log.SessionID)
+	log.UserID = s.local(log.UserID)
+}
+
 // Ensure SQLiteStore implements model.SessionStore
 var _ model.SessionStore = (*SQLiteStore)(nil)
 
@@ -3,6 +3,7 @@ package store
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ghiac/agentize/model"
 )
@@ -291,3 +292,75 @@ func TestSQLiteStore_PutCoreSession_WithExistingSessionID(t *testing.T) {
 		t.Errorf("Expected 1 session, got %d", len(allSessions))
 	}
 }
+
+func TestSQLiteStore_ArchivedCoreSession(t *testing.T) {
+	tmpFile := "/tmp/agentize_test_core_archived.db"
+	defer os.Remove(tmpFile)
+
+	store, err := NewSQLiteStore(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	userID := "user123"
+	old := model.NewSessionWithType(userID, model.AgentTypeCore)
+	old.SessionID = userID + "-core-s0001"
+	old.Archived = true
+	if err := store.Put(old); err != nil {
+		t.Fatalf("Failed to put archived core session: %v", err)
+	}
+
+	coreSession, err := store.GetCoreSession(userID)
+	if err != nil || coreSession != nil {
+		t.Fatalf("GetCoreSession = %v, %v; archived core sessions must not be returned", coreSession, err)
+	}
+
+	current := model.NewSessionWithType(userID, model.AgentTypeCore)
+	current.SessionID = userID + "-core-s0002"
+	if err := store.Put(current); err != nil {
+		t.Fatalf("Failed to put new core session: %v", err)
+	}
+
+	coreSession, err = store.GetCoreSession(userID)
+	if err != nil || coreSession == nil || coreSession.SessionID != current.SessionID {
+		t.Fatalf("GetCoreSession = %v, %v; want %s", coreSession, err, current.SessionID)
+	}
+	if archived, err := store.Get(old.SessionID); err != nil || !archived.Archived {
+		t.Errorf("archived core session was not kept: %v, %v", archived, err)
+	}
+}
+
+func TestSQLiteStore_ActiveSessionSkipsArchived(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	// A user from before ActiveSessionIDs existed: they are computed from the sessions
+	userID := "user123"
+	if err := store.PutUser(model.NewUser(userID)); err != nil {
+		t.Fatalf("Failed to put user: %v", err)
+	}
+	older := model.NewSessionWithID(userID, userID+"-high-s0001", model.AgentTypeHigh)
+	newer := model.NewSessionWithID(userID, userID+"-high-s0002", model.AgentTypeHigh)
+	newer.Archived = true
+	for _, s := range []*model.Session{older, newer} {
+		if err := store.Put(s); err != nil {
+			t.Fatalf("Failed to put session: %v", err)
+		}
+	}
+	// The archived session is the most recently updated one
+	if _, err := store.db.Exec("UPDATE sessions SET updated_at = ? WHERE session_id = ?", time.Now().Add(time.Hour).Unix(), newer.SessionID); err != nil {
+		t.Fatalf("Failed to update session: %v", err)
+	}
+
+	user, err := store.GetOrCreateUser(userID)
+	if err != nil {
+		t.Fatalf("GetOrCreateUser failed: %v", err)
+	}
+	if active := user.GetActiveSessionID(model.AgentTypeHigh); active != older.SessionID {
+		t.Errorf("Expected the unarchived session %s to be active, got %q", older.SessionID, active)
+	}
+}
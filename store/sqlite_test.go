@@ -1,7 +1,11 @@
 package store
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"os"
+	"sort"
 	"testing"
 	"time"
 
@@ -239,3 +243,885 @@ func TestSQLiteStore_MultipleUsers(t *testing.T) {
 		t.Errorf("Expected 1 session for user2, got %d", len(sessions))
 	}
 }
+
+func TestSQLiteStore_GetToolCall(t *testing.T) {
+	tmpFile := "/tmp/agentize_test_get_tool_call.db"
+	defer os.Remove(tmpFile)
+
+	store, err := NewSQLiteStore(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	tc := &model.ToolCall{
+		ToolCallID:   "call_abc123",
+		ToolID:       "user123-core-s0001-t0001",
+		MessageID:    "msg-1",
+		SessionID:    "user123-core-s0001",
+		UserID:       "user123",
+		FunctionName: "search",
+		Arguments:    `{"query":"hello"}`,
+		Status:       "pending",
+	}
+	if err := store.PutToolCall(tc); err != nil {
+		t.Fatalf("Failed to put tool call: %v", err)
+	}
+
+	for _, id := range []string{tc.ToolID, tc.ToolCallID} {
+		got, err := store.GetToolCall(id)
+		if err != nil {
+			t.Fatalf("GetToolCall(%s) failed: %v", id, err)
+		}
+		if got == nil || got.ToolID != tc.ToolID || got.FunctionName != "search" {
+			t.Errorf("GetToolCall(%s) = %+v, want tool call %s", id, got, tc.ToolID)
+		}
+	}
+
+	missing, err := store.GetToolCall("does-not-exist")
+	if err != nil || missing != nil {
+		t.Errorf("Expected (nil, nil) for missing tool call, got (%v, %v)", missing, err)
+	}
+}
+
+func TestSQLiteStore_TimeRangeQueries(t *testing.T) {
+	tmpFile := "/tmp/agentize_test_time_range.db"
+	defer os.Remove(tmpFile)
+
+	store, err := NewSQLiteStore(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	for i, age := range []time.Duration{10 * time.Minute, 2 * time.Hour, 48 * time.Hour} {
+		created := now.Add(-age)
+		if err := store.PutMessage(&model.Message{
+			MessageID: fmt.Sprintf("msg-%d", i),
+			UserID:    "user123",
+			SessionID: "user123-core-s0001",
+			Role:      "user",
+			CreatedAt: created,
+		}); err != nil {
+			t.Fatalf("Failed to put message: %v", err)
+		}
+		if err := store.PutToolCall(&model.ToolCall{
+			ToolCallID: fmt.Sprintf("call-%d", i),
+			ToolID:     fmt.Sprintf("user123-core-s0001-t%04d", i),
+			SessionID:  "user123-core-s0001",
+			UserID:     "user123",
+			CreatedAt:  created,
+			UpdatedAt:  created,
+		}); err != nil {
+			t.Fatalf("Failed to put tool call: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int
+	}{
+		{"all time", time.Time{}, time.Time{}, 3},
+		{"last hour", now.Add(-time.Hour), time.Time{}, 1},
+		{"last day", now.Add(-24 * time.Hour), time.Time{}, 2},
+		{"older than a day", time.Time{}, now.Add(-24 * time.Hour), 1},
+		{"between", now.Add(-3 * time.Hour), now.Add(-time.Hour), 1},
+	}
+	for _, tt := range tests {
+		messages, err := store.GetMessagesByTimeRange(tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("%s: GetMessagesByTimeRange failed: %v", tt.name, err)
+		}
+		if len(messages) != tt.want {
+			t.Errorf("%s: expected %d messages, got %d", tt.name, tt.want, len(messages))
+		}
+		toolCalls, err := store.GetToolCallsByTimeRange(tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("%s: GetToolCallsByTimeRange failed: %v", tt.name, err)
+		}
+		if len(toolCalls) != tt.want {
+			t.Errorf("%s: expected %d tool calls, got %d", tt.name, tt.want, len(toolCalls))
+		}
+	}
+
+	// Sessions are matched on last activity; Put stamps UpdatedAt with the current time
+	if err := store.Put(model.NewSessionWithID("user123", "user123-user-s0001", model.AgentTypeUser)); err != nil {
+		t.Fatalf("Failed to put session: %v", err)
+	}
+	recent, err := store.GetSessionsByTimeRange(now.Add(-time.Hour), time.Time{})
+	if err != nil {
+		t.Fatalf("GetSessionsByTimeRange failed: %v", err)
+	}
+	if len(recent["user123"]) != 1 {
+		t.Errorf("Expected 1 recent session, got %d", len(recent["user123"]))
+	}
+	old, err := store.GetSessionsByTimeRange(time.Time{}, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetSessionsByTimeRange failed: %v", err)
+	}
+	if len(old) != 0 {
+		t.Errorf("Expected no sessions active over an hour ago, got %v", old)
+	}
+}
+
+func TestSQLiteStore_Paginated(t *testing.T) {
+	tmpFile := "/tmp/agentize_test_paginated.db"
+	defer os.Remove(tmpFile)
+
+	store, err := NewSQLiteStore(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	statuses := []string{"success", "success", "failed", "pending", "success"}
+	for i, status := range statuses {
+		created := now.Add(-time.Duration(i) * time.Minute)
+		if err := store.PutToolCall(&model.ToolCall{
+			ToolCallID: fmt.Sprintf("call-%d", i),
+			ToolID:     fmt.Sprintf("user123-core-s0001-t%04d", i),
+			SessionID:  "user123-core-s0001",
+			UserID:     "user123",
+			CreatedAt:  created,
+			UpdatedAt:  created,
+		}); err != nil {
+			t.Fatalf("Failed to put tool call: %v", err)
+		}
+		if err := store.PutSummarizationLog(&model.SummarizationLog{
+			LogID:     fmt.Sprintf("log-%d", i),
+			SessionID: "user123-core-s0001",
+			UserID:    "user123",
+			Status:    status,
+			CreatedAt: created,
+		}); err != nil {
+			t.Fatalf("Failed to put summarization log: %v", err)
+		}
+	}
+
+	toolCalls, total, err := store.GetToolCallsPaginated(2, 2)
+	if err != nil {
+		t.Fatalf("GetToolCallsPaginated failed: %v", err)
+	}
+	if total != 5 || len(toolCalls) != 2 || toolCalls[0].ToolCallID != "call-2" || toolCalls[1].ToolCallID != "call-3" {
+		t.Errorf("GetToolCallsPaginated(2, 2) = %d calls (total %d), want call-2, call-3 of 5", len(toolCalls), total)
+	}
+
+	logs, total, err := store.GetSummarizationLogsPaginated(4, 2)
+	if err != nil {
+		t.Fatalf("GetSummarizationLogsPaginated failed: %v", err)
+	}
+	if total != 5 || len(logs) != 1 || logs[0].LogID != "log-4" {
+		t.Errorf("GetSummarizationLogsPaginated(4, 2) = %d logs (total %d), want log-4 of 5", len(logs), total)
+	}
+
+	counts, err := store.CountSummarizationLogsByStatus()
+	if err != nil {
+		t.Fatalf("CountSummarizationLogsByStatus failed: %v", err)
+	}
+	if counts["success"] != 3 || counts["failed"] != 1 || counts["pending"] != 1 {
+		t.Errorf("CountSummarizationLogsByStatus() = %v", counts)
+	}
+}
+
+func TestSQLiteStore_GetSessionStats(t *testing.T) {
+	tmpFile := "/tmp/agentize_test_session_stats.db"
+	defer os.Remove(tmpFile)
+
+	store, err := NewSQLiteStore(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	sessionID := "user123-core-s0001"
+	start := time.Unix(time.Now().Unix(), 0)
+	roles := []string{"system", "user", "assistant", "user", "assistant"}
+	for i, role := range roles {
+		if err := store.PutMessage(&model.Message{
+			MessageID:   fmt.Sprintf("msg-%d", i),
+			SeqID:       i + 1,
+			SessionID:   sessionID,
+			UserID:      "user123",
+			Role:        role,
+			TotalTokens: 10 * i,
+			CreatedAt:   start.Add(time.Duration(i) * time.Minute),
+		}); err != nil {
+			t.Fatalf("Failed to put message: %v", err)
+		}
+	}
+	// A message in another session is not counted
+	if err := store.PutMessage(&model.Message{MessageID: "other", SessionID: "user123-core-s0002", UserID: "user123", Role: "user", TotalTokens: 100, CreatedAt: start}); err != nil {
+		t.Fatalf("Failed to put message: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := store.PutToolCall(&model.ToolCall{ToolCallID: fmt.Sprintf("call-%d", i), SessionID: sessionID, UserID: "user123", CreatedAt: start}); err != nil {
+			t.Fatalf("Failed to put tool call: %v", err)
+		}
+	}
+	if err := store.PutSummarizationLog(&model.SummarizationLog{LogID: "log-0", SessionID: sessionID, UserID: "user123", CreatedAt: start}); err != nil {
+		t.Fatalf("Failed to put summarization log: %v", err)
+	}
+
+	stats, err := store.GetSessionStats(sessionID)
+	if err != nil {
+		t.Fatalf("GetSessionStats failed: %v", err)
+	}
+	if stats.TotalMessages != 5 || stats.MessagesByRole["user"] != 2 || stats.MessagesByRole["assistant"] != 2 || stats.MessagesByRole["system"] != 1 {
+		t.Errorf("Unexpected message counts: total %d, by role %v", stats.TotalMessages, stats.MessagesByRole)
+	}
+	if stats.TotalTokens != 100 {
+		t.Errorf("TotalTokens = %d, want 100", stats.TotalTokens)
+	}
+	if !stats.FirstMessageAt.Equal(start) || !stats.LastMessageAt.Equal(start.Add(4*time.Minute)) {
+		t.Errorf("Message span = %v - %v, want %v - %v", stats.FirstMessageAt, stats.LastMessageAt, start, start.Add(4*time.Minute))
+	}
+	if stats.ToolCalls != 3 || stats.Summarizations != 1 {
+		t.Errorf("ToolCalls = %d, Summarizations = %d, want 3 and 1", stats.ToolCalls, stats.Summarizations)
+	}
+
+	// Sessions without data return zero stats
+	empty, err := store.GetSessionStats("user123-core-s0009")
+	if err != nil {
+		t.Fatalf("GetSessionStats failed: %v", err)
+	}
+	if empty.TotalMessages != 0 || !empty.FirstMessageAt.IsZero() || empty.ToolCalls != 0 {
+		t.Errorf("Expected empty stats, got %+v", empty)
+	}
+}
+
+func TestSQLiteStore_GetUserStats(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	user := model.NewUser("user123")
+	user.Ban(time.Hour, "spam")
+	if err := store.PutUser(user); err != nil {
+		t.Fatalf("Failed to put user: %v", err)
+	}
+	archived := model.NewSessionWithID("user123", "user123-high-s0001", model.AgentTypeHigh)
+	archived.Archived = true
+	for _, session := range []*model.Session{archived, model.NewSessionWithID("user123", "user123-high-s0002", model.AgentTypeHigh)} {
+		if err := store.Put(session); err != nil {
+			t.Fatalf("Failed to put session: %v", err)
+		}
+	}
+	last := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	for i, userID := range []string{"user123", "user123", "user456"} {
+		if err := store.PutMessage(&model.Message{MessageID: fmt.Sprintf("msg-%d", i), SessionID: userID + "-high-s0002", UserID: userID, Role: "user", TotalTokens: 10, CreatedAt: last}); err != nil {
+			t.Fatalf("Failed to put message: %v", err)
+		}
+	}
+	if err := store.PutToolCall(&model.ToolCall{ToolID: "tool-0", ToolCallID: "call-0", SessionID: "user123-high-s0002", UserID: "user123", CreatedAt: last}); err != nil {
+		t.Fatalf("Failed to put tool call: %v", err)
+	}
+	if err := store.AddOpenedFile(&model.OpenedFile{FileID: "file-0", SessionID: "user123-high-s0002", UserID: "user123", FilePath: "root", OpenedAt: last}); err != nil {
+		t.Fatalf("Failed to add opened file: %v", err)
+	}
+
+	stats, err := store.GetUserStats("user123")
+	if err != nil {
+		t.Fatalf("GetUserStats failed: %v", err)
+	}
+	if stats.Sessions != 2 || stats.ArchivedSessions != 1 || stats.TotalMessages != 2 || stats.TotalTokens != 20 || stats.ToolCalls != 1 || stats.OpenedFiles != 1 {
+		t.Errorf("Unexpected counts: %+v", stats)
+	}
+	if !stats.IsBanned || stats.BanUntil.IsZero() || !stats.LastActiveAt.Equal(last) {
+		t.Errorf("Unexpected ban status or last activity: %+v", stats)
+	}
+
+	// Users without data return zero stats
+	empty, err := store.GetUserStats("nobody")
+	if err != nil || empty.Sessions != 0 || empty.IsBanned || !empty.LastActiveAt.IsZero() {
+		t.Errorf("Expected empty stats, got %+v (err %v)", empty, err)
+	}
+}
+
+func TestSQLiteStore_ModerationEvents(t *testing.T) {
+	tmpFile := "/tmp/agentize_test_moderation_events.db"
+	defer os.Remove(tmpFile)
+
+	store, err := NewSQLiteStore(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	start := time.Unix(time.Now().Unix(), 0)
+	strike := model.NewModerationEvent("user123", model.ModerationEventNonsenseStrike, model.ModerationActorAuto)
+	strike.MessageID = "msg-1"
+	strike.NonsenseCount = 3
+	strike.CreatedAt = start
+	ban := model.NewModerationEvent("user123", model.ModerationEventBan, model.ModerationActorAuto)
+	ban.MessageID = "msg-1"
+	ban.Reason = "Too many nonsense messages"
+	ban.Duration = 6 * time.Hour
+	ban.NonsenseCount = 3
+	ban.CreatedAt = start.Add(time.Second)
+	unban := model.NewModerationEvent("user123", model.ModerationEventUnban, model.ModerationActorAdmin)
+	unban.CreatedAt = start.Add(time.Minute)
+	other := model.NewModerationEvent("user456", model.ModerationEventBan, model.ModerationActorCore)
+	other.CreatedAt = start
+
+	for _, event := range []*model.ModerationEvent{strike, unban, ban, other} {
+		if err := store.PutModerationEvent(event); err != nil {
+			t.Fatalf("Failed to put moderation event: %v", err)
+		}
+	}
+
+	events, err := store.GetModerationEventsByUser("user123")
+	if err != nil {
+		t.Fatalf("GetModerationEventsByUser failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	if events[0].Type != model.ModerationEventUnban || events[1].Type != model.ModerationEventBan || events[2].Type != model.ModerationEventNonsenseStrike {
+		t.Errorf("Events not newest first: %s, %s, %s", events[0].Type, events[1].Type, events[2].Type)
+	}
+	got := events[1]
+	if got.EventID != ban.EventID || got.Actor != model.ModerationActorAuto || got.MessageID != "msg-1" ||
+		got.Reason != ban.Reason || got.Duration != 6*time.Hour || got.NonsenseCount != 3 || !got.CreatedAt.Equal(ban.CreatedAt) {
+		t.Errorf("Unexpected ban event: %+v", got)
+	}
+
+	// Deleting user data keeps the audit trail
+	if err := store.DeleteUserData("user123"); err != nil {
+		t.Fatalf("DeleteUserData failed: %v", err)
+	}
+	events, err = store.GetModerationEventsByUser("user123")
+	if err != nil || len(events) != 3 {
+		t.Errorf("Expected the moderation history to survive DeleteUserData, got %d events (err %v)", len(events), err)
+	}
+}
+
+func TestSQLiteStore_UsageSummary(t *testing.T) {
+	tmpFile := "/tmp/agentize_test_usage.db"
+	defer os.Remove(tmpFile)
+
+	store, err := NewSQLiteStore(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	start := time.Unix(time.Now().Unix(), 0)
+	put := func(userID, modelName string, prompt, completion int, cost float64, at time.Time) {
+		record := model.NewUsageRecord(userID, "session-1", modelName)
+		record.PromptTokens = prompt
+		record.CompletionTokens = completion
+		record.CostUSD = cost
+		record.CreatedAt = at
+		if err := store.PutUsageRecord(record); err != nil {
+			t.Fatalf("Failed to put usage record: %v", err)
+		}
+	}
+	put("user123", "gpt-4o", 1000, 200, 0.01, start)
+	put("user123", "gpt-4o", 500, 100, 0.005, start.Add(time.Minute))
+	put("user123", "gpt-5-nano", 300, 50, 0, start.Add(time.Hour))
+	put("user456", "gpt-4o", 100, 10, 0.001, start)
+
+	summary, err := store.GetUsageSummary("user123", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("GetUsageSummary failed: %v", err)
+	}
+	if summary.Calls != 3 || summary.PromptTokens != 1800 || summary.CompletionTokens != 350 || summary.TotalTokens() != 2150 {
+		t.Errorf("Unexpected user summary: %+v", summary)
+	}
+	if got := summary.ByModel["gpt-4o"]; got == nil || got.Calls != 2 || got.PromptTokens != 1500 || math.Abs(got.CostUSD-0.015) > 1e-9 {
+		t.Errorf("Unexpected gpt-4o usage: %+v", got)
+	}
+
+	// Time range bounds are inclusive
+	summary, err = store.GetUsageSummary("user123", start, start.Add(time.Minute))
+	if err != nil || summary.Calls != 2 || len(summary.ByModel) != 1 {
+		t.Errorf("Expected 2 calls of one model in range, got %+v (err %v)", summary, err)
+	}
+
+	// An empty user ID aggregates every user
+	summary, err = store.GetUsageSummary("", time.Time{}, time.Time{})
+	if err != nil || summary.Calls != 4 || math.Abs(summary.CostUSD-0.016) > 1e-9 {
+		t.Errorf("Unexpected summary of every user: %+v (err %v)", summary, err)
+	}
+
+	// Usage is consumption data and goes with the user's data
+	if err := store.DeleteUserData("user123"); err != nil {
+		t.Fatalf("DeleteUserData failed: %v", err)
+	}
+	summary, err = store.GetUsageSummary("user123", time.Time{}, time.Time{})
+	if err != nil || summary.Calls != 0 {
+		t.Errorf("Expected no usage after DeleteUserData, got %+v (err %v)", summary, err)
+	}
+}
+
+func TestSQLiteStore_Memories(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	first := model.NewMemoryRecord("user123", "Prefers email over phone", []float32{0.1, -0.5, 2})
+	second := model.NewMemoryRecord("user123", "Lives in Berlin", []float32{1, 0, 0})
+	second.CreatedAt = first.CreatedAt.Add(time.Second)
+	for _, memory := range []*model.MemoryRecord{second, first, model.NewMemoryRecord("user456", "Owns a cat", []float32{0, 1})} {
+		if err := store.PutMemory(memory); err != nil {
+			t.Fatalf("PutMemory failed: %v", err)
+		}
+	}
+
+	memories, err := store.GetMemoriesByUser("user123")
+	if err != nil {
+		t.Fatalf("GetMemoriesByUser failed: %v", err)
+	}
+	if len(memories) != 2 {
+		t.Fatalf("Expected 2 memories, got %d", len(memories))
+	}
+	got := memories[0]
+	if got.MemoryID != first.MemoryID || got.UserID != "user123" || got.Text != first.Text || !got.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("Unexpected first memory: %+v", got)
+	}
+	if len(got.Embedding) != 3 || got.Embedding[0] != 0.1 || got.Embedding[1] != -0.5 || got.Embedding[2] != 2 {
+		t.Errorf("Embedding did not round-trip: %v", got.Embedding)
+	}
+	if memories[1].Text != second.Text {
+		t.Errorf("Expected memories oldest first, got %q second", memories[1].Text)
+	}
+
+	// Facts keep their key, confidence and source session; the same key replaces the fact
+	fact := model.NewMemoryFact("user123", "session-1", "Preferred Tone", "Prefers a formal tone", 0.5, []float32{1})
+	if err := store.PutMemory(fact); err != nil {
+		t.Fatalf("PutMemory failed: %v", err)
+	}
+	if err := store.PutMemory(model.NewMemoryFact("user123", "session-2", "preferred_tone", "Prefers a casual tone", 0.75, []float32{1})); err != nil {
+		t.Fatalf("PutMemory failed: %v", err)
+	}
+	memories, _ = store.GetMemoriesByUser("user123")
+	if len(memories) != 3 {
+		t.Fatalf("Expected 3 memories, got %d", len(memories))
+	}
+	byID := map[string]*model.MemoryRecord{}
+	for _, memory := range memories {
+		byID[memory.MemoryID] = memory
+	}
+	got = byID[fact.MemoryID]
+	if got == nil || got.Key != "preferred_tone" || got.Text != "Prefers a casual tone" || got.Confidence != 0.75 || got.SessionID != "session-2" {
+		t.Errorf("Unexpected fact: %+v", got)
+	}
+
+	used := time.Now().Add(time.Hour)
+	if err := store.TouchMemories("user123", []string{first.MemoryID}, used); err != nil {
+		t.Fatalf("TouchMemories failed: %v", err)
+	}
+	memories, _ = store.GetMemoriesByUser("user123")
+	if !memories[0].LastUsedAt.Equal(used) || !memories[len(memories)-1].LastUsedAt.Equal(second.LastUsedAt) {
+		t.Errorf("Expected only the touched memory's last use to change, got %v and %v", memories[0].LastUsedAt, memories[len(memories)-1].LastUsedAt)
+	}
+
+	if deleted, err := store.DeleteMemories("user456", first.MemoryID); err != nil || deleted != 0 {
+		t.Errorf("Expected no deletion of another user's memory, got %d (err %v)", deleted, err)
+	}
+	if deleted, err := store.DeleteMemories("user123", fact.MemoryID); err != nil || deleted != 1 {
+		t.Errorf("Expected the fact deleted, got %d (err %v)", deleted, err)
+	}
+	if memories, _ = store.GetMemoriesByUser("user123"); len(memories) != 2 {
+		t.Errorf("Expected 2 memories after deleting one, got %d", len(memories))
+	}
+
+	if err := store.DeleteUserData("user123"); err != nil {
+		t.Fatalf("DeleteUserData failed: %v", err)
+	}
+	if memories, err := store.GetMemoriesByUser("user123"); err != nil || len(memories) != 0 {
+		t.Errorf("Expected no memories after DeleteUserData, got %d (err %v)", len(memories), err)
+	}
+	if memories, err := store.GetMemoriesByUser("user456"); err != nil || len(memories) != 1 {
+		t.Errorf("Expected another user's memories to survive, got %d (err %v)", len(memories), err)
+	}
+}
+
+func TestSQLiteStore_Feedback(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	put := func(feedback *model.Feedback) {
+		t.Helper()
+		if err := store.PutFeedback(feedback); err != nil {
+			t.Fatalf("PutFeedback failed: %v", err)
+		}
+	}
+	put(model.NewFeedback("user123", "user123-s1-m0002", model.FeedbackDown, "wrong price"))
+	put(model.NewFeedback("user456", "user123-s1-m0002", model.FeedbackUp, ""))
+	put(model.NewFeedback("user123", "user123-s1-m0004", model.FeedbackUp, ""))
+	// Rating a message again replaces the user's previous rating
+	put(model.NewFeedback("user123", "user123-s1-m0002", model.FeedbackUp, "fixed now"))
+
+	if err := store.PutFeedback(model.NewFeedback("user123", "user123-s1-m0002", 5, "")); err == nil {
+		t.Error("Expected an invalid rating to be rejected")
+	}
+
+	feedbacks, err := store.GetFeedbackByMessage("user123-s1-m0002")
+	if err != nil {
+		t.Fatalf("GetFeedbackByMessage failed: %v", err)
+	}
+	if len(feedbacks) != 2 {
+		t.Fatalf("Expected 2 ratings of the message, got %d", len(feedbacks))
+	}
+	got := feedbacks[0]
+	if got.UserID != "user123" || got.Rating != model.FeedbackUp || got.Comment != "fixed now" || got.SessionID != "user123-s1" {
+		t.Errorf("Expected the replaced rating first, got %+v", got)
+	}
+
+	stats, err := store.GetFeedbackStats(model.FeedbackFilter{})
+	if err != nil {
+		t.Fatalf("GetFeedbackStats failed: %v", err)
+	}
+	if stats.Total != 3 || stats.Up != 3 || stats.Down != 0 || stats.Comments != 1 {
+		t.Errorf("Unexpected stats of every user: %+v", stats)
+	}
+	stats, err = store.GetFeedbackStats(model.FeedbackFilter{UserID: "user123", MessageID: "user123-s1-m0002"})
+	if err != nil || stats.Total != 1 || stats.Up != 1 {
+		t.Errorf("Unexpected stats of one user and message: %+v (err %v)", stats, err)
+	}
+	stats, err = store.GetFeedbackStats(model.FeedbackFilter{From: time.Now().Add(time.Hour)})
+	if err != nil || stats.Total != 0 || stats.UpRatio() != 0 {
+		t.Errorf("Expected no feedback in a future range, got %+v (err %v)", stats, err)
+	}
+	byMessage, err := store.GetFeedbackStatsByMessages([]string{"user123-s1-m0002", "user123-s1-m0004", "user123-s1-m0006"})
+	if err != nil {
+		t.Fatalf("GetFeedbackStatsByMessages failed: %v", err)
+	}
+	if len(byMessage) != 2 || byMessage["user123-s1-m0002"].Total != 2 || byMessage["user123-s1-m0004"].Up != 1 {
+		t.Errorf("Unexpected stats by message: %+v", byMessage)
+	}
+
+	if err := store.DeleteUserData("user123"); err != nil {
+		t.Fatalf("DeleteUserData failed: %v", err)
+	}
+	stats, err = store.GetFeedbackStats(model.FeedbackFilter{SessionID: "user123-s1"})
+	if err != nil || stats.Total != 1 {
+		t.Errorf("Expected only another user's rating after DeleteUserData, got %+v (err %v)", stats, err)
+	}
+}
+
+func TestSQLiteStore_FindSessionsByTags(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	berlin := model.NewSessionWithType("user123", model.AgentTypeHigh)
+	berlin.SessionID = "user123-high-s0001"
+	berlin.Tags = []string{"Travel", "Berlin"}
+	paris := model.NewSessionWithType("user123", model.AgentTypeHigh)
+	paris.SessionID = "user123-high-s0002"
+	paris.Tags = []string{"travel", "paris"}
+	other := model.NewSessionWithType("user456", model.AgentTypeHigh)
+	other.Tags = []string{"berlin"}
+	for _, session := range []*model.Session{berlin, paris, other} {
+		if err := store.Put(session); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	ids := func(sessions []*model.Session) []string {
+		var ids []string
+		for _, s := range sessions {
+			ids = append(ids, s.SessionID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	found, err := store.FindSessionsByTags("user123", []string{"berlin", "PARIS"}, false)
+	if err != nil {
+		t.Fatalf("FindSessionsByTags failed: %v", err)
+	}
+	if got := ids(found); len(got) != 2 || got[0] != berlin.SessionID || got[1] != paris.SessionID {
+		t.Errorf("Expected both sessions of user123 with any tag, got %v", got)
+	}
+	found, _ = store.FindSessionsByTags("user123", []string{"travel", "berlin"}, true)
+	if got := ids(found); len(got) != 1 || got[0] != berlin.SessionID {
+		t.Errorf("Expected only the Berlin session with every tag, got %v", got)
+	}
+
+	// Retagging replaces the index entries
+	berlin.Tags = []string{"work"}
+	if err := store.Put(berlin); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if found, _ = store.FindSessionsByTags("user123", []string{"berlin"}, false); len(found) != 0 {
+		t.Errorf("Expected no session tagged berlin after retagging, got %v", ids(found))
+	}
+
+	if err := store.Delete(paris.SessionID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if found, _ = store.FindSessionsByTags("user123", []string{"travel"}, false); len(found) != 0 {
+		t.Errorf("Expected deleted session to be gone from the tag index, got %v", ids(found))
+	}
+	if found, _ = store.FindSessionsByTags("user456", []string{"berlin"}, false); len(found) != 1 {
+		t.Errorf("Expected user456's session, got %v", ids(found))
+	}
+}
+
+func TestSQLiteStore_SessionExportImport(t *testing.T) {
+	src, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer src.Close()
+	dst, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer dst.Close()
+
+	session := model.NewSessionWithID("user123", "user123-core-s0001", model.AgentTypeCore)
+	session.Title = "Refunds"
+	session.Msgs = append(session.Msgs,
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "Hello"},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "search"}}}},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "found"},
+	)
+	if err := src.Put(session); err != nil {
+		t.Fatalf("Failed to put session: %v", err)
+	}
+	messageID := session.GenerateMessageID()
+	src.PutMessage(&model.Message{MessageID: messageID, SessionID: session.SessionID, UserID: "user123", Role: "user", Content: "Hello", CreatedAt: time.Now()})
+	src.PutToolCall(&model.ToolCall{ToolCallID: "call_1", ToolID: session.GenerateToolID(), MessageID: messageID, SessionID: session.SessionID, UserID: "user123", FunctionName: "search", CreatedAt: time.Now()})
+	src.AddOpenedFile(model.NewOpenedFile(session, "root/refund", "Refund"))
+	src.PutSummarizationLog(model.NewSummarizationLog(session))
+
+	doc, err := model.NewSessionHandler(src, model.DefaultSessionHandlerConfig()).ExportSession(session.SessionID)
+	if err != nil {
+		t.Fatalf("ExportSession failed: %v", err)
+	}
+	if len(doc.Messages) != 1 || len(doc.ToolCalls) != 1 || len(doc.OpenedFiles) != 1 || len(doc.SummarizationLogs) != 1 {
+		t.Fatalf("Expected one record of each kind, got %+v", doc)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Failed to marshal export: %v", err)
+	}
+
+	importInto := func(opts model.ImportOptions) *model.Session {
+		t.Helper()
+		var decoded model.SessionExport
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Failed to unmarshal export: %v", err)
+		}
+		imported, err := model.NewSessionHandler(dst, model.DefaultSessionHandlerConfig()).ImportSession(&decoded, opts)
+		if err != nil {
+			t.Fatalf("ImportSession failed: %v", err)
+		}
+		return imported
+	}
+
+	// A free ID is kept
+	if imported := importInto(model.ImportOptions{}); imported.SessionID != "user123-core-s0001" {
+		t.Errorf("Expected the session ID to be kept, got %s", imported.SessionID)
+	}
+	got, err := dst.Get("user123-core-s0001")
+	if err != nil || got.Title != "Refunds" || len(got.Msgs) != 3 {
+		t.Fatalf("Unexpected imported session: %+v (err %v)", got, err)
+	}
+
+	// A taken ID is remapped, along with the record IDs derived from it
+	imported := importInto(model.ImportOptions{})
+	if imported.SessionID != "user123-core-s0002" {
+		t.Fatalf("Expected a new session ID on collision, got %s", imported.SessionID)
+	}
+	toolCalls, _ := dst.GetToolCallsBySession(imported.SessionID)
+	if len(toolCalls) != 1 || toolCalls[0].ToolID != "user123-core-s0002-t0001" || toolCalls[0].MessageID != "user123-core-s0002-m0001" ||
+		toolCalls[0].ToolCallID != "user123-core-s0002-call_1" {
+		t.Errorf("Expected remapped tool call IDs, got %+v", toolCalls)
+	}
+	if imported.Msgs[1].ToolCalls[0].ID != "user123-core-s0002-call_1" || imported.Msgs[2].ToolCallID != "user123-core-s0002-call_1" {
+		t.Errorf("Expected the session messages to point at the remapped tool call, got %+v", imported.Msgs)
+	}
+	if original, _ := dst.GetToolCallsBySession("user123-core-s0001"); len(original) != 1 || original[0].ToolCallID != "call_1" {
+		t.Errorf("Expected the first import to keep its tool call, got %+v", original)
+	}
+	messages, _ := dst.GetMessagesBySession("user123-core-s0001")
+	if len(messages) != 1 {
+		t.Errorf("Expected the first import to keep its messages, got %d", len(messages))
+	}
+
+	// Reassigning the owner gives the session the new user's ID
+	imported = importInto(model.ImportOptions{UserID: "user456"})
+	if imported.SessionID != "user456-core-s0001" || imported.UserID != "user456" {
+		t.Fatalf("Expected the session to move to user456, got %s (%s)", imported.SessionID, imported.UserID)
+	}
+	files, _ := dst.GetOpenedFilesBySession(imported.SessionID)
+	logs, _ := dst.GetSummarizationLogsBySession(imported.SessionID)
+	if len(files) != 1 || files[0].UserID != "user456" || len(logs) != 1 || logs[0].UserID != "user456" {
+		t.Errorf("Expected the records to move to user456, got files %+v, logs %+v", files, logs)
+	}
+}
+
+func TestSQLiteStore_NamespaceIsolation(t *testing.T) {
+	tmpFile := "/tmp/agentize_test_namespace.db"
+	defer os.Remove(tmpFile)
+
+	storeA, err := NewSQLiteStoreWithConfig(SQLiteStoreConfig{Path: tmpFile, Namespace: "tenant_a"})
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer storeA.Close()
+	storeB, err := NewSQLiteStoreWithConfig(SQLiteStoreConfig{Path: tmpFile, Namespace: "tenant%b"})
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer storeB.Close()
+
+	// The same user (and so the same session ID) in both namespaces
+	for _, s := range []*SQLiteStore{storeA, storeB} {
+		session := model.NewSessionWithType("user123", model.AgentTypeCore)
+		session.SessionID = "user123-core-s0001"
+		session.Title = s.Namespace()
+		if err := s.Put(session); err != nil {
+			t.Fatalf("Failed to put session: %v", err)
+		}
+		if err := s.PutMessage(&model.Message{
+			MessageID: "user123-core-s0001-m0001",
+			UserID:    "user123",
+			SessionID: session.SessionID,
+			Role:      "user",
+			Content:   s.Namespace(),
+			CreatedAt: time.Now(),
+		}); err != nil {
+			t.Fatalf("Failed to put message: %v", err)
+		}
+	}
+
+	for _, s := range []*SQLiteStore{storeA, storeB} {
+		sessions, err := s.List("user123")
+		if err != nil {
+			t.Fatalf("Failed to list sessions: %v", err)
+		}
+		if len(sessions) != 1 || sessions[0].Title != s.Namespace() {
+			t.Fatalf("%s: List crossed namespaces: %+v", s.Namespace(), sessions)
+		}
+		if sessions[0].SessionID != "user123-core-s0001" || sessions[0].UserID != "user123" {
+			t.Errorf("%s: IDs not returned without the namespace: %s / %s", s.Namespace(), sessions[0].SessionID, sessions[0].UserID)
+		}
+
+		all, err := s.GetAllSessions()
+		if err != nil {
+			t.Fatalf("Failed to get all sessions: %v", err)
+		}
+		if len(all) != 1 || len(all["user123"]) != 1 || all["user123"][0].Title != s.Namespace() {
+			t.Fatalf("%s: GetAllSessions crossed namespaces: %+v", s.Namespace(), all)
+		}
+
+		got, err := s.Get("user123-core-s0001")
+		if err != nil || got.Title != s.Namespace() {
+			t.Fatalf("%s: Get returned the wrong session: %+v, %v", s.Namespace(), got, err)
+		}
+
+		messages, err := s.GetAllMessages()
+		if err != nil {
+			t.Fatalf("Failed to get all messages: %v", err)
+		}
+		if len(messages) != 1 || messages[0].Content != s.Namespace() || messages[0].SessionID != "user123-core-s0001" {
+			t.Fatalf("%s: GetAllMessages crossed namespaces: %+v", s.Namespace(), messages)
+		}
+	}
+
+	// Deleting a user's data only affects its own namespace
+	if err := storeA.DeleteUserData("user123"); err != nil {
+		t.Fatalf("Failed to delete user data: %v", err)
+	}
+	if sessions, _ := storeB.List("user123"); len(sessions) != 1 {
+		t.Errorf("DeleteUserData crossed namespaces: %d sessions left in tenant%%b", len(sessions))
+	}
+
+	// An unscoped store over the same file sees both namespaces
+	unscoped, err := NewSQLiteStore(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	defer unscoped.Close()
+	if all, _ := unscoped.GetAllSessions(); len(all) != 1 {
+		t.Errorf("Expected 1 user in the unscoped store, got %d", len(all))
+	}
+
+	if _, err := NewSQLiteStoreWithConfig(SQLiteStoreConfig{Path: ":memory:", Namespace: "a:b"}); err == nil {
+		t.Error("Expected a namespace containing ':' to be rejected")
+	}
+}
+
+func TestSQLiteStore_BusyTimeout(t *testing.T) {
+	tmpFile := "/tmp/agentize_test_busy_timeout.db"
+	defer os.Remove(tmpFile)
+
+	for _, tc := range []struct {
+		timeout time.Duration
+		want    int
+	}{
+		{0, 5000},
+		{2 * time.Second, 2000},
+		{-1, 0},
+	} {
+		store, err := NewSQLiteStoreWithConfig(SQLiteStoreConfig{Path: tmpFile, BusyTimeout: tc.timeout})
+		if err != nil {
+			t.Fatalf("Failed to create SQLiteStore: %v", err)
+		}
+		var got int
+		if err := store.db.QueryRow("PRAGMA busy_timeout").Scan(&got); err != nil {
+			t.Fatalf("Failed to read busy_timeout: %v", err)
+		}
+		store.Close()
+		if got != tc.want {
+			t.Errorf("BusyTimeout %v: expected busy_timeout %d, got %d", tc.timeout, tc.want, got)
+		}
+	}
+}
+
+func TestSQLiteStore_VisitedNodesPersist(t *testing.T) {
+	tmpFile := "/tmp/agentize_test_visited_nodes.db"
+	defer os.Remove(tmpFile)
+
+	store, err := NewSQLiteStore(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to create SQLiteStore: %v", err)
+	}
+	store.AddVisitedNode("user123", &model.NodeDigest{Path: "root", Title: "Root"})
+	store.AddVisitedNode("user123", &model.NodeDigest{Path: "root/a", Title: "A", Hash: "h1"})
+	store.AddVisitedNode("user456", &model.NodeDigest{Path: "root/b", Title: "B"})
+	store.ClearVisitedNodes("user456")
+	store.Close()
+
+	// A reopened store has an empty cache and must read the nodes back
+	store, err = NewSQLiteStore(tmpFile)
+	if err != nil {
+		t.Fatalf("Failed to reopen SQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	if !store.HasVisitedNode("user123", "root/a") {
+		t.Error("Expected root/a to be visited after reopening")
+	}
+	nodes := store.GetVisitedNodes("user123")
+	if len(nodes) != 2 || nodes["root/a"] == nil || nodes["root/a"].Title != "A" || nodes["root/a"].Hash != "h1" {
+		t.Errorf("Expected 2 restored nodes, got %+v", nodes)
+	}
+	if paths := store.GetVisitedNodePaths("user456"); len(paths) != 0 {
+		t.Errorf("Expected cleared nodes to stay cleared, got %v", paths)
+	}
+
+	if err := store.DeleteUserData("user123"); err != nil {
+		t.Fatalf("Failed to delete user data: %v", err)
+	}
+	if store.HasVisitedNode("user123", "root") {
+		t.Error("Expected DeleteUserData to remove visited nodes")
+	}
+}